@@ -240,8 +240,9 @@ var _ = Describe("bosh-init", func() {
 		Expect(validatingSteps[0]).To(MatchRegexp("^  Validating stemcell" + stageFinishedPattern))
 		Expect(validatingSteps[1]).To(MatchRegexp("^  Validating releases" + stageFinishedPattern))
 		Expect(validatingSteps[2]).To(MatchRegexp("^  Validating deployment manifest" + stageFinishedPattern))
-		Expect(validatingSteps[3]).To(MatchRegexp("^  Validating cpi release" + stageFinishedPattern))
-		Expect(validatingSteps).To(HaveLen(4))
+		Expect(validatingSteps[3]).To(MatchRegexp("^  Validating job properties" + stageFinishedPattern))
+		Expect(validatingSteps[4]).To(MatchRegexp("^  Validating cpi release" + stageFinishedPattern))
+		Expect(validatingSteps).To(HaveLen(5))
 
 		installingSteps, doneIndex := findStage(outputLines, "installing CPI", doneIndex+1)
 		numInstallingSteps := len(installingSteps)
@@ -12,10 +12,11 @@ import (
 	boshuuid "github.com/cloudfoundry/bosh-agent/uuid"
 
 	bihttpclient "github.com/cloudfoundry/bosh-init/deployment/httpclient"
+	biinstallmanifest "github.com/cloudfoundry/bosh-init/installation/manifest"
 )
 
 type Factory interface {
-	Create(string) (Blobstore, error)
+	Create(string, biinstallmanifest.Cert) (Blobstore, error)
 }
 
 type blobstoreFactory struct {
@@ -32,14 +33,17 @@ func NewBlobstoreFactory(uuidGenerator boshuuid.Generator, fs boshsys.FileSystem
 	}
 }
 
-//TODO: rename NewBlobstore
-func (f blobstoreFactory) Create(blobstoreURL string) (Blobstore, error) {
+// TODO: rename NewBlobstore
+func (f blobstoreFactory) Create(blobstoreURL string, cert biinstallmanifest.Cert) (Blobstore, error) {
 	blobstoreConfig, err := f.parseBlobstoreURL(blobstoreURL)
 	if err != nil {
 		return nil, bosherr.WrapError(err, "Creating blobstore config")
 	}
 
-	httpClient := bihttpclient.DefaultClient
+	httpClient, err := bihttpclient.NewClient(cert.CA, cert.Certificate, cert.PrivateKey)
+	if err != nil {
+		return nil, bosherr.WrapError(err, "Creating blobstore http client")
+	}
 
 	davClient := boshdavcli.NewClient(boshdavcliconf.Config{
 		Endpoint: fmt.Sprintf("%s/blobs", blobstoreConfig.Endpoint),
@@ -56,6 +60,11 @@ func (f blobstoreFactory) parseBlobstoreURL(blobstoreURL string) (Config, error)
 		return Config{}, bosherr.WrapError(err, "Parsing Mbus URL")
 	}
 
+	// the agent only serves its blobstore over http, a NATS mbus needs a separate blobstore URL
+	if parsedURL.Scheme != "http" && parsedURL.Scheme != "https" {
+		return Config{}, bosherr.Errorf("Blobstore URL scheme '%s' is not supported, expected 'http' or 'https'", parsedURL.Scheme)
+	}
+
 	var username, password string
 	userInfo := parsedURL.User
 	if userInfo != nil {
@@ -2,10 +2,12 @@ package fakes
 
 import (
 	biblobstore "github.com/cloudfoundry/bosh-init/blobstore"
+	biinstallmanifest "github.com/cloudfoundry/bosh-init/installation/manifest"
 )
 
 type FakeBlobstoreFactory struct {
 	CreateBlobstoreURL string
+	CreateCert         biinstallmanifest.Cert
 	CreateBlobstore    biblobstore.Blobstore
 	CreateErr          error
 }
@@ -14,7 +16,8 @@ func NewFakeBlobstoreFactory() *FakeBlobstoreFactory {
 	return &FakeBlobstoreFactory{}
 }
 
-func (f *FakeBlobstoreFactory) Create(blobstoreURL string) (biblobstore.Blobstore, error) {
+func (f *FakeBlobstoreFactory) Create(blobstoreURL string, cert biinstallmanifest.Cert) (biblobstore.Blobstore, error) {
 	f.CreateBlobstoreURL = blobstoreURL
+	f.CreateCert = cert
 	return f.CreateBlobstore, f.CreateErr
 }
@@ -0,0 +1,157 @@
+package cloud
+
+import (
+	"encoding/json"
+	"reflect"
+	"syscall"
+	"time"
+
+	bosherr "github.com/cloudfoundry/bosh-agent/errors"
+	boshsys "github.com/cloudfoundry/bosh-agent/system"
+
+	bifile "github.com/cloudfoundry/bosh-init/common/file"
+)
+
+const (
+	CassetteModeRecord = "record"
+	CassetteModeReplay = "replay"
+)
+
+// The kinds of the recorded errors that are handled by kind, e.g. are not retried
+const (
+	CassetteErrorKindTimeout     = "timeout"
+	CassetteErrorKindInterrupted = "interrupted"
+)
+
+// CassetteConfig selects whether CPI commands are recorded to, or replayed from, the cassette file at Path.
+// CPI commands are run normally when Mode is empty.
+type CassetteConfig struct {
+	Mode string
+	Path string
+}
+
+// DefaultIgnoredArguments are the argument indexes of CPI methods that are generated by each deploy,
+// e.g. the agent ID of create_vm, and so are not compared when replaying.
+var DefaultIgnoredArguments = map[string][]int{
+	"create_vm": []int{0},
+}
+
+// Cassette is the file that CPI interactions are recorded in.
+// IgnoredArguments can be edited to tolerate other arguments that differ between the recording and the replay.
+type Cassette struct {
+	IgnoredArguments map[string][]int      `json:"ignored_arguments"`
+	Interactions     []CassetteInteraction `json:"interactions"`
+}
+
+// CassetteInteraction is a CPI command and its output.
+// Arguments have their secrets redacted.
+// Error is the message of the error returned when the CPI command could not be run, e.g. it timed out.
+// ErrorKind, ErrorTimeout and ErrorSignal record a TimeoutError or an InterruptedError, so that it is replayed with its type.
+type CassetteInteraction struct {
+	Method       string        `json:"method"`
+	Arguments    []interface{} `json:"arguments"`
+	Output       CmdOutput     `json:"output"`
+	Error        string        `json:"error,omitempty"`
+	ErrorKind    string        `json:"error_kind,omitempty"`
+	ErrorTimeout string        `json:"error_timeout,omitempty"`
+	ErrorSignal  int           `json:"error_signal,omitempty"`
+}
+
+// recordError records the error of a CPI command that could not be run
+func (i *CassetteInteraction) recordError(err error) {
+	i.Error = err.Error()
+
+	switch typedErr := err.(type) {
+	case TimeoutError:
+		i.ErrorKind = CassetteErrorKindTimeout
+		i.ErrorTimeout = typedErr.Timeout.String()
+	case InterruptedError:
+		i.ErrorKind = CassetteErrorKindInterrupted
+		if signal, ok := typedErr.Signal.(syscall.Signal); ok {
+			i.ErrorSignal = int(signal)
+		}
+	}
+}
+
+// replayedError returns the recorded error of a CPI command that could not be run, with its type
+func (i CassetteInteraction) replayedError() error {
+	switch i.ErrorKind {
+	case CassetteErrorKindTimeout:
+		timeout, err := time.ParseDuration(i.ErrorTimeout)
+		if err != nil {
+			return bosherr.WrapErrorf(err, "Parsing recorded timeout '%s' of CPI method '%s'", i.ErrorTimeout, i.Method)
+		}
+		return TimeoutError{Method: i.Method, Timeout: timeout}
+	case CassetteErrorKindInterrupted:
+		return InterruptedError{Method: i.Method, Signal: syscall.Signal(i.ErrorSignal)}
+	}
+	return bosherr.Error(i.Error)
+}
+
+// Matches returns true if the interaction is for the method and the redacted arguments,
+// not comparing the ignored argument indexes
+func (i CassetteInteraction) Matches(method string, arguments []interface{}, ignoredArguments map[string][]int) bool {
+	if i.Method != method || len(i.Arguments) != len(arguments) {
+		return false
+	}
+
+	ignored := map[int]bool{}
+	for _, index := range ignoredArguments[method] {
+		ignored[index] = true
+	}
+
+	for index, argument := range arguments {
+		if !ignored[index] && !reflect.DeepEqual(i.Arguments[index], argument) {
+			return false
+		}
+	}
+	return true
+}
+
+// cassetteArguments returns the arguments as they are stored in a cassette:
+// as unmarshalled JSON, so that they can be compared with the loaded arguments, with secrets redacted
+func cassetteArguments(args []interface{}) ([]interface{}, error) {
+	argsBytes, err := json.Marshal(args)
+	if err != nil {
+		return nil, bosherr.WrapError(err, "Marshalling arguments")
+	}
+
+	arguments := []interface{}{}
+	err = json.Unmarshal(argsBytes, &arguments)
+	if err != nil {
+		return nil, bosherr.WrapError(err, "Unmarshalling arguments")
+	}
+
+	for index, argument := range arguments {
+		arguments[index] = redact(argument)
+	}
+	return arguments, nil
+}
+
+func loadCassette(fs boshsys.FileSystem, path string) (Cassette, error) {
+	contents, err := fs.ReadFile(path)
+	if err != nil {
+		return Cassette{}, bosherr.WrapErrorf(err, "Reading cassette '%s'", path)
+	}
+
+	cassette := Cassette{}
+	err = json.Unmarshal(contents, &cassette)
+	if err != nil {
+		return Cassette{}, bosherr.WrapErrorf(err, "Unmarshalling cassette '%s'", path)
+	}
+	return cassette, nil
+}
+
+// saveCassette writes the cassette readable only by the current user, as CPI responses may contain credentials
+func saveCassette(fs boshsys.FileSystem, path string, cassette Cassette) error {
+	contents, err := json.MarshalIndent(cassette, "", "  ")
+	if err != nil {
+		return bosherr.WrapError(err, "Marshalling cassette")
+	}
+
+	err = bifile.WriteWithMode(fs, path, contents, 0600)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Writing cassette '%s'", path)
+	}
+	return nil
+}
@@ -24,12 +24,23 @@ type Cloud interface {
 	AttachDisk(vmCID, diskCID string) error
 	DetachDisk(vmCID, diskCID string) error
 	DeleteDisk(diskCID string) error
+	HasDisk(diskCID string) (bool, error)
+	GetDisks(vmCID string) (diskCIDs []string, err error)
+	SetVMMetadata(vmCID string, metadata VMMetadata) error
+	SnapshotDisk(diskCID string, metadata biproperty.Map) (snapshotCID string, err error)
+	DeleteSnapshot(snapshotCID string) error
+	RebootVM(vmCID string) error
+	Info() CPIInfo
 	fmt.Stringer
 }
 
+// VMMetadata tags the VM in the IaaS, e.g. with the deployment and job name
+type VMMetadata map[string]string
+
 type cloud struct {
 	cpiCmdRunner CPICmdRunner
 	context      CmdContext
+	info         CPIInfo
 	logger       boshlog.Logger
 	logTag       string
 }
@@ -37,11 +48,13 @@ type cloud struct {
 func NewCloud(
 	cpiCmdRunner CPICmdRunner,
 	directorID string,
+	info CPIInfo,
 	logger boshlog.Logger,
 ) Cloud {
 	return cloud{
 		cpiCmdRunner: cpiCmdRunner,
-		context:      CmdContext{DirectorID: directorID},
+		context:      CmdContext{DirectorID: directorID, APIVersion: info.ContextAPIVersion()},
+		info:         info,
 		logger:       logger,
 		logTag:       "cloud",
 	}
@@ -237,6 +250,98 @@ func (c cloud) DeleteDisk(diskCID string) error {
 	return nil
 }
 
+func (c cloud) HasDisk(diskCID string) (bool, error) {
+	c.logger.Debug(c.logTag, "Checking existence of disk '%s'", diskCID)
+	method := "has_disk"
+	cmdOutput, err := c.run(method, diskCID)
+	if err != nil {
+		return false, err
+	}
+
+	found, ok := cmdOutput.Result.(bool)
+	if !ok {
+		return false, bosherr.Errorf("Unexpected external CPI command result: '%#v'", cmdOutput.Result)
+	}
+	return found, nil
+}
+
+func (c cloud) GetDisks(vmCID string) ([]string, error) {
+	c.logger.Debug(c.logTag, "Getting disks of vm '%s'", vmCID)
+	method := "get_disks"
+	cmdOutput, err := c.run(method, vmCID)
+	if err != nil {
+		return []string{}, err
+	}
+
+	// for get_disks, the result is an array of disk cids
+	results, ok := cmdOutput.Result.([]interface{})
+	if !ok {
+		return []string{}, bosherr.Errorf("Unexpected external CPI command result: '%#v'", cmdOutput.Result)
+	}
+
+	diskCIDs := []string{}
+	for _, result := range results {
+		diskCID, ok := result.(string)
+		if !ok {
+			return []string{}, bosherr.Errorf("Unexpected external CPI command result: '%#v'", cmdOutput.Result)
+		}
+		diskCIDs = append(diskCIDs, diskCID)
+	}
+	return diskCIDs, nil
+}
+
+func (c cloud) SetVMMetadata(vmCID string, metadata VMMetadata) error {
+	c.logger.Debug(c.logTag, "Setting metadata of vm '%s': %#v", vmCID, metadata)
+	_, err := c.run("set_vm_metadata", vmCID, metadata)
+	return err
+}
+
+func (c cloud) SnapshotDisk(diskCID string, metadata biproperty.Map) (string, error) {
+	c.logger.Debug(c.logTag, "Snapshotting disk '%s'", diskCID)
+	method := "snapshot_disk"
+	cmdOutput, err := c.run(method, diskCID, metadata)
+	if err != nil {
+		return "", err
+	}
+
+	// for snapshot_disk, the result is a string of the snapshot cid
+	cidString, ok := cmdOutput.Result.(string)
+	if !ok {
+		return "", bosherr.Errorf("Unexpected external CPI command result: '%#v'", cmdOutput.Result)
+	}
+	return cidString, nil
+}
+
+func (c cloud) DeleteSnapshot(snapshotCID string) error {
+	c.logger.Debug(c.logTag, "Deleting snapshot '%s'", snapshotCID)
+	_, err := c.run("delete_snapshot", snapshotCID)
+	return err
+}
+
+func (c cloud) RebootVM(vmCID string) error {
+	c.logger.Debug(c.logTag, "Rebooting vm '%s'", vmCID)
+	_, err := c.run("reboot_vm", vmCID)
+	return err
+}
+
+// Info returns the info reported by the CPI when it was installed
+func (c cloud) Info() CPIInfo {
+	return c.info
+}
+
+// run returns the error response of the CPI as an Error, even if the command runner also returned an error,
+// so that callers can tell apart errors like NotImplementedError
+func (c cloud) run(method string, args ...interface{}) (CmdOutput, error) {
+	cmdOutput, err := c.cpiCmdRunner.Run(c.context, method, args...)
+	if cmdOutput.Error != nil {
+		return cmdOutput, NewCPIError(method, *cmdOutput.Error)
+	}
+	if err != nil {
+		return cmdOutput, bosherr.WrapErrorf(err, "Calling CPI '%s' method", method)
+	}
+	return cmdOutput, nil
+}
+
 func (c cloud) String() string {
 	return fmt.Sprintf("Cloud{Context=%s}", c.context)
 }
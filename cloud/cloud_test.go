@@ -25,7 +25,7 @@ var _ = Describe("Cloud", func() {
 	BeforeEach(func() {
 		fakeCPICmdRunner = fakebicloud.NewFakeCPICmdRunner()
 		logger := boshlog.NewLogger(boshlog.LevelNone)
-		cloud = NewCloud(fakeCPICmdRunner, "fake-director-id", logger)
+		cloud = NewCloud(fakeCPICmdRunner, "fake-director-id", CPIInfo{}, logger)
 		context = CmdContext{DirectorID: "fake-director-id"}
 	})
 
@@ -503,4 +503,245 @@ var _ = Describe("Cloud", func() {
 			return cloud.DeleteDisk("fake-disk-cid")
 		})
 	})
+
+	var itHandlesNotImplemented = func(method string, exec func() error) {
+		It("returns a NotImplemented cloud.Error when the CPI does not implement the method", func() {
+			fakeCPICmdRunner.RunCmdOutput = CmdOutput{
+				Error: &CmdError{
+					Type:    NotImplementedError,
+					Message: "fake-not-implemented",
+				},
+			}
+			fakeCPICmdRunner.RunErr = errors.New("fake-cpi-error-response")
+
+			err := exec()
+			Expect(err).To(HaveOccurred())
+			Expect(IsNotImplemented(err)).To(BeTrue())
+
+			cpiError, ok := err.(Error)
+			Expect(ok).To(BeTrue(), "Expected %s to implement the Error interface", cpiError)
+			Expect(cpiError.Method()).To(Equal(method))
+		})
+	}
+
+	Describe("Info", func() {
+		It("returns the info of the CPI", func() {
+			logger := boshlog.NewLogger(boshlog.LevelNone)
+			info := CPIInfo{APIVersion: 1, StemcellFormats: []string{"fake-format"}}
+			cloud = NewCloud(fakeCPICmdRunner, "fake-director-id", info, logger)
+
+			Expect(cloud.Info()).To(Equal(info))
+		})
+
+		It("sends the API version of the CPI in the context of CPI commands", func() {
+			logger := boshlog.NewLogger(boshlog.LevelNone)
+			cloud = NewCloud(fakeCPICmdRunner, "fake-director-id", CPIInfo{APIVersion: 1}, logger)
+
+			err := cloud.DeleteVM("fake-vm-cid")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fakeCPICmdRunner.RunInputs[0].Context).To(Equal(CmdContext{DirectorID: "fake-director-id", APIVersion: 1}))
+		})
+	})
+
+	Describe("CPIInfo", func() {
+		It("supports stemcells with one of the formats of the CPI", func() {
+			info := CPIInfo{StemcellFormats: []string{"fake-format-1", "fake-format-2"}}
+			Expect(info.SupportsStemcellFormats([]string{"fake-format-2"})).To(BeTrue())
+			Expect(info.SupportsStemcellFormats([]string{"fake-other-format"})).To(BeFalse())
+		})
+
+		It("supports all stemcells when the CPI or the stemcell does not report formats", func() {
+			Expect(CPIInfo{}.SupportsStemcellFormats([]string{"fake-format"})).To(BeTrue())
+			Expect(CPIInfo{StemcellFormats: []string{"fake-format"}}.SupportsStemcellFormats([]string{})).To(BeTrue())
+		})
+
+		It("negotiates the API version sent in the context", func() {
+			Expect(CPIInfo{}.ContextAPIVersion()).To(Equal(0))
+			Expect(CPIInfo{APIVersion: 1}.ContextAPIVersion()).To(Equal(1))
+			Expect(CPIInfo{APIVersion: SupportedAPIVersion + 1}.ContextAPIVersion()).To(Equal(SupportedAPIVersion))
+		})
+	})
+
+	Describe("HasDisk", func() {
+		It("returns true when the disk exists", func() {
+			fakeCPICmdRunner.RunCmdOutput = CmdOutput{
+				Result: true,
+			}
+
+			found, err := cloud.HasDisk("fake-disk-cid")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(found).To(BeTrue())
+
+			Expect(fakeCPICmdRunner.RunInputs).To(Equal([]fakebicloud.RunInput{
+				{
+					Context:   context,
+					Method:    "has_disk",
+					Arguments: []interface{}{"fake-disk-cid"},
+				},
+			}))
+		})
+
+		It("returns an error when executing the CPI command fails", func() {
+			fakeCPICmdRunner.RunErr = errors.New("fake-run-error")
+
+			_, err := cloud.HasDisk("fake-disk-cid")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("fake-run-error"))
+		})
+
+		itHandlesCPIErrors("has_disk", func() error {
+			_, err := cloud.HasDisk("fake-disk-cid")
+			return err
+		})
+
+		itHandlesNotImplemented("has_disk", func() error {
+			_, err := cloud.HasDisk("fake-disk-cid")
+			return err
+		})
+	})
+
+	Describe("GetDisks", func() {
+		It("returns the cids of the disks attached to the vm", func() {
+			fakeCPICmdRunner.RunCmdOutput = CmdOutput{
+				Result: []interface{}{"fake-disk-cid-1", "fake-disk-cid-2"},
+			}
+
+			diskCIDs, err := cloud.GetDisks("fake-vm-cid")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(diskCIDs).To(Equal([]string{"fake-disk-cid-1", "fake-disk-cid-2"}))
+
+			Expect(fakeCPICmdRunner.RunInputs).To(Equal([]fakebicloud.RunInput{
+				{
+					Context:   context,
+					Method:    "get_disks",
+					Arguments: []interface{}{"fake-vm-cid"},
+				},
+			}))
+		})
+
+		It("returns an error when the result is not a list of cids", func() {
+			fakeCPICmdRunner.RunCmdOutput = CmdOutput{
+				Result: []interface{}{1},
+			}
+
+			_, err := cloud.GetDisks("fake-vm-cid")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Unexpected external CPI command result"))
+		})
+
+		itHandlesCPIErrors("get_disks", func() error {
+			_, err := cloud.GetDisks("fake-vm-cid")
+			return err
+		})
+
+		itHandlesNotImplemented("get_disks", func() error {
+			_, err := cloud.GetDisks("fake-vm-cid")
+			return err
+		})
+	})
+
+	Describe("SetVMMetadata", func() {
+		It("executes the cpi job script with the correct arguments", func() {
+			metadata := VMMetadata{"deployment": "fake-deployment-name"}
+			err := cloud.SetVMMetadata("fake-vm-cid", metadata)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(fakeCPICmdRunner.RunInputs).To(Equal([]fakebicloud.RunInput{
+				{
+					Context:   context,
+					Method:    "set_vm_metadata",
+					Arguments: []interface{}{"fake-vm-cid", metadata},
+				},
+			}))
+		})
+
+		itHandlesCPIErrors("set_vm_metadata", func() error {
+			return cloud.SetVMMetadata("fake-vm-cid", VMMetadata{})
+		})
+
+		itHandlesNotImplemented("set_vm_metadata", func() error {
+			return cloud.SetVMMetadata("fake-vm-cid", VMMetadata{})
+		})
+	})
+
+	Describe("SnapshotDisk", func() {
+		It("returns the cid of the snapshot", func() {
+			fakeCPICmdRunner.RunCmdOutput = CmdOutput{
+				Result: "fake-snapshot-cid",
+			}
+
+			metadata := biproperty.Map{"deployment": "fake-deployment-name"}
+			snapshotCID, err := cloud.SnapshotDisk("fake-disk-cid", metadata)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(snapshotCID).To(Equal("fake-snapshot-cid"))
+
+			Expect(fakeCPICmdRunner.RunInputs).To(Equal([]fakebicloud.RunInput{
+				{
+					Context:   context,
+					Method:    "snapshot_disk",
+					Arguments: []interface{}{"fake-disk-cid", metadata},
+				},
+			}))
+		})
+
+		itHandlesCPIErrors("snapshot_disk", func() error {
+			_, err := cloud.SnapshotDisk("fake-disk-cid", biproperty.Map{})
+			return err
+		})
+
+		itHandlesNotImplemented("snapshot_disk", func() error {
+			_, err := cloud.SnapshotDisk("fake-disk-cid", biproperty.Map{})
+			return err
+		})
+	})
+
+	Describe("DeleteSnapshot", func() {
+		It("executes the cpi job script with the correct arguments", func() {
+			err := cloud.DeleteSnapshot("fake-snapshot-cid")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(fakeCPICmdRunner.RunInputs).To(Equal([]fakebicloud.RunInput{
+				{
+					Context:   context,
+					Method:    "delete_snapshot",
+					Arguments: []interface{}{"fake-snapshot-cid"},
+				},
+			}))
+		})
+
+		itHandlesCPIErrors("delete_snapshot", func() error {
+			return cloud.DeleteSnapshot("fake-snapshot-cid")
+		})
+
+		itHandlesNotImplemented("delete_snapshot", func() error {
+			return cloud.DeleteSnapshot("fake-snapshot-cid")
+		})
+	})
+
+	Describe("RebootVM", func() {
+		It("executes the cpi job script with the correct arguments", func() {
+			err := cloud.RebootVM("fake-vm-cid")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(fakeCPICmdRunner.RunInputs).To(Equal([]fakebicloud.RunInput{
+				{
+					Context:   context,
+					Method:    "reboot_vm",
+					Arguments: []interface{}{"fake-vm-cid"},
+				},
+			}))
+		})
+
+		It("returns an error when executing the CPI command fails", func() {
+			fakeCPICmdRunner.RunErr = errors.New("fake-run-error")
+
+			err := cloud.RebootVM("fake-vm-cid")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("fake-run-error"))
+		})
+
+		itHandlesNotImplemented("reboot_vm", func() error {
+			return cloud.RebootVM("fake-vm-cid")
+		})
+	})
 })
@@ -4,6 +4,10 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
 
 	bosherr "github.com/cloudfoundry/bosh-agent/errors"
 	boshlog "github.com/cloudfoundry/bosh-agent/logger"
@@ -18,6 +22,9 @@ type CmdInput struct {
 
 type CmdContext struct {
 	DirectorID string `json:"director_uuid"`
+
+	// APIVersion is only sent to CPIs that report their API version
+	APIVersion int `json:"api_version,omitempty"`
 }
 
 func (c CmdContext) String() string {
@@ -48,27 +55,62 @@ type CmdOutput struct {
 	Log    string      `json:"log"`
 }
 
+// Timeouts are the maximum durations of CPI commands by method, with a default for the other methods
+type Timeouts struct {
+	Default time.Duration
+	Methods map[string]time.Duration
+}
+
+var DefaultTimeouts = Timeouts{
+	Default: 10 * time.Minute,
+	Methods: map[string]time.Duration{
+		"create_stemcell": 1 * time.Hour,
+	},
+}
+
+func (t Timeouts) For(method string) time.Duration {
+	timeout, found := t.Methods[method]
+	if found {
+		return timeout
+	}
+	return t.Default
+}
+
+// cpiKillGracePeriod is how long a timed out or interrupted CPI command has to exit after SIGTERM before it is killed
+const cpiKillGracePeriod = 10 * time.Second
+
 type CPICmdRunner interface {
 	Run(context CmdContext, method string, args ...interface{}) (CmdOutput, error)
 }
 
 type cpiCmdRunner struct {
-	cmdRunner boshsys.CmdRunner
-	cpi       CPI
-	logger    boshlog.Logger
-	logTag    string
+	cmdRunner      boshsys.CmdRunner
+	cpi            CPI
+	timeouts       Timeouts
+	signalNotifier SignalNotifier
+	cpiLog         CPILog
+	logger         boshlog.Logger
+	logTag         string
 }
 
+// NewCPICmdRunner returns a CPICmdRunner that streams the CPI's stderr to the logger and the CPI log while the CPI runs,
+// and writes the requests and responses to the CPI log
 func NewCPICmdRunner(
 	cmdRunner boshsys.CmdRunner,
 	cpi CPI,
+	timeouts Timeouts,
+	signalNotifier SignalNotifier,
+	cpiLog CPILog,
 	logger boshlog.Logger,
 ) CPICmdRunner {
 	return &cpiCmdRunner{
-		cmdRunner: cmdRunner,
-		cpi:       cpi,
-		logger:    logger,
-		logTag:    "cpiCmdRunner",
+		cmdRunner:      cmdRunner,
+		cpi:            cpi,
+		timeouts:       timeouts,
+		signalNotifier: signalNotifier,
+		cpiLog:         cpiLog,
+		logger:         logger,
+		logTag:         "cpiCmdRunner",
 	}
 }
 
@@ -83,6 +125,15 @@ func (r *cpiCmdRunner) Run(context CmdContext, method string, args ...interface{
 		return CmdOutput{}, bosherr.WrapErrorf(err, "Marshalling external CPI command input %#v", cmdInput)
 	}
 
+	r.cpiLog.Write(method, "request", redactJSON(inputBytes))
+
+	stderrWriter := &cpiStderrWriter{
+		lineFunc: func(line string) {
+			r.logger.Info(r.logTag, "CPI '%s' method stderr: %s", method, line)
+			r.cpiLog.Write(method, "stderr", line)
+		},
+	}
+
 	cmdPath := r.cpi.ExecutablePath()
 	cmd := boshsys.Command{
 		Name: cmdPath,
@@ -93,24 +144,144 @@ func (r *cpiCmdRunner) Run(context CmdContext, method string, args ...interface{
 		},
 		UseIsolatedEnv: true,
 		Stdin:          bytes.NewReader(inputBytes),
+		Stderr:         stderrWriter,
 	}
-	stdout, stderr, exitCode, err := r.cmdRunner.RunComplexCommand(cmd)
-	r.logger.Debug(r.logTag, "Exit Code %d when executing external CPI command '%s'\nSTDIN: '%s'\nSTDOUT: '%s'\nSTDERR: '%s'", exitCode, cmdPath, string(inputBytes), stdout, stderr)
+	stdout, stderr, exitCode, err := r.runCommand(cmd, method)
+	stderrWriter.Flush()
+	if stderr == "" {
+		// the stderr of the result is only set by command runners that do not write to cmd.Stderr
+		stderr = stderrWriter.String()
+	}
+
+	switch typedErr := err.(type) {
+	case TimeoutError:
+		typedErr.LogPath = r.cpiLog.Path()
+		r.cpiLog.Write(method, "error", typedErr.Error())
+		return CmdOutput{}, typedErr
+	case InterruptedError:
+		typedErr.LogPath = r.cpiLog.Path()
+		r.cpiLog.Write(method, "error", typedErr.Error())
+		return CmdOutput{}, typedErr
+	}
+
+	r.logger.Debug(r.logTag, "Exit Code %d when executing external CPI command '%s'\nSTDIN: '%s'\nSTDOUT: '%s'\nSTDERR: '%s'", exitCode, cmdPath, redactJSON(inputBytes), stdout, stderr)
 	if err != nil {
-		return CmdOutput{}, bosherr.WrapErrorf(err, "Executing external CPI command: '%s'", cmdPath)
+		r.cpiLog.Write(method, "error", fmt.Sprintf("Exit code %d: %s", exitCode, err.Error()))
+		return CmdOutput{}, bosherr.WrapErrorf(err, "Executing external CPI command: '%s', see CPI log '%s'", cmdPath, r.cpiLog.Path())
 	}
 
 	cmdOutput := CmdOutput{}
 	err = json.Unmarshal([]byte(stdout), &cmdOutput)
 	if err != nil {
-		return CmdOutput{}, bosherr.WrapErrorf(err, "Unmarshalling external CPI command output: STDOUT: '%s', STDERR: '%s'", stdout, stderr)
+		r.cpiLog.Write(method, "response", stdout)
+		return CmdOutput{}, bosherr.WrapErrorf(err, "Unmarshalling external CPI command output: STDOUT: '%s', STDERR: '%s', see CPI log '%s'", stdout, stderr, r.cpiLog.Path())
 	}
 
-	r.logger.Debug(r.logTag, cmdOutput.Log)
+	if cmdOutput.Log != "" {
+		r.logger.Info(r.logTag, "CPI '%s' method log: %s", method, cmdOutput.Log)
+		r.cpiLog.Write(method, "log", cmdOutput.Log)
+	}
+
+	response, err := json.Marshal(CmdOutput{Result: cmdOutput.Result, Error: cmdOutput.Error})
+	if err == nil {
+		r.cpiLog.Write(method, "response", redactJSON(response))
+	}
 
 	if cmdOutput.Error != nil {
-		return cmdOutput, bosherr.Errorf("External CPI command for method '%s' returned an error: %s", method, cmdOutput.Error)
+		return cmdOutput, bosherr.Errorf("External CPI command for method '%s' returned an error: %s, see CPI log '%s'", method, cmdOutput.Error, r.cpiLog.Path())
 	}
 
-	return cmdOutput, err
+	return cmdOutput, nil
+}
+
+// runCommand runs the CPI command until it exits, its method times out, or bosh-init is interrupted.
+// A timed out or interrupted CPI command has its process group terminated.
+// A CPI command is not run at all when bosh-init was interrupted while no CPI command was running.
+func (r *cpiCmdRunner) runCommand(cmd boshsys.Command, method string) (string, string, int, error) {
+	if signal := r.signalNotifier.Interrupted(); signal != nil {
+		r.logger.Warn(r.logTag, "Not running external CPI command for method '%s', because bosh-init was interrupted by signal '%s'", method, signal)
+		return "", "", -1, InterruptedError{Method: method, Signal: signal}
+	}
+
+	signals := make(chan os.Signal, 1)
+	r.signalNotifier.Notify(signals)
+	defer r.signalNotifier.Stop(signals)
+
+	process, err := r.cmdRunner.RunComplexCommandAsync(cmd)
+	if err != nil {
+		return "", "", -1, err
+	}
+	resultCh := process.Wait()
+
+	timeout := r.timeouts.For(method)
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case result := <-resultCh:
+		return result.Stdout, result.Stderr, result.ExitStatus, result.Error
+
+	case <-timer.C:
+		r.logger.Error(r.logTag, "External CPI command for method '%s' timed out after %s, terminating it", method, timeout)
+		r.terminate(process, method)
+		return "", "", -1, TimeoutError{Method: method, Timeout: timeout}
+
+	case signal := <-signals:
+		r.logger.Warn(r.logTag, "Received signal '%s' while running external CPI command for method '%s', terminating it", signal, method)
+		r.terminate(process, method)
+		return "", "", -1, InterruptedError{Method: method, Signal: signal}
+	}
+}
+
+func (r *cpiCmdRunner) terminate(process boshsys.Process, method string) {
+	err := process.TerminateNicely(cpiKillGracePeriod)
+	if err != nil {
+		r.logger.Error(r.logTag, "Failed to terminate external CPI command for method '%s': %s", method, err.Error())
+	}
+}
+
+// cpiStderrWriter calls the line func with each line written to it, and keeps all the lines
+type cpiStderrWriter struct {
+	lineFunc func(line string)
+
+	lock    sync.Mutex
+	all     bytes.Buffer
+	partial bytes.Buffer
+}
+
+func (w *cpiStderrWriter) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.all.Write(p)
+	w.partial.Write(p)
+
+	for {
+		line, err := w.partial.ReadString('\n')
+		if err != nil {
+			// keep the incomplete line until the rest of it is written
+			w.partial.Reset()
+			w.partial.WriteString(line)
+			return len(p), nil
+		}
+		w.lineFunc(strings.TrimRight(line, "\r\n"))
+	}
+}
+
+// Flush calls the line func with the last line if it does not end with a new line
+func (w *cpiStderrWriter) Flush() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.partial.Len() > 0 {
+		w.lineFunc(w.partial.String())
+		w.partial.Reset()
+	}
+}
+
+func (w *cpiStderrWriter) String() string {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return w.all.String()
 }
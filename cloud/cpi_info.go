@@ -0,0 +1,108 @@
+package cloud
+
+import (
+	"encoding/json"
+
+	bosherr "github.com/cloudfoundry/bosh-agent/errors"
+	boshlog "github.com/cloudfoundry/bosh-agent/logger"
+	boshsys "github.com/cloudfoundry/bosh-agent/system"
+)
+
+// SupportedAPIVersion is the latest CPI API version that bosh-init implements
+const SupportedAPIVersion = 1
+
+// CPIInfo is the result of the CPI 'info' method.
+// It is empty for CPIs that do not implement 'info'.
+type CPIInfo struct {
+	APIVersion      int      `json:"api_version"`
+	StemcellFormats []string `json:"stemcell_formats"`
+}
+
+// ContextAPIVersion returns the API version sent in the context of CPI commands:
+// the latest version supported by both bosh-init and the CPI, or 0 (not sent) if the CPI did not report its version
+func (i CPIInfo) ContextAPIVersion() int {
+	if i.APIVersion > SupportedAPIVersion {
+		return SupportedAPIVersion
+	}
+	return i.APIVersion
+}
+
+// SupportsStemcellFormats returns true if the CPI handles one of the stemcell formats,
+// or if the CPI or the stemcell does not report its formats
+func (i CPIInfo) SupportsStemcellFormats(formats []string) bool {
+	if len(i.StemcellFormats) == 0 || len(formats) == 0 {
+		return true
+	}
+
+	for _, format := range formats {
+		for _, supportedFormat := range i.StemcellFormats {
+			if format == supportedFormat {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// requestCPIInfo calls the CPI 'info' method, without an API version in the context as it is not known yet.
+// Empty info is returned if the CPI does not implement 'info', which is cached,
+// or if 'info' fails with an error that is not ok to retry, which is not cached so that 'info' is called again by the next command.
+func requestCPIInfo(cpiCmdRunner CPICmdRunner, directorID string, logger boshlog.Logger) (info CPIInfo, cache bool, err error) {
+	c := cloud{
+		cpiCmdRunner: cpiCmdRunner,
+		context:      CmdContext{DirectorID: directorID},
+		logger:       logger,
+		logTag:       "cloud",
+	}
+
+	cmdOutput, err := c.run("info")
+	if err != nil {
+		if IsNotImplemented(err) {
+			logger.Info(c.logTag, "CPI does not implement info, assuming the original CPI API")
+			return CPIInfo{}, true, nil
+		}
+		if cloudErr, ok := err.(Error); ok && !cloudErr.OkToRetry() {
+			logger.Warn(c.logTag, "CPI info failed, assuming the original CPI API: %s", err.Error())
+			return CPIInfo{}, false, nil
+		}
+		return CPIInfo{}, false, err
+	}
+
+	resultBytes, err := json.Marshal(cmdOutput.Result)
+	if err != nil {
+		return CPIInfo{}, false, bosherr.WrapErrorf(err, "Marshalling external CPI command result: '%#v'", cmdOutput.Result)
+	}
+
+	err = json.Unmarshal(resultBytes, &info)
+	if err != nil {
+		return CPIInfo{}, false, bosherr.WrapErrorf(err, "Unexpected external CPI command result: '%#v'", cmdOutput.Result)
+	}
+	return info, true, nil
+}
+
+func loadCPIInfo(fs boshsys.FileSystem, path string) (CPIInfo, error) {
+	contents, err := fs.ReadFile(path)
+	if err != nil {
+		return CPIInfo{}, bosherr.WrapErrorf(err, "Reading CPI info '%s'", path)
+	}
+
+	info := CPIInfo{}
+	err = json.Unmarshal(contents, &info)
+	if err != nil {
+		return CPIInfo{}, bosherr.WrapErrorf(err, "Unmarshalling CPI info '%s'", path)
+	}
+	return info, nil
+}
+
+func saveCPIInfo(fs boshsys.FileSystem, path string, info CPIInfo) error {
+	contents, err := json.Marshal(info)
+	if err != nil {
+		return bosherr.WrapError(err, "Marshalling CPI info")
+	}
+
+	err = fs.WriteFile(path, contents)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Writing CPI info '%s'", path)
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package cloud
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	boshlog "github.com/cloudfoundry/bosh-agent/logger"
+	boshsys "github.com/cloudfoundry/bosh-agent/system"
+	boshtime "github.com/cloudfoundry/bosh-agent/time"
+)
+
+const (
+	CPILogMaxSize    = 10 * 1024 * 1024
+	CPILogMaxBackups = 5
+
+	redactedValue = "<redacted>"
+)
+
+var (
+	secretKeyRegexp   = regexp.MustCompile(`(?i)password|secret|private_key|token|credential|access_key`)
+	urlUserInfoRegexp = regexp.MustCompile(`://[^/@\s]+@`)
+)
+
+// CPILog records the requests and responses of CPI commands and the output of the CPI in a file.
+// The previous file is rotated to '<path>.1' by the first write of each bosh-init command,
+// and when the file grows larger than the max size, keeping up to max backups.
+type CPILog interface {
+	Path() string
+
+	// Write writes each line of the contents with the time, the CPI method and where the contents came from
+	Write(method, source, contents string)
+}
+
+type cpiLog struct {
+	path        string
+	maxSize     int64
+	maxBackups  int
+	fs          boshsys.FileSystem
+	timeService boshtime.Service
+	logger      boshlog.Logger
+	logTag      string
+
+	lock    sync.Mutex
+	started bool
+}
+
+func NewCPILog(
+	path string,
+	maxSize int64,
+	maxBackups int,
+	fs boshsys.FileSystem,
+	timeService boshtime.Service,
+	logger boshlog.Logger,
+) CPILog {
+	return &cpiLog{
+		path:        path,
+		maxSize:     maxSize,
+		maxBackups:  maxBackups,
+		fs:          fs,
+		timeService: timeService,
+		logger:      logger,
+		logTag:      "cpiLog",
+	}
+}
+
+func (l *cpiLog) Path() string {
+	return l.path
+}
+
+// Write does not return errors, so that failing to write the CPI log does not fail CPI commands
+func (l *cpiLog) Write(method, source, contents string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if !l.started || l.size() >= l.maxSize {
+		l.rotate()
+		l.started = true
+	}
+
+	file, err := l.fs.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		l.logger.Warn(l.logTag, "Failed to open CPI log '%s': %s", l.path, err.Error())
+		return
+	}
+	defer file.Close()
+
+	timestamp := l.timeService.Now().UTC().Format(time.RFC3339)
+	for _, line := range strings.Split(strings.TrimRight(contents, "\n"), "\n") {
+		_, err = file.Write([]byte(fmt.Sprintf("%s [%s] %s: %s\n", timestamp, method, source, line)))
+		if err != nil {
+			l.logger.Warn(l.logTag, "Failed to write CPI log '%s': %s", l.path, err.Error())
+			return
+		}
+	}
+}
+
+func (l *cpiLog) size() int64 {
+	if !l.fs.FileExists(l.path) {
+		return 0
+	}
+
+	file, err := l.fs.OpenFile(l.path, os.O_RDONLY, 0600)
+	if err != nil {
+		return 0
+	}
+	defer file.Close()
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return 0
+	}
+	return fileInfo.Size()
+}
+
+// rotate renames '<path>' to '<path>.1', '<path>.1' to '<path>.2', etc, dropping the oldest backup
+func (l *cpiLog) rotate() {
+	if l.size() == 0 {
+		return
+	}
+
+	for i := l.maxBackups - 1; i >= 0; i-- {
+		oldPath := l.backupPath(i)
+		if !l.fs.FileExists(oldPath) {
+			continue
+		}
+
+		err := l.fs.Rename(oldPath, l.backupPath(i+1))
+		if err != nil {
+			l.logger.Warn(l.logTag, "Failed to rotate CPI log '%s': %s", oldPath, err.Error())
+		}
+	}
+}
+
+func (l *cpiLog) backupPath(index int) string {
+	if index == 0 {
+		return l.path
+	}
+	return fmt.Sprintf("%s.%d", l.path, index)
+}
+
+// redactJSON returns the JSON with the values of keys that look like secrets (e.g. 'password')
+// and the credentials in URLs (e.g. the mbus URL) replaced.
+// Contents that are not JSON are returned unchanged.
+func redactJSON(contents []byte) string {
+	var value interface{}
+	err := json.Unmarshal(contents, &value)
+	if err != nil {
+		return string(contents)
+	}
+
+	// do not escape '<' and '>' so that the redacted values are readable
+	buffer := &bytes.Buffer{}
+	encoder := json.NewEncoder(buffer)
+	encoder.SetEscapeHTML(false)
+	err = encoder.Encode(redact(value))
+	if err != nil {
+		return string(contents)
+	}
+	return strings.TrimRight(buffer.String(), "\n")
+}
+
+func redact(value interface{}) interface{} {
+	switch typedValue := value.(type) {
+	case map[string]interface{}:
+		redactedMap := map[string]interface{}{}
+		for key, mapValue := range typedValue {
+			if mapValue != nil && secretKeyRegexp.MatchString(key) {
+				redactedMap[key] = redactedValue
+			} else {
+				redactedMap[key] = redact(mapValue)
+			}
+		}
+		return redactedMap
+	case []interface{}:
+		redactedList := make([]interface{}, len(typedValue))
+		for i, listValue := range typedValue {
+			redactedList[i] = redact(listValue)
+		}
+		return redactedList
+	case string:
+		return urlUserInfoRegexp.ReplaceAllString(typedValue, "://"+redactedValue+"@")
+	default:
+		return value
+	}
+}
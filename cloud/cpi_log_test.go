@@ -0,0 +1,99 @@
+package cloud_test
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	boshlog "github.com/cloudfoundry/bosh-agent/logger"
+	boshsys "github.com/cloudfoundry/bosh-agent/system"
+	faketime "github.com/cloudfoundry/bosh-agent/time/fakes"
+
+	. "github.com/cloudfoundry/bosh-init/cloud"
+)
+
+var _ = Describe("CPILog", func() {
+	var (
+		fs          boshsys.FileSystem
+		timeService *faketime.FakeService
+		logDir      string
+		logPath     string
+		cpiLog      CPILog
+	)
+
+	BeforeEach(func() {
+		logger := boshlog.NewLogger(boshlog.LevelNone)
+		fs = boshsys.NewOsFileSystem(logger)
+
+		var err error
+		logDir, err = fs.TempDir("cpi-log")
+		Expect(err).ToNot(HaveOccurred())
+		logPath = filepath.Join(logDir, "cpi.log")
+
+		timeService = &faketime.FakeService{}
+		now := time.Date(2015, 1, 2, 3, 4, 5, 0, time.UTC)
+		timeService.NowTimes = []time.Time{now, now, now, now, now, now, now, now}
+
+		cpiLog = NewCPILog(logPath, 200, 2, fs, timeService, logger)
+	})
+
+	AfterEach(func() {
+		err := fs.RemoveAll(logDir)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("returns its path", func() {
+		Expect(cpiLog.Path()).To(Equal(logPath))
+	})
+
+	It("writes each line with the time, method and source", func() {
+		cpiLog.Write("create_vm", "stderr", "fake-line-1\nfake-line-2\n")
+		cpiLog.Write("create_vm", "response", `{"result":"fake-cid"}`)
+
+		contents, err := fs.ReadFileString(logPath)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(contents).To(Equal(
+			"2015-01-02T03:04:05Z [create_vm] stderr: fake-line-1\n" +
+				"2015-01-02T03:04:05Z [create_vm] stderr: fake-line-2\n" +
+				"2015-01-02T03:04:05Z [create_vm] response: {\"result\":\"fake-cid\"}\n",
+		))
+	})
+
+	It("is readable only by the current user", func() {
+		cpiLog.Write("create_vm", "request", "fake-request")
+
+		fileInfo, err := os.Stat(logPath)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fileInfo.Mode().Perm()).To(Equal(os.FileMode(0600)))
+	})
+
+	It("rotates the log of the previous command on the first write", func() {
+		err := fs.WriteFileString(logPath, "fake-previous-log\n")
+		Expect(err).ToNot(HaveOccurred())
+
+		cpiLog.Write("create_vm", "request", "fake-request")
+
+		contents, err := fs.ReadFileString(logPath + ".1")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(contents).To(Equal("fake-previous-log\n"))
+
+		contents, err = fs.ReadFileString(logPath)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(contents).To(Equal("2015-01-02T03:04:05Z [create_vm] request: fake-request\n"))
+	})
+
+	It("rotates the log when it reaches the max size, keeping the max backups", func() {
+		line := "fake-line-that-is-long-enough-to-fill-the-log"
+		for i := 0; i < 8; i++ {
+			cpiLog.Write("create_vm", "stderr", line)
+		}
+
+		Expect(fs.FileExists(logPath)).To(BeTrue())
+		Expect(fs.FileExists(logPath + ".1")).To(BeTrue())
+		Expect(fs.FileExists(logPath + ".2")).To(BeTrue())
+		Expect(fs.FileExists(logPath + ".3")).To(BeFalse())
+	})
+})
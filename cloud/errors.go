@@ -2,12 +2,18 @@ package cloud
 
 import (
 	"fmt"
+	"os"
+	"time"
 )
 
 const (
 	VMNotFoundError       = "Bosh::Cloud::VMNotFound"
 	DiskNotFoundError     = "Bosh::Cloud::DiskNotFound"
 	StemcellNotFoundError = "Bosh::Cloud::StemcellNotFound"
+	NotImplementedError   = "Bosh::Clouds::NotImplemented"
+
+	// InvalidCallError is the response of the Ruby CPIs to methods they do not know
+	InvalidCallError = "InvalidCall"
 )
 
 type Error interface {
@@ -49,3 +55,40 @@ func (e cpiError) Message() string {
 func (e cpiError) OkToRetry() bool {
 	return e.cmdError.OkToRetry
 }
+
+// IsNotImplemented returns true if the CPI responded that it does not implement or does not know the method,
+// in which case optional CPI methods (e.g. set_vm_metadata) are skipped
+func IsNotImplemented(err error) bool {
+	cloudErr, ok := err.(Error)
+	return ok && (cloudErr.Type() == NotImplementedError || cloudErr.Type() == InvalidCallError)
+}
+
+// TimeoutError is returned when a CPI command runs for longer than the timeout of its method
+type TimeoutError struct {
+	Method  string
+	Timeout time.Duration
+	LogPath string
+}
+
+func (e TimeoutError) Error() string {
+	return fmt.Sprintf("CPI '%s' method timed out after %s%s", e.Method, e.Timeout, seeCPILog(e.LogPath))
+}
+
+// InterruptedError is returned when bosh-init receives a signal while a CPI command is running,
+// or before a CPI command is run after bosh-init received a signal
+type InterruptedError struct {
+	Method  string
+	Signal  os.Signal
+	LogPath string
+}
+
+func (e InterruptedError) Error() string {
+	return fmt.Sprintf("CPI '%s' method was interrupted by signal '%s'%s", e.Method, e.Signal, seeCPILog(e.LogPath))
+}
+
+func seeCPILog(logPath string) string {
+	if logPath == "" {
+		return ""
+	}
+	return fmt.Sprintf(", see CPI log '%s'", logPath)
+}
@@ -1,9 +1,13 @@
 package cloud
 
 import (
+	"path/filepath"
+	"time"
+
 	bosherr "github.com/cloudfoundry/bosh-agent/errors"
 	boshlog "github.com/cloudfoundry/bosh-agent/logger"
 	boshsys "github.com/cloudfoundry/bosh-agent/system"
+	boshtime "github.com/cloudfoundry/bosh-agent/time"
 
 	biinstall "github.com/cloudfoundry/bosh-init/installation"
 )
@@ -13,20 +17,31 @@ type Factory interface {
 }
 
 type factory struct {
-	fs        boshsys.FileSystem
-	cmdRunner boshsys.CmdRunner
-	logger    boshlog.Logger
+	fs             boshsys.FileSystem
+	cmdRunner      boshsys.CmdRunner
+	timeService    boshtime.Service
+	signalNotifier SignalNotifier
+	cassetteConfig CassetteConfig
+	logger         boshlog.Logger
+	logTag         string
 }
 
 func NewFactory(
 	fs boshsys.FileSystem,
 	cmdRunner boshsys.CmdRunner,
+	timeService boshtime.Service,
+	signalNotifier SignalNotifier,
+	cassetteConfig CassetteConfig,
 	logger boshlog.Logger,
 ) Factory {
 	return &factory{
-		fs:        fs,
-		cmdRunner: cmdRunner,
-		logger:    logger,
+		fs:             fs,
+		cmdRunner:      cmdRunner,
+		timeService:    timeService,
+		signalNotifier: signalNotifier,
+		cassetteConfig: cassetteConfig,
+		logger:         logger,
+		logTag:         "cloudFactory",
 	}
 }
 
@@ -35,15 +50,82 @@ func (f *factory) NewCloud(installation biinstall.Installation, directorID strin
 	target := installation.Target()
 	cpi := CPI{
 		JobPath:     cpiJob.Path,
-		JobsDir:     target.JobsPath(),
+		JobsDir:     filepath.Dir(cpiJob.Path),
 		PackagesDir: target.PackagesPath(),
 	}
 
 	cmdPath := cpi.ExecutablePath()
-	if !f.fs.FileExists(cmdPath) {
+	if f.cassetteConfig.Mode != CassetteModeReplay && !f.fs.FileExists(cmdPath) {
 		return nil, bosherr.Errorf("Installed CPI job '%s' does not contain the required executable '%s'", cpiJob.Name, cmdPath)
 	}
 
-	cpiCmdRunner := NewCPICmdRunner(f.cmdRunner, cpi, f.logger)
-	return NewCloud(cpiCmdRunner, directorID, f.logger), nil
+	timeouts := Timeouts{
+		Default: DefaultTimeouts.Default,
+		Methods: map[string]time.Duration{},
+	}
+	for method, timeout := range DefaultTimeouts.Methods {
+		timeouts.Methods[method] = timeout
+	}
+	for method, seconds := range installation.Manifest().Timeouts {
+		if method == "default" {
+			timeouts.Default = time.Duration(seconds) * time.Second
+		} else {
+			timeouts.Methods[method] = time.Duration(seconds) * time.Second
+		}
+	}
+
+	cpiLog := NewCPILog(filepath.Join(target.Path(), "cpi.log"), CPILogMaxSize, CPILogMaxBackups, f.fs, f.timeService, f.logger)
+
+	retries := installation.Manifest().Retries
+	retryConfig := RetryConfig{
+		MaxAttempts:  retries.MaxAttempts,
+		InitialDelay: time.Duration(retries.InitialDelay) * time.Second,
+		MaxDelay:     time.Duration(retries.MaxDelay) * time.Second,
+	}
+
+	var cpiCmdRunner CPICmdRunner
+	switch f.cassetteConfig.Mode {
+	case CassetteModeReplay:
+		f.logger.Info(f.logTag, "Replaying CPI commands from cassette '%s'", f.cassetteConfig.Path)
+		cpiCmdRunner = NewReplayingCPICmdRunner(f.cassetteConfig.Path, f.fs, f.logger)
+	case CassetteModeRecord:
+		f.logger.Info(f.logTag, "Recording CPI commands in cassette '%s'", f.cassetteConfig.Path)
+		cpiCmdRunner = NewRecordingCPICmdRunner(NewCPICmdRunner(f.cmdRunner, cpi, timeouts, f.signalNotifier, cpiLog, f.logger), f.cassetteConfig.Path, f.fs, f.logger)
+	default:
+		cpiCmdRunner = NewCPICmdRunner(f.cmdRunner, cpi, timeouts, f.signalNotifier, cpiLog, f.logger)
+	}
+
+	cpiCmdRunner = NewRetryingCPICmdRunner(cpiCmdRunner, retryConfig, f.timeService, f.logger)
+
+	info, err := f.cpiInfo(cpiCmdRunner, directorID, target)
+	if err != nil {
+		return nil, bosherr.WrapError(err, "Getting CPI info")
+	}
+
+	return NewCloud(cpiCmdRunner, directorID, info, f.logger), nil
+}
+
+// cpiInfo returns the info of the CPI of the installation target,
+// calling the CPI 'info' method only if it has not been called since the CPI was installed
+func (f *factory) cpiInfo(cpiCmdRunner CPICmdRunner, directorID string, target biinstall.Target) (CPIInfo, error) {
+	infoPath := target.CPIInfoPath()
+	if f.fs.FileExists(infoPath) {
+		return loadCPIInfo(f.fs, infoPath)
+	}
+
+	info, cache, err := requestCPIInfo(cpiCmdRunner, directorID, f.logger)
+	if err != nil {
+		return CPIInfo{}, err
+	}
+	f.logger.Debug(f.logTag, "CPI info: %#v", info)
+
+	if !cache {
+		return info, nil
+	}
+
+	err = saveCPIInfo(f.fs, infoPath, info)
+	if err != nil {
+		return CPIInfo{}, err
+	}
+	return info, nil
 }
@@ -0,0 +1,147 @@
+package cloud_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+
+	. "github.com/cloudfoundry/bosh-init/cloud"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	boshlog "github.com/cloudfoundry/bosh-agent/logger"
+	boshsys "github.com/cloudfoundry/bosh-agent/system"
+	fakesys "github.com/cloudfoundry/bosh-agent/system/fakes"
+	faketime "github.com/cloudfoundry/bosh-agent/time/fakes"
+
+	biinstall "github.com/cloudfoundry/bosh-init/installation"
+	biinstalljob "github.com/cloudfoundry/bosh-init/installation/job"
+	biinstallmanifest "github.com/cloudfoundry/bosh-init/installation/manifest"
+
+	fakebicloud "github.com/cloudfoundry/bosh-init/cloud/fakes"
+)
+
+var _ = Describe("Factory", func() {
+	var (
+		fs           *fakesys.FakeFileSystem
+		cmdRunner    *fakesys.FakeCmdRunner
+		installation biinstall.Installation
+		factory      Factory
+	)
+
+	BeforeEach(func() {
+		fs = fakesys.NewFakeFileSystem()
+		cmdRunner = fakesys.NewFakeCmdRunner()
+		logger := boshlog.NewLogger(boshlog.LevelNone)
+
+		target := biinstall.NewTarget("/fake-installation")
+		installedJob := biinstalljob.InstalledJob{Name: "cpi", Path: "/fake-installation/jobs/cpi"}
+		installation = biinstall.NewInstallation(target, installedJob, nil, biinstallmanifest.Manifest{}, nil)
+
+		err := fs.WriteFileString("/fake-installation/jobs/cpi/bin/cpi", "fake-cpi-executable")
+		Expect(err).ToNot(HaveOccurred())
+
+		factory = NewFactory(fs, cmdRunner, &faketime.FakeService{}, fakebicloud.NewFakeSignalNotifier(), CassetteConfig{}, logger)
+	})
+
+	var addCPIOutput = func(cmdOutput CmdOutput) {
+		outputBytes, err := json.Marshal(cmdOutput)
+		Expect(err).ToNot(HaveOccurred())
+
+		cmdRunner.AddProcess("/fake-installation/jobs/cpi/bin/cpi", &fakesys.FakeProcess{
+			WaitResult: boshsys.Result{Stdout: string(outputBytes)},
+		})
+	}
+
+	var cpiInput = func(index int) CmdInput {
+		Expect(len(cmdRunner.RunComplexCommands)).To(BeNumerically(">", index))
+		inputBytes, err := ioutil.ReadAll(cmdRunner.RunComplexCommands[index].Stdin)
+		Expect(err).ToNot(HaveOccurred())
+
+		input := CmdInput{}
+		err = json.Unmarshal(inputBytes, &input)
+		Expect(err).ToNot(HaveOccurred())
+		return input
+	}
+
+	Describe("NewCloud", func() {
+		It("calls the CPI info method and caches its result in the installation", func() {
+			addCPIOutput(CmdOutput{Result: map[string]interface{}{
+				"api_version":      2,
+				"stemcell_formats": []string{"fake-format"},
+			}})
+
+			cloud, err := factory.NewCloud(installation, "fake-director-id")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cloud.Info()).To(Equal(CPIInfo{APIVersion: 2, StemcellFormats: []string{"fake-format"}}))
+
+			input := cpiInput(0)
+			Expect(input.Method).To(Equal("info"))
+			Expect(input.Context).To(Equal(CmdContext{DirectorID: "fake-director-id"}))
+
+			cachedInfo, err := fs.ReadFileString("/fake-installation/cpi_info.json")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cachedInfo).To(Equal(`{"api_version":2,"stemcell_formats":["fake-format"]}`))
+		})
+
+		It("sends the latest API version supported by both bosh-init and the CPI in the context", func() {
+			err := fs.WriteFileString("/fake-installation/cpi_info.json", `{"api_version":2}`)
+			Expect(err).ToNot(HaveOccurred())
+			addCPIOutput(CmdOutput{Result: true})
+
+			cloud, err := factory.NewCloud(installation, "fake-director-id")
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = cloud.HasVM("fake-vm-cid")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(cpiInput(0).Context).To(Equal(CmdContext{DirectorID: "fake-director-id", APIVersion: SupportedAPIVersion}))
+		})
+
+		It("uses the cached info without calling the CPI", func() {
+			err := fs.WriteFileString("/fake-installation/cpi_info.json", `{"api_version":1,"stemcell_formats":["fake-format"]}`)
+			Expect(err).ToNot(HaveOccurred())
+
+			cloud, err := factory.NewCloud(installation, "fake-director-id")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cloud.Info()).To(Equal(CPIInfo{APIVersion: 1, StemcellFormats: []string{"fake-format"}}))
+			Expect(cmdRunner.RunComplexCommands).To(BeEmpty())
+		})
+
+		It("returns a cloud without info when the CPI does not implement info", func() {
+			addCPIOutput(CmdOutput{Error: &CmdError{Type: NotImplementedError, Message: "fake-not-implemented"}})
+
+			cloud, err := factory.NewCloud(installation, "fake-director-id")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cloud.Info()).To(Equal(CPIInfo{}))
+			Expect(fs.FileExists("/fake-installation/cpi_info.json")).To(BeTrue())
+		})
+
+		It("returns a cloud without info when the CPI does not know the info method", func() {
+			addCPIOutput(CmdOutput{Error: &CmdError{Type: InvalidCallError, Message: "Method is not known, got info"}})
+
+			cloud, err := factory.NewCloud(installation, "fake-director-id")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cloud.Info()).To(Equal(CPIInfo{}))
+			Expect(fs.FileExists("/fake-installation/cpi_info.json")).To(BeTrue())
+		})
+
+		It("returns a cloud without info, which is not cached, when the CPI info method fails with an error that is not ok to retry", func() {
+			addCPIOutput(CmdOutput{Error: &CmdError{Type: "Bosh::Clouds::CloudError", Message: "fake-info-error", OkToRetry: false}})
+
+			cloud, err := factory.NewCloud(installation, "fake-director-id")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cloud.Info()).To(Equal(CPIInfo{}))
+			Expect(fs.FileExists("/fake-installation/cpi_info.json")).To(BeFalse())
+		})
+
+		It("returns an error when the CPI info result is invalid", func() {
+			addCPIOutput(CmdOutput{Result: "fake-invalid-info"})
+
+			_, err := factory.NewCloud(installation, "fake-director-id")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("fake-invalid-info"))
+			Expect(fs.FileExists("/fake-installation/cpi_info.json")).To(BeFalse())
+		})
+	})
+})
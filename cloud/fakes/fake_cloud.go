@@ -1,6 +1,7 @@
 package fakes
 
 import (
+	bicloud "github.com/cloudfoundry/bosh-init/cloud"
 	biproperty "github.com/cloudfoundry/bosh-init/common/property"
 )
 
@@ -35,6 +36,29 @@ type FakeCloud struct {
 
 	DeleteStemcellInputs []DeleteStemcellInput
 	DeleteStemcellErr    error
+
+	HasDiskInputs []HasDiskInput
+	HasDiskFound  bool
+	HasDiskErr    error
+
+	GetDisksInput    GetDisksInput
+	GetDisksDiskCIDs []string
+	GetDisksErr      error
+
+	SetVMMetadataInputs []SetVMMetadataInput
+	SetVMMetadataErr    error
+
+	SnapshotDiskInputs      []SnapshotDiskInput
+	SnapshotDiskSnapshotCID string
+	SnapshotDiskErr         error
+
+	DeleteSnapshotInputs []DeleteSnapshotInput
+	DeleteSnapshotErr    error
+
+	RebootVMInput RebootVMInput
+	RebootVMErr   error
+
+	InfoResult bicloud.CPIInfo
 }
 
 type CreateStemcellInput struct {
@@ -82,10 +106,40 @@ type DeleteStemcellInput struct {
 	StemcellCID string
 }
 
+type HasDiskInput struct {
+	DiskCID string
+}
+
+type GetDisksInput struct {
+	VMCID string
+}
+
+type SetVMMetadataInput struct {
+	VMCID    string
+	Metadata bicloud.VMMetadata
+}
+
+type SnapshotDiskInput struct {
+	DiskCID  string
+	Metadata biproperty.Map
+}
+
+type DeleteSnapshotInput struct {
+	SnapshotCID string
+}
+
+type RebootVMInput struct {
+	VMCID string
+}
+
 func NewFakeCloud() *FakeCloud {
 	return &FakeCloud{
 		CreateStemcellInputs: []CreateStemcellInput{},
 		DeleteDiskInputs:     []DeleteDiskInput{},
+		HasDiskInputs:        []HasDiskInput{},
+		SetVMMetadataInputs:  []SetVMMetadataInput{},
+		SnapshotDiskInputs:   []SnapshotDiskInput{},
+		DeleteSnapshotInputs: []DeleteSnapshotInput{},
 	}
 }
 
@@ -174,6 +228,54 @@ func (c *FakeCloud) DeleteDisk(diskCID string) error {
 	return c.DeleteDiskErr
 }
 
+func (c *FakeCloud) HasDisk(diskCID string) (bool, error) {
+	c.HasDiskInputs = append(c.HasDiskInputs, HasDiskInput{
+		DiskCID: diskCID,
+	})
+	return c.HasDiskFound, c.HasDiskErr
+}
+
+func (c *FakeCloud) GetDisks(vmCID string) ([]string, error) {
+	c.GetDisksInput = GetDisksInput{
+		VMCID: vmCID,
+	}
+	return c.GetDisksDiskCIDs, c.GetDisksErr
+}
+
+func (c *FakeCloud) SetVMMetadata(vmCID string, metadata bicloud.VMMetadata) error {
+	c.SetVMMetadataInputs = append(c.SetVMMetadataInputs, SetVMMetadataInput{
+		VMCID:    vmCID,
+		Metadata: metadata,
+	})
+	return c.SetVMMetadataErr
+}
+
+func (c *FakeCloud) SnapshotDisk(diskCID string, metadata biproperty.Map) (string, error) {
+	c.SnapshotDiskInputs = append(c.SnapshotDiskInputs, SnapshotDiskInput{
+		DiskCID:  diskCID,
+		Metadata: metadata,
+	})
+	return c.SnapshotDiskSnapshotCID, c.SnapshotDiskErr
+}
+
+func (c *FakeCloud) DeleteSnapshot(snapshotCID string) error {
+	c.DeleteSnapshotInputs = append(c.DeleteSnapshotInputs, DeleteSnapshotInput{
+		SnapshotCID: snapshotCID,
+	})
+	return c.DeleteSnapshotErr
+}
+
+func (c *FakeCloud) RebootVM(vmCID string) error {
+	c.RebootVMInput = RebootVMInput{
+		VMCID: vmCID,
+	}
+	return c.RebootVMErr
+}
+
+func (c *FakeCloud) Info() bicloud.CPIInfo {
+	return c.InfoResult
+}
+
 func (c *FakeCloud) String() string {
 	return "FakeCloud{}"
 }
@@ -8,6 +8,14 @@ type FakeCPICmdRunner struct {
 	RunInputs    []RunInput
 	RunCmdOutput bicloud.CmdOutput
 	RunErr       error
+
+	// RunOutputs, if set, are returned by successive calls instead of RunCmdOutput and RunErr
+	RunOutputs []RunOutput
+}
+
+type RunOutput struct {
+	CmdOutput bicloud.CmdOutput
+	Err       error
 }
 
 type RunInput struct {
@@ -26,5 +34,12 @@ func (r *FakeCPICmdRunner) Run(context bicloud.CmdContext, method string, args .
 		Method:    method,
 		Arguments: args,
 	})
+
+	if len(r.RunOutputs) > 0 {
+		output := r.RunOutputs[0]
+		r.RunOutputs = r.RunOutputs[1:]
+		return output.CmdOutput, output.Err
+	}
+
 	return r.RunCmdOutput, r.RunErr
 }
@@ -0,0 +1,28 @@
+package fakes
+
+type FakeCPILog struct {
+	PathValue string
+	Writes    []CPILogWrite
+}
+
+type CPILogWrite struct {
+	Method   string
+	Source   string
+	Contents string
+}
+
+func NewFakeCPILog(path string) *FakeCPILog {
+	return &FakeCPILog{PathValue: path}
+}
+
+func (l *FakeCPILog) Path() string {
+	return l.PathValue
+}
+
+func (l *FakeCPILog) Write(method, source, contents string) {
+	l.Writes = append(l.Writes, CPILogWrite{
+		Method:   method,
+		Source:   source,
+		Contents: contents,
+	})
+}
@@ -0,0 +1,34 @@
+package fakes
+
+import (
+	"os"
+)
+
+type FakeSignalNotifier struct {
+	NotifiedChannels []chan<- os.Signal
+	StoppedChannels  []chan<- os.Signal
+
+	// Signal, if set, is sent to each channel when Notify is called
+	Signal os.Signal
+
+	InterruptedSignal os.Signal
+}
+
+func NewFakeSignalNotifier() *FakeSignalNotifier {
+	return &FakeSignalNotifier{}
+}
+
+func (n *FakeSignalNotifier) Notify(c chan<- os.Signal) {
+	n.NotifiedChannels = append(n.NotifiedChannels, c)
+	if n.Signal != nil {
+		c <- n.Signal
+	}
+}
+
+func (n *FakeSignalNotifier) Stop(c chan<- os.Signal) {
+	n.StoppedChannels = append(n.StoppedChannels, c)
+}
+
+func (n *FakeSignalNotifier) Interrupted() os.Signal {
+	return n.InterruptedSignal
+}
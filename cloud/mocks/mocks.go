@@ -125,6 +125,79 @@ func (_mr *_MockCloudRecorder) HasVM(arg0 interface{}) *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "HasVM", arg0)
 }
 
+func (_m *MockCloud) HasDisk(_param0 string) (bool, error) {
+	ret := _m.ctrl.Call(_m, "HasDisk", _param0)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockCloudRecorder) HasDisk(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "HasDisk", arg0)
+}
+
+func (_m *MockCloud) GetDisks(_param0 string) ([]string, error) {
+	ret := _m.ctrl.Call(_m, "GetDisks", _param0)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockCloudRecorder) GetDisks(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetDisks", arg0)
+}
+
+func (_m *MockCloud) SetVMMetadata(_param0 string, _param1 cloud.VMMetadata) error {
+	ret := _m.ctrl.Call(_m, "SetVMMetadata", _param0, _param1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockCloudRecorder) SetVMMetadata(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetVMMetadata", arg0, arg1)
+}
+
+func (_m *MockCloud) SnapshotDisk(_param0 string, _param1 property.Map) (string, error) {
+	ret := _m.ctrl.Call(_m, "SnapshotDisk", _param0, _param1)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockCloudRecorder) SnapshotDisk(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SnapshotDisk", arg0, arg1)
+}
+
+func (_m *MockCloud) DeleteSnapshot(_param0 string) error {
+	ret := _m.ctrl.Call(_m, "DeleteSnapshot", _param0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockCloudRecorder) DeleteSnapshot(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "DeleteSnapshot", arg0)
+}
+
+func (_m *MockCloud) RebootVM(_param0 string) error {
+	ret := _m.ctrl.Call(_m, "RebootVM", _param0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockCloudRecorder) RebootVM(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "RebootVM", arg0)
+}
+
+func (_m *MockCloud) Info() cloud.CPIInfo {
+	ret := _m.ctrl.Call(_m, "Info")
+	ret0, _ := ret[0].(cloud.CPIInfo)
+	return ret0
+}
+
+func (_mr *_MockCloudRecorder) Info() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Info")
+}
+
 func (_m *MockCloud) String() string {
 	ret := _m.ctrl.Call(_m, "String")
 	ret0, _ := ret[0].(string)
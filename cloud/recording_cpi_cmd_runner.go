@@ -0,0 +1,71 @@
+package cloud
+
+import (
+	"sync"
+
+	boshlog "github.com/cloudfoundry/bosh-agent/logger"
+	boshsys "github.com/cloudfoundry/bosh-agent/system"
+)
+
+type recordingCPICmdRunner struct {
+	cpiCmdRunner CPICmdRunner
+	cassettePath string
+	fs           boshsys.FileSystem
+	logger       boshlog.Logger
+	logTag       string
+
+	lock     sync.Mutex
+	cassette Cassette
+}
+
+// NewRecordingCPICmdRunner returns a CPICmdRunner that records each CPI command and its output in a new cassette file.
+// The cassette is written after each command, so that the commands before a failure are kept.
+func NewRecordingCPICmdRunner(
+	cpiCmdRunner CPICmdRunner,
+	cassettePath string,
+	fs boshsys.FileSystem,
+	logger boshlog.Logger,
+) CPICmdRunner {
+	return &recordingCPICmdRunner{
+		cpiCmdRunner: cpiCmdRunner,
+		cassettePath: cassettePath,
+		fs:           fs,
+		logger:       logger,
+		logTag:       "recordingCPICmdRunner",
+		cassette: Cassette{
+			IgnoredArguments: DefaultIgnoredArguments,
+			Interactions:     []CassetteInteraction{},
+		},
+	}
+}
+
+func (r *recordingCPICmdRunner) Run(context CmdContext, method string, args ...interface{}) (CmdOutput, error) {
+	cmdOutput, err := r.cpiCmdRunner.Run(context, method, args...)
+
+	// an error with a CPI error response is recreated from the output when replaying
+	interaction := CassetteInteraction{
+		Method: method,
+		Output: cmdOutput,
+	}
+	if err != nil && cmdOutput.Error == nil {
+		interaction.recordError(err)
+	}
+
+	arguments, argsErr := cassetteArguments(args)
+	if argsErr != nil {
+		r.logger.Warn(r.logTag, "Failed to record CPI method '%s' in cassette '%s': %s", method, r.cassettePath, argsErr.Error())
+		return cmdOutput, err
+	}
+	interaction.Arguments = arguments
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.cassette.Interactions = append(r.cassette.Interactions, interaction)
+	saveErr := saveCassette(r.fs, r.cassettePath, r.cassette)
+	if saveErr != nil {
+		r.logger.Warn(r.logTag, "Failed to record CPI method '%s' in cassette '%s': %s", method, r.cassettePath, saveErr.Error())
+	}
+
+	return cmdOutput, err
+}
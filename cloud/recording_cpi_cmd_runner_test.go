@@ -0,0 +1,124 @@
+package cloud_test
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"syscall"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	boshlog "github.com/cloudfoundry/bosh-agent/logger"
+	fakesys "github.com/cloudfoundry/bosh-agent/system/fakes"
+
+	fakebicloud "github.com/cloudfoundry/bosh-init/cloud/fakes"
+
+	. "github.com/cloudfoundry/bosh-init/cloud"
+)
+
+var _ = Describe("RecordingCPICmdRunner", func() {
+	var (
+		fakeCPICmdRunner *fakebicloud.FakeCPICmdRunner
+		fakeFs           *fakesys.FakeFileSystem
+		cpiCmdRunner     CPICmdRunner
+		context          CmdContext
+	)
+
+	BeforeEach(func() {
+		fakeCPICmdRunner = fakebicloud.NewFakeCPICmdRunner()
+		fakeFs = fakesys.NewFakeFileSystem()
+		logger := boshlog.NewLogger(boshlog.LevelNone)
+		cpiCmdRunner = NewRecordingCPICmdRunner(fakeCPICmdRunner, "/fake-cassette.json", fakeFs, logger)
+		context = CmdContext{DirectorID: "fake-director-id"}
+	})
+
+	readCassette := func() Cassette {
+		contents, err := fakeFs.ReadFile("/fake-cassette.json")
+		Expect(err).ToNot(HaveOccurred())
+
+		cassette := Cassette{}
+		err = json.Unmarshal(contents, &cassette)
+		Expect(err).ToNot(HaveOccurred())
+		return cassette
+	}
+
+	It("returns the output of the command and records it in the cassette", func() {
+		fakeCPICmdRunner.RunOutputs = []fakebicloud.RunOutput{
+			{CmdOutput: CmdOutput{Result: "fake-vm-cid"}},
+			{CmdOutput: CmdOutput{Result: nil}},
+		}
+
+		cmdOutput, err := cpiCmdRunner.Run(context, "create_vm", "fake-agent-id", map[string]interface{}{"password": "fake-password"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cmdOutput).To(Equal(CmdOutput{Result: "fake-vm-cid"}))
+
+		_, err = cpiCmdRunner.Run(context, "delete_vm", "fake-vm-cid")
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(readCassette()).To(Equal(Cassette{
+			IgnoredArguments: map[string][]int{"create_vm": []int{0}},
+			Interactions: []CassetteInteraction{
+				{
+					Method:    "create_vm",
+					Arguments: []interface{}{"fake-agent-id", map[string]interface{}{"password": "<redacted>"}},
+					Output:    CmdOutput{Result: "fake-vm-cid"},
+				},
+				{
+					Method:    "delete_vm",
+					Arguments: []interface{}{"fake-vm-cid"},
+					Output:    CmdOutput{Result: nil},
+				},
+			},
+		}))
+	})
+
+	It("writes the cassette readable only by the current user", func() {
+		_, err := cpiCmdRunner.Run(context, "delete_vm", "fake-vm-cid")
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(fakeFs.GetFileTestStat("/fake-cassette.json").FileMode).To(Equal(os.FileMode(0600)))
+	})
+
+	It("records commands that fail", func() {
+		fakeCPICmdRunner.RunOutputs = []fakebicloud.RunOutput{
+			{
+				CmdOutput: CmdOutput{Error: &CmdError{Type: "Bosh::Clouds::CloudError", Message: "fake-cpi-error"}},
+				Err:       errors.New("fake-cpi-error"),
+			},
+			{Err: errors.New("fake-execution-error")},
+		}
+
+		_, err := cpiCmdRunner.Run(context, "delete_vm", "fake-vm-cid-1")
+		Expect(err).To(HaveOccurred())
+		_, err = cpiCmdRunner.Run(context, "delete_vm", "fake-vm-cid-2")
+		Expect(err).To(HaveOccurred())
+
+		cassette := readCassette()
+		Expect(cassette.Interactions).To(HaveLen(2))
+		Expect(cassette.Interactions[0].Output.Error).To(Equal(&CmdError{Type: "Bosh::Clouds::CloudError", Message: "fake-cpi-error"}))
+		Expect(cassette.Interactions[0].Error).To(BeEmpty())
+		Expect(cassette.Interactions[1].Error).To(Equal("fake-execution-error"))
+	})
+
+	It("records the kind of the timeout and interrupted errors", func() {
+		fakeCPICmdRunner.RunOutputs = []fakebicloud.RunOutput{
+			{Err: TimeoutError{Method: "delete_vm", Timeout: 10 * time.Minute, LogPath: "/fake-cpi.log"}},
+			{Err: InterruptedError{Method: "delete_vm", Signal: syscall.SIGINT, LogPath: "/fake-cpi.log"}},
+		}
+
+		_, err := cpiCmdRunner.Run(context, "delete_vm", "fake-vm-cid-1")
+		Expect(err).To(HaveOccurred())
+		_, err = cpiCmdRunner.Run(context, "delete_vm", "fake-vm-cid-2")
+		Expect(err).To(HaveOccurred())
+
+		cassette := readCassette()
+		Expect(cassette.Interactions).To(HaveLen(2))
+		Expect(cassette.Interactions[0].Error).To(Equal("CPI 'delete_vm' method timed out after 10m0s, see CPI log '/fake-cpi.log'"))
+		Expect(cassette.Interactions[0].ErrorKind).To(Equal(CassetteErrorKindTimeout))
+		Expect(cassette.Interactions[0].ErrorTimeout).To(Equal("10m0s"))
+		Expect(cassette.Interactions[1].ErrorKind).To(Equal(CassetteErrorKindInterrupted))
+		Expect(cassette.Interactions[1].ErrorSignal).To(Equal(int(syscall.SIGINT)))
+	})
+})
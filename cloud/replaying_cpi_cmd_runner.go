@@ -0,0 +1,76 @@
+package cloud
+
+import (
+	"encoding/json"
+	"sync"
+
+	bosherr "github.com/cloudfoundry/bosh-agent/errors"
+	boshlog "github.com/cloudfoundry/bosh-agent/logger"
+	boshsys "github.com/cloudfoundry/bosh-agent/system"
+)
+
+type replayingCPICmdRunner struct {
+	cassettePath string
+	fs           boshsys.FileSystem
+	logger       boshlog.Logger
+	logTag       string
+
+	lock     sync.Mutex
+	cassette *Cassette
+	replayed map[int]bool
+}
+
+// NewReplayingCPICmdRunner returns a CPICmdRunner that does not run the CPI,
+// but returns the outputs recorded in the cassette file for the same methods and arguments.
+// Each recorded interaction is replayed once, in the recorded order.
+func NewReplayingCPICmdRunner(
+	cassettePath string,
+	fs boshsys.FileSystem,
+	logger boshlog.Logger,
+) CPICmdRunner {
+	return &replayingCPICmdRunner{
+		cassettePath: cassettePath,
+		fs:           fs,
+		logger:       logger,
+		logTag:       "replayingCPICmdRunner",
+		replayed:     map[int]bool{},
+	}
+}
+
+func (r *replayingCPICmdRunner) Run(context CmdContext, method string, args ...interface{}) (CmdOutput, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.cassette == nil {
+		cassette, err := loadCassette(r.fs, r.cassettePath)
+		if err != nil {
+			return CmdOutput{}, err
+		}
+		r.cassette = &cassette
+	}
+
+	arguments, err := cassetteArguments(args)
+	if err != nil {
+		return CmdOutput{}, bosherr.WrapErrorf(err, "Replaying CPI method '%s'", method)
+	}
+
+	for index, interaction := range r.cassette.Interactions {
+		if r.replayed[index] || !interaction.Matches(method, arguments, r.cassette.IgnoredArguments) {
+			continue
+		}
+		r.replayed[index] = true
+
+		r.logger.Debug(r.logTag, "Replaying interaction %d of cassette '%s' for CPI method '%s'", index, r.cassettePath, method)
+
+		if interaction.Error != "" {
+			return interaction.Output, interaction.replayedError()
+		}
+		if interaction.Output.Error != nil {
+			return interaction.Output, bosherr.Errorf("External CPI command for method '%s' returned an error: %s", method, interaction.Output.Error)
+		}
+		return interaction.Output, nil
+	}
+
+	argumentsBytes, _ := json.Marshal(arguments)
+	return CmdOutput{}, bosherr.Errorf("Expected to find a recorded interaction for CPI method '%s' with arguments '%s' in cassette '%s'", method, argumentsBytes, r.cassettePath)
+}
@@ -0,0 +1,128 @@
+package cloud_test
+
+import (
+	"errors"
+	"syscall"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	boshlog "github.com/cloudfoundry/bosh-agent/logger"
+	fakesys "github.com/cloudfoundry/bosh-agent/system/fakes"
+
+	. "github.com/cloudfoundry/bosh-init/cloud"
+)
+
+var _ = Describe("ReplayingCPICmdRunner", func() {
+	var (
+		fakeFs       *fakesys.FakeFileSystem
+		cpiCmdRunner CPICmdRunner
+		context      CmdContext
+	)
+
+	BeforeEach(func() {
+		fakeFs = fakesys.NewFakeFileSystem()
+		logger := boshlog.NewLogger(boshlog.LevelNone)
+		cpiCmdRunner = NewReplayingCPICmdRunner("/fake-cassette.json", fakeFs, logger)
+		context = CmdContext{DirectorID: "fake-director-id"}
+
+		err := fakeFs.WriteFileString("/fake-cassette.json", `{
+  "ignored_arguments": {"create_vm": [0]},
+  "interactions": [
+    {
+      "method": "create_vm",
+      "arguments": ["fake-recorded-agent-id", "fake-stemcell-cid", {"password": "<redacted>"}],
+      "output": {"result": "fake-vm-cid-1", "log": ""}
+    },
+    {
+      "method": "create_vm",
+      "arguments": ["fake-recorded-agent-id", "fake-stemcell-cid", {"password": "<redacted>"}],
+      "output": {"result": "fake-vm-cid-2", "log": ""}
+    },
+    {
+      "method": "delete_vm",
+      "arguments": ["fake-vm-cid-1"],
+      "output": {"result": null, "error": {"type": "Bosh::Clouds::VMNotFound", "message": "fake-vm-not-found", "ok_to_retry": false}, "log": ""}
+    },
+    {
+      "method": "delete_vm",
+      "arguments": ["fake-vm-cid-2"],
+      "output": {"result": null, "log": ""},
+      "error": "fake-execution-error"
+    },
+    {
+      "method": "delete_vm",
+      "arguments": ["fake-vm-cid-3"],
+      "output": {"result": null, "log": ""},
+      "error": "CPI 'delete_vm' method timed out after 10m0s",
+      "error_kind": "timeout",
+      "error_timeout": "10m0s"
+    },
+    {
+      "method": "delete_vm",
+      "arguments": ["fake-vm-cid-4"],
+      "output": {"result": null, "log": ""},
+      "error": "CPI 'delete_vm' method was interrupted by signal 'interrupt'",
+      "error_kind": "interrupted",
+      "error_signal": 2
+    }
+  ]
+}`)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("returns the recorded outputs of matching interactions in order, ignoring the ignored arguments", func() {
+		cmdOutput, err := cpiCmdRunner.Run(context, "create_vm", "fake-agent-id", "fake-stemcell-cid", map[string]interface{}{"password": "fake-password"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cmdOutput).To(Equal(CmdOutput{Result: "fake-vm-cid-1"}))
+
+		cmdOutput, err = cpiCmdRunner.Run(context, "create_vm", "other-agent-id", "fake-stemcell-cid", map[string]interface{}{"password": "other-password"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cmdOutput).To(Equal(CmdOutput{Result: "fake-vm-cid-2"}))
+	})
+
+	It("returns an error for a recorded CPI error response", func() {
+		cmdOutput, err := cpiCmdRunner.Run(context, "delete_vm", "fake-vm-cid-1")
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("fake-vm-not-found"))
+		Expect(cmdOutput.Error).To(Equal(&CmdError{Type: "Bosh::Clouds::VMNotFound", Message: "fake-vm-not-found"}))
+	})
+
+	It("returns the recorded error of a command that could not be run", func() {
+		_, err := cpiCmdRunner.Run(context, "delete_vm", "fake-vm-cid-2")
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(Equal("fake-execution-error"))
+	})
+
+	It("returns the recorded timeout and interrupted errors with their types, so that they are not retried", func() {
+		_, err := cpiCmdRunner.Run(context, "delete_vm", "fake-vm-cid-3")
+		Expect(err).To(Equal(TimeoutError{Method: "delete_vm", Timeout: 10 * time.Minute}))
+
+		_, err = cpiCmdRunner.Run(context, "delete_vm", "fake-vm-cid-4")
+		Expect(err).To(Equal(InterruptedError{Method: "delete_vm", Signal: syscall.SIGINT}))
+	})
+
+	It("returns an error when no interaction matches", func() {
+		_, err := cpiCmdRunner.Run(context, "create_vm", "fake-agent-id", "other-stemcell-cid", map[string]interface{}{})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(Equal(`Expected to find a recorded interaction for CPI method 'create_vm' with arguments '["fake-agent-id","other-stemcell-cid",{}]' in cassette '/fake-cassette.json'`))
+	})
+
+	It("replays each interaction only once", func() {
+		_, err := cpiCmdRunner.Run(context, "delete_vm", "fake-vm-cid-2")
+		Expect(err).To(HaveOccurred())
+
+		_, err = cpiCmdRunner.Run(context, "delete_vm", "fake-vm-cid-2")
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("Expected to find a recorded interaction"))
+	})
+
+	It("returns an error when the cassette cannot be read", func() {
+		fakeFs.ReadFileError = errors.New("fake-read-error")
+
+		_, err := cpiCmdRunner.Run(context, "delete_vm", "fake-vm-cid-1")
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("Reading cassette '/fake-cassette.json'"))
+	})
+})
@@ -0,0 +1,114 @@
+package cloud
+
+import (
+	"time"
+
+	boshlog "github.com/cloudfoundry/bosh-agent/logger"
+	boshtime "github.com/cloudfoundry/bosh-agent/time"
+)
+
+// RetryConfig configures how CPI commands that fail with a retryable error are retried.
+// The delay before each retry doubles, starting at InitialDelay, up to MaxDelay.
+type RetryConfig struct {
+	MaxAttempts  int
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+}
+
+var DefaultRetryConfig = RetryConfig{
+	MaxAttempts:  5,
+	InitialDelay: 1 * time.Second,
+	MaxDelay:     30 * time.Second,
+}
+
+// WithDefaults returns the config with the zero values replaced by the defaults
+func (c RetryConfig) WithDefaults() RetryConfig {
+	if c.MaxAttempts == 0 {
+		c.MaxAttempts = DefaultRetryConfig.MaxAttempts
+	}
+	if c.InitialDelay == 0 {
+		c.InitialDelay = DefaultRetryConfig.InitialDelay
+	}
+	if c.MaxDelay == 0 {
+		c.MaxDelay = DefaultRetryConfig.MaxDelay
+	}
+	return c
+}
+
+// nonIdempotentMethods create resources, so retrying them after an unknown failure could leak resources
+var nonIdempotentMethods = map[string]bool{
+	"create_stemcell": true,
+	"create_vm":       true,
+	"create_disk":     true,
+	"snapshot_disk":   true,
+}
+
+type retryingCPICmdRunner struct {
+	cpiCmdRunner CPICmdRunner
+	config       RetryConfig
+	timeService  boshtime.Service
+	logger       boshlog.Logger
+	logTag       string
+}
+
+// NewRetryingCPICmdRunner returns a CPICmdRunner that retries CPI commands with exponential backoff when:
+//   - the CPI responds with an error that is ok_to_retry, or
+//   - an idempotent command fails without a CPI error response (e.g. the CPI exits unexpectedly)
+//
+// Timed out and interrupted commands are not retried.
+func NewRetryingCPICmdRunner(
+	cpiCmdRunner CPICmdRunner,
+	config RetryConfig,
+	timeService boshtime.Service,
+	logger boshlog.Logger,
+) CPICmdRunner {
+	return &retryingCPICmdRunner{
+		cpiCmdRunner: cpiCmdRunner,
+		config:       config.WithDefaults(),
+		timeService:  timeService,
+		logger:       logger,
+		logTag:       "retryingCPICmdRunner",
+	}
+}
+
+func (r *retryingCPICmdRunner) Run(context CmdContext, method string, args ...interface{}) (CmdOutput, error) {
+	delay := r.config.InitialDelay
+
+	for attempt := 1; ; attempt++ {
+		cmdOutput, err := r.cpiCmdRunner.Run(context, method, args...)
+		if err == nil {
+			if attempt > 1 {
+				r.logger.Info(r.logTag, "CPI method '%s' succeeded on attempt %d of %d", method, attempt, r.config.MaxAttempts)
+			}
+			return cmdOutput, nil
+		}
+
+		if !r.isRetryable(method, cmdOutput, err) {
+			return cmdOutput, err
+		}
+
+		if attempt >= r.config.MaxAttempts {
+			r.logger.Error(r.logTag, "CPI method '%s' failed on attempt %d of %d, giving up: %s", method, attempt, r.config.MaxAttempts, err.Error())
+			return cmdOutput, err
+		}
+
+		r.logger.Warn(r.logTag, "CPI method '%s' failed on attempt %d of %d, retrying in %s: %s", method, attempt, r.config.MaxAttempts, delay, err.Error())
+		r.timeService.Sleep(delay)
+
+		delay *= 2
+		if delay > r.config.MaxDelay {
+			delay = r.config.MaxDelay
+		}
+	}
+}
+
+func (r *retryingCPICmdRunner) isRetryable(method string, cmdOutput CmdOutput, err error) bool {
+	switch err.(type) {
+	case TimeoutError, InterruptedError:
+		return false
+	}
+	if cmdOutput.Error != nil {
+		return cmdOutput.Error.OkToRetry
+	}
+	return !nonIdempotentMethods[method]
+}
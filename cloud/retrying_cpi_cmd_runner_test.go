@@ -0,0 +1,142 @@
+package cloud_test
+
+import (
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	boshlog "github.com/cloudfoundry/bosh-agent/logger"
+	faketime "github.com/cloudfoundry/bosh-agent/time/fakes"
+
+	fakebicloud "github.com/cloudfoundry/bosh-init/cloud/fakes"
+
+	. "github.com/cloudfoundry/bosh-init/cloud"
+)
+
+var _ = Describe("RetryingCPICmdRunner", func() {
+	var (
+		fakeCPICmdRunner *fakebicloud.FakeCPICmdRunner
+		fakeTimeService  *faketime.FakeService
+		cpiCmdRunner     CPICmdRunner
+		context          CmdContext
+
+		retryableOutput = fakebicloud.RunOutput{
+			CmdOutput: CmdOutput{Error: &CmdError{Type: "Bosh::Clouds::CloudError", Message: "fake-rate-limited", OkToRetry: true}},
+			Err:       errors.New("fake-rate-limited"),
+		}
+		notRetryableOutput = fakebicloud.RunOutput{
+			CmdOutput: CmdOutput{Error: &CmdError{Type: "Bosh::Clouds::CloudError", Message: "fake-quota-exceeded", OkToRetry: false}},
+			Err:       errors.New("fake-quota-exceeded"),
+		}
+		executionFailedOutput = fakebicloud.RunOutput{
+			Err: errors.New("fake-execution-error"),
+		}
+		successOutput = fakebicloud.RunOutput{
+			CmdOutput: CmdOutput{Result: "fake-cid"},
+		}
+	)
+
+	BeforeEach(func() {
+		fakeCPICmdRunner = fakebicloud.NewFakeCPICmdRunner()
+		fakeTimeService = &faketime.FakeService{}
+		logger := boshlog.NewLogger(boshlog.LevelNone)
+		config := RetryConfig{MaxAttempts: 4, InitialDelay: 1 * time.Second, MaxDelay: 3 * time.Second}
+		cpiCmdRunner = NewRetryingCPICmdRunner(fakeCPICmdRunner, config, fakeTimeService, logger)
+		context = CmdContext{DirectorID: "fake-director-id"}
+	})
+
+	It("returns the output of a successful command without retrying", func() {
+		fakeCPICmdRunner.RunOutputs = []fakebicloud.RunOutput{successOutput}
+
+		cmdOutput, err := cpiCmdRunner.Run(context, "create_vm", "fake-agent-id")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cmdOutput).To(Equal(CmdOutput{Result: "fake-cid"}))
+		Expect(fakeCPICmdRunner.RunInputs).To(Equal([]fakebicloud.RunInput{
+			{Context: context, Method: "create_vm", Arguments: []interface{}{"fake-agent-id"}},
+		}))
+		Expect(fakeTimeService.SleepInputs).To(BeEmpty())
+	})
+
+	It("retries errors that are ok to retry with exponential backoff", func() {
+		fakeCPICmdRunner.RunOutputs = []fakebicloud.RunOutput{retryableOutput, retryableOutput, retryableOutput, successOutput}
+
+		cmdOutput, err := cpiCmdRunner.Run(context, "create_vm", "fake-agent-id")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cmdOutput).To(Equal(CmdOutput{Result: "fake-cid"}))
+		Expect(fakeCPICmdRunner.RunInputs).To(HaveLen(4))
+		Expect(fakeTimeService.SleepInputs).To(Equal([]time.Duration{1 * time.Second, 2 * time.Second, 3 * time.Second}))
+	})
+
+	It("returns the last error when the max attempts are used up", func() {
+		fakeCPICmdRunner.RunOutputs = []fakebicloud.RunOutput{retryableOutput, retryableOutput, retryableOutput, retryableOutput, successOutput}
+
+		cmdOutput, err := cpiCmdRunner.Run(context, "attach_disk", "fake-vm-cid", "fake-disk-cid")
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(Equal("fake-rate-limited"))
+		Expect(cmdOutput.Error.OkToRetry).To(BeTrue())
+		Expect(fakeCPICmdRunner.RunInputs).To(HaveLen(4))
+	})
+
+	It("does not retry errors that are not ok to retry", func() {
+		fakeCPICmdRunner.RunOutputs = []fakebicloud.RunOutput{notRetryableOutput, successOutput}
+
+		_, err := cpiCmdRunner.Run(context, "attach_disk", "fake-vm-cid", "fake-disk-cid")
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(Equal("fake-quota-exceeded"))
+		Expect(fakeCPICmdRunner.RunInputs).To(HaveLen(1))
+	})
+
+	Context("when the command fails without a CPI error response", func() {
+		BeforeEach(func() {
+			fakeCPICmdRunner.RunOutputs = []fakebicloud.RunOutput{executionFailedOutput, successOutput}
+		})
+
+		It("retries idempotent methods", func() {
+			_, err := cpiCmdRunner.Run(context, "delete_vm", "fake-vm-cid")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fakeCPICmdRunner.RunInputs).To(HaveLen(2))
+		})
+
+		It("does not retry methods that create resources", func() {
+			for _, method := range []string{"create_stemcell", "create_vm", "create_disk", "snapshot_disk"} {
+				fakeCPICmdRunner.RunInputs = []fakebicloud.RunInput{}
+				fakeCPICmdRunner.RunOutputs = []fakebicloud.RunOutput{executionFailedOutput, successOutput}
+
+				_, err := cpiCmdRunner.Run(context, method)
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(Equal("fake-execution-error"))
+				Expect(fakeCPICmdRunner.RunInputs).To(HaveLen(1))
+			}
+		})
+	})
+
+	It("does not retry timed out or interrupted commands", func() {
+		fakeCPICmdRunner.RunOutputs = []fakebicloud.RunOutput{{Err: TimeoutError{Method: "delete_vm", Timeout: 1 * time.Minute}}, successOutput}
+
+		_, err := cpiCmdRunner.Run(context, "delete_vm", "fake-vm-cid")
+		Expect(err).To(HaveOccurred())
+		Expect(fakeCPICmdRunner.RunInputs).To(HaveLen(1))
+
+		fakeCPICmdRunner.RunInputs = []fakebicloud.RunInput{}
+		fakeCPICmdRunner.RunOutputs = []fakebicloud.RunOutput{{Err: InterruptedError{Method: "delete_vm"}}, successOutput}
+
+		_, err = cpiCmdRunner.Run(context, "delete_vm", "fake-vm-cid")
+		Expect(err).To(HaveOccurred())
+		Expect(fakeCPICmdRunner.RunInputs).To(HaveLen(1))
+	})
+
+	It("uses the defaults for zero config values", func() {
+		cpiCmdRunner = NewRetryingCPICmdRunner(fakeCPICmdRunner, RetryConfig{}, fakeTimeService, boshlog.NewLogger(boshlog.LevelNone))
+		fakeCPICmdRunner.RunOutputs = []fakebicloud.RunOutput{}
+		for i := 0; i < 10; i++ {
+			fakeCPICmdRunner.RunOutputs = append(fakeCPICmdRunner.RunOutputs, retryableOutput)
+		}
+
+		_, err := cpiCmdRunner.Run(context, "create_vm")
+		Expect(err).To(HaveOccurred())
+		Expect(fakeCPICmdRunner.RunInputs).To(HaveLen(DefaultRetryConfig.MaxAttempts))
+		Expect(fakeTimeService.SleepInputs).To(Equal([]time.Duration{1 * time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second}))
+	})
+})
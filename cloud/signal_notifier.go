@@ -0,0 +1,185 @@
+package cloud
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	boshlog "github.com/cloudfoundry/bosh-agent/logger"
+
+	biui "github.com/cloudfoundry/bosh-init/ui"
+)
+
+// SignalSource relays the signals that interrupt bosh-init to a channel, until Stop is called
+type SignalSource interface {
+	Notify(c chan<- os.Signal)
+	Stop(c chan<- os.Signal)
+}
+
+type osSignalSource struct{}
+
+func NewOSSignalSource() SignalSource {
+	return osSignalSource{}
+}
+
+// Notify relays SIGINT and SIGTERM to the channel instead of terminating bosh-init, until Stop is called
+func (s osSignalSource) Notify(c chan<- os.Signal) {
+	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
+}
+
+func (s osSignalSource) Stop(c chan<- os.Signal) {
+	signal.Stop(c)
+}
+
+// SignalNotifier relays the signals that interrupt bosh-init, so that they can be forwarded to a running CPI command.
+// The CPI runs in its own process group, so it does not receive the SIGINT from a Ctrl-C in the terminal.
+type SignalNotifier interface {
+	SignalSource
+
+	// Interrupted returns the signal that interrupted bosh-init while no CPI command was running, or nil
+	Interrupted() os.Signal
+}
+
+// SignalTrap is the SignalNotifier of a whole command run. Between Trap and Release, the signals of its source do not terminate bosh-init.
+// A signal is relayed to the running CPI commands. A signal received between CPI commands makes the next one fail without running,
+// so that the command stops and releases what it holds, e.g. the deployment lock, on the way out.
+// A second signal received between CPI commands calls the OnExit funcs and exits without waiting for the next CPI command.
+type SignalTrap interface {
+	SignalNotifier
+
+	Trap()
+	Release()
+	OnExit(cleanup func())
+}
+
+type signalTrap struct {
+	source SignalSource
+	exit   func(int)
+	ui     biui.UI
+	logger boshlog.Logger
+	logTag string
+
+	lock        sync.Mutex
+	signals     chan os.Signal
+	channels    []chan<- os.Signal
+	interrupted os.Signal
+	cleanups    []func()
+}
+
+// NewSignalTrap returns a SignalTrap of the signals of source that exits with exit, e.g. os.Exit
+func NewSignalTrap(source SignalSource, exit func(int), ui biui.UI, logger boshlog.Logger) SignalTrap {
+	return &signalTrap{
+		source: source,
+		exit:   exit,
+		ui:     ui,
+		logger: logger,
+		logTag: "signalTrap",
+	}
+}
+
+func (t *signalTrap) Trap() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.signals != nil {
+		return
+	}
+
+	t.signals = make(chan os.Signal, 1)
+	t.source.Notify(t.signals)
+	go t.relay(t.signals)
+}
+
+func (t *signalTrap) Release() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.signals == nil {
+		return
+	}
+
+	t.source.Stop(t.signals)
+	close(t.signals)
+	t.signals = nil
+}
+
+// OnExit adds a func that is called before exiting on a second signal, in reverse order like deferred funcs
+func (t *signalTrap) OnExit(cleanup func()) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.cleanups = append(t.cleanups, cleanup)
+}
+
+func (t *signalTrap) Notify(c chan<- os.Signal) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.channels = append(t.channels, c)
+}
+
+func (t *signalTrap) Stop(c chan<- os.Signal) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for i, channel := range t.channels {
+		if channel == c {
+			t.channels = append(t.channels[:i], t.channels[i+1:]...)
+			return
+		}
+	}
+}
+
+func (t *signalTrap) Interrupted() os.Signal {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return t.interrupted
+}
+
+func (t *signalTrap) relay(signals <-chan os.Signal) {
+	for s := range signals {
+		t.handle(s)
+	}
+}
+
+func (t *signalTrap) handle(s os.Signal) {
+	t.lock.Lock()
+
+	if len(t.channels) > 0 {
+		for _, c := range t.channels {
+			select {
+			case c <- s:
+			default:
+			}
+		}
+		t.lock.Unlock()
+		return
+	}
+
+	if t.interrupted == nil {
+		t.interrupted = s
+		t.lock.Unlock()
+
+		t.logger.Warn(t.logTag, "Received signal '%s' while no CPI command is running, stopping before the next one", s)
+		t.ui.ErrorLinef("Received signal '%s', stopping before the next CPI call. Interrupt again to exit now.", s)
+		return
+	}
+
+	cleanups := t.cleanups
+	t.lock.Unlock()
+
+	t.logger.Warn(t.logTag, "Received signal '%s' again while no CPI command is running, exiting", s)
+	t.ui.ErrorLinef("Received signal '%s' again, exiting.", s)
+
+	for i := len(cleanups) - 1; i >= 0; i-- {
+		cleanups[i]()
+	}
+
+	exitStatus := 1
+	if signalNumber, ok := s.(syscall.Signal); ok {
+		exitStatus = 128 + int(signalNumber)
+	}
+	t.exit(exitStatus)
+}
@@ -0,0 +1,95 @@
+package cloud_test
+
+import (
+	"os"
+	"syscall"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	boshlog "github.com/cloudfoundry/bosh-agent/logger"
+
+	fakebicloud "github.com/cloudfoundry/bosh-init/cloud/fakes"
+	fakebiui "github.com/cloudfoundry/bosh-init/ui/fakes"
+
+	. "github.com/cloudfoundry/bosh-init/cloud"
+)
+
+var _ = Describe("SignalTrap", func() {
+	var (
+		signalTrap   SignalTrap
+		signalSource *fakebicloud.FakeSignalNotifier
+		fakeUI       *fakebiui.FakeUI
+		exitStatuses chan int
+	)
+
+	BeforeEach(func() {
+		fakeUI = &fakebiui.FakeUI{}
+		exitStatuses = make(chan int, 1)
+		exit := func(status int) {
+			exitStatuses <- status
+		}
+		signalSource = fakebicloud.NewFakeSignalNotifier()
+		signalTrap = NewSignalTrap(signalSource, exit, fakeUI, boshlog.NewLogger(boshlog.LevelNone))
+		signalTrap.Trap()
+	})
+
+	AfterEach(func() {
+		signalTrap.Release()
+	})
+
+	var interrupt = func() {
+		Expect(signalSource.NotifiedChannels).To(HaveLen(1))
+		signalSource.NotifiedChannels[0] <- syscall.SIGINT
+	}
+
+	It("stops trapping the signals of its source when released", func() {
+		signalTrap.Release()
+		Expect(signalSource.StoppedChannels).To(Equal(signalSource.NotifiedChannels))
+	})
+
+	It("relays a signal to the running CPI commands", func() {
+		signals := make(chan os.Signal, 1)
+		signalTrap.Notify(signals)
+		defer signalTrap.Stop(signals)
+
+		interrupt()
+
+		Eventually(signals).Should(Receive(Equal(syscall.SIGINT)))
+		Expect(signalTrap.Interrupted()).To(BeNil())
+		Consistently(exitStatuses).ShouldNot(Receive())
+	})
+
+	It("records a signal received while no CPI command is running, without exiting", func() {
+		interrupt()
+
+		Eventually(signalTrap.Interrupted).Should(Equal(syscall.SIGINT))
+		Eventually(func() []string { return fakeUI.Errors }).Should(ContainElement("Received signal 'interrupt', stopping before the next CPI call. Interrupt again to exit now."))
+		Consistently(exitStatuses).ShouldNot(Receive())
+	})
+
+	It("does not relay signals to the channels of CPI commands that are done", func() {
+		signals := make(chan os.Signal, 1)
+		signalTrap.Notify(signals)
+		signalTrap.Stop(signals)
+
+		interrupt()
+
+		Eventually(signalTrap.Interrupted).Should(Equal(syscall.SIGINT))
+		Expect(signals).ToNot(Receive())
+	})
+
+	It("calls the exit funcs in reverse order and exits on a second signal received while no CPI command is running", func() {
+		cleanups := []string{}
+		signalTrap.OnExit(func() { cleanups = append(cleanups, "first") })
+		signalTrap.OnExit(func() { cleanups = append(cleanups, "second") })
+
+		interrupt()
+		Eventually(signalTrap.Interrupted).Should(Equal(syscall.SIGINT))
+
+		interrupt()
+		Eventually(exitStatuses).Should(Receive(Equal(130)))
+		Expect(cleanups).To(Equal([]string{"second", "first"}))
+		Expect(fakeUI.Errors).To(ContainElement("Received signal 'interrupt' again, exiting."))
+	})
+})
@@ -36,4 +36,24 @@ var genericEnv = map[string]MetaEnv{
 		Default:     "standard out/err",
 		Description: "The path where logs will be written",
 	},
+	"BOSH_INIT_CPI_CASSETTE_MODE": MetaEnv{
+		Example:     "record",
+		Default:     "none",
+		Description: "record or replay CPI commands with the cassette file",
+	},
+	"BOSH_INIT_CPI_CASSETTE": MetaEnv{
+		Example:     "/path/to/cassette.json",
+		Default:     "none",
+		Description: "The path of the cassette file CPI commands are recorded to or replayed from",
+	},
+	"BOSH_INIT_STATE_KEY": MetaEnv{
+		Example:     "$(openssl rand -hex 32)",
+		Default:     "none",
+		Description: "The key the deployment state, vars store and rendered CPI job templates are encrypted with",
+	},
+	"BOSH_INIT_STATE_KEY_FILE": MetaEnv{
+		Example:     "/path/to/key",
+		Default:     "none",
+		Description: "The path of a file containing the key, instead of BOSH_INIT_STATE_KEY",
+	},
 }
@@ -13,9 +13,10 @@ import (
 	biconfig "github.com/cloudfoundry/bosh-init/config"
 	bicpirel "github.com/cloudfoundry/bosh-init/cpi/release"
 	bidepl "github.com/cloudfoundry/bosh-init/deployment"
-	bihttpagent "github.com/cloudfoundry/bosh-init/deployment/agentclient/http"
+	bideplmanifest "github.com/cloudfoundry/bosh-init/deployment/manifest"
 	biinstall "github.com/cloudfoundry/bosh-init/installation"
 	biinstallmanifest "github.com/cloudfoundry/bosh-init/installation/manifest"
+	bimanifest "github.com/cloudfoundry/bosh-init/manifest"
 	birel "github.com/cloudfoundry/bosh-init/release"
 	birelset "github.com/cloudfoundry/bosh-init/release/set"
 	birelsetmanifest "github.com/cloudfoundry/bosh-init/release/set/manifest"
@@ -26,8 +27,10 @@ type deleteCmd struct {
 	ui                       biui.UI
 	userConfig               biconfig.UserConfig
 	fs                       boshsys.FileSystem
+	manifestResolver         bimanifest.Resolver
 	releaseSetParser         birelsetmanifest.Parser
 	installationParser       biinstallmanifest.Parser
+	deploymentParser         bideplmanifest.Parser
 	deploymentConfigService  biconfig.DeploymentConfigService
 	releaseSetValidator      birelsetmanifest.Validator
 	installationValidator    biinstallmanifest.Validator
@@ -36,7 +39,6 @@ type deleteCmd struct {
 	releaseManager           birel.Manager
 	releaseResolver          birelset.Resolver
 	cloudFactory             bicloud.Factory
-	agentClientFactory       bihttpagent.AgentClientFactory
 	blobstoreFactory         biblobstore.Factory
 	deploymentManagerFactory bidepl.ManagerFactory
 	logger                   boshlog.Logger
@@ -47,8 +49,10 @@ func NewDeleteCmd(
 	ui biui.UI,
 	userConfig biconfig.UserConfig,
 	fs boshsys.FileSystem,
+	manifestResolver bimanifest.Resolver,
 	releaseSetParser birelsetmanifest.Parser,
 	installationParser biinstallmanifest.Parser,
+	deploymentParser bideplmanifest.Parser,
 	deploymentConfigService biconfig.DeploymentConfigService,
 	releaseSetValidator birelsetmanifest.Validator,
 	installationValidator biinstallmanifest.Validator,
@@ -57,7 +61,6 @@ func NewDeleteCmd(
 	releaseManager birel.Manager,
 	releaseResolver birelset.Resolver,
 	cloudFactory bicloud.Factory,
-	agentClientFactory bihttpagent.AgentClientFactory,
 	blobstoreFactory biblobstore.Factory,
 	deploymentManagerFactory bidepl.ManagerFactory,
 	logger boshlog.Logger,
@@ -66,8 +69,10 @@ func NewDeleteCmd(
 		ui:                       ui,
 		userConfig:               userConfig,
 		fs:                       fs,
+		manifestResolver:         manifestResolver,
 		releaseSetParser:         releaseSetParser,
 		installationParser:       installationParser,
+		deploymentParser:         deploymentParser,
 		deploymentConfigService:  deploymentConfigService,
 		releaseSetValidator:      releaseSetValidator,
 		installationValidator:    installationValidator,
@@ -76,7 +81,6 @@ func NewDeleteCmd(
 		releaseManager:           releaseManager,
 		releaseResolver:          releaseResolver,
 		cloudFactory:             cloudFactory,
-		agentClientFactory:       agentClientFactory,
 		blobstoreFactory:         blobstoreFactory,
 		deploymentManagerFactory: deploymentManagerFactory,
 		logger: logger,
@@ -91,13 +95,13 @@ func (c *deleteCmd) Name() string {
 func (c *deleteCmd) Meta() Meta {
 	return Meta{
 		Synopsis: "Delete existing deployment",
-		Usage:    "<deployment_manifest_path> <cpi_release_path>",
+		Usage:    manifestFlagsUsage + " <deployment_manifest_path> <cpi_release_path>",
 		Env:      genericEnv,
 	}
 }
 
 func (c *deleteCmd) Run(stage biui.Stage, args []string) error {
-	deploymentManifestPath, releaseTarballPath, err := c.parseCmdInputs(args)
+	deploymentManifestPath, releaseTarballPath, flags, err := c.parseCmdInputs(args)
 	if err != nil {
 		return err
 	}
@@ -116,11 +120,22 @@ func (c *deleteCmd) Run(stage biui.Stage, args []string) error {
 	c.userConfig.DeploymentManifestPath = manifestAbsFilePath
 	c.ui.PrintLinef("Deployment manifest: '%s'", manifestAbsFilePath)
 
-	deploymentConfigPath := c.userConfig.DeploymentConfigPath()
+	deploymentConfigPath := flags.deploymentConfigPathFor(c.userConfig)
 	c.deploymentConfigService.SetConfigPath(deploymentConfigPath)
+	deploymentConfigPath = biconfig.RedactDeploymentConfigPath(deploymentConfigPath)
 
 	c.ui.PrintLinef("Deployment state: '%s'", deploymentConfigPath)
 
+	if err := c.deploymentConfigService.Lock(); err != nil {
+		return bosherr.WrapError(err, "Locking deployment config")
+	}
+	defer func() {
+		unlockErr := c.deploymentConfigService.Unlock()
+		if unlockErr != nil {
+			c.logger.Warn(c.logTag, "Failed to unlock deployment config: %s", unlockErr.Error())
+		}
+	}()
+
 	if !c.deploymentConfigService.Exists() {
 		c.ui.PrintLinef("No deployment config file found.")
 		return nil
@@ -132,8 +147,9 @@ func (c *deleteCmd) Run(stage biui.Stage, args []string) error {
 	}
 
 	var installationManifest biinstallmanifest.Manifest
+	var deploymentManifest bideplmanifest.Manifest
 	err = stage.PerformComplex("validating", func(stage biui.Stage) error {
-		installationManifest, err = c.validate(stage, releaseTarballPath, deploymentManifestPath)
+		installationManifest, deploymentManifest, err = c.validate(stage, releaseTarballPath, deploymentManifestPath, flags)
 		return err
 	})
 	if err != nil {
@@ -159,6 +175,12 @@ func (c *deleteCmd) Run(stage biui.Stage, args []string) error {
 	if err != nil {
 		return err
 	}
+	defer func() {
+		err := installation.Cleanup()
+		if err != nil {
+			c.logger.Warn(c.logTag, "Failed to clean up CPI installation: %s", err.Error())
+		}
+	}()
 
 	err = stage.Perform("Starting registry", func() error {
 		return installation.StartRegistry()
@@ -180,20 +202,17 @@ func (c *deleteCmd) Run(stage biui.Stage, args []string) error {
 		return bosherr.WrapError(err, "Creating CPI client from CPI installation")
 	}
 
-	c.logger.Debug(c.logTag, "Creating agent client...")
-	agentClient := c.agentClientFactory.NewAgentClient(deploymentConfig.DirectorID, installationManifest.Mbus)
-
 	c.logger.Debug(c.logTag, "Creating blobstore client...")
-	blobstore, err := c.blobstoreFactory.Create(installationManifest.Mbus)
+	blobstore, err := c.blobstoreFactory.Create(installationManifest.AgentBlobstoreURL(), installationManifest.Cert)
 	if err != nil {
 		return bosherr.WrapError(err, "Creating blobstore client")
 	}
 
 	c.logger.Debug(c.logTag, "Creating deployment manager...")
-	deploymentManager := c.deploymentManagerFactory.NewManager(cloud, agentClient, blobstore)
+	deploymentManager := c.deploymentManagerFactory.NewManager(cloud, deploymentConfig.DirectorID, installationManifest.Mbus, installationManifest.Cert, blobstore)
 
 	c.logger.Debug(c.logTag, "Finding current deployment...")
-	deployment, found, err := deploymentManager.FindCurrent()
+	deployment, found, err := deploymentManager.FindCurrent(deploymentManifest)
 	if err != nil {
 		return bosherr.WrapError(err, "Finding current deployment")
 	}
@@ -219,18 +238,26 @@ func (c *deleteCmd) Run(stage biui.Stage, args []string) error {
 	return err
 }
 
-func (c *deleteCmd) parseCmdInputs(args []string) (string, string, error) {
+func (c *deleteCmd) parseCmdInputs(args []string) (string, string, manifestFlags, error) {
+	args, flags, err := parseManifestFlags(args)
+	if err != nil {
+		c.ui.ErrorLinef("%s", err.Error())
+		c.logger.Error(c.logTag, "Invalid arguments: %#v", args)
+		return "", "", manifestFlags{}, err
+	}
+
 	if len(args) != 2 {
 		c.ui.ErrorLinef("Invalid usage - delete command requires exactly 2 arguments")
-		c.ui.PrintLinef("Expected usage: bosh-init delete <deployment-manifest> <cpi-release-tarball>")
+		c.ui.PrintLinef("Expected usage: bosh-init delete %s <deployment-manifest> <cpi-release-tarball>", manifestFlagsUsage)
 		c.logger.Error(c.logTag, "Invalid arguments: %#v", args)
-		return "", "", errors.New("Invalid usage - delete command requires exactly 2 arguments")
+		return "", "", manifestFlags{}, errors.New("Invalid usage - delete command requires exactly 2 arguments")
 	}
-	return args[0], args[1], nil
+	return args[0], args[1], flags, nil
 }
 
-func (c *deleteCmd) validate(validationStage biui.Stage, releaseTarballPath, deploymentManifestPath string) (
+func (c *deleteCmd) validate(validationStage biui.Stage, releaseTarballPath, deploymentManifestPath string, flags manifestFlags) (
 	installationManifest biinstallmanifest.Manifest,
+	deploymentManifest bideplmanifest.Manifest,
 	err error,
 ) {
 	err = validationStage.Perform("Validating releases", func() error {
@@ -247,7 +274,7 @@ func (c *deleteCmd) validate(validationStage biui.Stage, releaseTarballPath, dep
 		return nil
 	})
 	if err != nil {
-		return installationManifest, err
+		return installationManifest, deploymentManifest, err
 	}
 	defer func() {
 		if err != nil {
@@ -259,7 +286,18 @@ func (c *deleteCmd) validate(validationStage biui.Stage, releaseTarballPath, dep
 	}()
 
 	err = validationStage.Perform("Validating deployment manifest", func() error {
-		releaseSetManifest, err := c.releaseSetParser.Parse(deploymentManifestPath)
+		resolvedManifest, err := c.manifestResolver.Resolve(deploymentManifestPath, flags.opsFilePaths, flags.readOnlyVariablesSourcesFor(c.userConfig))
+		if err != nil {
+			return bosherr.WrapErrorf(err, "Resolving variables in deployment manifest '%s'", deploymentManifestPath)
+		}
+		defer func() {
+			deleteErr := resolvedManifest.Delete()
+			if deleteErr != nil {
+				c.logger.Warn(c.logTag, "Failed to delete interpolated deployment manifest: %s", deleteErr.Error())
+			}
+		}()
+
+		releaseSetManifest, err := c.releaseSetParser.Parse(resolvedManifest.Path)
 		if err != nil {
 			return bosherr.WrapErrorf(err, "Parsing release set manifest '%s'", deploymentManifestPath)
 		}
@@ -271,7 +309,7 @@ func (c *deleteCmd) validate(validationStage biui.Stage, releaseTarballPath, dep
 
 		c.releaseResolver.Filter(releaseSetManifest.Releases)
 
-		installationManifest, err = c.installationParser.Parse(deploymentManifestPath)
+		installationManifest, err = c.installationParser.Parse(resolvedManifest.Path)
 		if err != nil {
 			return bosherr.WrapErrorf(err, "Parsing installation manifest '%s'", deploymentManifestPath)
 		}
@@ -281,10 +319,16 @@ func (c *deleteCmd) validate(validationStage biui.Stage, releaseTarballPath, dep
 			return bosherr.WrapError(err, "Validating installation manifest")
 		}
 
+		// names the vms of a deployment file recorded before multiple instances were supported
+		deploymentManifest, err = c.deploymentParser.Parse(resolvedManifest.Path)
+		if err != nil {
+			return bosherr.WrapErrorf(err, "Parsing deployment manifest '%s'", deploymentManifestPath)
+		}
+
 		return nil
 	})
 	if err != nil {
-		return installationManifest, err
+		return installationManifest, deploymentManifest, err
 	}
 
 	err = validationStage.Perform("Validating cpi release", func() error {
@@ -304,5 +348,5 @@ func (c *deleteCmd) validate(validationStage biui.Stage, releaseTarballPath, dep
 		return nil
 	})
 
-	return installationManifest, err
+	return installationManifest, deploymentManifest, err
 }
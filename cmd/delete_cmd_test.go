@@ -11,8 +11,6 @@ import (
 	"code.google.com/p/gomock/gomock"
 	mock_blobstore "github.com/cloudfoundry/bosh-init/blobstore/mocks"
 	mock_cloud "github.com/cloudfoundry/bosh-init/cloud/mocks"
-	mock_httpagent "github.com/cloudfoundry/bosh-init/deployment/agentclient/http/mocks"
-	mock_agentclient "github.com/cloudfoundry/bosh-init/deployment/agentclient/mocks"
 	mock_deployment "github.com/cloudfoundry/bosh-init/deployment/mocks"
 	mock_install "github.com/cloudfoundry/bosh-init/installation/mocks"
 	mock_release "github.com/cloudfoundry/bosh-init/release/mocks"
@@ -21,11 +19,15 @@ import (
 	boshsys "github.com/cloudfoundry/bosh-agent/system"
 
 	fakesys "github.com/cloudfoundry/bosh-agent/system/fakes"
+	faketime "github.com/cloudfoundry/bosh-agent/time/fakes"
 	fakeuuid "github.com/cloudfoundry/bosh-agent/uuid/fakes"
 
 	biproperty "github.com/cloudfoundry/bosh-init/common/property"
 	biconfig "github.com/cloudfoundry/bosh-init/config"
+	bicrypto "github.com/cloudfoundry/bosh-init/crypto"
+	bideplmanifest "github.com/cloudfoundry/bosh-init/deployment/manifest"
 	biinstallmanifest "github.com/cloudfoundry/bosh-init/installation/manifest"
+	bimanifest "github.com/cloudfoundry/bosh-init/manifest"
 	birel "github.com/cloudfoundry/bosh-init/release"
 	bireljob "github.com/cloudfoundry/bosh-init/release/job"
 	birelpkg "github.com/cloudfoundry/bosh-init/release/pkg"
@@ -71,9 +73,7 @@ var _ = Describe("DeleteCmd", func() {
 			mockDeploymentManager        *mock_deployment.MockManager
 			mockDeployment               *mock_deployment.MockDeployment
 
-			mockAgentClient        *mock_agentclient.MockAgentClient
-			mockAgentClientFactory *mock_httpagent.MockAgentClientFactory
-			mockCloud              *mock_cloud.MockCloud
+			mockCloud *mock_cloud.MockCloud
 
 			fakeStage *fakebiui.FakeStage
 
@@ -95,6 +95,10 @@ var _ = Describe("DeleteCmd", func() {
 			fs.WriteFileString(deploymentManifestPath, `---
 name: test-release
 
+jobs:
+- name: fake-first-job-name
+- name: fake-second-job-name
+
 cloud_provider:
   template:
     name: fake-cpi-release-job-name
@@ -151,6 +155,7 @@ cloud_provider:
 
 			expectStartRegistry = mockInstallation.EXPECT().StartRegistry().AnyTimes()
 			expectStopRegistry = mockInstallation.EXPECT().StopRegistry().AnyTimes()
+			mockInstallation.EXPECT().Cleanup().AnyTimes()
 		}
 
 		var newDeleteCmd = func() Cmd {
@@ -164,9 +169,11 @@ cloud_provider:
 				fakeUI,
 				userConfig,
 				fs,
+				bimanifest.NewResolver(fs, bimanifest.NewVariablesLoader(fs, []string{}, logger), bimanifest.NewVariablesStore(fs, bicrypto.NewEncryptor(nil), logger), bimanifest.NewVariablesGenerator(logger), bimanifest.NewOpsApplier(fs, logger), bimanifest.NewInterpolator(logger), logger),
 				releaseSetParser,
 				installationParser,
-				biconfig.NewFileSystemDeploymentConfigService(fs, fakeUUIDGenerator, logger),
+				bideplmanifest.NewParser(fs, logger),
+				biconfig.NewFileSystemDeploymentConfigService(fs, fakeUUIDGenerator, &faketime.FakeService{}, bicrypto.NewEncryptor(nil), logger),
 				releaseSetValidator,
 				installationValidator,
 				mockInstallerFactory,
@@ -174,7 +181,6 @@ cloud_provider:
 				releaseManager,
 				releaseSetResolver,
 				mockCloudFactory,
-				mockAgentClientFactory,
 				mockBlobstoreFactory,
 				mockDeploymentManagerFactory,
 				logger,
@@ -182,8 +188,11 @@ cloud_provider:
 		}
 
 		var expectDeleteAndCleanup = func() {
-			mockDeploymentManagerFactory.EXPECT().NewManager(mockCloud, mockAgentClient, mockBlobstore).Return(mockDeploymentManager)
-			mockDeploymentManager.EXPECT().FindCurrent().Return(mockDeployment, true, nil)
+			mockDeploymentManagerFactory.EXPECT().NewManager(mockCloud, directorID, mbusURL, biinstallmanifest.Cert{}, mockBlobstore).Return(mockDeploymentManager)
+			mockDeploymentManager.EXPECT().FindCurrent(gomock.Any()).Do(func(deploymentManifest bideplmanifest.Manifest) {
+				// names the vms of a deployment file recorded before multiple instances were supported
+				Expect(deploymentManifest.LegacyJobName()).To(Equal("fake-first-job-name"))
+			}).Return(mockDeployment, true, nil)
 
 			gomock.InOrder(
 				mockDeployment.EXPECT().Delete(gomock.Any()).Do(func(stage biui.Stage) {
@@ -194,8 +203,8 @@ cloud_provider:
 		}
 
 		var expectCleanup = func() {
-			mockDeploymentManagerFactory.EXPECT().NewManager(mockCloud, mockAgentClient, mockBlobstore).Return(mockDeploymentManager).AnyTimes()
-			mockDeploymentManager.EXPECT().FindCurrent().Return(nil, false, nil).AnyTimes()
+			mockDeploymentManagerFactory.EXPECT().NewManager(mockCloud, directorID, mbusURL, biinstallmanifest.Cert{}, mockBlobstore).Return(mockDeploymentManager).AnyTimes()
+			mockDeploymentManager.EXPECT().FindCurrent(gomock.Any()).Return(nil, false, nil).AnyTimes()
 
 			mockDeploymentManager.EXPECT().Cleanup(fakeStage)
 		}
@@ -237,7 +246,7 @@ cloud_provider:
 			fs = fakesys.NewFakeFileSystem()
 			logger = boshlog.NewLogger(boshlog.LevelNone)
 			fakeUUIDGenerator = fakeuuid.NewFakeGenerator()
-			setupDeploymentConfigService = biconfig.NewFileSystemDeploymentConfigService(fs, fakeUUIDGenerator, logger)
+			setupDeploymentConfigService = biconfig.NewFileSystemDeploymentConfigService(fs, fakeUUIDGenerator, &faketime.FakeService{}, bicrypto.NewEncryptor(nil), logger)
 			deploymentConfigPath = biconfig.UserConfig{DeploymentManifestPath: deploymentManifestPath}.DeploymentConfigPath()
 			setupDeploymentConfigService.SetConfigPath(deploymentConfigPath)
 			setupDeploymentConfigService.Load()
@@ -255,7 +264,7 @@ cloud_provider:
 
 			mockBlobstoreFactory = mock_blobstore.NewMockFactory(mockCtrl)
 			mockBlobstore = mock_blobstore.NewMockBlobstore(mockCtrl)
-			mockBlobstoreFactory.EXPECT().Create(mbusURL).Return(mockBlobstore, nil).AnyTimes()
+			mockBlobstoreFactory.EXPECT().Create(mbusURL, biinstallmanifest.Cert{}).Return(mockBlobstore, nil).AnyTimes()
 
 			mockDeploymentManagerFactory = mock_deployment.NewMockManagerFactory(mockCtrl)
 			mockDeploymentManager = mock_deployment.NewMockManager(mockCtrl)
@@ -264,13 +273,8 @@ cloud_provider:
 			mockReleaseExtractor = mock_release.NewMockExtractor(mockCtrl)
 			releaseManager = birel.NewManager(logger)
 
-			mockAgentClientFactory = mock_httpagent.NewMockAgentClientFactory(mockCtrl)
-			mockAgentClient = mock_agentclient.NewMockAgentClient(mockCtrl)
-
 			userConfig = biconfig.UserConfig{}
 
-			mockAgentClientFactory.EXPECT().NewAgentClient(gomock.Any(), gomock.Any()).Return(mockAgentClient).AnyTimes()
-
 			directorID = "fake-uuid-0"
 
 			writeDeploymentManifest()
@@ -368,6 +372,54 @@ cloud_provider:
 
 				expectValidationInstallationDeletionEvents()
 			})
+
+			Context("when ops files and variables are given", func() {
+				BeforeEach(func() {
+					fs.WriteFileString("/fake-ops.yml", `---
+- type: remove
+  path: /cloud_provider/mbus
+- type: replace
+  path: /cloud_provider/mbus?
+  value: ((mbus))
+`)
+					fakeFs := fs.(*fakesys.FakeFileSystem)
+					fakeFs.ReturnTempFile = fakesys.NewFakeFile("/fake-resolved-manifest", fakeFs)
+				})
+
+				It("deletes the deployment using the patched manifest", func() {
+					expectDeleteAndCleanup()
+
+					err := newDeleteCmd().Run(fakeStage, []string{"--ops-file", "/fake-ops.yml", "--var", "mbus=" + mbusURL, deploymentManifestPath, "/fake-cpi-release.tgz"})
+					Expect(err).ToNot(HaveOccurred())
+					Expect(fs.FileExists("/fake-resolved-manifest")).To(BeFalse())
+				})
+
+				It("does not generate declared variables missing from the vars store", func() {
+					fs.WriteFileString("/fake-ops.yml", `---
+- type: replace
+  path: /cloud_provider/mbus
+  value: ((mbus))
+- type: replace
+  path: /variables?
+  value:
+  - name: mbus
+    type: password
+`)
+
+					err := newDeleteCmd().Run(fakeStage, []string{"--ops-file", "/fake-ops.yml", "--vars-store", "/fake-vars-store.yml", deploymentManifestPath, "/fake-cpi-release.tgz"})
+					Expect(err).To(HaveOccurred())
+					Expect(err.Error()).To(ContainSubstring("Expected to find variables: mbus"))
+					Expect(fs.FileExists("/fake-vars-store.yml")).To(BeFalse())
+				})
+
+				It("returns an error with the failing operation", func() {
+					fs.WriteFileString("/fake-ops.yml", "- type: replace\n  path: /cloud_provider/missing/mbus\n  value: ((mbus))\n")
+
+					err := newDeleteCmd().Run(fakeStage, []string{"--ops-file", "/fake-ops.yml", deploymentManifestPath, "/fake-cpi-release.tgz"})
+					Expect(err).To(HaveOccurred())
+					Expect(err.Error()).To(ContainSubstring("Applying operation [0] in ops file '/fake-ops.yml' (type 'replace', path '/cloud_provider/missing/mbus')"))
+				})
+			})
 		})
 
 		Context("when nothing has been deployed", func() {
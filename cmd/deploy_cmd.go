@@ -15,11 +15,11 @@ import (
 	biconfig "github.com/cloudfoundry/bosh-init/config"
 	bicpirel "github.com/cloudfoundry/bosh-init/cpi/release"
 	bidepl "github.com/cloudfoundry/bosh-init/deployment"
-	bihttpagent "github.com/cloudfoundry/bosh-init/deployment/agentclient/http"
 	bideplmanifest "github.com/cloudfoundry/bosh-init/deployment/manifest"
 	bivm "github.com/cloudfoundry/bosh-init/deployment/vm"
 	biinstall "github.com/cloudfoundry/bosh-init/installation"
 	biinstallmanifest "github.com/cloudfoundry/bosh-init/installation/manifest"
+	bimanifest "github.com/cloudfoundry/bosh-init/manifest"
 	birel "github.com/cloudfoundry/bosh-init/release"
 	birelset "github.com/cloudfoundry/bosh-init/release/set"
 	birelsetmanifest "github.com/cloudfoundry/bosh-init/release/set/manifest"
@@ -31,6 +31,7 @@ type deployCmd struct {
 	ui                             biui.UI
 	userConfig                     biconfig.UserConfig
 	fs                             boshsys.FileSystem
+	manifestResolver               bimanifest.Resolver
 	releaseSetParser               birelsetmanifest.Parser
 	installationParser             biinstallmanifest.Parser
 	deploymentParser               bideplmanifest.Parser
@@ -39,16 +40,17 @@ type deployCmd struct {
 	releaseSetValidator            birelsetmanifest.Validator
 	installationValidator          biinstallmanifest.Validator
 	deploymentValidator            bideplmanifest.Validator
+	jobPropertiesValidator         bideplmanifest.JobPropertiesValidator
 	installerFactory               biinstall.InstallerFactory
 	releaseExtractor               birel.Extractor
 	releaseManager                 birel.Manager
 	releaseResolver                birelset.Resolver
 	cloudFactory                   bicloud.Factory
-	agentClientFactory             bihttpagent.AgentClientFactory
 	vmManagerFactory               bivm.ManagerFactory
 	stemcellExtractor              bistemcell.Extractor
 	stemcellManagerFactory         bistemcell.ManagerFactory
 	deploymentRecord               bidepl.Record
+	planner                        bidepl.Planner
 	blobstoreFactory               biblobstore.Factory
 	deployer                       bidepl.Deployer
 	eventLogger                    biui.Stage
@@ -61,6 +63,7 @@ func NewDeployCmd(
 	ui biui.UI,
 	userConfig biconfig.UserConfig,
 	fs boshsys.FileSystem,
+	manifestResolver bimanifest.Resolver,
 	releaseSetParser birelsetmanifest.Parser,
 	installationParser biinstallmanifest.Parser,
 	deploymentParser bideplmanifest.Parser,
@@ -69,16 +72,17 @@ func NewDeployCmd(
 	releaseSetValidator birelsetmanifest.Validator,
 	installationValidator biinstallmanifest.Validator,
 	deploymentValidator bideplmanifest.Validator,
+	jobPropertiesValidator bideplmanifest.JobPropertiesValidator,
 	installerFactory biinstall.InstallerFactory,
 	releaseExtractor birel.Extractor,
 	releaseManager birel.Manager,
 	releaseResolver birelset.Resolver,
 	cloudFactory bicloud.Factory,
-	agentClientFactory bihttpagent.AgentClientFactory,
 	vmManagerFactory bivm.ManagerFactory,
 	stemcellExtractor bistemcell.Extractor,
 	stemcellManagerFactory bistemcell.ManagerFactory,
 	deploymentRecord bidepl.Record,
+	planner bidepl.Planner,
 	blobstoreFactory biblobstore.Factory,
 	deployer bidepl.Deployer,
 	uuidGenerator uuid.Generator,
@@ -88,6 +92,7 @@ func NewDeployCmd(
 		ui:                             ui,
 		userConfig:                     userConfig,
 		fs:                             fs,
+		manifestResolver:               manifestResolver,
 		releaseSetParser:               releaseSetParser,
 		installationParser:             installationParser,
 		deploymentParser:               deploymentParser,
@@ -96,16 +101,17 @@ func NewDeployCmd(
 		releaseSetValidator:            releaseSetValidator,
 		installationValidator:          installationValidator,
 		deploymentValidator:            deploymentValidator,
+		jobPropertiesValidator:         jobPropertiesValidator,
 		installerFactory:               installerFactory,
 		releaseExtractor:               releaseExtractor,
 		releaseManager:                 releaseManager,
 		releaseResolver:                releaseResolver,
 		cloudFactory:                   cloudFactory,
-		agentClientFactory:             agentClientFactory,
 		vmManagerFactory:               vmManagerFactory,
 		stemcellExtractor:              stemcellExtractor,
 		stemcellManagerFactory:         stemcellManagerFactory,
 		deploymentRecord:               deploymentRecord,
+		planner:                        planner,
 		blobstoreFactory:               blobstoreFactory,
 		deployer:                       deployer,
 		uuidGenerator:                  uuidGenerator,
@@ -121,13 +127,13 @@ func (c *deployCmd) Name() string {
 func (c *deployCmd) Meta() Meta {
 	return Meta{
 		Synopsis: "Create or update a deployment",
-		Usage:    "<deployment_manifest_path> <stemcell_path> <cpi_release_path> [<release_paths...>]",
+		Usage:    "[--dry-run] " + manifestFlagsUsage + " <deployment_manifest_path> <stemcell_path> <cpi_release_path> [<release_paths...>]",
 		Env:      genericEnv,
 	}
 }
 
 func (c *deployCmd) Run(stage biui.Stage, args []string) error {
-	deploymentManifestPath, stemcellTarballPath, releaseTarballPaths, err := c.parseCmdInputs(args)
+	deploymentManifestPath, stemcellTarballPath, releaseTarballPaths, dryRun, flags, err := c.parseCmdInputs(args)
 	if err != nil {
 		return err
 	}
@@ -146,18 +152,34 @@ func (c *deployCmd) Run(stage biui.Stage, args []string) error {
 	c.userConfig.DeploymentManifestPath = manifestAbsFilePath
 	c.ui.PrintLinef("Deployment manifest: '%s'", manifestAbsFilePath)
 
-	deploymentConfigPath := c.userConfig.DeploymentConfigPath()
+	deploymentConfigPath := flags.deploymentConfigPathFor(c.userConfig)
 	c.deploymentConfigService.SetConfigPath(deploymentConfigPath)
+	deploymentConfigPath = biconfig.RedactDeploymentConfigPath(deploymentConfigPath)
 
 	c.ui.PrintLinef("Deployment state: '%s'", deploymentConfigPath)
 
-	if !c.deploymentConfigService.Exists() {
-		migrated, err := c.legacyDeploymentConfigMigrator.MigrateIfExists(c.userConfig.LegacyDeploymentConfigPath())
-		if err != nil {
-			return bosherr.WrapError(err, "Migrating legacy deployment config file")
+	if dryRun {
+		// a dry run neither locks, migrates nor saves the deployment config
+		c.deploymentConfigService.SetReadOnly()
+	} else {
+		if err := c.deploymentConfigService.Lock(); err != nil {
+			return bosherr.WrapError(err, "Locking deployment config")
 		}
-		if migrated {
-			c.ui.PrintLinef("Migrated legacy deployments file: '%s'", c.userConfig.LegacyDeploymentConfigPath())
+		defer func() {
+			unlockErr := c.deploymentConfigService.Unlock()
+			if unlockErr != nil {
+				c.logger.Warn(c.logTag, "Failed to unlock deployment config: %s", unlockErr.Error())
+			}
+		}()
+
+		if !c.deploymentConfigService.Exists() {
+			migrated, err := c.legacyDeploymentConfigMigrator.MigrateIfExists(c.userConfig.LegacyDeploymentConfigPath())
+			if err != nil {
+				return bosherr.WrapError(err, "Migrating legacy deployment config file")
+			}
+			if migrated {
+				c.ui.PrintLinef("Migrated legacy deployments file: '%s'", c.userConfig.LegacyDeploymentConfigPath())
+			}
 		}
 	}
 
@@ -168,16 +190,23 @@ func (c *deployCmd) Run(stage biui.Stage, args []string) error {
 
 	var (
 		extractedStemcell    bistemcell.ExtractedStemcell
+		resolvedManifest     bimanifest.ResolvedManifest
 		deploymentManifest   bideplmanifest.Manifest
 		installationManifest biinstallmanifest.Manifest
 	)
 	err = stage.PerformComplex("validating", func(stage biui.Stage) error {
-		extractedStemcell, deploymentManifest, installationManifest, err = c.validate(stage, stemcellTarballPath, releaseTarballPaths, deploymentManifestPath)
+		extractedStemcell, resolvedManifest, deploymentManifest, installationManifest, err = c.validate(stage, stemcellTarballPath, releaseTarballPaths, deploymentManifestPath, flags, dryRun)
 		return err
 	})
 	if err != nil {
 		return err
 	}
+	defer func() {
+		deleteErr := resolvedManifest.Delete()
+		if deleteErr != nil {
+			c.logger.Warn(c.logTag, "Failed to delete interpolated deployment manifest: %s", deleteErr.Error())
+		}
+	}()
 	defer func() {
 		deleteErr := extractedStemcell.Delete()
 		if deleteErr != nil {
@@ -191,7 +220,11 @@ func (c *deployCmd) Run(stage biui.Stage, args []string) error {
 		}
 	}()
 
-	isDeployed, err := c.deploymentRecord.IsDeployed(deploymentManifestPath, c.releaseManager.List(), extractedStemcell)
+	if dryRun {
+		return c.plan(stage, resolvedManifest.Path, deploymentManifest, extractedStemcell)
+	}
+
+	isDeployed, err := c.deploymentRecord.IsDeployed(resolvedManifest.Path, c.releaseManager.List(), extractedStemcell)
 	if err != nil {
 		return bosherr.WrapError(err, "Checking if deployment has changed")
 	}
@@ -214,6 +247,12 @@ func (c *deployCmd) Run(stage biui.Stage, args []string) error {
 	if err != nil {
 		return err
 	}
+	defer func() {
+		err := installation.Cleanup()
+		if err != nil {
+			c.logger.Warn(c.logTag, "Failed to clean up CPI installation: %s", err.Error())
+		}
+	}()
 
 	err = stage.Perform("Starting registry", func() error {
 		return installation.StartRegistry()
@@ -241,10 +280,9 @@ func (c *deployCmd) Run(stage biui.Stage, args []string) error {
 		return err
 	}
 
-	agentClient := c.agentClientFactory.NewAgentClient(deploymentConfig.DirectorID, installationManifest.Mbus)
-	vmManager := c.vmManagerFactory.NewManager(cloud, agentClient)
+	vmManager := c.vmManagerFactory.NewManager(cloud, deploymentConfig.DirectorID, installationManifest.Mbus, installationManifest.Cert)
 
-	blobstore, err := c.blobstoreFactory.Create(installationManifest.Mbus)
+	blobstore, err := c.blobstoreFactory.Create(installationManifest.AgentBlobstoreURL(), installationManifest.Cert)
 	if err != nil {
 		return bosherr.WrapError(err, "Creating blobstore client")
 	}
@@ -264,7 +302,7 @@ func (c *deployCmd) Run(stage biui.Stage, args []string) error {
 			return bosherr.WrapError(err, "Deploying")
 		}
 
-		err = c.deploymentRecord.Update(deploymentManifestPath, c.releaseManager.List())
+		err = c.deploymentRecord.Update(resolvedManifest.Path, c.releaseManager.List())
 		if err != nil {
 			return bosherr.WrapError(err, "Updating deployment record")
 		}
@@ -287,14 +325,60 @@ func (c *deployCmd) Run(stage biui.Stage, args []string) error {
 
 type Deployment struct{}
 
-func (c *deployCmd) parseCmdInputs(args []string) (string, string, []string, error) {
-	if len(args) < 3 {
+func (c *deployCmd) plan(
+	stage biui.Stage,
+	deploymentManifestPath string,
+	deploymentManifest bideplmanifest.Manifest,
+	extractedStemcell bistemcell.ExtractedStemcell,
+) error {
+	var plan bidepl.Plan
+	err := stage.Perform("Planning deployment", func() error {
+		var err error
+		plan, err = c.planner.Plan(deploymentManifestPath, deploymentManifest, c.releaseManager.List(), extractedStemcell)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if plan.IsEmpty() {
+		c.ui.PrintLinef("No deployment, stemcell or release changes.")
+		return nil
+	}
+
+	c.ui.PrintLinef("Planned changes (dry run, nothing was deployed):")
+	for _, change := range plan.Changes {
+		c.ui.PrintLinef("  - %s", change)
+	}
+
+	return nil
+}
+
+func (c *deployCmd) parseCmdInputs(args []string) (string, string, []string, bool, manifestFlags, error) {
+	args, flags, err := parseManifestFlags(args)
+	if err != nil {
+		c.ui.ErrorLinef("%s", err.Error())
+		c.logger.Error(c.logTag, "Invalid arguments: %#v", args)
+		return "", "", []string{}, false, manifestFlags{}, err
+	}
+
+	dryRun := false
+	positionalArgs := []string{}
+	for _, arg := range args {
+		if arg == "--dry-run" {
+			dryRun = true
+			continue
+		}
+		positionalArgs = append(positionalArgs, arg)
+	}
+
+	if len(positionalArgs) < 3 {
 		c.ui.ErrorLinef("Invalid usage - deploy command requires at least 3 arguments")
-		c.ui.PrintLinef("Expected usage: bosh-init deploy <deployment-manifest> <stemcell-tarball> <cpi-release-tarball> [release-2-tarball [release-3-tarball...]]")
+		c.ui.PrintLinef("Expected usage: bosh-init deploy [--dry-run] %s <deployment-manifest> <stemcell-tarball> <cpi-release-tarball> [release-2-tarball [release-3-tarball...]]", manifestFlagsUsage)
 		c.logger.Error(c.logTag, "Invalid arguments: %#v", args)
-		return "", "", []string{}, errors.New("Invalid usage - deploy command requires at least 3 arguments")
+		return "", "", []string{}, false, manifestFlags{}, errors.New("Invalid usage - deploy command requires at least 3 arguments")
 	}
-	return args[0], args[1], args[2:], nil
+	return positionalArgs[0], positionalArgs[1], positionalArgs[2:], dryRun, flags, nil
 }
 
 func (c *deployCmd) isBlank(str string) bool {
@@ -306,8 +390,11 @@ func (c *deployCmd) validate(
 	stemcellTarballPath string,
 	releaseTarballPaths []string,
 	deploymentManifestPath string,
+	flags manifestFlags,
+	dryRun bool,
 ) (
 	extractedStemcell bistemcell.ExtractedStemcell,
+	resolvedManifest bimanifest.ResolvedManifest,
 	deploymentManifest bideplmanifest.Manifest,
 	installationManifest biinstallmanifest.Manifest,
 	err error,
@@ -325,7 +412,7 @@ func (c *deployCmd) validate(
 		return nil
 	})
 	if err != nil {
-		return extractedStemcell, deploymentManifest, installationManifest, err
+		return extractedStemcell, resolvedManifest, deploymentManifest, installationManifest, err
 	}
 	defer func() {
 		if err != nil {
@@ -352,7 +439,7 @@ func (c *deployCmd) validate(
 		return nil
 	})
 	if err != nil {
-		return extractedStemcell, deploymentManifest, installationManifest, err
+		return extractedStemcell, resolvedManifest, deploymentManifest, installationManifest, err
 	}
 	defer func() {
 		if err != nil {
@@ -362,9 +449,27 @@ func (c *deployCmd) validate(
 			}
 		}
 	}()
+	defer func() {
+		if err != nil {
+			deleteErr := resolvedManifest.Delete()
+			if deleteErr != nil {
+				c.logger.Warn(c.logTag, "Failed to delete interpolated deployment manifest: %s", deleteErr.Error())
+			}
+		}
+	}()
 
 	err = validationStage.Perform("Validating deployment manifest", func() error {
-		releaseSetManifest, err := c.releaseSetParser.Parse(deploymentManifestPath)
+		variablesSources := flags.variablesSourcesFor(c.userConfig)
+		if dryRun {
+			variablesSources = flags.readOnlyVariablesSourcesFor(c.userConfig)
+		}
+
+		resolvedManifest, err = c.manifestResolver.Resolve(deploymentManifestPath, flags.opsFilePaths, variablesSources)
+		if err != nil {
+			return bosherr.WrapErrorf(err, "Resolving variables in deployment manifest '%s'", deploymentManifestPath)
+		}
+
+		releaseSetManifest, err := c.releaseSetParser.Parse(resolvedManifest.Path)
 		if err != nil {
 			return bosherr.WrapErrorf(err, "Parsing release set manifest '%s'", deploymentManifestPath)
 		}
@@ -377,7 +482,7 @@ func (c *deployCmd) validate(
 		//TODO: this seems to be a naming smell indicating a deeper issue
 		c.releaseResolver.Filter(releaseSetManifest.Releases)
 
-		deploymentManifest, err = c.deploymentParser.Parse(deploymentManifestPath)
+		deploymentManifest, err = c.deploymentParser.Parse(resolvedManifest.Path)
 		if err != nil {
 			return bosherr.WrapErrorf(err, "Parsing deployment manifest '%s'", deploymentManifestPath)
 		}
@@ -387,7 +492,7 @@ func (c *deployCmd) validate(
 			return bosherr.WrapError(err, "Validating deployment manifest")
 		}
 
-		installationManifest, err = c.installationParser.Parse(deploymentManifestPath)
+		installationManifest, err = c.installationParser.Parse(resolvedManifest.Path)
 		if err != nil {
 			return bosherr.WrapErrorf(err, "Parsing installation manifest '%s'", deploymentManifestPath)
 		}
@@ -400,7 +505,17 @@ func (c *deployCmd) validate(
 		return nil
 	})
 	if err != nil {
-		return extractedStemcell, deploymentManifest, installationManifest, err
+		return extractedStemcell, resolvedManifest, deploymentManifest, installationManifest, err
+	}
+
+	var missingProperties []bideplmanifest.MissingProperty
+	err = validationStage.Perform("Validating job properties", func() error {
+		missingProperties, err = c.jobPropertiesValidator.Validate(deploymentManifest)
+		return err
+	})
+	reportMissingProperties(c.ui, missingProperties)
+	if err != nil {
+		return extractedStemcell, resolvedManifest, deploymentManifest, installationManifest, err
 	}
 
 	err = validationStage.Perform("Validating cpi release", func() error {
@@ -420,5 +535,13 @@ func (c *deployCmd) validate(
 		return nil
 	})
 
-	return extractedStemcell, deploymentManifest, installationManifest, err
+	return extractedStemcell, resolvedManifest, deploymentManifest, installationManifest, err
+}
+
+// reportMissingProperties warns about every property without a default that is not set,
+// since templates only fail on the ones they require once they are rendered
+func reportMissingProperties(ui biui.UI, missingProperties []bideplmanifest.MissingProperty) {
+	for _, missingProperty := range missingProperties {
+		ui.ErrorLinef("Warning: %s", missingProperty)
+	}
 }
@@ -10,8 +10,6 @@ import (
 	mock_blobstore "github.com/cloudfoundry/bosh-init/blobstore/mocks"
 	mock_cloud "github.com/cloudfoundry/bosh-init/cloud/mocks"
 	mock_config "github.com/cloudfoundry/bosh-init/config/mocks"
-	mock_httpagent "github.com/cloudfoundry/bosh-init/deployment/agentclient/http/mocks"
-	mock_agentclient "github.com/cloudfoundry/bosh-init/deployment/agentclient/mocks"
 	mock_deployment "github.com/cloudfoundry/bosh-init/deployment/mocks"
 	mock_vm "github.com/cloudfoundry/bosh-init/deployment/vm/mocks"
 	mock_install "github.com/cloudfoundry/bosh-init/installation/mocks"
@@ -29,6 +27,7 @@ import (
 	biinstall "github.com/cloudfoundry/bosh-init/installation"
 	biinstalljob "github.com/cloudfoundry/bosh-init/installation/job"
 	biinstallmanifest "github.com/cloudfoundry/bosh-init/installation/manifest"
+	bimanifest "github.com/cloudfoundry/bosh-init/manifest"
 	birel "github.com/cloudfoundry/bosh-init/release"
 	bireljob "github.com/cloudfoundry/bosh-init/release/job"
 	birelmanifest "github.com/cloudfoundry/bosh-init/release/manifest"
@@ -38,6 +37,7 @@ import (
 	biui "github.com/cloudfoundry/bosh-init/ui"
 
 	fakesys "github.com/cloudfoundry/bosh-agent/system/fakes"
+	faketime "github.com/cloudfoundry/bosh-agent/time/fakes"
 	fakeuuid "github.com/cloudfoundry/bosh-agent/uuid/fakes"
 	fakebicloud "github.com/cloudfoundry/bosh-init/cloud/fakes"
 	fakebideplmanifest "github.com/cloudfoundry/bosh-init/deployment/manifest/fakes"
@@ -87,8 +87,6 @@ func rootDesc() {
 			releaseSetResolver        birelset.Resolver
 			mockRegistryServerManager *mock_registry.MockServerManager
 			mockRegistryServer        *mock_registry.MockServer
-			mockAgentClient           *mock_agentclient.MockAgentClient
-			mockAgentClientFactory    *mock_httpagent.MockAgentClientFactory
 			mockCloudFactory          *mock_cloud.MockFactory
 
 			fakeCPIRelease *fakebirel.FakeRelease
@@ -111,6 +109,7 @@ func rootDesc() {
 			fakeReleaseSetValidator            *fakebirelsetmanifest.FakeValidator
 			fakeInstallationValidator          *fakebiinstallmanifest.FakeValidator
 			fakeDeploymentValidator            *fakebideplval.FakeValidator
+			fakeJobPropertiesValidator         *fakebideplval.FakeJobPropertiesValidator
 
 			directorID          = "generated-director-uuid"
 			fakeUUIDGenerator   *fakeuuid.FakeGenerator
@@ -169,19 +168,15 @@ func rootDesc() {
 			mockRegistryServerManager = mock_registry.NewMockServerManager(mockCtrl)
 			mockRegistryServer = mock_registry.NewMockServer(mockCtrl)
 
-			mockAgentClientFactory = mock_httpagent.NewMockAgentClientFactory(mockCtrl)
-			mockAgentClient = mock_agentclient.NewMockAgentClient(mockCtrl)
-			mockAgentClientFactory.EXPECT().NewAgentClient(gomock.Any(), gomock.Any()).Return(mockAgentClient).AnyTimes()
-
 			mockCloudFactory = mock_cloud.NewMockFactory(mockCtrl)
 
 			mockBlobstoreFactory = mock_blobstore.NewMockFactory(mockCtrl)
 			mockBlobstore = mock_blobstore.NewMockBlobstore(mockCtrl)
-			mockBlobstoreFactory.EXPECT().Create(mbusURL).Return(mockBlobstore, nil).AnyTimes()
+			mockBlobstoreFactory.EXPECT().Create(mbusURL, biinstallmanifest.Cert{}).Return(mockBlobstore, nil).AnyTimes()
 
 			mockVMManagerFactory = mock_vm.NewMockManagerFactory(mockCtrl)
 			fakeVMManager = fakebivm.NewFakeManager()
-			mockVMManagerFactory.EXPECT().NewManager(gomock.Any(), mockAgentClient).Return(fakeVMManager).AnyTimes()
+			mockVMManagerFactory.EXPECT().NewManager(gomock.Any(), directorID, mbusURL, biinstallmanifest.Cert{}).Return(fakeVMManager).AnyTimes()
 
 			fakeStemcellExtractor = fakebistemcell.NewFakeExtractor()
 			mockStemcellManager = mock_stemcell.NewMockManager(mockCtrl)
@@ -195,12 +190,13 @@ func rootDesc() {
 
 			configUUIDGenerator = &fakeuuid.FakeGenerator{}
 			configUUIDGenerator.GeneratedUUID = directorID
-			setupDeploymentConfigService = biconfig.NewFileSystemDeploymentConfigService(fakeFs, configUUIDGenerator, logger)
+			setupDeploymentConfigService = biconfig.NewFileSystemDeploymentConfigService(fakeFs, configUUIDGenerator, &faketime.FakeService{}, crypto.NewEncryptor(nil), logger)
 			setupDeploymentConfigService.SetConfigPath(deploymentConfigPath)
 
 			fakeReleaseSetValidator = fakebirelsetmanifest.NewFakeValidator()
 			fakeInstallationValidator = fakebiinstallmanifest.NewFakeValidator()
 			fakeDeploymentValidator = fakebideplval.NewFakeValidator()
+			fakeJobPropertiesValidator = fakebideplval.NewFakeJobPropertiesValidator()
 
 			fakeStage = fakebiui.NewFakeStage()
 
@@ -247,6 +243,11 @@ func rootDesc() {
 				{Err: nil},
 			})
 
+			// job properties are valid
+			fakeJobPropertiesValidator.SetValidateBehavior([]fakebideplval.JobPropertiesValidateOutput{
+				{Err: nil},
+			})
+
 			// stemcell exists
 			fakeFs.WriteFile(stemcellTarballPath, []byte{})
 
@@ -277,7 +278,8 @@ func rootDesc() {
 				Name: "fake-deployment-name",
 				Jobs: []bideplmanifest.Job{
 					{
-						Name: "fake-job-name",
+						Name:      "fake-job-name",
+						Instances: 1,
 					},
 				},
 			}
@@ -303,16 +305,21 @@ func rootDesc() {
 		})
 
 		JustBeforeEach(func() {
-			deploymentConfigService := biconfig.NewFileSystemDeploymentConfigService(fakeFs, configUUIDGenerator, logger)
+			deploymentConfigService := biconfig.NewFileSystemDeploymentConfigService(fakeFs, configUUIDGenerator, &faketime.FakeService{}, crypto.NewEncryptor(nil), logger)
 			deploymentRepo := biconfig.NewDeploymentRepo(deploymentConfigService)
 			releaseRepo := biconfig.NewReleaseRepo(deploymentConfigService, fakeUUIDGenerator)
 			stemcellRepo := biconfig.NewStemcellRepo(deploymentConfigService, fakeUUIDGenerator)
-			deploymentRecord := deployment.NewRecord(deploymentRepo, releaseRepo, stemcellRepo, sha1Calculator)
+			vmRepo := biconfig.NewVMRepo(deploymentConfigService)
+			diskRepo := biconfig.NewDiskRepo(deploymentConfigService, fakeUUIDGenerator)
+			fingerprinter := bideplmanifest.NewFingerprinter(fakeFs)
+			deploymentRecord := deployment.NewRecord(deploymentRepo, releaseRepo, stemcellRepo, sha1Calculator, fingerprinter)
+			planner := deployment.NewPlanner(deploymentRecord, deploymentRepo, releaseRepo, stemcellRepo, vmRepo, diskRepo, sha1Calculator, fingerprinter)
 
 			command = bicmd.NewDeployCmd(
 				userInterface,
 				userConfig,
 				fakeFs,
+				bimanifest.NewResolver(fakeFs, bimanifest.NewVariablesLoader(fakeFs, []string{}, logger), bimanifest.NewVariablesStore(fakeFs, crypto.NewEncryptor(nil), logger), bimanifest.NewVariablesGenerator(logger), bimanifest.NewOpsApplier(fakeFs, logger), bimanifest.NewInterpolator(logger), logger),
 				fakeReleaseSetParser,
 				fakeInstallationParser,
 				fakeDeploymentParser,
@@ -321,16 +328,17 @@ func rootDesc() {
 				fakeReleaseSetValidator,
 				fakeInstallationValidator,
 				fakeDeploymentValidator,
+				fakeJobPropertiesValidator,
 				mockInstallerFactory,
 				mockReleaseExtractor,
 				releaseManager,
 				releaseSetResolver,
 				mockCloudFactory,
-				mockAgentClientFactory,
 				mockVMManagerFactory,
 				fakeStemcellExtractor,
 				fakeStemcellManagerFactory,
 				deploymentRecord,
+				planner,
 				mockBlobstoreFactory,
 				mockDeployer,
 				configUUIDGenerator,
@@ -361,7 +369,7 @@ func rootDesc() {
 
 			mockInstallerFactory.EXPECT().NewInstaller().Return(mockInstaller, nil).AnyTimes()
 
-			installation := biinstall.NewInstallation(target, installedJob, installationManifest, mockRegistryServerManager)
+			installation := biinstall.NewInstallation(target, installedJob, nil, installationManifest, mockRegistryServerManager)
 
 			expectInstall = mockInstaller.EXPECT().Install(installationManifest, gomock.Any()).Do(func(_ interface{}, stage biui.Stage) {
 				Expect(fakeStage.SubStages).To(ContainElement(stage))
@@ -395,6 +403,39 @@ func rootDesc() {
 			Expect(stdOut).To(gbytes.Say("Deployment state: '/path/to/deployment.json'"))
 		})
 
+		It("stores the deployment state at the path given with --state", func() {
+			err := command.Run(fakeStage, []string{deploymentManifestPath, stemcellTarballPath, cpiReleaseTarballPath, "--state", "/other/path/state.json"})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(stdOut).To(gbytes.Say("Deployment state: '/other/path/state.json'"))
+			Expect(fakeFs.FileExists("/other/path/state.json")).To(BeTrue())
+			Expect(fakeFs.FileExists("/path/to/deployment.json")).To(BeFalse())
+		})
+
+		It("locks the deployment state while deploying", func() {
+			err := command.Run(fakeStage, []string{deploymentManifestPath, stemcellTarballPath, cpiReleaseTarballPath})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fakeFs.FileExists("/path/to/deployment.json.lock")).To(BeFalse())
+			Expect(fakeInstallationParser.ParsePath).To(Equal(deploymentManifestPath))
+		})
+
+		Context("when the deployment state is locked by another process", func() {
+			BeforeEach(func() {
+				err := fakeFs.WriteFileString("/path/to/deployment.json.lock", `{"pid":1234,"host":"fake-host"}`)
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			It("returns an error without deploying", func() {
+				err := command.Run(fakeStage, []string{deploymentManifestPath, stemcellTarballPath, cpiReleaseTarballPath})
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("locked by process 1234 on host 'fake-host'"))
+
+				Expect(fakeInstallationParser.ParsePath).To(BeEmpty())
+				Expect(fakeFs.FileExists("/path/to/deployment.json.lock")).To(BeTrue())
+			})
+		})
+
 		It("does not migrate the legacy bosh-deployments.yml if deployment.json exists", func() {
 			err := fakeFs.WriteFileString(deploymentConfigPath, "{}")
 			Expect(err).ToNot(HaveOccurred())
@@ -457,6 +498,30 @@ func rootDesc() {
 			}))
 		})
 
+		It("validates job properties", func() {
+			err := command.Run(fakeStage, []string{deploymentManifestPath, stemcellTarballPath, cpiReleaseTarballPath})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeJobPropertiesValidator.ValidateInputs).To(Equal([]fakebideplval.ValidateInput{
+				{Manifest: boshDeploymentManifest},
+			}))
+		})
+
+		It("warns about every job property without a default that is not set, and deploys", func() {
+			fakeJobPropertiesValidator.SetValidateBehavior([]fakebideplval.JobPropertiesValidateOutput{
+				{
+					MissingProperties: []bideplmanifest.MissingProperty{
+						{Path: "jobs[0].properties.nats.password", Job: "fake-release-job", Release: "fake-release-name"},
+						{Path: "jobs[0].properties.director.name", Job: "fake-release-job", Release: "fake-release-name"},
+					},
+				},
+			})
+
+			err := command.Run(fakeStage, []string{deploymentManifestPath, stemcellTarballPath, cpiReleaseTarballPath})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stdErr).To(gbytes.Say("Warning: jobs\\[0\\]\\.properties\\.nats\\.password is not set, and job 'fake-release-job' in release 'fake-release-name' has no default for it"))
+			Expect(stdErr).To(gbytes.Say("Warning: jobs\\[0\\]\\.properties\\.director\\.name is not set, and job 'fake-release-job' in release 'fake-release-name' has no default for it"))
+		})
+
 		It("logs validating stages", func() {
 			err := command.Run(fakeStage, []string{deploymentManifestPath, stemcellTarballPath, cpiReleaseTarballPath})
 			Expect(err).NotTo(HaveOccurred())
@@ -468,6 +533,7 @@ func rootDesc() {
 						{Name: "Validating stemcell"},
 						{Name: "Validating releases"},
 						{Name: "Validating deployment manifest"},
+						{Name: "Validating job properties"},
 						{Name: "Validating cpi release"},
 					},
 				},
@@ -621,6 +687,189 @@ func rootDesc() {
 			})
 		})
 
+		Context("when --dry-run is given", func() {
+			It("prints the planned changes without installing the CPI or deploying", func() {
+				expectInstall.Times(0)
+				expectDeploy.Times(0)
+				expectStemcellUpload.Times(0)
+
+				err := command.Run(fakeStage, []string{"--dry-run", deploymentManifestPath, stemcellTarballPath, cpiReleaseTarballPath})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(stdOut).To(gbytes.Say("Planned changes \\(dry run, nothing was deployed\\):"))
+				Expect(stdOut).To(gbytes.Say("  - Stemcell 'fake-stemcell-name/fake-stemcell-version' will be uploaded"))
+				Expect(stdOut).To(gbytes.Say("  - Release 'fake-cpi-release-name/1.0' will be added"))
+				Expect(stdOut).To(gbytes.Say("  - VM for instance 'fake-job-name/0' will be created"))
+			})
+
+			It("does not update the deployment record", func() {
+				err := command.Run(fakeStage, []string{deploymentManifestPath, stemcellTarballPath, cpiReleaseTarballPath, "--dry-run"})
+				Expect(err).NotTo(HaveOccurred())
+
+				deploymentConfig, err := setupDeploymentConfigService.Load()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(deploymentConfig.CurrentManifestSHA1).To(BeEmpty())
+			})
+
+			It("does not lock or write the deployment state, nor migrate the legacy deployments file", func() {
+				expectLegacyMigrate.Times(0)
+
+				err := command.Run(fakeStage, []string{"--dry-run", deploymentManifestPath, stemcellTarballPath, cpiReleaseTarballPath})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(fakeFs.FileExists(deploymentConfigPath)).To(BeFalse())
+				Expect(fakeFs.FileExists(deploymentConfigPath + ".lock")).To(BeFalse())
+			})
+
+			It("leaves an existing deployment state unchanged", func() {
+				err := fakeFs.WriteFileString(deploymentConfigPath, `{"director_id":"fake-director-id"}`)
+				Expect(err).ToNot(HaveOccurred())
+
+				err = command.Run(fakeStage, []string{"--dry-run", deploymentManifestPath, stemcellTarballPath, cpiReleaseTarballPath})
+				Expect(err).NotTo(HaveOccurred())
+
+				contents, err := fakeFs.ReadFileString(deploymentConfigPath)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(contents).To(Equal(`{"director_id":"fake-director-id"}`))
+			})
+		})
+
+		Context("when the deployment manifest has variables", func() {
+			BeforeEach(func() {
+				fakeFs.WriteFileString(deploymentManifestPath, "---\nname: ((deployment-name))\n")
+				fakeFs.WriteFileString("/path/to/vars.yml", "deployment-name: fake-deployment-name\n")
+				fakeFs.ReturnTempFile = fakesys.NewFakeFile("/fake-interpolated-manifest", fakeFs)
+				fakeFs.RegisterOpenFile("/fake-interpolated-manifest", &fakesys.FakeFile{
+					Stats: &fakesys.FakeFileStats{FileType: fakesys.FakeFileTypeFile},
+				})
+			})
+
+			It("parses the manifests with the variables interpolated", func() {
+				err := command.Run(fakeStage, []string{"--vars-file", "/path/to/vars.yml", deploymentManifestPath, stemcellTarballPath, cpiReleaseTarballPath})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(fakeReleaseSetParser.ParsePath).To(Equal("/fake-interpolated-manifest"))
+				Expect(fakeDeploymentParser.ParsePath).To(Equal("/fake-interpolated-manifest"))
+				Expect(fakeInstallationParser.ParsePath).To(Equal("/fake-interpolated-manifest"))
+			})
+
+			It("accepts variables given with --var", func() {
+				err := command.Run(fakeStage, []string{"--var=deployment-name=fake-deployment-name", deploymentManifestPath, stemcellTarballPath, cpiReleaseTarballPath})
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("deletes the interpolated manifest", func() {
+				err := command.Run(fakeStage, []string{"--vars-file", "/path/to/vars.yml", deploymentManifestPath, stemcellTarballPath, cpiReleaseTarballPath})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(fakeFs.FileExists("/fake-interpolated-manifest")).To(BeFalse())
+				Expect(fakeFs.FileExists(deploymentManifestPath)).To(BeTrue())
+			})
+
+			It("logs the variables that are not found in the failed event log", func() {
+				err := command.Run(fakeStage, []string{deploymentManifestPath, stemcellTarballPath, cpiReleaseTarballPath})
+				Expect(err).To(HaveOccurred())
+
+				performCall := fakeStage.PerformCalls[0].Stage.PerformCalls[2]
+				Expect(performCall.Name).To(Equal("Validating deployment manifest"))
+				Expect(performCall.Error.Error()).To(ContainSubstring("Expected to find variables: deployment-name"))
+			})
+
+			It("returns err when a variables flag has no value", func() {
+				err := command.Run(fakeStage, []string{deploymentManifestPath, stemcellTarballPath, cpiReleaseTarballPath, "--vars-file"})
+				Expect(err).To(HaveOccurred())
+				Expect(stdErr).To(gbytes.Say("Invalid usage - flag '--vars-file' requires a value"))
+			})
+		})
+
+		Context("when the deployment manifest declares variables to generate", func() {
+			BeforeEach(func() {
+				fakeFs.WriteFileString(deploymentManifestPath, "---\nname: fake-deployment-name\nproperties:\n  password: ((password))\nvariables:\n- name: password\n  type: password\n")
+				fakeFs.ReturnTempFile = fakesys.NewFakeFile("/fake-interpolated-manifest", fakeFs)
+				fakeFs.RegisterOpenFile("/fake-interpolated-manifest", &fakesys.FakeFile{
+					Stats: &fakesys.FakeFileStats{FileType: fakesys.FakeFileTypeFile},
+				})
+			})
+
+			It("saves the generated variables in a vars store next to the deployment state", func() {
+				err := command.Run(fakeStage, []string{deploymentManifestPath, stemcellTarballPath, cpiReleaseTarballPath})
+				Expect(err).NotTo(HaveOccurred())
+
+				contents, err := fakeFs.ReadFileString("/path/to/vars-store.yml")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(contents).To(MatchRegexp(`password: [a-z0-9]{20}`))
+			})
+
+			It("saves the generated variables in the vars store given with --vars-store", func() {
+				err := command.Run(fakeStage, []string{"--vars-store", "/path/to/creds.yml", deploymentManifestPath, stemcellTarballPath, cpiReleaseTarballPath})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(fakeFs.FileExists("/path/to/creds.yml")).To(BeTrue())
+				Expect(fakeFs.FileExists("/path/to/vars-store.yml")).To(BeFalse())
+			})
+
+			It("reuses the stored variables", func() {
+				fakeFs.WriteFileString("/path/to/vars-store.yml", "password: stored-password\n")
+
+				err := command.Run(fakeStage, []string{deploymentManifestPath, stemcellTarballPath, cpiReleaseTarballPath})
+				Expect(err).NotTo(HaveOccurred())
+
+				contents, err := fakeFs.ReadFileString("/path/to/vars-store.yml")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(contents).To(Equal("password: stored-password\n"))
+			})
+
+			Context("when --dry-run is given", func() {
+				It("uses the stored variables without changing the vars store", func() {
+					fakeFs.WriteFileString("/path/to/vars-store.yml", "password: stored-password\n")
+
+					err := command.Run(fakeStage, []string{"--dry-run", deploymentManifestPath, stemcellTarballPath, cpiReleaseTarballPath})
+					Expect(err).NotTo(HaveOccurred())
+
+					contents, err := fakeFs.ReadFileString("/path/to/vars-store.yml")
+					Expect(err).ToNot(HaveOccurred())
+					Expect(contents).To(Equal("password: stored-password\n"))
+				})
+
+				It("does not generate the variables or write the vars store", func() {
+					command.Run(fakeStage, []string{"--dry-run", deploymentManifestPath, stemcellTarballPath, cpiReleaseTarballPath})
+
+					Expect(fakeFs.FileExists("/path/to/vars-store.yml")).To(BeFalse())
+					Expect(fakeFs.FileExists(deploymentConfigPath)).To(BeFalse())
+				})
+			})
+		})
+
+		Context("when ops files are given", func() {
+			BeforeEach(func() {
+				fakeFs.WriteFileString(deploymentManifestPath, "---\nname: fake-deployment-name\n")
+				fakeFs.WriteFileString("/path/to/ops.yml", "- type: replace\n  path: /name\n  value: patched-deployment-name\n")
+				fakeFs.WriteFileString("/path/to/invalid-ops.yml", "- type: remove\n  path: /missing\n")
+				fakeFs.ReturnTempFile = fakesys.NewFakeFile("/fake-patched-manifest", fakeFs)
+				fakeFs.RegisterOpenFile("/fake-patched-manifest", &fakesys.FakeFile{
+					Stats: &fakesys.FakeFileStats{FileType: fakesys.FakeFileTypeFile},
+				})
+			})
+
+			It("parses the manifests with the ops applied", func() {
+				err := command.Run(fakeStage, []string{"--ops-file", "/path/to/ops.yml", deploymentManifestPath, stemcellTarballPath, cpiReleaseTarballPath})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(fakeReleaseSetParser.ParsePath).To(Equal("/fake-patched-manifest"))
+				Expect(fakeDeploymentParser.ParsePath).To(Equal("/fake-patched-manifest"))
+				Expect(fakeInstallationParser.ParsePath).To(Equal("/fake-patched-manifest"))
+			})
+
+			It("logs the failing operation in the failed event log", func() {
+				err := command.Run(fakeStage, []string{"--ops-file=/path/to/invalid-ops.yml", deploymentManifestPath, stemcellTarballPath, cpiReleaseTarballPath})
+				Expect(err).To(HaveOccurred())
+
+				performCall := fakeStage.PerformCalls[0].Stage.PerformCalls[2]
+				Expect(performCall.Name).To(Equal("Validating deployment manifest"))
+				Expect(performCall.Error.Error()).To(ContainSubstring("Applying operation [0] in ops file '/path/to/invalid-ops.yml' (type 'remove', path '/missing')"))
+			})
+		})
+
 		Context("when parsing the cpi deployment manifest fails", func() {
 			BeforeEach(func() {
 				fakeDeploymentParser.ParseErr = bosherr.Error("fake-parse-error")
@@ -927,6 +1176,29 @@ func rootDesc() {
 			})
 		})
 
+		Context("when the job properties are invalid", func() {
+			BeforeEach(func() {
+				fakeJobPropertiesValidator.SetValidateBehavior([]fakebideplval.JobPropertiesValidateOutput{
+					{Err: bosherr.Error("fake-job-properties-validation-error")},
+				})
+			})
+
+			It("returns err", func() {
+				err := command.Run(fakeStage, []string{deploymentManifestPath, stemcellTarballPath, cpiReleaseTarballPath})
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("fake-job-properties-validation-error"))
+			})
+
+			It("logs the failed event log", func() {
+				err := command.Run(fakeStage, []string{deploymentManifestPath, stemcellTarballPath, cpiReleaseTarballPath})
+				Expect(err).To(HaveOccurred())
+
+				performCall := fakeStage.PerformCalls[0].Stage.PerformCalls[3]
+				Expect(performCall.Name).To(Equal("Validating job properties"))
+				Expect(performCall.Error.Error()).To(Equal("fake-job-properties-validation-error"))
+			})
+		})
+
 		It("returns err when no arguments are given", func() {
 			err := command.Run(fakeStage, []string{})
 			Expect(err).To(HaveOccurred())
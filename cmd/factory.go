@@ -2,6 +2,8 @@ package cmd
 
 import (
 	"errors"
+	"net/http"
+	"os"
 	"path/filepath"
 	"time"
 
@@ -27,6 +29,7 @@ import (
 	biindex "github.com/cloudfoundry/bosh-init/index"
 	biinstall "github.com/cloudfoundry/bosh-init/installation"
 	biinstallmanifest "github.com/cloudfoundry/bosh-init/installation/manifest"
+	bimanifest "github.com/cloudfoundry/bosh-init/manifest"
 	biregistry "github.com/cloudfoundry/bosh-init/registry"
 	birel "github.com/cloudfoundry/bosh-init/release"
 	birelset "github.com/cloudfoundry/bosh-init/release/set"
@@ -53,6 +56,12 @@ type factory struct {
 	logger                         boshlog.Logger
 	uuidGenerator                  boshuuid.Generator
 	workspaceRootPath              string
+	erbRendererEngine              string
+	cassetteConfig                 bicloud.CassetteConfig
+	signalTrap                     bicloud.SignalTrap
+	stateKey                       []byte
+	encryptor                      bicrypto.Encryptor
+	erbRenderer                    bitemplateerb.ERBRenderer
 	runner                         boshsys.CmdRunner
 	compressor                     boshcmd.Compressor
 	agentClientFactory             bihttpagent.AgentClientFactory
@@ -70,12 +79,15 @@ type factory struct {
 	deploymentManagerFactory       bidepl.ManagerFactory
 	deploymentFactory              bidepl.Factory
 	deployer                       bidepl.Deployer
+	errandRunner                   bidepl.ErrandRunner
 	blobstoreFactory               biblobstore.Factory
 	eventLogger                    biui.Stage
 	installerFactory               biinstall.InstallerFactory
 	releaseExtractor               birel.Extractor
 	releaseManager                 birel.Manager
 	releaseResolver                birelset.Resolver
+	manifestResolver               bimanifest.Resolver
+	variablesStore                 bimanifest.VariablesStore
 	releaseSetParser               birelsetmanifest.Parser
 	releaseJobResolver             bideplrel.JobResolver
 	installationParser             biinstallmanifest.Parser
@@ -83,6 +95,7 @@ type factory struct {
 	releaseSetValidator            birelsetmanifest.Validator
 	installationValidator          biinstallmanifest.Validator
 	deploymentValidator            bideplmanifest.Validator
+	jobPropertiesValidator         bideplmanifest.JobPropertiesValidator
 	cloudFactory                   bicloud.Factory
 	stateBuilderFactory            biinstancestate.BuilderFactory
 	compiledPackageRepo            bistatepkg.CompiledPackageRepo
@@ -96,6 +109,10 @@ func NewFactory(
 	logger boshlog.Logger,
 	uuidGenerator boshuuid.Generator,
 	workspaceRootPath string,
+	erbRendererEngine string,
+	cassetteConfig bicloud.CassetteConfig,
+	stateKey []byte,
+	signalTrap bicloud.SignalTrap,
 ) Factory {
 	f := &factory{
 		userConfig:        userConfig,
@@ -105,11 +122,18 @@ func NewFactory(
 		logger:            logger,
 		uuidGenerator:     uuidGenerator,
 		workspaceRootPath: workspaceRootPath,
+		erbRendererEngine: erbRendererEngine,
+		cassetteConfig:    cassetteConfig,
+		stateKey:          stateKey,
+		signalTrap:        signalTrap,
 	}
 	f.commands = CommandList{
-		"deploy": f.createDeployCmd,
-		"delete": f.createDeleteCmd,
-		"help":   f.createHelpCmd,
+		"deploy":     f.createDeployCmd,
+		"delete":     f.createDeleteCmd,
+		"status":     f.createStatusCmd,
+		"run-errand": f.createRunErrandCmd,
+		"state":      f.createStateCmd,
+		"help":       f.createHelpCmd,
 	}
 	return f
 }
@@ -125,7 +149,35 @@ func (cl CommandList) Create(name string) (Cmd, error) {
 }
 
 func (f *factory) CreateCommand(name string) (Cmd, error) {
-	return f.commands.Create(name)
+	cmd, err := f.commands.Create(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return closingCmd{Cmd: cmd, close: f.closeAgentClients}, nil
+}
+
+// closingCmd releases the connections opened by a command when it ends
+type closingCmd struct {
+	Cmd
+	close func()
+}
+
+func (c closingCmd) Run(stage biui.Stage, args []string) error {
+	defer c.close()
+	return c.Cmd.Run(stage, args)
+}
+
+// closeAgentClients closes the NATS connections of the agent clients created by the command, if any
+func (f *factory) closeAgentClients() {
+	if f.agentClientFactory == nil {
+		return
+	}
+
+	err := f.agentClientFactory.Close()
+	if err != nil {
+		f.logger.Warn("factory", "Closing agent clients: %s", err.Error())
+	}
 }
 
 func (f *factory) createDeployCmd() (Cmd, error) {
@@ -135,12 +187,24 @@ func (f *factory) createDeployCmd() (Cmd, error) {
 	deploymentRepo := biconfig.NewDeploymentRepo(f.loadDeploymentConfigService())
 	releaseRepo := biconfig.NewReleaseRepo(f.loadDeploymentConfigService(), f.uuidGenerator)
 	sha1Calculator := bicrypto.NewSha1Calculator(f.fs)
-	deploymentRecord := bidepl.NewRecord(deploymentRepo, releaseRepo, f.loadStemcellRepo(), sha1Calculator)
+	fingerprinter := bideplmanifest.NewFingerprinter(f.fs)
+	deploymentRecord := bidepl.NewRecord(deploymentRepo, releaseRepo, f.loadStemcellRepo(), sha1Calculator, fingerprinter)
+	planner := bidepl.NewPlanner(
+		deploymentRecord,
+		deploymentRepo,
+		releaseRepo,
+		f.loadStemcellRepo(),
+		f.loadVMRepo(),
+		f.loadDiskRepo(),
+		sha1Calculator,
+		fingerprinter,
+	)
 
 	return NewDeployCmd(
 		f.ui,
 		f.userConfig,
 		f.fs,
+		f.loadManifestResolver(),
 		f.loadReleaseSetParser(),
 		f.loadInstallationParser(),
 		f.loadDeploymentParser(),
@@ -149,16 +213,17 @@ func (f *factory) createDeployCmd() (Cmd, error) {
 		f.loadReleaseSetValidator(),
 		f.loadInstallationValidator(),
 		f.loadDeploymentValidator(),
+		f.loadJobPropertiesValidator(),
 		f.loadInstallerFactory(),
 		f.loadReleaseExtractor(),
 		f.loadReleaseManager(),
 		f.loadReleaseResolver(),
 		f.loadCloudFactory(),
-		f.loadAgentClientFactory(),
 		f.loadVMManagerFactory(),
 		stemcellExtractor,
 		f.loadStemcellManagerFactory(),
 		deploymentRecord,
+		planner,
 		f.loadBlobstoreFactory(),
 		f.loadDeployer(),
 		f.uuidGenerator,
@@ -171,8 +236,10 @@ func (f *factory) createDeleteCmd() (Cmd, error) {
 		f.ui,
 		f.userConfig,
 		f.fs,
+		f.loadManifestResolver(),
 		f.loadReleaseSetParser(),
 		f.loadInstallationParser(),
+		f.loadDeploymentParser(),
 		f.loadDeploymentConfigService(),
 		f.loadReleaseSetValidator(),
 		f.loadInstallationValidator(),
@@ -181,13 +248,93 @@ func (f *factory) createDeleteCmd() (Cmd, error) {
 		f.loadReleaseManager(),
 		f.loadReleaseResolver(),
 		f.loadCloudFactory(),
-		f.loadAgentClientFactory(),
 		f.loadBlobstoreFactory(),
 		f.loadDeploymentManagerFactory(),
 		f.logger,
 	), nil
 }
 
+func (f *factory) createStatusCmd() (Cmd, error) {
+	installationFinder := biinstall.NewFinder(
+		f.loadDeploymentConfigService(),
+		f.fs,
+		f.loadInstallerFactory(),
+		f.loadRegistryServerManager(),
+		filepath.Join(f.workspaceRootPath, "installations"),
+	)
+
+	releaseRepo := biconfig.NewReleaseRepo(f.loadDeploymentConfigService(), f.uuidGenerator)
+	statusReporter := bidepl.NewStatusReporter(
+		f.loadDiskRepo(),
+		f.loadStemcellRepo(),
+		releaseRepo,
+		f.logger,
+	)
+
+	return NewStatusCmd(
+		f.ui,
+		f.userConfig,
+		f.fs,
+		f.loadManifestResolver(),
+		f.loadInstallationParser(),
+		f.loadDeploymentParser(),
+		f.loadDeploymentConfigService(),
+		installationFinder,
+		f.loadCloudFactory(),
+		f.loadVMManagerFactory(),
+		statusReporter,
+		f.logger,
+	), nil
+}
+
+func (f *factory) createRunErrandCmd() (Cmd, error) {
+	installationFinder := biinstall.NewFinder(
+		f.loadDeploymentConfigService(),
+		f.fs,
+		f.loadInstallerFactory(),
+		f.loadRegistryServerManager(),
+		filepath.Join(f.workspaceRootPath, "installations"),
+	)
+
+	return NewRunErrandCmd(
+		f.ui,
+		f.userConfig,
+		f.fs,
+		f.loadManifestResolver(),
+		f.loadReleaseSetParser(),
+		f.loadInstallationParser(),
+		f.loadDeploymentParser(),
+		f.loadDeploymentConfigService(),
+		f.loadReleaseSetValidator(),
+		f.loadInstallationValidator(),
+		f.loadDeploymentValidator(),
+		f.loadJobPropertiesValidator(),
+		installationFinder,
+		f.loadReleaseExtractor(),
+		f.loadReleaseManager(),
+		f.loadReleaseResolver(),
+		f.loadCloudFactory(),
+		f.loadVMManagerFactory(),
+		f.loadStemcellManagerFactory(),
+		f.loadBlobstoreFactory(),
+		f.loadErrandRunner(),
+		f.logger,
+	), nil
+}
+
+func (f *factory) createStateCmd() (Cmd, error) {
+	return NewStateCmd(
+		f.ui,
+		f.userConfig,
+		f.fs,
+		f.loadDeploymentConfigService(),
+		f.loadVariablesStore(),
+		f.loadEncryptor(),
+		filepath.Join(f.workspaceRootPath, "installations"),
+		f.logger,
+	), nil
+}
+
 func (f *factory) createHelpCmd() (Cmd, error) {
 	return NewHelpCmd(
 		f.ui,
@@ -287,6 +434,7 @@ func (f *factory) loadInstanceManagerFactory() biinstance.ManagerFactory {
 	}
 
 	f.instanceManagerFactory = biinstance.NewManagerFactory(
+		f.loadBlobstoreFactory(),
 		f.loadSSHTunnelFactory(),
 		f.loadInstanceFactory(),
 		f.logger,
@@ -320,8 +468,7 @@ func (f *factory) loadBuilderFactory() biinstancestate.BuilderFactory {
 		return f.stateBuilderFactory
 	}
 
-	erbRenderer := bitemplateerb.NewERBRenderer(f.fs, f.loadCMDRunner(), f.logger)
-	jobRenderer := bitemplate.NewJobRenderer(erbRenderer, f.fs, f.logger)
+	jobRenderer := bitemplate.NewJobRenderer(f.loadERBRenderer(), f.fs, f.logger)
 	jobListRenderer := bitemplate.NewJobListRenderer(jobRenderer, f.logger)
 
 	sha1Calculator := bicrypto.NewSha1Calculator(f.fs)
@@ -378,7 +525,7 @@ func (f *factory) loadAgentClientFactory() bihttpagent.AgentClientFactory {
 		return f.agentClientFactory
 	}
 
-	f.agentClientFactory = bihttpagent.NewAgentClientFactory(1*time.Second, f.logger)
+	f.agentClientFactory = bihttpagent.NewAgentClientFactory(1*time.Second, 30*time.Second, f.uuidGenerator, f.logger)
 	return f.agentClientFactory
 }
 
@@ -391,7 +538,9 @@ func (f *factory) loadVMManagerFactory() bivm.ManagerFactory {
 		f.loadVMRepo(),
 		f.loadStemcellRepo(),
 		f.loadDiskDeployer(),
+		f.loadAgentClientFactory(),
 		f.uuidGenerator,
+		f.timeService,
 		f.fs,
 		f.logger,
 	)
@@ -426,14 +575,37 @@ func (f *factory) loadDeploymentConfigService() biconfig.DeploymentConfigService
 		return f.deploymentConfigService
 	}
 
-	f.deploymentConfigService = biconfig.NewFileSystemDeploymentConfigService(
+	f.deploymentConfigService = biconfig.NewDeploymentConfigService(
 		f.fs,
 		f.uuidGenerator,
+		f.timeService,
+		f.loadEncryptor(),
+		http.DefaultClient,
 		f.logger,
 	)
+
+	// the deployment lock is released by the deferred Unlock of the command, unless bosh-init exits on a second interrupt
+	deploymentConfigService := f.deploymentConfigService
+	f.signalTrap.OnExit(func() {
+		err := deploymentConfigService.Unlock()
+		if err != nil {
+			f.logger.Warn("factory", "Failed to unlock deployment config: %s", err.Error())
+		}
+	})
+
 	return f.deploymentConfigService
 }
 
+// loadEncryptor returns the encryptor shared by everything that is encrypted at rest, so that 'state rekey' can set the new key once
+func (f *factory) loadEncryptor() bicrypto.Encryptor {
+	if f.encryptor != nil {
+		return f.encryptor
+	}
+
+	f.encryptor = bicrypto.NewEncryptor(f.stateKey)
+	return f.encryptor
+}
+
 func (f *factory) loadDeployer() bidepl.Deployer {
 	if f.deployer != nil {
 		return f.deployer
@@ -448,6 +620,23 @@ func (f *factory) loadDeployer() bidepl.Deployer {
 	return f.deployer
 }
 
+func (f *factory) loadErrandRunner() bidepl.ErrandRunner {
+	if f.errandRunner != nil {
+		return f.errandRunner
+	}
+
+	pingTimeout := 10 * time.Second
+	pingDelay := 500 * time.Millisecond
+
+	f.errandRunner = bidepl.NewErrandRunner(
+		f.loadInstanceManagerFactory(),
+		pingTimeout,
+		pingDelay,
+		f.logger,
+	)
+	return f.errandRunner
+}
+
 func (f *factory) loadBlobstoreFactory() biblobstore.Factory {
 	if f.blobstoreFactory != nil {
 		return f.blobstoreFactory
@@ -485,6 +674,25 @@ func (f *factory) loadReleaseResolver() birelset.Resolver {
 	return f.releaseResolver
 }
 
+func (f *factory) loadManifestResolver() bimanifest.Resolver {
+	if f.manifestResolver != nil {
+		return f.manifestResolver
+	}
+
+	variablesLoader := bimanifest.NewVariablesLoader(f.fs, os.Environ(), f.logger)
+	f.manifestResolver = bimanifest.NewResolver(f.fs, variablesLoader, f.loadVariablesStore(), bimanifest.NewVariablesGenerator(f.logger), bimanifest.NewOpsApplier(f.fs, f.logger), bimanifest.NewInterpolator(f.logger), f.logger)
+	return f.manifestResolver
+}
+
+func (f *factory) loadVariablesStore() bimanifest.VariablesStore {
+	if f.variablesStore != nil {
+		return f.variablesStore
+	}
+
+	f.variablesStore = bimanifest.NewVariablesStore(f.fs, f.loadEncryptor(), f.logger)
+	return f.variablesStore
+}
+
 func (f *factory) loadReleaseSetParser() birelsetmanifest.Parser {
 	if f.releaseSetParser != nil {
 		return f.releaseSetParser
@@ -530,6 +738,15 @@ func (f *factory) loadDeploymentValidator() bideplmanifest.Validator {
 	return f.deploymentValidator
 }
 
+func (f *factory) loadJobPropertiesValidator() bideplmanifest.JobPropertiesValidator {
+	if f.jobPropertiesValidator != nil {
+		return f.jobPropertiesValidator
+	}
+
+	f.jobPropertiesValidator = bideplmanifest.NewJobPropertiesValidator(f.loadReleaseResolver(), f.logger)
+	return f.jobPropertiesValidator
+}
+
 func (f *factory) loadReleaseSetValidator() birelsetmanifest.Validator {
 	if f.releaseSetValidator != nil {
 		return f.releaseSetValidator
@@ -544,7 +761,7 @@ func (f *factory) loadCloudFactory() bicloud.Factory {
 		return f.cloudFactory
 	}
 
-	f.cloudFactory = bicloud.NewFactory(f.fs, f.loadCMDRunner(), f.logger)
+	f.cloudFactory = bicloud.NewFactory(f.fs, f.loadCMDRunner(), f.timeService, f.signalTrap, f.cassetteConfig, f.logger)
 	return f.cloudFactory
 }
 
@@ -567,9 +784,24 @@ func (f *factory) loadInstallerFactory() biinstall.InstallerFactory {
 		f.loadCompressor(),
 		f.loadReleaseResolver(),
 		f.loadReleaseJobResolver(),
+		f.loadERBRenderer(),
 		f.uuidGenerator,
 		f.loadRegistryServerManager(),
+		f.loadEncryptor(),
 		f.logger,
 	)
 	return f.installerFactory
 }
+
+func (f *factory) loadERBRenderer() bitemplateerb.ERBRenderer {
+	if f.erbRenderer != nil {
+		return f.erbRenderer
+	}
+
+	if f.erbRendererEngine == bitemplateerb.EngineRuby {
+		f.erbRenderer = bitemplateerb.NewERBRenderer(f.fs, f.loadCMDRunner(), f.logger)
+	} else {
+		f.erbRenderer = bitemplateerb.NewGoERBRenderer(f.fs, f.logger)
+	}
+	return f.erbRenderer
+}
@@ -13,6 +13,8 @@ import (
 	fakesys "github.com/cloudfoundry/bosh-agent/system/fakes"
 	fakeuuid "github.com/cloudfoundry/bosh-agent/uuid/fakes"
 
+	bicloud "github.com/cloudfoundry/bosh-init/cloud"
+	fakebicloud "github.com/cloudfoundry/bosh-init/cloud/fakes"
 	biconfig "github.com/cloudfoundry/bosh-init/config"
 	biui "github.com/cloudfoundry/bosh-init/ui"
 
@@ -44,6 +46,10 @@ var _ = Describe("cmd.Factory", func() {
 			logger,
 			uuidGenerator,
 			"/fake-path",
+			"go",
+			bicloud.CassetteConfig{},
+			nil,
+			bicloud.NewSignalTrap(fakebicloud.NewFakeSignalNotifier(), func(int) {}, ui, logger),
 		)
 	})
 
@@ -67,6 +73,30 @@ var _ = Describe("cmd.Factory", func() {
 				Expect(cmd.Name()).To(Equal("delete"))
 			})
 		})
+
+		Describe("status command", func() {
+			It("returns status command", func() {
+				cmd, err := factory.CreateCommand("status")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(cmd.Name()).To(Equal("status"))
+			})
+		})
+
+		Describe("run-errand command", func() {
+			It("returns run-errand command", func() {
+				cmd, err := factory.CreateCommand("run-errand")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(cmd.Name()).To(Equal("run-errand"))
+			})
+		})
+
+		Describe("state command", func() {
+			It("returns state command", func() {
+				cmd, err := factory.CreateCommand("state")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(cmd.Name()).To(Equal("state"))
+			})
+		})
 	})
 
 	Context("unknown command name", func() {
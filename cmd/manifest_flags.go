@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"strings"
+
+	bosherr "github.com/cloudfoundry/bosh-agent/errors"
+
+	biconfig "github.com/cloudfoundry/bosh-init/config"
+	bimanifest "github.com/cloudfoundry/bosh-init/manifest"
+)
+
+const manifestFlagsUsage = "[--ops-file <path>...] [--var <name=value>...] [--vars-file <path>...] [--vars-env <prefix>...] [--vars-store <path>] [--regenerate-var <name>...] [--state <path_or_url>]"
+
+// manifestFlags change the deployment manifest before it is parsed, and where the deployment state is stored
+type manifestFlags struct {
+	opsFilePaths     []string
+	variablesSources bimanifest.VariablesSources
+	statePath        string
+}
+
+// parseManifestFlags removes the manifest flags from the args, returning the remaining args and the manifest flags.
+// Each flag may be given more than once, either as '--flag value' or '--flag=value'; the last '--vars-store' and '--state' are used.
+func parseManifestFlags(args []string) ([]string, manifestFlags, error) {
+	flags := manifestFlags{}
+	remainingArgs := []string{}
+	varsStorePaths := []string{}
+	statePaths := []string{}
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		var values *[]string
+		flag := strings.SplitN(arg, "=", 2)[0]
+		switch flag {
+		case "--ops-file":
+			values = &flags.opsFilePaths
+		case "--var":
+			values = &flags.variablesSources.Vars
+		case "--vars-file":
+			values = &flags.variablesSources.Files
+		case "--vars-env":
+			values = &flags.variablesSources.EnvPrefixes
+		case "--vars-store":
+			values = &varsStorePaths
+		case "--regenerate-var":
+			values = &flags.variablesSources.Regenerate
+		case "--state":
+			values = &statePaths
+		default:
+			remainingArgs = append(remainingArgs, arg)
+			continue
+		}
+
+		if len(arg) > len(flag) {
+			*values = append(*values, arg[len(flag)+1:])
+			continue
+		}
+
+		if i+1 >= len(args) {
+			return nil, manifestFlags{}, bosherr.Errorf("Invalid usage - flag '%s' requires a value", flag)
+		}
+		i++
+		*values = append(*values, args[i])
+	}
+
+	if len(varsStorePaths) > 0 {
+		flags.variablesSources.StorePath = varsStorePaths[len(varsStorePaths)-1]
+	}
+
+	if len(statePaths) > 0 {
+		flags.statePath = statePaths[len(statePaths)-1]
+	}
+
+	return remainingArgs, flags, nil
+}
+
+// variablesSourcesFor returns the variables sources, storing generated variables next to the deployment state unless '--vars-store' is given
+func (f manifestFlags) variablesSourcesFor(userConfig biconfig.UserConfig) bimanifest.VariablesSources {
+	sources := f.variablesSources
+	if sources.StorePath == "" {
+		sources.StorePath = userConfig.VarsStorePath()
+	}
+	return sources
+}
+
+// readOnlyVariablesSourcesFor returns the variables sources of a command that must not generate variables or write the vars store
+func (f manifestFlags) readOnlyVariablesSourcesFor(userConfig biconfig.UserConfig) bimanifest.VariablesSources {
+	sources := f.variablesSourcesFor(userConfig)
+	sources.ReadOnly = true
+	return sources
+}
+
+// deploymentConfigPathFor returns the deployment state path or URL given with '--state', or the deployment.json next to the deployment manifest
+func (f manifestFlags) deploymentConfigPathFor(userConfig biconfig.UserConfig) string {
+	if f.statePath != "" {
+		return f.statePath
+	}
+	return userConfig.DeploymentConfigPath()
+}
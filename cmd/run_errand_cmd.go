@@ -0,0 +1,400 @@
+package cmd
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+
+	bosherr "github.com/cloudfoundry/bosh-agent/errors"
+	boshlog "github.com/cloudfoundry/bosh-agent/logger"
+	boshsys "github.com/cloudfoundry/bosh-agent/system"
+
+	biblobstore "github.com/cloudfoundry/bosh-init/blobstore"
+	bicloud "github.com/cloudfoundry/bosh-init/cloud"
+	biconfig "github.com/cloudfoundry/bosh-init/config"
+	bidepl "github.com/cloudfoundry/bosh-init/deployment"
+	biagentclient "github.com/cloudfoundry/bosh-init/deployment/agentclient"
+	bideplmanifest "github.com/cloudfoundry/bosh-init/deployment/manifest"
+	bivm "github.com/cloudfoundry/bosh-init/deployment/vm"
+	biinstall "github.com/cloudfoundry/bosh-init/installation"
+	biinstallmanifest "github.com/cloudfoundry/bosh-init/installation/manifest"
+	bimanifest "github.com/cloudfoundry/bosh-init/manifest"
+	birel "github.com/cloudfoundry/bosh-init/release"
+	birelset "github.com/cloudfoundry/bosh-init/release/set"
+	birelsetmanifest "github.com/cloudfoundry/bosh-init/release/set/manifest"
+	bistemcell "github.com/cloudfoundry/bosh-init/stemcell"
+	biui "github.com/cloudfoundry/bosh-init/ui"
+)
+
+type runErrandCmd struct {
+	ui                      biui.UI
+	userConfig              biconfig.UserConfig
+	fs                      boshsys.FileSystem
+	manifestResolver        bimanifest.Resolver
+	releaseSetParser        birelsetmanifest.Parser
+	installationParser      biinstallmanifest.Parser
+	deploymentParser        bideplmanifest.Parser
+	deploymentConfigService biconfig.DeploymentConfigService
+	releaseSetValidator     birelsetmanifest.Validator
+	installationValidator   biinstallmanifest.Validator
+	deploymentValidator     bideplmanifest.Validator
+	jobPropertiesValidator  bideplmanifest.JobPropertiesValidator
+	installationFinder      biinstall.Finder
+	releaseExtractor        birel.Extractor
+	releaseManager          birel.Manager
+	releaseResolver         birelset.Resolver
+	cloudFactory            bicloud.Factory
+	vmManagerFactory        bivm.ManagerFactory
+	stemcellManagerFactory  bistemcell.ManagerFactory
+	blobstoreFactory        biblobstore.Factory
+	errandRunner            bidepl.ErrandRunner
+	logger                  boshlog.Logger
+	logTag                  string
+}
+
+func NewRunErrandCmd(
+	ui biui.UI,
+	userConfig biconfig.UserConfig,
+	fs boshsys.FileSystem,
+	manifestResolver bimanifest.Resolver,
+	releaseSetParser birelsetmanifest.Parser,
+	installationParser biinstallmanifest.Parser,
+	deploymentParser bideplmanifest.Parser,
+	deploymentConfigService biconfig.DeploymentConfigService,
+	releaseSetValidator birelsetmanifest.Validator,
+	installationValidator biinstallmanifest.Validator,
+	deploymentValidator bideplmanifest.Validator,
+	jobPropertiesValidator bideplmanifest.JobPropertiesValidator,
+	installationFinder biinstall.Finder,
+	releaseExtractor birel.Extractor,
+	releaseManager birel.Manager,
+	releaseResolver birelset.Resolver,
+	cloudFactory bicloud.Factory,
+	vmManagerFactory bivm.ManagerFactory,
+	stemcellManagerFactory bistemcell.ManagerFactory,
+	blobstoreFactory biblobstore.Factory,
+	errandRunner bidepl.ErrandRunner,
+	logger boshlog.Logger,
+) Cmd {
+	return &runErrandCmd{
+		ui:                      ui,
+		userConfig:              userConfig,
+		fs:                      fs,
+		manifestResolver:        manifestResolver,
+		releaseSetParser:        releaseSetParser,
+		installationParser:      installationParser,
+		deploymentParser:        deploymentParser,
+		deploymentConfigService: deploymentConfigService,
+		releaseSetValidator:     releaseSetValidator,
+		installationValidator:   installationValidator,
+		deploymentValidator:     deploymentValidator,
+		jobPropertiesValidator:  jobPropertiesValidator,
+		installationFinder:      installationFinder,
+		releaseExtractor:        releaseExtractor,
+		releaseManager:          releaseManager,
+		releaseResolver:         releaseResolver,
+		cloudFactory:            cloudFactory,
+		vmManagerFactory:        vmManagerFactory,
+		stemcellManagerFactory:  stemcellManagerFactory,
+		blobstoreFactory:        blobstoreFactory,
+		errandRunner:            errandRunner,
+		logger:                  logger,
+		logTag:                  "runErrandCmd",
+	}
+}
+
+func (c *runErrandCmd) Name() string {
+	return "run-errand"
+}
+
+func (c *runErrandCmd) Meta() Meta {
+	return Meta{
+		Synopsis: "Run an errand job of an existing deployment on a new VM",
+		Usage:    manifestFlagsUsage + " <deployment_manifest_path> <errand_name> <cpi_release_path> [<release_paths...>]",
+		Env:      genericEnv,
+	}
+}
+
+func (c *runErrandCmd) Run(stage biui.Stage, args []string) error {
+	deploymentManifestPath, errandName, releaseTarballPaths, flags, err := c.parseCmdInputs(args)
+	if err != nil {
+		return err
+	}
+
+	manifestAbsFilePath, err := filepath.Abs(deploymentManifestPath)
+	if err != nil {
+		c.ui.ErrorLinef("Failed getting absolute path to deployment file '%s'", deploymentManifestPath)
+		return bosherr.WrapErrorf(err, "Getting absolute path to deployment file '%s'", deploymentManifestPath)
+	}
+
+	if !c.fs.FileExists(manifestAbsFilePath) {
+		c.ui.ErrorLinef("Deployment '%s' does not exist", manifestAbsFilePath)
+		return bosherr.Errorf("Deployment manifest does not exist at '%s'", manifestAbsFilePath)
+	}
+
+	c.userConfig.DeploymentManifestPath = manifestAbsFilePath
+	c.ui.PrintLinef("Deployment manifest: '%s'", manifestAbsFilePath)
+
+	deploymentConfigPath := flags.deploymentConfigPathFor(c.userConfig)
+	c.deploymentConfigService.SetConfigPath(deploymentConfigPath)
+	deploymentConfigPath = biconfig.RedactDeploymentConfigPath(deploymentConfigPath)
+
+	c.ui.PrintLinef("Deployment state: '%s'", deploymentConfigPath)
+
+	if err := c.deploymentConfigService.Lock(); err != nil {
+		return bosherr.WrapError(err, "Locking deployment config")
+	}
+	defer func() {
+		unlockErr := c.deploymentConfigService.Unlock()
+		if unlockErr != nil {
+			c.logger.Warn(c.logTag, "Failed to unlock deployment config: %s", unlockErr.Error())
+		}
+	}()
+
+	if !c.deploymentConfigService.Exists() {
+		c.ui.ErrorLinef("No deployment config file found. The deployment must be deployed before an errand can be run.")
+		return bosherr.Errorf("Deployment config does not exist at '%s'", deploymentConfigPath)
+	}
+
+	deploymentConfig, err := c.deploymentConfigService.Load()
+	if err != nil {
+		return bosherr.WrapError(err, "Loading deployment config")
+	}
+
+	var (
+		deploymentManifest   bideplmanifest.Manifest
+		installationManifest biinstallmanifest.Manifest
+	)
+	err = stage.PerformComplex("validating", func(stage biui.Stage) error {
+		deploymentManifest, installationManifest, err = c.validate(stage, releaseTarballPaths, deploymentManifestPath, flags)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err := c.releaseManager.DeleteAll()
+		if err != nil {
+			c.logger.Warn(c.logTag, "Deleting all extracted releases: %s", err.Error())
+		}
+	}()
+
+	installation, found, err := c.installationFinder.Find(installationManifest, stage)
+	if err != nil {
+		return bosherr.WrapError(err, "Finding installed CPI")
+	}
+	if !found {
+		c.ui.ErrorLinef("No installed CPI found. The deployment must be deployed before an errand can be run.")
+		return bosherr.Error("Finding installed CPI: CPI is not installed")
+	}
+	defer func() {
+		err := installation.Cleanup()
+		if err != nil {
+			c.logger.Warn(c.logTag, "Failed to clean up CPI installation: %s", err.Error())
+		}
+	}()
+
+	err = stage.Perform("Starting registry", func() error {
+		return installation.StartRegistry()
+	})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err := installation.StopRegistry()
+		if err != nil {
+			c.logger.Warn(c.logTag, "Registry failed to stop: %s", err)
+		}
+	}()
+
+	cloud, err := c.cloudFactory.NewCloud(installation, deploymentConfig.DirectorID)
+	if err != nil {
+		return bosherr.WrapError(err, "Creating CPI client from CPI installation")
+	}
+
+	stemcellManager := c.stemcellManagerFactory.NewManager(cloud)
+	cloudStemcells, err := stemcellManager.FindCurrent()
+	if err != nil {
+		return bosherr.WrapError(err, "Finding current stemcell")
+	}
+	if len(cloudStemcells) == 0 {
+		c.ui.ErrorLinef("No current stemcell found. The deployment must be deployed before an errand can be run.")
+		return bosherr.Error("Finding current stemcell: no stemcell is deployed")
+	}
+
+	vmManager := c.vmManagerFactory.NewManager(cloud, deploymentConfig.DirectorID, installationManifest.Mbus, installationManifest.Cert)
+
+	blobstore, err := c.blobstoreFactory.Create(installationManifest.AgentBlobstoreURL(), installationManifest.Cert)
+	if err != nil {
+		return bosherr.WrapError(err, "Creating blobstore client")
+	}
+
+	var result biagentclient.ErrandResult
+	err = stage.PerformComplex("running errand", func(errandStage biui.Stage) error {
+		result, err = c.errandRunner.Run(
+			cloud,
+			errandName,
+			deploymentManifest,
+			cloudStemcells[0],
+			installationManifest.Registry,
+			installationManifest.SSHTunnel,
+			vmManager,
+			blobstore,
+			errandStage,
+		)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	c.printResult(errandName, result)
+
+	if result.ExitStatus != 0 {
+		return bosherr.Errorf("Errand '%s' completed with error (exit code %d)", errandName, result.ExitStatus)
+	}
+
+	return nil
+}
+
+func (c *runErrandCmd) printResult(errandName string, result biagentclient.ErrandResult) {
+	c.ui.PrintLinef("")
+	c.ui.PrintLinef("[stdout]")
+	c.printOutput(result.Stdout)
+	c.ui.PrintLinef("")
+	c.ui.PrintLinef("[stderr]")
+	c.printOutput(result.Stderr)
+	c.ui.PrintLinef("")
+
+	if result.ExitStatus == 0 {
+		c.ui.PrintLinef("Errand '%s' completed successfully (exit code %d)", errandName, result.ExitStatus)
+	} else {
+		c.ui.ErrorLinef("Errand '%s' completed with error (exit code %d)", errandName, result.ExitStatus)
+	}
+}
+
+func (c *runErrandCmd) printOutput(output string) {
+	if output == "" {
+		c.ui.PrintLinef("None")
+		return
+	}
+
+	for _, line := range strings.Split(strings.TrimRight(output, "\n"), "\n") {
+		c.ui.PrintLinef("%s", line)
+	}
+}
+
+func (c *runErrandCmd) parseCmdInputs(args []string) (string, string, []string, manifestFlags, error) {
+	args, flags, err := parseManifestFlags(args)
+	if err != nil {
+		c.ui.ErrorLinef("%s", err.Error())
+		c.logger.Error(c.logTag, "Invalid arguments: %#v", args)
+		return "", "", []string{}, manifestFlags{}, err
+	}
+
+	if len(args) < 3 {
+		c.ui.ErrorLinef("Invalid usage - run-errand command requires at least 3 arguments")
+		c.ui.PrintLinef("Expected usage: bosh-init run-errand %s <deployment-manifest> <errand-name> <cpi-release-tarball> [release-2-tarball [release-3-tarball...]]", manifestFlagsUsage)
+		c.logger.Error(c.logTag, "Invalid arguments: %#v", args)
+		return "", "", []string{}, manifestFlags{}, errors.New("Invalid usage - run-errand command requires at least 3 arguments")
+	}
+	return args[0], args[1], args[2:], flags, nil
+}
+
+// validate extracts the releases, which are needed to render the errand job, and validates the manifests
+func (c *runErrandCmd) validate(
+	validationStage biui.Stage,
+	releaseTarballPaths []string,
+	deploymentManifestPath string,
+	flags manifestFlags,
+) (
+	deploymentManifest bideplmanifest.Manifest,
+	installationManifest biinstallmanifest.Manifest,
+	err error,
+) {
+	err = validationStage.Perform("Validating releases", func() error {
+		for _, releaseTarballPath := range releaseTarballPaths {
+			if !c.fs.FileExists(releaseTarballPath) {
+				return bosherr.Errorf("Verifying that the release '%s' exists", releaseTarballPath)
+			}
+
+			release, err := c.releaseExtractor.Extract(releaseTarballPath)
+			if err != nil {
+				return bosherr.WrapErrorf(err, "Extracting release '%s'", releaseTarballPath)
+			}
+			c.releaseManager.Add(release)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return deploymentManifest, installationManifest, err
+	}
+	defer func() {
+		if err != nil {
+			err := c.releaseManager.DeleteAll()
+			if err != nil {
+				c.logger.Warn(c.logTag, "Deleting all extracted releases: %s", err.Error())
+			}
+		}
+	}()
+
+	err = validationStage.Perform("Validating deployment manifest", func() error {
+		resolvedManifest, err := c.manifestResolver.Resolve(deploymentManifestPath, flags.opsFilePaths, flags.variablesSourcesFor(c.userConfig))
+		if err != nil {
+			return bosherr.WrapErrorf(err, "Resolving variables in deployment manifest '%s'", deploymentManifestPath)
+		}
+		defer func() {
+			deleteErr := resolvedManifest.Delete()
+			if deleteErr != nil {
+				c.logger.Warn(c.logTag, "Failed to delete interpolated deployment manifest: %s", deleteErr.Error())
+			}
+		}()
+
+		releaseSetManifest, err := c.releaseSetParser.Parse(resolvedManifest.Path)
+		if err != nil {
+			return bosherr.WrapErrorf(err, "Parsing release set manifest '%s'", deploymentManifestPath)
+		}
+
+		err = c.releaseSetValidator.Validate(releaseSetManifest)
+		if err != nil {
+			return bosherr.WrapError(err, "Validating release set manifest")
+		}
+
+		c.releaseResolver.Filter(releaseSetManifest.Releases)
+
+		deploymentManifest, err = c.deploymentParser.Parse(resolvedManifest.Path)
+		if err != nil {
+			return bosherr.WrapErrorf(err, "Parsing deployment manifest '%s'", deploymentManifestPath)
+		}
+
+		err = c.deploymentValidator.Validate(deploymentManifest)
+		if err != nil {
+			return bosherr.WrapError(err, "Validating deployment manifest")
+		}
+
+		installationManifest, err = c.installationParser.Parse(resolvedManifest.Path)
+		if err != nil {
+			return bosherr.WrapErrorf(err, "Parsing installation manifest '%s'", deploymentManifestPath)
+		}
+
+		err = c.installationValidator.Validate(installationManifest)
+		if err != nil {
+			return bosherr.WrapError(err, "Validating installation manifest")
+		}
+
+		return nil
+	})
+	if err != nil {
+		return deploymentManifest, installationManifest, err
+	}
+
+	var missingProperties []bideplmanifest.MissingProperty
+	err = validationStage.Perform("Validating job properties", func() error {
+		missingProperties, err = c.jobPropertiesValidator.Validate(deploymentManifest)
+		return err
+	})
+	reportMissingProperties(c.ui, missingProperties)
+
+	return deploymentManifest, installationManifest, err
+}
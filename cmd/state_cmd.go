@@ -0,0 +1,263 @@
+package cmd
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+
+	bosherr "github.com/cloudfoundry/bosh-agent/errors"
+	boshlog "github.com/cloudfoundry/bosh-agent/logger"
+	boshsys "github.com/cloudfoundry/bosh-agent/system"
+
+	biconfig "github.com/cloudfoundry/bosh-init/config"
+	bicrypto "github.com/cloudfoundry/bosh-init/crypto"
+	biinstall "github.com/cloudfoundry/bosh-init/installation"
+	bimanifest "github.com/cloudfoundry/bosh-init/manifest"
+	biui "github.com/cloudfoundry/bosh-init/ui"
+)
+
+const stateCmdUsage = "rekey [--state <path_or_url>] [--vars-store <path>] (--new-key-file <path> | --decrypt) <deployment_manifest_path>"
+
+type stateCmd struct {
+	ui                      biui.UI
+	userConfig              biconfig.UserConfig
+	fs                      boshsys.FileSystem
+	deploymentConfigService biconfig.DeploymentConfigService
+	variablesStore          bimanifest.VariablesStore
+	encryptor               bicrypto.Encryptor
+	installationsRootPath   string
+	logger                  boshlog.Logger
+	logTag                  string
+}
+
+// NewStateCmd returns the 'state rekey' command, which encrypts the deployment state, the vars store and the rendered job templates
+// of the installation again with a new key.
+// The encryptor must be the one the deployment config service and the vars store encrypt with.
+func NewStateCmd(
+	ui biui.UI,
+	userConfig biconfig.UserConfig,
+	fs boshsys.FileSystem,
+	deploymentConfigService biconfig.DeploymentConfigService,
+	variablesStore bimanifest.VariablesStore,
+	encryptor bicrypto.Encryptor,
+	installationsRootPath string,
+	logger boshlog.Logger,
+) Cmd {
+	return &stateCmd{
+		ui:                      ui,
+		userConfig:              userConfig,
+		fs:                      fs,
+		deploymentConfigService: deploymentConfigService,
+		variablesStore:          variablesStore,
+		encryptor:               encryptor,
+		installationsRootPath:   installationsRootPath,
+		logger:                  logger,
+		logTag:                  "stateCmd",
+	}
+}
+
+func (c *stateCmd) Name() string {
+	return "state"
+}
+
+func (c *stateCmd) Meta() Meta {
+	return Meta{
+		Synopsis: "Encrypt the deployment state, vars store and rendered CPI job templates with a new key, or decrypt them",
+		Usage:    stateCmdUsage,
+		Env:      genericEnv,
+	}
+}
+
+type stateCmdInputs struct {
+	deploymentManifestPath string
+	flags                  manifestFlags
+	newKeyFile             string
+	decrypt                bool
+}
+
+func (c *stateCmd) Run(stage biui.Stage, args []string) error {
+	inputs, err := c.parseCmdInputs(args)
+	if err != nil {
+		return err
+	}
+
+	manifestAbsFilePath, err := filepath.Abs(inputs.deploymentManifestPath)
+	if err != nil {
+		c.ui.ErrorLinef("Failed getting absolute path to deployment file '%s'", inputs.deploymentManifestPath)
+		return bosherr.WrapErrorf(err, "Getting absolute path to deployment file '%s'", inputs.deploymentManifestPath)
+	}
+
+	c.userConfig.DeploymentManifestPath = manifestAbsFilePath
+	c.ui.PrintLinef("Deployment manifest: '%s'", manifestAbsFilePath)
+
+	deploymentConfigPath := inputs.flags.deploymentConfigPathFor(c.userConfig)
+	c.deploymentConfigService.SetConfigPath(deploymentConfigPath)
+	deploymentConfigPath = biconfig.RedactDeploymentConfigPath(deploymentConfigPath)
+
+	c.ui.PrintLinef("Deployment state: '%s'", deploymentConfigPath)
+
+	if !c.deploymentConfigService.Exists() {
+		c.ui.ErrorLinef("No deployment state found")
+		return bosherr.Errorf("Deployment state does not exist at '%s'", deploymentConfigPath)
+	}
+
+	var newKey []byte
+	if !inputs.decrypt {
+		newKey, err = bicrypto.LoadKey(c.fs, "", inputs.newKeyFile)
+		if err != nil {
+			return bosherr.WrapError(err, "Loading new key")
+		}
+	}
+
+	if err := c.deploymentConfigService.Lock(); err != nil {
+		return bosherr.WrapError(err, "Locking deployment config")
+	}
+	defer func() {
+		if err := c.deploymentConfigService.Unlock(); err != nil {
+			c.logger.Warn(c.logTag, "Failed to unlock deployment config: %s", err.Error())
+		}
+	}()
+
+	// contents encrypted with the current key can still be decrypted after the key is set,
+	// so running the command again after a failure finishes rekeying
+	c.encryptor.SetKey(newKey)
+
+	var deploymentConfig biconfig.DeploymentFile
+	err = stage.Perform("Rekeying deployment state", func() error {
+		deploymentConfig, err = c.deploymentConfigService.Load()
+		if err != nil {
+			return bosherr.WrapError(err, "Loading deployment config")
+		}
+
+		err = c.deploymentConfigService.Save(deploymentConfig)
+		if err != nil {
+			return bosherr.WrapError(err, "Saving deployment config")
+		}
+
+		err = c.deploymentConfigService.RekeyBackups()
+		if err != nil {
+			return bosherr.WrapError(err, "Rekeying deployment config backups")
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	varsStorePath := inputs.flags.variablesSourcesFor(c.userConfig).StorePath
+	if c.fs.FileExists(varsStorePath) {
+		err = stage.Perform("Rekeying vars store", func() error {
+			variables, err := c.variablesStore.Load(varsStorePath)
+			if err != nil {
+				return bosherr.WrapErrorf(err, "Loading vars store '%s'", varsStorePath)
+			}
+
+			err = c.variablesStore.Save(varsStorePath, variables)
+			if err != nil {
+				return bosherr.WrapErrorf(err, "Saving vars store '%s'", varsStorePath)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if deploymentConfig.InstallationID != "" {
+		target := biinstall.NewTarget(filepath.Join(c.installationsRootPath, deploymentConfig.InstallationID))
+		err = stage.Perform("Rekeying rendered CPI job templates", func() error {
+			return c.rekeyBlobs(target.BlobstorePath())
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.encryptor.HasKey() {
+		c.ui.PrintLinef("Deployment state encrypted with the new key")
+	} else {
+		c.ui.PrintLinef("Deployment state decrypted")
+	}
+
+	return nil
+}
+
+// rekeyBlobs encrypts the encrypted blobs again, which are the rendered job templates: package blobs are not encrypted
+func (c *stateCmd) rekeyBlobs(blobstorePath string) error {
+	blobPaths, err := c.fs.Glob(filepath.Join(blobstorePath, "*"))
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Finding blobs in '%s'", blobstorePath)
+	}
+
+	for _, blobPath := range blobPaths {
+		contents, err := c.fs.ReadFile(blobPath)
+		if err != nil {
+			return bosherr.WrapErrorf(err, "Reading blob '%s'", blobPath)
+		}
+
+		if !bicrypto.IsEncrypted(contents) {
+			continue
+		}
+
+		contents, err = c.encryptor.Decrypt(contents)
+		if err != nil {
+			return bosherr.WrapErrorf(err, "Decrypting blob '%s'", blobPath)
+		}
+
+		contents, err = c.encryptor.Encrypt(contents)
+		if err != nil {
+			return bosherr.WrapErrorf(err, "Encrypting blob '%s'", blobPath)
+		}
+
+		err = c.fs.WriteFile(blobPath, contents)
+		if err != nil {
+			return bosherr.WrapErrorf(err, "Writing blob '%s'", blobPath)
+		}
+		c.logger.Debug(c.logTag, "Rekeyed blob '%s'", blobPath)
+	}
+
+	return nil
+}
+
+func (c *stateCmd) parseCmdInputs(args []string) (stateCmdInputs, error) {
+	args, flags, err := parseManifestFlags(args)
+	if err != nil {
+		c.ui.ErrorLinef("%s", err.Error())
+		c.logger.Error(c.logTag, "Invalid arguments: %#v", args)
+		return stateCmdInputs{}, err
+	}
+
+	inputs := stateCmdInputs{flags: flags}
+	remainingArgs := []string{}
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--decrypt":
+			inputs.decrypt = true
+		case args[i] == "--new-key-file" && i+1 < len(args):
+			inputs.newKeyFile = args[i+1]
+			i++
+		case strings.HasPrefix(args[i], "--new-key-file="):
+			inputs.newKeyFile = strings.TrimPrefix(args[i], "--new-key-file=")
+		default:
+			remainingArgs = append(remainingArgs, args[i])
+		}
+	}
+
+	if len(remainingArgs) != 2 || remainingArgs[0] != "rekey" {
+		return stateCmdInputs{}, c.invalidUsage("Invalid usage - state command requires the 'rekey' subcommand and exactly 1 argument", args)
+	}
+
+	if (inputs.decrypt && inputs.newKeyFile != "") || (!inputs.decrypt && inputs.newKeyFile == "") {
+		return stateCmdInputs{}, c.invalidUsage("Invalid usage - state rekey requires exactly one of '--new-key-file' and '--decrypt'", args)
+	}
+
+	inputs.deploymentManifestPath = remainingArgs[1]
+	return inputs, nil
+}
+
+func (c *stateCmd) invalidUsage(message string, args []string) error {
+	c.ui.ErrorLinef("%s", message)
+	c.ui.PrintLinef("Expected usage: bosh-init state %s", stateCmdUsage)
+	c.logger.Error(c.logTag, "Invalid arguments: %#v", args)
+	return errors.New(message)
+}
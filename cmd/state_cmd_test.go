@@ -0,0 +1,186 @@
+package cmd_test
+
+import (
+	"errors"
+
+	. "github.com/cloudfoundry/bosh-init/cmd"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	boshlog "github.com/cloudfoundry/bosh-agent/logger"
+
+	fakesys "github.com/cloudfoundry/bosh-agent/system/fakes"
+	faketime "github.com/cloudfoundry/bosh-agent/time/fakes"
+	fakeuuid "github.com/cloudfoundry/bosh-agent/uuid/fakes"
+
+	biconfig "github.com/cloudfoundry/bosh-init/config"
+	bicrypto "github.com/cloudfoundry/bosh-init/crypto"
+	bimanifest "github.com/cloudfoundry/bosh-init/manifest"
+
+	fakebiui "github.com/cloudfoundry/bosh-init/ui/fakes"
+)
+
+var _ = Describe("StateCmd", func() {
+	var (
+		fs                *fakesys.FakeFileSystem
+		logger            boshlog.Logger
+		fakeUUIDGenerator *fakeuuid.FakeGenerator
+		fakeUI            *fakebiui.FakeUI
+		fakeStage         *fakebiui.FakeStage
+
+		deploymentManifestPath = "/deployment-dir/fake-deployment-manifest.yml"
+		deploymentConfigPath   = "/deployment-dir/deployment.json"
+		varsStorePath          = "/deployment-dir/vars-store.yml"
+		blobPath               = "/fake-workspace/installations/fake-installation-id/blobs/fake-template-blob-id"
+		packageBlobPath        = "/fake-workspace/installations/fake-installation-id/blobs/fake-package-blob-id"
+	)
+
+	// newStateCmd returns a command using the key, as the factory would with BOSH_INIT_STATE_KEY
+	var newStateCmd = func(key string) Cmd {
+		encryptor := bicrypto.NewEncryptor([]byte(key))
+		deploymentConfigService := biconfig.NewFileSystemDeploymentConfigService(fs, fakeUUIDGenerator, &faketime.FakeService{}, encryptor, logger)
+		return NewStateCmd(
+			fakeUI,
+			biconfig.UserConfig{},
+			fs,
+			deploymentConfigService,
+			bimanifest.NewVariablesStore(fs, encryptor, logger),
+			encryptor,
+			"/fake-workspace/installations",
+			logger,
+		)
+	}
+
+	var decrypt = func(key string, path string) string {
+		contents, err := fs.ReadFile(path)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(bicrypto.IsEncrypted(contents)).To(Equal(key != ""))
+
+		decrypted, err := bicrypto.NewEncryptor([]byte(key)).Decrypt(contents)
+		Expect(err).ToNot(HaveOccurred())
+		return string(decrypted)
+	}
+
+	BeforeEach(func() {
+		fs = fakesys.NewFakeFileSystem()
+		logger = boshlog.NewLogger(boshlog.LevelNone)
+		fakeUUIDGenerator = fakeuuid.NewFakeGenerator()
+		fakeUI = &fakebiui.FakeUI{}
+		fakeStage = fakebiui.NewFakeStage()
+
+		fs.WriteFileString(deploymentManifestPath, "---\nname: fake-deployment\n")
+		fs.WriteFileString("/fake-new-key", "fake-new-key\n")
+
+		encryptor := bicrypto.NewEncryptor([]byte("fake-key"))
+		encryptedConfig, err := encryptor.Encrypt([]byte(`{"director_id":"fake-director-id","installation_id":"fake-installation-id"}`))
+		Expect(err).ToNot(HaveOccurred())
+		fs.WriteFile(deploymentConfigPath, encryptedConfig)
+
+		encryptedVariables, err := encryptor.Encrypt([]byte("password: fake-password\n"))
+		Expect(err).ToNot(HaveOccurred())
+		fs.WriteFile(varsStorePath, encryptedVariables)
+
+		encryptedBlob, err := encryptor.Encrypt([]byte("fake-rendered-template-contents"))
+		Expect(err).ToNot(HaveOccurred())
+		fs.WriteFile(blobPath, encryptedBlob)
+		fs.WriteFileString(packageBlobPath, "fake-package-contents")
+		fs.SetGlob("/fake-workspace/installations/fake-installation-id/blobs/*", []string{blobPath, packageBlobPath})
+	})
+
+	It("encrypts the deployment state, vars store and rendered templates with the new key", func() {
+		err := newStateCmd("fake-key").Run(fakeStage, []string{"rekey", "--new-key-file", "/fake-new-key", deploymentManifestPath})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(decrypt("fake-new-key", deploymentConfigPath)).To(ContainSubstring(`"director_id": "fake-director-id"`))
+		Expect(decrypt("fake-new-key", varsStorePath)).To(ContainSubstring("fake-password"))
+		Expect(decrypt("fake-new-key", blobPath)).To(Equal("fake-rendered-template-contents"))
+		Expect(fs.ReadFileString(packageBlobPath)).To(Equal("fake-package-contents"))
+
+		Expect(fakeStage.PerformCalls).To(Equal([]fakebiui.PerformCall{
+			{Name: "Rekeying deployment state"},
+			{Name: "Rekeying vars store"},
+			{Name: "Rekeying rendered CPI job templates"},
+		}))
+		Expect(fakeUI.Said).To(ContainElement("Deployment state encrypted with the new key"))
+		Expect(fs.FileExists(deploymentConfigPath + ".lock")).To(BeFalse())
+	})
+
+	It("encrypts the backups of the deployment state with the new key, including backups written unencrypted", func() {
+		backupPath := deploymentConfigPath + ".20150101T000000Z"
+		fs.WriteFileString(backupPath, `{"director_id":"fake-director-id"}`)
+		fs.SetGlob(deploymentConfigPath+".[0-9]*Z", []string{backupPath})
+
+		err := newStateCmd("fake-key").Run(fakeStage, []string{"rekey", "--new-key-file", "/fake-new-key", deploymentManifestPath})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(decrypt("fake-new-key", backupPath)).To(Equal(`{"director_id":"fake-director-id"}`))
+	})
+
+	It("decrypts the deployment state, vars store and rendered templates", func() {
+		err := newStateCmd("fake-key").Run(fakeStage, []string{"rekey", "--decrypt", deploymentManifestPath})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(decrypt("", deploymentConfigPath)).To(ContainSubstring(`"director_id": "fake-director-id"`))
+		Expect(decrypt("", varsStorePath)).To(ContainSubstring("fake-password"))
+		Expect(decrypt("", blobPath)).To(Equal("fake-rendered-template-contents"))
+		Expect(fakeUI.Said).To(ContainElement("Deployment state decrypted"))
+	})
+
+	It("finishes rekeying when it is run again after a failure", func() {
+		failingFile := fakesys.NewFakeFile(varsStorePath+".tmp", fs)
+		failingFile.WriteErr = errors.New("fake-write-error")
+		fs.RegisterOpenFile(varsStorePath+".tmp", failingFile)
+
+		err := newStateCmd("fake-key").Run(fakeStage, []string{"rekey", "--new-key-file", "/fake-new-key", deploymentManifestPath})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("fake-write-error"))
+
+		fs.RegisterOpenFile(varsStorePath+".tmp", nil)
+		fs.SetGlob("/fake-workspace/installations/fake-installation-id/blobs/*", []string{blobPath, packageBlobPath})
+
+		err = newStateCmd("fake-key").Run(fakebiui.NewFakeStage(), []string{"rekey", "--new-key-file", "/fake-new-key", deploymentManifestPath})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(decrypt("fake-new-key", deploymentConfigPath)).To(ContainSubstring("fake-director-id"))
+		Expect(decrypt("fake-new-key", varsStorePath)).To(ContainSubstring("fake-password"))
+	})
+
+	It("returns an error when the current key is missing", func() {
+		err := newStateCmd("").Run(fakeStage, []string{"rekey", "--new-key-file", "/fake-new-key", deploymentManifestPath})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("set BOSH_INIT_STATE_KEY or BOSH_INIT_STATE_KEY_FILE"))
+
+		Expect(decrypt("fake-key", deploymentConfigPath)).To(ContainSubstring("fake-director-id"))
+	})
+
+	It("returns an error when the current key is wrong", func() {
+		err := newStateCmd("fake-wrong-key").Run(fakeStage, []string{"rekey", "--new-key-file", "/fake-new-key", deploymentManifestPath})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("set BOSH_INIT_STATE_KEY or BOSH_INIT_STATE_KEY_FILE to the key the contents were encrypted with"))
+	})
+
+	It("returns an error when the deployment state does not exist", func() {
+		fs.RemoveAll(deploymentConfigPath)
+
+		err := newStateCmd("fake-key").Run(fakeStage, []string{"rekey", "--decrypt", deploymentManifestPath})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("Deployment state does not exist at '/deployment-dir/deployment.json'"))
+	})
+
+	It("returns an error when neither or both of --new-key-file and --decrypt are given", func() {
+		err := newStateCmd("fake-key").Run(fakeStage, []string{"rekey", deploymentManifestPath})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("requires exactly one of '--new-key-file' and '--decrypt'"))
+
+		err = newStateCmd("fake-key").Run(fakeStage, []string{"rekey", "--decrypt", "--new-key-file=/fake-new-key", deploymentManifestPath})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("requires exactly one of '--new-key-file' and '--decrypt'"))
+	})
+
+	It("returns an error without the rekey subcommand", func() {
+		err := newStateCmd("fake-key").Run(fakeStage, []string{"--decrypt", deploymentManifestPath})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("requires the 'rekey' subcommand"))
+	})
+})
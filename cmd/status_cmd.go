@@ -0,0 +1,305 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	bosherr "github.com/cloudfoundry/bosh-agent/errors"
+	boshlog "github.com/cloudfoundry/bosh-agent/logger"
+	boshsys "github.com/cloudfoundry/bosh-agent/system"
+
+	bicloud "github.com/cloudfoundry/bosh-init/cloud"
+	biconfig "github.com/cloudfoundry/bosh-init/config"
+	bidepl "github.com/cloudfoundry/bosh-init/deployment"
+	bideplmanifest "github.com/cloudfoundry/bosh-init/deployment/manifest"
+	bivm "github.com/cloudfoundry/bosh-init/deployment/vm"
+	biinstall "github.com/cloudfoundry/bosh-init/installation"
+	biinstallmanifest "github.com/cloudfoundry/bosh-init/installation/manifest"
+	bimanifest "github.com/cloudfoundry/bosh-init/manifest"
+	biui "github.com/cloudfoundry/bosh-init/ui"
+)
+
+type statusCmd struct {
+	ui                      biui.UI
+	userConfig              biconfig.UserConfig
+	fs                      boshsys.FileSystem
+	manifestResolver        bimanifest.Resolver
+	installationParser      biinstallmanifest.Parser
+	deploymentParser        bideplmanifest.Parser
+	deploymentConfigService biconfig.DeploymentConfigService
+	installationFinder      biinstall.Finder
+	cloudFactory            bicloud.Factory
+	vmManagerFactory        bivm.ManagerFactory
+	statusReporter          bidepl.StatusReporter
+	logger                  boshlog.Logger
+	logTag                  string
+}
+
+func NewStatusCmd(
+	ui biui.UI,
+	userConfig biconfig.UserConfig,
+	fs boshsys.FileSystem,
+	manifestResolver bimanifest.Resolver,
+	installationParser biinstallmanifest.Parser,
+	deploymentParser bideplmanifest.Parser,
+	deploymentConfigService biconfig.DeploymentConfigService,
+	installationFinder biinstall.Finder,
+	cloudFactory bicloud.Factory,
+	vmManagerFactory bivm.ManagerFactory,
+	statusReporter bidepl.StatusReporter,
+	logger boshlog.Logger,
+) Cmd {
+	return &statusCmd{
+		ui:                      ui,
+		userConfig:              userConfig,
+		fs:                      fs,
+		manifestResolver:        manifestResolver,
+		installationParser:      installationParser,
+		deploymentParser:        deploymentParser,
+		deploymentConfigService: deploymentConfigService,
+		installationFinder:      installationFinder,
+		cloudFactory:            cloudFactory,
+		vmManagerFactory:        vmManagerFactory,
+		statusReporter:          statusReporter,
+		logger:                  logger,
+		logTag:                  "statusCmd",
+	}
+}
+
+func (c *statusCmd) Name() string {
+	return "status"
+}
+
+func (c *statusCmd) Meta() Meta {
+	return Meta{
+		Synopsis: "Show the status of an existing deployment",
+		Usage:    manifestFlagsUsage + " <deployment_manifest_path>",
+		Env:      genericEnv,
+	}
+}
+
+func (c *statusCmd) Run(stage biui.Stage, args []string) error {
+	deploymentManifestPath, flags, err := c.parseCmdInputs(args)
+	if err != nil {
+		return err
+	}
+
+	manifestAbsFilePath, err := filepath.Abs(deploymentManifestPath)
+	if err != nil {
+		c.ui.ErrorLinef("Failed getting absolute path to deployment file '%s'", deploymentManifestPath)
+		return bosherr.WrapErrorf(err, "Getting absolute path to deployment file '%s'", deploymentManifestPath)
+	}
+
+	if !c.fs.FileExists(manifestAbsFilePath) {
+		c.ui.ErrorLinef("Deployment '%s' does not exist", manifestAbsFilePath)
+		return bosherr.Errorf("Deployment manifest does not exist at '%s'", manifestAbsFilePath)
+	}
+
+	c.userConfig.DeploymentManifestPath = manifestAbsFilePath
+	c.ui.PrintLinef("Deployment manifest: '%s'", manifestAbsFilePath)
+
+	deploymentConfigPath := flags.deploymentConfigPathFor(c.userConfig)
+	c.deploymentConfigService.SetConfigPath(deploymentConfigPath)
+	deploymentConfigPath = biconfig.RedactDeploymentConfigPath(deploymentConfigPath)
+
+	c.ui.PrintLinef("Deployment state: '%s'", deploymentConfigPath)
+
+	if !c.deploymentConfigService.Exists() {
+		c.ui.PrintLinef("No deployment config file found.")
+		return nil
+	}
+
+	deploymentConfig, err := c.deploymentConfigService.Load()
+	if err != nil {
+		return bosherr.WrapError(err, "Loading deployment config")
+	}
+
+	var installationManifest biinstallmanifest.Manifest
+	var deploymentManifest bideplmanifest.Manifest
+	err = stage.Perform("Parsing installation manifest", func() error {
+		resolvedManifest, err := c.manifestResolver.Resolve(deploymentManifestPath, flags.opsFilePaths, flags.readOnlyVariablesSourcesFor(c.userConfig))
+		if err != nil {
+			return bosherr.WrapErrorf(err, "Resolving variables in deployment manifest '%s'", deploymentManifestPath)
+		}
+		defer func() {
+			deleteErr := resolvedManifest.Delete()
+			if deleteErr != nil {
+				c.logger.Warn(c.logTag, "Failed to delete interpolated deployment manifest: %s", deleteErr.Error())
+			}
+		}()
+
+		installationManifest, err = c.installationParser.Parse(resolvedManifest.Path)
+		if err != nil {
+			return bosherr.WrapErrorf(err, "Parsing installation manifest '%s'", deploymentManifestPath)
+		}
+
+		// names the vms of a deployment file recorded before multiple instances were supported
+		deploymentManifest, err = c.deploymentParser.Parse(resolvedManifest.Path)
+		if err != nil {
+			return bosherr.WrapErrorf(err, "Parsing deployment manifest '%s'", deploymentManifestPath)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	installation, found, err := c.installationFinder.Find(installationManifest, stage)
+	if err != nil {
+		return bosherr.WrapError(err, "Finding installed CPI")
+	}
+	if !found {
+		c.ui.ErrorLinef("No installed CPI found. The deployment must be deployed before its status can be shown.")
+		return bosherr.Error("Finding installed CPI: CPI is not installed")
+	}
+	defer func() {
+		err := installation.Cleanup()
+		if err != nil {
+			c.logger.Warn(c.logTag, "Failed to clean up CPI installation: %s", err.Error())
+		}
+	}()
+
+	c.logger.Debug(c.logTag, "Creating cloud client...")
+	cloud, err := c.cloudFactory.NewCloud(installation, deploymentConfig.DirectorID)
+	if err != nil {
+		return bosherr.WrapError(err, "Creating CPI client from CPI installation")
+	}
+
+	vmManager := c.vmManagerFactory.NewManager(cloud, deploymentConfig.DirectorID, installationManifest.Mbus, installationManifest.Cert)
+
+	var status bidepl.Status
+	err = stage.Perform("Checking deployment status", func() error {
+		status, err = c.statusReporter.Report(vmManager, cloud, deploymentManifest)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	c.printStatus(status)
+
+	return nil
+}
+
+func (c *statusCmd) parseCmdInputs(args []string) (string, manifestFlags, error) {
+	args, flags, err := parseManifestFlags(args)
+	if err != nil {
+		c.ui.ErrorLinef("%s", err.Error())
+		c.logger.Error(c.logTag, "Invalid arguments: %#v", args)
+		return "", manifestFlags{}, err
+	}
+
+	if len(args) != 1 {
+		c.ui.ErrorLinef("Invalid usage - status command requires exactly 1 argument")
+		c.ui.PrintLinef("Expected usage: bosh-init status %s <deployment-manifest>", manifestFlagsUsage)
+		c.logger.Error(c.logTag, "Invalid arguments: %#v", args)
+		return "", manifestFlags{}, errors.New("Invalid usage - status command requires exactly 1 argument")
+	}
+	return args[0], flags, nil
+}
+
+func (c *statusCmd) printStatus(status bidepl.Status) {
+	buffer := bytes.NewBuffer([]byte{})
+	writer := tabwriter.NewWriter(buffer, 0, 8, 2, ' ', 0)
+
+	fmt.Fprintln(writer, "Instance\tVM CID\tIPs\tCreated\tVM\tAgent\tJob State\tAttached Disks")
+	for _, vmStatus := range status.VMs {
+		fmt.Fprintf(
+			writer,
+			"%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			vmStatus.Instance,
+			vmStatus.CID,
+			c.formatList(vmStatus.IPs),
+			c.formatCreatedAt(vmStatus.CreatedAt),
+			c.formatBool(vmStatus.Exists, "exists", "missing"),
+			c.formatBool(vmStatus.AgentReachable, "reachable", "unreachable"),
+			vmStatus.JobState,
+			c.formatList(vmStatus.AttachedDisks),
+		)
+	}
+	writer.Flush()
+
+	c.ui.PrintLinef("")
+	for _, line := range strings.Split(strings.TrimRight(buffer.String(), "\n"), "\n") {
+		c.ui.PrintLinef("%s", line)
+	}
+	if len(status.VMs) == 0 {
+		c.ui.PrintLinef("No VMs deployed")
+	}
+	for _, vmStatus := range status.VMs {
+		if vmStatus.AgentReachable && vmStatus.CloudDisks != nil && !sameElements(vmStatus.CloudDisks, vmStatus.AttachedDisks) {
+			c.ui.PrintLinef("%s: disks attached by the CPI (%s) differ from disks mounted by the agent (%s)",
+				vmStatus.Instance, c.formatList(vmStatus.CloudDisks), c.formatList(vmStatus.AttachedDisks))
+		}
+	}
+
+	c.ui.PrintLinef("")
+	c.ui.PrintLinef("Persistent disks: %s", c.formatList(status.DiskCIDs))
+	if len(status.MissingDiskCIDs) > 0 {
+		c.ui.PrintLinef("Missing persistent disks: %s", c.formatList(status.MissingDiskCIDs))
+	}
+	c.ui.PrintLinef("Stemcell: %s", c.formatString(status.Stemcell))
+	c.ui.PrintLinef("Releases: %s", c.formatList(status.Releases))
+	c.ui.PrintLinef("CPI API version: %s", c.formatAPIVersion(status.CPIInfo.APIVersion))
+	c.ui.PrintLinef("CPI stemcell formats: %s", c.formatList(status.CPIInfo.StemcellFormats))
+}
+
+func (c *statusCmd) formatBool(value bool, trueString, falseString string) string {
+	if value {
+		return trueString
+	}
+	return falseString
+}
+
+// formatAPIVersion returns unknown for CPIs that do not report their API version
+func (c *statusCmd) formatAPIVersion(apiVersion int) string {
+	if apiVersion == 0 {
+		return "unknown"
+	}
+	return strconv.Itoa(apiVersion)
+}
+
+// formatCreatedAt returns unknown for vms recorded before their creation time was
+func (c *statusCmd) formatCreatedAt(createdAt string) string {
+	if createdAt == "" {
+		return "unknown"
+	}
+	return createdAt
+}
+
+func (c *statusCmd) formatString(value string) string {
+	if value == "" {
+		return "none"
+	}
+	return value
+}
+
+func (c *statusCmd) formatList(values []string) string {
+	if len(values) == 0 {
+		return "none"
+	}
+	return strings.Join(values, ", ")
+}
+
+func sameElements(values, otherValues []string) bool {
+	if len(values) != len(otherValues) {
+		return false
+	}
+
+	counts := map[string]int{}
+	for _, value := range values {
+		counts[value]++
+	}
+	for _, value := range otherValues {
+		counts[value]--
+		if counts[value] < 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,54 @@
+package file
+
+import (
+	"os"
+	"path/filepath"
+
+	boshsys "github.com/cloudfoundry/bosh-agent/system"
+)
+
+// WriteWithMode writes the file with the permissions, creating its directory, for files whose contents must not be
+// readable by others, e.g. the deployment state and the CPI cassette.
+// A new file is created with the permissions, and an existing file has them set before it is written, so that the contents
+// are never readable with other permissions; they are set again after the file is written, as the umask may have removed some.
+// The file is flushed to disk when the file system supports it.
+func WriteWithMode(fs boshsys.FileSystem, path string, contents []byte, mode os.FileMode) error {
+	err := fs.MkdirAll(filepath.Dir(path), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	file, err := fs.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+
+	err = fs.Chmod(path, mode)
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	_, err = file.Write(contents)
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	if syncer, ok := file.(interface {
+		Sync() error
+	}); ok {
+		err = syncer.Sync()
+		if err != nil {
+			file.Close()
+			return err
+		}
+	}
+
+	err = file.Close()
+	if err != nil {
+		return err
+	}
+
+	return fs.Chmod(path, mode)
+}
@@ -0,0 +1,78 @@
+package file_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	boshlog "github.com/cloudfoundry/bosh-agent/logger"
+	boshsys "github.com/cloudfoundry/bosh-agent/system"
+	fakesys "github.com/cloudfoundry/bosh-agent/system/fakes"
+
+	. "github.com/cloudfoundry/bosh-init/common/file"
+)
+
+var _ = Describe("WriteWithMode", func() {
+	var (
+		fs     boshsys.FileSystem
+		tmpDir string
+	)
+
+	BeforeEach(func() {
+		fs = boshsys.NewOsFileSystem(boshlog.NewLogger(boshlog.LevelNone))
+
+		var err error
+		tmpDir, err = fs.TempDir("write-with-mode")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		fs.RemoveAll(tmpDir)
+	})
+
+	It("writes a new file with the permissions, creating its directory", func() {
+		path := filepath.Join(tmpDir, "some-dir", "file")
+
+		err := WriteWithMode(fs, path, []byte("fake-contents"), 0600)
+		Expect(err).ToNot(HaveOccurred())
+
+		contents, err := fs.ReadFileString(path)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(contents).To(Equal("fake-contents"))
+
+		fileInfo, err := os.Stat(path)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fileInfo.Mode().Perm()).To(Equal(os.FileMode(0600)))
+	})
+
+	It("overwrites an existing file and sets the permissions", func() {
+		path := filepath.Join(tmpDir, "file")
+		err := fs.WriteFileString(path, "fake-old-contents")
+		Expect(err).ToNot(HaveOccurred())
+		err = os.Chmod(path, 0644)
+		Expect(err).ToNot(HaveOccurred())
+
+		err = WriteWithMode(fs, path, []byte("fake-contents"), 0600)
+		Expect(err).ToNot(HaveOccurred())
+
+		contents, err := fs.ReadFileString(path)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(contents).To(Equal("fake-contents"))
+
+		fileInfo, err := os.Stat(path)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fileInfo.Mode().Perm()).To(Equal(os.FileMode(0600)))
+	})
+
+	It("returns an error when the file cannot be opened", func() {
+		fakeFs := fakesys.NewFakeFileSystem()
+		fakeFs.OpenFileErr = errors.New("fake-open-file-error")
+
+		err := WriteWithMode(fakeFs, "/some/file", []byte("fake-contents"), 0600)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("fake-open-file-error"))
+	})
+})
@@ -0,0 +1,126 @@
+package config
+
+import (
+	"net/url"
+
+	boshhttp "github.com/cloudfoundry/bosh-agent/http"
+	boshlog "github.com/cloudfoundry/bosh-agent/logger"
+	boshsys "github.com/cloudfoundry/bosh-agent/system"
+	boshtime "github.com/cloudfoundry/bosh-agent/time"
+	boshuuid "github.com/cloudfoundry/bosh-agent/uuid"
+
+	bicrypto "github.com/cloudfoundry/bosh-init/crypto"
+)
+
+type deploymentConfigService struct {
+	fileService   DeploymentConfigService
+	httpClient    boshhttp.Client
+	uuidGenerator boshuuid.Generator
+	encryptor     bicrypto.Encryptor
+	logger        boshlog.Logger
+	logTag        string
+
+	backend DeploymentConfigService
+}
+
+// NewDeploymentConfigService returns a service that stores the deployment config in the backend selected by SetConfigPath:
+//   - a local file path or 'file://' URL (see NewFileSystemDeploymentConfigService)
+//   - a 'http://' or 'https://' URL (see NewHTTPStateClient)
+//   - a 'dav://' or 'davs://' URL (see NewDavStateClient)
+//
+// Credentials for remote backends are given in the URL user info.
+// All backends store the deployment config encrypted with the encryptor key, if it has one.
+func NewDeploymentConfigService(
+	fs boshsys.FileSystem,
+	uuidGenerator boshuuid.Generator,
+	timeService boshtime.Service,
+	encryptor bicrypto.Encryptor,
+	httpClient boshhttp.Client,
+	logger boshlog.Logger,
+) DeploymentConfigService {
+	return &deploymentConfigService{
+		fileService:   NewFileSystemDeploymentConfigService(fs, uuidGenerator, timeService, encryptor, logger),
+		httpClient:    httpClient,
+		uuidGenerator: uuidGenerator,
+		encryptor:     encryptor,
+		logger:        logger,
+		logTag:        "deploymentConfigService",
+	}
+}
+
+func (s *deploymentConfigService) SetConfigPath(path string) {
+	stateURL, err := url.Parse(path)
+	if err != nil {
+		stateURL = &url.URL{Path: path}
+	}
+
+	switch stateURL.Scheme {
+	case "http", "https":
+		s.logger.Debug(s.logTag, "Using HTTP deployment config '%s'", urlWithoutCredentials(stateURL))
+		s.backend = NewRemoteDeploymentConfigService(NewHTTPStateClient(stateURL, s.httpClient, s.logger), s.uuidGenerator, s.encryptor, s.logger)
+	case "dav", "davs":
+		s.logger.Debug(s.logTag, "Using WebDAV deployment config '%s'", urlWithoutCredentials(stateURL))
+		s.backend = NewRemoteDeploymentConfigService(NewDavStateClient(stateURL, s.httpClient), s.uuidGenerator, s.encryptor, s.logger)
+	case "file":
+		s.fileService.SetConfigPath(stateURL.Path)
+		s.backend = s.fileService
+	default:
+		// a local path, which may look like a URL with a one letter scheme on windows (e.g. 'C:\')
+		s.fileService.SetConfigPath(path)
+		s.backend = s.fileService
+	}
+}
+
+func (s *deploymentConfigService) Exists() bool {
+	return s.currentBackend().Exists()
+}
+
+func (s *deploymentConfigService) Load() (DeploymentFile, error) {
+	return s.currentBackend().Load()
+}
+
+func (s *deploymentConfigService) Save(deploymentFile DeploymentFile) error {
+	return s.currentBackend().Save(deploymentFile)
+}
+
+func (s *deploymentConfigService) SetReadOnly() {
+	s.currentBackend().SetReadOnly()
+}
+
+func (s *deploymentConfigService) Lock() error {
+	return s.currentBackend().Lock()
+}
+
+// Unlock does nothing before the config path is set, because nothing can be locked yet
+func (s *deploymentConfigService) Unlock() error {
+	if s.backend == nil {
+		return nil
+	}
+	return s.currentBackend().Unlock()
+}
+
+func (s *deploymentConfigService) RekeyBackups() error {
+	return s.currentBackend().RekeyBackups()
+}
+
+func (s *deploymentConfigService) currentBackend() DeploymentConfigService {
+	if s.backend == nil {
+		panic("configPath not yet set!")
+	}
+	return s.backend
+}
+
+// RedactDeploymentConfigPath returns the deployment config path or URL without the credentials of remote backends, so that it can be printed
+func RedactDeploymentConfigPath(path string) string {
+	stateURL, err := url.Parse(path)
+	if err != nil || stateURL.User == nil {
+		return path
+	}
+
+	switch stateURL.Scheme {
+	case "http", "https", "dav", "davs":
+		return urlWithoutCredentials(stateURL)
+	default:
+		return path
+	}
+}
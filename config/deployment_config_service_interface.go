@@ -1,20 +1,56 @@
 package config
 
 import (
+	bosherr "github.com/cloudfoundry/bosh-agent/errors"
+	boshuuid "github.com/cloudfoundry/bosh-agent/uuid"
+
 	biproperty "github.com/cloudfoundry/bosh-init/common/property"
 )
 
 type DeploymentFile struct {
-	DirectorID          string           `json:"director_id"`
-	InstallationID      string           `json:"installation_id"`
-	CurrentVMCID        string           `json:"current_vm_cid"`
-	CurrentStemcellID   string           `json:"current_stemcell_id"`
-	CurrentDiskID       string           `json:"current_disk_id"`
-	CurrentReleaseIDs   []string         `json:"current_release_ids"`
-	CurrentManifestSHA1 string           `json:"current_manifest_sha1"`
-	Disks               []DiskRecord     `json:"disks"`
-	Stemcells           []StemcellRecord `json:"stemcells"`
-	Releases            []ReleaseRecord  `json:"releases"`
+	// SchemaVersion is the DeploymentFileSchemaVersion the file was written with, 0 for files written before it was introduced
+	SchemaVersion               int               `json:"schema_version"`
+	DirectorID                  string            `json:"director_id"`
+	InstallationID              string            `json:"installation_id"`
+	CurrentVMs                  []VMRecord        `json:"current_vms"`
+	CurrentStemcellID           string            `json:"current_stemcell_id"`
+	CurrentDiskIDs              []string          `json:"current_disk_ids"`
+	CurrentReleaseIDs           []string          `json:"current_release_ids"`
+	CurrentManifestSHA1         string            `json:"current_manifest_sha1"`
+	CurrentManifestFingerprints map[string]string `json:"current_manifest_fingerprints"`
+	Disks                       []DiskRecord      `json:"disks"`
+	Stemcells                   []StemcellRecord  `json:"stemcells"`
+	Releases                    []ReleaseRecord   `json:"releases"`
+
+	// CurrentManifestFingerprintSalt keys the HMACs of CurrentManifestFingerprints, which are not used without it
+	CurrentManifestFingerprintSalt string `json:"current_manifest_fingerprint_salt"`
+
+	// CurrentVMCID and CurrentDiskID are only read from files written before
+	// multiple instances were supported; they are converted by the schema version 1 migration.
+	CurrentVMCID  string `json:"current_vm_cid,omitempty"`
+	CurrentDiskID string `json:"current_disk_id,omitempty"`
+}
+
+type VMRecord struct {
+	CID     string `json:"cid"`
+	JobName string `json:"job_name"`
+	Index   int    `json:"index"`
+
+	// AgentHost is empty when the agent is reachable at the mbus URL host
+	AgentHost string `json:"agent_host,omitempty"`
+
+	// AgentID addresses the agent when the mbus URL is a NATS URL
+	AgentID string `json:"agent_id,omitempty"`
+
+	// StemcellID is the ID of the record of the stemcell the vm was created from
+	StemcellID string `json:"stemcell_id,omitempty"`
+
+	// IPs are the static and vip IPs of the vm, in the order of the networks of its job;
+	// IPs assigned by dynamic networks are not known when the vm is created
+	IPs []string `json:"ips,omitempty"`
+
+	// CreatedAt is the time the vm was created, in RFC 3339 format
+	CreatedAt string `json:"created_at,omitempty"`
 }
 
 type StemcellRecord struct {
@@ -29,6 +65,8 @@ type DiskRecord struct {
 	CID             string         `json:"cid"`
 	Size            int            `json:"size"`
 	CloudProperties biproperty.Map `json:"cloud_properties"`
+	JobName         string         `json:"job_name"`
+	Index           int            `json:"index"`
 }
 
 type ReleaseRecord struct {
@@ -42,4 +80,35 @@ type DeploymentConfigService interface {
 	Exists() bool
 	Load() (DeploymentFile, error)
 	Save(DeploymentFile) error
+
+	// SetReadOnly makes Save fail, and Load return the defaults of a deployment config that does not exist yet without saving them,
+	// for commands that must not change the deployment, e.g. 'deploy --dry-run'. It is called after SetConfigPath.
+	SetReadOnly()
+
+	// Lock creates the '<path>.lock' file, failing if another process holds it.
+	// The lock is held until Unlock, for the whole run of a command that changes the deployment.
+	Lock() error
+	Unlock() error
+
+	// RekeyBackups writes the backups of the deployment config again with the current key of the encryptor,
+	// or decrypted when it has none, including the backups written unencrypted before a key was set
+	RekeyBackups() error
+}
+
+// initDefaults generates the DirectorID of a new deployment config, and saves it
+func initDefaults(deploymentFile *DeploymentFile, uuidGenerator boshuuid.Generator, save func(DeploymentFile) error) error {
+	if deploymentFile.DirectorID == "" {
+		uuid, err := uuidGenerator.Generate()
+		if err != nil {
+			return bosherr.WrapError(err, "Generating DirectorID")
+		}
+		deploymentFile.DirectorID = uuid
+
+		err = save(*deploymentFile)
+		if err != nil {
+			return bosherr.WrapError(err, "Saving deployment config")
+		}
+	}
+
+	return nil
 }
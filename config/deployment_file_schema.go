@@ -0,0 +1,119 @@
+package config
+
+import (
+	"encoding/json"
+
+	bosherr "github.com/cloudfoundry/bosh-agent/errors"
+)
+
+// DeploymentFileSchemaVersion is the schema version of the deployment files written by this version of bosh-init.
+// Increment it when the shape of DeploymentFile changes, and add a migration from the previous version.
+const DeploymentFileSchemaVersion = 2
+
+// deploymentFileMigration upgrades a deployment file from the previous schema version to its version
+type deploymentFileMigration struct {
+	version     int
+	description string
+	migrate     func(*DeploymentFile) error
+}
+
+// deploymentFileMigrations are applied in order to the files with an older schema version.
+// Files written before the schema version was introduced have version 0.
+var deploymentFileMigrations = []deploymentFileMigration{
+	{
+		version:     1,
+		description: "convert the current VM and disk into per instance records",
+		migrate:     convertSingleInstanceRecords,
+	},
+	{
+		version:     2,
+		description: "record the stemcell of the current VMs",
+		migrate:     recordVMStemcells,
+	},
+}
+
+type deploymentFileVersion struct {
+	SchemaVersion int `json:"schema_version"`
+}
+
+// unmarshalDeploymentFile returns the deployment file upgraded to the current schema version,
+// and the schema version it was written with.
+// Files with a newer schema version are refused, as the fields unknown to this version of bosh-init would be lost on save.
+// The description names the file in errors, e.g. "deployment config file '/path/to/deployment.json'".
+func unmarshalDeploymentFile(contents []byte, description string) (DeploymentFile, int, error) {
+	version := deploymentFileVersion{}
+	err := json.Unmarshal(contents, &version)
+	if err != nil {
+		return DeploymentFile{}, 0, bosherr.WrapErrorf(err, "Unmarshalling %s", description)
+	}
+
+	if version.SchemaVersion > DeploymentFileSchemaVersion {
+		return DeploymentFile{}, 0, bosherr.Errorf(
+			"The %s has schema version %d, but this version of bosh-init only supports up to schema version %d: upgrade bosh-init to use this deployment",
+			description,
+			version.SchemaVersion,
+			DeploymentFileSchemaVersion,
+		)
+	}
+
+	deploymentFile := DeploymentFile{}
+	err = json.Unmarshal(contents, &deploymentFile)
+	if err != nil {
+		return DeploymentFile{}, 0, bosherr.WrapErrorf(err, "Unmarshalling %s", description)
+	}
+
+	err = migrateDeploymentFile(&deploymentFile)
+	if err != nil {
+		return DeploymentFile{}, 0, bosherr.WrapErrorf(err, "Migrating %s", description)
+	}
+
+	return deploymentFile, version.SchemaVersion, nil
+}
+
+// migrateDeploymentFile applies the migrations newer than the schema version of the deployment file
+func migrateDeploymentFile(deploymentFile *DeploymentFile) error {
+	for _, migration := range deploymentFileMigrations {
+		if migration.version <= deploymentFile.SchemaVersion {
+			continue
+		}
+
+		err := migration.migrate(deploymentFile)
+		if err != nil {
+			return bosherr.WrapErrorf(err, "Migrating to schema version %d (%s)", migration.version, migration.description)
+		}
+		deploymentFile.SchemaVersion = migration.version
+	}
+
+	return nil
+}
+
+// convertSingleInstanceRecords moves the current vm & disk of a file written
+// before multiple instances were supported into the per-instance records.
+// These files do not record the job name, so it is left empty: such a deployment had a single instance,
+// which deploy treats as the first instance of the first job of the manifest.
+func convertSingleInstanceRecords(deploymentFile *DeploymentFile) error {
+	if deploymentFile.CurrentVMCID != "" {
+		deploymentFile.CurrentVMs = append(deploymentFile.CurrentVMs, VMRecord{CID: deploymentFile.CurrentVMCID})
+		deploymentFile.CurrentVMCID = ""
+	}
+
+	if deploymentFile.CurrentDiskID != "" {
+		deploymentFile.CurrentDiskIDs = append(deploymentFile.CurrentDiskIDs, deploymentFile.CurrentDiskID)
+		deploymentFile.CurrentDiskID = ""
+	}
+
+	return nil
+}
+
+// recordVMStemcells records the current stemcell as the stemcell of the current vms,
+// which were all created from it, as deploy replaces every vm when the stemcell changes.
+// The IPs and creation time of these vms were not recorded, and are left empty.
+func recordVMStemcells(deploymentFile *DeploymentFile) error {
+	for i := range deploymentFile.CurrentVMs {
+		if deploymentFile.CurrentVMs[i].StemcellID == "" {
+			deploymentFile.CurrentVMs[i].StemcellID = deploymentFile.CurrentStemcellID
+		}
+	}
+
+	return nil
+}
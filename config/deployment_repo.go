@@ -7,6 +7,8 @@ import (
 type DeploymentRepo interface {
 	UpdateCurrent(manifestSHA1 string) error
 	FindCurrent() (manifestSHA1 string, found bool, err error)
+	UpdateCurrentFingerprints(fingerprints map[string]string, salt string) error
+	FindCurrentFingerprints() (fingerprints map[string]string, salt string, found bool, err error)
 }
 
 type deploymentRepo struct {
@@ -47,3 +49,35 @@ func (r deploymentRepo) UpdateCurrent(manifestSHA1 string) error {
 	}
 	return nil
 }
+
+// FindCurrentFingerprints does not find fingerprints without a salt, which were written by older versions
+func (r deploymentRepo) FindCurrentFingerprints() (map[string]string, string, bool, error) {
+	config, err := r.configService.Load()
+	if err != nil {
+		return nil, "", false, bosherr.WrapError(err, "Loading existing config")
+	}
+
+	fingerprints := config.CurrentManifestFingerprints
+	salt := config.CurrentManifestFingerprintSalt
+	if len(fingerprints) > 0 && salt != "" {
+		return fingerprints, salt, true, nil
+	}
+
+	return nil, "", false, nil
+}
+
+func (r deploymentRepo) UpdateCurrentFingerprints(fingerprints map[string]string, salt string) error {
+	config, err := r.configService.Load()
+	if err != nil {
+		return bosherr.WrapError(err, "Loading existing config")
+	}
+
+	config.CurrentManifestFingerprints = fingerprints
+	config.CurrentManifestFingerprintSalt = salt
+
+	err = r.configService.Save(config)
+	if err != nil {
+		return bosherr.WrapError(err, "Saving new config")
+	}
+	return nil
+}
@@ -6,9 +6,11 @@ import (
 
 	boshlog "github.com/cloudfoundry/bosh-agent/logger"
 	fakesys "github.com/cloudfoundry/bosh-agent/system/fakes"
+	faketime "github.com/cloudfoundry/bosh-agent/time/fakes"
 	fakeuuid "github.com/cloudfoundry/bosh-agent/uuid/fakes"
 
 	. "github.com/cloudfoundry/bosh-init/config"
+	bicrypto "github.com/cloudfoundry/bosh-init/crypto"
 )
 
 var _ = Describe("DeploymentRepo", func() {
@@ -23,7 +25,7 @@ var _ = Describe("DeploymentRepo", func() {
 		logger := boshlog.NewLogger(boshlog.LevelNone)
 		fs = fakesys.NewFakeFileSystem()
 		fakeUUIDGenerator = fakeuuid.NewFakeGenerator()
-		configService = NewFileSystemDeploymentConfigService(fs, fakeUUIDGenerator, logger)
+		configService = NewFileSystemDeploymentConfigService(fs, fakeUUIDGenerator, &faketime.FakeService{}, bicrypto.NewEncryptor(nil), logger)
 		configService.SetConfigPath("/fake/path")
 		repo = NewDeploymentRepo(configService)
 	})
@@ -37,6 +39,7 @@ var _ = Describe("DeploymentRepo", func() {
 			Expect(err).ToNot(HaveOccurred())
 
 			expectedConfig := DeploymentFile{
+				SchemaVersion:       DeploymentFileSchemaVersion,
 				DirectorID:          "fake-uuid-0",
 				CurrentManifestSHA1: "fake-manifest-sha1",
 			}
@@ -67,4 +70,62 @@ var _ = Describe("DeploymentRepo", func() {
 			})
 		})
 	})
+
+	Describe("UpdateCurrentFingerprints", func() {
+		It("updates deployment manifest fingerprints and their salt", func() {
+			err := repo.UpdateCurrentFingerprints(map[string]string{"name": "fake-name-sha1"}, "fake-salt")
+			Expect(err).ToNot(HaveOccurred())
+
+			deploymentConfig, err := configService.Load()
+			Expect(err).ToNot(HaveOccurred())
+
+			expectedConfig := DeploymentFile{
+				SchemaVersion: DeploymentFileSchemaVersion,
+				DirectorID:    "fake-uuid-0",
+				CurrentManifestFingerprints: map[string]string{
+					"name": "fake-name-sha1",
+				},
+				CurrentManifestFingerprintSalt: "fake-salt",
+			}
+			Expect(deploymentConfig).To(Equal(expectedConfig))
+		})
+	})
+
+	Describe("FindCurrentFingerprints", func() {
+		Context("when current manifest fingerprints are set", func() {
+			BeforeEach(func() {
+				err := repo.UpdateCurrentFingerprints(map[string]string{"name": "fake-name-sha1"}, "fake-salt")
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			It("returns current manifest fingerprints and their salt", func() {
+				fingerprints, salt, found, err := repo.FindCurrentFingerprints()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(found).To(BeTrue())
+				Expect(fingerprints).To(Equal(map[string]string{"name": "fake-name-sha1"}))
+				Expect(salt).To(Equal("fake-salt"))
+			})
+		})
+
+		Context("when current manifest fingerprints were set without a salt by an older version", func() {
+			BeforeEach(func() {
+				err := repo.UpdateCurrentFingerprints(map[string]string{"name": "fake-name-sha1"}, "")
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			It("returns false", func() {
+				_, _, found, err := repo.FindCurrentFingerprints()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(found).To(BeFalse())
+			})
+		})
+
+		Context("when current manifest fingerprints are not set", func() {
+			It("returns false", func() {
+				_, _, found, err := repo.FindCurrentFingerprints()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(found).To(BeFalse())
+			})
+		})
+	})
 })
@@ -8,8 +8,9 @@ import (
 )
 
 type DiskRepo interface {
-	UpdateCurrent(diskID string) error
-	FindCurrent() (DiskRecord, bool, error)
+	UpdateCurrent(jobName string, index int, diskID string) error
+	FindCurrent() ([]DiskRecord, error)
+	FindCurrentForInstance(jobName string, index int) (DiskRecord, bool, error)
 	ClearCurrent() error
 	Save(cid string, size int, cloudProperties biproperty.Map) (DiskRecord, error)
 	Find(cid string) (DiskRecord, bool, error)
@@ -60,43 +61,70 @@ func (r diskRepo) Save(cid string, size int, cloudProperties biproperty.Map) (Di
 	return newRecord, nil
 }
 
-func (r diskRepo) FindCurrent() (DiskRecord, bool, error) {
+func (r diskRepo) FindCurrent() ([]DiskRecord, error) {
+	config, err := r.configService.Load()
+	if err != nil {
+		return []DiskRecord{}, bosherr.WrapError(err, "Loading existing config")
+	}
+
+	return r.current(config), nil
+}
+
+// FindCurrentForInstance returns the current disk of the instance.
+// A current disk without a job name was recorded before multiple instances were supported,
+// and belongs to the first instance that looks for it with the same index.
+func (r diskRepo) FindCurrentForInstance(jobName string, index int) (DiskRecord, bool, error) {
 	config, err := r.configService.Load()
 	if err != nil {
 		return DiskRecord{}, false, bosherr.WrapError(err, "Loading existing config")
 	}
 
-	currentDiskID := config.CurrentDiskID
-	if currentDiskID == "" {
-		return DiskRecord{}, false, nil
+	currentRecords := r.current(config)
+
+	for _, record := range currentRecords {
+		if record.JobName == jobName && record.Index == index {
+			return record, true, nil
+		}
 	}
 
-	for _, oldRecord := range config.Disks {
-		if oldRecord.ID == currentDiskID {
-			return oldRecord, true, nil
+	for _, record := range currentRecords {
+		if record.JobName == "" && record.Index == index {
+			return record, true, nil
 		}
 	}
 
 	return DiskRecord{}, false, nil
 }
 
-func (r diskRepo) UpdateCurrent(diskID string) error {
+// UpdateCurrent records the disk as the current disk of the instance, replacing any previous one
+func (r diskRepo) UpdateCurrent(jobName string, index int, diskID string) error {
 	config, err := r.configService.Load()
 	if err != nil {
 		return bosherr.WrapError(err, "Loading existing config")
 	}
 
 	found := false
-	for _, oldRecord := range config.Disks {
+	replacedIDs := map[string]bool{}
+	for i, oldRecord := range config.Disks {
 		if oldRecord.ID == diskID {
 			found = true
+			config.Disks[i].JobName = jobName
+			config.Disks[i].Index = index
+		} else if oldRecord.JobName == jobName && oldRecord.Index == index {
+			replacedIDs[oldRecord.ID] = true
 		}
 	}
 	if !found {
 		return bosherr.Errorf("Verifying disk record exists with id '%s'", diskID)
 	}
 
-	config.CurrentDiskID = diskID
+	currentDiskIDs := []string{}
+	for _, currentDiskID := range config.CurrentDiskIDs {
+		if currentDiskID != diskID && !replacedIDs[currentDiskID] {
+			currentDiskIDs = append(currentDiskIDs, currentDiskID)
+		}
+	}
+	config.CurrentDiskIDs = append(currentDiskIDs, diskID)
 
 	err = r.configService.Save(config)
 	if err != nil {
@@ -139,9 +167,13 @@ func (r diskRepo) Delete(diskRecord DiskRecord) error {
 
 	config.Disks = newRecords
 
-	if config.CurrentDiskID == diskRecord.ID {
-		config.CurrentDiskID = ""
+	currentDiskIDs := []string{}
+	for _, currentDiskID := range config.CurrentDiskIDs {
+		if currentDiskID != diskRecord.ID {
+			currentDiskIDs = append(currentDiskIDs, currentDiskID)
+		}
 	}
+	config.CurrentDiskIDs = currentDiskIDs
 
 	err = r.configService.Save(config)
 	if err != nil {
@@ -157,7 +189,7 @@ func (r diskRepo) ClearCurrent() error {
 		return bosherr.WrapError(err, "Loading existing config")
 	}
 
-	config.CurrentDiskID = ""
+	config.CurrentDiskIDs = []string{}
 
 	err = r.configService.Save(config)
 	if err != nil {
@@ -180,6 +212,18 @@ func (r diskRepo) load() (DeploymentFile, []DiskRecord, error) {
 	return config, records, nil
 }
 
+func (r diskRepo) current(config DeploymentFile) []DiskRecord {
+	currentRecords := []DiskRecord{}
+	for _, currentDiskID := range config.CurrentDiskIDs {
+		for _, record := range config.Disks {
+			if record.ID == currentDiskID {
+				currentRecords = append(currentRecords, record)
+			}
+		}
+	}
+	return currentRecords
+}
+
 func (r diskRepo) find(records []DiskRecord, cid string) (DiskRecord, bool) {
 	for _, existingRecord := range records {
 		if existingRecord.CID == cid {
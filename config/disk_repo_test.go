@@ -5,10 +5,12 @@ import (
 	. "github.com/onsi/gomega"
 
 	. "github.com/cloudfoundry/bosh-init/config"
+	bicrypto "github.com/cloudfoundry/bosh-init/crypto"
 
 	boshlog "github.com/cloudfoundry/bosh-agent/logger"
 
 	fakesys "github.com/cloudfoundry/bosh-agent/system/fakes"
+	faketime "github.com/cloudfoundry/bosh-agent/time/fakes"
 	fakeuuid "github.com/cloudfoundry/bosh-agent/uuid/fakes"
 
 	biproperty "github.com/cloudfoundry/bosh-init/common/property"
@@ -27,7 +29,7 @@ var _ = Describe("DiskRepo", func() {
 		logger := boshlog.NewLogger(boshlog.LevelNone)
 		fs = fakesys.NewFakeFileSystem()
 		fakeUUIDGenerator = &fakeuuid.FakeGenerator{}
-		configService = NewFileSystemDeploymentConfigService(fs, fakeUUIDGenerator, logger)
+		configService = NewFileSystemDeploymentConfigService(fs, fakeUUIDGenerator, &faketime.FakeService{}, bicrypto.NewEncryptor(nil), logger)
 		configService.SetConfigPath("/fake/path")
 		repo = NewDiskRepo(configService, fakeUUIDGenerator)
 		cloudProperties = biproperty.Map{
@@ -50,7 +52,8 @@ var _ = Describe("DiskRepo", func() {
 			Expect(err).ToNot(HaveOccurred())
 
 			expectedConfig := DeploymentFile{
-				DirectorID: "fake-uuid-0",
+				SchemaVersion: DeploymentFileSchemaVersion,
+				DirectorID:    "fake-uuid-0",
 				Disks: []DiskRecord{
 					{
 						ID:              "fake-uuid-1",
@@ -97,14 +100,36 @@ var _ = Describe("DiskRepo", func() {
 				recordID = record.ID
 			})
 
-			It("saves the disk record as current stemcell", func() {
-				err := repo.UpdateCurrent(recordID)
+			It("saves the disk record as current disk of the instance", func() {
+				err := repo.UpdateCurrent("fake-job-name", 1, recordID)
 				Expect(err).ToNot(HaveOccurred())
 
 				deploymentConfig, err := configService.Load()
 				Expect(err).ToNot(HaveOccurred())
 
-				Expect(deploymentConfig.CurrentDiskID).To(Equal(recordID))
+				Expect(deploymentConfig.CurrentDiskIDs).To(Equal([]string{recordID}))
+				Expect(deploymentConfig.Disks[0].JobName).To(Equal("fake-job-name"))
+				Expect(deploymentConfig.Disks[0].Index).To(Equal(1))
+			})
+
+			It("replaces the current disk of the same instance", func() {
+				err := repo.UpdateCurrent("fake-job-name", 1, recordID)
+				Expect(err).ToNot(HaveOccurred())
+
+				otherRecord, err := repo.Save("fake-other-cid", 1024, cloudProperties)
+				Expect(err).ToNot(HaveOccurred())
+				err = repo.UpdateCurrent("fake-other-job-name", 1, otherRecord.ID)
+				Expect(err).ToNot(HaveOccurred())
+
+				newRecord, err := repo.Save("fake-new-cid", 1024, cloudProperties)
+				Expect(err).ToNot(HaveOccurred())
+				err = repo.UpdateCurrent("fake-job-name", 1, newRecord.ID)
+				Expect(err).ToNot(HaveOccurred())
+
+				deploymentConfig, err := configService.Load()
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(deploymentConfig.CurrentDiskIDs).To(Equal([]string{otherRecord.ID, newRecord.ID}))
 			})
 		})
 
@@ -115,7 +140,7 @@ var _ = Describe("DiskRepo", func() {
 			})
 
 			It("returns an error", func() {
-				err := repo.UpdateCurrent("fake-unknown-id")
+				err := repo.UpdateCurrent("fake-job-name", 0, "fake-unknown-id")
 				Expect(err).To(HaveOccurred())
 				Expect(err.Error()).To(ContainSubstring("Verifying disk record exists with id 'fake-unknown-id'"))
 			})
@@ -123,7 +148,7 @@ var _ = Describe("DiskRepo", func() {
 	})
 
 	Describe("FindCurrent", func() {
-		Context("when current disk exists", func() {
+		Context("when current disks exist", func() {
 			var (
 				diskID2 string
 			)
@@ -135,18 +160,21 @@ var _ = Describe("DiskRepo", func() {
 				Expect(err).ToNot(HaveOccurred())
 				diskID2 = record.ID
 
-				repo.UpdateCurrent(record.ID)
+				repo.UpdateCurrent("fake-job-name", 0, record.ID)
 			})
 
-			It("returns existing disk", func() {
-				record, found, err := repo.FindCurrent()
+			It("returns existing disks", func() {
+				records, err := repo.FindCurrent()
 				Expect(err).ToNot(HaveOccurred())
-				Expect(found).To(BeTrue())
-				Expect(record).To(Equal(DiskRecord{
-					ID:              diskID2,
-					CID:             "fake-cid-2",
-					Size:            1024,
-					CloudProperties: cloudProperties,
+				Expect(records).To(Equal([]DiskRecord{
+					{
+						ID:              diskID2,
+						CID:             "fake-cid-2",
+						Size:            1024,
+						CloudProperties: cloudProperties,
+						JobName:         "fake-job-name",
+						Index:           0,
+					},
 				}))
 			})
 		})
@@ -157,16 +185,75 @@ var _ = Describe("DiskRepo", func() {
 				Expect(err).ToNot(HaveOccurred())
 			})
 
-			It("returns not found", func() {
-				_, found, err := repo.FindCurrent()
+			It("returns no disks", func() {
+				records, err := repo.FindCurrent()
 				Expect(err).ToNot(HaveOccurred())
-				Expect(found).To(BeFalse())
+				Expect(records).To(BeEmpty())
 			})
 		})
 
 		Context("when there are no disks", func() {
-			It("returns not found", func() {
-				_, found, err := repo.FindCurrent()
+			It("returns no disks", func() {
+				records, err := repo.FindCurrent()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(records).To(BeEmpty())
+			})
+		})
+	})
+
+	Describe("FindCurrentForInstance", func() {
+		var (
+			record DiskRecord
+		)
+
+		BeforeEach(func() {
+			var err error
+			record, err = repo.Save("fake-cid-1", 1024, cloudProperties)
+			Expect(err).ToNot(HaveOccurred())
+
+			err = repo.UpdateCurrent("fake-job-name", 1, record.ID)
+			Expect(err).ToNot(HaveOccurred())
+			record.JobName = "fake-job-name"
+			record.Index = 1
+		})
+
+		It("returns the current disk of the instance", func() {
+			foundRecord, found, err := repo.FindCurrentForInstance("fake-job-name", 1)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(found).To(BeTrue())
+			Expect(foundRecord).To(Equal(record))
+		})
+
+		It("does not return the current disk of another instance", func() {
+			_, found, err := repo.FindCurrentForInstance("fake-job-name", 0)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(found).To(BeFalse())
+
+			_, found, err = repo.FindCurrentForInstance("fake-other-job-name", 1)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(found).To(BeFalse())
+		})
+
+		Context("when the config was written with a single current disk id", func() {
+			BeforeEach(func() {
+				err := fs.WriteFileString("/fake/path", `{
+					"director_id": "fake-director-id",
+					"current_disk_id": "fake-disk-id",
+					"disks": [{"id": "fake-disk-id", "cid": "fake-disk-cid", "size": 1024}]
+				}`)
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			It("returns it for the first instance asking for index 0", func() {
+				foundRecord, found, err := repo.FindCurrentForInstance("fake-job-name", 0)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(found).To(BeTrue())
+				Expect(foundRecord.CID).To(Equal("fake-disk-cid"))
+
+				err = repo.UpdateCurrent("fake-job-name", 0, foundRecord.ID)
+				Expect(err).ToNot(HaveOccurred())
+
+				_, found, err = repo.FindCurrentForInstance("fake-other-job-name", 0)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(found).To(BeFalse())
 			})
@@ -227,7 +314,7 @@ var _ = Describe("DiskRepo", func() {
 
 		Context("when the disk to be deleted is also the current disk", func() {
 			BeforeEach(func() {
-				err := repo.UpdateCurrent(firstDisk.ID)
+				err := repo.UpdateCurrent("fake-job-name", 0, firstDisk.ID)
 				Expect(err).ToNot(HaveOccurred())
 			})
 
@@ -241,30 +328,30 @@ var _ = Describe("DiskRepo", func() {
 					secondDisk,
 				}))
 
-				_, found, err := repo.FindCurrent()
+				records, err := repo.FindCurrent()
 				Expect(err).ToNot(HaveOccurred())
-				Expect(found).To(BeFalse())
+				Expect(records).To(BeEmpty())
 			})
 		})
 	})
 
 	Describe("ClearCurrent", func() {
-		It("updates disk cid", func() {
-			err := repo.ClearCurrent()
+		It("clears the current disks", func() {
+			record, err := repo.Save("fake-cid", 1024, cloudProperties)
+			Expect(err).ToNot(HaveOccurred())
+			err = repo.UpdateCurrent("fake-job-name", 0, record.ID)
 			Expect(err).ToNot(HaveOccurred())
 
-			deploymentConfig, err := configService.Load()
+			err = repo.ClearCurrent()
 			Expect(err).ToNot(HaveOccurred())
 
-			expectedConfig := DeploymentFile{
-				DirectorID:    "fake-uuid-0",
-				CurrentDiskID: "",
-			}
-			Expect(deploymentConfig).To(Equal(expectedConfig))
+			deploymentConfig, err := configService.Load()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(deploymentConfig.CurrentDiskIDs).To(BeEmpty())
 
-			_, found, err := repo.FindCurrent()
+			records, err := repo.FindCurrent()
 			Expect(err).ToNot(HaveOccurred())
-			Expect(found).To(BeFalse())
+			Expect(records).To(BeEmpty())
 		})
 	})
 })
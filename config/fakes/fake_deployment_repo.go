@@ -5,6 +5,12 @@ type FakeDeploymentRepo struct {
 	UpdateCurrentErr          error
 
 	findCurrentOutput deploymentRepoFindCurrentOutput
+
+	UpdateCurrentFingerprintsInput     map[string]string
+	UpdateCurrentFingerprintsSaltInput string
+	UpdateCurrentFingerprintsErr       error
+
+	findCurrentFingerprintsOutput deploymentRepoFindCurrentFingerprintsOutput
 }
 
 type deploymentRepoFindCurrentOutput struct {
@@ -13,6 +19,13 @@ type deploymentRepoFindCurrentOutput struct {
 	err          error
 }
 
+type deploymentRepoFindCurrentFingerprintsOutput struct {
+	fingerprints map[string]string
+	salt         string
+	found        bool
+	err          error
+}
+
 func NewFakeDeploymentRepo() *FakeDeploymentRepo {
 	return &FakeDeploymentRepo{}
 }
@@ -33,3 +46,23 @@ func (r *FakeDeploymentRepo) SetFindCurrentBehavior(manifestSHA1 string, found b
 		err:          err,
 	}
 }
+
+func (r *FakeDeploymentRepo) UpdateCurrentFingerprints(fingerprints map[string]string, salt string) error {
+	r.UpdateCurrentFingerprintsInput = fingerprints
+	r.UpdateCurrentFingerprintsSaltInput = salt
+	return r.UpdateCurrentFingerprintsErr
+}
+
+func (r *FakeDeploymentRepo) FindCurrentFingerprints() (fingerprints map[string]string, salt string, found bool, err error) {
+	output := r.findCurrentFingerprintsOutput
+	return output.fingerprints, output.salt, output.found, output.err
+}
+
+func (r *FakeDeploymentRepo) SetFindCurrentFingerprintsBehavior(fingerprints map[string]string, salt string, found bool, err error) {
+	r.findCurrentFingerprintsOutput = deploymentRepoFindCurrentFingerprintsOutput{
+		fingerprints: fingerprints,
+		salt:         salt,
+		found:        found,
+		err:          err,
+	}
+}
@@ -23,7 +23,9 @@ type FakeDiskRepo struct {
 }
 
 type DiskRepoUpdateCurrentInput struct {
-	DiskID string
+	JobName string
+	Index   int
+	DiskID  string
 }
 
 type diskRepoFindCurrentOutput struct {
@@ -67,14 +69,23 @@ func NewFakeDiskRepo() *FakeDiskRepo {
 	}
 }
 
-func (r *FakeDiskRepo) UpdateCurrent(diskID string) error {
+func (r *FakeDiskRepo) UpdateCurrent(jobName string, index int, diskID string) error {
 	r.UpdateCurrentInputs = append(r.UpdateCurrentInputs, DiskRepoUpdateCurrentInput{
-		DiskID: diskID,
+		JobName: jobName,
+		Index:   index,
+		DiskID:  diskID,
 	})
 	return r.updateErr
 }
 
-func (r *FakeDiskRepo) FindCurrent() (biconfig.DiskRecord, bool, error) {
+func (r *FakeDiskRepo) FindCurrent() ([]biconfig.DiskRecord, error) {
+	if !r.findCurrentOutput.found {
+		return []biconfig.DiskRecord{}, r.findCurrentOutput.err
+	}
+	return []biconfig.DiskRecord{r.findCurrentOutput.diskRecord}, r.findCurrentOutput.err
+}
+
+func (r *FakeDiskRepo) FindCurrentForInstance(jobName string, index int) (biconfig.DiskRecord, bool, error) {
 	return r.findCurrentOutput.diskRecord, r.findCurrentOutput.found, r.findCurrentOutput.err
 }
 
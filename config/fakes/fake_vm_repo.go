@@ -1,43 +1,45 @@
 package fakes
 
+import (
+	biconfig "github.com/cloudfoundry/bosh-init/config"
+)
+
 type FakeVMRepo struct {
-	UpdateCurrentCID string
-	UpdateCurrentErr error
+	UpdateCurrentRecord biconfig.VMRecord
+	UpdateCurrentErr    error
 
-	ClearCurrentCalled bool
-	ClearCurrentErr    error
+	ClearCurrentCID string
+	ClearCurrentErr error
 
 	findCurrentOutput vmRepoFindCurrentOutput
 }
 
 type vmRepoFindCurrentOutput struct {
-	cid   string
-	found bool
-	err   error
+	records []biconfig.VMRecord
+	err     error
 }
 
 func NewFakeVMRepo() *FakeVMRepo {
 	return &FakeVMRepo{}
 }
 
-func (r *FakeVMRepo) FindCurrent() (cid string, found bool, err error) {
-	return r.findCurrentOutput.cid, r.findCurrentOutput.found, r.findCurrentOutput.err
+func (r *FakeVMRepo) FindCurrent() ([]biconfig.VMRecord, error) {
+	return r.findCurrentOutput.records, r.findCurrentOutput.err
 }
 
-func (r *FakeVMRepo) SetFindCurrentBehavior(cid string, found bool, err error) {
+func (r *FakeVMRepo) SetFindCurrentBehavior(records []biconfig.VMRecord, err error) {
 	r.findCurrentOutput = vmRepoFindCurrentOutput{
-		cid:   cid,
-		found: found,
-		err:   err,
+		records: records,
+		err:     err,
 	}
 }
 
-func (r *FakeVMRepo) UpdateCurrent(cid string) error {
-	r.UpdateCurrentCID = cid
+func (r *FakeVMRepo) UpdateCurrent(record biconfig.VMRecord) error {
+	r.UpdateCurrentRecord = record
 	return r.UpdateCurrentErr
 }
 
-func (r *FakeVMRepo) ClearCurrent() error {
-	r.ClearCurrentCalled = true
+func (r *FakeVMRepo) ClearCurrent(cid string) error {
+	r.ClearCurrentCID = cid
 	return r.ClearCurrentErr
 }
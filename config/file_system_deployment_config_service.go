@@ -1,26 +1,70 @@
 package config
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
 
 	bosherr "github.com/cloudfoundry/bosh-agent/errors"
 	boshlog "github.com/cloudfoundry/bosh-agent/logger"
 	boshsys "github.com/cloudfoundry/bosh-agent/system"
+	boshtime "github.com/cloudfoundry/bosh-agent/time"
 	boshuuid "github.com/cloudfoundry/bosh-agent/uuid"
+
+	bifile "github.com/cloudfoundry/bosh-init/common/file"
+	bicrypto "github.com/cloudfoundry/bosh-init/crypto"
+)
+
+const (
+	// DeploymentConfigMaxBackups is the number of previous versions of the deployment config kept as '<path>.<timestamp>'
+	DeploymentConfigMaxBackups = 5
+
+	deploymentConfigBackupTimeFormat = "20060102T150405Z"
 )
 
 type fileSystemDeploymentConfigService struct {
 	configPath    string
 	fs            boshsys.FileSystem
 	uuidGenerator boshuuid.Generator
+	timeService   boshtime.Service
+	encryptor     bicrypto.Encryptor
 	logger        boshlog.Logger
 	logTag        string
+
+	backedUp bool
+	locked   bool
+
+	// migratedContents are the contents of a config loaded with an older schema version,
+	// backed up to '<path>.schema-v<version>' on the next save
+	migratedContents []byte
+	migratedVersion  int
+
+	readOnly bool
+}
+
+// deploymentConfigLock is the content of the lock file, identifying the process holding the lock
+type deploymentConfigLock struct {
+	PID       int    `json:"pid"`
+	Host      string `json:"host"`
+	CreatedAt string `json:"created_at"`
 }
 
-func NewFileSystemDeploymentConfigService(fs boshsys.FileSystem, uuidGenerator boshuuid.Generator, logger boshlog.Logger) DeploymentConfigService {
+func NewFileSystemDeploymentConfigService(
+	fs boshsys.FileSystem,
+	uuidGenerator boshuuid.Generator,
+	timeService boshtime.Service,
+	encryptor bicrypto.Encryptor,
+	logger boshlog.Logger,
+) DeploymentConfigService {
 	return &fileSystemDeploymentConfigService{
 		fs:            fs,
 		uuidGenerator: uuidGenerator,
+		timeService:   timeService,
+		encryptor:     encryptor,
 		logger:        logger,
 		logTag:        "config",
 	}
@@ -32,6 +76,104 @@ func (s *fileSystemDeploymentConfigService) Exists() bool {
 
 func (s *fileSystemDeploymentConfigService) SetConfigPath(path string) {
 	s.configPath = path
+	s.backedUp = false
+	s.migratedContents = nil
+}
+
+func (s *fileSystemDeploymentConfigService) SetReadOnly() {
+	s.readOnly = true
+}
+
+func (s *fileSystemDeploymentConfigService) Lock() error {
+	if s.configPath == "" {
+		panic("configPath not yet set!")
+	}
+
+	lockPath := s.lockPath()
+	if s.fs.FileExists(lockPath) {
+		return s.lockedError()
+	}
+
+	err := s.fs.MkdirAll(filepath.Dir(lockPath), os.ModePerm)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Creating deployment config directory '%s'", filepath.Dir(lockPath))
+	}
+
+	// O_EXCL makes creating the lock file fail if another process created it since it was checked
+	lockFile, err := s.fs.OpenFile(lockPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		if os.IsExist(err) {
+			return s.lockedError()
+		}
+		return bosherr.WrapErrorf(err, "Creating deployment config lock file '%s'", lockPath)
+	}
+	defer lockFile.Close()
+
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+
+	lockContents, err := json.Marshal(deploymentConfigLock{
+		PID:       os.Getpid(),
+		Host:      host,
+		CreatedAt: s.timeService.Now().UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return bosherr.WrapError(err, "Marshalling deployment config lock")
+	}
+
+	_, err = lockFile.Write(lockContents)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Writing deployment config lock file '%s'", lockPath)
+	}
+
+	s.locked = true
+	s.logger.Debug(s.logTag, "Locked deployment config: %s", lockPath)
+
+	return nil
+}
+
+func (s *fileSystemDeploymentConfigService) Unlock() error {
+	if !s.locked {
+		return nil
+	}
+
+	err := s.fs.RemoveAll(s.lockPath())
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Removing deployment config lock file '%s'", s.lockPath())
+	}
+
+	s.locked = false
+	s.logger.Debug(s.logTag, "Unlocked deployment config: %s", s.lockPath())
+
+	return nil
+}
+
+func (s *fileSystemDeploymentConfigService) lockPath() string {
+	return s.configPath + ".lock"
+}
+
+func (s *fileSystemDeploymentConfigService) lockedError() error {
+	lockPath := s.lockPath()
+
+	lock := deploymentConfigLock{}
+	lockContents, err := s.fs.ReadFile(lockPath)
+	if err == nil {
+		err = json.Unmarshal(lockContents, &lock)
+	}
+	if err != nil {
+		return bosherr.Errorf("Deployment config '%s' is locked by another process: remove '%s' if no other bosh-init command is running", s.configPath, lockPath)
+	}
+
+	return bosherr.Errorf(
+		"Deployment config '%s' is locked by process %d on host '%s' since %s: remove '%s' if that process is no longer running",
+		s.configPath,
+		lock.PID,
+		lock.Host,
+		lock.CreatedAt,
+		lockPath,
+	)
 }
 
 func (s *fileSystemDeploymentConfigService) Load() (DeploymentFile, error) {
@@ -41,7 +183,7 @@ func (s *fileSystemDeploymentConfigService) Load() (DeploymentFile, error) {
 
 	s.logger.Debug(s.logTag, "Loading deployment config: %s", s.configPath)
 
-	deploymentFile := &DeploymentFile{}
+	deploymentFile := &DeploymentFile{SchemaVersion: DeploymentFileSchemaVersion}
 
 	if s.fs.FileExists(s.configPath) {
 		deploymentFileContents, err := s.fs.ReadFile(s.configPath)
@@ -50,13 +192,25 @@ func (s *fileSystemDeploymentConfigService) Load() (DeploymentFile, error) {
 		}
 		s.logger.Debug(s.logTag, "Deployment File Contents %#s", deploymentFileContents)
 
-		err = json.Unmarshal(deploymentFileContents, deploymentFile)
+		decryptedContents, err := s.encryptor.Decrypt(deploymentFileContents)
+		if err != nil {
+			return DeploymentFile{}, bosherr.WrapErrorf(err, "Decrypting deployment config file '%s'", s.configPath)
+		}
+
+		var schemaVersion int
+		*deploymentFile, schemaVersion, err = unmarshalDeploymentFile(decryptedContents, fmt.Sprintf("deployment config file '%s'", s.configPath))
 		if err != nil {
-			return DeploymentFile{}, bosherr.WrapErrorf(err, "Unmarshalling deployment config file '%s'", s.configPath)
+			return DeploymentFile{}, err
+		}
+
+		if schemaVersion < DeploymentFileSchemaVersion && s.migratedContents == nil {
+			s.logger.Info(s.logTag, "Migrated deployment config file '%s' from schema version %d to %d", s.configPath, schemaVersion, DeploymentFileSchemaVersion)
+			s.migratedContents = deploymentFileContents
+			s.migratedVersion = schemaVersion
 		}
 	}
 
-	err := s.initDefaults(deploymentFile)
+	err := initDefaults(deploymentFile, s.uuidGenerator, s.saveDefaults)
 	if err != nil {
 		return DeploymentFile{}, bosherr.WrapErrorf(err, "Initializing deployment config defaults")
 	}
@@ -64,11 +218,24 @@ func (s *fileSystemDeploymentConfigService) Load() (DeploymentFile, error) {
 	return *deploymentFile, nil
 }
 
+// saveDefaults saves the defaults of a new deployment config, unless it is read only
+func (s *fileSystemDeploymentConfigService) saveDefaults(deploymentFile DeploymentFile) error {
+	if s.readOnly {
+		return nil
+	}
+	return s.Save(deploymentFile)
+}
+
 func (s *fileSystemDeploymentConfigService) Save(deploymentFile DeploymentFile) error {
 	if s.configPath == "" {
 		panic("configPath not yet set!")
 	}
 
+	if s.readOnly {
+		return bosherr.Errorf("Saving read only deployment config file '%s'", s.configPath)
+	}
+
+	deploymentFile.SchemaVersion = DeploymentFileSchemaVersion
 	s.logger.Debug(s.logTag, "Saving deployment config %#v", deploymentFile)
 
 	jsonContent, err := json.MarshalIndent(deploymentFile, "", "    ")
@@ -76,27 +243,159 @@ func (s *fileSystemDeploymentConfigService) Save(deploymentFile DeploymentFile)
 		return bosherr.WrapError(err, "Marshalling deployment config into JSON")
 	}
 
-	err = s.fs.WriteFile(s.configPath, jsonContent)
+	jsonContent, err = s.encryptor.Encrypt(jsonContent)
+	if err != nil {
+		return bosherr.WrapError(err, "Encrypting deployment config")
+	}
+
+	if !s.backedUp {
+		err = s.backup()
+		if err != nil {
+			return err
+		}
+		s.backedUp = true
+	}
+
+	if s.migratedContents != nil {
+		err = s.backupSchemaVersion()
+		if err != nil {
+			return err
+		}
+		s.migratedContents = nil
+	}
+
+	// the file is written next to the config and renamed over it, so that a failed write does not corrupt the config
+	tmpPath := s.configPath + ".tmp"
+	err = bifile.WriteWithMode(s.fs, tmpPath, jsonContent, s.fileMode(s.configPath))
 	if err != nil {
 		return bosherr.WrapErrorf(err, "Writing deployment config file '%s'", s.configPath)
 	}
 
+	err = s.fs.Rename(tmpPath, s.configPath)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Renaming '%s' to deployment config file '%s'", tmpPath, s.configPath)
+	}
+
 	return nil
 }
 
-func (s *fileSystemDeploymentConfigService) initDefaults(deploymentFile *DeploymentFile) error {
-	if deploymentFile.DirectorID == "" {
-		uuid, err := s.uuidGenerator.Generate()
+// backup copies the config, as it was before the first save of the command, to '<path>.<timestamp>',
+// and deletes the oldest backups beyond the max backups
+func (s *fileSystemDeploymentConfigService) backup() error {
+	if !s.fs.FileExists(s.configPath) {
+		return nil
+	}
+
+	contents, err := s.fs.ReadFile(s.configPath)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Reading deployment config file '%s'", s.configPath)
+	}
+
+	backupPath := fmt.Sprintf("%s.%s", s.configPath, s.timeService.Now().UTC().Format(deploymentConfigBackupTimeFormat))
+	err = bifile.WriteWithMode(s.fs, backupPath, contents, s.fileMode(s.configPath))
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Backing up deployment config file '%s' to '%s'", s.configPath, backupPath)
+	}
+
+	backupPaths, err := s.fs.Glob(s.configPath + ".[0-9]*Z")
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Finding deployment config file backups")
+	}
+
+	// timestamps sort chronologically
+	sort.Strings(backupPaths)
+	for len(backupPaths) > DeploymentConfigMaxBackups {
+		err = s.fs.RemoveAll(backupPaths[0])
 		if err != nil {
-			return bosherr.WrapError(err, "Generating DirectorID")
+			return bosherr.WrapErrorf(err, "Deleting deployment config file backup '%s'", backupPaths[0])
 		}
-		deploymentFile.DirectorID = uuid
+		backupPaths = backupPaths[1:]
+	}
+
+	return nil
+}
+
+// backupSchemaVersion writes the config, as it was before it was migrated to the current schema version, to '<path>.schema-v<version>'.
+// The backup is not deleted with the timestamped backups, so that it can be restored to use the config with an older version of bosh-init.
+// It is created with the permissions of the config, which may have been restricted as the config contains credentials.
+func (s *fileSystemDeploymentConfigService) backupSchemaVersion() error {
+	backupPath := fmt.Sprintf("%s.schema-v%d", s.configPath, s.migratedVersion)
+	if s.fs.FileExists(backupPath) {
+		return nil
+	}
+
+	err := bifile.WriteWithMode(s.fs, backupPath, s.migratedContents, s.fileMode(s.configPath))
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Backing up deployment config file '%s' with schema version %d to '%s'", s.configPath, s.migratedVersion, backupPath)
+	}
 
-		err = s.Save(*deploymentFile)
+	return nil
+}
+
+// fileMode returns the permissions of the file.
+// The file system does not report them, so they are read from the OS; when they cannot be read,
+// the file is assumed to be readable only by the current user.
+func (s *fileSystemDeploymentConfigService) fileMode(path string) os.FileMode {
+	fileInfo, err := os.Stat(path)
+	if err != nil {
+		s.logger.Debug(s.logTag, "Failed to read the permissions of '%s': %s", path, err.Error())
+		return 0600
+	}
+	return fileInfo.Mode().Perm()
+}
+
+// RekeyBackups rewrites the timestamped and schema version backups of the config.
+// Backups encrypted with a key that is no longer known are left as they are.
+func (s *fileSystemDeploymentConfigService) RekeyBackups() error {
+	if s.configPath == "" {
+		panic("configPath not yet set!")
+	}
+
+	backupPaths := []string{}
+	for _, pattern := range []string{s.configPath + ".[0-9]*Z", s.configPath + ".schema-v*"} {
+		matches, err := s.fs.Glob(pattern)
+		if err != nil {
+			return bosherr.WrapErrorf(err, "Finding deployment config file backups")
+		}
+		backupPaths = append(backupPaths, matches...)
+	}
+
+	for _, backupPath := range backupPaths {
+		err := s.rekeyFile(backupPath)
 		if err != nil {
-			return bosherr.WrapError(err, "Saving deployment config")
+			return err
 		}
 	}
 
 	return nil
 }
+
+func (s *fileSystemDeploymentConfigService) rekeyFile(path string) error {
+	contents, err := s.fs.ReadFile(path)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Reading deployment config file backup '%s'", path)
+	}
+
+	decryptedContents, err := s.encryptor.Decrypt(contents)
+	if err != nil {
+		s.logger.Warn(s.logTag, "Not rekeying deployment config file backup '%s': %s", path, err.Error())
+		return nil
+	}
+
+	rekeyedContents, err := s.encryptor.Encrypt(decryptedContents)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Encrypting deployment config file backup '%s'", path)
+	}
+
+	if bytes.Equal(rekeyedContents, contents) {
+		return nil
+	}
+
+	err = bifile.WriteWithMode(s.fs, path, rekeyedContents, s.fileMode(path))
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Writing deployment config file backup '%s'", path)
+	}
+	s.logger.Debug(s.logTag, "Rekeyed deployment config file backup '%s'", path)
+
+	return nil
+}
@@ -5,13 +5,20 @@ import (
 	. "github.com/onsi/gomega"
 
 	. "github.com/cloudfoundry/bosh-init/config"
+	bicrypto "github.com/cloudfoundry/bosh-init/crypto"
 
 	"encoding/json"
 	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
 
 	boshlog "github.com/cloudfoundry/bosh-agent/logger"
+	boshsys "github.com/cloudfoundry/bosh-agent/system"
 
 	fakesys "github.com/cloudfoundry/bosh-agent/system/fakes"
+	faketime "github.com/cloudfoundry/bosh-agent/time/fakes"
 	fakeuuid "github.com/cloudfoundry/bosh-agent/uuid/fakes"
 
 	biproperty "github.com/cloudfoundry/bosh-init/common/property"
@@ -23,6 +30,8 @@ var _ = Describe("fileSystemConfigService", func() {
 		deploymentFilePath string
 		fakeFs             *fakesys.FakeFileSystem
 		fakeUUIDGenerator  *fakeuuid.FakeGenerator
+		fakeTimeService    *faketime.FakeService
+		encryptor          bicrypto.Encryptor
 	)
 
 	BeforeEach(func() {
@@ -30,7 +39,9 @@ var _ = Describe("fileSystemConfigService", func() {
 		deploymentFilePath = "/some/deployment.json"
 		logger := boshlog.NewLogger(boshlog.LevelNone)
 		fakeUUIDGenerator = fakeuuid.NewFakeGenerator()
-		service = NewFileSystemDeploymentConfigService(fakeFs, fakeUUIDGenerator, logger)
+		fakeTimeService = &faketime.FakeService{}
+		encryptor = bicrypto.NewEncryptor(nil)
+		service = NewFileSystemDeploymentConfigService(fakeFs, fakeUUIDGenerator, fakeTimeService, encryptor, logger)
 		service.SetConfigPath(deploymentFilePath)
 	})
 
@@ -83,8 +94,8 @@ var _ = Describe("fileSystemConfigService", func() {
 			Expect(err).NotTo(HaveOccurred())
 			Expect(deploymentFile.DirectorID).To(Equal("fake-director-id"))
 			Expect(deploymentFile.Stemcells).To(Equal(stemcells))
-			Expect(deploymentFile.CurrentVMCID).To(Equal("fake-vm-cid"))
-			Expect(deploymentFile.CurrentDiskID).To(Equal("fake-disk-id"))
+			Expect(deploymentFile.CurrentVMs).To(Equal([]VMRecord{{CID: "fake-vm-cid"}}))
+			Expect(deploymentFile.CurrentDiskIDs).To(Equal([]string{"fake-disk-id"}))
 			Expect(deploymentFile.Disks).To(Equal(disks))
 		})
 
@@ -93,7 +104,8 @@ var _ = Describe("fileSystemConfigService", func() {
 				config, err := service.Load()
 				Expect(err).NotTo(HaveOccurred())
 				Expect(config).To(Equal(DeploymentFile{
-					DirectorID: "fake-uuid-0",
+					SchemaVersion: DeploymentFileSchemaVersion,
+					DirectorID:    "fake-uuid-0",
 				}))
 
 				Expect(fakeFs.FileExists(deploymentFilePath)).To(BeTrue())
@@ -122,6 +134,140 @@ var _ = Describe("fileSystemConfigService", func() {
 				Expect(config).To(Equal(DeploymentFile{}))
 			})
 		})
+
+		Context("when the config was written with an older schema version", func() {
+			BeforeEach(func() {
+				fakeFs.WriteFileString(deploymentFilePath, `{"director_id":"fake-director-id","current_vm_cid":"fake-vm-cid"}`)
+				fakeTimeService.NowTimes = []time.Time{
+					time.Date(2015, time.March, 4, 5, 6, 7, 0, time.UTC),
+				}
+			})
+
+			It("migrates it to the current schema version", func() {
+				deploymentFile, err := service.Load()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(deploymentFile.SchemaVersion).To(Equal(DeploymentFileSchemaVersion))
+				Expect(deploymentFile.CurrentVMs).To(Equal([]VMRecord{{CID: "fake-vm-cid"}}))
+				Expect(deploymentFile.CurrentVMCID).To(BeEmpty())
+			})
+
+			It("backs up the config with the older schema version on the next save, and keeps the backup", func() {
+				deploymentFile, err := service.Load()
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(fakeFs.FileExists("/some/deployment.json.schema-v0")).To(BeFalse())
+
+				err = service.Save(deploymentFile)
+				Expect(err).NotTo(HaveOccurred())
+
+				backupContents, err := fakeFs.ReadFileString("/some/deployment.json.schema-v0")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(backupContents).To(Equal(`{"director_id":"fake-director-id","current_vm_cid":"fake-vm-cid"}`))
+
+				contents, err := fakeFs.ReadFileString(deploymentFilePath)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(contents).To(ContainSubstring(fmt.Sprintf(`"schema_version": %d`, DeploymentFileSchemaVersion)))
+				Expect(contents).ToNot(ContainSubstring("current_vm_cid"))
+			})
+
+			It("does not overwrite an existing backup of the older schema version", func() {
+				fakeFs.WriteFileString("/some/deployment.json.schema-v0", "fake-previous-backup")
+
+				deploymentFile, err := service.Load()
+				Expect(err).NotTo(HaveOccurred())
+
+				err = service.Save(deploymentFile)
+				Expect(err).NotTo(HaveOccurred())
+
+				backupContents, err := fakeFs.ReadFileString("/some/deployment.json.schema-v0")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(backupContents).To(Equal("fake-previous-backup"))
+			})
+
+			It("backs up the config with the permissions of the config", func() {
+				logger := boshlog.NewLogger(boshlog.LevelNone)
+				fs := boshsys.NewOsFileSystem(logger)
+				configDir, err := fs.TempDir("deployment-config")
+				Expect(err).NotTo(HaveOccurred())
+				defer fs.RemoveAll(configDir)
+
+				configPath := filepath.Join(configDir, "deployment.json")
+				err = fs.WriteFileString(configPath, `{"director_id":"fake-director-id","current_vm_cid":"fake-vm-cid"}`)
+				Expect(err).NotTo(HaveOccurred())
+				err = fs.Chmod(configPath, 0640)
+				Expect(err).NotTo(HaveOccurred())
+
+				service = NewFileSystemDeploymentConfigService(fs, fakeUUIDGenerator, fakeTimeService, encryptor, logger)
+				service.SetConfigPath(configPath)
+
+				deploymentFile, err := service.Load()
+				Expect(err).NotTo(HaveOccurred())
+				err = service.Save(deploymentFile)
+				Expect(err).NotTo(HaveOccurred())
+
+				fileInfo, err := os.Stat(configPath + ".schema-v0")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(fileInfo.Mode().Perm()).To(Equal(os.FileMode(0640)))
+			})
+
+			It("returns an error and leaves the config unchanged when the backup fails", func() {
+				fakeFs.OpenFileErr = errors.New("fake-backup-error")
+
+				deploymentFile, err := service.Load()
+				Expect(err).NotTo(HaveOccurred())
+
+				err = service.Save(deploymentFile)
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("fake-backup-error"))
+
+				contents, err := fakeFs.ReadFileString(deploymentFilePath)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(contents).To(Equal(`{"director_id":"fake-director-id","current_vm_cid":"fake-vm-cid"}`))
+			})
+		})
+
+		Context("when the config was written with schema version 1", func() {
+			BeforeEach(func() {
+				fakeFs.WriteFileString(deploymentFilePath, `{
+					"schema_version": 1,
+					"director_id": "fake-director-id",
+					"current_vms": [{"cid": "fake-vm-cid", "job_name": "fake-job-name", "index": 0, "agent_id": "fake-agent-id"}],
+					"current_stemcell_id": "fake-stemcell-id"
+				}`)
+			})
+
+			It("records the current stemcell as the stemcell of the current vms", func() {
+				deploymentFile, err := service.Load()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(deploymentFile.CurrentVMs).To(Equal([]VMRecord{
+					{CID: "fake-vm-cid", JobName: "fake-job-name", Index: 0, AgentID: "fake-agent-id", StemcellID: "fake-stemcell-id"},
+				}))
+
+				err = service.Save(deploymentFile)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(fakeFs.FileExists("/some/deployment.json.schema-v1")).To(BeTrue())
+			})
+		})
+
+		Context("when the config was written with a newer schema version", func() {
+			BeforeEach(func() {
+				fakeFs.WriteFileString(deploymentFilePath, fmt.Sprintf(`{"schema_version":%d,"director_id":"fake-director-id"}`, DeploymentFileSchemaVersion+1))
+			})
+
+			It("returns an error without changing the config", func() {
+				_, err := service.Load()
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring(fmt.Sprintf(
+					"The deployment config file '/some/deployment.json' has schema version %d, but this version of bosh-init only supports up to schema version %d: upgrade bosh-init",
+					DeploymentFileSchemaVersion+1,
+					DeploymentFileSchemaVersion,
+				)))
+
+				contents, err := fakeFs.ReadFileString(deploymentFilePath)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(contents).To(Equal(fmt.Sprintf(`{"schema_version":%d,"director_id":"fake-director-id"}`, DeploymentFileSchemaVersion+1)))
+			})
+		})
 	})
 
 	Describe("Save", func() {
@@ -135,7 +281,7 @@ var _ = Describe("fileSystemConfigService", func() {
 						CID:     "fake-stemcell-cid",
 					},
 				},
-				CurrentVMCID: "fake-vm-cid",
+				CurrentVMs: []VMRecord{{CID: "fake-vm-cid", JobName: "fake-job-name"}},
 				Disks: []DiskRecord{
 					{
 						CID:  "fake-disk-cid",
@@ -152,7 +298,8 @@ var _ = Describe("fileSystemConfigService", func() {
 
 			deploymentFileContents, err := fakeFs.ReadFileString(deploymentFilePath)
 			deploymentFile := DeploymentFile{
-				DirectorID: "deadbeef",
+				SchemaVersion: DeploymentFileSchemaVersion,
+				DirectorID:    "deadbeef",
 				Stemcells: []StemcellRecord{
 					{
 						Name:    "fake-stemcell-name",
@@ -160,7 +307,7 @@ var _ = Describe("fileSystemConfigService", func() {
 						CID:     "fake-stemcell-cid",
 					},
 				},
-				CurrentVMCID: "fake-vm-cid",
+				CurrentVMs: []VMRecord{{CID: "fake-vm-cid", JobName: "fake-job-name"}},
 				Disks: []DiskRecord{
 					{
 						CID:  "fake-disk-cid",
@@ -175,9 +322,122 @@ var _ = Describe("fileSystemConfigService", func() {
 			Expect(deploymentFileContents).To(Equal(string(expectedDeploymentFileContents)))
 		})
 
+		It("writes a temporary file and renames it over the deployment file", func() {
+			err := service.Save(DeploymentFile{DirectorID: "deadbeef"})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fakeFs.RenameOldPaths).To(Equal([]string{"/some/deployment.json.tmp"}))
+			Expect(fakeFs.RenameNewPaths).To(Equal([]string{"/some/deployment.json"}))
+			Expect(fakeFs.FileExists("/some/deployment.json.tmp")).To(BeFalse())
+		})
+
+		Context("when the deployment file exists", func() {
+			BeforeEach(func() {
+				fakeFs.WriteFileString(deploymentFilePath, `{"director_id":"fake-previous-director-id"}`)
+				fakeTimeService.NowTimes = []time.Time{
+					time.Date(2015, time.March, 4, 5, 6, 7, 0, time.UTC),
+				}
+			})
+
+			It("backs up the previous version of the deployment file on the first save", func() {
+				err := service.Save(DeploymentFile{DirectorID: "fake-director-id-1"})
+				Expect(err).NotTo(HaveOccurred())
+
+				err = service.Save(DeploymentFile{DirectorID: "fake-director-id-2"})
+				Expect(err).NotTo(HaveOccurred())
+
+				backupContents, err := fakeFs.ReadFileString("/some/deployment.json.20150304T050607Z")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(backupContents).To(Equal(`{"director_id":"fake-previous-director-id"}`))
+
+				deploymentFile, err := service.Load()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(deploymentFile.DirectorID).To(Equal("fake-director-id-2"))
+			})
+
+			It("deletes the oldest backups", func() {
+				backupPaths := []string{}
+				for i := 0; i <= DeploymentConfigMaxBackups; i++ {
+					backupPath := fmt.Sprintf("/some/deployment.json.2015030%dT000000Z", i)
+					fakeFs.WriteFileString(backupPath, "{}")
+					backupPaths = append(backupPaths, backupPath)
+				}
+				fakeFs.SetGlob("/some/deployment.json.[0-9]*Z", append(backupPaths, "/some/deployment.json.20150304T050607Z"))
+
+				err := service.Save(DeploymentFile{DirectorID: "fake-director-id"})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(fakeFs.FileExists(backupPaths[0])).To(BeFalse())
+				Expect(fakeFs.FileExists(backupPaths[1])).To(BeFalse())
+				Expect(fakeFs.FileExists(backupPaths[2])).To(BeTrue())
+				Expect(fakeFs.FileExists("/some/deployment.json.20150304T050607Z")).To(BeTrue())
+			})
+
+			It("keeps the permissions of the deployment file, and backs it up with them", func() {
+				logger := boshlog.NewLogger(boshlog.LevelNone)
+				fs := boshsys.NewOsFileSystem(logger)
+				configDir, err := fs.TempDir("deployment-config")
+				Expect(err).NotTo(HaveOccurred())
+				defer fs.RemoveAll(configDir)
+
+				configPath := filepath.Join(configDir, "deployment.json")
+				err = fs.WriteFileString(configPath, `{"director_id":"fake-previous-director-id"}`)
+				Expect(err).NotTo(HaveOccurred())
+				err = fs.Chmod(configPath, 0600)
+				Expect(err).NotTo(HaveOccurred())
+
+				service = NewFileSystemDeploymentConfigService(fs, fakeUUIDGenerator, fakeTimeService, encryptor, logger)
+				service.SetConfigPath(configPath)
+
+				err = service.Save(DeploymentFile{DirectorID: "fake-director-id"})
+				Expect(err).NotTo(HaveOccurred())
+
+				for _, path := range []string{configPath, configPath + ".20150304T050607Z"} {
+					fileInfo, err := os.Stat(path)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(fileInfo.Mode().Perm()).To(Equal(os.FileMode(0600)), path)
+				}
+			})
+
+			Context("when backing up fails", func() {
+				BeforeEach(func() {
+					failingFile := fakesys.NewFakeFile("/some/deployment.json.20150304T050607Z", fakeFs)
+					failingFile.WriteErr = errors.New("fake-backup-error")
+					fakeFs.RegisterOpenFile("/some/deployment.json.20150304T050607Z", failingFile)
+				})
+
+				It("returns an error and leaves the deployment file unchanged", func() {
+					err := service.Save(DeploymentFile{DirectorID: "fake-director-id"})
+					Expect(err).To(HaveOccurred())
+					Expect(err.Error()).To(ContainSubstring("fake-backup-error"))
+
+					contents, err := fakeFs.ReadFileString(deploymentFilePath)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(contents).To(Equal(`{"director_id":"fake-previous-director-id"}`))
+				})
+			})
+		})
+
+		Context("when the temporary file cannot be renamed", func() {
+			BeforeEach(func() {
+				fakeFs.WriteFileString(deploymentFilePath, `{"director_id":"fake-previous-director-id"}`)
+				fakeFs.RenameError = errors.New("fake-rename-error")
+			})
+
+			It("returns an error and leaves the deployment file unchanged", func() {
+				err := service.Save(DeploymentFile{DirectorID: "fake-director-id"})
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("fake-rename-error"))
+
+				contents, err := fakeFs.ReadFileString(deploymentFilePath)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(contents).To(Equal(`{"director_id":"fake-previous-director-id"}`))
+			})
+		})
+
 		Context("when the deployment file cannot be written", func() {
 			BeforeEach(func() {
-				fakeFs.WriteFileError = errors.New("")
+				fakeFs.OpenFileErr = errors.New("")
 			})
 
 			It("returns an error when it cannot write the config file", func() {
@@ -190,4 +450,227 @@ var _ = Describe("fileSystemConfigService", func() {
 			})
 		})
 	})
+
+	Context("when it is read only", func() {
+		BeforeEach(func() {
+			service.SetReadOnly()
+		})
+
+		It("returns the generated defaults of a config that does not exist without saving them", func() {
+			config, err := service.Load()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(config.DirectorID).To(Equal("fake-uuid-0"))
+
+			Expect(fakeFs.FileExists(deploymentFilePath)).To(BeFalse())
+		})
+
+		It("returns an error when saving, and leaves the deployment file unchanged", func() {
+			fakeFs.WriteFileString(deploymentFilePath, `{"director_id":"fake-director-id"}`)
+
+			err := service.Save(DeploymentFile{DirectorID: "fake-other-director-id"})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Saving read only deployment config file '/some/deployment.json'"))
+
+			contents, err := fakeFs.ReadFileString(deploymentFilePath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(contents).To(Equal(`{"director_id":"fake-director-id"}`))
+		})
+	})
+
+	Describe("Lock", func() {
+		It("creates a lock file with the pid and host of the process", func() {
+			fakeTimeService.NowTimes = []time.Time{
+				time.Date(2015, time.March, 4, 5, 6, 7, 0, time.UTC),
+			}
+
+			err := service.Lock()
+			Expect(err).NotTo(HaveOccurred())
+
+			host, err := os.Hostname()
+			Expect(err).NotTo(HaveOccurred())
+
+			lockContents, err := fakeFs.ReadFileString("/some/deployment.json.lock")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(lockContents).To(Equal(fmt.Sprintf(`{"pid":%d,"host":"%s","created_at":"2015-03-04T05:06:07Z"}`, os.Getpid(), host)))
+		})
+
+		It("returns an error with the lock holder when the lock is held by another process", func() {
+			fakeFs.WriteFileString("/some/deployment.json.lock", `{"pid":1234,"host":"fake-host","created_at":"2015-03-04T05:06:07Z"}`)
+
+			err := service.Lock()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("locked by process 1234 on host 'fake-host' since 2015-03-04T05:06:07Z"))
+			Expect(err.Error()).To(ContainSubstring("remove '/some/deployment.json.lock'"))
+		})
+
+		It("returns an error when the lock file cannot be read", func() {
+			fakeFs.WriteFileString("/some/deployment.json.lock", "")
+
+			err := service.Lock()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("locked by another process"))
+		})
+
+		It("returns an error when the lock file cannot be created", func() {
+			fakeFs.OpenFileErr = errors.New("fake-open-error")
+
+			err := service.Lock()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("fake-open-error"))
+		})
+	})
+
+	Describe("Unlock", func() {
+		It("removes the lock file", func() {
+			err := service.Lock()
+			Expect(err).NotTo(HaveOccurred())
+
+			err = service.Unlock()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeFs.FileExists("/some/deployment.json.lock")).To(BeFalse())
+		})
+
+		It("does not remove a lock file held by another process", func() {
+			fakeFs.WriteFileString("/some/deployment.json.lock", `{"pid":1234,"host":"fake-host"}`)
+
+			err := service.Lock()
+			Expect(err).To(HaveOccurred())
+
+			err = service.Unlock()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeFs.FileExists("/some/deployment.json.lock")).To(BeTrue())
+		})
+	})
+
+	Context("when the encryptor has a key", func() {
+		BeforeEach(func() {
+			encryptor.SetKey([]byte("fake-key"))
+		})
+
+		It("writes the config file encrypted", func() {
+			err := service.Save(DeploymentFile{DirectorID: "fake-director-id"})
+			Expect(err).ToNot(HaveOccurred())
+
+			contents, err := fakeFs.ReadFile(deploymentFilePath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(bicrypto.IsEncrypted(contents)).To(BeTrue())
+			Expect(string(contents)).ToNot(ContainSubstring("fake-director-id"))
+
+			deploymentFile, err := service.Load()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(deploymentFile.DirectorID).To(Equal("fake-director-id"))
+		})
+
+		It("reads a config file written before encryption was enabled and encrypts it when it is saved", func() {
+			fakeFs.WriteFileString(deploymentFilePath, `{"director_id":"fake-director-id"}`)
+
+			deploymentFile, err := service.Load()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(deploymentFile.DirectorID).To(Equal("fake-director-id"))
+
+			err = service.Save(deploymentFile)
+			Expect(err).ToNot(HaveOccurred())
+
+			contents, err := fakeFs.ReadFile(deploymentFilePath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(bicrypto.IsEncrypted(contents)).To(BeTrue())
+		})
+
+		It("returns an error when loading without the key", func() {
+			err := service.Save(DeploymentFile{DirectorID: "fake-director-id"})
+			Expect(err).ToNot(HaveOccurred())
+
+			otherService := NewFileSystemDeploymentConfigService(fakeFs, fakeUUIDGenerator, fakeTimeService, bicrypto.NewEncryptor(nil), boshlog.NewLogger(boshlog.LevelNone))
+			otherService.SetConfigPath(deploymentFilePath)
+
+			_, err = otherService.Load()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Decrypting deployment config file '/some/deployment.json'"))
+			Expect(err.Error()).To(ContainSubstring("set BOSH_INIT_STATE_KEY or BOSH_INIT_STATE_KEY_FILE"))
+		})
+
+		Describe("RekeyBackups", func() {
+			var (
+				plaintextBackupPath = "/some/deployment.json.20150101T000000Z"
+				otherKeyBackupPath  = "/some/deployment.json.20150102T000000Z"
+			)
+
+			BeforeEach(func() {
+				fakeFs.WriteFileString(plaintextBackupPath, `{"director_id":"fake-director-id"}`)
+				otherKeyContents, err := bicrypto.NewEncryptor([]byte("fake-other-key")).Encrypt([]byte(`{"director_id":"fake-director-id"}`))
+				Expect(err).ToNot(HaveOccurred())
+				fakeFs.WriteFile(otherKeyBackupPath, otherKeyContents)
+
+				fakeFs.SetGlob("/some/deployment.json.[0-9]*Z", []string{plaintextBackupPath, otherKeyBackupPath})
+			})
+
+			It("encrypts backups written before encryption was enabled", func() {
+				err := service.RekeyBackups()
+				Expect(err).ToNot(HaveOccurred())
+
+				contents, err := fakeFs.ReadFile(plaintextBackupPath)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(bicrypto.IsEncrypted(contents)).To(BeTrue())
+
+				decryptedContents, err := encryptor.Decrypt(contents)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(decryptedContents)).To(Equal(`{"director_id":"fake-director-id"}`))
+			})
+
+			It("encrypts the backup of the config with an older schema version", func() {
+				schemaBackupPath := "/some/deployment.json.schema-v0"
+				fakeFs.WriteFileString(schemaBackupPath, `{"director_id":"fake-director-id","current_vm_cid":"fake-vm-cid"}`)
+				fakeFs.SetGlob("/some/deployment.json.schema-v*", []string{schemaBackupPath})
+
+				err := service.RekeyBackups()
+				Expect(err).ToNot(HaveOccurred())
+
+				contents, err := fakeFs.ReadFile(schemaBackupPath)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(bicrypto.IsEncrypted(contents)).To(BeTrue())
+
+				decryptedContents, err := encryptor.Decrypt(contents)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(decryptedContents)).To(Equal(`{"director_id":"fake-director-id","current_vm_cid":"fake-vm-cid"}`))
+			})
+
+			It("keeps the permissions of the backups", func() {
+				logger := boshlog.NewLogger(boshlog.LevelNone)
+				fs := boshsys.NewOsFileSystem(logger)
+				configDir, err := fs.TempDir("deployment-config")
+				Expect(err).ToNot(HaveOccurred())
+				defer fs.RemoveAll(configDir)
+
+				configPath := filepath.Join(configDir, "deployment.json")
+				backupPath := configPath + ".20150101T000000Z"
+				err = fs.WriteFileString(backupPath, `{"director_id":"fake-director-id"}`)
+				Expect(err).ToNot(HaveOccurred())
+				err = fs.Chmod(backupPath, 0600)
+				Expect(err).ToNot(HaveOccurred())
+
+				service = NewFileSystemDeploymentConfigService(fs, fakeUUIDGenerator, fakeTimeService, encryptor, logger)
+				service.SetConfigPath(configPath)
+
+				err = service.RekeyBackups()
+				Expect(err).ToNot(HaveOccurred())
+
+				contents, err := fs.ReadFile(backupPath)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(bicrypto.IsEncrypted(contents)).To(BeTrue())
+
+				fileInfo, err := os.Stat(backupPath)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(fileInfo.Mode().Perm()).To(Equal(os.FileMode(0600)))
+			})
+
+			It("leaves backups encrypted with an unknown key as they are", func() {
+				otherKeyContents, err := fakeFs.ReadFile(otherKeyBackupPath)
+				Expect(err).ToNot(HaveOccurred())
+
+				err = service.RekeyBackups()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(fakeFs.ReadFile(otherKeyBackupPath)).To(Equal(otherKeyContents))
+			})
+		})
+	})
 })
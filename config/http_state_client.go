@@ -0,0 +1,173 @@
+package config
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	bosherr "github.com/cloudfoundry/bosh-agent/errors"
+	boshhttp "github.com/cloudfoundry/bosh-agent/http"
+	boshlog "github.com/cloudfoundry/bosh-agent/logger"
+)
+
+type httpStateClient struct {
+	stateURL   *url.URL
+	httpClient boshhttp.Client
+	logger     boshlog.Logger
+	logTag     string
+
+	// etag is the ETag of the deployment config when it was first read or last written, empty if it did not exist
+	etag string
+	read bool
+}
+
+// NewHTTPStateClient returns a client that GETs and PUTs the deployment config at the URL.
+// PUTs are conditional on the ETag of the first GET or of the last PUT ('If-Match'),
+// or on the deployment config not existing yet ('If-None-Match: *').
+// Later GETs do not change the ETag, so that changes made by another process since the deployment config was first read
+// are not overwritten, even when the command reads the deployment config again before writing it.
+func NewHTTPStateClient(stateURL *url.URL, httpClient boshhttp.Client, logger boshlog.Logger) StateClient {
+	return &httpStateClient{
+		stateURL:   stateURL,
+		httpClient: httpClient,
+		logger:     logger,
+		logTag:     "httpStateClient",
+	}
+}
+
+func (c *httpStateClient) URL() string {
+	return urlWithoutCredentials(c.stateURL)
+}
+
+func (c *httpStateClient) Sibling(suffix string) StateClient {
+	siblingURL := *c.stateURL
+	siblingURL.Path += suffix
+	return NewHTTPStateClient(&siblingURL, c.httpClient, c.logger)
+}
+
+func (c *httpStateClient) Get() ([]byte, bool, error) {
+	body, found, etag, err := c.get()
+	if err != nil {
+		return nil, false, err
+	}
+
+	if !c.read {
+		c.etag = etag
+		c.read = true
+	} else if etag != c.etag {
+		c.logger.Debug(c.logTag, "Deployment config '%s' has ETag '%s', keeping ETag '%s' of the first read", c.URL(), etag, c.etag)
+	}
+
+	return body, found, nil
+}
+
+// get returns the deployment config with its ETag, which is empty if it was not found
+func (c *httpStateClient) get() ([]byte, bool, string, error) {
+	request, err := c.newRequest("GET", nil)
+	if err != nil {
+		return nil, false, "", err
+	}
+
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		return nil, false, "", bosherr.WrapError(err, "Performing GET request")
+	}
+	defer response.Body.Close()
+
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, false, "", bosherr.WrapError(err, "Reading GET response")
+	}
+
+	if response.StatusCode == http.StatusNotFound {
+		return nil, false, "", nil
+	}
+
+	if response.StatusCode != http.StatusOK {
+		return nil, false, "", bosherr.Errorf("GET responded with status %d: %s", response.StatusCode, truncate(body))
+	}
+
+	return body, true, response.Header.Get("ETag"), nil
+}
+
+func (c *httpStateClient) Put(contents []byte) error {
+	request, err := c.newRequest("PUT", contents)
+	if err != nil {
+		return err
+	}
+
+	if c.etag != "" {
+		request.Header.Set("If-Match", c.etag)
+	} else {
+		request.Header.Set("If-None-Match", "*")
+	}
+
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		return bosherr.WrapError(err, "Performing PUT request")
+	}
+	defer response.Body.Close()
+
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return bosherr.WrapError(err, "Reading PUT response")
+	}
+
+	if response.StatusCode == http.StatusPreconditionFailed {
+		return bosherr.Errorf("Deployment config was changed by another process since it was read: PUT responded with status %d", response.StatusCode)
+	}
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return bosherr.Errorf("PUT responded with status %d: %s", response.StatusCode, truncate(body))
+	}
+
+	c.etag = response.Header.Get("ETag")
+	c.read = true
+	if c.etag == "" {
+		// the server did not return the new ETag; read it back so that the next PUT is conditional on it
+		c.logger.Debug(c.logTag, "PUT response has no ETag, getting deployment config '%s'", c.URL())
+		_, _, c.etag, err = c.get()
+		if err != nil {
+			return bosherr.WrapError(err, "Getting the ETag of the deployment config")
+		}
+	}
+
+	return nil
+}
+
+func (c *httpStateClient) newRequest(method string, contents []byte) (*http.Request, error) {
+	requestURL := *c.stateURL
+	requestURL.User = nil
+
+	request, err := http.NewRequest(method, requestURL.String(), bytes.NewReader(contents))
+	if err != nil {
+		return nil, bosherr.WrapErrorf(err, "Creating %s request", method)
+	}
+
+	if c.stateURL.User != nil {
+		password, _ := c.stateURL.User.Password()
+		request.SetBasicAuth(c.stateURL.User.Username(), password)
+	}
+
+	if contents != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	return request, nil
+}
+
+// urlWithoutCredentials returns the URL without user info, so that it can be logged
+func urlWithoutCredentials(stateURL *url.URL) string {
+	displayURL := *stateURL
+	displayURL.User = nil
+	return displayURL.String()
+}
+
+// truncate returns the beginning of a response body, to be included in errors
+func truncate(body []byte) string {
+	if len(body) > 1024 {
+		return string(body[:1024])
+	}
+	return string(body)
+}
@@ -104,7 +104,7 @@ func (m *legacyDeploymentConfigMigrator) migrate(configPath string) (deploymentF
 				return deploymentFile, bosherr.WrapError(err, "Generating UUID")
 			}
 
-			deploymentFile.CurrentDiskID = uuid
+			deploymentFile.CurrentDiskIDs = []string{uuid}
 			deploymentFile.Disks = []DiskRecord{
 				{
 					ID:              uuid,
@@ -117,7 +117,7 @@ func (m *legacyDeploymentConfigMigrator) migrate(configPath string) (deploymentF
 
 		vmCID := instance.VMCID
 		if vmCID != "" {
-			deploymentFile.CurrentVMCID = vmCID
+			deploymentFile.CurrentVMs = []VMRecord{{CID: vmCID}}
 		}
 
 		stemcellCID := instance.StemcellCID
@@ -140,6 +140,11 @@ func (m *legacyDeploymentConfigMigrator) migrate(configPath string) (deploymentF
 					CID:     stemcellCID,
 				},
 			}
+
+			// the vm was created from the stemcell
+			for i := range deploymentFile.CurrentVMs {
+				deploymentFile.CurrentVMs[i].StemcellID = uuid
+			}
 		}
 	}
 
@@ -5,6 +5,7 @@ import (
 	. "github.com/onsi/gomega"
 
 	. "github.com/cloudfoundry/bosh-init/config"
+	bicrypto "github.com/cloudfoundry/bosh-init/crypto"
 
 	//	"encoding/json"
 	//	"errors"
@@ -12,6 +13,7 @@ import (
 	boshlog "github.com/cloudfoundry/bosh-agent/logger"
 
 	fakesys "github.com/cloudfoundry/bosh-agent/system/fakes"
+	faketime "github.com/cloudfoundry/bosh-agent/time/fakes"
 	fakeuuid "github.com/cloudfoundry/bosh-agent/uuid/fakes"
 )
 
@@ -31,7 +33,7 @@ var _ = Describe("legacyDeploymentConfigMigrator", func() {
 		legacyDeploymentConfigFilePath = "/path/to/legacy/bosh-deployment.yml"
 		modernDeploymentConfigFilePath = "/path/to/legacy/deployment.json"
 		logger := boshlog.NewLogger(boshlog.LevelNone)
-		deploymentConfigService = NewFileSystemDeploymentConfigService(fakeFs, fakeUUIDGenerator, logger)
+		deploymentConfigService = NewFileSystemDeploymentConfigService(fakeFs, fakeUUIDGenerator, &faketime.FakeService{}, bicrypto.NewEncryptor(nil), logger)
 		deploymentConfigService.SetConfigPath(modernDeploymentConfigFilePath)
 		migrator = NewLegacyDeploymentConfigMigrator(deploymentConfigService, fakeFs, fakeUUIDGenerator, logger)
 	})
@@ -114,16 +116,19 @@ registry_instances:
 				Expect(err).ToNot(HaveOccurred())
 
 				Expect(content).To(MatchRegexp(`{
+    "schema_version": 2,
     "director_id": "fake-uuid-0",
     "installation_id": "",
-    "current_vm_cid": "",
+    "current_vms": null,
     "current_stemcell_id": "",
-    "current_disk_id": "",
+    "current_disk_ids": null,
     "current_release_ids": null,
     "current_manifest_sha1": "",
+    "current_manifest_fingerprints": null,
     "disks": \[\],
     "stemcells": \[\],
-    "releases": \[\]
+    "releases": \[\],
+    "current_manifest_fingerprint_salt": ""
 }`))
 			})
 		})
@@ -166,19 +171,32 @@ registry_instances:
 				Expect(err).ToNot(HaveOccurred())
 
 				Expect(content).To(MatchRegexp(`{
+    "schema_version": 2,
     "director_id": "fake-uuid-0",
     "installation_id": "",
-    "current_vm_cid": "i-a1624150",
+    "current_vms": \[
+        {
+            "cid": "i-a1624150",
+            "job_name": "",
+            "index": 0,
+            "stemcell_id": "fake-uuid-2"
+        }
+    \],
     "current_stemcell_id": "",
-    "current_disk_id": "fake-uuid-1",
+    "current_disk_ids": \[
+        "fake-uuid-1"
+    \],
     "current_release_ids": null,
     "current_manifest_sha1": "",
+    "current_manifest_fingerprints": null,
     "disks": \[
         {
             "id": "fake-uuid-1",
             "cid": "vol-565ed74d",
             "size": 0,
-            "cloud_properties": {}
+            "cloud_properties": {},
+            "job_name": "",
+            "index": 0
         }
     \],
     "stemcells": \[
@@ -189,7 +207,8 @@ registry_instances:
             "cid": "ami-f2503e9a light"
         }
     \],
-    "releases": \[\]
+    "releases": \[\],
+    "current_manifest_fingerprint_salt": ""
 }`))
 			})
 		})
@@ -232,16 +251,25 @@ registry_instances:
 				Expect(err).ToNot(HaveOccurred())
 
 				Expect(content).To(MatchRegexp(`{
+    "schema_version": 2,
     "director_id": "fake-uuid-0",
     "installation_id": "",
-    "current_vm_cid": "i-a1624150",
+    "current_vms": \[
+        {
+            "cid": "i-a1624150",
+            "job_name": "",
+            "index": 0
+        }
+    \],
     "current_stemcell_id": "",
-    "current_disk_id": "",
+    "current_disk_ids": null,
     "current_release_ids": null,
     "current_manifest_sha1": "",
+    "current_manifest_fingerprints": null,
     "disks": \[\],
     "stemcells": \[\],
-    "releases": \[\]
+    "releases": \[\],
+    "current_manifest_fingerprint_salt": ""
 }`))
 			})
 		})
@@ -284,23 +312,30 @@ registry_instances:
 				Expect(err).ToNot(HaveOccurred())
 
 				Expect(content).To(MatchRegexp(`{
+    "schema_version": 2,
     "director_id": "fake-uuid-0",
     "installation_id": "",
-    "current_vm_cid": "",
+    "current_vms": null,
     "current_stemcell_id": "",
-    "current_disk_id": "fake-uuid-1",
+    "current_disk_ids": \[
+        "fake-uuid-1"
+    \],
     "current_release_ids": null,
     "current_manifest_sha1": "",
+    "current_manifest_fingerprints": null,
     "disks": \[
         {
             "id": "fake-uuid-1",
             "cid": "vol-565ed74d",
             "size": 0,
-            "cloud_properties": {}
+            "cloud_properties": {},
+            "job_name": "",
+            "index": 0
         }
     \],
     "stemcells": \[\],
-    "releases": \[\]
+    "releases": \[\],
+    "current_manifest_fingerprint_salt": ""
 }`))
 			})
 		})
@@ -343,13 +378,15 @@ registry_instances:
 				Expect(err).ToNot(HaveOccurred())
 
 				Expect(content).To(MatchRegexp(`{
+    "schema_version": 2,
     "director_id": "fake-uuid-0",
     "installation_id": "",
-    "current_vm_cid": "",
+    "current_vms": null,
     "current_stemcell_id": "",
-    "current_disk_id": "",
+    "current_disk_ids": null,
     "current_release_ids": null,
     "current_manifest_sha1": "",
+    "current_manifest_fingerprints": null,
     "disks": \[\],
     "stemcells": \[
         {
@@ -359,7 +396,8 @@ registry_instances:
             "cid": "ami-f2503e9a light"
         }
     \],
-    "releases": \[\]
+    "releases": \[\],
+    "current_manifest_fingerprint_salt": ""
 }`))
 			})
 		})
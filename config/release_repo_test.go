@@ -7,8 +7,10 @@ import (
 	"errors"
 	boshlog "github.com/cloudfoundry/bosh-agent/logger"
 	fakesys "github.com/cloudfoundry/bosh-agent/system/fakes"
+	faketime "github.com/cloudfoundry/bosh-agent/time/fakes"
 	fakeuuid "github.com/cloudfoundry/bosh-agent/uuid/fakes"
 	. "github.com/cloudfoundry/bosh-init/config"
+	bicrypto "github.com/cloudfoundry/bosh-init/crypto"
 	"github.com/cloudfoundry/bosh-init/release"
 	fakerelease "github.com/cloudfoundry/bosh-init/release/fakes"
 )
@@ -28,7 +30,7 @@ func rootDesc() {
 		fs = fakesys.NewFakeFileSystem()
 		fakeUUIDGenerator = &fakeuuid.FakeGenerator{}
 		fakeUUIDGenerator.GeneratedUUID = "fake-uuid"
-		configService = NewFileSystemDeploymentConfigService(fs, fakeUUIDGenerator, logger)
+		configService = NewFileSystemDeploymentConfigService(fs, fakeUUIDGenerator, &faketime.FakeService{}, bicrypto.NewEncryptor(nil), logger)
 		configService.SetConfigPath("/fake/path")
 		configService.Load()
 		repo = NewReleaseRepo(configService, fakeUUIDGenerator)
@@ -226,7 +228,7 @@ func rootDesc() {
 
 		Context("when the config service fails to save", func() {
 			BeforeEach(func() {
-				fs.WriteFileError = errors.New("kaboom")
+				fs.OpenFileErr = errors.New("kaboom")
 			})
 
 			It("returns an error", func() {
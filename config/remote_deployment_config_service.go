@@ -0,0 +1,217 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	bosherr "github.com/cloudfoundry/bosh-agent/errors"
+	boshlog "github.com/cloudfoundry/bosh-agent/logger"
+	boshuuid "github.com/cloudfoundry/bosh-agent/uuid"
+
+	bicrypto "github.com/cloudfoundry/bosh-init/crypto"
+)
+
+// StateClient reads and writes the deployment config in a remote store
+type StateClient interface {
+	// Get returns found=false when the deployment config has not been written yet
+	Get() (contents []byte, found bool, err error)
+	Put(contents []byte) error
+
+	// URL returns the URL of the deployment config, without credentials
+	URL() string
+
+	// Sibling returns a client for the object next to the deployment config, whose name has the suffix appended,
+	// e.g. '.schema-v0' for 'deployment.json.schema-v0'
+	Sibling(suffix string) StateClient
+}
+
+type remoteDeploymentConfigService struct {
+	client        StateClient
+	uuidGenerator boshuuid.Generator
+	encryptor     bicrypto.Encryptor
+	logger        boshlog.Logger
+	logTag        string
+
+	// migratedContents are the contents of a config loaded with an older schema version,
+	// backed up to '<url>.schema-v<version>' on the next save
+	migratedContents []byte
+	migratedVersion  int
+
+	readOnly bool
+}
+
+func NewRemoteDeploymentConfigService(client StateClient, uuidGenerator boshuuid.Generator, encryptor bicrypto.Encryptor, logger boshlog.Logger) DeploymentConfigService {
+	return &remoteDeploymentConfigService{
+		client:        client,
+		uuidGenerator: uuidGenerator,
+		encryptor:     encryptor,
+		logger:        logger,
+		logTag:        "remoteConfig",
+	}
+}
+
+// SetConfigPath does nothing: the URL of the deployment config is given to the client
+func (s *remoteDeploymentConfigService) SetConfigPath(path string) {}
+
+func (s *remoteDeploymentConfigService) SetReadOnly() {
+	s.readOnly = true
+}
+
+func (s *remoteDeploymentConfigService) Exists() bool {
+	_, found, err := s.client.Get()
+	if err != nil {
+		s.logger.Warn(s.logTag, "Failed to get deployment config '%s': %s", s.client.URL(), err.Error())
+		return false
+	}
+	return found
+}
+
+func (s *remoteDeploymentConfigService) Load() (DeploymentFile, error) {
+	s.logger.Debug(s.logTag, "Loading deployment config: %s", s.client.URL())
+
+	deploymentFile := &DeploymentFile{SchemaVersion: DeploymentFileSchemaVersion}
+
+	deploymentFileContents, found, err := s.client.Get()
+	if err != nil {
+		return DeploymentFile{}, bosherr.WrapErrorf(err, "Getting deployment config '%s'", s.client.URL())
+	}
+
+	if found {
+		decryptedContents, err := s.encryptor.Decrypt(deploymentFileContents)
+		if err != nil {
+			return DeploymentFile{}, bosherr.WrapErrorf(err, "Decrypting deployment config '%s'", s.client.URL())
+		}
+
+		var schemaVersion int
+		*deploymentFile, schemaVersion, err = unmarshalDeploymentFile(decryptedContents, fmt.Sprintf("deployment config '%s'", s.client.URL()))
+		if err != nil {
+			return DeploymentFile{}, err
+		}
+
+		if schemaVersion < DeploymentFileSchemaVersion && s.migratedContents == nil {
+			s.logger.Info(s.logTag, "Migrated deployment config '%s' from schema version %d to %d", s.client.URL(), schemaVersion, DeploymentFileSchemaVersion)
+			s.migratedContents = deploymentFileContents
+			s.migratedVersion = schemaVersion
+		}
+	}
+
+	err = initDefaults(deploymentFile, s.uuidGenerator, s.saveDefaults)
+	if err != nil {
+		return DeploymentFile{}, bosherr.WrapErrorf(err, "Initializing deployment config defaults")
+	}
+
+	return *deploymentFile, nil
+}
+
+// saveDefaults saves the defaults of a new deployment config, unless it is read only
+func (s *remoteDeploymentConfigService) saveDefaults(deploymentFile DeploymentFile) error {
+	if s.readOnly {
+		return nil
+	}
+	return s.Save(deploymentFile)
+}
+
+func (s *remoteDeploymentConfigService) Save(deploymentFile DeploymentFile) error {
+	if s.readOnly {
+		return bosherr.Errorf("Saving read only deployment config '%s'", s.client.URL())
+	}
+
+	deploymentFile.SchemaVersion = DeploymentFileSchemaVersion
+	s.logger.Debug(s.logTag, "Saving deployment config %#v", deploymentFile)
+
+	jsonContent, err := json.MarshalIndent(deploymentFile, "", "    ")
+	if err != nil {
+		return bosherr.WrapError(err, "Marshalling deployment config into JSON")
+	}
+
+	jsonContent, err = s.encryptor.Encrypt(jsonContent)
+	if err != nil {
+		return bosherr.WrapError(err, "Encrypting deployment config")
+	}
+
+	if s.migratedContents != nil {
+		err = s.backupSchemaVersion()
+		if err != nil {
+			return err
+		}
+		s.migratedContents = nil
+	}
+
+	err = s.client.Put(jsonContent)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Putting deployment config '%s'", s.client.URL())
+	}
+
+	return nil
+}
+
+// backupSchemaVersion puts the config, as it was before it was migrated to the current schema version, next to it at '<url>.schema-v<version>',
+// so that it can be restored to use the config with an older version of bosh-init. An existing backup is kept.
+func (s *remoteDeploymentConfigService) backupSchemaVersion() error {
+	backupClient := s.client.Sibling(fmt.Sprintf(".schema-v%d", s.migratedVersion))
+
+	_, found, err := backupClient.Get()
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Getting deployment config backup '%s'", backupClient.URL())
+	}
+	if found {
+		return nil
+	}
+
+	err = backupClient.Put(s.migratedContents)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Backing up deployment config '%s' with schema version %d to '%s'", s.client.URL(), s.migratedVersion, backupClient.URL())
+	}
+
+	return nil
+}
+
+// Lock does nothing: remote stores do not support lock files.
+// Clients that support it make every write of the command conditional on the deployment config it first read, see NewHTTPStateClient.
+func (s *remoteDeploymentConfigService) Lock() error {
+	return nil
+}
+
+func (s *remoteDeploymentConfigService) Unlock() error {
+	return nil
+}
+
+// RekeyBackups rewrites the schema version backups of the config; remote stores keep no timestamped backups.
+// Backups encrypted with a key that is no longer known are left as they are.
+func (s *remoteDeploymentConfigService) RekeyBackups() error {
+	for version := 0; version < DeploymentFileSchemaVersion; version++ {
+		backupClient := s.client.Sibling(fmt.Sprintf(".schema-v%d", version))
+
+		contents, found, err := backupClient.Get()
+		if err != nil {
+			return bosherr.WrapErrorf(err, "Getting deployment config backup '%s'", backupClient.URL())
+		}
+		if !found {
+			continue
+		}
+
+		decryptedContents, err := s.encryptor.Decrypt(contents)
+		if err != nil {
+			s.logger.Warn(s.logTag, "Not rekeying deployment config backup '%s': %s", backupClient.URL(), err.Error())
+			continue
+		}
+
+		rekeyedContents, err := s.encryptor.Encrypt(decryptedContents)
+		if err != nil {
+			return bosherr.WrapErrorf(err, "Encrypting deployment config backup '%s'", backupClient.URL())
+		}
+
+		if bytes.Equal(rekeyedContents, contents) {
+			continue
+		}
+
+		err = backupClient.Put(rekeyedContents)
+		if err != nil {
+			return bosherr.WrapErrorf(err, "Putting deployment config backup '%s'", backupClient.URL())
+		}
+		s.logger.Debug(s.logTag, "Rekeyed deployment config backup '%s'", backupClient.URL())
+	}
+
+	return nil
+}
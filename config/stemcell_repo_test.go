@@ -6,9 +6,11 @@ import (
 
 	boshlog "github.com/cloudfoundry/bosh-agent/logger"
 	fakesys "github.com/cloudfoundry/bosh-agent/system/fakes"
+	faketime "github.com/cloudfoundry/bosh-agent/time/fakes"
 	fakeuuid "github.com/cloudfoundry/bosh-agent/uuid/fakes"
 
 	. "github.com/cloudfoundry/bosh-init/config"
+	bicrypto "github.com/cloudfoundry/bosh-init/crypto"
 )
 
 var _ = Describe("StemcellRepo", func() {
@@ -23,7 +25,7 @@ var _ = Describe("StemcellRepo", func() {
 		logger := boshlog.NewLogger(boshlog.LevelNone)
 		fs = fakesys.NewFakeFileSystem()
 		fakeUUIDGenerator = &fakeuuid.FakeGenerator{}
-		configService = NewFileSystemDeploymentConfigService(fs, fakeUUIDGenerator, logger)
+		configService = NewFileSystemDeploymentConfigService(fs, fakeUUIDGenerator, &faketime.FakeService{}, bicrypto.NewEncryptor(nil), logger)
 		configService.SetConfigPath("/fake/path")
 		repo = NewStemcellRepo(configService, fakeUUIDGenerator)
 	})
@@ -37,7 +39,8 @@ var _ = Describe("StemcellRepo", func() {
 			Expect(err).ToNot(HaveOccurred())
 
 			expectedConfig := DeploymentFile{
-				DirectorID: "fake-uuid-0",
+				SchemaVersion: DeploymentFileSchemaVersion,
+				DirectorID:    "fake-uuid-0",
 				Stemcells: []StemcellRecord{
 					{
 						ID:      "fake-uuid-1",
@@ -99,7 +102,8 @@ var _ = Describe("StemcellRepo", func() {
 				Expect(err).ToNot(HaveOccurred())
 
 				expectedConfig := DeploymentFile{
-					DirectorID: "fake-uuid-0",
+					SchemaVersion: DeploymentFileSchemaVersion,
+					DirectorID:    "fake-uuid-0",
 					Stemcells: []StemcellRecord{
 						{
 							ID:      "fake-uuid-1",
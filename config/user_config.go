@@ -12,6 +12,10 @@ func (c UserConfig) DeploymentConfigPath() string {
 	return path.Join(path.Dir(c.DeploymentManifestPath), "deployment.json")
 }
 
+func (c UserConfig) VarsStorePath() string {
+	return path.Join(path.Dir(c.DeploymentManifestPath), "vars-store.yml")
+}
+
 func (c UserConfig) LegacyDeploymentConfigPath() string {
 	return path.Join(path.Dir(c.DeploymentManifestPath), "bosh-deployments.yml")
 }
@@ -5,9 +5,9 @@ import (
 )
 
 type VMRepo interface {
-	FindCurrent() (cid string, found bool, err error)
-	UpdateCurrent(cid string) error
-	ClearCurrent() error
+	FindCurrent() ([]VMRecord, error)
+	UpdateCurrent(VMRecord) error
+	ClearCurrent(cid string) error
 }
 
 type vMRepo struct {
@@ -20,27 +20,43 @@ func NewVMRepo(configService DeploymentConfigService) VMRepo {
 	}
 }
 
-func (r vMRepo) FindCurrent() (string, bool, error) {
+func (r vMRepo) FindCurrent() ([]VMRecord, error) {
 	config, err := r.configService.Load()
 	if err != nil {
-		return "", false, bosherr.WrapError(err, "Loading existing config")
+		return []VMRecord{}, bosherr.WrapError(err, "Loading existing config")
 	}
 
-	currentVMCID := config.CurrentVMCID
-	if currentVMCID != "" {
-		return currentVMCID, true, nil
+	if config.CurrentVMs == nil {
+		return []VMRecord{}, nil
 	}
 
-	return "", false, nil
+	return config.CurrentVMs, nil
 }
 
-func (r vMRepo) UpdateCurrent(cid string) error {
+// UpdateCurrent records the vm as the current vm of its instance, replacing any previous one
+func (r vMRepo) UpdateCurrent(record VMRecord) error {
 	config, err := r.configService.Load()
 	if err != nil {
 		return bosherr.WrapError(err, "Loading existing config")
 	}
 
-	config.CurrentVMCID = cid
+	newRecords := []VMRecord{}
+	replaced := false
+	for _, oldRecord := range config.CurrentVMs {
+		if oldRecord.JobName == record.JobName && oldRecord.Index == record.Index {
+			if !replaced {
+				newRecords = append(newRecords, record)
+				replaced = true
+			}
+			continue
+		}
+		newRecords = append(newRecords, oldRecord)
+	}
+	if !replaced {
+		newRecords = append(newRecords, record)
+	}
+
+	config.CurrentVMs = newRecords
 
 	err = r.configService.Save(config)
 	if err != nil {
@@ -49,13 +65,20 @@ func (r vMRepo) UpdateCurrent(cid string) error {
 	return nil
 }
 
-func (r vMRepo) ClearCurrent() error {
+func (r vMRepo) ClearCurrent(cid string) error {
 	config, err := r.configService.Load()
 	if err != nil {
 		return bosherr.WrapError(err, "Loading existing config")
 	}
 
-	config.CurrentVMCID = ""
+	newRecords := []VMRecord{}
+	for _, oldRecord := range config.CurrentVMs {
+		if oldRecord.CID != cid {
+			newRecords = append(newRecords, oldRecord)
+		}
+	}
+
+	config.CurrentVMs = newRecords
 
 	err = r.configService.Save(config)
 	if err != nil {
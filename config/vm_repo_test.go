@@ -6,9 +6,11 @@ import (
 
 	boshlog "github.com/cloudfoundry/bosh-agent/logger"
 	fakesys "github.com/cloudfoundry/bosh-agent/system/fakes"
+	faketime "github.com/cloudfoundry/bosh-agent/time/fakes"
 	fakeuuid "github.com/cloudfoundry/bosh-agent/uuid/fakes"
 
 	. "github.com/cloudfoundry/bosh-init/config"
+	bicrypto "github.com/cloudfoundry/bosh-init/crypto"
 )
 
 var _ = Describe("VMRepo", func() {
@@ -23,68 +25,102 @@ var _ = Describe("VMRepo", func() {
 		logger := boshlog.NewLogger(boshlog.LevelNone)
 		fs = fakesys.NewFakeFileSystem()
 		fakeUUIDGenerator = &fakeuuid.FakeGenerator{}
-		configService = NewFileSystemDeploymentConfigService(fs, fakeUUIDGenerator, logger)
+		configService = NewFileSystemDeploymentConfigService(fs, fakeUUIDGenerator, &faketime.FakeService{}, bicrypto.NewEncryptor(nil), logger)
 		configService.SetConfigPath("/fake/path")
 		repo = NewVMRepo(configService)
 	})
 
 	Describe("FindCurrent", func() {
-		Context("when a current vm cid is set", func() {
+		Context("when current vms are set", func() {
 			BeforeEach(func() {
-				err := repo.UpdateCurrent("fake-vm-cid")
+				err := repo.UpdateCurrent(VMRecord{CID: "fake-vm-cid-1", JobName: "fake-job-name", Index: 0})
 				Expect(err).ToNot(HaveOccurred())
+				err = repo.UpdateCurrent(VMRecord{CID: "fake-vm-cid-2", JobName: "fake-job-name", Index: 1})
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			It("returns the current vm records", func() {
+				records, err := repo.FindCurrent()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(records).To(Equal([]VMRecord{
+					{CID: "fake-vm-cid-1", JobName: "fake-job-name", Index: 0},
+					{CID: "fake-vm-cid-2", JobName: "fake-job-name", Index: 1},
+				}))
 			})
+		})
 
-			It("returns current manifest sha1", func() {
-				record, found, err := repo.FindCurrent()
+		Context("when no current vm is set", func() {
+			It("returns no records", func() {
+				records, err := repo.FindCurrent()
 				Expect(err).ToNot(HaveOccurred())
-				Expect(found).To(BeTrue())
-				Expect(record).To(Equal("fake-vm-cid"))
+				Expect(records).To(BeEmpty())
 			})
 		})
 
-		Context("when a current vm cid is not set", func() {
-			It("returns false", func() {
-				_, found, err := repo.FindCurrent()
+		Context("when the config was written with a single current vm cid", func() {
+			BeforeEach(func() {
+				err := fs.WriteFileString("/fake/path", `{"director_id":"fake-director-id","current_vm_cid":"fake-vm-cid"}`)
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			It("returns it as the vm of index 0, without a job name", func() {
+				records, err := repo.FindCurrent()
 				Expect(err).ToNot(HaveOccurred())
-				Expect(found).To(BeFalse())
+				Expect(records).To(Equal([]VMRecord{{CID: "fake-vm-cid"}}))
 			})
 		})
 	})
 
 	Describe("UpdateCurrent", func() {
 		It("updates vm cid", func() {
-			err := repo.UpdateCurrent("fake-vm-cid")
+			err := repo.UpdateCurrent(VMRecord{CID: "fake-vm-cid", JobName: "fake-job-name", Index: 0})
 			Expect(err).ToNot(HaveOccurred())
 
 			deploymentConfig, err := configService.Load()
 			Expect(err).ToNot(HaveOccurred())
 
 			expectedConfig := DeploymentFile{
-				DirectorID:   "fake-uuid-0",
-				CurrentVMCID: "fake-vm-cid",
+				SchemaVersion: DeploymentFileSchemaVersion,
+				DirectorID:    "fake-uuid-0",
+				CurrentVMs: []VMRecord{
+					{CID: "fake-vm-cid", JobName: "fake-job-name", Index: 0},
+				},
 			}
 			Expect(deploymentConfig).To(Equal(expectedConfig))
 		})
+
+		It("replaces the vm of the same instance", func() {
+			err := repo.UpdateCurrent(VMRecord{CID: "fake-vm-cid-1", JobName: "fake-job-name", Index: 0})
+			Expect(err).ToNot(HaveOccurred())
+			err = repo.UpdateCurrent(VMRecord{CID: "fake-other-vm-cid", JobName: "fake-other-job-name", Index: 0})
+			Expect(err).ToNot(HaveOccurred())
+			err = repo.UpdateCurrent(VMRecord{CID: "fake-vm-cid-2", JobName: "fake-job-name", Index: 0})
+			Expect(err).ToNot(HaveOccurred())
+
+			records, err := repo.FindCurrent()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(records).To(Equal([]VMRecord{
+				{CID: "fake-vm-cid-2", JobName: "fake-job-name", Index: 0},
+				{CID: "fake-other-vm-cid", JobName: "fake-other-job-name", Index: 0},
+			}))
+		})
 	})
 
 	Describe("ClearCurrent", func() {
-		It("updates vm cid", func() {
-			err := repo.ClearCurrent()
+		It("removes the vm with the given cid", func() {
+			err := repo.UpdateCurrent(VMRecord{CID: "fake-vm-cid-1", JobName: "fake-job-name", Index: 0})
 			Expect(err).ToNot(HaveOccurred())
-
-			deploymentConfig, err := configService.Load()
+			err = repo.UpdateCurrent(VMRecord{CID: "fake-vm-cid-2", JobName: "fake-job-name", Index: 1})
 			Expect(err).ToNot(HaveOccurred())
 
-			expectedConfig := DeploymentFile{
-				DirectorID:   "fake-uuid-0",
-				CurrentVMCID: "",
-			}
-			Expect(deploymentConfig).To(Equal(expectedConfig))
+			err = repo.ClearCurrent("fake-vm-cid-1")
+			Expect(err).ToNot(HaveOccurred())
 
-			_, found, err := repo.FindCurrent()
+			records, err := repo.FindCurrent()
 			Expect(err).ToNot(HaveOccurred())
-			Expect(found).To(BeFalse())
+			Expect(records).To(Equal([]VMRecord{
+				{CID: "fake-vm-cid-2", JobName: "fake-job-name", Index: 1},
+			}))
 		})
 	})
 })
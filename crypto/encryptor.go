@@ -0,0 +1,177 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	bosherr "github.com/cloudfoundry/bosh-agent/errors"
+	boshsys "github.com/cloudfoundry/bosh-agent/system"
+)
+
+const (
+	// StateKeyEnv is the environment variable with the key of the deployment state, vars store and rendered templates
+	StateKeyEnv = "BOSH_INIT_STATE_KEY"
+
+	// StateKeyFileEnv is the environment variable with the path of a file containing the key, used when StateKeyEnv is not set
+	StateKeyFileEnv = "BOSH_INIT_STATE_KEY_FILE"
+)
+
+// encryptedHeader starts encrypted contents. It is followed by the key ID and a new line, then the nonce and the sealed contents.
+const encryptedHeader = "bosh-init-encrypted:v1:"
+
+const keyIDLength = 8
+
+type Encryptor interface {
+	// HasKey returns false if no key is set, in which case contents are not encrypted
+	HasKey() bool
+
+	// SetKey replaces the key contents are encrypted with, or disables encryption if the key is empty.
+	// Contents encrypted with the previous keys can still be decrypted, so that they can be encrypted again with the new key.
+	SetKey(key []byte)
+
+	// Encrypt returns the contents encrypted and authenticated with AES-256-GCM, or the contents unchanged if no key is set
+	Encrypt(contents []byte) ([]byte, error)
+
+	// Decrypt returns the decrypted contents, or the contents unchanged if they are not encrypted
+	Decrypt(contents []byte) ([]byte, error)
+}
+
+type encryptor struct {
+	keyID string
+
+	// aeads are the ciphers of the current and previous keys, by key ID
+	aeads map[string]cipher.AEAD
+}
+
+// NewEncryptor returns an Encryptor with the key, which may be empty to not encrypt.
+// The AES key is derived from the key with SHA-256, so the key should be random (e.g. 'openssl rand -hex 32').
+func NewEncryptor(key []byte) Encryptor {
+	e := &encryptor{
+		aeads: map[string]cipher.AEAD{},
+	}
+	e.SetKey(key)
+	return e
+}
+
+// IsEncrypted returns true if the contents were encrypted by an Encryptor
+func IsEncrypted(contents []byte) bool {
+	return bytes.HasPrefix(contents, []byte(encryptedHeader))
+}
+
+// LoadKey returns the key, or the contents of the key file if the key is empty.
+// Surrounding white space is removed. It returns nil if neither is given.
+func LoadKey(fs boshsys.FileSystem, key string, keyFile string) ([]byte, error) {
+	if key != "" && keyFile != "" {
+		return nil, bosherr.Errorf("Expected only one of %s and %s to be set", StateKeyEnv, StateKeyFileEnv)
+	}
+
+	if key != "" {
+		return []byte(strings.TrimSpace(key)), nil
+	}
+
+	if keyFile == "" {
+		return nil, nil
+	}
+
+	contents, err := fs.ReadFile(keyFile)
+	if err != nil {
+		return nil, bosherr.WrapErrorf(err, "Reading key file '%s'", keyFile)
+	}
+
+	contents = bytes.TrimSpace(contents)
+	if len(contents) == 0 {
+		return nil, bosherr.Errorf("Key file '%s' is empty", keyFile)
+	}
+
+	return contents, nil
+}
+
+func (e *encryptor) HasKey() bool {
+	return e.keyID != ""
+}
+
+func (e *encryptor) SetKey(key []byte) {
+	if len(key) == 0 {
+		e.keyID = ""
+		return
+	}
+
+	aesKey := sha256.Sum256(append([]byte("bosh-init state encryption key:"), key...))
+	block, err := aes.NewCipher(aesKey[:])
+	if err != nil {
+		// only possible with an invalid key size
+		panic(err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		panic(err)
+	}
+
+	e.keyID = keyID(key)
+	e.aeads[e.keyID] = aead
+}
+
+func (e *encryptor) Encrypt(contents []byte) ([]byte, error) {
+	if !e.HasKey() {
+		return contents, nil
+	}
+
+	aead := e.aeads[e.keyID]
+
+	nonce := make([]byte, aead.NonceSize())
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return nil, bosherr.WrapError(err, "Generating nonce")
+	}
+
+	header := []byte(encryptedHeader + e.keyID + "\n")
+
+	encrypted := append(header, nonce...)
+	return aead.Seal(encrypted, nonce, contents, header), nil
+}
+
+func (e *encryptor) Decrypt(contents []byte) ([]byte, error) {
+	if !IsEncrypted(contents) {
+		return contents, nil
+	}
+
+	headerLength := len(encryptedHeader) + keyIDLength + 1
+	if len(contents) < headerLength || contents[headerLength-1] != '\n' {
+		return nil, bosherr.Error("Decrypting contents: invalid header")
+	}
+
+	header := contents[:headerLength]
+	contentsKeyID := string(header[len(encryptedHeader) : headerLength-1])
+
+	aead, found := e.aeads[contentsKeyID]
+	if !found {
+		if !e.HasKey() {
+			return nil, bosherr.Errorf("Contents are encrypted with key ID '%s' but no key is set: set %s or %s", contentsKeyID, StateKeyEnv, StateKeyFileEnv)
+		}
+		return nil, bosherr.Errorf("Contents are encrypted with key ID '%s' but the key has ID '%s': set %s or %s to the key the contents were encrypted with", contentsKeyID, e.keyID, StateKeyEnv, StateKeyFileEnv)
+	}
+
+	sealed := contents[headerLength:]
+	if len(sealed) < aead.NonceSize() {
+		return nil, bosherr.Errorf("Decrypting contents with key ID '%s': contents are truncated", contentsKeyID)
+	}
+
+	decrypted, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], header)
+	if err != nil {
+		return nil, bosherr.Errorf("Decrypting contents with key ID '%s': contents were modified or corrupted", contentsKeyID)
+	}
+
+	return decrypted, nil
+}
+
+// keyID identifies the key in encrypted contents, so that a wrong key can be told apart from modified contents
+func keyID(key []byte) string {
+	sum := sha256.Sum256(append([]byte("bosh-init state key id:"), key...))
+	return hex.EncodeToString(sum[:])[:keyIDLength]
+}
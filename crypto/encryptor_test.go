@@ -0,0 +1,183 @@
+package crypto_test
+
+import (
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	fakesys "github.com/cloudfoundry/bosh-agent/system/fakes"
+
+	. "github.com/cloudfoundry/bosh-init/crypto"
+)
+
+var _ = Describe("Encryptor", func() {
+	var (
+		encryptor Encryptor
+	)
+
+	BeforeEach(func() {
+		encryptor = NewEncryptor([]byte("fake-key"))
+	})
+
+	Describe("Encrypt", func() {
+		It("encrypts the contents so that they can be decrypted with the same key", func() {
+			encrypted, err := encryptor.Encrypt([]byte("fake-secret-contents"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(encrypted)).ToNot(ContainSubstring("fake-secret-contents"))
+			Expect(IsEncrypted(encrypted)).To(BeTrue())
+
+			decrypted, err := NewEncryptor([]byte("fake-key")).Decrypt(encrypted)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(decrypted)).To(Equal("fake-secret-contents"))
+		})
+
+		It("uses a new nonce each time", func() {
+			encrypted, err := encryptor.Encrypt([]byte("fake-secret-contents"))
+			Expect(err).ToNot(HaveOccurred())
+			otherEncrypted, err := encryptor.Encrypt([]byte("fake-secret-contents"))
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(encrypted).ToNot(Equal(otherEncrypted))
+		})
+
+		It("returns the contents unchanged when there is no key", func() {
+			encryptor = NewEncryptor(nil)
+			Expect(encryptor.HasKey()).To(BeFalse())
+
+			encrypted, err := encryptor.Encrypt([]byte("fake-contents"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(encrypted)).To(Equal("fake-contents"))
+		})
+	})
+
+	Describe("Decrypt", func() {
+		var encrypted []byte
+
+		BeforeEach(func() {
+			var err error
+			encrypted, err = encryptor.Encrypt([]byte("fake-secret-contents"))
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("returns contents that are not encrypted unchanged", func() {
+			decrypted, err := encryptor.Decrypt([]byte(`{"director_id":"fake-director-id"}`))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(decrypted)).To(Equal(`{"director_id":"fake-director-id"}`))
+		})
+
+		It("returns an error when there is no key", func() {
+			_, err := NewEncryptor(nil).Decrypt(encrypted)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("but no key is set: set BOSH_INIT_STATE_KEY or BOSH_INIT_STATE_KEY_FILE"))
+		})
+
+		It("returns an error when the key is wrong", func() {
+			_, err := NewEncryptor([]byte("fake-other-key")).Decrypt(encrypted)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("but the key has ID"))
+		})
+
+		It("returns an error when the contents were modified", func() {
+			encrypted[len(encrypted)-1] ^= 1
+
+			_, err := encryptor.Decrypt(encrypted)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("contents were modified or corrupted"))
+		})
+
+		It("returns an error when the key ID was modified", func() {
+			otherEncrypted, err := NewEncryptor([]byte("fake-other-key")).Encrypt([]byte("fake-secret-contents"))
+			Expect(err).ToNot(HaveOccurred())
+
+			copy(otherEncrypted, encrypted[:len("bosh-init-encrypted:v1:")+9])
+
+			_, err = encryptor.Decrypt(otherEncrypted)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("contents were modified or corrupted"))
+		})
+	})
+
+	Describe("SetKey", func() {
+		It("encrypts with the new key and still decrypts contents encrypted with the previous key", func() {
+			encrypted, err := encryptor.Encrypt([]byte("fake-secret-contents"))
+			Expect(err).ToNot(HaveOccurred())
+
+			encryptor.SetKey([]byte("fake-new-key"))
+
+			decrypted, err := encryptor.Decrypt(encrypted)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(decrypted)).To(Equal("fake-secret-contents"))
+
+			reencrypted, err := encryptor.Encrypt(decrypted)
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = NewEncryptor([]byte("fake-key")).Decrypt(reencrypted)
+			Expect(err).To(HaveOccurred())
+
+			decrypted, err = NewEncryptor([]byte("fake-new-key")).Decrypt(reencrypted)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(decrypted)).To(Equal("fake-secret-contents"))
+		})
+
+		It("disables encryption with an empty key", func() {
+			encryptor.SetKey(nil)
+			Expect(encryptor.HasKey()).To(BeFalse())
+
+			encrypted, err := encryptor.Encrypt([]byte("fake-contents"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(encrypted)).To(Equal("fake-contents"))
+		})
+	})
+
+	Describe("LoadKey", func() {
+		var fs *fakesys.FakeFileSystem
+
+		BeforeEach(func() {
+			fs = fakesys.NewFakeFileSystem()
+		})
+
+		It("returns the key", func() {
+			key, err := LoadKey(fs, "fake-key\n", "")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(key)).To(Equal("fake-key"))
+		})
+
+		It("returns the contents of the key file", func() {
+			fs.WriteFileString("/fake-key-file", "fake-key\n")
+
+			key, err := LoadKey(fs, "", "/fake-key-file")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(key)).To(Equal("fake-key"))
+		})
+
+		It("returns no key when neither is given", func() {
+			key, err := LoadKey(fs, "", "")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(key).To(BeNil())
+		})
+
+		It("returns an error when both are given", func() {
+			_, err := LoadKey(fs, "fake-key", "/fake-key-file")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Expected only one of BOSH_INIT_STATE_KEY and BOSH_INIT_STATE_KEY_FILE to be set"))
+		})
+
+		It("returns an error when the key file is empty", func() {
+			fs.WriteFileString("/fake-key-file", "\n")
+
+			_, err := LoadKey(fs, "", "/fake-key-file")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Key file '/fake-key-file' is empty"))
+		})
+
+		It("returns an error when the key file cannot be read", func() {
+			fs.WriteFileString("/fake-key-file", "fake-key")
+			fs.ReadFileError = errors.New("fake-read-error")
+
+			_, err := LoadKey(fs, "", "/fake-key-file")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("fake-read-error"))
+		})
+	})
+})
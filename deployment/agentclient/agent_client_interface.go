@@ -15,6 +15,7 @@ type AgentClient interface {
 	ListDisk() ([]string, error)
 	MigrateDisk() error
 	CompilePackage(packageSource BlobRef, compiledPackageDependencies []BlobRef) (compiledPackageRef BlobRef, err error)
+	RunErrand() (ErrandResult, error)
 }
 
 type AgentState struct {
@@ -27,3 +28,9 @@ type BlobRef struct {
 	BlobstoreID string
 	SHA1        string
 }
+
+type ErrandResult struct {
+	ExitStatus int
+	Stdout     string
+	Stderr     string
+}
@@ -33,6 +33,10 @@ type FakeAgentClient struct {
 
 	MigrateDiskCalledTimes int
 	migrateDiskErr         error
+
+	RunErrandCalledTimes int
+	runErrandResult      biagentclient.ErrandResult
+	runErrandErr         error
 }
 
 type pingResponse struct {
@@ -114,6 +118,11 @@ func (c *FakeAgentClient) MigrateDisk() error {
 	return c.migrateDiskErr
 }
 
+func (c *FakeAgentClient) RunErrand() (biagentclient.ErrandResult, error) {
+	c.RunErrandCalledTimes++
+	return c.runErrandResult, c.runErrandErr
+}
+
 func (c *FakeAgentClient) CompilePackage(
 	packageSource biagentclient.BlobRef,
 	compiledPackageDependencies []biagentclient.BlobRef,
@@ -158,6 +167,11 @@ func (c *FakeAgentClient) SetMigrateDiskBehavior(err error) {
 	c.migrateDiskErr = err
 }
 
+func (c *FakeAgentClient) SetRunErrandBehavior(result biagentclient.ErrandResult, err error) {
+	c.runErrandResult = result
+	c.runErrandErr = err
+}
+
 func (c *FakeAgentClient) SetListDiskBehavior(disks []string, err error) {
 	c.listDiskDisks = disks
 	c.listDiskErr = err
@@ -7,9 +7,11 @@ import (
 	bosherr "github.com/cloudfoundry/bosh-agent/errors"
 	boshlog "github.com/cloudfoundry/bosh-agent/logger"
 	boshretry "github.com/cloudfoundry/bosh-agent/retrystrategy"
+	boshuuid "github.com/cloudfoundry/bosh-agent/uuid"
 	biagentclient "github.com/cloudfoundry/bosh-init/deployment/agentclient"
 	bias "github.com/cloudfoundry/bosh-init/deployment/applyspec"
 	bihttpclient "github.com/cloudfoundry/bosh-init/deployment/httpclient"
+	binatsclient "github.com/cloudfoundry/bosh-init/deployment/natsclient"
 )
 
 type agentClient struct {
@@ -26,9 +28,8 @@ func NewAgentClient(
 	httpClient bihttpclient.HTTPClient,
 	logger boshlog.Logger,
 ) biagentclient.AgentClient {
-	// if this were NATS, we would need the agentID, but since it's http, the endpoint is unique to the agent
 	agentEndpoint := fmt.Sprintf("%s/agent", endpoint)
-	agentRequest := agentRequest{
+	agentRequest := httpAgentRequest{
 		directorID: directorID,
 		endpoint:   agentEndpoint,
 		httpClient: httpClient,
@@ -41,6 +42,29 @@ func NewAgentClient(
 	}
 }
 
+func NewNATSAgentClient(
+	natsClient binatsclient.NATSClient,
+	agentID string,
+	directorID string,
+	getTaskDelay time.Duration,
+	uuidGenerator boshuuid.Generator,
+	logger boshlog.Logger,
+) biagentclient.AgentClient {
+	// over NATS all agents share the bus, so each request is addressed to the agent by its ID
+	agentRequest := natsAgentRequest{
+		agentID:       agentID,
+		directorID:    directorID,
+		natsClient:    natsClient,
+		uuidGenerator: uuidGenerator,
+	}
+	return &agentClient{
+		agentRequest: agentRequest,
+		getTaskDelay: getTaskDelay,
+		logger:       logger,
+		logTag:       "natsAgentClient",
+	}
+}
+
 func (c *agentClient) Ping() (string, error) {
 	var response SimpleTaskResponse
 	err := c.agentRequest.Send("ping", []interface{}{}, &response)
@@ -113,6 +137,35 @@ func (c *agentClient) MigrateDisk() error {
 	return err
 }
 
+func (c *agentClient) RunErrand() (biagentclient.ErrandResult, error) {
+	responseValue, err := c.sendAsyncTaskMessage("run_errand", []interface{}{})
+	if err != nil {
+		return biagentclient.ErrandResult{}, bosherr.WrapError(err, "Sending 'run_errand' to the agent")
+	}
+
+	// json numbers are unmarshalled as float64
+	exitStatus, ok := responseValue["exit_code"].(float64)
+	if !ok {
+		return biagentclient.ErrandResult{}, bosherr.Errorf("Unable to parse 'run_errand' response from the agent: %#v", responseValue)
+	}
+
+	stdout, ok := responseValue["stdout"].(string)
+	if !ok {
+		return biagentclient.ErrandResult{}, bosherr.Errorf("Unable to parse 'run_errand' response from the agent: %#v", responseValue)
+	}
+
+	stderr, ok := responseValue["stderr"].(string)
+	if !ok {
+		return biagentclient.ErrandResult{}, bosherr.Errorf("Unable to parse 'run_errand' response from the agent: %#v", responseValue)
+	}
+
+	return biagentclient.ErrandResult{
+		ExitStatus: int(exitStatus),
+		Stdout:     stdout,
+		Stderr:     stderr,
+	}, nil
+}
+
 func (c *agentClient) sendAsyncTaskMessage(method string, arguments []interface{}) (value map[string]interface{}, err error) {
 	var response TaskResponse
 	err = c.agentRequest.Send(method, arguments, &response)
@@ -1,33 +1,95 @@
 package http
 
 import (
+	"sync"
 	"time"
 
+	bosherr "github.com/cloudfoundry/bosh-agent/errors"
 	boshlog "github.com/cloudfoundry/bosh-agent/logger"
+	boshuuid "github.com/cloudfoundry/bosh-agent/uuid"
 	biagentclient "github.com/cloudfoundry/bosh-init/deployment/agentclient"
 	bihttpclient "github.com/cloudfoundry/bosh-init/deployment/httpclient"
+	binatsclient "github.com/cloudfoundry/bosh-init/deployment/natsclient"
+	biinstallmanifest "github.com/cloudfoundry/bosh-init/installation/manifest"
 )
 
 type AgentClientFactory interface {
-	NewAgentClient(directorID, mbusURL string) biagentclient.AgentClient
+	NewAgentClient(directorID, mbusURL, agentID string, cert biinstallmanifest.Cert) (biagentclient.AgentClient, error)
+
+	// Close closes the NATS connections shared by the agent clients created so far
+	Close() error
 }
 
 type agentClientFactory struct {
-	getTaskDelay time.Duration
-	logger       boshlog.Logger
+	getTaskDelay  time.Duration
+	natsTimeout   time.Duration
+	uuidGenerator boshuuid.Generator
+	logger        boshlog.Logger
+
+	natsClientsLock sync.Mutex
+	natsClients     map[string]binatsclient.NATSClient
 }
 
 func NewAgentClientFactory(
 	getTaskDelay time.Duration,
+	natsTimeout time.Duration,
+	uuidGenerator boshuuid.Generator,
 	logger boshlog.Logger,
 ) AgentClientFactory {
 	return &agentClientFactory{
-		getTaskDelay: getTaskDelay,
-		logger:       logger,
+		getTaskDelay:  getTaskDelay,
+		natsTimeout:   natsTimeout,
+		uuidGenerator: uuidGenerator,
+		logger:        logger,
+		natsClients:   map[string]binatsclient.NATSClient{},
+	}
+}
+
+// NewAgentClient picks the transport from the scheme of the mbus URL.
+// nats:// URLs address the agent by its ID on the shared bus, any other URL is the agent's own https endpoint,
+// whose certificate is verified with the CA certificate of cert.
+func (f *agentClientFactory) NewAgentClient(directorID, mbusURL, agentID string, cert biinstallmanifest.Cert) (biagentclient.AgentClient, error) {
+	if binatsclient.IsNATSURL(mbusURL) {
+		return NewNATSAgentClient(f.natsClient(mbusURL), agentID, directorID, f.getTaskDelay, f.uuidGenerator, f.logger), nil
+	}
+
+	client, err := bihttpclient.NewClient(cert.CA, cert.Certificate, cert.PrivateKey)
+	if err != nil {
+		return nil, bosherr.WrapError(err, "Creating agent http client")
+	}
+
+	httpClient := bihttpclient.NewHTTPClient(client, f.logger)
+	return NewAgentClient(mbusURL, directorID, f.getTaskDelay, httpClient, f.logger), nil
+}
+
+// natsClient shares one connection per NATS server between all agent clients
+func (f *agentClientFactory) natsClient(natsURL string) binatsclient.NATSClient {
+	f.natsClientsLock.Lock()
+	defer f.natsClientsLock.Unlock()
+
+	natsClient, found := f.natsClients[natsURL]
+	if !found {
+		natsClient = binatsclient.NewNATSClient(natsURL, f.natsTimeout, f.logger)
+		f.natsClients[natsURL] = natsClient
 	}
+	return natsClient
 }
 
-func (f *agentClientFactory) NewAgentClient(directorID, mbusURL string) biagentclient.AgentClient {
-	httpClient := bihttpclient.NewHTTPClient(f.logger)
-	return NewAgentClient(mbusURL, directorID, f.getTaskDelay, httpClient, f.logger)
+func (f *agentClientFactory) Close() error {
+	f.natsClientsLock.Lock()
+	defer f.natsClientsLock.Unlock()
+
+	errs := []error{}
+	for natsURL, natsClient := range f.natsClients {
+		err := natsClient.Close()
+		if err != nil {
+			errs = append(errs, err)
+		}
+		delete(f.natsClients, natsURL)
+	}
+
+	if len(errs) > 0 {
+		return bosherr.WrapError(bosherr.NewMultiError(errs...), "Closing NATS connections")
+	}
+	return nil
 }
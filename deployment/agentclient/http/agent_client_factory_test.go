@@ -0,0 +1,127 @@
+package http_test
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/cloudfoundry/bosh-init/deployment/agentclient/http"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	boshlog "github.com/cloudfoundry/bosh-agent/logger"
+	fakeuuid "github.com/cloudfoundry/bosh-agent/uuid/fakes"
+	biinstallmanifest "github.com/cloudfoundry/bosh-init/installation/manifest"
+	bitestutils "github.com/cloudfoundry/bosh-init/testutils"
+
+	fakebinatsclient "github.com/cloudfoundry/bosh-init/deployment/natsclient/fakes"
+)
+
+var _ = Describe("AgentClientFactory", func() {
+	var (
+		agentClientFactory AgentClientFactory
+	)
+
+	BeforeEach(func() {
+		logger := boshlog.NewLogger(boshlog.LevelNone)
+		agentClientFactory = NewAgentClientFactory(0, 1*time.Second, &fakeuuid.FakeGenerator{}, logger)
+	})
+
+	Context("when the mbus URL is a NATS URL", func() {
+		var fakeNATSServer *fakebinatsclient.FakeNATSServer
+
+		BeforeEach(func() {
+			fakeNATSServer = fakebinatsclient.NewFakeNATSServer()
+			err := fakeNATSServer.Start()
+			Expect(err).ToNot(HaveOccurred())
+
+			fakeNATSServer.RegisterHandler("agent.fake-agent-id", func(payload []byte) []byte {
+				return []byte(`{"value":"pong"}`)
+			})
+		})
+
+		AfterEach(func() {
+			fakeNATSServer.Stop()
+		})
+
+		It("creates an agent client that reaches the agent over NATS by its ID", func() {
+			agentClient, err := agentClientFactory.NewAgentClient("fake-director-id", fakeNATSServer.URL(), "fake-agent-id", biinstallmanifest.Cert{})
+			Expect(err).ToNot(HaveOccurred())
+
+			response, err := agentClient.Ping()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(response).To(Equal("pong"))
+			Expect(fakeNATSServer.PublishedMessages()[0].Subject).To(Equal("agent.fake-agent-id"))
+		})
+
+		It("closes the NATS connection shared by the agent clients on Close", func() {
+			agentClient, err := agentClientFactory.NewAgentClient("fake-director-id", fakeNATSServer.URL(), "fake-agent-id", biinstallmanifest.Cert{})
+			Expect(err).ToNot(HaveOccurred())
+			otherAgentClient, err := agentClientFactory.NewAgentClient("fake-director-id", fakeNATSServer.URL(), "fake-agent-id", biinstallmanifest.Cert{})
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = agentClient.Ping()
+			Expect(err).ToNot(HaveOccurred())
+			_, err = otherAgentClient.Ping()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fakeNATSServer.ConnectionCount()).To(Equal(1))
+
+			err = agentClientFactory.Close()
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(fakeNATSServer.ConnectionCount).Should(Equal(0))
+		})
+	})
+
+	Context("when the mbus URL is an https URL", func() {
+		var (
+			agentServer *httptest.Server
+			caCert      string
+		)
+
+		BeforeEach(func() {
+			var serverKey string
+			var err error
+			caCert, serverKey, err = bitestutils.GenerateCertificate("fake-agent")
+			Expect(err).ToNot(HaveOccurred())
+
+			keyPair, err := tls.X509KeyPair([]byte(caCert), []byte(serverKey))
+			Expect(err).ToNot(HaveOccurred())
+
+			agentServer = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(`{"value":"pong"}`))
+			}))
+			agentServer.TLS = &tls.Config{Certificates: []tls.Certificate{keyPair}}
+			agentServer.StartTLS()
+		})
+
+		AfterEach(func() {
+			agentServer.Close()
+		})
+
+		It("creates an agent client that verifies the agent certificate with the CA certificate", func() {
+			agentClient, err := agentClientFactory.NewAgentClient("fake-director-id", agentServer.URL, "fake-agent-id", biinstallmanifest.Cert{CA: caCert})
+			Expect(err).ToNot(HaveOccurred())
+
+			response, err := agentClient.Ping()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(response).To(Equal("pong"))
+		})
+
+		It("creates an agent client that fails to reach an agent with an untrusted certificate", func() {
+			agentClient, err := agentClientFactory.NewAgentClient("fake-director-id", agentServer.URL, "fake-agent-id", biinstallmanifest.Cert{})
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = agentClient.Ping()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Verifying TLS certificate of '" + agentServer.Listener.Addr().String() + "' failed"))
+		})
+
+		It("returns an error when the CA certificate is invalid", func() {
+			_, err := agentClientFactory.NewAgentClient("fake-director-id", agentServer.URL, "fake-agent-id", biinstallmanifest.Cert{CA: "fake-ca-cert"})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Creating agent http client"))
+		})
+	})
+})
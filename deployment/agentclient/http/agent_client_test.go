@@ -628,4 +628,54 @@ var _ = Describe("AgentClient", func() {
 			}))
 		})
 	})
+
+	Describe("RunErrand", func() {
+		Context("when the agent responds with the errand result", func() {
+			BeforeEach(func() {
+				fakeHTTPClient.SetPostBehavior(`{"value":{"agent_task_id":"fake-agent-task-id","state":"running"}}`, 200, nil)
+				fakeHTTPClient.SetPostBehavior(`{"value":{"agent_task_id":"fake-agent-task-id","state":"running"}}`, 200, nil)
+				fakeHTTPClient.SetPostBehavior(`{"value":{"exit_code":3,"stdout":"fake-stdout","stderr":"fake-stderr"}}`, 200, nil)
+			})
+
+			It("makes a run_errand request and waits for the task to be done", func() {
+				_, err := agentClient.RunErrand()
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(fakeHTTPClient.PostInputs).To(HaveLen(3))
+
+				var request AgentRequestMessage
+				err = json.Unmarshal(fakeHTTPClient.PostInputs[0].Payload, &request)
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(request).To(Equal(AgentRequestMessage{
+					Method:    "run_errand",
+					Arguments: []interface{}{},
+					ReplyTo:   "fake-uuid",
+				}))
+			})
+
+			It("returns the exit status and output of the errand", func() {
+				result, err := agentClient.RunErrand()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(result).To(Equal(biagentclient.ErrandResult{
+					ExitStatus: 3,
+					Stdout:     "fake-stdout",
+					Stderr:     "fake-stderr",
+				}))
+			})
+		})
+
+		Context("when the agent response cannot be parsed", func() {
+			BeforeEach(func() {
+				fakeHTTPClient.SetPostBehavior(`{"value":{"agent_task_id":"fake-agent-task-id","state":"running"}}`, 200, nil)
+				fakeHTTPClient.SetPostBehavior(`{"value":{"stdout":"fake-stdout"}}`, 200, nil)
+			})
+
+			It("returns an error", func() {
+				_, err := agentClient.RunErrand()
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("Unable to parse 'run_errand' response from the agent"))
+			})
+		})
+	})
 })
@@ -2,11 +2,14 @@ package http
 
 import (
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 
 	bosherr "github.com/cloudfoundry/bosh-agent/errors"
+	boshuuid "github.com/cloudfoundry/bosh-agent/uuid"
 	bihttpclient "github.com/cloudfoundry/bosh-init/deployment/httpclient"
+	binatsclient "github.com/cloudfoundry/bosh-init/deployment/natsclient"
 )
 
 type AgentRequestMessage struct {
@@ -15,13 +18,17 @@ type AgentRequestMessage struct {
 	ReplyTo   string        `json:"reply_to"`
 }
 
-type agentRequest struct {
+type agentRequest interface {
+	Send(method string, arguments []interface{}, response Response) error
+}
+
+type httpAgentRequest struct {
 	directorID string
 	endpoint   string
 	httpClient bihttpclient.HTTPClient
 }
 
-func (r agentRequest) Send(method string, arguments []interface{}, response Response) error {
+func (r httpAgentRequest) Send(method string, arguments []interface{}, response Response) error {
 	postBody := AgentRequestMessage{
 		Method:    method,
 		Arguments: arguments,
@@ -60,3 +67,52 @@ func (r agentRequest) Send(method string, arguments []interface{}, response Resp
 
 	return nil
 }
+
+type natsAgentRequest struct {
+	agentID       string
+	directorID    string
+	natsClient    binatsclient.NATSClient
+	uuidGenerator boshuuid.Generator
+}
+
+func (r natsAgentRequest) Send(method string, arguments []interface{}, response Response) error {
+	if r.agentID == "" {
+		return bosherr.Error("Agent ID of the VM is unknown, which is required to reach the agent over NATS")
+	}
+
+	requestID, err := r.uuidGenerator.Generate()
+	if err != nil {
+		return bosherr.WrapError(err, "Generating agent request ID")
+	}
+
+	// the agent publishes its reply to the subject given in reply_to
+	replyTo := fmt.Sprintf("director.%s.%s", r.directorID, requestID)
+	message := AgentRequestMessage{
+		Method:    method,
+		Arguments: arguments,
+		ReplyTo:   replyTo,
+	}
+
+	agentRequestJSON, err := json.Marshal(message)
+	if err != nil {
+		return bosherr.WrapError(err, "Marshaling agent request")
+	}
+
+	subject := fmt.Sprintf("agent.%s", r.agentID)
+	responseBody, err := r.natsClient.Request(subject, replyTo, agentRequestJSON)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Performing request to agent on subject '%s'", subject)
+	}
+
+	err = response.Unmarshal(responseBody)
+	if err != nil {
+		return bosherr.WrapError(err, "Unmarshaling agent response")
+	}
+
+	err = response.ServerError()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
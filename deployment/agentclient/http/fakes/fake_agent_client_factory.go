@@ -2,20 +2,34 @@ package fakes
 
 import (
 	biagentclient "github.com/cloudfoundry/bosh-init/deployment/agentclient"
+	biinstallmanifest "github.com/cloudfoundry/bosh-init/installation/manifest"
 )
 
 type FakeAgentClientFactory struct {
 	CreateAgentClient biagentclient.AgentClient
 	CreateDirectorID  string
 	CreateMbusURL     string
+	CreateAgentID     string
+	CreateCert        biinstallmanifest.Cert
+	CreateErr         error
+
+	CloseCalled bool
+	CloseErr    error
 }
 
 func NewFakeAgentClientFactory() *FakeAgentClientFactory {
 	return &FakeAgentClientFactory{}
 }
 
-func (f *FakeAgentClientFactory) NewAgentClient(directorID, mbusURL string) biagentclient.AgentClient {
+func (f *FakeAgentClientFactory) NewAgentClient(directorID, mbusURL, agentID string, cert biinstallmanifest.Cert) (biagentclient.AgentClient, error) {
 	f.CreateDirectorID = directorID
 	f.CreateMbusURL = mbusURL
-	return f.CreateAgentClient
+	f.CreateAgentID = agentID
+	f.CreateCert = cert
+	return f.CreateAgentClient, f.CreateErr
+}
+
+func (f *FakeAgentClientFactory) Close() error {
+	f.CloseCalled = true
+	return f.CloseErr
 }
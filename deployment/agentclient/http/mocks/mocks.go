@@ -6,6 +6,7 @@ package mocks
 import (
 	gomock "code.google.com/p/gomock/gomock"
 	agentclient "github.com/cloudfoundry/bosh-init/deployment/agentclient"
+	manifest "github.com/cloudfoundry/bosh-init/installation/manifest"
 )
 
 // Mock of AgentClientFactory interface
@@ -29,12 +30,23 @@ func (_m *MockAgentClientFactory) EXPECT() *_MockAgentClientFactoryRecorder {
 	return _m.recorder
 }
 
-func (_m *MockAgentClientFactory) NewAgentClient(_param0 string, _param1 string) agentclient.AgentClient {
-	ret := _m.ctrl.Call(_m, "NewAgentClient", _param0, _param1)
+func (_m *MockAgentClientFactory) NewAgentClient(_param0 string, _param1 string, _param2 string, _param3 manifest.Cert) (agentclient.AgentClient, error) {
+	ret := _m.ctrl.Call(_m, "NewAgentClient", _param0, _param1, _param2, _param3)
 	ret0, _ := ret[0].(agentclient.AgentClient)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockAgentClientFactoryRecorder) NewAgentClient(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "NewAgentClient", arg0, arg1, arg2, arg3)
+}
+
+func (_m *MockAgentClientFactory) Close() error {
+	ret := _m.ctrl.Call(_m, "Close")
+	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-func (_mr *_MockAgentClientFactoryRecorder) NewAgentClient(arg0, arg1 interface{}) *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "NewAgentClient", arg0, arg1)
+func (_mr *_MockAgentClientFactoryRecorder) Close() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Close")
 }
@@ -0,0 +1,100 @@
+package http_test
+
+import (
+	"encoding/json"
+	"time"
+
+	. "github.com/cloudfoundry/bosh-init/deployment/agentclient/http"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	boshlog "github.com/cloudfoundry/bosh-agent/logger"
+	fakeuuid "github.com/cloudfoundry/bosh-agent/uuid/fakes"
+	biagentclient "github.com/cloudfoundry/bosh-init/deployment/agentclient"
+	binatsclient "github.com/cloudfoundry/bosh-init/deployment/natsclient"
+
+	fakebinatsclient "github.com/cloudfoundry/bosh-init/deployment/natsclient/fakes"
+)
+
+var _ = Describe("NATS AgentClient", func() {
+	var (
+		fakeNATSServer  *fakebinatsclient.FakeNATSServer
+		natsClient      binatsclient.NATSClient
+		agentClient     biagentclient.AgentClient
+		receivedMethods []string
+	)
+
+	BeforeEach(func() {
+		fakeNATSServer = fakebinatsclient.NewFakeNATSServer()
+		err := fakeNATSServer.Start()
+		Expect(err).ToNot(HaveOccurred())
+
+		receivedMethods = []string{}
+		fakeNATSServer.RegisterHandler("agent.fake-agent-id", func(payload []byte) []byte {
+			var request AgentRequestMessage
+			err := json.Unmarshal(payload, &request)
+			Expect(err).ToNot(HaveOccurred())
+			receivedMethods = append(receivedMethods, request.Method)
+
+			switch request.Method {
+			case "ping":
+				return []byte(`{"value":"pong"}`)
+			case "stop":
+				return []byte(`{"value":{"agent_task_id":"fake-agent-task-id","state":"running"}}`)
+			case "get_task":
+				return []byte(`{"value":"stopped"}`)
+			}
+			return []byte(`{"exception":{"message":"unknown message"}}`)
+		})
+
+		logger := boshlog.NewLogger(boshlog.LevelNone)
+		natsClient = binatsclient.NewNATSClient(fakeNATSServer.URL(), 1*time.Second, logger)
+		agentClient = NewNATSAgentClient(natsClient, "fake-agent-id", "fake-director-id", 0, &fakeuuid.FakeGenerator{}, logger)
+	})
+
+	AfterEach(func() {
+		natsClient.Close()
+		fakeNATSServer.Stop()
+	})
+
+	It("sends requests to the agent subject with a reply subject for the director", func() {
+		response, err := agentClient.Ping()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(response).To(Equal("pong"))
+
+		messages := fakeNATSServer.PublishedMessages()
+		Expect(messages[0].Subject).To(Equal("agent.fake-agent-id"))
+		Expect(messages[0].ReplyTo).To(Equal("director.fake-director-id.fake-uuid-0"))
+
+		var request AgentRequestMessage
+		err = json.Unmarshal(messages[0].Payload, &request)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(request).To(Equal(AgentRequestMessage{
+			Method:    "ping",
+			Arguments: []interface{}{},
+			ReplyTo:   "director.fake-director-id.fake-uuid-0",
+		}))
+	})
+
+	It("waits for async tasks to be finished", func() {
+		err := agentClient.Stop()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(receivedMethods).To(Equal([]string{"stop", "get_task"}))
+	})
+
+	It("returns an error when the agent responds with an exception", func() {
+		err := agentClient.Start()
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("unknown message"))
+	})
+
+	It("returns an error when the agent ID is unknown", func() {
+		agentClient = NewNATSAgentClient(natsClient, "", "fake-director-id", 0, &fakeuuid.FakeGenerator{}, boshlog.NewLogger(boshlog.LevelNone))
+
+		_, err := agentClient.Ping()
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("Agent ID of the VM is unknown"))
+		Expect(fakeNATSServer.PublishedMessages()).To(BeEmpty())
+	})
+})
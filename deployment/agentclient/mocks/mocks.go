@@ -104,6 +104,17 @@ func (_mr *_MockAgentClientRecorder) Ping() *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "Ping")
 }
 
+func (_m *MockAgentClient) RunErrand() (agentclient.ErrandResult, error) {
+	ret := _m.ctrl.Call(_m, "RunErrand")
+	ret0, _ := ret[0].(agentclient.ErrandResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockAgentClientRecorder) RunErrand() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "RunErrand")
+}
+
 func (_m *MockAgentClient) Start() error {
 	ret := _m.ctrl.Call(_m, "Start")
 	ret0, _ := ret[0].(error)
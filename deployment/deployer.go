@@ -67,7 +67,7 @@ func (d *deployer) Deploy(
 
 	pingTimeout := 10 * time.Second
 	pingDelay := 500 * time.Millisecond
-	if err := instanceManager.DeleteAll(pingTimeout, pingDelay, deployStage); err != nil {
+	if err := instanceManager.DeleteAll(deploymentManifest, pingTimeout, pingDelay, deployStage); err != nil {
 		return nil, err
 	}
 
@@ -91,14 +91,13 @@ func (d *deployer) createAllInstances(
 	instances := []biinstance.Instance{}
 	disks := []bidisk.Disk{}
 
-	if len(deploymentManifest.Jobs) != 1 {
-		return instances, disks, bosherr.Errorf("There must only be one job, found %d", len(deploymentManifest.Jobs))
-	}
-
+	// instances are updated one at a time, in the order of the manifest
 	for _, jobSpec := range deploymentManifest.Jobs {
-		if jobSpec.Instances != 1 {
-			return instances, disks, bosherr.Errorf("Job '%s' must have only one instance, found %d", jobSpec.Name, jobSpec.Instances)
+		// errand instances are only created when the errand is run
+		if jobSpec.Lifecycle == bideplmanifest.JobLifecycleErrand {
+			continue
 		}
+
 		for instanceID := 0; instanceID < jobSpec.Instances; instanceID++ {
 			instance, instanceDisks, err := instanceManager.Create(jobSpec.Name, instanceID, deploymentManifest, cloudStemcell, registryConfig, sshTunnelConfig, deployStage)
 			if err != nil {
@@ -11,7 +11,6 @@ import (
 
 	"code.google.com/p/gomock/gomock"
 	mock_blobstore "github.com/cloudfoundry/bosh-init/blobstore/mocks"
-	mock_httpagent "github.com/cloudfoundry/bosh-init/deployment/agentclient/http/mocks"
 	mock_agentclient "github.com/cloudfoundry/bosh-init/deployment/agentclient/mocks"
 	mock_instance_state "github.com/cloudfoundry/bosh-init/deployment/instance/state/mocks"
 	mock_vm "github.com/cloudfoundry/bosh-init/deployment/vm/mocks"
@@ -25,9 +24,11 @@ import (
 	biinstance "github.com/cloudfoundry/bosh-init/deployment/instance"
 	bideplmanifest "github.com/cloudfoundry/bosh-init/deployment/manifest"
 	bisshtunnel "github.com/cloudfoundry/bosh-init/deployment/sshtunnel"
+	bivm "github.com/cloudfoundry/bosh-init/deployment/vm"
 	biinstallmanifest "github.com/cloudfoundry/bosh-init/installation/manifest"
 	bistemcell "github.com/cloudfoundry/bosh-init/stemcell"
 
+	fakebiblobstore "github.com/cloudfoundry/bosh-init/blobstore/fakes"
 	fakebicloud "github.com/cloudfoundry/bosh-init/cloud/fakes"
 	fakebiconfig "github.com/cloudfoundry/bosh-init/config/fakes"
 	fakebisshtunnel "github.com/cloudfoundry/bosh-init/deployment/sshtunnel/fakes"
@@ -47,20 +48,19 @@ var _ = Describe("Deployer", func() {
 	})
 
 	var (
-		deployer               Deployer
-		mockVMManagerFactory   *mock_vm.MockManagerFactory
-		fakeVMManager          *fakebivm.FakeManager
-		mockAgentClient        *mock_agentclient.MockAgentClient
-		mockAgentClientFactory *mock_httpagent.MockAgentClientFactory
-		fakeSSHTunnelFactory   *fakebisshtunnel.FakeFactory
-		fakeSSHTunnel          *fakebisshtunnel.FakeTunnel
-		cloud                  *fakebicloud.FakeCloud
-		deploymentManifest     bideplmanifest.Manifest
-		diskPool               bideplmanifest.DiskPool
-		registryConfig         biinstallmanifest.Registry
-		fakeStage              *fakebiui.FakeStage
-		sshTunnelConfig        biinstallmanifest.SSHTunnel
-		fakeVM                 *fakebivm.FakeVM
+		deployer             Deployer
+		mockVMManagerFactory *mock_vm.MockManagerFactory
+		fakeVMManager        *fakebivm.FakeManager
+		mockAgentClient      *mock_agentclient.MockAgentClient
+		fakeSSHTunnelFactory *fakebisshtunnel.FakeFactory
+		fakeSSHTunnel        *fakebisshtunnel.FakeTunnel
+		cloud                *fakebicloud.FakeCloud
+		deploymentManifest   bideplmanifest.Manifest
+		diskPool             bideplmanifest.DiskPool
+		registryConfig       biinstallmanifest.Registry
+		fakeStage            *fakebiui.FakeStage
+		sshTunnelConfig      biinstallmanifest.SSHTunnel
+		fakeVM               *fakebivm.FakeVM
 
 		cloudStemcell bistemcell.CloudStemcell
 
@@ -110,13 +110,11 @@ var _ = Describe("Deployer", func() {
 
 		cloud = fakebicloud.NewFakeCloud()
 
-		mockAgentClientFactory = mock_httpagent.NewMockAgentClientFactory(mockCtrl)
 		mockAgentClient = mock_agentclient.NewMockAgentClient(mockCtrl)
-		mockAgentClientFactory.EXPECT().NewAgentClient(gomock.Any(), gomock.Any()).Return(mockAgentClient).AnyTimes()
 
 		mockVMManagerFactory = mock_vm.NewMockManagerFactory(mockCtrl)
 		fakeVMManager = fakebivm.NewFakeManager()
-		mockVMManagerFactory.EXPECT().NewManager(cloud, mockAgentClient).Return(fakeVMManager).AnyTimes()
+		mockVMManagerFactory.EXPECT().NewManager(cloud, gomock.Any(), gomock.Any(), gomock.Any()).Return(fakeVMManager).AnyTimes()
 
 		fakeSSHTunnelFactory = fakebisshtunnel.NewFakeFactory()
 		fakeSSHTunnel = fakebisshtunnel.NewFakeTunnel()
@@ -148,7 +146,7 @@ var _ = Describe("Deployer", func() {
 		mockState = mock_instance_state.NewMockState(mockCtrl)
 
 		instanceFactory := biinstance.NewFactory(mockStateBuilderFactory)
-		instanceManagerFactory := biinstance.NewManagerFactory(fakeSSHTunnelFactory, instanceFactory, logger)
+		instanceManagerFactory := biinstance.NewManagerFactory(fakebiblobstore.NewFakeBlobstoreFactory(), fakeSSHTunnelFactory, instanceFactory, logger)
 
 		mockBlobstore = mock_blobstore.NewMockBlobstore(mockCtrl)
 
@@ -183,11 +181,11 @@ var _ = Describe("Deployer", func() {
 
 		BeforeEach(func() {
 			fakeExistingVM = fakebivm.NewFakeVM("existing-vm-cid")
-			fakeVMManager.SetFindCurrentBehavior(fakeExistingVM, true, nil)
+			fakeVMManager.SetFindCurrentBehavior([]bivm.VM{fakeExistingVM}, nil)
 			fakeExistingVM.AgentClientReturn = mockAgentClient
 		})
 
-		It("deletes existing vm", func() {
+		It("deletes existing vm, naming the instance of a vm recorded without a job name after the first job", func() {
 			_, err := deployer.Deploy(cloud, deploymentManifest, cloudStemcell, registryConfig, sshTunnelConfig, fakeVMManager, mockBlobstore, fakeStage)
 			Expect(err).NotTo(HaveOccurred())
 
@@ -195,7 +193,7 @@ var _ = Describe("Deployer", func() {
 
 			Expect(fakeStage.PerformCalls[:3]).To(Equal([]fakebiui.PerformCall{
 				{Name: "Waiting for the agent on VM 'existing-vm-cid'"},
-				{Name: "Stopping jobs on instance 'unknown/0'"},
+				{Name: "Stopping jobs on instance 'fake-job-name/0'"},
 				{Name: "Deleting VM 'existing-vm-cid'"},
 			}))
 		})
@@ -206,11 +204,52 @@ var _ = Describe("Deployer", func() {
 		Expect(err).NotTo(HaveOccurred())
 
 		Expect(fakeVMManager.CreateInput).To(Equal(fakebivm.CreateInput{
+			JobName:  "fake-job-name",
+			Index:    0,
 			Stemcell: cloudStemcell,
 			Manifest: deploymentManifest,
 		}))
 	})
 
+	Context("when the job has more than one instance", func() {
+		BeforeEach(func() {
+			deploymentManifest.Jobs[0].Instances = 2
+		})
+
+		JustBeforeEach(func() {
+			mockStateBuilder.EXPECT().Build("fake-job-name", 1, deploymentManifest, fakeStage).Return(mockState, nil).AnyTimes()
+		})
+
+		It("creates a vm for each instance, in order", func() {
+			_, err := deployer.Deploy(cloud, deploymentManifest, cloudStemcell, registryConfig, sshTunnelConfig, fakeVMManager, mockBlobstore, fakeStage)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fakeVMManager.CreateInputs).To(Equal([]fakebivm.CreateInput{
+				{JobName: "fake-job-name", Index: 0, Stemcell: cloudStemcell, Manifest: deploymentManifest},
+				{JobName: "fake-job-name", Index: 1, Stemcell: cloudStemcell, Manifest: deploymentManifest},
+			}))
+		})
+	})
+
+	Context("when the deployment has an errand job", func() {
+		BeforeEach(func() {
+			deploymentManifest.Jobs = append(deploymentManifest.Jobs, bideplmanifest.Job{
+				Name:      "fake-errand-name",
+				Lifecycle: bideplmanifest.JobLifecycleErrand,
+				Instances: 1,
+			})
+		})
+
+		It("does not create a vm for the errand", func() {
+			_, err := deployer.Deploy(cloud, deploymentManifest, cloudStemcell, registryConfig, sshTunnelConfig, fakeVMManager, mockBlobstore, fakeStage)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fakeVMManager.CreateInputs).To(Equal([]fakebivm.CreateInput{
+				{JobName: "fake-job-name", Index: 0, Stemcell: cloudStemcell, Manifest: deploymentManifest},
+			}))
+		})
+	})
+
 	Context("when registry & ssh tunnel configs are not empty", func() {
 		BeforeEach(func() {
 			registryConfig = biinstallmanifest.Registry{
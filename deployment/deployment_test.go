@@ -19,18 +19,24 @@ import (
 	boshsys "github.com/cloudfoundry/bosh-agent/system"
 
 	fakesys "github.com/cloudfoundry/bosh-agent/system/fakes"
+	faketime "github.com/cloudfoundry/bosh-agent/time/fakes"
 	fakeuuid "github.com/cloudfoundry/bosh-agent/uuid/fakes"
 
 	bicloud "github.com/cloudfoundry/bosh-init/cloud"
 	biproperty "github.com/cloudfoundry/bosh-init/common/property"
 	biconfig "github.com/cloudfoundry/bosh-init/config"
+	bicrypto "github.com/cloudfoundry/bosh-init/crypto"
 	bias "github.com/cloudfoundry/bosh-init/deployment/applyspec"
 	bidisk "github.com/cloudfoundry/bosh-init/deployment/disk"
 	biinstance "github.com/cloudfoundry/bosh-init/deployment/instance"
+	bideplmanifest "github.com/cloudfoundry/bosh-init/deployment/manifest"
 	bisshtunnel "github.com/cloudfoundry/bosh-init/deployment/sshtunnel"
 	bivm "github.com/cloudfoundry/bosh-init/deployment/vm"
+	biinstallmanifest "github.com/cloudfoundry/bosh-init/installation/manifest"
 	bistemcell "github.com/cloudfoundry/bosh-init/stemcell"
 
+	fakebiblobstore "github.com/cloudfoundry/bosh-init/blobstore/fakes"
+	fakebihttpagent "github.com/cloudfoundry/bosh-init/deployment/agentclient/http/fakes"
 	fakebiui "github.com/cloudfoundry/bosh-init/ui/fakes"
 )
 
@@ -121,7 +127,7 @@ var _ = Describe("Deployment", func() {
 			fs = fakesys.NewFakeFileSystem()
 
 			fakeUUIDGenerator = fakeuuid.NewFakeGenerator()
-			deploymentConfigService = biconfig.NewFileSystemDeploymentConfigService(fs, fakeUUIDGenerator, logger)
+			deploymentConfigService = biconfig.NewFileSystemDeploymentConfigService(fs, fakeUUIDGenerator, &faketime.FakeService{}, bicrypto.NewEncryptor(nil), logger)
 			deploymentConfigService.SetConfigPath(deploymentConfigPath)
 
 			fakeRepoUUIDGenerator = fakeuuid.NewFakeGenerator()
@@ -144,7 +150,9 @@ var _ = Describe("Deployment", func() {
 			diskManagerFactory := bidisk.NewManagerFactory(diskRepo, logger)
 			diskDeployer := bivm.NewDiskDeployer(diskManagerFactory, diskRepo, logger)
 
-			vmManagerFactory := bivm.NewManagerFactory(vmRepo, stemcellRepo, diskDeployer, fakeUUIDGenerator, fs, logger)
+			fakeAgentClientFactory := fakebihttpagent.NewFakeAgentClientFactory()
+			fakeAgentClientFactory.CreateAgentClient = mockAgentClient
+			vmManagerFactory := bivm.NewManagerFactory(vmRepo, stemcellRepo, diskDeployer, fakeAgentClientFactory, fakeUUIDGenerator, &faketime.FakeService{}, fs, logger)
 			sshTunnelFactory := bisshtunnel.NewFactory(logger)
 
 			mockStateBuilderFactory = mock_instance_state.NewMockBuilderFactory(mockCtrl)
@@ -152,18 +160,20 @@ var _ = Describe("Deployment", func() {
 			mockState = mock_instance_state.NewMockState(mockCtrl)
 
 			instanceFactory := biinstance.NewFactory(mockStateBuilderFactory)
-			instanceManagerFactory := biinstance.NewManagerFactory(sshTunnelFactory, instanceFactory, logger)
+			fakeBlobstoreFactory := fakebiblobstore.NewFakeBlobstoreFactory()
+			instanceManagerFactory := biinstance.NewManagerFactory(fakeBlobstoreFactory, sshTunnelFactory, instanceFactory, logger)
 			stemcellManagerFactory := bistemcell.NewManagerFactory(stemcellRepo)
 
 			mockBlobstore = mock_blobstore.NewMockBlobstore(mockCtrl)
+			fakeBlobstoreFactory.CreateBlobstore = mockBlobstore
 
 			deploymentManagerFactory := NewManagerFactory(vmManagerFactory, instanceManagerFactory, diskManagerFactory, stemcellManagerFactory, deploymentFactory)
-			deploymentManager := deploymentManagerFactory.NewManager(mockCloud, mockAgentClient, mockBlobstore)
+			deploymentManager := deploymentManagerFactory.NewManager(mockCloud, "fake-director-id", "https://fake-mbus-host:6868", biinstallmanifest.Cert{}, mockBlobstore)
 
 			allowApplySpecToBeCreated()
 
 			var err error
-			deployment, _, err = deploymentManager.FindCurrent()
+			deployment, _, err = deploymentManager.FindCurrent(bideplmanifest.Manifest{})
 			Expect(err).ToNot(HaveOccurred())
 			//Note: deployment will be nil if the config has no vms, disks, or stemcells
 		})
@@ -174,9 +184,9 @@ var _ = Describe("Deployment", func() {
 				deploymentConfigService.Save(biconfig.DeploymentFile{
 					DirectorID:        "fake-director-id",
 					InstallationID:    "fake-installation-id",
-					CurrentVMCID:      "fake-vm-cid",
+					CurrentVMs:        []biconfig.VMRecord{{CID: "fake-vm-cid", JobName: "fake-job-name"}},
 					CurrentStemcellID: "fake-stemcell-guid",
-					CurrentDiskID:     "fake-disk-guid",
+					CurrentDiskIDs:    []string{"fake-disk-guid"},
 					Disks: []biconfig.DiskRecord{
 						{
 							ID:   "fake-disk-guid",
@@ -208,7 +218,7 @@ var _ = Describe("Deployment", func() {
 
 				Expect(fakeStage.PerformCalls).To(Equal([]fakebiui.PerformCall{
 					{Name: "Waiting for the agent on VM 'fake-vm-cid'"},
-					{Name: "Stopping jobs on instance 'unknown/0'"},
+					{Name: "Stopping jobs on instance 'fake-job-name/0'"},
 					{Name: "Unmounting disk 'fake-disk-cid'"},
 					{Name: "Deleting VM 'fake-vm-cid'"},
 					{Name: "Deleting disk 'fake-disk-cid'"},
@@ -222,17 +232,19 @@ var _ = Describe("Deployment", func() {
 				err := deployment.Delete(fakeStage)
 				Expect(err).ToNot(HaveOccurred())
 
-				_, found, err := vmRepo.FindCurrent()
-				Expect(found).To(BeFalse(), "should be no current VM")
+				vmRecords, err := vmRepo.FindCurrent()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(vmRecords).To(BeEmpty(), "should be no current VM")
 
-				_, found, err = diskRepo.FindCurrent()
-				Expect(found).To(BeFalse(), "should be no current disk")
+				currentDiskRecords, err := diskRepo.FindCurrent()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(currentDiskRecords).To(BeEmpty(), "should be no current disk")
 
 				diskRecords, err := diskRepo.All()
 				Expect(err).ToNot(HaveOccurred())
 				Expect(diskRecords).To(BeEmpty(), "expected no disk records")
 
-				_, found, err = stemcellRepo.FindCurrent()
+				_, found, err := stemcellRepo.FindCurrent()
 				Expect(found).To(BeFalse(), "should be no current stemcell")
 
 				stemcellRecords, err := stemcellRepo.All()
@@ -309,7 +321,7 @@ var _ = Describe("Deployment", func() {
 			)
 			BeforeEach(func() {
 				deploymentConfigService.Save(biconfig.DeploymentFile{})
-				vmRepo.UpdateCurrent("fake-vm-cid")
+				vmRepo.UpdateCurrent(biconfig.VMRecord{CID: "fake-vm-cid", JobName: "fake-job-name", Index: 0})
 
 				expectHasVM = mockCloud.EXPECT().HasVM("fake-vm-cid").Return(true, nil)
 			})
@@ -351,12 +363,35 @@ var _ = Describe("Deployment", func() {
 			})
 		})
 
+		Context("when more than one instance has been deployed", func() {
+			BeforeEach(func() {
+				deploymentConfigService.Save(biconfig.DeploymentFile{})
+				vmRepo.UpdateCurrent(biconfig.VMRecord{CID: "fake-vm-cid-1", JobName: "fake-job-name", Index: 0})
+				vmRepo.UpdateCurrent(biconfig.VMRecord{CID: "fake-vm-cid-2", JobName: "fake-job-name", Index: 1, AgentHost: "10.0.0.2"})
+
+				mockCloud.EXPECT().HasVM("fake-vm-cid-1").Return(false, nil)
+				mockCloud.EXPECT().HasVM("fake-vm-cid-2").Return(false, nil)
+			})
+
+			It("deletes the VM of every instance", func() {
+				mockCloud.EXPECT().DeleteVM("fake-vm-cid-1")
+				mockCloud.EXPECT().DeleteVM("fake-vm-cid-2")
+
+				err := deployment.Delete(fakeStage)
+				Expect(err).ToNot(HaveOccurred())
+
+				vmRecords, err := vmRepo.FindCurrent()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(vmRecords).To(BeEmpty())
+			})
+		})
+
 		Context("when a current disk exists", func() {
 			BeforeEach(func() {
 				deploymentConfigService.Save(biconfig.DeploymentFile{})
 				diskRecord, err := diskRepo.Save("fake-disk-cid", 100, nil)
 				Expect(err).ToNot(HaveOccurred())
-				diskRepo.UpdateCurrent(diskRecord.ID)
+				diskRepo.UpdateCurrent("fake-job-name", 0, diskRecord.ID)
 			})
 
 			It("deletes the disk", func() {
@@ -9,11 +9,13 @@ import (
 	boshlog "github.com/cloudfoundry/bosh-agent/logger"
 
 	fakesys "github.com/cloudfoundry/bosh-agent/system/fakes"
+	faketime "github.com/cloudfoundry/bosh-agent/time/fakes"
 	fakeuuid "github.com/cloudfoundry/bosh-agent/uuid/fakes"
 
 	bicloud "github.com/cloudfoundry/bosh-init/cloud"
 	biproperty "github.com/cloudfoundry/bosh-init/common/property"
 	biconfig "github.com/cloudfoundry/bosh-init/config"
+	bicrypto "github.com/cloudfoundry/bosh-init/crypto"
 
 	fakebicloud "github.com/cloudfoundry/bosh-init/cloud/fakes"
 
@@ -44,7 +46,7 @@ var _ = Describe("Disk", func() {
 		fs := fakesys.NewFakeFileSystem()
 		logger := boshlog.NewLogger(boshlog.LevelNone)
 		fakeUUIDGenerator = &fakeuuid.FakeGenerator{}
-		configService := biconfig.NewFileSystemDeploymentConfigService(fs, fakeUUIDGenerator, logger)
+		configService := biconfig.NewFileSystemDeploymentConfigService(fs, fakeUUIDGenerator, &faketime.FakeService{}, bicrypto.NewEncryptor(nil), logger)
 		configService.SetConfigPath("/fake/path")
 		diskRepo = biconfig.NewDiskRepo(configService, fakeUUIDGenerator)
 
@@ -111,7 +113,7 @@ var _ = Describe("Disk", func() {
 				diskRecord, err := diskRepo.Save("fake-disk-cid", 1024, diskCloudProperties)
 				Expect(err).ToNot(HaveOccurred())
 
-				err = diskRepo.UpdateCurrent(diskRecord.ID)
+				err = diskRepo.UpdateCurrent("fake-job-name", 0, diskRecord.ID)
 				Expect(err).ToNot(HaveOccurred())
 			})
 
@@ -119,9 +121,9 @@ var _ = Describe("Disk", func() {
 				err := disk.Delete()
 				Expect(err).ToNot(HaveOccurred())
 
-				_, found, err := diskRepo.FindCurrent()
+				currentRecords, err := diskRepo.FindCurrent()
 				Expect(err).ToNot(HaveOccurred())
-				Expect(found).To(BeFalse())
+				Expect(currentRecords).To(BeEmpty())
 			})
 		})
 
@@ -147,7 +149,7 @@ var _ = Describe("Disk", func() {
 				diskRecord, err := diskRepo.Save("fake-disk-cid", 1024, diskCloudProperties)
 				Expect(err).ToNot(HaveOccurred())
 
-				err = diskRepo.UpdateCurrent(diskRecord.ID)
+				err = diskRepo.UpdateCurrent("fake-job-name", 0, diskRecord.ID)
 				Expect(err).ToNot(HaveOccurred())
 
 				fakeCloud.DeleteDiskErr = deleteErr
@@ -179,9 +181,9 @@ var _ = Describe("Disk", func() {
 				Expect(err).To(HaveOccurred())
 				Expect(err).To(Equal(deleteErr))
 
-				_, found, err := diskRepo.FindCurrent()
+				currentRecords, err := diskRepo.FindCurrent()
 				Expect(err).ToNot(HaveOccurred())
-				Expect(found).To(BeFalse())
+				Expect(currentRecords).To(BeEmpty())
 			})
 		})
 	})
@@ -13,6 +13,7 @@ import (
 
 type Manager interface {
 	FindCurrent() ([]Disk, error)
+	FindCurrentForInstance(jobName string, index int) ([]Disk, error)
 	Create(bideplmanifest.DiskPool, string) (Disk, error)
 	FindUnused() ([]Disk, error)
 	DeleteUnused(biui.Stage) error
@@ -41,9 +42,24 @@ type manager struct {
 func (m *manager) FindCurrent() ([]Disk, error) {
 	disks := []Disk{}
 
-	diskRecord, found, err := m.diskRepo.FindCurrent()
+	diskRecords, err := m.diskRepo.FindCurrent()
 	if err != nil {
-		return disks, bosherr.WrapError(err, "Reading disk record")
+		return disks, bosherr.WrapError(err, "Reading disk records")
+	}
+
+	for _, diskRecord := range diskRecords {
+		disks = append(disks, NewDisk(diskRecord, m.cloud, m.diskRepo))
+	}
+
+	return disks, nil
+}
+
+func (m *manager) FindCurrentForInstance(jobName string, index int) ([]Disk, error) {
+	disks := []Disk{}
+
+	diskRecord, found, err := m.diskRepo.FindCurrentForInstance(jobName, index)
+	if err != nil {
+		return disks, bosherr.WrapErrorf(err, "Reading disk record of instance '%s/%d'", jobName, index)
 	}
 
 	if found {
@@ -85,13 +101,18 @@ func (m *manager) FindUnused() ([]Disk, error) {
 		return disks, bosherr.WrapError(err, "Getting all disk records")
 	}
 
-	currentDiskRecord, found, err := m.diskRepo.FindCurrent()
+	currentDiskRecords, err := m.diskRepo.FindCurrent()
 	if err != nil {
-		return disks, bosherr.WrapError(err, "Finding current disk record")
+		return disks, bosherr.WrapError(err, "Finding current disk records")
+	}
+
+	currentDiskIDs := map[string]bool{}
+	for _, currentDiskRecord := range currentDiskRecords {
+		currentDiskIDs[currentDiskRecord.ID] = true
 	}
 
 	for _, diskRecord := range diskRecords {
-		if !found || diskRecord.ID != currentDiskRecord.ID {
+		if !currentDiskIDs[diskRecord.ID] {
 			disks = append(disks, NewDisk(diskRecord, m.cloud, m.diskRepo))
 		}
 	}
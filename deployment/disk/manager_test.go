@@ -7,6 +7,7 @@ import (
 	. "github.com/onsi/gomega"
 
 	fakesys "github.com/cloudfoundry/bosh-agent/system/fakes"
+	faketime "github.com/cloudfoundry/bosh-agent/time/fakes"
 	fakeuuid "github.com/cloudfoundry/bosh-agent/uuid/fakes"
 	fakebicloud "github.com/cloudfoundry/bosh-init/cloud/fakes"
 	fakebiui "github.com/cloudfoundry/bosh-init/ui/fakes"
@@ -14,6 +15,7 @@ import (
 	boshlog "github.com/cloudfoundry/bosh-agent/logger"
 	biproperty "github.com/cloudfoundry/bosh-init/common/property"
 	biconfig "github.com/cloudfoundry/bosh-init/config"
+	bicrypto "github.com/cloudfoundry/bosh-init/crypto"
 	bidisk "github.com/cloudfoundry/bosh-init/deployment/disk"
 	bideplmanifest "github.com/cloudfoundry/bosh-init/deployment/manifest"
 
@@ -33,7 +35,7 @@ var _ = Describe("Manager", func() {
 		logger := boshlog.NewLogger(boshlog.LevelNone)
 		fakeFs = fakesys.NewFakeFileSystem()
 		fakeUUIDGenerator = &fakeuuid.FakeGenerator{}
-		configService := biconfig.NewFileSystemDeploymentConfigService(fakeFs, fakeUUIDGenerator, logger)
+		configService := biconfig.NewFileSystemDeploymentConfigService(fakeFs, fakeUUIDGenerator, &faketime.FakeService{}, bicrypto.NewEncryptor(nil), logger)
 		configService.SetConfigPath("/fake/path")
 		diskRepo = biconfig.NewDiskRepo(configService, fakeUUIDGenerator)
 		managerFactory := NewManagerFactory(diskRepo, logger)
@@ -102,7 +104,7 @@ var _ = Describe("Manager", func() {
 
 		Context("when updating disk record fails", func() {
 			BeforeEach(func() {
-				fakeFs.WriteFileError = errors.New("fake-write-error")
+				fakeFs.OpenFileErr = errors.New("fake-write-error")
 			})
 
 			It("returns an error", func() {
@@ -119,7 +121,7 @@ var _ = Describe("Manager", func() {
 				diskRecord, err := diskRepo.Save("fake-existing-disk-cid", 1024, biproperty.Map{})
 				Expect(err).ToNot(HaveOccurred())
 
-				err = diskRepo.UpdateCurrent(diskRecord.ID)
+				err = diskRepo.UpdateCurrent("fake-job-name", 0, diskRecord.ID)
 				Expect(err).ToNot(HaveOccurred())
 			})
 
@@ -153,6 +155,35 @@ var _ = Describe("Manager", func() {
 		})
 	})
 
+	Describe("FindCurrentForInstance", func() {
+		BeforeEach(func() {
+			fakeUUIDGenerator.GeneratedUUID = "fake-disk-id-1"
+			_, err := diskRepo.Save("fake-disk-cid-1", 1024, biproperty.Map{})
+			Expect(err).ToNot(HaveOccurred())
+			err = diskRepo.UpdateCurrent("fake-job-name", 0, "fake-disk-id-1")
+			Expect(err).ToNot(HaveOccurred())
+
+			fakeUUIDGenerator.GeneratedUUID = "fake-disk-id-2"
+			_, err = diskRepo.Save("fake-disk-cid-2", 1024, biproperty.Map{})
+			Expect(err).ToNot(HaveOccurred())
+			err = diskRepo.UpdateCurrent("fake-job-name", 1, "fake-disk-id-2")
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("returns the current disk of the instance", func() {
+			disks, err := manager.FindCurrentForInstance("fake-job-name", 1)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(disks).To(HaveLen(1))
+			Expect(disks[0].CID()).To(Equal("fake-disk-cid-2"))
+		})
+
+		It("returns an empty array when the instance has no current disk", func() {
+			disks, err := manager.FindCurrentForInstance("fake-job-name", 2)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(disks).To(BeEmpty())
+		})
+	})
+
 	Describe("FindUnused", func() {
 		var (
 			firstDisk bidisk.Disk
@@ -168,7 +199,7 @@ var _ = Describe("Manager", func() {
 			fakeUUIDGenerator.GeneratedUUID = "fake-guid-2"
 			_, err = diskRepo.Save("fake-disk-cid-2", 1024, biproperty.Map{})
 			Expect(err).ToNot(HaveOccurred())
-			err = diskRepo.UpdateCurrent("fake-guid-2")
+			err = diskRepo.UpdateCurrent("fake-job-name", 0, "fake-guid-2")
 			Expect(err).ToNot(HaveOccurred())
 
 			fakeUUIDGenerator.GeneratedUUID = "fake-guid-3"
@@ -203,8 +234,9 @@ var _ = Describe("Manager", func() {
 			fakeUUIDGenerator.GeneratedUUID = "fake-disk-id-2"
 			secondDiskRecord, err = diskRepo.Save("fake-disk-cid-2", 100, nil)
 			Expect(err).ToNot(HaveOccurred())
-			err = diskRepo.UpdateCurrent(secondDiskRecord.ID)
+			err = diskRepo.UpdateCurrent("fake-job-name", 0, secondDiskRecord.ID)
 			Expect(err).ToNot(HaveOccurred())
+			secondDiskRecord.JobName = "fake-job-name"
 
 			fakeUUIDGenerator.GeneratedUUID = "fake-disk-id-3"
 			_, err = diskRepo.Save("fake-disk-cid-3", 100, nil)
@@ -225,10 +257,9 @@ var _ = Describe("Manager", func() {
 				{Name: "Deleting unused disk 'fake-disk-cid-3'"},
 			}))
 
-			currentRecord, found, err := diskRepo.FindCurrent()
+			currentRecords, err := diskRepo.FindCurrent()
 			Expect(err).ToNot(HaveOccurred())
-			Expect(found).To(BeTrue())
-			Expect(currentRecord).To(Equal(secondDiskRecord))
+			Expect(currentRecords).To(Equal([]biconfig.DiskRecord{secondDiskRecord}))
 
 			records, err := diskRepo.All()
 			Expect(err).ToNot(HaveOccurred())
@@ -115,6 +115,17 @@ func (_mr *_MockManagerRecorder) FindCurrent() *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "FindCurrent")
 }
 
+func (_m *MockManager) FindCurrentForInstance(_param0 string, _param1 int) ([]disk.Disk, error) {
+	ret := _m.ctrl.Call(_m, "FindCurrentForInstance", _param0, _param1)
+	ret0, _ := ret[0].([]disk.Disk)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockManagerRecorder) FindCurrentForInstance(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "FindCurrentForInstance", arg0, arg1)
+}
+
 func (_m *MockManager) FindUnused() ([]disk.Disk, error) {
 	ret := _m.ctrl.Call(_m, "FindUnused")
 	ret0, _ := ret[0].([]disk.Disk)
@@ -0,0 +1,104 @@
+package deployment
+
+import (
+	"time"
+
+	bosherr "github.com/cloudfoundry/bosh-agent/errors"
+	boshlog "github.com/cloudfoundry/bosh-agent/logger"
+
+	biblobstore "github.com/cloudfoundry/bosh-init/blobstore"
+	bicloud "github.com/cloudfoundry/bosh-init/cloud"
+	biagentclient "github.com/cloudfoundry/bosh-init/deployment/agentclient"
+	biinstance "github.com/cloudfoundry/bosh-init/deployment/instance"
+	bideplmanifest "github.com/cloudfoundry/bosh-init/deployment/manifest"
+	bivm "github.com/cloudfoundry/bosh-init/deployment/vm"
+	biinstallmanifest "github.com/cloudfoundry/bosh-init/installation/manifest"
+	bistemcell "github.com/cloudfoundry/bosh-init/stemcell"
+	biui "github.com/cloudfoundry/bosh-init/ui"
+)
+
+// ErrandRunner creates the vm of an errand job, runs the errand on it and deletes it again
+type ErrandRunner interface {
+	Run(
+		cloud bicloud.Cloud,
+		errandName string,
+		deploymentManifest bideplmanifest.Manifest,
+		cloudStemcell bistemcell.CloudStemcell,
+		registryConfig biinstallmanifest.Registry,
+		sshTunnelConfig biinstallmanifest.SSHTunnel,
+		vmManager bivm.Manager,
+		blobstore biblobstore.Blobstore,
+		stage biui.Stage,
+	) (biagentclient.ErrandResult, error)
+}
+
+type errandRunner struct {
+	instanceManagerFactory biinstance.ManagerFactory
+	pingTimeout            time.Duration
+	pingDelay              time.Duration
+	logger                 boshlog.Logger
+	logTag                 string
+}
+
+func NewErrandRunner(
+	instanceManagerFactory biinstance.ManagerFactory,
+	pingTimeout time.Duration,
+	pingDelay time.Duration,
+	logger boshlog.Logger,
+) ErrandRunner {
+	return &errandRunner{
+		instanceManagerFactory: instanceManagerFactory,
+		pingTimeout:            pingTimeout,
+		pingDelay:              pingDelay,
+		logger:                 logger,
+		logTag:                 "errandRunner",
+	}
+}
+
+func (r *errandRunner) Run(
+	cloud bicloud.Cloud,
+	errandName string,
+	deploymentManifest bideplmanifest.Manifest,
+	cloudStemcell bistemcell.CloudStemcell,
+	registryConfig biinstallmanifest.Registry,
+	sshTunnelConfig biinstallmanifest.SSHTunnel,
+	vmManager bivm.Manager,
+	blobstore biblobstore.Blobstore,
+	stage biui.Stage,
+) (result biagentclient.ErrandResult, err error) {
+	job, found := deploymentManifest.FindJobByName(errandName)
+	if !found {
+		return result, bosherr.Errorf("Errand '%s' not found in the deployment manifest", errandName)
+	}
+
+	if job.Lifecycle != bideplmanifest.JobLifecycleErrand {
+		return result, bosherr.Errorf("Job '%s' is not an errand", errandName)
+	}
+
+	instanceManager := r.instanceManagerFactory.NewManager(cloud, vmManager, blobstore)
+
+	// errands always run on a single, new instance
+	instance, _, err := instanceManager.Create(job.Name, 0, deploymentManifest, cloudStemcell, registryConfig, sshTunnelConfig, stage)
+	if instance != nil {
+		defer func() {
+			deleteErr := instance.Delete(r.pingTimeout, r.pingDelay, stage)
+			if deleteErr != nil {
+				if err == nil {
+					err = bosherr.WrapErrorf(deleteErr, "Deleting errand instance '%s/0'", job.Name)
+				} else {
+					r.logger.Warn(r.logTag, "Failed to delete errand instance '%s/0': %s", job.Name, deleteErr.Error())
+				}
+			}
+		}()
+	}
+	if err != nil {
+		return result, bosherr.WrapErrorf(err, "Creating errand instance '%s/0'", job.Name)
+	}
+
+	result, err = instance.RunErrand(deploymentManifest, stage)
+	if err != nil {
+		return result, bosherr.WrapErrorf(err, "Running errand '%s'", job.Name)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,192 @@
+package deployment_test
+
+import (
+	. "github.com/cloudfoundry/bosh-init/deployment"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"time"
+
+	"code.google.com/p/gomock/gomock"
+	mock_blobstore "github.com/cloudfoundry/bosh-init/blobstore/mocks"
+	mock_instance "github.com/cloudfoundry/bosh-init/deployment/instance/mocks"
+
+	bosherr "github.com/cloudfoundry/bosh-agent/errors"
+	boshlog "github.com/cloudfoundry/bosh-agent/logger"
+
+	biagentclient "github.com/cloudfoundry/bosh-init/deployment/agentclient"
+	bideplmanifest "github.com/cloudfoundry/bosh-init/deployment/manifest"
+	biinstallmanifest "github.com/cloudfoundry/bosh-init/installation/manifest"
+
+	fakebicloud "github.com/cloudfoundry/bosh-init/cloud/fakes"
+	fakebivm "github.com/cloudfoundry/bosh-init/deployment/vm/fakes"
+	fakebistemcell "github.com/cloudfoundry/bosh-init/stemcell/fakes"
+	fakebiui "github.com/cloudfoundry/bosh-init/ui/fakes"
+)
+
+var _ = Describe("ErrandRunner", func() {
+	var mockCtrl *gomock.Controller
+
+	BeforeEach(func() {
+		mockCtrl = gomock.NewController(GinkgoT())
+	})
+
+	AfterEach(func() {
+		mockCtrl.Finish()
+	})
+
+	var (
+		mockInstanceManagerFactory *mock_instance.MockManagerFactory
+		mockInstanceManager        *mock_instance.MockManager
+		mockInstance               *mock_instance.MockInstance
+		mockBlobstore              *mock_blobstore.MockBlobstore
+
+		cloud             *fakebicloud.FakeCloud
+		fakeVMManager     *fakebivm.FakeManager
+		fakeCloudStemcell *fakebistemcell.FakeCloudStemcell
+		fakeStage         *fakebiui.FakeStage
+
+		registryConfig     biinstallmanifest.Registry
+		sshTunnelConfig    biinstallmanifest.SSHTunnel
+		deploymentManifest bideplmanifest.Manifest
+
+		pingTimeout = 10 * time.Second
+		pingDelay   = 500 * time.Millisecond
+
+		errandRunner ErrandRunner
+	)
+
+	BeforeEach(func() {
+		mockInstanceManagerFactory = mock_instance.NewMockManagerFactory(mockCtrl)
+		mockInstanceManager = mock_instance.NewMockManager(mockCtrl)
+		mockInstance = mock_instance.NewMockInstance(mockCtrl)
+		mockBlobstore = mock_blobstore.NewMockBlobstore(mockCtrl)
+
+		cloud = fakebicloud.NewFakeCloud()
+		fakeVMManager = fakebivm.NewFakeManager()
+		fakeCloudStemcell = fakebistemcell.NewFakeCloudStemcell("fake-stemcell-cid", "fake-stemcell-name", "fake-stemcell-version")
+		fakeStage = fakebiui.NewFakeStage()
+
+		registryConfig = biinstallmanifest.Registry{}
+		sshTunnelConfig = biinstallmanifest.SSHTunnel{}
+		deploymentManifest = bideplmanifest.Manifest{
+			Name: "fake-deployment-name",
+			Jobs: []bideplmanifest.Job{
+				{
+					Name:      "fake-job-name",
+					Instances: 1,
+				},
+				{
+					Name:      "fake-errand-name",
+					Lifecycle: bideplmanifest.JobLifecycleErrand,
+					Instances: 1,
+				},
+			},
+		}
+
+		mockInstanceManagerFactory.EXPECT().NewManager(cloud, fakeVMManager, mockBlobstore).Return(mockInstanceManager).AnyTimes()
+
+		logger := boshlog.NewLogger(boshlog.LevelNone)
+		errandRunner = NewErrandRunner(mockInstanceManagerFactory, pingTimeout, pingDelay, logger)
+	})
+
+	run := func(errandName string) (biagentclient.ErrandResult, error) {
+		return errandRunner.Run(
+			cloud,
+			errandName,
+			deploymentManifest,
+			fakeCloudStemcell,
+			registryConfig,
+			sshTunnelConfig,
+			fakeVMManager,
+			mockBlobstore,
+			fakeStage,
+		)
+	}
+
+	Context("when the errand instance is created", func() {
+		var expectCreate *gomock.Call
+
+		BeforeEach(func() {
+			expectCreate = mockInstanceManager.EXPECT().Create(
+				"fake-errand-name",
+				0,
+				deploymentManifest,
+				fakeCloudStemcell,
+				registryConfig,
+				sshTunnelConfig,
+				fakeStage,
+			).Return(mockInstance, nil, nil)
+		})
+
+		It("runs the errand on a new instance and deletes it afterwards", func() {
+			errandResult := biagentclient.ErrandResult{ExitStatus: 0, Stdout: "fake-stdout", Stderr: "fake-stderr"}
+
+			gomock.InOrder(
+				expectCreate,
+				mockInstance.EXPECT().RunErrand(deploymentManifest, fakeStage).Return(errandResult, nil),
+				mockInstance.EXPECT().Delete(pingTimeout, pingDelay, fakeStage).Return(nil),
+			)
+
+			result, err := run("fake-errand-name")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result).To(Equal(errandResult))
+		})
+
+		It("deletes the instance when running the errand fails", func() {
+			gomock.InOrder(
+				expectCreate,
+				mockInstance.EXPECT().RunErrand(deploymentManifest, fakeStage).Return(biagentclient.ErrandResult{}, bosherr.Error("fake-run-errand-error")),
+				mockInstance.EXPECT().Delete(pingTimeout, pingDelay, fakeStage).Return(nil),
+			)
+
+			_, err := run("fake-errand-name")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("fake-run-errand-error"))
+		})
+
+		It("returns an error when deleting the instance fails", func() {
+			mockInstance.EXPECT().RunErrand(deploymentManifest, fakeStage).Return(biagentclient.ErrandResult{}, nil)
+			mockInstance.EXPECT().Delete(pingTimeout, pingDelay, fakeStage).Return(bosherr.Error("fake-delete-error"))
+
+			_, err := run("fake-errand-name")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("fake-delete-error"))
+		})
+	})
+
+	Context("when creating the errand instance fails after its vm was created", func() {
+		BeforeEach(func() {
+			mockInstanceManager.EXPECT().Create(
+				"fake-errand-name",
+				0,
+				deploymentManifest,
+				fakeCloudStemcell,
+				registryConfig,
+				sshTunnelConfig,
+				fakeStage,
+			).Return(mockInstance, nil, bosherr.Error("fake-create-error"))
+		})
+
+		It("deletes the instance and returns an error", func() {
+			mockInstance.EXPECT().Delete(pingTimeout, pingDelay, fakeStage).Return(nil)
+
+			_, err := run("fake-errand-name")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("fake-create-error"))
+		})
+	})
+
+	It("returns an error when the errand is not in the manifest", func() {
+		_, err := run("fake-missing-errand-name")
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(Equal("Errand 'fake-missing-errand-name' not found in the deployment manifest"))
+	})
+
+	It("returns an error when the job is not an errand", func() {
+		_, err := run("fake-job-name")
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(Equal("Job 'fake-job-name' is not an errand"))
+	})
+})
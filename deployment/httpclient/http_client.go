@@ -2,8 +2,10 @@ package httpclient
 
 import (
 	"crypto/tls"
+	"crypto/x509"
 	"net"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 
@@ -11,16 +13,48 @@ import (
 	boshlog "github.com/cloudfoundry/bosh-agent/logger"
 )
 
-var DefaultClient = http.Client{
-	Transport: &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		Proxy:           http.ProxyFromEnvironment,
-		Dial: (&net.Dialer{
-			Timeout:   30 * time.Second,
-			KeepAlive: 30 * time.Second,
-		}).Dial,
-		TLSHandshakeTimeout: 10 * time.Second,
-	},
+// NewClient returns an http.Client that verifies the server certificate against the PEM encoded caCert,
+// or against the system roots when caCert is empty.
+// The PEM encoded client certificate and private key are presented to the server when given, for mutual TLS.
+func NewClient(caCert string, certificate string, privateKey string) (http.Client, error) {
+	tlsConfig, err := NewTLSConfig(caCert, certificate, privateKey)
+	if err != nil {
+		return http.Client{}, err
+	}
+
+	return http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: tlsConfig,
+			Proxy:           http.ProxyFromEnvironment,
+			Dial: (&net.Dialer{
+				Timeout:   30 * time.Second,
+				KeepAlive: 30 * time.Second,
+			}).Dial,
+			TLSHandshakeTimeout: 10 * time.Second,
+		},
+	}, nil
+}
+
+func NewTLSConfig(caCert string, certificate string, privateKey string) (*tls.Config, error) {
+	tlsConfig := &tls.Config{}
+
+	if caCert != "" {
+		certPool := x509.NewCertPool()
+		if !certPool.AppendCertsFromPEM([]byte(caCert)) {
+			return nil, bosherr.Error("Parsing CA certificate: no PEM encoded certificate found")
+		}
+		tlsConfig.RootCAs = certPool
+	}
+
+	if certificate != "" || privateKey != "" {
+		clientCert, err := tls.X509KeyPair([]byte(certificate), []byte(privateKey))
+		if err != nil {
+			return nil, bosherr.WrapError(err, "Parsing client certificate and private key")
+		}
+		tlsConfig.Certificates = []tls.Certificate{clientCert}
+	}
+
+	return tlsConfig, nil
 }
 
 type HTTPClient interface {
@@ -36,9 +70,9 @@ type httpClient struct {
 	logTag string
 }
 
-func NewHTTPClient(logger boshlog.Logger) HTTPClient {
+func NewHTTPClient(client http.Client, logger boshlog.Logger) HTTPClient {
 	return httpClient{
-		client: DefaultClient,
+		client: client,
 		logger: logger,
 		logTag: "httpClient",
 	}
@@ -55,7 +89,7 @@ func (c httpClient) Post(endpoint string, payload []byte) (*http.Response, error
 
 	response, err := c.client.Do(request)
 	if err != nil {
-		return nil, bosherr.WrapError(err, "Performing POST request")
+		return nil, wrapRequestError(err, "Performing POST request", request.URL)
 	}
 	return response, nil
 }
@@ -71,15 +105,22 @@ func (c httpClient) Put(endpoint string, payload []byte) (*http.Response, error)
 
 	response, err := c.client.Do(request)
 	if err != nil {
-		return nil, bosherr.WrapError(err, "Performing POST request")
+		return nil, wrapRequestError(err, "Performing POST request", request.URL)
 	}
 	return response, nil
 }
 
 func (c httpClient) Get(endpoint string) (*http.Response, error) {
-	response, err := http.Get(endpoint)
+	c.logger.Debug(c.logTag, "Sending GET request with endpoint %s", endpoint)
+
+	request, err := http.NewRequest("GET", endpoint, nil)
+	if err != nil {
+		return nil, bosherr.WrapError(err, "Creating GET request")
+	}
+
+	response, err := c.client.Do(request)
 	if err != nil {
-		return nil, bosherr.WrapError(err, "Performing GET request")
+		return nil, wrapRequestError(err, "Performing GET request", request.URL)
 	}
 
 	return response, nil
@@ -95,7 +136,35 @@ func (c httpClient) Delete(endpoint string) (*http.Response, error) {
 
 	response, err := c.client.Do(request)
 	if err != nil {
-		return nil, bosherr.WrapError(err, "Performing DELETE request")
+		return nil, wrapRequestError(err, "Performing DELETE request", request.URL)
 	}
 	return response, nil
 }
+
+// wrapRequestError calls out failed TLS verification of the server, which is otherwise buried in the transport error
+func wrapRequestError(err error, msg string, endpoint *url.URL) error {
+	if verificationErr, ok := tlsVerificationError(err); ok {
+		return bosherr.WrapErrorf(verificationErr, "%s: Verifying TLS certificate of '%s' failed, check the CA certificate of the endpoint", msg, endpoint.Host)
+	}
+	return bosherr.WrapError(err, msg)
+}
+
+func tlsVerificationError(err error) (error, bool) {
+	if urlErr, ok := err.(*url.Error); ok {
+		err = urlErr.Err
+	}
+
+	switch err.(type) {
+	case x509.UnknownAuthorityError, x509.HostnameError, x509.CertificateInvalidError:
+		return err, true
+	}
+
+	// the verification error may be wrapped by the tls package
+	if wrapper, ok := err.(interface {
+		Unwrap() error
+	}); ok {
+		return tlsVerificationError(wrapper.Unwrap())
+	}
+
+	return nil, false
+}
@@ -1,9 +1,12 @@
 package httpclient_test
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"io/ioutil"
 	"net"
 	"net/http"
+	"net/http/httptest"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -11,6 +14,8 @@ import (
 	boshlog "github.com/cloudfoundry/bosh-agent/logger"
 
 	. "github.com/cloudfoundry/bosh-init/deployment/httpclient"
+
+	bitestutils "github.com/cloudfoundry/bosh-init/testutils"
 )
 
 var _ = Describe("HttpClient", func() {
@@ -21,12 +26,14 @@ var _ = Describe("HttpClient", func() {
 
 	BeforeEach(func() {
 		logger := boshlog.NewLogger(boshlog.LevelNone)
-		httpClient = NewHTTPClient(logger)
+		client, err := NewClient("", "", "")
+		Expect(err).ToNot(HaveOccurred())
+		httpClient = NewHTTPClient(client, logger)
 		fakeServer = newFakeServer("localhost:6305")
 
 		readyCh := make(chan error)
 		go fakeServer.Start(readyCh)
-		err := <-readyCh
+		err = <-readyCh
 		Expect(err).ToNot(HaveOccurred())
 	})
 
@@ -83,6 +90,116 @@ var _ = Describe("HttpClient", func() {
 			))
 		})
 	})
+
+	Describe("TLS verification", func() {
+		var (
+			tlsServer  *httptest.Server
+			serverCert string
+			serverKey  string
+			logger     boshlog.Logger
+		)
+
+		BeforeEach(func() {
+			logger = boshlog.NewLogger(boshlog.LevelNone)
+
+			var err error
+			serverCert, serverKey, err = bitestutils.GenerateCertificate("fake-agent")
+			Expect(err).ToNot(HaveOccurred())
+
+			keyPair, err := tls.X509KeyPair([]byte(serverCert), []byte(serverKey))
+			Expect(err).ToNot(HaveOccurred())
+
+			tlsServer = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("fake-response"))
+			}))
+			tlsServer.TLS = &tls.Config{Certificates: []tls.Certificate{keyPair}}
+		})
+
+		AfterEach(func() {
+			tlsServer.Close()
+		})
+
+		It("succeeds when the server certificate is signed by the CA certificate", func() {
+			tlsServer.StartTLS()
+
+			client, err := NewClient(serverCert, "", "")
+			Expect(err).ToNot(HaveOccurred())
+
+			response, err := NewHTTPClient(client, logger).Post(tlsServer.URL, []byte("fake-request"))
+			Expect(err).ToNot(HaveOccurred())
+			defer response.Body.Close()
+			Expect(response.StatusCode).To(Equal(200))
+		})
+
+		It("returns an error when the server certificate is not signed by a trusted CA", func() {
+			tlsServer.StartTLS()
+
+			otherCACert, _, err := bitestutils.GenerateCertificate("fake-other-ca")
+			Expect(err).ToNot(HaveOccurred())
+
+			client, err := NewClient(otherCACert, "", "")
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = NewHTTPClient(client, logger).Post(tlsServer.URL, []byte("fake-request"))
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Verifying TLS certificate of '" + tlsServer.Listener.Addr().String() + "' failed"))
+		})
+
+		Context("when the server requires a client certificate", func() {
+			var (
+				clientCert string
+				clientKey  string
+			)
+
+			BeforeEach(func() {
+				var err error
+				clientCert, clientKey, err = bitestutils.GenerateCertificate("fake-director")
+				Expect(err).ToNot(HaveOccurred())
+
+				clientCAs := x509.NewCertPool()
+				clientCAs.AppendCertsFromPEM([]byte(clientCert))
+				tlsServer.TLS.ClientAuth = tls.RequireAndVerifyClientCert
+				tlsServer.TLS.ClientCAs = clientCAs
+				tlsServer.StartTLS()
+			})
+
+			It("presents the client certificate", func() {
+				client, err := NewClient(serverCert, clientCert, clientKey)
+				Expect(err).ToNot(HaveOccurred())
+
+				response, err := NewHTTPClient(client, logger).Get(tlsServer.URL)
+				Expect(err).ToNot(HaveOccurred())
+				defer response.Body.Close()
+				Expect(response.StatusCode).To(Equal(200))
+			})
+
+			It("returns an error without a client certificate", func() {
+				client, err := NewClient(serverCert, "", "")
+				Expect(err).ToNot(HaveOccurred())
+
+				_, err = NewHTTPClient(client, logger).Get(tlsServer.URL)
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("Performing GET request"))
+			})
+		})
+	})
+
+	Describe("NewClient", func() {
+		It("returns an error when the CA certificate is not PEM encoded", func() {
+			_, err := NewClient("fake-ca-cert", "", "")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Parsing CA certificate"))
+		})
+
+		It("returns an error when the client certificate has no matching private key", func() {
+			clientCert, _, err := bitestutils.GenerateCertificate("fake-director")
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = NewClient("", clientCert, "")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Parsing client certificate and private key"))
+		})
+	})
 })
 
 type receivedRequestBody struct {
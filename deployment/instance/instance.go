@@ -8,6 +8,7 @@ import (
 	boshlog "github.com/cloudfoundry/bosh-agent/logger"
 
 	bicloud "github.com/cloudfoundry/bosh-init/cloud"
+	biagentclient "github.com/cloudfoundry/bosh-init/deployment/agentclient"
 	bidisk "github.com/cloudfoundry/bosh-init/deployment/disk"
 	biinstancestate "github.com/cloudfoundry/bosh-init/deployment/instance/state"
 	bideplmanifest "github.com/cloudfoundry/bosh-init/deployment/manifest"
@@ -24,6 +25,7 @@ type Instance interface {
 	WaitUntilReady(biinstallmanifest.Registry, biinstallmanifest.SSHTunnel, biui.Stage) error
 	UpdateDisks(bideplmanifest.Manifest, biui.Stage) ([]bidisk.Disk, error)
 	UpdateJobs(bideplmanifest.Manifest, biui.Stage) error
+	RunErrand(bideplmanifest.Manifest, biui.Stage) (biagentclient.ErrandResult, error)
 	Delete(
 		pingTimeout time.Duration,
 		pingDelay time.Duration,
@@ -87,8 +89,13 @@ func (i *instance) WaitUntilReady(
 	stepName := fmt.Sprintf("Waiting for the agent on VM '%s' to be ready", i.vm.CID())
 	err := stage.Perform(stepName, func() error {
 		if !registryConfig.IsEmpty() && !sshTunnelConfig.IsEmpty() {
+			sshTunnelHost := sshTunnelConfig.Host
+			if i.vm.AgentHost() != "" {
+				sshTunnelHost = i.vm.AgentHost()
+			}
+
 			sshTunnelOptions := bisshtunnel.Options{
-				Host:              sshTunnelConfig.Host,
+				Host:              sshTunnelHost,
 				Port:              sshTunnelConfig.Port,
 				User:              sshTunnelConfig.User,
 				Password:          sshTunnelConfig.Password,
@@ -160,7 +167,54 @@ func (i *instance) UpdateJobs(
 		return err
 	}
 
-	return i.waitUntilJobsAreRunning(deploymentManifest.Update.UpdateWatchTime, stage)
+	err = i.waitUntilJobsAreRunning(deploymentManifest.Update.UpdateWatchTime, stage)
+	if err != nil {
+		return err
+	}
+
+	// disks replaced by a migration are only deleted once the jobs are running on the new disks
+	return i.vm.DeleteUnusedDisks(stage)
+}
+
+// RunErrand applies the errand job to the VM without starting it, then runs the job's bin/run and waits for it to exit
+func (i *instance) RunErrand(
+	deploymentManifest bideplmanifest.Manifest,
+	stage biui.Stage,
+) (biagentclient.ErrandResult, error) {
+	newState, err := i.stateBuilder.Build(i.jobName, i.id, deploymentManifest, stage)
+	if err != nil {
+		return biagentclient.ErrandResult{}, bosherr.WrapErrorf(err, "Building state for instance '%s/%d'", i.jobName, i.id)
+	}
+
+	stepName := fmt.Sprintf("Updating instance '%s/%d'", i.jobName, i.id)
+	err = stage.Perform(stepName, func() error {
+		err := i.vm.Stop()
+		if err != nil {
+			return bosherr.WrapError(err, "Stopping the agent")
+		}
+
+		err = i.vm.Apply(newState.ToApplySpec())
+		if err != nil {
+			return bosherr.WrapError(err, "Applying the agent state")
+		}
+
+		return nil
+	})
+	if err != nil {
+		return biagentclient.ErrandResult{}, err
+	}
+
+	var result biagentclient.ErrandResult
+	stepName = fmt.Sprintf("Running errand '%s/%d'", i.jobName, i.id)
+	err = stage.Perform(stepName, func() error {
+		result, err = i.vm.RunErrand()
+		return err
+	})
+	if err != nil {
+		return result, err
+	}
+
+	return result, nil
 }
 
 func (i *instance) Delete(
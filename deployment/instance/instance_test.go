@@ -15,6 +15,7 @@ import (
 	boshlog "github.com/cloudfoundry/bosh-agent/logger"
 
 	bicloud "github.com/cloudfoundry/bosh-init/cloud"
+	biagentclient "github.com/cloudfoundry/bosh-init/deployment/agentclient"
 	bias "github.com/cloudfoundry/bosh-init/deployment/applyspec"
 	bidisk "github.com/cloudfoundry/bosh-init/deployment/disk"
 	bideplmanifest "github.com/cloudfoundry/bosh-init/deployment/manifest"
@@ -335,6 +336,25 @@ var _ = Describe("Instance", func() {
 			}))
 		})
 
+		It("deletes unused disks once the jobs are running", func() {
+			err := instance.UpdateJobs(deploymentManifest, fakeStage)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fakeVM.DeleteUnusedDisksCalledTimes).To(Equal(1))
+		})
+
+		Context("when deleting unused disks fails", func() {
+			BeforeEach(func() {
+				fakeVM.DeleteUnusedDisksErr = bosherr.Error("fake-delete-unused-disks-error")
+			})
+
+			It("returns an error", func() {
+				err := instance.UpdateJobs(deploymentManifest, fakeStage)
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("fake-delete-unused-disks-error"))
+			})
+		})
+
 		Context("when instance state building fails", func() {
 			JustBeforeEach(func() {
 				expectStateBuild.Return(nil, bosherr.Error("fake-template-err")).Times(1)
@@ -417,6 +437,116 @@ var _ = Describe("Instance", func() {
 					},
 				}))
 			})
+
+			It("keeps unused disks", func() {
+				err := instance.UpdateJobs(deploymentManifest, fakeStage)
+				Expect(err).To(HaveOccurred())
+
+				Expect(fakeVM.DeleteUnusedDisksCalledTimes).To(Equal(0))
+			})
+		})
+	})
+
+	Describe("RunErrand", func() {
+		var (
+			deploymentManifest bideplmanifest.Manifest
+			applySpec          bias.ApplySpec
+			expectStateBuild   *gomock.Call
+		)
+
+		BeforeEach(func() {
+			deploymentManifest = bideplmanifest.Manifest{
+				Name: "fake-deployment-name",
+			}
+
+			applySpec = bias.ApplySpec{
+				Deployment: "fake-deployment-name",
+			}
+
+			fakeVM.RunErrandResult = biagentclient.ErrandResult{
+				ExitStatus: 0,
+				Stdout:     "fake-stdout",
+				Stderr:     "fake-stderr",
+			}
+		})
+
+		JustBeforeEach(func() {
+			expectStateBuild = mockStateBuilder.EXPECT().Build(jobName, jobIndex, deploymentManifest, fakeStage).Return(mockState, nil).AnyTimes()
+			mockState.EXPECT().ToApplySpec().Return(applySpec).AnyTimes()
+		})
+
+		It("applies the new state without starting the jobs", func() {
+			_, err := instance.RunErrand(deploymentManifest, fakeStage)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(fakeVM.StopCalled).To(Equal(1))
+			Expect(fakeVM.ApplyInputs).To(Equal([]fakebivm.ApplyInput{
+				{ApplySpec: applySpec},
+			}))
+			Expect(fakeVM.StartCalled).To(Equal(0))
+		})
+
+		It("runs the errand and returns its result", func() {
+			result, err := instance.RunErrand(deploymentManifest, fakeStage)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(fakeVM.RunErrandCalledTimes).To(Equal(1))
+			Expect(result).To(Equal(biagentclient.ErrandResult{
+				ExitStatus: 0,
+				Stdout:     "fake-stdout",
+				Stderr:     "fake-stderr",
+			}))
+		})
+
+		It("logs update and run events to the eventLogger", func() {
+			_, err := instance.RunErrand(deploymentManifest, fakeStage)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(fakeStage.PerformCalls).To(Equal([]fakebiui.PerformCall{
+				{Name: "Updating instance 'fake-job-name/0'"},
+				{Name: "Running errand 'fake-job-name/0'"},
+			}))
+		})
+
+		Context("when instance state building fails", func() {
+			JustBeforeEach(func() {
+				expectStateBuild.Return(nil, bosherr.Error("fake-template-err")).Times(1)
+			})
+
+			It("returns an error", func() {
+				_, err := instance.RunErrand(deploymentManifest, fakeStage)
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("fake-template-err"))
+				Expect(fakeVM.RunErrandCalledTimes).To(Equal(0))
+			})
+		})
+
+		Context("when applying a new vm state fails", func() {
+			BeforeEach(func() {
+				fakeVM.ApplyErr = bosherr.Error("fake-apply-error")
+			})
+
+			It("does not run the errand", func() {
+				_, err := instance.RunErrand(deploymentManifest, fakeStage)
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("fake-apply-error"))
+				Expect(fakeVM.RunErrandCalledTimes).To(Equal(0))
+			})
+		})
+
+		Context("when running the errand fails", func() {
+			BeforeEach(func() {
+				fakeVM.RunErrandErr = bosherr.Error("fake-run-errand-error")
+			})
+
+			It("returns an error", func() {
+				_, err := instance.RunErrand(deploymentManifest, fakeStage)
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("fake-run-errand-error"))
+
+				Expect(fakeStage.PerformCalls[1].Name).To(Equal("Running errand 'fake-job-name/0'"))
+				Expect(fakeStage.PerformCalls[1].Error).To(HaveOccurred())
+			})
 		})
 	})
 
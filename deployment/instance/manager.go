@@ -11,6 +11,7 @@ import (
 	bicloud "github.com/cloudfoundry/bosh-init/cloud"
 	bidisk "github.com/cloudfoundry/bosh-init/deployment/disk"
 	bideplmanifest "github.com/cloudfoundry/bosh-init/deployment/manifest"
+	binatsclient "github.com/cloudfoundry/bosh-init/deployment/natsclient"
 	bisshtunnel "github.com/cloudfoundry/bosh-init/deployment/sshtunnel"
 	bivm "github.com/cloudfoundry/bosh-init/deployment/vm"
 	biinstallmanifest "github.com/cloudfoundry/bosh-init/installation/manifest"
@@ -19,7 +20,7 @@ import (
 )
 
 type Manager interface {
-	FindCurrent() ([]Instance, error)
+	FindCurrent(deploymentManifest bideplmanifest.Manifest) ([]Instance, error)
 	Create(
 		jobName string,
 		id int,
@@ -30,6 +31,7 @@ type Manager interface {
 		eventLoggerStage biui.Stage,
 	) (Instance, []bidisk.Disk, error)
 	DeleteAll(
+		deploymentManifest bideplmanifest.Manifest,
 		pingTimeout time.Duration,
 		pingDelay time.Duration,
 		eventLoggerStage biui.Stage,
@@ -40,6 +42,7 @@ type manager struct {
 	cloud            bicloud.Cloud
 	vmManager        bivm.Manager
 	blobstore        biblobstore.Blobstore
+	blobstoreFactory biblobstore.Factory
 	sshTunnelFactory bisshtunnel.Factory
 	instanceFactory  Factory
 	logger           boshlog.Logger
@@ -50,6 +53,7 @@ func NewManager(
 	cloud bicloud.Cloud,
 	vmManager bivm.Manager,
 	blobstore biblobstore.Blobstore,
+	blobstoreFactory biblobstore.Factory,
 	sshTunnelFactory bisshtunnel.Factory,
 	instanceFactory Factory,
 	logger boshlog.Logger,
@@ -58,6 +62,7 @@ func NewManager(
 		cloud:            cloud,
 		vmManager:        vmManager,
 		blobstore:        blobstore,
+		blobstoreFactory: blobstoreFactory,
 		sshTunnelFactory: sshTunnelFactory,
 		instanceFactory:  instanceFactory,
 		logger:           logger,
@@ -65,27 +70,34 @@ func NewManager(
 	}
 }
 
-func (m *manager) FindCurrent() ([]Instance, error) {
+// FindCurrent names the instances of vms recorded before multiple instances were supported, which have no job name,
+// after the LegacyJobName of the manifest
+func (m *manager) FindCurrent(deploymentManifest bideplmanifest.Manifest) ([]Instance, error) {
 	instances := []Instance{}
 
-	// Only one current instance will exist (for now)
-	vm, found, err := m.vmManager.FindCurrent()
+	vms, err := m.vmManager.FindCurrent()
 	if err != nil {
 		return instances, bosherr.WrapError(err, "Finding currently deployed instances")
 	}
 
-	if found {
-		// TODO: store the name of the job for each instance in the repo, so that we can print it when deleting
-		jobName := "unknown"
-		instanceID := 0
+	for _, vm := range vms {
+		jobName := vm.JobName()
+		if jobName == "" {
+			jobName = deploymentManifest.LegacyJobName()
+		}
+
+		blobstore, err := m.instanceBlobstore(vm)
+		if err != nil {
+			return instances, err
+		}
 
 		instance := m.instanceFactory.NewInstance(
 			jobName,
-			instanceID,
+			vm.Index(),
 			vm,
 			m.vmManager,
 			m.sshTunnelFactory,
-			m.blobstore,
+			blobstore,
 			m.logger,
 		)
 		instances = append(instances, instance)
@@ -107,7 +119,7 @@ func (m *manager) Create(
 	stepName := fmt.Sprintf("Creating VM for instance '%s/%d' from stemcell '%s'", jobName, id, cloudStemcell.CID())
 	err := eventLoggerStage.Perform(stepName, func() error {
 		var err error
-		vm, err = m.vmManager.Create(cloudStemcell, deploymentManifest)
+		vm, err = m.vmManager.Create(jobName, id, cloudStemcell, deploymentManifest)
 		if err != nil {
 			return bosherr.WrapError(err, "Creating VM")
 		}
@@ -122,7 +134,12 @@ func (m *manager) Create(
 		return nil, []bidisk.Disk{}, err
 	}
 
-	instance := m.instanceFactory.NewInstance(jobName, id, vm, m.vmManager, m.sshTunnelFactory, m.blobstore, m.logger)
+	blobstore, err := m.instanceBlobstore(vm)
+	if err != nil {
+		return nil, []bidisk.Disk{}, err
+	}
+
+	instance := m.instanceFactory.NewInstance(jobName, id, vm, m.vmManager, m.sshTunnelFactory, blobstore, m.logger)
 
 	if err := instance.WaitUntilReady(registryConfig, sshTunnelConfig, eventLoggerStage); err != nil {
 		return instance, []bidisk.Disk{}, bosherr.WrapError(err, "Waiting until instance is ready")
@@ -136,12 +153,29 @@ func (m *manager) Create(
 	return instance, disks, err
 }
 
+// instanceBlobstore returns the blobstore served by the agent of the vm.
+// Only the first instance of the deployment is reached at the mbus URL.
+// Agents on a NATS mbus all use the blobstore of the installation.
+func (m *manager) instanceBlobstore(vm bivm.VM) (biblobstore.Blobstore, error) {
+	if vm.AgentHost() == "" || binatsclient.IsNATSURL(vm.MbusURL()) {
+		return m.blobstore, nil
+	}
+
+	blobstore, err := m.blobstoreFactory.Create(vm.MbusURL(), vm.MbusCert())
+	if err != nil {
+		return nil, bosherr.WrapErrorf(err, "Creating blobstore client for vm '%s'", vm.CID())
+	}
+
+	return blobstore, nil
+}
+
 func (m *manager) DeleteAll(
+	deploymentManifest bideplmanifest.Manifest,
 	pingTimeout time.Duration,
 	pingDelay time.Duration,
 	eventLoggerStage biui.Stage,
 ) error {
-	instances, err := m.FindCurrent()
+	instances, err := m.FindCurrent(deploymentManifest)
 	if err != nil {
 		return err
 	}
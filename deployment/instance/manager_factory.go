@@ -14,17 +14,20 @@ type ManagerFactory interface {
 }
 
 type managerFactory struct {
+	blobstoreFactory biblobstore.Factory
 	sshTunnelFactory bisshtunnel.Factory
 	instanceFactory  Factory
 	logger           boshlog.Logger
 }
 
 func NewManagerFactory(
+	blobstoreFactory biblobstore.Factory,
 	sshTunnelFactory bisshtunnel.Factory,
 	instanceFactory Factory,
 	logger boshlog.Logger,
 ) ManagerFactory {
 	return &managerFactory{
+		blobstoreFactory: blobstoreFactory,
 		sshTunnelFactory: sshTunnelFactory,
 		instanceFactory:  instanceFactory,
 		logger:           logger,
@@ -36,6 +39,7 @@ func (f *managerFactory) NewManager(cloud bicloud.Cloud, vmManager bivm.Manager,
 		cloud,
 		vmManager,
 		blobstore,
+		f.blobstoreFactory,
 		f.sshTunnelFactory,
 		f.instanceFactory,
 		f.logger,
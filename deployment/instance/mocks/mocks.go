@@ -1,13 +1,17 @@
 // Automatically generated by MockGen. DO NOT EDIT!
-// Source: github.com/cloudfoundry/bosh-init/deployment/instance (interfaces: Instance,Manager)
+// Source: github.com/cloudfoundry/bosh-init/deployment/instance (interfaces: Instance,Manager,ManagerFactory)
 
 package mocks
 
 import (
 	gomock "code.google.com/p/gomock/gomock"
+	blobstore "github.com/cloudfoundry/bosh-init/blobstore"
+	cloud "github.com/cloudfoundry/bosh-init/cloud"
+	agentclient "github.com/cloudfoundry/bosh-init/deployment/agentclient"
 	disk "github.com/cloudfoundry/bosh-init/deployment/disk"
 	instance "github.com/cloudfoundry/bosh-init/deployment/instance"
 	manifest "github.com/cloudfoundry/bosh-init/deployment/manifest"
+	vm "github.com/cloudfoundry/bosh-init/deployment/vm"
 	manifest0 "github.com/cloudfoundry/bosh-init/installation/manifest"
 	stemcell "github.com/cloudfoundry/bosh-init/stemcell"
 	ui "github.com/cloudfoundry/bosh-init/ui"
@@ -87,6 +91,17 @@ func (_mr *_MockInstanceRecorder) UpdateDisks(arg0, arg1 interface{}) *gomock.Ca
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "UpdateDisks", arg0, arg1)
 }
 
+func (_m *MockInstance) RunErrand(_param0 manifest.Manifest, _param1 ui.Stage) (agentclient.ErrandResult, error) {
+	ret := _m.ctrl.Call(_m, "RunErrand", _param0, _param1)
+	ret0, _ := ret[0].(agentclient.ErrandResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockInstanceRecorder) RunErrand(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "RunErrand", arg0, arg1)
+}
+
 func (_m *MockInstance) UpdateJobs(_param0 manifest.Manifest, _param1 ui.Stage) error {
 	ret := _m.ctrl.Call(_m, "UpdateJobs", _param0, _param1)
 	ret0, _ := ret[0].(error)
@@ -140,23 +155,54 @@ func (_mr *_MockManagerRecorder) Create(arg0, arg1, arg2, arg3, arg4, arg5, arg6
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "Create", arg0, arg1, arg2, arg3, arg4, arg5, arg6)
 }
 
-func (_m *MockManager) DeleteAll(_param0 time.Duration, _param1 time.Duration, _param2 ui.Stage) error {
-	ret := _m.ctrl.Call(_m, "DeleteAll", _param0, _param1, _param2)
+func (_m *MockManager) DeleteAll(_param0 manifest.Manifest, _param1 time.Duration, _param2 time.Duration, _param3 ui.Stage) error {
+	ret := _m.ctrl.Call(_m, "DeleteAll", _param0, _param1, _param2, _param3)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-func (_mr *_MockManagerRecorder) DeleteAll(arg0, arg1, arg2 interface{}) *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "DeleteAll", arg0, arg1, arg2)
+func (_mr *_MockManagerRecorder) DeleteAll(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "DeleteAll", arg0, arg1, arg2, arg3)
 }
 
-func (_m *MockManager) FindCurrent() ([]instance.Instance, error) {
-	ret := _m.ctrl.Call(_m, "FindCurrent")
+func (_m *MockManager) FindCurrent(_param0 manifest.Manifest) ([]instance.Instance, error) {
+	ret := _m.ctrl.Call(_m, "FindCurrent", _param0)
 	ret0, _ := ret[0].([]instance.Instance)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-func (_mr *_MockManagerRecorder) FindCurrent() *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "FindCurrent")
+func (_mr *_MockManagerRecorder) FindCurrent(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "FindCurrent", arg0)
+}
+
+// Mock of ManagerFactory interface
+type MockManagerFactory struct {
+	ctrl     *gomock.Controller
+	recorder *_MockManagerFactoryRecorder
+}
+
+// Recorder for MockManagerFactory (not exported)
+type _MockManagerFactoryRecorder struct {
+	mock *MockManagerFactory
+}
+
+func NewMockManagerFactory(ctrl *gomock.Controller) *MockManagerFactory {
+	mock := &MockManagerFactory{ctrl: ctrl}
+	mock.recorder = &_MockManagerFactoryRecorder{mock}
+	return mock
+}
+
+func (_m *MockManagerFactory) EXPECT() *_MockManagerFactoryRecorder {
+	return _m.recorder
+}
+
+func (_m *MockManagerFactory) NewManager(_param0 cloud.Cloud, _param1 vm.Manager, _param2 blobstore.Blobstore) instance.Manager {
+	ret := _m.ctrl.Call(_m, "NewManager", _param0, _param1, _param2)
+	ret0, _ := ret[0].(instance.Manager)
+	return ret0
+}
+
+func (_mr *_MockManagerFactoryRecorder) NewManager(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "NewManager", arg0, arg1, arg2)
 }
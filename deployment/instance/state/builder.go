@@ -1,6 +1,10 @@
 package state
 
 import (
+	"fmt"
+
+	gouuid "github.com/nu7hatch/gouuid"
+
 	bosherr "github.com/cloudfoundry/bosh-agent/errors"
 	boshlog "github.com/cloudfoundry/bosh-agent/logger"
 
@@ -63,19 +67,26 @@ func (b *builder) Build(jobName string, instanceID int, deploymentManifest bidep
 		return nil, bosherr.WrapErrorf(err, "Resolving jobs for instance '%s/%d'", jobName, instanceID)
 	}
 
-	renderedJobTemplates, err := b.renderJobTemplates(releaseJobs, deploymentJob.Properties, deploymentManifest.Properties, deploymentManifest.Name, stage)
+	networkInterfaces, err := deploymentManifest.NetworkInterfaces(deploymentJob.Name, instanceID)
 	if err != nil {
-		return nil, bosherr.WrapErrorf(err, "Rendering job templates for instance '%s/%d'", jobName, instanceID)
+		return nil, bosherr.WrapErrorf(err, "Finding networks for job '%s", jobName)
 	}
 
-	compiledPackageRefs, err := b.jobDependencyCompiler.Compile(releaseJobs, stage)
+	templateInstance := bitemplate.Instance{
+		Name:     jobName,
+		ID:       b.instanceUUID(deploymentManifest.Name, jobName, instanceID),
+		Index:    instanceID,
+		Networks: b.templateNetworks(deploymentJob, networkInterfaces),
+	}
+
+	renderedJobTemplates, err := b.renderJobTemplates(releaseJobs, deploymentJob.Properties, deploymentManifest.Properties, deploymentManifest.Name, templateInstance, stage)
 	if err != nil {
-		return nil, bosherr.WrapErrorf(err, "Compiling job package dependencies for instance '%s/%d'", jobName, instanceID)
+		return nil, bosherr.WrapErrorf(err, "Rendering job templates for instance '%s/%d'", jobName, instanceID)
 	}
 
-	networkInterfaces, err := deploymentManifest.NetworkInterfaces(deploymentJob.Name)
+	compiledPackageRefs, err := b.jobDependencyCompiler.Compile(releaseJobs, stage)
 	if err != nil {
-		return nil, bosherr.WrapErrorf(err, "Finding networks for job '%s", jobName)
+		return nil, bosherr.WrapErrorf(err, "Compiling job package dependencies for instance '%s/%d'", jobName, instanceID)
 	}
 
 	// convert map to array
@@ -137,12 +148,53 @@ func (b *builder) resolveJobs(jobRefs []bideplmanifest.ReleaseJobRef) ([]bireljo
 	return releaseJobs, nil
 }
 
+// instanceUUID returns an instance ID that stays the same across deploys of the deployment
+func (b *builder) instanceUUID(deploymentName string, jobName string, instanceID int) string {
+	id, err := gouuid.NewV5(gouuid.NamespaceURL, []byte(fmt.Sprintf("bosh-init://%s/%s/%d", deploymentName, jobName, instanceID)))
+	if err != nil {
+		// only fails when the namespace is invalid
+		panic(err)
+	}
+	return id.String()
+}
+
+// templateNetworks returns copies of the network interfaces that list the networks that are the default for dns and gateway.
+// A job with a single network uses it as the default for both.
+func (b *builder) templateNetworks(deploymentJob bideplmanifest.Job, networkInterfaces map[string]biproperty.Map) map[string]biproperty.Map {
+	networks := map[string]biproperty.Map{}
+	for _, jobNetwork := range deploymentJob.Networks {
+		networkInterface, found := networkInterfaces[jobNetwork.Name]
+		if !found {
+			continue
+		}
+
+		network := biproperty.Map{}
+		for key, value := range networkInterface {
+			network[key] = value
+		}
+
+		defaults := []string{}
+		if len(deploymentJob.Networks) == 1 {
+			defaults = []string{string(bideplmanifest.NetworkDefaultDNS), string(bideplmanifest.NetworkDefaultGateway)}
+		} else {
+			for _, networkDefault := range jobNetwork.Default {
+				defaults = append(defaults, string(networkDefault))
+			}
+		}
+		network["default"] = defaults
+
+		networks[jobNetwork.Name] = network
+	}
+	return networks
+}
+
 // renderJobTemplates renders all the release job templates for multiple release jobs specified by a deployment job
 func (b *builder) renderJobTemplates(
 	releaseJobs []bireljob.Job,
 	jobProperties biproperty.Map,
 	globalProperties biproperty.Map,
 	deploymentName string,
+	templateInstance bitemplate.Instance,
 	stage biui.Stage,
 ) (renderedJobs, error) {
 	var (
@@ -150,7 +202,7 @@ func (b *builder) renderJobTemplates(
 		blobID                 string
 	)
 	err := stage.Perform("Rendering job templates", func() error {
-		renderedJobList, err := b.jobListRenderer.Render(releaseJobs, jobProperties, globalProperties, deploymentName)
+		renderedJobList, err := b.jobListRenderer.Render(releaseJobs, jobProperties, globalProperties, deploymentName, templateInstance)
 		if err != nil {
 			return err
 		}
@@ -20,6 +20,7 @@ import (
 	bireljob "github.com/cloudfoundry/bosh-init/release/job"
 	birelpkg "github.com/cloudfoundry/bosh-init/release/pkg"
 	bistatejob "github.com/cloudfoundry/bosh-init/state/job"
+	bitemplate "github.com/cloudfoundry/bosh-init/templatescompiler"
 
 	fakebiui "github.com/cloudfoundry/bosh-init/ui/fakes"
 )
@@ -190,7 +191,22 @@ func describeBuilder() {
 			globalProperties := biproperty.Map{
 				"fake-job-property": "fake-global-property-value",
 			}
-			mockJobListRenderer.EXPECT().Render(releaseJobs, jobProperties, globalProperties, "fake-deployment-name").Return(mockRenderedJobList, nil)
+			templateInstance := bitemplate.Instance{
+				Name:  "fake-deployment-job-name",
+				ID:    "bbe3b797-7a62-56fd-5fc6-019906d49e71",
+				Index: 0,
+				Networks: map[string]biproperty.Map{
+					"fake-network-name": biproperty.Map{
+						"ip":   "fake-network-ip",
+						"type": "fake-network-type",
+						"cloud_properties": biproperty.Map{
+							"fake-network-cloud-property": "fake-network-cloud-property-value",
+						},
+						"default": []string{"dns", "gateway"},
+					},
+				},
+			}
+			mockJobListRenderer.EXPECT().Render(releaseJobs, jobProperties, globalProperties, "fake-deployment-name", templateInstance).Return(mockRenderedJobList, nil)
 
 			mockRenderedJobList.EXPECT().DeleteSilently()
 
@@ -5,12 +5,13 @@ import (
 
 	bidisk "github.com/cloudfoundry/bosh-init/deployment/disk"
 	biinstance "github.com/cloudfoundry/bosh-init/deployment/instance"
+	bideplmanifest "github.com/cloudfoundry/bosh-init/deployment/manifest"
 	bistemcell "github.com/cloudfoundry/bosh-init/stemcell"
 	biui "github.com/cloudfoundry/bosh-init/ui"
 )
 
 type Manager interface {
-	FindCurrent() (deployment Deployment, found bool, err error)
+	FindCurrent(deploymentManifest bideplmanifest.Manifest) (deployment Deployment, found bool, err error)
 	Cleanup(biui.Stage) error
 }
 
@@ -35,8 +36,8 @@ func NewManager(
 	}
 }
 
-func (m *manager) FindCurrent() (deployment Deployment, found bool, err error) {
-	instances, err := m.instanceManager.FindCurrent()
+func (m *manager) FindCurrent(deploymentManifest bideplmanifest.Manifest) (deployment Deployment, found bool, err error) {
+	instances, err := m.instanceManager.FindCurrent(deploymentManifest)
 	if err != nil {
 		return nil, false, bosherr.WrapError(err, "Finding current deployment instances")
 	}
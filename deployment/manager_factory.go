@@ -3,15 +3,15 @@ package deployment
 import (
 	biblobstore "github.com/cloudfoundry/bosh-init/blobstore"
 	bicloud "github.com/cloudfoundry/bosh-init/cloud"
-	biagentclient "github.com/cloudfoundry/bosh-init/deployment/agentclient"
 	bidisk "github.com/cloudfoundry/bosh-init/deployment/disk"
 	biinstance "github.com/cloudfoundry/bosh-init/deployment/instance"
 	bivm "github.com/cloudfoundry/bosh-init/deployment/vm"
+	biinstallmanifest "github.com/cloudfoundry/bosh-init/installation/manifest"
 	bistemcell "github.com/cloudfoundry/bosh-init/stemcell"
 )
 
 type ManagerFactory interface {
-	NewManager(bicloud.Cloud, biagentclient.AgentClient, biblobstore.Blobstore) Manager
+	NewManager(cloud bicloud.Cloud, directorID string, mbusURL string, mbusCert biinstallmanifest.Cert, blobstore biblobstore.Blobstore) Manager
 }
 
 type managerFactory struct {
@@ -38,8 +38,8 @@ func NewManagerFactory(
 	}
 }
 
-func (f *managerFactory) NewManager(cloud bicloud.Cloud, agentClient biagentclient.AgentClient, blobstore biblobstore.Blobstore) Manager {
-	vmManager := f.vmManagerFactory.NewManager(cloud, agentClient)
+func (f *managerFactory) NewManager(cloud bicloud.Cloud, directorID string, mbusURL string, mbusCert biinstallmanifest.Cert, blobstore biblobstore.Blobstore) Manager {
+	vmManager := f.vmManagerFactory.NewManager(cloud, directorID, mbusURL, mbusCert)
 	instanceManager := f.instanceManagerFactory.NewManager(cloud, vmManager, blobstore)
 	diskManager := f.diskManagerFactory.NewManager(cloud)
 	stemcellManager := f.stemcellManagerFactory.NewManager(cloud)
@@ -20,16 +20,22 @@ import (
 	boshsys "github.com/cloudfoundry/bosh-agent/system"
 
 	fakesys "github.com/cloudfoundry/bosh-agent/system/fakes"
+	faketime "github.com/cloudfoundry/bosh-agent/time/fakes"
 	fakeuuid "github.com/cloudfoundry/bosh-agent/uuid/fakes"
 
 	bicloud "github.com/cloudfoundry/bosh-init/cloud"
 	biconfig "github.com/cloudfoundry/bosh-init/config"
+	bicrypto "github.com/cloudfoundry/bosh-init/crypto"
 	bidisk "github.com/cloudfoundry/bosh-init/deployment/disk"
 	biinstance "github.com/cloudfoundry/bosh-init/deployment/instance"
+	bideplmanifest "github.com/cloudfoundry/bosh-init/deployment/manifest"
 	bisshtunnel "github.com/cloudfoundry/bosh-init/deployment/sshtunnel"
 	bivm "github.com/cloudfoundry/bosh-init/deployment/vm"
+	biinstallmanifest "github.com/cloudfoundry/bosh-init/installation/manifest"
 	bistemcell "github.com/cloudfoundry/bosh-init/stemcell"
 
+	fakebiblobstore "github.com/cloudfoundry/bosh-init/blobstore/fakes"
+	fakebihttpagent "github.com/cloudfoundry/bosh-init/deployment/agentclient/http/fakes"
 	fakebiui "github.com/cloudfoundry/bosh-init/ui/fakes"
 )
 
@@ -52,7 +58,8 @@ var _ = Describe("Manager", func() {
 			mockDeploymentFactory *mock_deployment.MockFactory
 			mockDeployment        *mock_deployment.MockDeployment
 
-			deploymentManager Manager
+			deploymentManager  Manager
+			deploymentManifest bideplmanifest.Manifest
 
 			expectedInstances []biinstance.Instance
 			expectedDisks     []bidisk.Disk
@@ -68,13 +75,19 @@ var _ = Describe("Manager", func() {
 			mockDeploymentFactory = mock_deployment.NewMockFactory(mockCtrl)
 			mockDeployment = mock_deployment.NewMockDeployment(mockCtrl)
 
+			deploymentManifest = bideplmanifest.Manifest{
+				Jobs: []bideplmanifest.Job{
+					{Name: "fake-job-name"},
+				},
+			}
+
 			expectedInstances = []biinstance.Instance{}
 			expectedDisks = []bidisk.Disk{}
 			expectedStemcells = []bistemcell.CloudStemcell{}
 		})
 
 		JustBeforeEach(func() {
-			mockInstanceManager.EXPECT().FindCurrent().Return(expectedInstances, nil)
+			mockInstanceManager.EXPECT().FindCurrent(deploymentManifest).Return(expectedInstances, nil)
 			mockDiskManager.EXPECT().FindCurrent().Return(expectedDisks, nil)
 			mockStemcellManager.EXPECT().FindCurrent().Return(expectedStemcells, nil)
 
@@ -85,7 +98,7 @@ var _ = Describe("Manager", func() {
 
 		Context("when no current instances, disks, or stemcells exist", func() {
 			It("returns not found", func() {
-				_, found, err := deploymentManager.FindCurrent()
+				_, found, err := deploymentManager.FindCurrent(deploymentManifest)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(found).To(BeFalse())
 			})
@@ -100,7 +113,7 @@ var _ = Describe("Manager", func() {
 			It("returns a deployment that wraps the current instances, disks, & stemcells", func() {
 				expectNewDeployment.Times(1)
 
-				deployment, found, err := deploymentManager.FindCurrent()
+				deployment, found, err := deploymentManager.FindCurrent(deploymentManifest)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(found).To(BeTrue())
 				Expect(deployment).To(Equal(mockDeployment))
@@ -116,7 +129,7 @@ var _ = Describe("Manager", func() {
 			It("returns a deployment that wraps the current instances, disks, & stemcells", func() {
 				expectNewDeployment.Times(1)
 
-				deployment, found, err := deploymentManager.FindCurrent()
+				deployment, found, err := deploymentManager.FindCurrent(deploymentManifest)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(found).To(BeTrue())
 				Expect(deployment).To(Equal(mockDeployment))
@@ -132,7 +145,7 @@ var _ = Describe("Manager", func() {
 			It("returns a deployment that wraps the current instances, disks, & stemcells", func() {
 				expectNewDeployment.Times(1)
 
-				deployment, found, err := deploymentManager.FindCurrent()
+				deployment, found, err := deploymentManager.FindCurrent(deploymentManifest)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(found).To(BeTrue())
 				Expect(deployment).To(Equal(mockDeployment))
@@ -175,7 +188,7 @@ var _ = Describe("Manager", func() {
 			mockDeploymentFactory = mock_deployment.NewMockFactory(mockCtrl)
 
 			fakeUUIDGenerator = fakeuuid.NewFakeGenerator()
-			deploymentConfigService = biconfig.NewFileSystemDeploymentConfigService(fs, fakeUUIDGenerator, logger)
+			deploymentConfigService = biconfig.NewFileSystemDeploymentConfigService(fs, fakeUUIDGenerator, &faketime.FakeService{}, bicrypto.NewEncryptor(nil), logger)
 			deploymentConfigService.SetConfigPath(deploymentConfigPath)
 
 			fakeRepoUUIDGenerator = fakeuuid.NewFakeGenerator()
@@ -193,19 +206,21 @@ var _ = Describe("Manager", func() {
 			diskManagerFactory := bidisk.NewManagerFactory(diskRepo, logger)
 			diskDeployer := bivm.NewDiskDeployer(diskManagerFactory, diskRepo, logger)
 
-			vmManagerFactory := bivm.NewManagerFactory(vmRepo, stemcellRepo, diskDeployer, fakeUUIDGenerator, fs, logger)
+			fakeAgentClientFactory := fakebihttpagent.NewFakeAgentClientFactory()
+			fakeAgentClientFactory.CreateAgentClient = mockAgentClient
+			vmManagerFactory := bivm.NewManagerFactory(vmRepo, stemcellRepo, diskDeployer, fakeAgentClientFactory, fakeUUIDGenerator, &faketime.FakeService{}, fs, logger)
 			sshTunnelFactory := bisshtunnel.NewFactory(logger)
 
 			mockStateBuilderFactory = mock_instance_state.NewMockBuilderFactory(mockCtrl)
 
 			instanceFactory := biinstance.NewFactory(mockStateBuilderFactory)
-			instanceManagerFactory := biinstance.NewManagerFactory(sshTunnelFactory, instanceFactory, logger)
+			instanceManagerFactory := biinstance.NewManagerFactory(fakebiblobstore.NewFakeBlobstoreFactory(), sshTunnelFactory, instanceFactory, logger)
 			stemcellManagerFactory := bistemcell.NewManagerFactory(stemcellRepo)
 
 			mockBlobstore = mock_blobstore.NewMockBlobstore(mockCtrl)
 
 			deploymentManagerFactory := NewManagerFactory(vmManagerFactory, instanceManagerFactory, diskManagerFactory, stemcellManagerFactory, mockDeploymentFactory)
-			deploymentManager = deploymentManagerFactory.NewManager(mockCloud, mockAgentClient, mockBlobstore)
+			deploymentManager = deploymentManagerFactory.NewManager(mockCloud, "fake-director-id", "https://fake-mbus-host:6868", biinstallmanifest.Cert{}, mockBlobstore)
 		})
 
 		Context("no orphan disk or stemcell records exist", func() {
@@ -218,8 +233,9 @@ var _ = Describe("Manager", func() {
 				var err error
 				currentDiskRecord, err = diskRepo.Save("fake-disk-cid", 100, nil)
 				Expect(err).ToNot(HaveOccurred())
-				err = diskRepo.UpdateCurrent(currentDiskRecord.ID)
+				err = diskRepo.UpdateCurrent("fake-job-name", 0, currentDiskRecord.ID)
 				Expect(err).ToNot(HaveOccurred())
+				currentDiskRecord.JobName = "fake-job-name"
 
 				currentStemcellRecord, err = stemcellRepo.Save("fake-stemcell-name", "fake-stemcell-version", "fake-stemcell-cid")
 				Expect(err).ToNot(HaveOccurred())
@@ -231,10 +247,9 @@ var _ = Describe("Manager", func() {
 				err := deploymentManager.Cleanup(fakeStage)
 				Expect(err).ToNot(HaveOccurred())
 
-				diskRecord, found, err := diskRepo.FindCurrent()
+				diskRecords, err := diskRepo.FindCurrent()
 				Expect(err).ToNot(HaveOccurred())
-				Expect(found).To(BeTrue())
-				Expect(diskRecord).To(Equal(currentDiskRecord))
+				Expect(diskRecords).To(Equal([]biconfig.DiskRecord{currentDiskRecord}))
 
 				stemcellRecord, found, err := stemcellRepo.FindCurrent()
 				Expect(err).ToNot(HaveOccurred())
@@ -0,0 +1,41 @@
+package fakes
+
+import (
+	bosherr "github.com/cloudfoundry/bosh-agent/errors"
+
+	bideplmanifest "github.com/cloudfoundry/bosh-init/deployment/manifest"
+)
+
+type FakeJobPropertiesValidator struct {
+	ValidateInputs  []ValidateInput
+	validateOutputs []JobPropertiesValidateOutput
+}
+
+func NewFakeJobPropertiesValidator() *FakeJobPropertiesValidator {
+	return &FakeJobPropertiesValidator{
+		ValidateInputs:  []ValidateInput{},
+		validateOutputs: []JobPropertiesValidateOutput{},
+	}
+}
+
+type JobPropertiesValidateOutput struct {
+	MissingProperties []bideplmanifest.MissingProperty
+	Err               error
+}
+
+func (v *FakeJobPropertiesValidator) Validate(manifest bideplmanifest.Manifest) ([]bideplmanifest.MissingProperty, error) {
+	v.ValidateInputs = append(v.ValidateInputs, ValidateInput{
+		Manifest: manifest,
+	})
+
+	if len(v.validateOutputs) == 0 {
+		return nil, bosherr.Errorf("Unexpected FakeJobPropertiesValidator.Validate(manifest) called with manifest: %#v", manifest)
+	}
+	validateOutput := v.validateOutputs[0]
+	v.validateOutputs = v.validateOutputs[1:]
+	return validateOutput.MissingProperties, validateOutput.Err
+}
+
+func (v *FakeJobPropertiesValidator) SetValidateBehavior(outputs []JobPropertiesValidateOutput) {
+	v.validateOutputs = outputs
+}
@@ -0,0 +1,110 @@
+package manifest
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/cloudfoundry-incubator/candiedyaml"
+
+	bosherr "github.com/cloudfoundry/bosh-agent/errors"
+	boshsys "github.com/cloudfoundry/bosh-agent/system"
+)
+
+// Fingerprinter flattens a manifest into a map of value paths (e.g. 'jobs[0].properties.foo')
+// to the HMAC of the value at that path, so that changes can be located without storing the values themselves.
+// The HMAC is keyed with a random salt of the deployment, so that short secrets cannot be guessed from the fingerprints.
+type Fingerprinter interface {
+	NewSalt() (string, error)
+	Fingerprint(path string, salt string) (map[string]string, error)
+}
+
+type fingerprinter struct {
+	fs boshsys.FileSystem
+}
+
+func NewFingerprinter(fs boshsys.FileSystem) Fingerprinter {
+	return fingerprinter{
+		fs: fs,
+	}
+}
+
+func (f fingerprinter) NewSalt() (string, error) {
+	salt := make([]byte, 32)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", bosherr.WrapError(err, "Generating fingerprint salt")
+	}
+
+	return hex.EncodeToString(salt), nil
+}
+
+func (f fingerprinter) Fingerprint(path string, salt string) (map[string]string, error) {
+	contents, err := f.fs.ReadFile(path)
+	if err != nil {
+		return map[string]string{}, bosherr.WrapErrorf(err, "Reading file %s", path)
+	}
+
+	fingerprints := map[string]string{}
+	if strings.TrimSpace(string(contents)) == "" {
+		return fingerprints, nil
+	}
+
+	var rawManifest interface{}
+	err = candiedyaml.Unmarshal(contents, &rawManifest)
+	if err != nil {
+		return map[string]string{}, bosherr.WrapError(err, "Unmarshalling manifest")
+	}
+
+	f.flatten("", rawManifest, []byte(salt), fingerprints)
+
+	return fingerprints, nil
+}
+
+func (f fingerprinter) flatten(path string, value interface{}, salt []byte, fingerprints map[string]string) {
+	switch typedValue := value.(type) {
+	case map[interface{}]interface{}:
+		if len(typedValue) == 0 {
+			fingerprints[path] = f.hmac(salt, "{}")
+			return
+		}
+
+		keys := make([]string, 0, len(typedValue))
+		values := map[string]interface{}{}
+		for key, nestedValue := range typedValue {
+			keyString := fmt.Sprintf("%v", key)
+			keys = append(keys, keyString)
+			values[keyString] = nestedValue
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			nestedPath := key
+			if path != "" {
+				nestedPath = fmt.Sprintf("%s.%s", path, key)
+			}
+			f.flatten(nestedPath, values[key], salt, fingerprints)
+		}
+	case []interface{}:
+		if len(typedValue) == 0 {
+			fingerprints[path] = f.hmac(salt, "[]")
+			return
+		}
+
+		for i, nestedValue := range typedValue {
+			f.flatten(fmt.Sprintf("%s[%d]", path, i), nestedValue, salt, fingerprints)
+		}
+	default:
+		fingerprints[path] = f.hmac(salt, fmt.Sprintf("%#v", typedValue))
+	}
+}
+
+func (f fingerprinter) hmac(salt []byte, value string) string {
+	mac := hmac.New(sha256.New, salt)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,127 @@
+package manifest_test
+
+import (
+	"crypto/sha1"
+	"errors"
+	"fmt"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/cloudfoundry/bosh-init/deployment/manifest"
+
+	fakesys "github.com/cloudfoundry/bosh-agent/system/fakes"
+)
+
+var _ = Describe("Fingerprinter", func() {
+	var (
+		manifestPath  string
+		fakeFs        *fakesys.FakeFileSystem
+		fingerprinter Fingerprinter
+	)
+
+	BeforeEach(func() {
+		manifestPath = "fake-deployment-path"
+		fakeFs = fakesys.NewFakeFileSystem()
+		fingerprinter = NewFingerprinter(fakeFs)
+
+		fakeFs.WriteFileString(manifestPath, `---
+name: fake-deployment-name
+resource_pools: []
+jobs:
+- name: fake-job-name
+  properties:
+    foo: fake-foo
+    bar:
+      baz: 5
+`)
+	})
+
+	It("returns a fingerprint for every value path", func() {
+		fingerprints, err := fingerprinter.Fingerprint(manifestPath, "fake-salt")
+		Expect(err).ToNot(HaveOccurred())
+
+		keys := []string{}
+		for key := range fingerprints {
+			keys = append(keys, key)
+		}
+		Expect(keys).To(ConsistOf(
+			"name",
+			"resource_pools",
+			"jobs[0].name",
+			"jobs[0].properties.foo",
+			"jobs[0].properties.bar.baz",
+		))
+	})
+
+	It("returns the same fingerprints for the same values", func() {
+		fingerprints, err := fingerprinter.Fingerprint(manifestPath, "fake-salt")
+		Expect(err).ToNot(HaveOccurred())
+
+		fakeFs.WriteFileString("other-deployment-path", `---
+jobs:
+- properties:
+    bar:
+      baz: 5
+    foo: fake-other-foo
+  name: fake-job-name
+resource_pools: []
+name: fake-deployment-name
+`)
+		otherFingerprints, err := fingerprinter.Fingerprint("other-deployment-path", "fake-salt")
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(otherFingerprints["jobs[0].properties.bar.baz"]).To(Equal(fingerprints["jobs[0].properties.bar.baz"]))
+		Expect(otherFingerprints["name"]).To(Equal(fingerprints["name"]))
+		Expect(otherFingerprints["jobs[0].properties.foo"]).ToNot(Equal(fingerprints["jobs[0].properties.foo"]))
+	})
+
+	It("returns different fingerprints for the same values with a different salt", func() {
+		fingerprints, err := fingerprinter.Fingerprint(manifestPath, "fake-salt")
+		Expect(err).ToNot(HaveOccurred())
+
+		otherFingerprints, err := fingerprinter.Fingerprint(manifestPath, "fake-other-salt")
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(otherFingerprints["name"]).ToNot(Equal(fingerprints["name"]))
+	})
+
+	It("does not return the plain sha1 of a value", func() {
+		fingerprints, err := fingerprinter.Fingerprint(manifestPath, "fake-salt")
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(fingerprints["jobs[0].properties.foo"]).ToNot(Equal(fmt.Sprintf("%x", sha1.Sum([]byte(`"fake-foo"`)))))
+	})
+
+	It("returns no fingerprints for an empty manifest", func() {
+		fakeFs.WriteFileString(manifestPath, "")
+
+		fingerprints, err := fingerprinter.Fingerprint(manifestPath, "fake-salt")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fingerprints).To(BeEmpty())
+	})
+
+	Describe("NewSalt", func() {
+		It("returns a new random salt", func() {
+			salt, err := fingerprinter.NewSalt()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(salt).To(MatchRegexp("^[0-9a-f]{64}$"))
+
+			otherSalt, err := fingerprinter.NewSalt()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(otherSalt).ToNot(Equal(salt))
+		})
+	})
+
+	Context("when reading the manifest fails", func() {
+		BeforeEach(func() {
+			fakeFs.ReadFileError = errors.New("fake-read-file-error")
+		})
+
+		It("returns an error", func() {
+			_, err := fingerprinter.Fingerprint(manifestPath, "fake-salt")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("fake-read-file-error"))
+		})
+	})
+})
@@ -10,6 +10,7 @@ type Job struct {
 	Lifecycle          JobLifecycle
 	Templates          []ReleaseJobRef
 	Networks           []JobNetwork
+	ResourcePool       string
 	PersistentDisk     int
 	PersistentDiskPool string
 	Properties         biproperty.Map
@@ -0,0 +1,173 @@
+package manifest
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	bosherr "github.com/cloudfoundry/bosh-agent/errors"
+	boshlog "github.com/cloudfoundry/bosh-agent/logger"
+
+	biproperty "github.com/cloudfoundry/bosh-init/common/property"
+	bireljob "github.com/cloudfoundry/bosh-init/release/job"
+	birelset "github.com/cloudfoundry/bosh-init/release/set"
+)
+
+type JobPropertiesValidator interface {
+	// Validate returns an error for the properties that no release job defines,
+	// and returns the properties without a default that are not set
+	Validate(Manifest) ([]MissingProperty, error)
+}
+
+// MissingProperty is a property of a release job that has no default and is not set in the job or global properties
+type MissingProperty struct {
+	Path    string // full dotted path, e.g. 'jobs[0].properties.nats.password'
+	Job     string
+	Release string
+}
+
+func (p MissingProperty) String() string {
+	return fmt.Sprintf("%s is not set, and job '%s' in release '%s' has no default for it", p.Path, p.Job, p.Release)
+}
+
+type jobPropertiesValidator struct {
+	releaseResolver birelset.Resolver
+	logger          boshlog.Logger
+	logTag          string
+}
+
+// NewJobPropertiesValidator returns a Validator that checks the global and job properties of the manifest
+// against the property definitions in the specs of the release jobs used by each deployment job.
+// It reports properties that no release job defines.
+// Specs do not say which properties are required, as templates may check for optional properties with p?,
+// so properties without a default that are not set are returned to be reported as warnings.
+func NewJobPropertiesValidator(releaseResolver birelset.Resolver, logger boshlog.Logger) JobPropertiesValidator {
+	return &jobPropertiesValidator{
+		releaseResolver: releaseResolver,
+		logger:          logger,
+		logTag:          "jobPropertiesValidator",
+	}
+}
+
+func (v *jobPropertiesValidator) Validate(deploymentManifest Manifest) ([]MissingProperty, error) {
+	errs := []error{}
+	missingProperties := []MissingProperty{}
+
+	deploymentDefinitions := map[string]bireljob.PropertyDefinition{}
+	for idx, job := range deploymentManifest.Jobs {
+		jobDefinitions := map[string]bireljob.PropertyDefinition{}
+
+		for _, template := range job.Templates {
+			releaseJob, found := v.findReleaseJob(template)
+			if !found {
+				// reported by the deployment manifest validator
+				v.logger.Debug(v.logTag, "Skipping properties of unknown job '%s' in release '%s'", template.Name, template.Release)
+				continue
+			}
+
+			for _, name := range v.sortedDefinitionNames(releaseJob.Properties) {
+				definition := releaseJob.Properties[name]
+				jobDefinitions[name] = definition
+				deploymentDefinitions[name] = definition
+
+				if definition.Default != nil {
+					continue
+				}
+				if v.isSet(job.Properties, name) || v.isSet(deploymentManifest.Properties, name) {
+					continue
+				}
+				missingProperties = append(missingProperties, MissingProperty{
+					Path:    fmt.Sprintf("jobs[%d].properties.%s", idx, name),
+					Job:     template.Name,
+					Release: template.Release,
+				})
+			}
+		}
+
+		for _, path := range v.unknownProperties(job.Properties, "", jobDefinitions) {
+			errs = append(errs, bosherr.Errorf("jobs[%d].properties.%s is not a property of any of the job's templates", idx, path))
+		}
+	}
+
+	for _, path := range v.unknownProperties(deploymentManifest.Properties, "", deploymentDefinitions) {
+		errs = append(errs, bosherr.Errorf("properties.%s is not a property of any job template in the deployment", path))
+	}
+
+	if len(errs) > 0 {
+		return missingProperties, bosherr.NewMultiError(errs...)
+	}
+
+	return missingProperties, nil
+}
+
+func (v *jobPropertiesValidator) findReleaseJob(template ReleaseJobRef) (bireljob.Job, bool) {
+	release, err := v.releaseResolver.Find(template.Release)
+	if err != nil {
+		return bireljob.Job{}, false
+	}
+	return release.FindJobByName(template.Name)
+}
+
+// isSet returns true when the dotted property name has a non-nil value in the properties
+func (v *jobPropertiesValidator) isSet(properties biproperty.Map, name string) bool {
+	var ref biproperty.Property = properties
+	for _, key := range strings.Split(name, ".") {
+		propertyMap, isMap := ref.(biproperty.Map)
+		if !isMap {
+			return false
+		}
+		ref = propertyMap[key]
+		if ref == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// unknownProperties returns the dotted paths of the properties that are neither defined nor contain a defined property
+func (v *jobPropertiesValidator) unknownProperties(properties biproperty.Map, prefix string, definitions map[string]bireljob.PropertyDefinition) []string {
+	keys := make([]string, 0, len(properties))
+	for key := range properties {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	unknown := []string{}
+	for _, key := range keys {
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+
+		if _, defined := definitions[path]; defined {
+			continue
+		}
+
+		nestedProperties, isMap := properties[key].(biproperty.Map)
+		if isMap && v.hasDefinitionUnder(definitions, path) {
+			unknown = append(unknown, v.unknownProperties(nestedProperties, path, definitions)...)
+			continue
+		}
+
+		unknown = append(unknown, path)
+	}
+	return unknown
+}
+
+func (v *jobPropertiesValidator) hasDefinitionUnder(definitions map[string]bireljob.PropertyDefinition, path string) bool {
+	for name := range definitions {
+		if strings.HasPrefix(name, path+".") {
+			return true
+		}
+	}
+	return false
+}
+
+func (v *jobPropertiesValidator) sortedDefinitionNames(definitions map[string]bireljob.PropertyDefinition) []string {
+	names := make([]string, 0, len(definitions))
+	for name := range definitions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,146 @@
+package manifest_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	bosherr "github.com/cloudfoundry/bosh-agent/errors"
+	boshlog "github.com/cloudfoundry/bosh-agent/logger"
+
+	biproperty "github.com/cloudfoundry/bosh-init/common/property"
+	birel "github.com/cloudfoundry/bosh-init/release"
+	bireljob "github.com/cloudfoundry/bosh-init/release/job"
+	birelmanifest "github.com/cloudfoundry/bosh-init/release/manifest"
+	birelset "github.com/cloudfoundry/bosh-init/release/set"
+
+	fakebirel "github.com/cloudfoundry/bosh-init/release/fakes"
+
+	. "github.com/cloudfoundry/bosh-init/deployment/manifest"
+)
+
+var _ = Describe("JobPropertiesValidator", func() {
+	var (
+		logger         boshlog.Logger
+		releaseManager birel.Manager
+		validator      JobPropertiesValidator
+
+		deploymentManifest Manifest
+	)
+
+	BeforeEach(func() {
+		logger = boshlog.NewLogger(boshlog.LevelNone)
+		releaseManager = birel.NewManager(logger)
+
+		fakeRelease := fakebirel.New("fake-release-name", "1.0")
+		fakeRelease.ReleaseJobs = []bireljob.Job{
+			{
+				Name: "fake-job-1",
+				Properties: map[string]bireljob.PropertyDefinition{
+					"nats.user":     {},
+					"nats.password": {},
+					"port":          {Default: 8080},
+					"options":       {Default: biproperty.Map{}},
+				},
+			},
+			{
+				Name: "fake-job-2",
+				Properties: map[string]bireljob.PropertyDefinition{
+					"director.name": {},
+				},
+			},
+		}
+		releaseManager.Add(fakeRelease)
+
+		deploymentManifest = Manifest{
+			Name: "fake-deployment-name",
+			Jobs: []Job{
+				{
+					Name: "fake-deployment-job",
+					Templates: []ReleaseJobRef{
+						{Name: "fake-job-1", Release: "fake-release-name"},
+						{Name: "fake-job-2", Release: "fake-release-name"},
+					},
+					Properties: biproperty.Map{
+						"nats": biproperty.Map{
+							"password": "fake-password",
+						},
+						"options": biproperty.Map{
+							"any": "value",
+						},
+					},
+				},
+			},
+			Properties: biproperty.Map{
+				"nats": biproperty.Map{
+					"user": "fake-user",
+				},
+				"director": biproperty.Map{
+					"name": "fake-director-name",
+				},
+			},
+		}
+	})
+
+	JustBeforeEach(func() {
+		releaseResolver := birelset.NewResolver(releaseManager, logger)
+		err := releaseResolver.Filter([]birelmanifest.ReleaseRef{{Name: "fake-release-name", Version: "1.0"}})
+		Expect(err).ToNot(HaveOccurred())
+		validator = NewJobPropertiesValidator(releaseResolver, logger)
+	})
+
+	Describe("Validate", func() {
+		It("does not error when every property without a default is set in the job or global properties", func() {
+			missingProperties, err := validator.Validate(deploymentManifest)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(missingProperties).To(BeEmpty())
+		})
+
+		It("returns, but does not error on, properties without a default that are not set", func() {
+			deploymentManifest.Jobs[0].Properties = biproperty.Map{}
+			deploymentManifest.Properties = biproperty.Map{
+				"nats": biproperty.Map{
+					"user": nil,
+				},
+			}
+
+			missingProperties, err := validator.Validate(deploymentManifest)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(missingProperties).To(Equal([]MissingProperty{
+				{Path: "jobs[0].properties.nats.password", Job: "fake-job-1", Release: "fake-release-name"},
+				{Path: "jobs[0].properties.nats.user", Job: "fake-job-1", Release: "fake-release-name"},
+				{Path: "jobs[0].properties.director.name", Job: "fake-job-2", Release: "fake-release-name"},
+			}))
+			Expect(missingProperties[0].String()).To(Equal("jobs[0].properties.nats.password is not set, and job 'fake-job-1' in release 'fake-release-name' has no default for it"))
+		})
+
+		It("reports all unknown job and global properties with their full path", func() {
+			deploymentManifest.Jobs[0].Properties["nats"].(biproperty.Map)["port"] = 4222
+			deploymentManifest.Jobs[0].Properties["unknown"] = "value"
+			deploymentManifest.Properties["director"] = "not-a-map"
+
+			_, err := validator.Validate(deploymentManifest)
+			Expect(err).To(Equal(bosherr.NewMultiError(
+				bosherr.Error("jobs[0].properties.nats.port is not a property of any of the job's templates"),
+				bosherr.Error("jobs[0].properties.unknown is not a property of any of the job's templates"),
+				bosherr.Error("properties.director is not a property of any job template in the deployment"),
+			)))
+		})
+
+		It("skips templates that do not refer to a job in an available release", func() {
+			deploymentManifest.Jobs[0].Templates = []ReleaseJobRef{
+				{Name: "fake-job-2", Release: "fake-release-name"},
+				{Name: "missing-job", Release: "missing-release"},
+			}
+			deploymentManifest.Jobs[0].Properties = biproperty.Map{}
+			deploymentManifest.Properties = biproperty.Map{
+				"director": biproperty.Map{
+					"name": "fake-director-name",
+				},
+			}
+
+			_, err := validator.Validate(deploymentManifest)
+			Expect(err).ToNot(HaveOccurred())
+		})
+	})
+})
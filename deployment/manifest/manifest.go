@@ -21,8 +21,9 @@ type Update struct {
 
 // NetworkInterfaces returns a map of network names to network interfaces.
 // We can't use map[string]NetworkInterface, because it's impossible to down-cast to what the cloud client requires.
+// Each instance of the job gets the static IP at its index.
 //TODO: refactor to NetworkInterfaces(Job) and use FindJobByName before using (then remove error)
-func (d Manifest) NetworkInterfaces(jobName string) (map[string]biproperty.Map, error) {
+func (d Manifest) NetworkInterfaces(jobName string, instanceID int) (map[string]biproperty.Map, error) {
 	job, found := d.FindJobByName(jobName)
 	if !found {
 		return map[string]biproperty.Map{}, bosherr.Errorf("Could not find job with name: %s", jobName)
@@ -34,8 +35,8 @@ func (d Manifest) NetworkInterfaces(jobName string) (map[string]biproperty.Map,
 	for _, jobNetwork := range job.Networks {
 		network := networkMap[jobNetwork.Name]
 		staticIPs := jobNetwork.StaticIPs
-		if len(staticIPs) > 0 {
-			network.IP = staticIPs[0]
+		if len(staticIPs) > instanceID {
+			network.IP = staticIPs[instanceID]
 		}
 		ifaceMap[jobNetwork.Name] = network.Interface()
 	}
@@ -43,6 +44,30 @@ func (d Manifest) NetworkInterfaces(jobName string) (map[string]biproperty.Map,
 	return ifaceMap, nil
 }
 
+// ResourcePool returns the resource pool of the job.
+// The job may omit its resource pool when the deployment has only one.
+func (d Manifest) ResourcePool(jobName string) (ResourcePool, error) {
+	job, found := d.FindJobByName(jobName)
+	if !found {
+		return ResourcePool{}, bosherr.Errorf("Could not find job with name: %s", jobName)
+	}
+
+	if job.ResourcePool == "" {
+		if len(d.ResourcePools) == 1 {
+			return d.ResourcePools[0], nil
+		}
+		return ResourcePool{}, bosherr.Errorf("Job '%s' must specify a resource pool", jobName)
+	}
+
+	for _, resourcePool := range d.ResourcePools {
+		if resourcePool.Name == job.ResourcePool {
+			return resourcePool, nil
+		}
+	}
+
+	return ResourcePool{}, bosherr.Errorf("Could not find resource pool '%s' for job '%s'", job.ResourcePool, jobName)
+}
+
 func (d Manifest) DiskPool(jobName string) (DiskPool, error) {
 	job, found := d.FindJobByName(jobName)
 	if !found {
@@ -78,6 +103,16 @@ func (d Manifest) networkMap() map[string]Network {
 	return result
 }
 
+// LegacyJobName returns the name of the job of a vm recorded before multiple instances were supported, which has no job name.
+// Such a deployment had a single job with a single instance, which is the first instance of the first job of the manifest.
+func (d Manifest) LegacyJobName() string {
+	if len(d.Jobs) == 0 {
+		return "unknown"
+	}
+
+	return d.Jobs[0].Name
+}
+
 func (d Manifest) FindJobByName(jobName string) (Job, bool) {
 	for _, job := range d.Jobs {
 		if job.Name == jobName {
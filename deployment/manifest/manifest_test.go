@@ -63,7 +63,7 @@ var _ = Describe("Manifest", func() {
 			})
 
 			It("is a map of the network names to network interfaces", func() {
-				Expect(deploymentManifest.NetworkInterfaces("fake-job-name")).To(Equal(map[string]biproperty.Map{
+				Expect(deploymentManifest.NetworkInterfaces("fake-job-name", 0)).To(Equal(map[string]biproperty.Map{
 					"fake-network-name": biproperty.Map{
 						"type":             "dynamic",
 						"ip":               "5.6.7.8",
@@ -81,6 +81,15 @@ var _ = Describe("Manifest", func() {
 					},
 				}))
 			})
+
+			It("uses the static IP at the index of the instance", func() {
+				deploymentManifest.Jobs[0].Networks[1].StaticIPs = []string{"5.6.7.8", "5.6.7.10"}
+
+				networkInterfaces, err := deploymentManifest.NetworkInterfaces("fake-job-name", 1)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(networkInterfaces["fake-network-name"]["ip"]).To(Equal("5.6.7.10"))
+				Expect(networkInterfaces["vip"]["ip"]).To(Equal(""))
+			})
 		})
 
 		Context("when the deployment does not have networks", func() {
@@ -96,7 +105,7 @@ var _ = Describe("Manifest", func() {
 			})
 
 			It("is an empty map", func() {
-				Expect(deploymentManifest.NetworkInterfaces("fake-job-name")).To(Equal(map[string]biproperty.Map{}))
+				Expect(deploymentManifest.NetworkInterfaces("fake-job-name", 0)).To(Equal(map[string]biproperty.Map{}))
 			})
 		})
 
@@ -106,7 +115,7 @@ var _ = Describe("Manifest", func() {
 			})
 
 			It("returns an error", func() {
-				networkInterfaces, err := deploymentManifest.NetworkInterfaces("fake-job-name")
+				networkInterfaces, err := deploymentManifest.NetworkInterfaces("fake-job-name", 0)
 				Expect(networkInterfaces).To(Equal(map[string]biproperty.Map{}))
 				Expect(err).To(HaveOccurred())
 				Expect(err.Error()).To(ContainSubstring("Could not find job with name: fake-job-name"))
@@ -114,6 +123,61 @@ var _ = Describe("Manifest", func() {
 		})
 	})
 
+	Describe("ResourcePool", func() {
+		BeforeEach(func() {
+			deploymentManifest = Manifest{
+				ResourcePools: []ResourcePool{
+					{Name: "fake-resource-pool-name-1"},
+					{Name: "fake-resource-pool-name-2"},
+				},
+				Jobs: []Job{
+					{
+						Name:         "fake-job-name",
+						ResourcePool: "fake-resource-pool-name-2",
+					},
+				},
+			}
+		})
+
+		It("is the resource pool named by the job", func() {
+			resourcePool, err := deploymentManifest.ResourcePool("fake-job-name")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resourcePool).To(Equal(ResourcePool{Name: "fake-resource-pool-name-2"}))
+		})
+
+		Context("when the job does not name a resource pool", func() {
+			BeforeEach(func() {
+				deploymentManifest.Jobs[0].ResourcePool = ""
+			})
+
+			It("returns an error if there is more than one resource pool", func() {
+				_, err := deploymentManifest.ResourcePool("fake-job-name")
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(Equal("Job 'fake-job-name' must specify a resource pool"))
+			})
+
+			It("is the only resource pool if there is just one", func() {
+				deploymentManifest.ResourcePools = deploymentManifest.ResourcePools[:1]
+
+				resourcePool, err := deploymentManifest.ResourcePool("fake-job-name")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resourcePool).To(Equal(ResourcePool{Name: "fake-resource-pool-name-1"}))
+			})
+		})
+
+		Context("when the job names a resource pool that does not exist", func() {
+			BeforeEach(func() {
+				deploymentManifest.Jobs[0].ResourcePool = "fake-missing-resource-pool-name"
+			})
+
+			It("returns an error", func() {
+				_, err := deploymentManifest.ResourcePool("fake-job-name")
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(Equal("Could not find resource pool 'fake-missing-resource-pool-name' for job 'fake-job-name'"))
+			})
+		})
+	})
+
 	Describe("DiskPool", func() {
 		Context("when the deployment has disk_pools", func() {
 			BeforeEach(func() {
@@ -254,4 +318,23 @@ var _ = Describe("Manifest", func() {
 			})
 		})
 	})
+
+	Describe("LegacyJobName", func() {
+		It("is the name of the first job", func() {
+			deploymentManifest = Manifest{
+				Jobs: []Job{
+					{Name: "fake-job-name-1"},
+					{Name: "fake-job-name-2"},
+				},
+			}
+
+			Expect(deploymentManifest.LegacyJobName()).To(Equal("fake-job-name-1"))
+		})
+
+		It("is 'unknown' when the deployment has no jobs", func() {
+			deploymentManifest = Manifest{}
+
+			Expect(deploymentManifest.LegacyJobName()).To(Equal("unknown"))
+		})
+	})
 })
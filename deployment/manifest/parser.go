@@ -63,6 +63,7 @@ type job struct {
 	Lifecycle          string
 	Templates          []releaseJobRef
 	Networks           []jobNetwork
+	ResourcePool       string `yaml:"resource_pool"`
 	PersistentDisk     int    `yaml:"persistent_disk"`
 	PersistentDiskPool string `yaml:"persistent_disk_pool"`
 	Properties         map[interface{}]interface{}
@@ -172,6 +173,7 @@ func (p *parser) parseJobManifests(rawJobs []job) ([]Job, error) {
 			Name:               rawJob.Name,
 			Instances:          rawJob.Instances,
 			Lifecycle:          JobLifecycle(rawJob.Lifecycle),
+			ResourcePool:       rawJob.ResourcePool,
 			PersistentDisk:     rawJob.PersistentDisk,
 			PersistentDiskPool: rawJob.PersistentDiskPool,
 		}
@@ -84,6 +84,7 @@ jobs:
   networks:
   - name: vip
     static_ips: [1.2.3.4]
+  resource_pool: fake-resource-pool-name
   persistent_disk: 1024
   persistent_disk_pool: fake-disk-pool-name
   properties:
@@ -156,6 +157,7 @@ properties:
 							StaticIPs: []string{"1.2.3.4"},
 						},
 					},
+					ResourcePool:       "fake-resource-pool-name",
 					PersistentDisk:     1024,
 					PersistentDiskPool: "fake-disk-pool-name",
 					Properties: biproperty.Map{
@@ -41,8 +41,8 @@ func (v *validator) Validate(deploymentManifest Manifest) error {
 		}
 	}
 
-	if len(deploymentManifest.ResourcePools) != 1 {
-		errs = append(errs, bosherr.Error("resource_pools must be of size 1"))
+	if len(deploymentManifest.ResourcePools) == 0 {
+		errs = append(errs, bosherr.Error("resource_pools must contain at least one resource pool"))
 	}
 
 	for idx, resourcePool := range deploymentManifest.ResourcePools {
@@ -65,13 +65,21 @@ func (v *validator) Validate(deploymentManifest Manifest) error {
 		}
 	}
 
-	if len(deploymentManifest.Jobs) > 1 {
-		errs = append(errs, bosherr.Error("jobs must be of size 1"))
-	}
-
+	jobNames := map[string]struct{}{}
 	for idx, job := range deploymentManifest.Jobs {
 		if v.isBlank(job.Name) {
 			errs = append(errs, bosherr.Errorf("jobs[%d].name must be provided", idx))
+		} else if _, found := jobNames[job.Name]; found {
+			errs = append(errs, bosherr.Errorf("jobs[%d].name '%s' must be unique", idx, job.Name))
+		}
+		jobNames[job.Name] = struct{}{}
+
+		if v.isBlank(job.ResourcePool) {
+			if len(deploymentManifest.ResourcePools) > 1 {
+				errs = append(errs, bosherr.Errorf("jobs[%d].resource_pool must be provided when there is more than one resource pool", idx))
+			}
+		} else if _, ok := v.resourcePoolNames(deploymentManifest)[job.ResourcePool]; !ok {
+			errs = append(errs, bosherr.Errorf("jobs[%d].resource_pool must be the name of a resource pool", idx))
 		}
 		if job.PersistentDisk < 0 {
 			errs = append(errs, bosherr.Errorf("jobs[%d].persistent_disk must be >= 0", idx))
@@ -87,11 +95,19 @@ func (v *validator) Validate(deploymentManifest Manifest) error {
 		if len(job.Networks) == 0 {
 			errs = append(errs, bosherr.Errorf("jobs[%d].networks must be a non-empty array", idx))
 		}
+		hasStaticIPs := false
 		for networkIdx, jobNetwork := range job.Networks {
 			if v.isBlank(jobNetwork.Name) {
 				errs = append(errs, bosherr.Errorf("jobs[%d].networks[%d].name must be provided", idx, networkIdx))
 			}
 
+			if len(jobNetwork.StaticIPs) > 0 {
+				hasStaticIPs = true
+				if len(jobNetwork.StaticIPs) < job.Instances {
+					errs = append(errs, bosherr.Errorf("jobs[%d].networks[%d].static_ips must have an IP for each instance", idx, networkIdx))
+				}
+			}
+
 			for ipIdx, ip := range jobNetwork.StaticIPs {
 				if !v.isValidIP(ip) {
 					errs = append(errs, bosherr.Errorf("jobs[%d].networks[%d].static_ips[%d] must be a valid IP", idx, networkIdx, ipIdx))
@@ -105,8 +121,18 @@ func (v *validator) Validate(deploymentManifest Manifest) error {
 			}
 		}
 
-		if job.Lifecycle != "" && job.Lifecycle != JobLifecycleService {
-			errs = append(errs, bosherr.Errorf("jobs[%d].lifecycle must be 'service' ('%s' not supported)", idx, job.Lifecycle))
+		// only the agent of the first instance is reachable at the mbus URL; the others are reached at their static IP
+		if job.Instances > 0 && (idx > 0 || job.Instances > 1) && !hasStaticIPs {
+			errs = append(errs, bosherr.Errorf("jobs[%d].networks must have static_ips when the deployment has more than one instance", idx))
+		}
+
+		if job.Lifecycle != "" && job.Lifecycle != JobLifecycleService && job.Lifecycle != JobLifecycleErrand {
+			errs = append(errs, bosherr.Errorf("jobs[%d].lifecycle must be 'service' or 'errand' ('%s' not supported)", idx, job.Lifecycle))
+		}
+
+		// errand VMs are deleted after the errand runs, so they can not keep a persistent disk
+		if job.Lifecycle == JobLifecycleErrand && (job.PersistentDisk > 0 || job.PersistentDiskPool != "") {
+			errs = append(errs, bosherr.Errorf("jobs[%d].persistent_disk and persistent_disk_pool are not supported for errands", idx))
 		}
 
 		templateNames := map[string]struct{}{}
@@ -154,6 +180,14 @@ func (v *validator) networkNames(deploymentManifest Manifest) map[string]struct{
 	return names
 }
 
+func (v *validator) resourcePoolNames(deploymentManifest Manifest) map[string]struct{} {
+	names := make(map[string]struct{})
+	for _, resourcePool := range deploymentManifest.ResourcePools {
+		names[resourcePool.Name] = struct{}{}
+	}
+	return names
+}
+
 func (v *validator) diskPoolNames(deploymentManifest Manifest) map[string]struct{} {
 	names := make(map[string]struct{})
 	for _, diskPool := range deploymentManifest.DiskPools {
@@ -145,17 +145,14 @@ var _ = Describe("Validator", func() {
 			Expect(err.Error()).To(ContainSubstring("name must be provided"))
 		})
 
-		It("validates that there is only one resource pool", func() {
+		It("validates that there is at least one resource pool", func() {
 			deploymentManifest := Manifest{
-				ResourcePools: []ResourcePool{
-					{},
-					{},
-				},
+				ResourcePools: []ResourcePool{},
 			}
 
 			err := validator.Validate(deploymentManifest)
 			Expect(err).To(HaveOccurred())
-			Expect(err.Error()).To(ContainSubstring("resource_pools must be of size 1"))
+			Expect(err.Error()).To(ContainSubstring("resource_pools must contain at least one resource pool"))
 		})
 
 		It("validates resource pool name", func() {
@@ -304,17 +301,80 @@ var _ = Describe("Validator", func() {
 			Expect(err.Error()).To(ContainSubstring("networks[0].type must be 'manual', 'dynamic', or 'vip'"))
 		})
 
-		It("validates that there is only one job", func() {
+		It("permits multiple jobs with multiple instances", func() {
+			deploymentManifest := validManifest
+			deploymentManifest.ResourcePools = append(deploymentManifest.ResourcePools, ResourcePool{
+				Name:    "fake-other-resource-pool-name",
+				Network: "fake-network-name",
+			})
+
+			firstJob := validManifest.Jobs[0]
+			firstJob.Instances = 1
+			firstJob.ResourcePool = "fake-resource-pool-name"
+
+			secondJob := validManifest.Jobs[0]
+			secondJob.Name = "fake-other-job-name"
+			secondJob.Instances = 2
+			secondJob.ResourcePool = "fake-other-resource-pool-name"
+			secondJob.Networks = []JobNetwork{
+				{
+					Name:      "fake-network-name",
+					StaticIPs: []string{"127.0.0.2", "127.0.0.3"},
+				},
+			}
+
+			deploymentManifest.Jobs = []Job{firstJob, secondJob}
+
+			err := validator.Validate(deploymentManifest)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("validates job names are unique", func() {
+			deploymentManifest := Manifest{
+				Jobs: []Job{
+					{Name: "fake-job-name"},
+					{Name: "fake-job-name"},
+				},
+			}
+
+			err := validator.Validate(deploymentManifest)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("jobs[1].name 'fake-job-name' must be unique"))
+		})
+
+		It("validates job resource_pool", func() {
+			deploymentManifest := Manifest{
+				Jobs: []Job{
+					{
+						ResourcePool: "non-existent-resource-pool",
+					},
+				},
+				ResourcePools: []ResourcePool{
+					{
+						Name: "fake-resource-pool",
+					},
+				},
+			}
+
+			err := validator.Validate(deploymentManifest)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("jobs[0].resource_pool must be the name of a resource pool"))
+		})
+
+		It("validates job resource_pool is provided when there is more than one resource pool", func() {
 			deploymentManifest := Manifest{
 				Jobs: []Job{
-					{},
 					{},
 				},
+				ResourcePools: []ResourcePool{
+					{Name: "fake-resource-pool-1"},
+					{Name: "fake-resource-pool-2"},
+				},
 			}
 
 			err := validator.Validate(deploymentManifest)
 			Expect(err).To(HaveOccurred())
-			Expect(err.Error()).To(ContainSubstring("jobs must be of size 1"))
+			Expect(err.Error()).To(ContainSubstring("jobs[0].resource_pool must be provided when there is more than one resource pool"))
 		})
 
 		It("validates job name", func() {
@@ -443,6 +503,44 @@ var _ = Describe("Validator", func() {
 			Expect(err.Error()).To(ContainSubstring("jobs[0].networks[0].static_ips[0] must be a valid IP"))
 		})
 
+		It("validates job network static ips cover every instance", func() {
+			deploymentManifest := Manifest{
+				Jobs: []Job{
+					{
+						Instances: 2,
+						Networks: []JobNetwork{
+							{
+								StaticIPs: []string{"127.0.0.1"},
+							},
+						},
+					},
+				},
+			}
+
+			err := validator.Validate(deploymentManifest)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("jobs[0].networks[0].static_ips must have an IP for each instance"))
+		})
+
+		It("validates job networks have static ips when the deployment has more than one instance", func() {
+			deploymentManifest := Manifest{
+				Jobs: []Job{
+					{
+						Instances: 2,
+						Networks: []JobNetwork{
+							{
+								Name: "fake-network-name",
+							},
+						},
+					},
+				},
+			}
+
+			err := validator.Validate(deploymentManifest)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("jobs[0].networks must have static_ips when the deployment has more than one instance"))
+		})
+
 		It("validates job network default", func() {
 			deploymentManifest := Manifest{
 				Jobs: []Job{
@@ -467,14 +565,33 @@ var _ = Describe("Validator", func() {
 			deploymentManifest := Manifest{
 				Jobs: []Job{
 					{
-						Lifecycle: "errand",
+						Lifecycle: "fake-lifecycle",
 					},
 				},
 			}
 
 			err := validator.Validate(deploymentManifest)
 			Expect(err).To(HaveOccurred())
-			Expect(err.Error()).To(ContainSubstring("jobs[0].lifecycle must be 'service' ('errand' not supported)"))
+			Expect(err.Error()).To(ContainSubstring("jobs[0].lifecycle must be 'service' or 'errand' ('fake-lifecycle' not supported)"))
+		})
+
+		It("permits errand jobs", func() {
+			deploymentManifest := validManifest
+			deploymentManifest.Jobs[0].Lifecycle = JobLifecycleErrand
+			deploymentManifest.Jobs[0].PersistentDisk = 0
+
+			err := validator.Validate(deploymentManifest)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("validates that errand jobs do not have a persistent disk", func() {
+			deploymentManifest := validManifest
+			deploymentManifest.Jobs[0].Lifecycle = JobLifecycleErrand
+			deploymentManifest.Jobs[0].PersistentDisk = 1024
+
+			err := validator.Validate(deploymentManifest)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("jobs[0].persistent_disk and persistent_disk_pool are not supported for errands"))
 		})
 
 		It("permits job templates to reference an undeclared release", func() {
@@ -1,5 +1,5 @@
 // Automatically generated by MockGen. DO NOT EDIT!
-// Source: github.com/cloudfoundry/bosh-init/deployment (interfaces: Deployment,Factory,Deployer,Manager,ManagerFactory)
+// Source: github.com/cloudfoundry/bosh-init/deployment (interfaces: Deployment,Factory,Deployer,ErrandRunner,Manager,ManagerFactory)
 
 package mocks
 
@@ -112,6 +112,38 @@ func (_mr *_MockDeployerRecorder) Deploy(arg0, arg1, arg2, arg3, arg4, arg5, arg
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "Deploy", arg0, arg1, arg2, arg3, arg4, arg5, arg6, arg7)
 }
 
+// Mock of ErrandRunner interface
+type MockErrandRunner struct {
+	ctrl     *gomock.Controller
+	recorder *_MockErrandRunnerRecorder
+}
+
+// Recorder for MockErrandRunner (not exported)
+type _MockErrandRunnerRecorder struct {
+	mock *MockErrandRunner
+}
+
+func NewMockErrandRunner(ctrl *gomock.Controller) *MockErrandRunner {
+	mock := &MockErrandRunner{ctrl: ctrl}
+	mock.recorder = &_MockErrandRunnerRecorder{mock}
+	return mock
+}
+
+func (_m *MockErrandRunner) EXPECT() *_MockErrandRunnerRecorder {
+	return _m.recorder
+}
+
+func (_m *MockErrandRunner) Run(_param0 cloud.Cloud, _param1 string, _param2 manifest0.Manifest, _param3 stemcell.CloudStemcell, _param4 manifest.Registry, _param5 manifest.SSHTunnel, _param6 vm.Manager, _param7 blobstore.Blobstore, _param8 ui.Stage) (agentclient.ErrandResult, error) {
+	ret := _m.ctrl.Call(_m, "Run", _param0, _param1, _param2, _param3, _param4, _param5, _param6, _param7, _param8)
+	ret0, _ := ret[0].(agentclient.ErrandResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockErrandRunnerRecorder) Run(arg0, arg1, arg2, arg3, arg4, arg5, arg6, arg7, arg8 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Run", arg0, arg1, arg2, arg3, arg4, arg5, arg6, arg7, arg8)
+}
+
 // Mock of Manager interface
 type MockManager struct {
 	ctrl     *gomock.Controller
@@ -143,16 +175,16 @@ func (_mr *_MockManagerRecorder) Cleanup(arg0 interface{}) *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "Cleanup", arg0)
 }
 
-func (_m *MockManager) FindCurrent() (deployment.Deployment, bool, error) {
-	ret := _m.ctrl.Call(_m, "FindCurrent")
+func (_m *MockManager) FindCurrent(_param0 manifest0.Manifest) (deployment.Deployment, bool, error) {
+	ret := _m.ctrl.Call(_m, "FindCurrent", _param0)
 	ret0, _ := ret[0].(deployment.Deployment)
 	ret1, _ := ret[1].(bool)
 	ret2, _ := ret[2].(error)
 	return ret0, ret1, ret2
 }
 
-func (_mr *_MockManagerRecorder) FindCurrent() *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "FindCurrent")
+func (_mr *_MockManagerRecorder) FindCurrent(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "FindCurrent", arg0)
 }
 
 // Mock of ManagerFactory interface
@@ -176,12 +208,12 @@ func (_m *MockManagerFactory) EXPECT() *_MockManagerFactoryRecorder {
 	return _m.recorder
 }
 
-func (_m *MockManagerFactory) NewManager(_param0 cloud.Cloud, _param1 agentclient.AgentClient, _param2 blobstore.Blobstore) deployment.Manager {
-	ret := _m.ctrl.Call(_m, "NewManager", _param0, _param1, _param2)
+func (_m *MockManagerFactory) NewManager(_param0 cloud.Cloud, _param1 string, _param2 string, _param3 manifest.Cert, _param4 blobstore.Blobstore) deployment.Manager {
+	ret := _m.ctrl.Call(_m, "NewManager", _param0, _param1, _param2, _param3, _param4)
 	ret0, _ := ret[0].(deployment.Manager)
 	return ret0
 }
 
-func (_mr *_MockManagerFactoryRecorder) NewManager(arg0, arg1, arg2 interface{}) *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "NewManager", arg0, arg1, arg2)
+func (_mr *_MockManagerFactoryRecorder) NewManager(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "NewManager", arg0, arg1, arg2, arg3, arg4)
 }
@@ -0,0 +1,225 @@
+package fakes
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// FakeNATSServer is an in-process stand-in for a NATS server.
+// It supports exact subject matching and lets tests answer requests with handlers.
+type FakeNATSServer struct {
+	User     string
+	Password string
+
+	listener      net.Listener
+	lock          sync.Mutex
+	conns         map[*fakeConn]struct{}
+	handlers      map[string]func([]byte) []byte
+	publishedMsgs []PublishedMessage
+}
+
+type PublishedMessage struct {
+	Subject string
+	ReplyTo string
+	Payload []byte
+}
+
+type fakeConn struct {
+	conn          net.Conn
+	writeLock     sync.Mutex
+	subscriptions map[string]string
+}
+
+type connectOptions struct {
+	User string `json:"user"`
+	Pass string `json:"pass"`
+}
+
+func NewFakeNATSServer() *FakeNATSServer {
+	return &FakeNATSServer{
+		conns:    map[*fakeConn]struct{}{},
+		handlers: map[string]func([]byte) []byte{},
+	}
+}
+
+func (s *FakeNATSServer) Start() error {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+	s.listener = listener
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+
+	return nil
+}
+
+func (s *FakeNATSServer) Stop() {
+	if s.listener != nil {
+		s.listener.Close()
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for conn := range s.conns {
+		conn.conn.Close()
+	}
+}
+
+func (s *FakeNATSServer) Address() string {
+	return s.listener.Addr().String()
+}
+
+// URL returns the nats:// URL of the server, including the credentials if any are set
+func (s *FakeNATSServer) URL() string {
+	if s.User != "" {
+		return fmt.Sprintf("nats://%s:%s@%s", s.User, s.Password, s.Address())
+	}
+	return fmt.Sprintf("nats://%s", s.Address())
+}
+
+// RegisterHandler answers every message published on subject with the result of the handler
+func (s *FakeNATSServer) RegisterHandler(subject string, handler func(payload []byte) []byte) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.handlers[subject] = handler
+}
+
+func (s *FakeNATSServer) PublishedMessages() []PublishedMessage {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]PublishedMessage{}, s.publishedMsgs...)
+}
+
+// ConnectionCount returns the number of open client connections
+func (s *FakeNATSServer) ConnectionCount() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.conns)
+}
+
+func (s *FakeNATSServer) serve(netConn net.Conn) {
+	conn := &fakeConn{conn: netConn, subscriptions: map[string]string{}}
+
+	s.lock.Lock()
+	s.conns[conn] = struct{}{}
+	s.lock.Unlock()
+
+	defer func() {
+		s.lock.Lock()
+		delete(s.conns, conn)
+		s.lock.Unlock()
+		netConn.Close()
+	}()
+
+	conn.write(`INFO {"server_id":"fake-nats-server","auth_required":` + strconv.FormatBool(s.User != "") + "}\r\n")
+
+	reader := bufio.NewReader(netConn)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch strings.ToUpper(fields[0]) {
+		case "CONNECT":
+			var options connectOptions
+			json.Unmarshal([]byte(strings.TrimSpace(line[len("CONNECT"):])), &options)
+			if s.User != "" && (options.User != s.User || options.Pass != s.Password) {
+				conn.write("-ERR 'Authorization Violation'\r\n")
+				return
+			}
+		case "PING":
+			conn.write("PONG\r\n")
+		case "SUB":
+			if len(fields) == 3 {
+				s.lock.Lock()
+				conn.subscriptions[fields[2]] = fields[1]
+				s.lock.Unlock()
+			}
+		case "PUB":
+			if len(fields) != 3 && len(fields) != 4 {
+				conn.write("-ERR 'Unknown Protocol Operation'\r\n")
+				return
+			}
+			size, err := strconv.Atoi(fields[len(fields)-1])
+			if err != nil {
+				return
+			}
+			payload := make([]byte, size+2)
+			_, err = io.ReadFull(reader, payload)
+			if err != nil {
+				return
+			}
+
+			replyTo := ""
+			if len(fields) == 4 {
+				replyTo = fields[2]
+			}
+			s.publish(fields[1], replyTo, payload[:size])
+		}
+	}
+}
+
+func (s *FakeNATSServer) publish(subject string, replyTo string, payload []byte) {
+	s.lock.Lock()
+	s.publishedMsgs = append(s.publishedMsgs, PublishedMessage{Subject: subject, ReplyTo: replyTo, Payload: payload})
+	handler := s.handlers[subject]
+
+	type delivery struct {
+		conn *fakeConn
+		sid  string
+	}
+	deliveries := []delivery{}
+	for conn := range s.conns {
+		for sid, subscribedSubject := range conn.subscriptions {
+			if subscribedSubject == subject {
+				deliveries = append(deliveries, delivery{conn: conn, sid: sid})
+			}
+		}
+	}
+	s.lock.Unlock()
+
+	for _, d := range deliveries {
+		d.conn.deliver(subject, d.sid, replyTo, payload)
+	}
+
+	if handler != nil && replyTo != "" {
+		response := handler(payload)
+		if response != nil {
+			s.publish(replyTo, "", response)
+		}
+	}
+}
+
+func (c *fakeConn) deliver(subject string, sid string, replyTo string, payload []byte) {
+	if replyTo != "" {
+		c.write(fmt.Sprintf("MSG %s %s %s %d\r\n%s\r\n", subject, sid, replyTo, len(payload), payload))
+	} else {
+		c.write(fmt.Sprintf("MSG %s %s %d\r\n%s\r\n", subject, sid, len(payload), payload))
+	}
+}
+
+func (c *fakeConn) write(message string) {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	io.WriteString(c.conn, message)
+}
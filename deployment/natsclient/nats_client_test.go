@@ -0,0 +1,112 @@
+package natsclient_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	boshlog "github.com/cloudfoundry/bosh-agent/logger"
+
+	. "github.com/cloudfoundry/bosh-init/deployment/natsclient"
+
+	fakebinatsclient "github.com/cloudfoundry/bosh-init/deployment/natsclient/fakes"
+)
+
+var _ = Describe("NATSClient", func() {
+	var (
+		natsClient NATSClient
+		fakeServer *fakebinatsclient.FakeNATSServer
+		logger     boshlog.Logger
+	)
+
+	BeforeEach(func() {
+		logger = boshlog.NewLogger(boshlog.LevelNone)
+		fakeServer = fakebinatsclient.NewFakeNATSServer()
+	})
+
+	JustBeforeEach(func() {
+		err := fakeServer.Start()
+		Expect(err).ToNot(HaveOccurred())
+
+		natsClient = NewNATSClient(fakeServer.URL(), 1*time.Second, logger)
+	})
+
+	AfterEach(func() {
+		natsClient.Close()
+		fakeServer.Stop()
+	})
+
+	Describe("Request", func() {
+		It("publishes the payload and returns the reply", func() {
+			fakeServer.RegisterHandler("fake-subject", func(payload []byte) []byte {
+				return append([]byte("reply-to-"), payload...)
+			})
+
+			response, err := natsClient.Request("fake-subject", "fake-reply-to", []byte("fake-payload"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(response).To(Equal([]byte("reply-to-fake-payload")))
+
+			Expect(fakeServer.PublishedMessages()).To(ContainElement(fakebinatsclient.PublishedMessage{
+				Subject: "fake-subject",
+				ReplyTo: "fake-reply-to",
+				Payload: []byte("fake-payload"),
+			}))
+		})
+
+		It("reuses the connection for subsequent requests", func() {
+			fakeServer.RegisterHandler("fake-subject", func(payload []byte) []byte {
+				return payload
+			})
+
+			response, err := natsClient.Request("fake-subject", "fake-reply-to-1", []byte("fake-payload-1"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(response).To(Equal([]byte("fake-payload-1")))
+
+			response, err = natsClient.Request("fake-subject", "fake-reply-to-2", []byte("fake-payload-2"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(response).To(Equal([]byte("fake-payload-2")))
+		})
+
+		It("returns an error when no reply is received before the timeout", func() {
+			_, err := natsClient.Request("fake-unanswered-subject", "fake-reply-to", []byte("fake-payload"))
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Waiting for reply on 'fake-reply-to'"))
+		})
+
+		Context("when the server requires credentials", func() {
+			BeforeEach(func() {
+				fakeServer.User = "fake-user"
+				fakeServer.Password = "fake-password"
+				fakeServer.RegisterHandler("fake-subject", func(payload []byte) []byte {
+					return payload
+				})
+			})
+
+			It("authenticates with the credentials from the URL", func() {
+				response, err := natsClient.Request("fake-subject", "fake-reply-to", []byte("fake-payload"))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(response).To(Equal([]byte("fake-payload")))
+			})
+
+			It("returns an error without the credentials when they are wrong", func() {
+				natsClient = NewNATSClient("nats://fake-user:wrong-password@"+fakeServer.Address(), 1*time.Second, logger)
+
+				_, err := natsClient.Request("fake-subject", "fake-reply-to", []byte("fake-payload"))
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("Authorization Violation"))
+				Expect(err.Error()).To(ContainSubstring("Connecting to NATS server 'nats://" + fakeServer.Address() + "'"))
+				Expect(err.Error()).ToNot(ContainSubstring("wrong-password"))
+			})
+		})
+
+		It("returns an error when the server cannot be reached", func() {
+			fakeServer.Stop()
+			natsClient = NewNATSClient(fakeServer.URL(), 1*time.Second, logger)
+
+			_, err := natsClient.Request("fake-subject", "fake-reply-to", []byte("fake-payload"))
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Connecting to NATS server"))
+		})
+	})
+})
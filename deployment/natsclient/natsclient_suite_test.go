@@ -0,0 +1,13 @@
+package natsclient_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestNatsclient(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Natsclient Suite")
+}
@@ -0,0 +1,372 @@
+package deployment
+
+import (
+	"fmt"
+	"sort"
+
+	bosherr "github.com/cloudfoundry/bosh-agent/errors"
+
+	biconfig "github.com/cloudfoundry/bosh-init/config"
+	bicrypto "github.com/cloudfoundry/bosh-init/crypto"
+	bidisk "github.com/cloudfoundry/bosh-init/deployment/disk"
+	bideplmanifest "github.com/cloudfoundry/bosh-init/deployment/manifest"
+	birel "github.com/cloudfoundry/bosh-init/release"
+	bistemcell "github.com/cloudfoundry/bosh-init/stemcell"
+)
+
+// Plan describes the changes a deploy would make, without making them
+type Plan struct {
+	Changes []string
+}
+
+func (p Plan) IsEmpty() bool {
+	return len(p.Changes) == 0
+}
+
+// Planner compares the deployment record against a new manifest, stemcell & releases.
+// It only reads the deployment record, it does not call the CPI or the agent.
+type Planner interface {
+	Plan(
+		manifestPath string,
+		deploymentManifest bideplmanifest.Manifest,
+		releases []birel.Release,
+		stemcell bistemcell.ExtractedStemcell,
+	) (Plan, error)
+}
+
+type planner struct {
+	deploymentRecord Record
+	deploymentRepo   biconfig.DeploymentRepo
+	releaseRepo      biconfig.ReleaseRepo
+	stemcellRepo     biconfig.StemcellRepo
+	vmRepo           biconfig.VMRepo
+	diskRepo         biconfig.DiskRepo
+	sha1Calculator   bicrypto.SHA1Calculator
+	fingerprinter    bideplmanifest.Fingerprinter
+}
+
+func NewPlanner(
+	deploymentRecord Record,
+	deploymentRepo biconfig.DeploymentRepo,
+	releaseRepo biconfig.ReleaseRepo,
+	stemcellRepo biconfig.StemcellRepo,
+	vmRepo biconfig.VMRepo,
+	diskRepo biconfig.DiskRepo,
+	sha1Calculator bicrypto.SHA1Calculator,
+	fingerprinter bideplmanifest.Fingerprinter,
+) Planner {
+	return &planner{
+		deploymentRecord: deploymentRecord,
+		deploymentRepo:   deploymentRepo,
+		releaseRepo:      releaseRepo,
+		stemcellRepo:     stemcellRepo,
+		vmRepo:           vmRepo,
+		diskRepo:         diskRepo,
+		sha1Calculator:   sha1Calculator,
+		fingerprinter:    fingerprinter,
+	}
+}
+
+func (p *planner) Plan(
+	manifestPath string,
+	deploymentManifest bideplmanifest.Manifest,
+	releases []birel.Release,
+	stemcell bistemcell.ExtractedStemcell,
+) (Plan, error) {
+	plan := Plan{Changes: []string{}}
+
+	isDeployed, err := p.deploymentRecord.IsDeployed(manifestPath, releases, stemcell)
+	if err != nil {
+		return plan, bosherr.WrapError(err, "Checking if deployment has changed")
+	}
+
+	if isDeployed {
+		return plan, nil
+	}
+
+	stemcellChanges, err := p.planStemcell(stemcell)
+	if err != nil {
+		return plan, err
+	}
+	plan.Changes = append(plan.Changes, stemcellChanges...)
+
+	releaseChanges, err := p.planReleases(releases)
+	if err != nil {
+		return plan, err
+	}
+	plan.Changes = append(plan.Changes, releaseChanges...)
+
+	manifestChanges, err := p.planManifest(manifestPath)
+	if err != nil {
+		return plan, err
+	}
+	plan.Changes = append(plan.Changes, manifestChanges...)
+
+	vmChanges, err := p.planVMs(deploymentManifest)
+	if err != nil {
+		return plan, err
+	}
+	plan.Changes = append(plan.Changes, vmChanges...)
+
+	diskChanges, err := p.planDisks(deploymentManifest)
+	if err != nil {
+		return plan, err
+	}
+	plan.Changes = append(plan.Changes, diskChanges...)
+
+	return plan, nil
+}
+
+func (p *planner) planStemcell(stemcell bistemcell.ExtractedStemcell) ([]string, error) {
+	newStemcell := stemcell.Manifest()
+
+	currentStemcell, found, err := p.stemcellRepo.FindCurrent()
+	if err != nil {
+		return []string{}, bosherr.WrapError(err, "Finding currently deployed stemcell")
+	}
+
+	if !found {
+		return []string{fmt.Sprintf("Stemcell '%s/%s' will be uploaded", newStemcell.Name, newStemcell.Version)}, nil
+	}
+
+	if currentStemcell.Name != newStemcell.Name {
+		return []string{fmt.Sprintf("Stemcell '%s/%s' will be replaced by '%s/%s'", currentStemcell.Name, currentStemcell.Version, newStemcell.Name, newStemcell.Version)}, nil
+	}
+
+	if currentStemcell.Version != newStemcell.Version {
+		return []string{fmt.Sprintf("Stemcell '%s' %s → %s", newStemcell.Name, currentStemcell.Version, newStemcell.Version)}, nil
+	}
+
+	return []string{}, nil
+}
+
+func (p *planner) planReleases(releases []birel.Release) ([]string, error) {
+	changes := []string{}
+
+	currentReleaseRecords, err := p.releaseRepo.List()
+	if err != nil {
+		return changes, bosherr.WrapError(err, "Finding currently deployed releases")
+	}
+
+	currentVersions := map[string]string{}
+	for _, releaseRecord := range currentReleaseRecords {
+		currentVersions[releaseRecord.Name] = releaseRecord.Version
+	}
+
+	newVersions := map[string]string{}
+	for _, release := range releases {
+		newVersions[release.Name()] = release.Version()
+
+		currentVersion, found := currentVersions[release.Name()]
+		if !found {
+			changes = append(changes, fmt.Sprintf("Release '%s/%s' will be added", release.Name(), release.Version()))
+		} else if currentVersion != release.Version() {
+			changes = append(changes, fmt.Sprintf("Release '%s' %s → %s", release.Name(), currentVersion, release.Version()))
+		}
+	}
+
+	for _, releaseRecord := range currentReleaseRecords {
+		if _, found := newVersions[releaseRecord.Name]; !found {
+			changes = append(changes, fmt.Sprintf("Release '%s/%s' will be removed", releaseRecord.Name, releaseRecord.Version))
+		}
+	}
+
+	return changes, nil
+}
+
+func (p *planner) planManifest(manifestPath string) ([]string, error) {
+	currentSHA1, found, err := p.deploymentRepo.FindCurrent()
+	if err != nil {
+		return []string{}, bosherr.WrapError(err, "Finding sha1 of currently deployed manifest")
+	}
+
+	if !found {
+		return []string{}, nil
+	}
+
+	newSHA1, err := p.sha1Calculator.Calculate(manifestPath)
+	if err != nil {
+		return []string{}, bosherr.WrapError(err, "Calculating sha1 of current deployment manifest")
+	}
+
+	if currentSHA1 == newSHA1 {
+		return []string{}, nil
+	}
+
+	currentFingerprints, salt, found, err := p.deploymentRepo.FindCurrentFingerprints()
+	if err != nil {
+		return []string{}, bosherr.WrapError(err, "Finding fingerprints of currently deployed manifest")
+	}
+
+	if !found {
+		return []string{"Deployment manifest changed (changed values are unknown, because the deployed manifest was not fingerprinted)"}, nil
+	}
+
+	newFingerprints, err := p.fingerprinter.Fingerprint(manifestPath, salt)
+	if err != nil {
+		return []string{}, bosherr.WrapError(err, "Calculating fingerprints of current deployment manifest")
+	}
+
+	changes := []string{}
+	for _, path := range p.sortedPaths(currentFingerprints, newFingerprints) {
+		currentFingerprint, foundCurrent := currentFingerprints[path]
+		newFingerprint, foundNew := newFingerprints[path]
+
+		if !foundCurrent {
+			changes = append(changes, fmt.Sprintf("Deployment manifest added '%s'", path))
+		} else if !foundNew {
+			changes = append(changes, fmt.Sprintf("Deployment manifest removed '%s'", path))
+		} else if currentFingerprint != newFingerprint {
+			changes = append(changes, fmt.Sprintf("Deployment manifest changed under '%s'", path))
+		}
+	}
+
+	return changes, nil
+}
+
+// planVMs plans the vm of every instance. Deploy always replaces the current VMs when anything has changed.
+func (p *planner) planVMs(deploymentManifest bideplmanifest.Manifest) ([]string, error) {
+	vmRecords, err := p.vmRepo.FindCurrent()
+	if err != nil {
+		return []string{}, bosherr.WrapError(err, "Finding current VMs")
+	}
+
+	changes := []string{}
+	for _, job := range deploymentManifest.Jobs {
+		if job.Lifecycle == bideplmanifest.JobLifecycleErrand {
+			continue
+		}
+
+		for index := 0; index < job.Instances; index++ {
+			vmRecord, found := p.findVMRecord(vmRecords, deploymentManifest, job.Name, index)
+			if found {
+				changes = append(changes, fmt.Sprintf("VM '%s' will be recreated", vmRecord.CID))
+			} else {
+				changes = append(changes, fmt.Sprintf("VM for instance '%s/%d' will be created", job.Name, index))
+			}
+		}
+	}
+
+	for _, vmRecord := range vmRecords {
+		if !p.isInManifest(vmRecord, deploymentManifest) {
+			changes = append(changes, fmt.Sprintf("VM '%s' will be deleted", vmRecord.CID))
+		}
+	}
+
+	return changes, nil
+}
+
+func (p *planner) planDisks(deploymentManifest bideplmanifest.Manifest) ([]string, error) {
+	changes := []string{}
+	for _, job := range deploymentManifest.Jobs {
+		if job.Lifecycle == bideplmanifest.JobLifecycleErrand {
+			continue
+		}
+
+		diskPool, err := deploymentManifest.DiskPool(job.Name)
+		if err != nil {
+			return []string{}, bosherr.WrapError(err, "Getting disk pool")
+		}
+
+		if diskPool.DiskSize == 0 {
+			continue
+		}
+
+		for index := 0; index < job.Instances; index++ {
+			diskChanges, err := p.planDisk(job.Name, index, diskPool)
+			if err != nil {
+				return []string{}, err
+			}
+			changes = append(changes, diskChanges...)
+		}
+	}
+
+	return changes, nil
+}
+
+func (p *planner) planDisk(jobName string, index int, diskPool bideplmanifest.DiskPool) ([]string, error) {
+	diskRecord, found, err := p.diskRepo.FindCurrentForInstance(jobName, index)
+	if err != nil {
+		return []string{}, bosherr.WrapErrorf(err, "Finding current disk of instance '%s/%d'", jobName, index)
+	}
+
+	if !found {
+		return []string{fmt.Sprintf("Disk of size %s will be created for instance '%s/%d'", p.formatDiskSize(diskPool.DiskSize), jobName, index)}, nil
+	}
+
+	disk := bidisk.NewDisk(diskRecord, nil, nil)
+	if !disk.NeedsMigration(diskPool.DiskSize, diskPool.CloudProperties) {
+		return []string{}, nil
+	}
+
+	if diskRecord.Size != diskPool.DiskSize {
+		return []string{fmt.Sprintf("Disk '%s' will be migrated from %s to %s", diskRecord.CID, p.formatDiskSize(diskRecord.Size), p.formatDiskSize(diskPool.DiskSize))}, nil
+	}
+
+	return []string{fmt.Sprintf("Disk '%s' will be migrated to a disk with new cloud properties", diskRecord.CID)}, nil
+}
+
+// findVMRecord finds the vm of an instance.
+// A vm recorded before multiple instances were supported belongs to the first instance of the first job.
+func (p *planner) findVMRecord(vmRecords []biconfig.VMRecord, deploymentManifest bideplmanifest.Manifest, jobName string, index int) (biconfig.VMRecord, bool) {
+	for _, vmRecord := range vmRecords {
+		if vmRecord.JobName == jobName && vmRecord.Index == index {
+			return vmRecord, true
+		}
+	}
+
+	if index == 0 && deploymentManifest.Jobs[0].Name == jobName {
+		for _, vmRecord := range vmRecords {
+			if vmRecord.JobName == "" && vmRecord.Index == 0 {
+				return vmRecord, true
+			}
+		}
+	}
+
+	return biconfig.VMRecord{}, false
+}
+
+func (p *planner) isInManifest(vmRecord biconfig.VMRecord, deploymentManifest bideplmanifest.Manifest) bool {
+	if len(deploymentManifest.Jobs) == 0 {
+		return false
+	}
+
+	if vmRecord.JobName == "" {
+		firstJob := deploymentManifest.Jobs[0]
+		return vmRecord.Index == 0 && firstJob.Instances > 0 && firstJob.Lifecycle != bideplmanifest.JobLifecycleErrand
+	}
+
+	// errand vms left behind by an interrupted run-errand are deleted
+	for _, job := range deploymentManifest.Jobs {
+		if job.Name == vmRecord.JobName {
+			return vmRecord.Index < job.Instances && job.Lifecycle != bideplmanifest.JobLifecycleErrand
+		}
+	}
+
+	return false
+}
+
+func (p *planner) sortedPaths(fingerprints ...map[string]string) []string {
+	uniquePaths := map[string]struct{}{}
+	for _, fingerprintMap := range fingerprints {
+		for path := range fingerprintMap {
+			uniquePaths[path] = struct{}{}
+		}
+	}
+
+	paths := make([]string, 0, len(uniquePaths))
+	for path := range uniquePaths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	return paths
+}
+
+// formatDiskSize formats a disk size in MB (as specified in the manifest)
+func (p *planner) formatDiskSize(size int) string {
+	if size%1024 == 0 {
+		return fmt.Sprintf("%dGB", size/1024)
+	}
+	return fmt.Sprintf("%dMB", size)
+}
@@ -0,0 +1,317 @@
+package deployment_test
+
+import (
+	. "github.com/cloudfoundry/bosh-init/deployment"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	boshlog "github.com/cloudfoundry/bosh-agent/logger"
+	fakesys "github.com/cloudfoundry/bosh-agent/system/fakes"
+	faketime "github.com/cloudfoundry/bosh-agent/time/fakes"
+	fakeuuid "github.com/cloudfoundry/bosh-agent/uuid/fakes"
+
+	biproperty "github.com/cloudfoundry/bosh-init/common/property"
+	biconfig "github.com/cloudfoundry/bosh-init/config"
+	bicrypto "github.com/cloudfoundry/bosh-init/crypto"
+	fakebicrypto "github.com/cloudfoundry/bosh-init/crypto/fakes"
+	bideplmanifest "github.com/cloudfoundry/bosh-init/deployment/manifest"
+	birel "github.com/cloudfoundry/bosh-init/release"
+	fakebirel "github.com/cloudfoundry/bosh-init/release/fakes"
+	bistemcell "github.com/cloudfoundry/bosh-init/stemcell"
+)
+
+var _ = Describe("Planner", func() {
+	var (
+		fakeFs             *fakesys.FakeFileSystem
+		fakeSHA1Calculator *fakebicrypto.FakeSha1Calculator
+		stemcellRepo       biconfig.StemcellRepo
+		vmRepo             biconfig.VMRepo
+		diskRepo           biconfig.DiskRepo
+		deploymentRepo     biconfig.DeploymentRepo
+		record             Record
+
+		manifestPath       string
+		deploymentManifest bideplmanifest.Manifest
+		releases           []birel.Release
+		stemcell           bistemcell.ExtractedStemcell
+
+		planner Planner
+	)
+
+	BeforeEach(func() {
+		logger := boshlog.NewLogger(boshlog.LevelNone)
+		fakeFs = fakesys.NewFakeFileSystem()
+		fakeUUIDGenerator := fakeuuid.NewFakeGenerator()
+
+		configService := biconfig.NewFileSystemDeploymentConfigService(fakeFs, fakeUUIDGenerator, &faketime.FakeService{}, bicrypto.NewEncryptor(nil), logger)
+		configService.SetConfigPath("/deployment.json")
+
+		deploymentRepo = biconfig.NewDeploymentRepo(configService)
+		releaseRepo := biconfig.NewReleaseRepo(configService, fakeUUIDGenerator)
+		stemcellRepo = biconfig.NewStemcellRepo(configService, fakeUUIDGenerator)
+		vmRepo = biconfig.NewVMRepo(configService)
+		diskRepo = biconfig.NewDiskRepo(configService, fakeUUIDGenerator)
+		fakeSHA1Calculator = fakebicrypto.NewFakeSha1Calculator()
+		fingerprinter := bideplmanifest.NewFingerprinter(fakeFs)
+
+		record = NewRecord(deploymentRepo, releaseRepo, stemcellRepo, fakeSHA1Calculator, fingerprinter)
+		planner = NewPlanner(record, deploymentRepo, releaseRepo, stemcellRepo, vmRepo, diskRepo, fakeSHA1Calculator, fingerprinter)
+
+		manifestPath = "/deployment.yml"
+		fakeSHA1Calculator.SetCalculateBehavior(map[string]fakebicrypto.CalculateInput{
+			manifestPath: {Sha1: "fake-manifest-sha1"},
+		})
+		fakeFs.WriteFileString(manifestPath, `---
+name: fake-deployment-name
+jobs:
+- name: fake-job-name
+  persistent_disk: 10240
+  properties:
+    foo: fake-foo
+`)
+		deploymentManifest = bideplmanifest.Manifest{
+			Name: "fake-deployment-name",
+			Jobs: []bideplmanifest.Job{
+				{
+					Name:           "fake-job-name",
+					Instances:      1,
+					PersistentDisk: 10240,
+				},
+			},
+		}
+
+		releases = []birel.Release{
+			&fakebirel.FakeRelease{ReleaseName: "fake-release-name", ReleaseVersion: "1"},
+		}
+
+		stemcell = bistemcell.NewExtractedStemcell(
+			bistemcell.Manifest{
+				Name:    "fake-stemcell-name",
+				Version: "1",
+			},
+			"fake-extracted-path",
+			fakeFs,
+		)
+	})
+
+	Context("when nothing has been deployed", func() {
+		It("plans to create everything", func() {
+			plan, err := planner.Plan(manifestPath, deploymentManifest, releases, stemcell)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(plan.Changes).To(Equal([]string{
+				"Stemcell 'fake-stemcell-name/1' will be uploaded",
+				"Release 'fake-release-name/1' will be added",
+				"VM for instance 'fake-job-name/0' will be created",
+				"Disk of size 10GB will be created for instance 'fake-job-name/0'",
+			}))
+		})
+	})
+
+	Context("when the deployment has been deployed", func() {
+		BeforeEach(func() {
+			stemcellRecord, err := stemcellRepo.Save("fake-stemcell-name", "1", "fake-stemcell-cid")
+			Expect(err).ToNot(HaveOccurred())
+			err = stemcellRepo.UpdateCurrent(stemcellRecord.ID)
+			Expect(err).ToNot(HaveOccurred())
+
+			err = vmRepo.UpdateCurrent(biconfig.VMRecord{CID: "fake-vm-cid", JobName: "fake-job-name", Index: 0})
+			Expect(err).ToNot(HaveOccurred())
+
+			diskRecord, err := diskRepo.Save("fake-disk-cid", 10240, biproperty.Map{})
+			Expect(err).ToNot(HaveOccurred())
+			err = diskRepo.UpdateCurrent("fake-job-name", 0, diskRecord.ID)
+			Expect(err).ToNot(HaveOccurred())
+
+			err = record.Update(manifestPath, releases)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		Context("when nothing has changed", func() {
+			It("returns an empty plan", func() {
+				plan, err := planner.Plan(manifestPath, deploymentManifest, releases, stemcell)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(plan.IsEmpty()).To(BeTrue())
+			})
+		})
+
+		Context("when the stemcell and releases have new versions", func() {
+			BeforeEach(func() {
+				releases = []birel.Release{
+					&fakebirel.FakeRelease{ReleaseName: "fake-release-name", ReleaseVersion: "2"},
+				}
+				stemcell = bistemcell.NewExtractedStemcell(
+					bistemcell.Manifest{
+						Name:    "fake-stemcell-name",
+						Version: "2",
+					},
+					"fake-extracted-path",
+					fakeFs,
+				)
+			})
+
+			It("plans to upgrade them and recreate the VM", func() {
+				plan, err := planner.Plan(manifestPath, deploymentManifest, releases, stemcell)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(plan.Changes).To(Equal([]string{
+					"Stemcell 'fake-stemcell-name' 1 → 2",
+					"Release 'fake-release-name' 1 → 2",
+					"VM 'fake-vm-cid' will be recreated",
+				}))
+			})
+		})
+
+		Context("when a release was removed", func() {
+			BeforeEach(func() {
+				releases = []birel.Release{
+					&fakebirel.FakeRelease{ReleaseName: "fake-other-release-name", ReleaseVersion: "1"},
+				}
+			})
+
+			It("plans to add and remove releases", func() {
+				plan, err := planner.Plan(manifestPath, deploymentManifest, releases, stemcell)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(plan.Changes).To(ContainElement("Release 'fake-other-release-name/1' will be added"))
+				Expect(plan.Changes).To(ContainElement("Release 'fake-release-name/1' will be removed"))
+			})
+		})
+
+		Context("when the manifest properties and disk size have changed", func() {
+			BeforeEach(func() {
+				fakeFs.WriteFileString(manifestPath, `---
+name: fake-deployment-name
+jobs:
+- name: fake-job-name
+  persistent_disk: 20480
+  properties:
+    foo: fake-new-foo
+    bar: fake-bar
+`)
+				fakeSHA1Calculator.SetCalculateBehavior(map[string]fakebicrypto.CalculateInput{
+					manifestPath: {Sha1: "fake-new-manifest-sha1"},
+				})
+				deploymentManifest.Jobs[0].PersistentDisk = 20480
+			})
+
+			It("reports the changed paths and the disk migration", func() {
+				plan, err := planner.Plan(manifestPath, deploymentManifest, releases, stemcell)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(plan.Changes).To(Equal([]string{
+					"Deployment manifest changed under 'jobs[0].persistent_disk'",
+					"Deployment manifest added 'jobs[0].properties.bar'",
+					"Deployment manifest changed under 'jobs[0].properties.foo'",
+					"VM 'fake-vm-cid' will be recreated",
+					"Disk 'fake-disk-cid' will be migrated from 10GB to 20GB",
+				}))
+			})
+		})
+
+		Context("when the manifest was fingerprinted without a salt by an older version", func() {
+			BeforeEach(func() {
+				err := deploymentRepo.UpdateCurrentFingerprints(map[string]string{"name": "fake-unsalted-sha1"}, "")
+				Expect(err).ToNot(HaveOccurred())
+
+				fakeFs.WriteFileString(manifestPath, "---\nname: fake-new-deployment-name\n")
+				fakeSHA1Calculator.SetCalculateBehavior(map[string]fakebicrypto.CalculateInput{
+					manifestPath: {Sha1: "fake-new-manifest-sha1"},
+				})
+			})
+
+			It("reports that the changed values are unknown", func() {
+				plan, err := planner.Plan(manifestPath, deploymentManifest, releases, stemcell)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(plan.Changes).To(ContainElement("Deployment manifest changed (changed values are unknown, because the deployed manifest was not fingerprinted)"))
+			})
+		})
+
+		Context("when the number of instances has increased", func() {
+			BeforeEach(func() {
+				fakeSHA1Calculator.SetCalculateBehavior(map[string]fakebicrypto.CalculateInput{
+					manifestPath: {Sha1: "fake-new-manifest-sha1"},
+				})
+				deploymentManifest.Jobs[0].Instances = 2
+			})
+
+			It("plans to recreate the existing VM and create the new instance", func() {
+				plan, err := planner.Plan(manifestPath, deploymentManifest, releases, stemcell)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(plan.Changes).To(Equal([]string{
+					"VM 'fake-vm-cid' will be recreated",
+					"VM for instance 'fake-job-name/1' will be created",
+					"Disk of size 10GB will be created for instance 'fake-job-name/1'",
+				}))
+			})
+		})
+
+		Context("when the job has been removed", func() {
+			BeforeEach(func() {
+				fakeSHA1Calculator.SetCalculateBehavior(map[string]fakebicrypto.CalculateInput{
+					manifestPath: {Sha1: "fake-new-manifest-sha1"},
+				})
+				deploymentManifest.Jobs[0].Name = "fake-other-job-name"
+			})
+
+			It("plans to delete the VM of the removed job", func() {
+				plan, err := planner.Plan(manifestPath, deploymentManifest, releases, stemcell)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(plan.Changes).To(ContainElement("VM for instance 'fake-other-job-name/0' will be created"))
+				Expect(plan.Changes).To(ContainElement("VM 'fake-vm-cid' will be deleted"))
+			})
+		})
+
+		Context("when an errand job has been added", func() {
+			BeforeEach(func() {
+				fakeSHA1Calculator.SetCalculateBehavior(map[string]fakebicrypto.CalculateInput{
+					manifestPath: {Sha1: "fake-new-manifest-sha1"},
+				})
+				deploymentManifest.Jobs = append(deploymentManifest.Jobs, bideplmanifest.Job{
+					Name:      "fake-errand-name",
+					Lifecycle: bideplmanifest.JobLifecycleErrand,
+					Instances: 1,
+				})
+			})
+
+			It("does not plan a VM for the errand", func() {
+				plan, err := planner.Plan(manifestPath, deploymentManifest, releases, stemcell)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(plan.Changes).To(Equal([]string{
+					"VM 'fake-vm-cid' will be recreated",
+				}))
+			})
+
+			Context("when a VM of the errand was left behind", func() {
+				BeforeEach(func() {
+					err := vmRepo.UpdateCurrent(biconfig.VMRecord{CID: "fake-errand-vm-cid", JobName: "fake-errand-name", Index: 0})
+					Expect(err).ToNot(HaveOccurred())
+				})
+
+				It("plans to delete it", func() {
+					plan, err := planner.Plan(manifestPath, deploymentManifest, releases, stemcell)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(plan.Changes).To(ContainElement("VM 'fake-errand-vm-cid' will be deleted"))
+				})
+			})
+		})
+
+		Context("when the VM was recorded before multiple instances were supported", func() {
+			BeforeEach(func() {
+				fakeSHA1Calculator.SetCalculateBehavior(map[string]fakebicrypto.CalculateInput{
+					manifestPath: {Sha1: "fake-new-manifest-sha1"},
+				})
+				err := vmRepo.ClearCurrent("fake-vm-cid")
+				Expect(err).ToNot(HaveOccurred())
+				err = vmRepo.UpdateCurrent(biconfig.VMRecord{CID: "fake-legacy-vm-cid"})
+				Expect(err).ToNot(HaveOccurred())
+				deploymentManifest.Jobs[0].Instances = 2
+			})
+
+			It("plans to recreate it as the first instance of the first job", func() {
+				plan, err := planner.Plan(manifestPath, deploymentManifest, releases, stemcell)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(plan.Changes).To(ContainElement("VM 'fake-legacy-vm-cid' will be recreated"))
+				Expect(plan.Changes).To(ContainElement("VM for instance 'fake-job-name/1' will be created"))
+				Expect(plan.Changes).ToNot(ContainElement("VM 'fake-legacy-vm-cid' will be deleted"))
+			})
+		})
+	})
+})
@@ -5,6 +5,7 @@ import (
 
 	biconfig "github.com/cloudfoundry/bosh-init/config"
 	bicrypto "github.com/cloudfoundry/bosh-init/crypto"
+	bideplmanifest "github.com/cloudfoundry/bosh-init/deployment/manifest"
 	birel "github.com/cloudfoundry/bosh-init/release"
 	bistemcell "github.com/cloudfoundry/bosh-init/stemcell"
 )
@@ -19,6 +20,7 @@ type deploymentRecord struct {
 	releaseRepo    biconfig.ReleaseRepo
 	stemcellRepo   biconfig.StemcellRepo
 	sha1Calculator bicrypto.SHA1Calculator
+	fingerprinter  bideplmanifest.Fingerprinter
 }
 
 func NewRecord(
@@ -26,12 +28,14 @@ func NewRecord(
 	releaseRepo biconfig.ReleaseRepo,
 	stemcellRepo biconfig.StemcellRepo,
 	sha1Calculator bicrypto.SHA1Calculator,
+	fingerprinter bideplmanifest.Fingerprinter,
 ) Record {
 	return &deploymentRecord{
 		deploymentRepo: deploymentRepo,
 		releaseRepo:    releaseRepo,
 		stemcellRepo:   stemcellRepo,
 		sha1Calculator: sha1Calculator,
+		fingerprinter:  fingerprinter,
 	}
 }
 
@@ -107,6 +111,21 @@ func (v *deploymentRecord) Update(manifestPath string, releases []birel.Release)
 		return bosherr.WrapError(err, "Saving sha1 of deployed manifest")
 	}
 
+	salt, err := v.fingerprinter.NewSalt()
+	if err != nil {
+		return bosherr.WrapError(err, "Calculating fingerprints of current deployment manifest")
+	}
+
+	fingerprints, err := v.fingerprinter.Fingerprint(manifestPath, salt)
+	if err != nil {
+		return bosherr.WrapError(err, "Calculating fingerprints of current deployment manifest")
+	}
+
+	err = v.deploymentRepo.UpdateCurrentFingerprints(fingerprints, salt)
+	if err != nil {
+		return bosherr.WrapError(err, "Saving fingerprints of deployed manifest")
+	}
+
 	err = v.releaseRepo.Update(releases)
 	if err != nil {
 		return bosherr.WrapError(err, "Updating releases")
@@ -12,6 +12,7 @@ import (
 	fakebirel "github.com/cloudfoundry/bosh-init/release/fakes"
 
 	biconfig "github.com/cloudfoundry/bosh-init/config"
+	bideplmanifest "github.com/cloudfoundry/bosh-init/deployment/manifest"
 	"github.com/cloudfoundry/bosh-init/release"
 	bistemcell "github.com/cloudfoundry/bosh-init/stemcell"
 
@@ -23,6 +24,7 @@ var _ = Describe("Record", rootDesc)
 func rootDesc() {
 	var (
 		fakeRelease        *fakebirel.FakeRelease
+		fakeFS             *fakesys.FakeFileSystem
 		stemcell           bistemcell.ExtractedStemcell
 		deploymentRepo     *fakebiconfig.FakeDeploymentRepo
 		releaseRepo        *fakebiconfig.FakeReleaseRepo
@@ -38,7 +40,7 @@ func rootDesc() {
 			ReleaseVersion: "fake-release-version",
 		}
 		releases = []release.Release{fakeRelease}
-		fakeFS := fakesys.NewFakeFileSystem()
+		fakeFS = fakesys.NewFakeFileSystem()
 		stemcell = bistemcell.NewExtractedStemcell(
 			bistemcell.Manifest{
 				Name:    "fake-stemcell-name",
@@ -51,7 +53,8 @@ func rootDesc() {
 		releaseRepo = &fakebiconfig.FakeReleaseRepo{}
 		stemcellRepo = fakebiconfig.NewFakeStemcellRepo()
 		fakeSHA1Calculator = fakebicrypto.NewFakeSha1Calculator()
-		deploymentRecord = NewRecord(deploymentRepo, releaseRepo, stemcellRepo, fakeSHA1Calculator)
+		fingerprinter := bideplmanifest.NewFingerprinter(fakeFS)
+		deploymentRecord = NewRecord(deploymentRepo, releaseRepo, stemcellRepo, fakeSHA1Calculator, fingerprinter)
 	})
 
 	Describe("IsDeployed", func() {
@@ -320,6 +323,7 @@ func rootDesc() {
 
 	Describe("Update", func() {
 		BeforeEach(func() {
+			fakeFS.WriteFileString("fake-manifest-path", "name: fake-deployment-name")
 			fakeSHA1Calculator.SetCalculateBehavior(map[string]fakebicrypto.CalculateInput{
 				"fake-manifest-path": fakebicrypto.CalculateInput{
 					Sha1: "fake-manifest-sha1",
@@ -334,6 +338,24 @@ func rootDesc() {
 			Expect(deploymentRepo.UpdateCurrentManifestSHA1).To(Equal("fake-manifest-sha1"))
 		})
 
+		It("calculates and updates fingerprints of currently deployed manifest", func() {
+			err := deploymentRecord.Update("fake-manifest-path", releases)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(deploymentRepo.UpdateCurrentFingerprintsInput).To(HaveKey("name"))
+		})
+
+		It("keys the fingerprints with a new random salt", func() {
+			err := deploymentRecord.Update("fake-manifest-path", releases)
+			Expect(err).ToNot(HaveOccurred())
+			salt := deploymentRepo.UpdateCurrentFingerprintsSaltInput
+			Expect(salt).To(MatchRegexp("^[0-9a-f]{64}$"))
+
+			err = deploymentRecord.Update("fake-manifest-path", releases)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(deploymentRepo.UpdateCurrentFingerprintsSaltInput).To(MatchRegexp("^[0-9a-f]{64}$"))
+			Expect(deploymentRepo.UpdateCurrentFingerprintsSaltInput).ToNot(Equal(salt))
+		})
+
 		It("passes the releases to the release repo", func() {
 			err := deploymentRecord.Update("fake-manifest-path", releases)
 			Expect(err).ToNot(HaveOccurred())
@@ -380,6 +402,18 @@ func rootDesc() {
 			})
 		})
 
+		Context("when updating currently deployed manifest fingerprints fails", func() {
+			BeforeEach(func() {
+				deploymentRepo.UpdateCurrentFingerprintsErr = errors.New("fake-update-fingerprints-error")
+			})
+
+			It("returns an error", func() {
+				err := deploymentRecord.Update("fake-manifest-path", releases)
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("fake-update-fingerprints-error"))
+			})
+		})
+
 		Context("when updating release records fails", func() {
 			BeforeEach(func() {
 				releaseRepo.UpdateReturns(errors.New("fake-update-error"))
@@ -0,0 +1,203 @@
+package deployment
+
+import (
+	"fmt"
+
+	bosherr "github.com/cloudfoundry/bosh-agent/errors"
+	boshlog "github.com/cloudfoundry/bosh-agent/logger"
+
+	bicloud "github.com/cloudfoundry/bosh-init/cloud"
+	biconfig "github.com/cloudfoundry/bosh-init/config"
+	bideplmanifest "github.com/cloudfoundry/bosh-init/deployment/manifest"
+	bivm "github.com/cloudfoundry/bosh-init/deployment/vm"
+)
+
+const UnknownJobState = "unknown"
+
+type VMStatus struct {
+	Instance       string
+	CID            string
+	IPs            []string
+	CreatedAt      string
+	Exists         bool
+	AgentReachable bool
+	JobState       string
+	AttachedDisks  []string
+
+	// CloudDisks are the disks that the CPI reports as attached to the VM,
+	// or nil if the CPI does not implement get_disks
+	CloudDisks []string
+}
+
+// Status is the deployment record reconciled against the CPI & agent
+type Status struct {
+	VMs      []VMStatus
+	DiskCIDs []string
+	Stemcell string
+	Releases []string
+
+	// MissingDiskCIDs are the recorded disks that the CPI reports as not existing
+	MissingDiskCIDs []string
+
+	CPIInfo bicloud.CPIInfo
+}
+
+type StatusReporter interface {
+	Report(bivm.Manager, bicloud.Cloud, bideplmanifest.Manifest) (Status, error)
+}
+
+type statusReporter struct {
+	diskRepo     biconfig.DiskRepo
+	stemcellRepo biconfig.StemcellRepo
+	releaseRepo  biconfig.ReleaseRepo
+	logger       boshlog.Logger
+	logTag       string
+}
+
+func NewStatusReporter(
+	diskRepo biconfig.DiskRepo,
+	stemcellRepo biconfig.StemcellRepo,
+	releaseRepo biconfig.ReleaseRepo,
+	logger boshlog.Logger,
+) StatusReporter {
+	return &statusReporter{
+		diskRepo:     diskRepo,
+		stemcellRepo: stemcellRepo,
+		releaseRepo:  releaseRepo,
+		logger:       logger,
+		logTag:       "statusReporter",
+	}
+}
+
+func (r *statusReporter) Report(vmManager bivm.Manager, cloud bicloud.Cloud, deploymentManifest bideplmanifest.Manifest) (Status, error) {
+	status := Status{
+		VMs:             []VMStatus{},
+		DiskCIDs:        []string{},
+		Releases:        []string{},
+		MissingDiskCIDs: []string{},
+		CPIInfo:         cloud.Info(),
+	}
+
+	vms, err := vmManager.FindCurrent()
+	if err != nil {
+		return status, bosherr.WrapError(err, "Finding current VMs")
+	}
+
+	for _, vm := range vms {
+		vmStatus, err := r.reportVM(vm, cloud, deploymentManifest)
+		if err != nil {
+			return status, err
+		}
+		status.VMs = append(status.VMs, vmStatus)
+	}
+
+	diskRecords, err := r.diskRepo.FindCurrent()
+	if err != nil {
+		return status, bosherr.WrapError(err, "Finding current disks")
+	}
+	for _, diskRecord := range diskRecords {
+		status.DiskCIDs = append(status.DiskCIDs, diskRecord.CID)
+	}
+	status.MissingDiskCIDs = r.findMissingDisks(status.DiskCIDs, cloud)
+
+	stemcellRecord, found, err := r.stemcellRepo.FindCurrent()
+	if err != nil {
+		return status, bosherr.WrapError(err, "Finding current stemcell")
+	}
+	if found {
+		status.Stemcell = fmt.Sprintf("%s/%s", stemcellRecord.Name, stemcellRecord.Version)
+	}
+
+	releaseRecords, err := r.releaseRepo.List()
+	if err != nil {
+		return status, bosherr.WrapError(err, "Finding current releases")
+	}
+	for _, releaseRecord := range releaseRecords {
+		status.Releases = append(status.Releases, fmt.Sprintf("%s/%s", releaseRecord.Name, releaseRecord.Version))
+	}
+
+	return status, nil
+}
+
+func (r *statusReporter) reportVM(vm bivm.VM, cloud bicloud.Cloud, deploymentManifest bideplmanifest.Manifest) (VMStatus, error) {
+	vmCID := vm.CID()
+
+	// vms recorded before multiple instances were supported have no job name
+	jobName := vm.JobName()
+	if jobName == "" {
+		jobName = deploymentManifest.LegacyJobName()
+	}
+
+	vmStatus := VMStatus{
+		Instance:      fmt.Sprintf("%s/%d", jobName, vm.Index()),
+		CID:           vmCID,
+		IPs:           vm.IPs(),
+		CreatedAt:     vm.CreatedAt(),
+		JobState:      UnknownJobState,
+		AttachedDisks: []string{},
+	}
+
+	exists, err := vm.Exists()
+	if err != nil {
+		return vmStatus, err
+	}
+	vmStatus.Exists = exists
+
+	if !exists {
+		return vmStatus, nil
+	}
+
+	cloudDisks, err := cloud.GetDisks(vmCID)
+	if err != nil {
+		if !bicloud.IsNotImplemented(err) {
+			r.logger.Info(r.logTag, "Getting disks of VM '%s' from the CPI: %s", vmCID, err.Error())
+		}
+	} else {
+		vmStatus.CloudDisks = cloudDisks
+	}
+
+	// an unresponsive agent is reported, not returned as an error
+	agentClient := vm.AgentClient()
+	_, err = agentClient.Ping()
+	if err != nil {
+		r.logger.Info(r.logTag, "Agent on VM '%s' is not reachable: %s", vmCID, err.Error())
+		return vmStatus, nil
+	}
+	vmStatus.AgentReachable = true
+
+	agentState, err := agentClient.GetState()
+	if err != nil {
+		r.logger.Info(r.logTag, "Getting state of agent on VM '%s': %s", vmCID, err.Error())
+	} else {
+		vmStatus.JobState = agentState.JobState
+	}
+
+	disks, err := agentClient.ListDisk()
+	if err != nil {
+		r.logger.Info(r.logTag, "Listing disks of agent on VM '%s': %s", vmCID, err.Error())
+	} else {
+		vmStatus.AttachedDisks = disks
+	}
+
+	return vmStatus, nil
+}
+
+// findMissingDisks returns the disks that the CPI reports as not existing.
+// No disks are reported as missing if the CPI does not implement has_disk.
+func (r *statusReporter) findMissingDisks(diskCIDs []string, cloud bicloud.Cloud) []string {
+	missingDiskCIDs := []string{}
+	for _, diskCID := range diskCIDs {
+		found, err := cloud.HasDisk(diskCID)
+		if err != nil {
+			if bicloud.IsNotImplemented(err) {
+				return []string{}
+			}
+			r.logger.Info(r.logTag, "Checking existence of disk '%s': %s", diskCID, err.Error())
+			continue
+		}
+		if !found {
+			missingDiskCIDs = append(missingDiskCIDs, diskCID)
+		}
+	}
+	return missingDiskCIDs
+}
@@ -0,0 +1,310 @@
+package deployment_test
+
+import (
+	. "github.com/cloudfoundry/bosh-init/deployment"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"code.google.com/p/gomock/gomock"
+	mock_cloud "github.com/cloudfoundry/bosh-init/cloud/mocks"
+	mock_agentclient "github.com/cloudfoundry/bosh-init/deployment/agentclient/mocks"
+
+	bosherr "github.com/cloudfoundry/bosh-agent/errors"
+	boshlog "github.com/cloudfoundry/bosh-agent/logger"
+	fakesys "github.com/cloudfoundry/bosh-agent/system/fakes"
+	faketime "github.com/cloudfoundry/bosh-agent/time/fakes"
+	fakeuuid "github.com/cloudfoundry/bosh-agent/uuid/fakes"
+
+	bicloud "github.com/cloudfoundry/bosh-init/cloud"
+	biproperty "github.com/cloudfoundry/bosh-init/common/property"
+	biconfig "github.com/cloudfoundry/bosh-init/config"
+	bicrypto "github.com/cloudfoundry/bosh-init/crypto"
+	biagentclient "github.com/cloudfoundry/bosh-init/deployment/agentclient"
+	bideplmanifest "github.com/cloudfoundry/bosh-init/deployment/manifest"
+	bivm "github.com/cloudfoundry/bosh-init/deployment/vm"
+	biinstallmanifest "github.com/cloudfoundry/bosh-init/installation/manifest"
+	birel "github.com/cloudfoundry/bosh-init/release"
+
+	fakebihttpagent "github.com/cloudfoundry/bosh-init/deployment/agentclient/http/fakes"
+	fakebirel "github.com/cloudfoundry/bosh-init/release/fakes"
+)
+
+var _ = Describe("StatusReporter", func() {
+	var mockCtrl *gomock.Controller
+
+	BeforeEach(func() {
+		mockCtrl = gomock.NewController(GinkgoT())
+	})
+
+	AfterEach(func() {
+		mockCtrl.Finish()
+	})
+
+	var (
+		vmRepo          biconfig.VMRepo
+		diskRepo        biconfig.DiskRepo
+		stemcellRepo    biconfig.StemcellRepo
+		releaseRepo     biconfig.ReleaseRepo
+		mockCloud       *mock_cloud.MockCloud
+		mockAgentClient *mock_agentclient.MockAgentClient
+		vmManager       bivm.Manager
+
+		deploymentManifest bideplmanifest.Manifest
+		statusReporter     StatusReporter
+	)
+
+	BeforeEach(func() {
+		logger := boshlog.NewLogger(boshlog.LevelNone)
+		fakeFs := fakesys.NewFakeFileSystem()
+		fakeUUIDGenerator := fakeuuid.NewFakeGenerator()
+
+		configService := biconfig.NewFileSystemDeploymentConfigService(fakeFs, fakeUUIDGenerator, &faketime.FakeService{}, bicrypto.NewEncryptor(nil), logger)
+		configService.SetConfigPath("/deployment.json")
+
+		vmRepo = biconfig.NewVMRepo(configService)
+		diskRepo = biconfig.NewDiskRepo(configService, fakeUUIDGenerator)
+		stemcellRepo = biconfig.NewStemcellRepo(configService, fakeUUIDGenerator)
+		releaseRepo = biconfig.NewReleaseRepo(configService, fakeUUIDGenerator)
+
+		mockCloud = mock_cloud.NewMockCloud(mockCtrl)
+		mockCloud.EXPECT().Info().Return(bicloud.CPIInfo{APIVersion: 1, StemcellFormats: []string{"fake-format"}})
+		mockAgentClient = mock_agentclient.NewMockAgentClient(mockCtrl)
+
+		fakeAgentClientFactory := fakebihttpagent.NewFakeAgentClientFactory()
+		fakeAgentClientFactory.CreateAgentClient = mockAgentClient
+		vmManager = bivm.NewManagerFactory(
+			vmRepo,
+			stemcellRepo,
+			nil,
+			fakeAgentClientFactory,
+			fakeUUIDGenerator,
+			&faketime.FakeService{},
+			fakeFs,
+			logger,
+		).NewManager(mockCloud, "fake-director-id", "https://fake-mbus-host:6868", biinstallmanifest.Cert{})
+
+		deploymentManifest = bideplmanifest.Manifest{
+			Jobs: []bideplmanifest.Job{
+				{Name: "fake-first-job-name"},
+				{Name: "fake-second-job-name"},
+			},
+		}
+		statusReporter = NewStatusReporter(diskRepo, stemcellRepo, releaseRepo, logger)
+	})
+
+	Context("when nothing has been deployed", func() {
+		It("reports no VMs, disk, stemcell or releases, and the CPI info", func() {
+			status, err := statusReporter.Report(vmManager, mockCloud, deploymentManifest)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(status).To(Equal(Status{
+				VMs:             []VMStatus{},
+				DiskCIDs:        []string{},
+				Releases:        []string{},
+				MissingDiskCIDs: []string{},
+				CPIInfo:         bicloud.CPIInfo{APIVersion: 1, StemcellFormats: []string{"fake-format"}},
+			}))
+		})
+	})
+
+	Context("when a deployment exists", func() {
+		BeforeEach(func() {
+			err := vmRepo.UpdateCurrent(biconfig.VMRecord{CID: "fake-vm-cid", JobName: "fake-job-name", Index: 0})
+			Expect(err).ToNot(HaveOccurred())
+
+			diskRecord, err := diskRepo.Save("fake-disk-cid", 1024, biproperty.Map{})
+			Expect(err).ToNot(HaveOccurred())
+			err = diskRepo.UpdateCurrent("fake-job-name", 0, diskRecord.ID)
+			Expect(err).ToNot(HaveOccurred())
+
+			stemcellRecord, err := stemcellRepo.Save("fake-stemcell-name", "fake-stemcell-version", "fake-stemcell-cid")
+			Expect(err).ToNot(HaveOccurred())
+			err = stemcellRepo.UpdateCurrent(stemcellRecord.ID)
+			Expect(err).ToNot(HaveOccurred())
+
+			err = releaseRepo.Update([]birel.Release{
+				&fakebirel.FakeRelease{ReleaseName: "fake-release-name", ReleaseVersion: "fake-release-version"},
+			})
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		Context("when the VM exists and the agent is reachable", func() {
+			BeforeEach(func() {
+				gomock.InOrder(
+					mockCloud.EXPECT().HasVM("fake-vm-cid").Return(true, nil),
+					mockCloud.EXPECT().GetDisks("fake-vm-cid").Return([]string{"fake-disk-cid"}, nil),
+					mockAgentClient.EXPECT().Ping().Return("pong", nil),
+					mockAgentClient.EXPECT().GetState().Return(biagentclient.AgentState{JobState: "running"}, nil),
+					mockAgentClient.EXPECT().ListDisk().Return([]string{"fake-disk-cid"}, nil),
+					mockCloud.EXPECT().HasDisk("fake-disk-cid").Return(true, nil),
+				)
+			})
+
+			It("reports the VM, agent, job state and attached disks", func() {
+				status, err := statusReporter.Report(vmManager, mockCloud, deploymentManifest)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(status).To(Equal(Status{
+					VMs: []VMStatus{
+						{
+							Instance:       "fake-job-name/0",
+							CID:            "fake-vm-cid",
+							Exists:         true,
+							AgentReachable: true,
+							JobState:       "running",
+							AttachedDisks:  []string{"fake-disk-cid"},
+							CloudDisks:     []string{"fake-disk-cid"},
+						},
+					},
+					DiskCIDs:        []string{"fake-disk-cid"},
+					Stemcell:        "fake-stemcell-name/fake-stemcell-version",
+					Releases:        []string{"fake-release-name/fake-release-version"},
+					MissingDiskCIDs: []string{},
+					CPIInfo:         bicloud.CPIInfo{APIVersion: 1, StemcellFormats: []string{"fake-format"}},
+				}))
+			})
+		})
+
+		Context("when the CPI does not implement get_disks and has_disk", func() {
+			BeforeEach(func() {
+				notImplementedErr := func(method string) error {
+					return bicloud.NewCPIError(method, bicloud.CmdError{Type: bicloud.NotImplementedError, Message: "fake-not-implemented"})
+				}
+
+				mockCloud.EXPECT().HasVM("fake-vm-cid").Return(true, nil)
+				mockCloud.EXPECT().GetDisks("fake-vm-cid").Return(nil, notImplementedErr("get_disks"))
+				mockAgentClient.EXPECT().Ping().Return("pong", nil)
+				mockAgentClient.EXPECT().GetState().Return(biagentclient.AgentState{JobState: "running"}, nil)
+				mockAgentClient.EXPECT().ListDisk().Return([]string{"fake-disk-cid"}, nil)
+				mockCloud.EXPECT().HasDisk("fake-disk-cid").Return(false, notImplementedErr("has_disk"))
+			})
+
+			It("reports the VM without its cloud disks, and no missing disks", func() {
+				status, err := statusReporter.Report(vmManager, mockCloud, deploymentManifest)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(status.VMs[0].CloudDisks).To(BeNil())
+				Expect(status.MissingDiskCIDs).To(Equal([]string{}))
+			})
+		})
+
+		Context("when the CPI reports that the disk does not exist", func() {
+			BeforeEach(func() {
+				mockCloud.EXPECT().HasVM("fake-vm-cid").Return(false, nil)
+				mockCloud.EXPECT().HasDisk("fake-disk-cid").Return(false, nil)
+			})
+
+			It("reports the disk as missing", func() {
+				status, err := statusReporter.Report(vmManager, mockCloud, deploymentManifest)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(status.MissingDiskCIDs).To(Equal([]string{"fake-disk-cid"}))
+			})
+		})
+
+		Context("when the agent is not reachable", func() {
+			BeforeEach(func() {
+				mockCloud.EXPECT().HasVM("fake-vm-cid").Return(true, nil)
+				mockCloud.EXPECT().GetDisks("fake-vm-cid").Return([]string{"fake-disk-cid"}, nil)
+				mockAgentClient.EXPECT().Ping().Return("", bosherr.Error("fake-ping-error"))
+				mockCloud.EXPECT().HasDisk("fake-disk-cid").Return(true, nil)
+			})
+
+			It("reports the agent as unreachable, with an unknown job state", func() {
+				status, err := statusReporter.Report(vmManager, mockCloud, deploymentManifest)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(status.VMs).To(Equal([]VMStatus{
+					{
+						Instance:      "fake-job-name/0",
+						CID:           "fake-vm-cid",
+						Exists:        true,
+						JobState:      UnknownJobState,
+						AttachedDisks: []string{},
+						CloudDisks:    []string{"fake-disk-cid"},
+					},
+				}))
+			})
+		})
+
+		Context("when the VM does not exist", func() {
+			BeforeEach(func() {
+				mockCloud.EXPECT().HasVM("fake-vm-cid").Return(false, nil)
+				mockCloud.EXPECT().HasDisk("fake-disk-cid").Return(true, nil)
+			})
+
+			It("reports the VM as missing without contacting the agent", func() {
+				status, err := statusReporter.Report(vmManager, mockCloud, deploymentManifest)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(status.VMs).To(Equal([]VMStatus{
+					{
+						Instance:      "fake-job-name/0",
+						CID:           "fake-vm-cid",
+						JobState:      UnknownJobState,
+						AttachedDisks: []string{},
+					},
+				}))
+			})
+		})
+
+		Context("when checking the VM fails", func() {
+			BeforeEach(func() {
+				mockCloud.EXPECT().HasVM("fake-vm-cid").Return(false, bosherr.Error("fake-has-vm-error"))
+			})
+
+			It("returns an error", func() {
+				_, err := statusReporter.Report(vmManager, mockCloud, deploymentManifest)
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("fake-has-vm-error"))
+			})
+		})
+	})
+
+	Context("when more than one instance has been deployed", func() {
+		BeforeEach(func() {
+			err := vmRepo.UpdateCurrent(biconfig.VMRecord{CID: "fake-vm-cid-1", JobName: "fake-job-name", Index: 0})
+			Expect(err).ToNot(HaveOccurred())
+			err = vmRepo.UpdateCurrent(biconfig.VMRecord{CID: "fake-vm-cid-2", JobName: "fake-job-name", Index: 1, AgentHost: "10.0.0.2"})
+			Expect(err).ToNot(HaveOccurred())
+
+			mockCloud.EXPECT().HasVM("fake-vm-cid-1").Return(false, nil)
+			mockCloud.EXPECT().HasVM("fake-vm-cid-2").Return(false, nil)
+		})
+
+		It("reports every instance", func() {
+			status, err := statusReporter.Report(vmManager, mockCloud, deploymentManifest)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(status.VMs).To(Equal([]VMStatus{
+				{
+					Instance:      "fake-job-name/0",
+					CID:           "fake-vm-cid-1",
+					JobState:      UnknownJobState,
+					AttachedDisks: []string{},
+				},
+				{
+					Instance:      "fake-job-name/1",
+					CID:           "fake-vm-cid-2",
+					JobState:      UnknownJobState,
+					AttachedDisks: []string{},
+				},
+			}))
+		})
+	})
+
+	Context("when the VM was recorded before multiple instances were supported", func() {
+		BeforeEach(func() {
+			err := vmRepo.UpdateCurrent(biconfig.VMRecord{CID: "fake-vm-cid"})
+			Expect(err).ToNot(HaveOccurred())
+
+			mockCloud.EXPECT().HasVM("fake-vm-cid").Return(false, nil)
+		})
+
+		It("reports the instance as the first instance of the first job of the manifest", func() {
+			status, err := statusReporter.Report(vmManager, mockCloud, deploymentManifest)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(status.VMs[0].Instance).To(Equal("fake-first-job-name/0"))
+		})
+
+		It("reports the instance as unknown when the manifest has no jobs", func() {
+			status, err := statusReporter.Report(vmManager, mockCloud, bideplmanifest.Manifest{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(status.VMs[0].Instance).To(Equal("unknown/0"))
+		})
+	})
+})
@@ -7,6 +7,7 @@ import (
 	boshlog "github.com/cloudfoundry/bosh-agent/logger"
 
 	bicloud "github.com/cloudfoundry/bosh-init/cloud"
+	biproperty "github.com/cloudfoundry/bosh-init/common/property"
 	biconfig "github.com/cloudfoundry/bosh-init/config"
 	bidisk "github.com/cloudfoundry/bosh-init/deployment/disk"
 	bideplmanifest "github.com/cloudfoundry/bosh-init/deployment/manifest"
@@ -16,12 +17,18 @@ import (
 // DiskDeployer is in the vm package to avoid a [disk -> vm -> disk] dependency cycle
 type DiskDeployer interface {
 	Deploy(diskPool bideplmanifest.DiskPool, cloud bicloud.Cloud, vm VM, eventLoggerStage biui.Stage) ([]bidisk.Disk, error)
+
+	// DeleteUnused deletes the disks that are no longer current, and the snapshots taken before migrating them.
+	// It must only be called once the jobs are running on the current disks.
+	DeleteUnused(eventLoggerStage biui.Stage) error
 }
 
 type diskDeployer struct {
 	diskRepo           biconfig.DiskRepo
 	diskManagerFactory bidisk.ManagerFactory
 	diskManager        bidisk.Manager
+	cloud              bicloud.Cloud
+	snapshotCIDs       []string
 	logger             boshlog.Logger
 	logTag             string
 }
@@ -30,6 +37,7 @@ func NewDiskDeployer(diskManagerFactory bidisk.ManagerFactory, diskRepo biconfig
 	return &diskDeployer{
 		diskManagerFactory: diskManagerFactory,
 		diskRepo:           diskRepo,
+		snapshotCIDs:       []string{},
 		logger:             logger,
 		logTag:             "diskDeployer",
 	}
@@ -41,7 +49,8 @@ func (d *diskDeployer) Deploy(diskPool bideplmanifest.DiskPool, cloud bicloud.Cl
 	}
 
 	d.diskManager = d.diskManagerFactory.NewManager(cloud)
-	disks, err := d.diskManager.FindCurrent()
+	d.cloud = cloud
+	disks, err := d.diskManager.FindCurrentForInstance(vm.JobName(), vm.Index())
 	if err != nil {
 		return disks, bosherr.WrapError(err, "Finding existing disk")
 	}
@@ -62,12 +71,27 @@ func (d *diskDeployer) Deploy(diskPool bideplmanifest.DiskPool, cloud bicloud.Cl
 		}
 	}
 
-	err = d.diskManager.DeleteUnused(stage)
+	// unused disks are kept until the jobs are running on the current disk, see DeleteUnused
+	return disks, nil
+}
+
+func (d *diskDeployer) DeleteUnused(stage biui.Stage) error {
+	if d.diskManager == nil {
+		// no disk was deployed
+		return nil
+	}
+
+	err := d.diskManager.DeleteUnused(stage)
 	if err != nil {
-		return disks, err
+		return err
 	}
 
-	return disks, nil
+	for _, snapshotCID := range d.snapshotCIDs {
+		d.deleteSnapshot(snapshotCID)
+	}
+	d.snapshotCIDs = []string{}
+
+	return nil
 }
 
 func (d *diskDeployer) deployExistingDisk(disk bidisk.Disk, diskPool bideplmanifest.DiskPool, vm VM, stage biui.Stage) ([]bidisk.Disk, error) {
@@ -82,6 +106,12 @@ func (d *diskDeployer) deployExistingDisk(disk bidisk.Disk, diskPool bideplmanif
 		return disks, err
 	}
 
+	// claims a disk recorded before multiple instances were supported
+	err = d.updateCurrentDiskRecord(disk, vm)
+	if err != nil {
+		return disks, err
+	}
+
 	if disk.NeedsMigration(diskPool.DiskSize, diskPool.CloudProperties) {
 		disk, err = d.migrateDisk(disk, diskPool, vm, stage)
 		if err != nil {
@@ -111,7 +141,7 @@ func (d *diskDeployer) deployNewDisk(diskPool bideplmanifest.DiskPool, vm VM, st
 	// once attached, the disk is part of the deployment
 	disks = append(disks, disk)
 
-	err = d.updateCurrentDiskRecord(disk)
+	err = d.updateCurrentDiskRecord(disk, vm)
 	if err != nil {
 		return disks, err
 	}
@@ -127,6 +157,16 @@ func (d *diskDeployer) migrateDisk(
 ) (newDisk bidisk.Disk, err error) {
 	d.logger.Debug(d.logTag, "Migrating disk '%s'", originalDisk.CID())
 
+	snapshotCID, err := d.snapshotDisk(originalDisk, vm)
+	if err != nil {
+		return newDisk, err
+	}
+	defer func() {
+		if err != nil && snapshotCID != "" {
+			d.logger.Warn(d.logTag, "Keeping snapshot '%s' of disk '%s' after failed migration", snapshotCID, originalDisk.CID())
+		}
+	}()
+
 	err = stage.Perform("Creating disk", func() error {
 		newDisk, err = d.diskManager.Create(diskPool, vm.CID())
 		return err
@@ -135,6 +175,12 @@ func (d *diskDeployer) migrateDisk(
 		return newDisk, err
 	}
 
+	defer func() {
+		if err != nil {
+			d.rollbackMigration(originalDisk, newDisk, vm, stage)
+		}
+	}()
+
 	stageName := fmt.Sprintf("Attaching disk '%s' to VM '%s'", newDisk.CID(), vm.CID())
 	err = stage.Perform(stageName, func() error {
 		return vm.AttachDisk(newDisk)
@@ -151,7 +197,7 @@ func (d *diskDeployer) migrateDisk(
 		return newDisk, err
 	}
 
-	err = d.updateCurrentDiskRecord(newDisk)
+	err = d.updateCurrentDiskRecord(newDisk, vm)
 	if err != nil {
 		return newDisk, err
 	}
@@ -164,18 +210,78 @@ func (d *diskDeployer) migrateDisk(
 		return newDisk, err
 	}
 
-	stageName = fmt.Sprintf("Deleting disk '%s'", originalDisk.CID())
+	// the original disk is now unused, but is only deleted once the jobs are running on the new disk
+	d.logger.Info(d.logTag, "Keeping disk '%s' until the jobs are running on disk '%s'", originalDisk.CID(), newDisk.CID())
+	if snapshotCID != "" {
+		d.snapshotCIDs = append(d.snapshotCIDs, snapshotCID)
+	}
+
+	return newDisk, nil
+}
+
+// rollbackMigration makes the original disk current again, then detaches and deletes the partially migrated disk.
+// Rollback failures are only logged, so that the migration error is returned.
+func (d *diskDeployer) rollbackMigration(originalDisk bidisk.Disk, newDisk bidisk.Disk, vm VM, stage biui.Stage) {
+	d.logger.Info(d.logTag, "Rolling back migration of disk '%s' to disk '%s'", originalDisk.CID(), newDisk.CID())
+
+	err := d.updateCurrentDiskRecord(originalDisk, vm)
+	if err != nil {
+		d.logger.Warn(d.logTag, "Failed to restore disk '%s' as current disk: %s", originalDisk.CID(), err.Error())
+	}
+
+	stageName := fmt.Sprintf("Detaching disk '%s'", newDisk.CID())
 	err = stage.Perform(stageName, func() error {
-		return originalDisk.Delete()
+		return vm.DetachDisk(newDisk)
 	})
 	if err != nil {
-		return newDisk, err
+		d.logger.Warn(d.logTag, "Failed to detach disk '%s': %s", newDisk.CID(), err.Error())
 	}
 
-	return newDisk, nil
+	stageName = fmt.Sprintf("Deleting disk '%s'", newDisk.CID())
+	err = stage.Perform(stageName, func() error {
+		return newDisk.Delete()
+	})
+	if err != nil {
+		d.logger.Warn(d.logTag, "Failed to delete disk '%s': %s", newDisk.CID(), err.Error())
+	}
+}
+
+// snapshotDisk snapshots the disk before its content is migrated, so that it can be restored if the migration fails.
+// An empty snapshot CID is returned if the CPI does not implement snapshots.
+func (d *diskDeployer) snapshotDisk(disk bidisk.Disk, vm VM) (string, error) {
+	metadata := biproperty.Map{
+		"director": directorName,
+		"job":      vm.JobName(),
+		"index":    vm.Index(),
+	}
+
+	snapshotCID, err := d.cloud.SnapshotDisk(disk.CID(), metadata)
+	if err != nil {
+		if bicloud.IsNotImplemented(err) {
+			d.logger.Info(d.logTag, "Skipping snapshot of disk '%s': CPI does not implement snapshot_disk", disk.CID())
+			return "", nil
+		}
+		return "", bosherr.WrapErrorf(err, "Snapshotting disk '%s'", disk.CID())
+	}
+
+	d.logger.Debug(d.logTag, "Created snapshot '%s' of disk '%s'", snapshotCID, disk.CID())
+	return snapshotCID, nil
+}
+
+// deleteSnapshot deletes the snapshot once the jobs are running on the migrated disk.
+// Failing to delete it does not fail the deploy, since the migrated disk is already in use.
+func (d *diskDeployer) deleteSnapshot(snapshotCID string) {
+	if snapshotCID == "" {
+		return
+	}
+
+	err := d.cloud.DeleteSnapshot(snapshotCID)
+	if err != nil && !bicloud.IsNotImplemented(err) {
+		d.logger.Warn(d.logTag, "Failed to delete snapshot '%s': %s", snapshotCID, err.Error())
+	}
 }
 
-func (d *diskDeployer) updateCurrentDiskRecord(disk bidisk.Disk) error {
+func (d *diskDeployer) updateCurrentDiskRecord(disk bidisk.Disk, vm VM) error {
 	savedDiskRecord, found, err := d.diskRepo.Find(disk.CID())
 	if err != nil {
 		return bosherr.WrapError(err, "Finding disk record")
@@ -185,7 +291,7 @@ func (d *diskDeployer) updateCurrentDiskRecord(disk bidisk.Disk) error {
 		return bosherr.Error("Failed to find disk record for new disk")
 	}
 
-	err = d.diskRepo.UpdateCurrent(savedDiskRecord.ID)
+	err = d.diskRepo.UpdateCurrent(vm.JobName(), vm.Index(), savedDiskRecord.ID)
 	if err != nil {
 		return bosherr.WrapError(err, "Updating current disk record")
 	}
@@ -9,6 +9,7 @@ import (
 	bosherr "github.com/cloudfoundry/bosh-agent/errors"
 	boshlog "github.com/cloudfoundry/bosh-agent/logger"
 
+	bicloud "github.com/cloudfoundry/bosh-init/cloud"
 	biproperty "github.com/cloudfoundry/bosh-init/common/property"
 	biconfig "github.com/cloudfoundry/bosh-init/config"
 	bidisk "github.com/cloudfoundry/bosh-init/deployment/disk"
@@ -36,6 +37,7 @@ var _ = Describe("DiskDeployer", func() {
 	BeforeEach(func() {
 		cloud = fakebicloud.NewFakeCloud()
 		fakeVM = fakebivm.NewFakeVM("fake-vm-cid")
+		fakeVM.JobNameReturn = "fake-job-name"
 
 		fakeDiskManagerFactory := fakebidisk.NewFakeManagerFactory()
 		fakeDiskManager = fakebidisk.NewFakeManager()
@@ -163,6 +165,67 @@ var _ = Describe("DiskDeployer", func() {
 					}))
 				})
 
+				It("snapshots the primary disk before migrating, and deletes the snapshot with the unused disks", func() {
+					cloud.SnapshotDiskSnapshotCID = "fake-snapshot-cid"
+
+					_, err := diskDeployer.Deploy(diskPool, cloud, fakeVM, fakeStage)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(cloud.SnapshotDiskInputs).To(Equal([]fakebicloud.SnapshotDiskInput{
+						{
+							DiskCID: "fake-existing-disk-cid",
+							Metadata: biproperty.Map{
+								"director": "bosh-init",
+								"job":      "fake-job-name",
+								"index":    0,
+							},
+						},
+					}))
+					Expect(cloud.DeleteSnapshotInputs).To(Equal([]fakebicloud.DeleteSnapshotInput{}))
+
+					err = diskDeployer.DeleteUnused(fakeStage)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(cloud.DeleteSnapshotInputs).To(Equal([]fakebicloud.DeleteSnapshotInput{
+						{SnapshotCID: "fake-snapshot-cid"},
+					}))
+
+					err = diskDeployer.DeleteUnused(fakeStage)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(cloud.DeleteSnapshotInputs).To(HaveLen(1))
+				})
+
+				It("migrates without a snapshot when the CPI does not implement snapshot_disk", func() {
+					cloud.SnapshotDiskErr = bicloud.NewCPIError("snapshot_disk", bicloud.CmdError{
+						Type:    bicloud.NotImplementedError,
+						Message: "fake-not-implemented",
+					})
+
+					_, err := diskDeployer.Deploy(diskPool, cloud, fakeVM, fakeStage)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(fakeVM.MigrateDiskCalledTimes).To(Equal(1))
+					Expect(cloud.DeleteSnapshotInputs).To(Equal([]fakebicloud.DeleteSnapshotInput{}))
+				})
+
+				It("returns an error and does not migrate when snapshotting the primary disk fails", func() {
+					cloud.SnapshotDiskErr = bosherr.Error("fake-snapshot-disk-error")
+
+					_, err := diskDeployer.Deploy(diskPool, cloud, fakeVM, fakeStage)
+					Expect(err).To(HaveOccurred())
+					Expect(err.Error()).To(ContainSubstring("fake-snapshot-disk-error"))
+					Expect(fakeVM.MigrateDiskCalledTimes).To(Equal(0))
+				})
+
+				It("keeps the snapshot when the migration fails", func() {
+					cloud.SnapshotDiskSnapshotCID = "fake-snapshot-cid"
+					fakeVM.MigrateDiskErr = bosherr.Error("fake-migrate-disk-error")
+
+					_, err := diskDeployer.Deploy(diskPool, cloud, fakeVM, fakeStage)
+					Expect(err).To(HaveOccurred())
+
+					err = diskDeployer.DeleteUnused(fakeStage)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(cloud.DeleteSnapshotInputs).To(Equal([]fakebicloud.DeleteSnapshotInput{}))
+				})
+
 				It("detaches primary disk", func() {
 					_, err := diskDeployer.Deploy(diskPool, cloud, fakeVM, fakeStage)
 					Expect(err).NotTo(HaveOccurred())
@@ -175,14 +238,26 @@ var _ = Describe("DiskDeployer", func() {
 					}))
 				})
 
+				It("keeps the primary disk until the unused disks are deleted", func() {
+					_, err := diskDeployer.Deploy(diskPool, cloud, fakeVM, fakeStage)
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(existingDisk.DeleteCalledTimes).To(Equal(0))
+					Expect(fakeDiskManager.DeleteUnusedCalledTimes).To(Equal(0))
+
+					err = diskDeployer.DeleteUnused(fakeStage)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(fakeDiskManager.DeleteUnusedCalledTimes).To(Equal(1))
+				})
+
 				It("promotes secondary disk as primary", func() {
 					_, err := diskDeployer.Deploy(diskPool, cloud, fakeVM, fakeStage)
 					Expect(err).NotTo(HaveOccurred())
 
 					// existing disk must be current until after migration
 					Expect(fakeDiskRepo.UpdateCurrentInputs).To(Equal([]fakebiconfig.DiskRepoUpdateCurrentInput{
-						//						{ DiskID: "fake-existing-disk-id" },
-						{DiskID: "fake-secondary-disk-id"},
+						{JobName: "fake-job-name", Index: 0, DiskID: "fake-existing-disk-id"},
+						{JobName: "fake-job-name", Index: 0, DiskID: "fake-secondary-disk-id"},
 					}))
 				})
 
@@ -208,11 +283,15 @@ var _ = Describe("DiskDeployer", func() {
 						fakeVM.SetAttachDiskBehavior(secondaryDisk, attachError)
 					})
 
-					It("returns error and leaves the existing disk attached", func() {
+					It("returns error, deletes the new disk and leaves the existing disk attached", func() {
 						_, err := diskDeployer.Deploy(diskPool, cloud, fakeVM, fakeStage)
 						Expect(err).To(HaveOccurred())
 						Expect(err.Error()).To(ContainSubstring("fake-attach-disk-error"))
-						Expect(fakeVM.DetachDiskInputs).To(Equal([]fakebivm.DetachDiskInput{}))
+						Expect(fakeVM.DetachDiskInputs).To(Equal([]fakebivm.DetachDiskInput{
+							{Disk: secondaryDisk},
+						}))
+						Expect(secondaryDisk.DeleteCalledTimes).To(Equal(1))
+						Expect(existingDisk.DeleteCalledTimes).To(Equal(0))
 
 						Expect(fakeStage.PerformCalls).To(Equal([]fakebiui.PerformCall{
 							{Name: "Attaching disk 'fake-existing-disk-cid' to VM 'fake-vm-cid'"},
@@ -221,6 +300,18 @@ var _ = Describe("DiskDeployer", func() {
 								Name:  "Attaching disk 'fake-secondary-disk-cid' to VM 'fake-vm-cid'",
 								Error: attachError,
 							},
+							{Name: "Detaching disk 'fake-secondary-disk-cid'"},
+							{Name: "Deleting disk 'fake-secondary-disk-cid'"},
+						}))
+					})
+
+					It("keeps the existing disk as current", func() {
+						_, err := diskDeployer.Deploy(diskPool, cloud, fakeVM, fakeStage)
+						Expect(err).To(HaveOccurred())
+
+						Expect(fakeDiskRepo.UpdateCurrentInputs).To(Equal([]fakebiconfig.DiskRepoUpdateCurrentInput{
+							{JobName: "fake-job-name", Index: 0, DiskID: "fake-existing-disk-id"},
+							{JobName: "fake-job-name", Index: 0, DiskID: "fake-existing-disk-id"},
 						}))
 					})
 				})
@@ -234,10 +325,18 @@ var _ = Describe("DiskDeployer", func() {
 						fakeVM.SetDetachDiskBehavior(existingDisk, detachError)
 					})
 
-					It("returns error", func() {
+					It("returns error and rolls back to the existing disk", func() {
 						_, err := diskDeployer.Deploy(diskPool, cloud, fakeVM, fakeStage)
 						Expect(err).To(HaveOccurred())
 						Expect(err.Error()).To(ContainSubstring("fake-detach-disk-error"))
+						Expect(secondaryDisk.DeleteCalledTimes).To(Equal(1))
+						Expect(existingDisk.DeleteCalledTimes).To(Equal(0))
+
+						Expect(fakeDiskRepo.UpdateCurrentInputs).To(Equal([]fakebiconfig.DiskRepoUpdateCurrentInput{
+							{JobName: "fake-job-name", Index: 0, DiskID: "fake-existing-disk-id"},
+							{JobName: "fake-job-name", Index: 0, DiskID: "fake-secondary-disk-id"},
+							{JobName: "fake-job-name", Index: 0, DiskID: "fake-existing-disk-id"},
+						}))
 
 						Expect(fakeStage.PerformCalls).To(Equal([]fakebiui.PerformCall{
 							{Name: "Attaching disk 'fake-existing-disk-cid' to VM 'fake-vm-cid'"},
@@ -248,6 +347,8 @@ var _ = Describe("DiskDeployer", func() {
 								Name:  "Detaching disk 'fake-existing-disk-cid'",
 								Error: detachError,
 							},
+							{Name: "Detaching disk 'fake-secondary-disk-cid'"},
+							{Name: "Deleting disk 'fake-secondary-disk-cid'"},
 						}))
 					})
 				})
@@ -261,11 +362,15 @@ var _ = Describe("DiskDeployer", func() {
 						fakeVM.MigrateDiskErr = migrateError
 					})
 
-					It("returns error and leaves the existing disk attached", func() {
+					It("returns error, deletes the new disk and leaves the existing disk attached", func() {
 						_, err := diskDeployer.Deploy(diskPool, cloud, fakeVM, fakeStage)
 						Expect(err).To(HaveOccurred())
 						Expect(err.Error()).To(ContainSubstring("fake-migrate-disk-error"))
-						Expect(fakeVM.DetachDiskInputs).To(Equal([]fakebivm.DetachDiskInput{}))
+						Expect(fakeVM.DetachDiskInputs).To(Equal([]fakebivm.DetachDiskInput{
+							{Disk: secondaryDisk},
+						}))
+						Expect(secondaryDisk.DeleteCalledTimes).To(Equal(1))
+						Expect(existingDisk.DeleteCalledTimes).To(Equal(0))
 
 						Expect(fakeStage.PerformCalls).To(Equal([]fakebiui.PerformCall{
 							{Name: "Attaching disk 'fake-existing-disk-cid' to VM 'fake-vm-cid'"},
@@ -275,8 +380,23 @@ var _ = Describe("DiskDeployer", func() {
 								Name:  "Migrating disk content from 'fake-existing-disk-cid' to 'fake-secondary-disk-cid'",
 								Error: migrateError,
 							},
+							{Name: "Detaching disk 'fake-secondary-disk-cid'"},
+							{Name: "Deleting disk 'fake-secondary-disk-cid'"},
 						}))
 					})
+
+					Context("when deleting the new disk fails", func() {
+						BeforeEach(func() {
+							secondaryDisk.SetDeleteBehavior(bosherr.Error("fake-delete-disk-error"))
+						})
+
+						It("returns the migration error", func() {
+							_, err := diskDeployer.Deploy(diskPool, cloud, fakeVM, fakeStage)
+							Expect(err).To(HaveOccurred())
+							Expect(err.Error()).To(ContainSubstring("fake-migrate-disk-error"))
+							Expect(err.Error()).ToNot(ContainSubstring("fake-delete-disk-error"))
+						})
+					})
 				})
 			})
 		})
@@ -300,7 +420,7 @@ var _ = Describe("DiskDeployer", func() {
 				Expect(err).NotTo(HaveOccurred())
 
 				Expect(fakeDiskRepo.UpdateCurrentInputs).To(Equal([]fakebiconfig.DiskRepoUpdateCurrentInput{
-					{DiskID: "fake-new-disk-id"},
+					{JobName: "fake-job-name", Index: 0, DiskID: "fake-new-disk-id"},
 				}))
 			})
 
@@ -334,23 +454,11 @@ var _ = Describe("DiskDeployer", func() {
 			}))
 		})
 
-		It("removes unused disks", func() {
+		It("does not remove unused disks", func() {
 			_, err := diskDeployer.Deploy(diskPool, cloud, fakeVM, fakeStage)
 			Expect(err).ToNot(HaveOccurred())
 
-			Expect(fakeDiskManager.DeleteUnusedCalledTimes).To(Equal(1))
-		})
-
-		Context("when removing unused disk fails", func() {
-			BeforeEach(func() {
-				fakeDiskManager.DeleteUnusedErr = bosherr.Error("fake-delete-error")
-			})
-
-			It("returns an error", func() {
-				_, err := diskDeployer.Deploy(diskPool, cloud, fakeVM, fakeStage)
-				Expect(err).To(HaveOccurred())
-				Expect(err.Error()).To(ContainSubstring("fake-delete-error"))
-			})
+			Expect(fakeDiskManager.DeleteUnusedCalledTimes).To(Equal(0))
 		})
 
 		Context("when creating the persistent disk fails", func() {
@@ -411,6 +519,45 @@ var _ = Describe("DiskDeployer", func() {
 		})
 	})
 
+	Describe("DeleteUnused", func() {
+		BeforeEach(func() {
+			diskPool = bideplmanifest.DiskPool{
+				Name:     "fake-persistent-disk-pool-name",
+				DiskSize: 1024,
+			}
+		})
+
+		It("removes unused disks", func() {
+			_, err := diskDeployer.Deploy(diskPool, cloud, fakeVM, fakeStage)
+			Expect(err).ToNot(HaveOccurred())
+
+			err = diskDeployer.DeleteUnused(fakeStage)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fakeDiskManager.DeleteUnusedCalledTimes).To(Equal(1))
+		})
+
+		It("does nothing when no disk was deployed", func() {
+			err := diskDeployer.DeleteUnused(fakeStage)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fakeDiskManager.DeleteUnusedCalledTimes).To(Equal(0))
+		})
+
+		Context("when removing unused disk fails", func() {
+			BeforeEach(func() {
+				fakeDiskManager.DeleteUnusedErr = bosherr.Error("fake-delete-error")
+			})
+
+			It("returns an error", func() {
+				_, err := diskDeployer.Deploy(diskPool, cloud, fakeVM, fakeStage)
+				Expect(err).ToNot(HaveOccurred())
+
+				err = diskDeployer.DeleteUnused(fakeStage)
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("fake-delete-error"))
+			})
+		})
+	})
+
 	Context("when the disk pool size is 0", func() {
 		BeforeEach(func() {
 			diskPool = bideplmanifest.DiskPool{}
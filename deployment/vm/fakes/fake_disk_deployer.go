@@ -11,6 +11,9 @@ import (
 type FakeDiskDeployer struct {
 	DeployInputs  []DeployInput
 	deployOutputs deployOutput
+
+	DeleteUnusedInputs []DeleteUnusedInput
+	DeleteUnusedErr    error
 }
 
 type DeployInput struct {
@@ -20,6 +23,10 @@ type DeployInput struct {
 	EventLoggerStage biui.Stage
 }
 
+type DeleteUnusedInput struct {
+	EventLoggerStage biui.Stage
+}
+
 type deployOutput struct {
 	disks []bidisk.Disk
 	err   error
@@ -27,7 +34,8 @@ type deployOutput struct {
 
 func NewFakeDiskDeployer() *FakeDiskDeployer {
 	return &FakeDiskDeployer{
-		DeployInputs: []DeployInput{},
+		DeployInputs:       []DeployInput{},
+		DeleteUnusedInputs: []DeleteUnusedInput{},
 	}
 }
 
@@ -53,3 +61,11 @@ func (d *FakeDiskDeployer) SetDeployBehavior(disks []bidisk.Disk, err error) {
 		err:   err,
 	}
 }
+
+func (d *FakeDiskDeployer) DeleteUnused(eventLoggerStage biui.Stage) error {
+	d.DeleteUnusedInputs = append(d.DeleteUnusedInputs, DeleteUnusedInput{
+		EventLoggerStage: eventLoggerStage,
+	})
+
+	return d.DeleteUnusedErr
+}
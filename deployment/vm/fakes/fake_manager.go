@@ -7,46 +7,53 @@ import (
 )
 
 type CreateInput struct {
+	JobName  string
+	Index    int
 	Stemcell bistemcell.CloudStemcell
 	Manifest bideplmanifest.Manifest
 }
 
 type FakeManager struct {
-	CreateInput CreateInput
-	CreateVM    bivm.VM
-	CreateErr   error
+	CreateInput  CreateInput
+	CreateInputs []CreateInput
+	CreateVM     bivm.VM
+	CreateErr    error
 
 	findCurrentBehaviour findCurrentOutput
 }
 
 type findCurrentOutput struct {
-	vm    bivm.VM
-	found bool
-	err   error
+	vms []bivm.VM
+	err error
 }
 
 func NewFakeManager() *FakeManager {
 	return &FakeManager{}
 }
 
-func (m *FakeManager) FindCurrent() (bivm.VM, bool, error) {
-	return m.findCurrentBehaviour.vm, m.findCurrentBehaviour.found, m.findCurrentBehaviour.err
+func (m *FakeManager) FindCurrent() ([]bivm.VM, error) {
+	if m.findCurrentBehaviour.vms == nil {
+		return []bivm.VM{}, m.findCurrentBehaviour.err
+	}
+	return m.findCurrentBehaviour.vms, m.findCurrentBehaviour.err
 }
 
-func (m *FakeManager) Create(stemcell bistemcell.CloudStemcell, deploymentManifest bideplmanifest.Manifest) (bivm.VM, error) {
+func (m *FakeManager) Create(jobName string, index int, stemcell bistemcell.CloudStemcell, deploymentManifest bideplmanifest.Manifest) (bivm.VM, error) {
 	input := CreateInput{
+		JobName:  jobName,
+		Index:    index,
 		Stemcell: stemcell,
 		Manifest: deploymentManifest,
 	}
 	m.CreateInput = input
+	m.CreateInputs = append(m.CreateInputs, input)
 
 	return m.CreateVM, m.CreateErr
 }
 
-func (m *FakeManager) SetFindCurrentBehavior(vm bivm.VM, found bool, err error) {
+func (m *FakeManager) SetFindCurrentBehavior(vms []bivm.VM, err error) {
 	m.findCurrentBehaviour = findCurrentOutput{
-		vm:    vm,
-		found: found,
-		err:   err,
+		vms: vms,
+		err: err,
 	}
 }
@@ -7,12 +7,15 @@ import (
 
 	bicloud "github.com/cloudfoundry/bosh-init/cloud"
 	bivm "github.com/cloudfoundry/bosh-init/deployment/vm"
+	biinstallmanifest "github.com/cloudfoundry/bosh-init/installation/manifest"
 	bitestutils "github.com/cloudfoundry/bosh-init/testutils"
 )
 
 type NewManagerInput struct {
-	Cloud   bicloud.Cloud
-	MbusURL string
+	Cloud      bicloud.Cloud
+	DirectorID string
+	MbusURL    string
+	MbusCert   biinstallmanifest.Cert
 }
 
 type newManagerOutput struct {
@@ -31,10 +34,12 @@ func NewFakeManagerFactory() *FakeManagerFactory {
 	}
 }
 
-func (f *FakeManagerFactory) NewManager(cloud bicloud.Cloud, mbusURL string) bivm.Manager {
+func (f *FakeManagerFactory) NewManager(cloud bicloud.Cloud, directorID string, mbusURL string, mbusCert biinstallmanifest.Cert) bivm.Manager {
 	input := NewManagerInput{
-		Cloud:   cloud,
-		MbusURL: mbusURL,
+		Cloud:      cloud,
+		DirectorID: directorID,
+		MbusURL:    mbusURL,
+		MbusCert:   mbusCert,
 	}
 	f.NewManagerInputs = append(f.NewManagerInputs, input)
 
@@ -51,10 +56,12 @@ func (f *FakeManagerFactory) NewManager(cloud bicloud.Cloud, mbusURL string) biv
 	return output.manager
 }
 
-func (f *FakeManagerFactory) SetNewManagerBehavior(cloud bicloud.Cloud, mbusURL string, manager bivm.Manager) {
+func (f *FakeManagerFactory) SetNewManagerBehavior(cloud bicloud.Cloud, directorID string, mbusURL string, mbusCert biinstallmanifest.Cert, manager bivm.Manager) {
 	input := NewManagerInput{
-		Cloud:   cloud,
-		MbusURL: mbusURL,
+		Cloud:      cloud,
+		DirectorID: directorID,
+		MbusURL:    mbusURL,
+		MbusCert:   mbusCert,
 	}
 
 	inputString, marshalErr := bitestutils.MarshalToString(input)
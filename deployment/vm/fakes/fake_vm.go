@@ -7,12 +7,21 @@ import (
 	bias "github.com/cloudfoundry/bosh-init/deployment/applyspec"
 	bidisk "github.com/cloudfoundry/bosh-init/deployment/disk"
 	bideplmanifest "github.com/cloudfoundry/bosh-init/deployment/manifest"
+	biinstallmanifest "github.com/cloudfoundry/bosh-init/installation/manifest"
 	biui "github.com/cloudfoundry/bosh-init/ui"
 )
 
 type FakeVM struct {
 	cid string
 
+	JobNameReturn   string
+	IndexReturn     int
+	AgentHostReturn string
+	IPsReturn       []string
+	CreatedAtReturn string
+	MbusURLReturn   string
+	MbusCertReturn  biinstallmanifest.Cert
+
 	ExistsCalled int
 	ExistsFound  bool
 	ExistsErr    error
@@ -23,6 +32,9 @@ type FakeVM struct {
 	UpdateDisksDisks  []bidisk.Disk
 	UpdateDisksErr    error
 
+	DeleteUnusedDisksCalledTimes int
+	DeleteUnusedDisksErr         error
+
 	ApplyInputs []ApplyInput
 	ApplyErr    error
 
@@ -55,6 +67,10 @@ type FakeVM struct {
 
 	MigrateDiskCalledTimes int
 	MigrateDiskErr         error
+
+	RunErrandCalledTimes int
+	RunErrandResult      biagentclient.ErrandResult
+	RunErrandErr         error
 }
 
 type UpdateDisksInput struct {
@@ -107,6 +123,34 @@ func (vm *FakeVM) CID() string {
 	return vm.cid
 }
 
+func (vm *FakeVM) JobName() string {
+	return vm.JobNameReturn
+}
+
+func (vm *FakeVM) Index() int {
+	return vm.IndexReturn
+}
+
+func (vm *FakeVM) AgentHost() string {
+	return vm.AgentHostReturn
+}
+
+func (vm *FakeVM) IPs() []string {
+	return vm.IPsReturn
+}
+
+func (vm *FakeVM) CreatedAt() string {
+	return vm.CreatedAtReturn
+}
+
+func (vm *FakeVM) MbusURL() string {
+	return vm.MbusURLReturn
+}
+
+func (vm *FakeVM) MbusCert() biinstallmanifest.Cert {
+	return vm.MbusCertReturn
+}
+
 func (vm *FakeVM) Exists() (bool, error) {
 	vm.ExistsCalled++
 	return vm.ExistsFound, vm.ExistsErr
@@ -132,6 +176,11 @@ func (vm *FakeVM) UpdateDisks(diskPool bideplmanifest.DiskPool, eventLoggerStage
 	return vm.UpdateDisksDisks, vm.UpdateDisksErr
 }
 
+func (vm *FakeVM) DeleteUnusedDisks(eventLoggerStage biui.Stage) error {
+	vm.DeleteUnusedDisksCalledTimes++
+	return vm.DeleteUnusedDisksErr
+}
+
 func (vm *FakeVM) Apply(applySpec bias.ApplySpec) error {
 	vm.ApplyInputs = append(vm.ApplyInputs, ApplyInput{
 		ApplySpec: applySpec,
@@ -183,6 +232,12 @@ func (vm *FakeVM) MigrateDisk() error {
 	return vm.MigrateDiskErr
 }
 
+func (vm *FakeVM) RunErrand() (biagentclient.ErrandResult, error) {
+	vm.RunErrandCalledTimes++
+
+	return vm.RunErrandResult, vm.RunErrandErr
+}
+
 func (vm *FakeVM) Stop() error {
 	vm.StopCalled++
 	return vm.StopErr
@@ -1,32 +1,46 @@
 package vm
 
 import (
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+
 	bosherr "github.com/cloudfoundry/bosh-agent/errors"
 	boshlog "github.com/cloudfoundry/bosh-agent/logger"
 	boshsys "github.com/cloudfoundry/bosh-agent/system"
+	boshtime "github.com/cloudfoundry/bosh-agent/time"
 	boshuuid "github.com/cloudfoundry/bosh-agent/uuid"
 
 	bicloud "github.com/cloudfoundry/bosh-init/cloud"
+	biproperty "github.com/cloudfoundry/bosh-init/common/property"
 	biconfig "github.com/cloudfoundry/bosh-init/config"
-	biagentclient "github.com/cloudfoundry/bosh-init/deployment/agentclient"
 	bihttpagent "github.com/cloudfoundry/bosh-init/deployment/agentclient/http"
 	bideplmanifest "github.com/cloudfoundry/bosh-init/deployment/manifest"
+	biinstallmanifest "github.com/cloudfoundry/bosh-init/installation/manifest"
 	bistemcell "github.com/cloudfoundry/bosh-init/stemcell"
 )
 
+// directorName is the director that the metadata of the VMs and disk snapshots created by bosh-init names,
+// under the 'director' key
+const directorName = "bosh-init"
+
 type Manager interface {
-	FindCurrent() (VM, bool, error)
-	Create(bistemcell.CloudStemcell, bideplmanifest.Manifest) (VM, error)
+	FindCurrent() ([]VM, error)
+	Create(jobName string, index int, stemcell bistemcell.CloudStemcell, deploymentManifest bideplmanifest.Manifest) (VM, error)
 }
 
 type manager struct {
 	vmRepo             biconfig.VMRepo
 	stemcellRepo       biconfig.StemcellRepo
 	diskDeployer       DiskDeployer
-	agentClient        biagentclient.AgentClient
 	agentClientFactory bihttpagent.AgentClientFactory
+	directorID         string
+	mbusURL            string
+	mbusCert           biinstallmanifest.Cert
 	cloud              bicloud.Cloud
 	uuidGenerator      boshuuid.Generator
+	timeService        boshtime.Service
 	fs                 boshsys.FileSystem
 	logger             boshlog.Logger
 	logTag             string
@@ -36,80 +50,156 @@ func NewManager(
 	vmRepo biconfig.VMRepo,
 	stemcellRepo biconfig.StemcellRepo,
 	diskDeployer DiskDeployer,
-	agentClient biagentclient.AgentClient,
+	agentClientFactory bihttpagent.AgentClientFactory,
+	directorID string,
+	mbusURL string,
+	mbusCert biinstallmanifest.Cert,
 	cloud bicloud.Cloud,
 	uuidGenerator boshuuid.Generator,
+	timeService boshtime.Service,
 	fs boshsys.FileSystem,
 	logger boshlog.Logger,
 ) Manager {
 	return &manager{
-		cloud:         cloud,
-		agentClient:   agentClient,
-		vmRepo:        vmRepo,
-		stemcellRepo:  stemcellRepo,
-		diskDeployer:  diskDeployer,
-		uuidGenerator: uuidGenerator,
-		fs:            fs,
-		logger:        logger,
-		logTag:        "vmManager",
+		cloud:              cloud,
+		agentClientFactory: agentClientFactory,
+		directorID:         directorID,
+		mbusURL:            mbusURL,
+		mbusCert:           mbusCert,
+		vmRepo:             vmRepo,
+		stemcellRepo:       stemcellRepo,
+		diskDeployer:       diskDeployer,
+		uuidGenerator:      uuidGenerator,
+		timeService:        timeService,
+		fs:                 fs,
+		logger:             logger,
+		logTag:             "vmManager",
 	}
 }
 
-func (m *manager) FindCurrent() (VM, bool, error) {
-	vmCID, found, err := m.vmRepo.FindCurrent()
+func (m *manager) FindCurrent() ([]VM, error) {
+	vms := []VM{}
+
+	records, err := m.vmRepo.FindCurrent()
 	if err != nil {
-		return nil, false, bosherr.WrapError(err, "Finding currently deployed vm")
+		return vms, bosherr.WrapError(err, "Finding currently deployed vms")
 	}
 
-	if !found {
-		return nil, false, nil
-	}
+	for _, record := range records {
+		mbusURL, err := m.agentMbusURL(record.AgentHost)
+		if err != nil {
+			return vms, bosherr.WrapErrorf(err, "Finding agent address of vm '%s'", record.CID)
+		}
 
-	vm := NewVM(
-		vmCID,
-		m.vmRepo,
-		m.stemcellRepo,
-		m.diskDeployer,
-		m.agentClient,
-		m.cloud,
-		m.fs,
-		m.logger,
-	)
+		agentClient, err := m.agentClientFactory.NewAgentClient(m.directorID, mbusURL, record.AgentID, m.mbusCert)
+		if err != nil {
+			return vms, bosherr.WrapErrorf(err, "Creating agent client for vm '%s'", record.CID)
+		}
 
-	return vm, true, err
+		vm := NewVM(
+			record,
+			m.vmRepo,
+			m.stemcellRepo,
+			m.diskDeployer,
+			agentClient,
+			mbusURL,
+			m.mbusCert,
+			m.cloud,
+			m.fs,
+			m.logger,
+		)
+		vms = append(vms, vm)
+	}
+
+	return vms, nil
 }
 
-func (m *manager) Create(stemcell bistemcell.CloudStemcell, deploymentManifest bideplmanifest.Manifest) (VM, error) {
-	jobName := deploymentManifest.Jobs[0].Name
-	networkInterfaces, err := deploymentManifest.NetworkInterfaces(jobName)
+func (m *manager) Create(jobName string, index int, stemcell bistemcell.CloudStemcell, deploymentManifest bideplmanifest.Manifest) (VM, error) {
+	networkInterfaces, err := deploymentManifest.NetworkInterfaces(jobName, index)
 	m.logger.Debug(m.logTag, "Creating VM with network interfaces: %#v", networkInterfaces)
 	if err != nil {
 		return nil, bosherr.WrapError(err, "Getting network spec")
 	}
 
-	resourcePool := deploymentManifest.ResourcePools[0]
+	resourcePool, err := deploymentManifest.ResourcePool(jobName)
+	if err != nil {
+		return nil, bosherr.WrapError(err, "Getting resource pool")
+	}
+
+	agentHost, err := m.agentHost(jobName, index, deploymentManifest)
+	if err != nil {
+		return nil, bosherr.WrapErrorf(err, "Finding agent address of instance '%s/%d'", jobName, index)
+	}
+
+	mbusURL, err := m.agentMbusURL(agentHost)
+	if err != nil {
+		return nil, bosherr.WrapErrorf(err, "Finding agent address of instance '%s/%d'", jobName, index)
+	}
 
 	agentID, err := m.uuidGenerator.Generate()
 	if err != nil {
 		return nil, bosherr.WrapError(err, "Generating agent ID")
 	}
 
+	agentClient, err := m.agentClientFactory.NewAgentClient(m.directorID, mbusURL, agentID, m.mbusCert)
+	if err != nil {
+		return nil, bosherr.WrapErrorf(err, "Creating agent client for instance '%s/%d'", jobName, index)
+	}
+
+	// the stemcell is looked up before the vm is created, so that a failure does not leave the vm unrecorded
+	stemcellRecord, found, err := m.stemcellRepo.Find(stemcell.Name(), stemcell.Version())
+	if err != nil {
+		return nil, bosherr.WrapErrorf(err, "Finding stemcell record '%s/%s'", stemcell.Name(), stemcell.Version())
+	}
+	if !found {
+		m.logger.Warn(m.logTag, "Stemcell '%s/%s' of instance '%s/%d' is not recorded", stemcell.Name(), stemcell.Version(), jobName, index)
+	}
+
 	cid, err := m.cloud.CreateVM(agentID, stemcell.CID(), resourcePool.CloudProperties, networkInterfaces, resourcePool.Env)
 	if err != nil {
 		return nil, bosherr.WrapErrorf(err, "Creating vm with stemcell cid '%s'", stemcell.CID())
 	}
 
-	err = m.vmRepo.UpdateCurrent(cid)
+	record := biconfig.VMRecord{
+		CID:        cid,
+		JobName:    jobName,
+		Index:      index,
+		AgentHost:  agentHost,
+		AgentID:    agentID,
+		StemcellID: stemcellRecord.ID,
+		IPs:        m.staticIPs(jobName, networkInterfaces, deploymentManifest),
+		CreatedAt:  m.timeService.Now().UTC().Format(time.RFC3339),
+	}
+
+	err = m.vmRepo.UpdateCurrent(record)
 	if err != nil {
 		return nil, bosherr.WrapError(err, "Updating current vm record")
 	}
 
+	metadata := bicloud.VMMetadata{
+		"director":   directorName,
+		"deployment": deploymentManifest.Name,
+		"job":        jobName,
+		"index":      strconv.Itoa(index),
+	}
+	// the metadata only tags the vm in the IaaS, so failing to set it does not fail the deploy
+	err = m.cloud.SetVMMetadata(cid, metadata)
+	if err != nil {
+		if bicloud.IsNotImplemented(err) {
+			m.logger.Info(m.logTag, "Skipping metadata of vm '%s': CPI does not implement set_vm_metadata", cid)
+		} else {
+			m.logger.Warn(m.logTag, "Failed to set metadata of vm '%s': %s", cid, err.Error())
+		}
+	}
+
 	vm := NewVM(
-		cid,
+		record,
 		m.vmRepo,
 		m.stemcellRepo,
 		m.diskDeployer,
-		m.agentClient,
+		agentClient,
+		mbusURL,
+		m.mbusCert,
 		m.cloud,
 		m.fs,
 		m.logger,
@@ -117,3 +207,82 @@ func (m *manager) Create(stemcell bistemcell.CloudStemcell, deploymentManifest b
 
 	return vm, nil
 }
+
+// staticIPs returns the IPs of the network interfaces that have one, in the order of the networks of the job
+func (m *manager) staticIPs(jobName string, networkInterfaces map[string]biproperty.Map, deploymentManifest bideplmanifest.Manifest) []string {
+	job, found := deploymentManifest.FindJobByName(jobName)
+	if !found {
+		return nil
+	}
+
+	var ips []string
+	for _, jobNetwork := range job.Networks {
+		if ip, ok := networkInterfaces[jobNetwork.Name]["ip"].(string); ok && ip != "" {
+			ips = append(ips, ip)
+		}
+	}
+
+	return ips
+}
+
+// agentHost returns an empty host for the first instance of the deployment, which is reached at the mbus URL.
+// The agents of the other instances listen on the same port, at their vip or first static IP.
+func (m *manager) agentHost(jobName string, index int, deploymentManifest bideplmanifest.Manifest) (string, error) {
+	if len(deploymentManifest.Jobs) > 0 && deploymentManifest.Jobs[0].Name == jobName && index == 0 {
+		return "", nil
+	}
+
+	job, found := deploymentManifest.FindJobByName(jobName)
+	if !found {
+		return "", bosherr.Errorf("Could not find job with name: %s", jobName)
+	}
+
+	networkTypes := map[string]bideplmanifest.NetworkType{}
+	for _, network := range deploymentManifest.Networks {
+		networkTypes[network.Name] = network.Type
+	}
+
+	staticIP := ""
+	for _, jobNetwork := range job.Networks {
+		if len(jobNetwork.StaticIPs) <= index {
+			continue
+		}
+		if networkTypes[jobNetwork.Name] == bideplmanifest.VIP {
+			return jobNetwork.StaticIPs[index], nil
+		}
+		if staticIP == "" {
+			staticIP = jobNetwork.StaticIPs[index]
+		}
+	}
+
+	if staticIP == "" {
+		return "", bosherr.Error("Instance has no static IP")
+	}
+
+	return staticIP, nil
+}
+
+// agentMbusURL returns the mbus URL with its host replaced by the agent host, keeping the credentials and port.
+// NATS mbus URLs are returned unchanged, since all agents share the same message bus.
+func (m *manager) agentMbusURL(agentHost string) (string, error) {
+	if agentHost == "" {
+		return m.mbusURL, nil
+	}
+
+	mbusURL, err := url.Parse(m.mbusURL)
+	if err != nil {
+		return "", bosherr.WrapError(err, "Parsing mbus URL")
+	}
+
+	if mbusURL.Scheme == "nats" {
+		return m.mbusURL, nil
+	}
+
+	if _, port, err := net.SplitHostPort(mbusURL.Host); err == nil {
+		mbusURL.Host = net.JoinHostPort(agentHost, port)
+	} else {
+		mbusURL.Host = agentHost
+	}
+
+	return mbusURL.String(), nil
+}
@@ -3,52 +3,64 @@ package vm
 import (
 	boshlog "github.com/cloudfoundry/bosh-agent/logger"
 	boshsys "github.com/cloudfoundry/bosh-agent/system"
+	boshtime "github.com/cloudfoundry/bosh-agent/time"
 	boshuuid "github.com/cloudfoundry/bosh-agent/uuid"
 
 	bicloud "github.com/cloudfoundry/bosh-init/cloud"
 	biconfig "github.com/cloudfoundry/bosh-init/config"
-	biagentclient "github.com/cloudfoundry/bosh-init/deployment/agentclient"
+	bihttpagent "github.com/cloudfoundry/bosh-init/deployment/agentclient/http"
+	biinstallmanifest "github.com/cloudfoundry/bosh-init/installation/manifest"
 )
 
 type ManagerFactory interface {
-	NewManager(cloud bicloud.Cloud, agentClient biagentclient.AgentClient) Manager
+	NewManager(cloud bicloud.Cloud, directorID string, mbusURL string, mbusCert biinstallmanifest.Cert) Manager
 }
 
 type managerFactory struct {
-	vmRepo        biconfig.VMRepo
-	stemcellRepo  biconfig.StemcellRepo
-	diskDeployer  DiskDeployer
-	uuidGenerator boshuuid.Generator
-	fs            boshsys.FileSystem
-	logger        boshlog.Logger
+	vmRepo             biconfig.VMRepo
+	stemcellRepo       biconfig.StemcellRepo
+	diskDeployer       DiskDeployer
+	agentClientFactory bihttpagent.AgentClientFactory
+	uuidGenerator      boshuuid.Generator
+	timeService        boshtime.Service
+	fs                 boshsys.FileSystem
+	logger             boshlog.Logger
 }
 
 func NewManagerFactory(
 	vmRepo biconfig.VMRepo,
 	stemcellRepo biconfig.StemcellRepo,
 	diskDeployer DiskDeployer,
+	agentClientFactory bihttpagent.AgentClientFactory,
 	uuidGenerator boshuuid.Generator,
+	timeService boshtime.Service,
 	fs boshsys.FileSystem,
 	logger boshlog.Logger,
 ) ManagerFactory {
 	return &managerFactory{
-		vmRepo:        vmRepo,
-		stemcellRepo:  stemcellRepo,
-		diskDeployer:  diskDeployer,
-		uuidGenerator: uuidGenerator,
-		fs:            fs,
-		logger:        logger,
+		vmRepo:             vmRepo,
+		stemcellRepo:       stemcellRepo,
+		diskDeployer:       diskDeployer,
+		agentClientFactory: agentClientFactory,
+		uuidGenerator:      uuidGenerator,
+		timeService:        timeService,
+		fs:                 fs,
+		logger:             logger,
 	}
 }
 
-func (f *managerFactory) NewManager(cloud bicloud.Cloud, agentClient biagentclient.AgentClient) Manager {
+func (f *managerFactory) NewManager(cloud bicloud.Cloud, directorID string, mbusURL string, mbusCert biinstallmanifest.Cert) Manager {
 	return NewManager(
 		f.vmRepo,
 		f.stemcellRepo,
 		f.diskDeployer,
-		agentClient,
+		f.agentClientFactory,
+		directorID,
+		mbusURL,
+		mbusCert,
 		cloud,
 		f.uuidGenerator,
+		f.timeService,
 		f.fs,
 		f.logger,
 	)
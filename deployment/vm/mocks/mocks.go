@@ -6,8 +6,8 @@ package mocks
 import (
 	gomock "code.google.com/p/gomock/gomock"
 	cloud "github.com/cloudfoundry/bosh-init/cloud"
-	agentclient "github.com/cloudfoundry/bosh-init/deployment/agentclient"
 	vm "github.com/cloudfoundry/bosh-init/deployment/vm"
+	manifest "github.com/cloudfoundry/bosh-init/installation/manifest"
 )
 
 // Mock of ManagerFactory interface
@@ -31,12 +31,12 @@ func (_m *MockManagerFactory) EXPECT() *_MockManagerFactoryRecorder {
 	return _m.recorder
 }
 
-func (_m *MockManagerFactory) NewManager(_param0 cloud.Cloud, _param1 agentclient.AgentClient) vm.Manager {
-	ret := _m.ctrl.Call(_m, "NewManager", _param0, _param1)
+func (_m *MockManagerFactory) NewManager(_param0 cloud.Cloud, _param1 string, _param2 string, _param3 manifest.Cert) vm.Manager {
+	ret := _m.ctrl.Call(_m, "NewManager", _param0, _param1, _param2, _param3)
 	ret0, _ := ret[0].(vm.Manager)
 	return ret0
 }
 
-func (_mr *_MockManagerFactoryRecorder) NewManager(arg0, arg1 interface{}) *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "NewManager", arg0, arg1)
+func (_mr *_MockManagerFactoryRecorder) NewManager(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "NewManager", arg0, arg1, arg2, arg3)
 }
@@ -15,11 +15,19 @@ import (
 	bias "github.com/cloudfoundry/bosh-init/deployment/applyspec"
 	bidisk "github.com/cloudfoundry/bosh-init/deployment/disk"
 	bideplmanifest "github.com/cloudfoundry/bosh-init/deployment/manifest"
+	biinstallmanifest "github.com/cloudfoundry/bosh-init/installation/manifest"
 	biui "github.com/cloudfoundry/bosh-init/ui"
 )
 
 type VM interface {
 	CID() string
+	JobName() string
+	Index() int
+	AgentHost() string
+	IPs() []string
+	CreatedAt() string
+	MbusURL() string
+	MbusCert() biinstallmanifest.Cert
 	Exists() (bool, error)
 	AgentClient() biagentclient.AgentClient
 	WaitUntilReady(timeout time.Duration, delay time.Duration) error
@@ -27,21 +35,25 @@ type VM interface {
 	Stop() error
 	Apply(bias.ApplySpec) error
 	UpdateDisks(bideplmanifest.DiskPool, biui.Stage) ([]bidisk.Disk, error)
+	DeleteUnusedDisks(biui.Stage) error
 	WaitToBeRunning(maxAttempts int, delay time.Duration) error
 	AttachDisk(bidisk.Disk) error
 	DetachDisk(bidisk.Disk) error
 	Disks() ([]bidisk.Disk, error)
 	UnmountDisk(bidisk.Disk) error
 	MigrateDisk() error
+	RunErrand() (biagentclient.ErrandResult, error)
 	Delete() error
 }
 
 type vm struct {
-	cid          string
+	record       biconfig.VMRecord
 	vmRepo       biconfig.VMRepo
 	stemcellRepo biconfig.StemcellRepo
 	diskDeployer DiskDeployer
 	agentClient  biagentclient.AgentClient
+	mbusURL      string
+	mbusCert     biinstallmanifest.Cert
 	cloud        bicloud.Cloud
 	fs           boshsys.FileSystem
 	logger       boshlog.Logger
@@ -49,21 +61,25 @@ type vm struct {
 }
 
 func NewVM(
-	cid string,
+	record biconfig.VMRecord,
 	vmRepo biconfig.VMRepo,
 	stemcellRepo biconfig.StemcellRepo,
 	diskDeployer DiskDeployer,
 	agentClient biagentclient.AgentClient,
+	mbusURL string,
+	mbusCert biinstallmanifest.Cert,
 	cloud bicloud.Cloud,
 	fs boshsys.FileSystem,
 	logger boshlog.Logger,
 ) VM {
 	return &vm{
-		cid:          cid,
+		record:       record,
 		vmRepo:       vmRepo,
 		stemcellRepo: stemcellRepo,
 		diskDeployer: diskDeployer,
 		agentClient:  agentClient,
+		mbusURL:      mbusURL,
+		mbusCert:     mbusCert,
 		cloud:        cloud,
 		fs:           fs,
 		logger:       logger,
@@ -72,13 +88,46 @@ func NewVM(
 }
 
 func (vm *vm) CID() string {
-	return vm.cid
+	return vm.record.CID
+}
+
+func (vm *vm) JobName() string {
+	return vm.record.JobName
+}
+
+func (vm *vm) Index() int {
+	return vm.record.Index
+}
+
+// AgentHost is empty when the agent is reachable at the mbus URL host
+func (vm *vm) AgentHost() string {
+	return vm.record.AgentHost
+}
+
+// IPs are the static and vip IPs of the vm
+func (vm *vm) IPs() []string {
+	return vm.record.IPs
+}
+
+// CreatedAt is the time the vm was created, in RFC 3339 format, or empty for vms recorded before it was
+func (vm *vm) CreatedAt() string {
+	return vm.record.CreatedAt
+}
+
+// MbusURL is the URL of the agent of this vm, which also serves its blobstore
+func (vm *vm) MbusURL() string {
+	return vm.mbusURL
+}
+
+// MbusCert verifies the TLS certificate of the agent at the mbus URL
+func (vm *vm) MbusCert() biinstallmanifest.Cert {
+	return vm.mbusCert
 }
 
 func (vm *vm) Exists() (bool, error) {
-	exists, err := vm.cloud.HasVM(vm.cid)
+	exists, err := vm.cloud.HasVM(vm.record.CID)
 	if err != nil {
-		return false, bosherr.WrapErrorf(err, "Checking existance of VM '%s'", vm.cid)
+		return false, bosherr.WrapErrorf(err, "Checking existance of VM '%s'", vm.record.CID)
 	}
 	return exists, nil
 }
@@ -132,6 +181,14 @@ func (vm *vm) UpdateDisks(diskPool bideplmanifest.DiskPool, eventLoggerStage biu
 	return disks, nil
 }
 
+func (vm *vm) DeleteUnusedDisks(eventLoggerStage biui.Stage) error {
+	err := vm.diskDeployer.DeleteUnused(eventLoggerStage)
+	if err != nil {
+		return bosherr.WrapError(err, "Deleting unused disks")
+	}
+	return nil
+}
+
 func (vm *vm) WaitToBeRunning(maxAttempts int, delay time.Duration) error {
 	agentGetStateRetryable := biagentclient.NewGetStateRetryable(vm.agentClient)
 	agentGetStateRetryStrategy := boshretry.NewAttemptRetryStrategy(maxAttempts, delay, agentGetStateRetryable, vm.logger)
@@ -139,7 +196,7 @@ func (vm *vm) WaitToBeRunning(maxAttempts int, delay time.Duration) error {
 }
 
 func (vm *vm) AttachDisk(disk bidisk.Disk) error {
-	err := vm.cloud.AttachDisk(vm.cid, disk.CID())
+	err := vm.cloud.AttachDisk(vm.record.CID, disk.CID())
 	if err != nil {
 		return bosherr.WrapError(err, "Attaching disk in the cloud")
 	}
@@ -153,7 +210,7 @@ func (vm *vm) AttachDisk(disk bidisk.Disk) error {
 }
 
 func (vm *vm) DetachDisk(disk bidisk.Disk) error {
-	err := vm.cloud.DetachDisk(vm.cid, disk.CID())
+	err := vm.cloud.DetachDisk(vm.record.CID, disk.CID())
 	if err != nil {
 		return bosherr.WrapError(err, "Detaching disk in the cloud")
 	}
@@ -185,8 +242,18 @@ func (vm *vm) MigrateDisk() error {
 	return vm.agentClient.MigrateDisk()
 }
 
+func (vm *vm) RunErrand() (biagentclient.ErrandResult, error) {
+	vm.logger.Debug(vm.logTag, "Running errand")
+	result, err := vm.agentClient.RunErrand()
+	if err != nil {
+		return result, bosherr.WrapError(err, "Running errand")
+	}
+
+	return result, nil
+}
+
 func (vm *vm) Delete() error {
-	deleteErr := vm.cloud.DeleteVM(vm.cid)
+	deleteErr := vm.cloud.DeleteVM(vm.record.CID)
 	if deleteErr != nil {
 		// allow VMNotFoundError for idempotency
 		cloudErr, ok := deleteErr.(bicloud.Error)
@@ -195,14 +262,22 @@ func (vm *vm) Delete() error {
 		}
 	}
 
-	err := vm.vmRepo.ClearCurrent()
+	err := vm.vmRepo.ClearCurrent(vm.record.CID)
 	if err != nil {
 		return bosherr.WrapError(err, "Deleting vm from vm repo")
 	}
 
-	err = vm.stemcellRepo.ClearCurrent()
+	remainingVMs, err := vm.vmRepo.FindCurrent()
 	if err != nil {
-		return bosherr.WrapError(err, "Clearing current stemcell from stemcell repo")
+		return bosherr.WrapError(err, "Finding remaining vms")
+	}
+
+	// the current stemcell stays in use until the last vm is deleted
+	if len(remainingVMs) == 0 {
+		err = vm.stemcellRepo.ClearCurrent()
+		if err != nil {
+			return bosherr.WrapError(err, "Clearing current stemcell from stemcell repo")
+		}
 	}
 
 	// returns bicloud.Error only if it is a VMNotFoundError
@@ -19,6 +19,7 @@ import (
 	bias "github.com/cloudfoundry/bosh-init/deployment/applyspec"
 	bidisk "github.com/cloudfoundry/bosh-init/deployment/disk"
 	bideplmanifest "github.com/cloudfoundry/bosh-init/deployment/manifest"
+	biinstallmanifest "github.com/cloudfoundry/bosh-init/installation/manifest"
 
 	fakebicloud "github.com/cloudfoundry/bosh-init/cloud/fakes"
 	fakebiconfig "github.com/cloudfoundry/bosh-init/config/fakes"
@@ -65,11 +66,13 @@ var _ = Describe("VM", func() {
 		fakeStemcellRepo = fakebiconfig.NewFakeStemcellRepo()
 		fakeDiskDeployer = fakebivm.NewFakeDiskDeployer()
 		vm = NewVM(
-			"fake-vm-cid",
+			biconfig.VMRecord{CID: "fake-vm-cid", JobName: "fake-job-name", Index: 0},
 			fakeVMRepo,
 			fakeStemcellRepo,
 			fakeDiskDeployer,
 			fakeAgentClient,
+			"https://fake-mbus-host:6868",
+			biinstallmanifest.Cert{},
 			fakeCloud,
 			fs,
 			logger,
@@ -129,6 +132,31 @@ var _ = Describe("VM", func() {
 		})
 	})
 
+	Describe("DeleteUnusedDisks", func() {
+		It("delegates to DiskDeployer.DeleteUnused", func() {
+			fakeStage := fakebiui.NewFakeStage()
+
+			err := vm.DeleteUnusedDisks(fakeStage)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fakeDiskDeployer.DeleteUnusedInputs).To(Equal([]fakebivm.DeleteUnusedInput{
+				{EventLoggerStage: fakeStage},
+			}))
+		})
+
+		Context("when deleting unused disks fails", func() {
+			BeforeEach(func() {
+				fakeDiskDeployer.DeleteUnusedErr = errors.New("fake-delete-unused-error")
+			})
+
+			It("returns an error", func() {
+				err := vm.DeleteUnusedDisks(fakebiui.NewFakeStage())
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("fake-delete-unused-error"))
+			})
+		})
+	})
+
 	Describe("Stop", func() {
 		It("stops agent services", func() {
 			err := vm.Stop()
@@ -343,7 +371,7 @@ var _ = Describe("VM", func() {
 		It("deletes VM in the vm repo", func() {
 			err := vm.Delete()
 			Expect(err).ToNot(HaveOccurred())
-			Expect(fakeVMRepo.ClearCurrentCalled).To(BeTrue())
+			Expect(fakeVMRepo.ClearCurrentCID).To(Equal("fake-vm-cid"))
 		})
 
 		It("clears current stemcell in the stemcell repo", func() {
@@ -352,6 +380,18 @@ var _ = Describe("VM", func() {
 			Expect(fakeStemcellRepo.ClearCurrentCalled).To(BeTrue())
 		})
 
+		Context("when other vms are still current", func() {
+			BeforeEach(func() {
+				fakeVMRepo.SetFindCurrentBehavior([]biconfig.VMRecord{{CID: "fake-other-vm-cid"}}, nil)
+			})
+
+			It("does not clear the current stemcell", func() {
+				err := vm.Delete()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(fakeStemcellRepo.ClearCurrentCalled).To(BeFalse())
+			})
+		})
+
 		Context("when deleting vm in the cloud fails", func() {
 			BeforeEach(func() {
 				fakeCloud.DeleteVMErr = errors.New("fake-delete-vm-error")
@@ -387,7 +427,7 @@ var _ = Describe("VM", func() {
 				err := vm.Delete()
 				Expect(err).To(HaveOccurred())
 				Expect(err).To(Equal(deleteErr))
-				Expect(fakeVMRepo.ClearCurrentCalled).To(BeTrue())
+				Expect(fakeVMRepo.ClearCurrentCID).To(Equal("fake-vm-cid"))
 			})
 
 			It("clears current stemcell in the stemcell repo", func() {
@@ -418,4 +458,29 @@ var _ = Describe("VM", func() {
 			})
 		})
 	})
+
+	Describe("RunErrand", func() {
+		BeforeEach(func() {
+			fakeAgentClient.SetRunErrandBehavior(biagentclient.ErrandResult{ExitStatus: 1, Stdout: "fake-stdout"}, nil)
+		})
+
+		It("sends run_errand to the agent and returns its result", func() {
+			result, err := vm.RunErrand()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fakeAgentClient.RunErrandCalledTimes).To(Equal(1))
+			Expect(result).To(Equal(biagentclient.ErrandResult{ExitStatus: 1, Stdout: "fake-stdout"}))
+		})
+
+		Context("when running the errand fails", func() {
+			BeforeEach(func() {
+				fakeAgentClient.SetRunErrandBehavior(biagentclient.ErrandResult{}, errors.New("fake-run-errand-error"))
+			})
+
+			It("returns an error", func() {
+				_, err := vm.RunErrand()
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("fake-run-errand-error"))
+			})
+		})
+	})
 })
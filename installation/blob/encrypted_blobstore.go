@@ -0,0 +1,97 @@
+package blob
+
+import (
+	boshblob "github.com/cloudfoundry/bosh-agent/blobstore"
+	bosherr "github.com/cloudfoundry/bosh-agent/errors"
+	boshsys "github.com/cloudfoundry/bosh-agent/system"
+
+	bicrypto "github.com/cloudfoundry/bosh-init/crypto"
+)
+
+type encryptedBlobstore struct {
+	blobstore boshblob.Blobstore
+	encryptor bicrypto.Encryptor
+	fs        boshsys.FileSystem
+}
+
+// NewEncryptedBlobstore returns a blobstore that stores blobs encrypted in the inner blobstore, if the encryptor has a key.
+// Blobs that were stored before encryption was enabled are returned unchanged.
+// Blobs are encrypted in memory, so it is meant for small blobs, like rendered job templates.
+func NewEncryptedBlobstore(blobstore boshblob.Blobstore, encryptor bicrypto.Encryptor, fs boshsys.FileSystem) boshblob.Blobstore {
+	return encryptedBlobstore{
+		blobstore: blobstore,
+		encryptor: encryptor,
+		fs:        fs,
+	}
+}
+
+// Get ignores the fingerprint, which is the fingerprint of the decrypted blob
+func (b encryptedBlobstore) Get(blobID, _ string) (string, error) {
+	fileName, err := b.blobstore.Get(blobID, "")
+	if err != nil {
+		return "", err
+	}
+
+	contents, err := b.fs.ReadFile(fileName)
+	if err != nil {
+		b.blobstore.CleanUp(fileName)
+		return "", bosherr.WrapErrorf(err, "Reading blob '%s'", blobID)
+	}
+
+	if !bicrypto.IsEncrypted(contents) {
+		return fileName, nil
+	}
+
+	contents, err = b.encryptor.Decrypt(contents)
+	if err != nil {
+		b.blobstore.CleanUp(fileName)
+		return "", bosherr.WrapErrorf(err, "Decrypting blob '%s'", blobID)
+	}
+
+	err = b.fs.WriteFile(fileName, contents)
+	if err != nil {
+		b.blobstore.CleanUp(fileName)
+		return "", bosherr.WrapErrorf(err, "Writing decrypted blob '%s'", blobID)
+	}
+
+	return fileName, nil
+}
+
+func (b encryptedBlobstore) CleanUp(fileName string) error {
+	return b.blobstore.CleanUp(fileName)
+}
+
+func (b encryptedBlobstore) Create(fileName string) (string, string, error) {
+	if !b.encryptor.HasKey() {
+		return b.blobstore.Create(fileName)
+	}
+
+	contents, err := b.fs.ReadFile(fileName)
+	if err != nil {
+		return "", "", bosherr.WrapErrorf(err, "Reading file '%s'", fileName)
+	}
+
+	contents, err = b.encryptor.Encrypt(contents)
+	if err != nil {
+		return "", "", bosherr.WrapErrorf(err, "Encrypting file '%s'", fileName)
+	}
+
+	encryptedFile, err := b.fs.TempFile("bosh-init-encrypted-blob")
+	if err != nil {
+		return "", "", bosherr.WrapError(err, "Creating temporary file")
+	}
+	encryptedFileName := encryptedFile.Name()
+	encryptedFile.Close()
+	defer b.fs.RemoveAll(encryptedFileName)
+
+	err = b.fs.WriteFile(encryptedFileName, contents)
+	if err != nil {
+		return "", "", bosherr.WrapErrorf(err, "Writing encrypted file '%s'", encryptedFileName)
+	}
+
+	return b.blobstore.Create(encryptedFileName)
+}
+
+func (b encryptedBlobstore) Validate() error {
+	return b.blobstore.Validate()
+}
@@ -0,0 +1,103 @@
+package blob_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	boshblob "github.com/cloudfoundry/bosh-agent/blobstore"
+
+	fakeblobstore "github.com/cloudfoundry/bosh-agent/blobstore/fakes"
+	fakesys "github.com/cloudfoundry/bosh-agent/system/fakes"
+
+	bicrypto "github.com/cloudfoundry/bosh-init/crypto"
+	. "github.com/cloudfoundry/bosh-init/installation/blob"
+)
+
+var _ = Describe("EncryptedBlobstore", func() {
+	var (
+		innerBlobstore *fakeblobstore.FakeBlobstore
+		encryptor      bicrypto.Encryptor
+		fs             *fakesys.FakeFileSystem
+		blobstore      boshblob.Blobstore
+	)
+
+	BeforeEach(func() {
+		innerBlobstore = fakeblobstore.NewFakeBlobstore()
+		encryptor = bicrypto.NewEncryptor([]byte("fake-key"))
+		fs = fakesys.NewFakeFileSystem()
+		fs.ReturnTempFile = fakesys.NewFakeFile("/fake-encrypted-file", fs)
+
+		blobstore = NewEncryptedBlobstore(innerBlobstore, encryptor, fs)
+	})
+
+	Describe("Create", func() {
+		var encryptedContents string
+
+		BeforeEach(func() {
+			fs.WriteFileString("/fake-rendered-job.tgz", "fake-rendered-job-contents")
+			innerBlobstore.CreateBlobID = "fake-blob-id"
+			innerBlobstore.CreateCallBack = func() {
+				encryptedContents, _ = fs.ReadFileString("/fake-encrypted-file")
+			}
+		})
+
+		It("stores the file encrypted in the inner blobstore", func() {
+			blobID, _, err := blobstore.Create("/fake-rendered-job.tgz")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(blobID).To(Equal("fake-blob-id"))
+
+			Expect(innerBlobstore.CreateFileNames).To(Equal([]string{"/fake-encrypted-file"}))
+			Expect(bicrypto.IsEncrypted([]byte(encryptedContents))).To(BeTrue())
+			Expect(encryptedContents).ToNot(ContainSubstring("fake-rendered-job-contents"))
+
+			Expect(fs.FileExists("/fake-encrypted-file")).To(BeFalse())
+		})
+
+		It("stores the file unchanged when the encryptor has no key", func() {
+			encryptor.SetKey(nil)
+
+			_, _, err := blobstore.Create("/fake-rendered-job.tgz")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(innerBlobstore.CreateFileNames).To(Equal([]string{"/fake-rendered-job.tgz"}))
+		})
+	})
+
+	Describe("Get", func() {
+		BeforeEach(func() {
+			innerBlobstore.GetFileName = "/fake-blob-file"
+		})
+
+		It("returns the decrypted blob", func() {
+			encrypted, err := encryptor.Encrypt([]byte("fake-rendered-job-contents"))
+			Expect(err).ToNot(HaveOccurred())
+			fs.WriteFile("/fake-blob-file", encrypted)
+
+			fileName, err := blobstore.Get("fake-blob-id", "fake-sha1")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fileName).To(Equal("/fake-blob-file"))
+			Expect(fs.ReadFileString("/fake-blob-file")).To(Equal("fake-rendered-job-contents"))
+
+			Expect(innerBlobstore.GetBlobIDs).To(Equal([]string{"fake-blob-id"}))
+		})
+
+		It("returns blobs stored before encryption was enabled unchanged", func() {
+			fs.WriteFileString("/fake-blob-file", "fake-rendered-job-contents")
+
+			fileName, err := blobstore.Get("fake-blob-id", "fake-sha1")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fs.ReadFileString(fileName)).To(Equal("fake-rendered-job-contents"))
+		})
+
+		It("returns an error and cleans up the blob when the key is wrong", func() {
+			encrypted, err := bicrypto.NewEncryptor([]byte("fake-other-key")).Encrypt([]byte("fake-rendered-job-contents"))
+			Expect(err).ToNot(HaveOccurred())
+			fs.WriteFile("/fake-blob-file", encrypted)
+
+			_, err = blobstore.Get("fake-blob-id", "fake-sha1")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Decrypting blob 'fake-blob-id'"))
+			Expect(innerBlobstore.CleanUpFileName).To(Equal("/fake-blob-file"))
+		})
+	})
+})
@@ -0,0 +1,95 @@
+package installation
+
+import (
+	"path/filepath"
+
+	bosherr "github.com/cloudfoundry/bosh-agent/errors"
+	boshsys "github.com/cloudfoundry/bosh-agent/system"
+
+	biconfig "github.com/cloudfoundry/bosh-init/config"
+	biinstalljob "github.com/cloudfoundry/bosh-init/installation/job"
+	biinstallmanifest "github.com/cloudfoundry/bosh-init/installation/manifest"
+	biregistry "github.com/cloudfoundry/bosh-init/registry"
+	biui "github.com/cloudfoundry/bosh-init/ui"
+)
+
+// Finder finds the CPI installed by a previous deploy, without installing it again.
+// The rendered CPI job is extracted from the templates blobstore; the installation must be cleaned up after use.
+type Finder interface {
+	Find(biinstallmanifest.Manifest, biui.Stage) (Installation, bool, error)
+}
+
+type finder struct {
+	deploymentConfigService biconfig.DeploymentConfigService
+	fs                      boshsys.FileSystem
+	installerFactory        InstallerFactory
+	registryServerManager   biregistry.ServerManager
+	installationsRootPath   string
+}
+
+func NewFinder(
+	deploymentConfigService biconfig.DeploymentConfigService,
+	fs boshsys.FileSystem,
+	installerFactory InstallerFactory,
+	registryServerManager biregistry.ServerManager,
+	installationsRootPath string,
+) Finder {
+	return &finder{
+		deploymentConfigService: deploymentConfigService,
+		fs:                      fs,
+		installerFactory:        installerFactory,
+		registryServerManager:   registryServerManager,
+		installationsRootPath:   installationsRootPath,
+	}
+}
+
+func (f *finder) Find(manifest biinstallmanifest.Manifest, stage biui.Stage) (Installation, bool, error) {
+	deploymentConfig, err := f.deploymentConfigService.Load()
+	if err != nil {
+		return nil, false, bosherr.WrapError(err, "Loading deployment config")
+	}
+
+	if deploymentConfig.InstallationID == "" {
+		return nil, false, nil
+	}
+
+	target := NewTarget(filepath.Join(f.installationsRootPath, deploymentConfig.InstallationID))
+
+	renderedCPIJob, found, err := loadRenderedCPIJob(f.fs, target.RenderedCPIJobPath())
+	if err != nil {
+		return nil, false, err
+	}
+
+	if !found {
+		return f.findLegacyJob(target, manifest)
+	}
+
+	if renderedCPIJob.Name != manifest.Template.Name {
+		return nil, false, nil
+	}
+
+	jobInstaller := f.installerFactory.NewJobInstaller(target)
+	installedJob, err := jobInstaller.Install(renderedCPIJob, stage)
+	if err != nil {
+		return nil, false, bosherr.WrapErrorf(err, "Installing job '%s' for CPI release", renderedCPIJob.Name)
+	}
+
+	return NewInstallation(target, installedJob, jobInstaller, manifest, f.registryServerManager), true, nil
+}
+
+// findLegacyJob finds the job that versions before the rendered CPI job was recorded installed into the installation,
+// which is kept until the next deploy installs the CPI again
+func (f *finder) findLegacyJob(target Target, manifest biinstallmanifest.Manifest) (Installation, bool, error) {
+	jobName := manifest.Template.Name
+	jobPath := filepath.Join(target.JobsPath(), jobName)
+	if !f.fs.FileExists(jobPath) {
+		return nil, false, nil
+	}
+
+	installedJob := biinstalljob.InstalledJob{
+		Name: jobName,
+		Path: jobPath,
+	}
+
+	return NewInstallation(target, installedJob, nil, manifest, f.registryServerManager), true, nil
+}
@@ -0,0 +1,181 @@
+package installation_test
+
+import (
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/cloudfoundry/bosh-init/installation"
+
+	"code.google.com/p/gomock/gomock"
+	mock_install_job "github.com/cloudfoundry/bosh-init/installation/job/mocks"
+	mock_install "github.com/cloudfoundry/bosh-init/installation/mocks"
+
+	boshlog "github.com/cloudfoundry/bosh-agent/logger"
+
+	fakesys "github.com/cloudfoundry/bosh-agent/system/fakes"
+	faketime "github.com/cloudfoundry/bosh-agent/time/fakes"
+	fakeuuid "github.com/cloudfoundry/bosh-agent/uuid/fakes"
+
+	biconfig "github.com/cloudfoundry/bosh-init/config"
+	bicrypto "github.com/cloudfoundry/bosh-init/crypto"
+	biinstalljob "github.com/cloudfoundry/bosh-init/installation/job"
+	biinstallmanifest "github.com/cloudfoundry/bosh-init/installation/manifest"
+	fakebiui "github.com/cloudfoundry/bosh-init/ui/fakes"
+)
+
+var _ = Describe("Finder", func() {
+	var mockCtrl *gomock.Controller
+
+	BeforeEach(func() {
+		mockCtrl = gomock.NewController(GinkgoT())
+	})
+
+	AfterEach(func() {
+		mockCtrl.Finish()
+	})
+
+	var (
+		fakeFS                  *fakesys.FakeFileSystem
+		fakeStage               *fakebiui.FakeStage
+		mockInstallerFactory    *mock_install.MockInstallerFactory
+		mockJobInstaller        *mock_install_job.MockInstaller
+		deploymentConfigService biconfig.DeploymentConfigService
+		manifest                biinstallmanifest.Manifest
+
+		finder Finder
+
+		configPath            = "/deployment.json"
+		installationsRootPath = "/.bosh_init/installations"
+	)
+
+	BeforeEach(func() {
+		fakeFS = fakesys.NewFakeFileSystem()
+		fakeUUIDGenerator := fakeuuid.NewFakeGenerator()
+		logger := boshlog.NewLogger(boshlog.LevelNone)
+		deploymentConfigService = biconfig.NewFileSystemDeploymentConfigService(
+			fakeFS,
+			fakeUUIDGenerator,
+			&faketime.FakeService{},
+			bicrypto.NewEncryptor(nil),
+			logger,
+		)
+		deploymentConfigService.SetConfigPath(configPath)
+
+		manifest = biinstallmanifest.Manifest{
+			Template: biinstallmanifest.ReleaseJobRef{
+				Name:    "fake-cpi-job-name",
+				Release: "fake-cpi-release-name",
+			},
+		}
+
+		fakeStage = fakebiui.NewFakeStage()
+		mockInstallerFactory = mock_install.NewMockInstallerFactory(mockCtrl)
+		mockJobInstaller = mock_install_job.NewMockInstaller(mockCtrl)
+
+		finder = NewFinder(deploymentConfigService, fakeFS, mockInstallerFactory, nil, installationsRootPath)
+	})
+
+	Context("when the rendered CPI job has been recorded", func() {
+		var renderedCPIJob biinstalljob.RenderedJobRef
+
+		BeforeEach(func() {
+			err := fakeFS.WriteFileString(configPath, `{"installation_id":"12345"}`)
+			Expect(err).ToNot(HaveOccurred())
+			err = fakeFS.WriteFileString("/.bosh_init/installations/12345/rendered_cpi_job.json", `{
+				"name": "fake-cpi-job-name",
+				"version": "fake-cpi-job-fingerprint",
+				"blobstore_id": "fake-blobstore-id",
+				"sha1": "fake-sha1"
+			}`)
+			Expect(err).ToNot(HaveOccurred())
+
+			renderedCPIJob = biinstalljob.RenderedJobRef{
+				Name:        "fake-cpi-job-name",
+				Version:     "fake-cpi-job-fingerprint",
+				BlobstoreID: "fake-blobstore-id",
+				SHA1:        "fake-sha1",
+			}
+			mockInstallerFactory.EXPECT().NewJobInstaller(NewTarget("/.bosh_init/installations/12345")).Return(mockJobInstaller).AnyTimes()
+		})
+
+		It("extracts the rendered CPI job and returns the installation, which cleans up the job", func() {
+			installedJob := biinstalljob.InstalledJob{Name: "fake-cpi-job-name", Path: "/tmp/bosh-init-jobs/fake-cpi-job-name"}
+			mockJobInstaller.EXPECT().Install(renderedCPIJob, fakeStage).Return(installedJob, nil)
+
+			installation, found, err := finder.Find(manifest, fakeStage)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(found).To(BeTrue())
+			Expect(installation.Target().Path()).To(Equal("/.bosh_init/installations/12345"))
+			Expect(installation.Job()).To(Equal(installedJob))
+
+			mockJobInstaller.EXPECT().Cleanup(installedJob)
+			Expect(installation.Cleanup()).ToNot(HaveOccurred())
+		})
+
+		It("returns an error when extracting the job fails", func() {
+			mockJobInstaller.EXPECT().Install(renderedCPIJob, fakeStage).Return(biinstalljob.InstalledJob{}, errors.New("fake-install-error"))
+
+			_, _, err := finder.Find(manifest, fakeStage)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("fake-install-error"))
+		})
+
+		It("does not find an installation of another CPI job", func() {
+			manifest.Template.Name = "other-cpi-job-name"
+
+			_, found, err := finder.Find(manifest, fakeStage)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(found).To(BeFalse())
+		})
+	})
+
+	Context("when the CPI job has been installed by an earlier version", func() {
+		BeforeEach(func() {
+			err := fakeFS.WriteFileString(configPath, `{"installation_id":"12345"}`)
+			Expect(err).ToNot(HaveOccurred())
+			err = fakeFS.MkdirAll("/.bosh_init/installations/12345/jobs/fake-cpi-job-name", 0755)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("returns the installation", func() {
+			installation, found, err := finder.Find(manifest, fakeStage)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(found).To(BeTrue())
+			Expect(installation.Target().Path()).To(Equal("/.bosh_init/installations/12345"))
+			Expect(installation.Job().Name).To(Equal("fake-cpi-job-name"))
+			Expect(installation.Job().Path).To(Equal("/.bosh_init/installations/12345/jobs/fake-cpi-job-name"))
+		})
+	})
+
+	Context("when the CPI job has not been installed", func() {
+		BeforeEach(func() {
+			err := fakeFS.WriteFileString(configPath, `{"installation_id":"12345"}`)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("does not find an installation", func() {
+			_, found, err := finder.Find(manifest, fakeStage)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(found).To(BeFalse())
+		})
+	})
+
+	Context("when the deployment config has no installation_id", func() {
+		It("does not find an installation", func() {
+			_, found, err := finder.Find(manifest, fakeStage)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(found).To(BeFalse())
+		})
+
+		It("does not generate an installation_id", func() {
+			_, _, err := finder.Find(manifest, fakeStage)
+			Expect(err).ToNot(HaveOccurred())
+
+			deploymentConfig, err := deploymentConfigService.Load()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(deploymentConfig.InstallationID).To(BeEmpty())
+		})
+	})
+})
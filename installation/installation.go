@@ -11,13 +11,18 @@ import (
 type Installation interface {
 	Target() Target
 	Job() biinstalljob.InstalledJob
+	Manifest() biinstallmanifest.Manifest
 	StartRegistry() error
 	StopRegistry() error
+
+	// Cleanup deletes the CPI job extracted for the command, once the CPI is no longer run
+	Cleanup() error
 }
 
 type installation struct {
 	target                Target
 	job                   biinstalljob.InstalledJob
+	jobInstaller          biinstalljob.Installer
 	manifest              biinstallmanifest.Manifest
 	registryServerManager biregistry.ServerManager
 
@@ -27,12 +32,14 @@ type installation struct {
 func NewInstallation(
 	target Target,
 	job biinstalljob.InstalledJob,
+	jobInstaller biinstalljob.Installer,
 	manifest biinstallmanifest.Manifest,
 	registryServerManager biregistry.ServerManager,
 ) Installation {
 	return &installation{
 		target:                target,
 		job:                   job,
+		jobInstaller:          jobInstaller,
 		manifest:              manifest,
 		registryServerManager: registryServerManager,
 	}
@@ -46,6 +53,10 @@ func (i *installation) Job() biinstalljob.InstalledJob {
 	return i.job
 }
 
+func (i *installation) Manifest() biinstallmanifest.Manifest {
+	return i.manifest
+}
+
 func (i *installation) StartRegistry() error {
 	if !i.manifest.Registry.IsEmpty() {
 		if i.registryServer != nil {
@@ -74,3 +85,16 @@ func (i *installation) StopRegistry() error {
 	}
 	return nil
 }
+
+// Cleanup does nothing for a job installed by an earlier version of bosh-init, which has no job installer
+func (i *installation) Cleanup() error {
+	if i.jobInstaller == nil {
+		return nil
+	}
+
+	err := i.jobInstaller.Cleanup(i.job)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Cleaning up job '%s'", i.job.Name)
+	}
+	return nil
+}
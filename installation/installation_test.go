@@ -9,6 +9,7 @@ import (
 	. "github.com/cloudfoundry/bosh-init/installation"
 
 	"code.google.com/p/gomock/gomock"
+	mock_install_job "github.com/cloudfoundry/bosh-init/installation/job/mocks"
 	mock_registry "github.com/cloudfoundry/bosh-init/registry/mocks"
 
 	biinstalljob "github.com/cloudfoundry/bosh-init/installation/job"
@@ -30,13 +31,14 @@ var _ = Describe("Installation", func() {
 		manifest                  biinstallmanifest.Manifest
 		mockRegistryServerManager *mock_registry.MockServerManager
 		mockRegistryServer        *mock_registry.MockServer
+		mockJobInstaller          *mock_install_job.MockInstaller
 
 		target       Target
 		installedJob biinstalljob.InstalledJob
 	)
 
 	var newInstalation = func() Installation {
-		return NewInstallation(target, installedJob, manifest, mockRegistryServerManager)
+		return NewInstallation(target, installedJob, mockJobInstaller, manifest, mockRegistryServerManager)
 	}
 
 	BeforeEach(func() {
@@ -44,6 +46,7 @@ var _ = Describe("Installation", func() {
 
 		mockRegistryServerManager = mock_registry.NewMockServerManager(mockCtrl)
 		mockRegistryServer = mock_registry.NewMockServer(mockCtrl)
+		mockJobInstaller = mock_install_job.NewMockInstaller(mockCtrl)
 
 		target = NewTarget("fake-installation-path")
 
@@ -151,4 +154,30 @@ var _ = Describe("Installation", func() {
 			})
 		})
 	})
+
+	Describe("Cleanup", func() {
+		It("cleans up the installed job", func() {
+			mockJobInstaller.EXPECT().Cleanup(installedJob)
+
+			err := newInstalation().Cleanup()
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		Context("when cleaning up the job fails", func() {
+			It("returns an error", func() {
+				mockJobInstaller.EXPECT().Cleanup(installedJob).Return(errors.New("fake-cleanup-error"))
+
+				err := newInstalation().Cleanup()
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(Equal("Cleaning up job 'cpi': fake-cleanup-error"))
+			})
+		})
+
+		Context("when the job was installed without a job installer", func() {
+			It("does nothing", func() {
+				installation := NewInstallation(target, installedJob, nil, manifest, mockRegistryServerManager)
+				Expect(installation.Cleanup()).ToNot(HaveOccurred())
+			})
+		})
+	})
 })
@@ -58,6 +58,12 @@ func (i *installer) Install(manifest biinstallmanifest.Manifest, stage biui.Stag
 	i.logger.Info(i.logTag, "Installing CPI deployment '%s'", manifest.Name)
 	i.logger.Debug(i.logTag, "Installing CPI deployment '%s' with manifest: %#v", manifest.Name, manifest)
 
+	// the CPI may change, so its info is requested again when a cloud is next created
+	err := i.fs.RemoveAll(i.target.CPIInfoPath())
+	if err != nil {
+		return nil, bosherr.WrapError(err, "Removing cached CPI info")
+	}
+
 	state, err := i.stateBuilder.Build(manifest, stage)
 	if err != nil {
 		return nil, bosherr.WrapError(err, "Building installation state")
@@ -87,10 +93,35 @@ func (i *installer) Install(manifest biinstallmanifest.Manifest, stage biui.Stag
 		return nil, bosherr.WrapErrorf(err, "Installing job '%s' for CPI release", renderedCPIJob.Name)
 	}
 
+	err = i.recordRenderedCPIJob(renderedCPIJob)
+	if err != nil {
+		cleanupErr := i.jobInstaller.Cleanup(installedJob)
+		if cleanupErr != nil {
+			i.logger.Warn(i.logTag, "Failed to clean up job '%s': %s", installedJob.Name, cleanupErr.Error())
+		}
+		return nil, err
+	}
+
 	return NewInstallation(
 		i.target,
 		installedJob,
+		i.jobInstaller,
 		manifest,
 		i.registryServerManager,
 	), nil
 }
+
+// recordRenderedCPIJob saves the rendered CPI job, so that it can be extracted again by the installation finder,
+// and removes the jobs that earlier versions extracted into the installation unencrypted
+func (i *installer) recordRenderedCPIJob(renderedCPIJob biinstalljob.RenderedJobRef) error {
+	err := saveRenderedCPIJob(i.fs, i.target.RenderedCPIJobPath(), renderedCPIJob)
+	if err != nil {
+		return err
+	}
+
+	err = i.fs.RemoveAll(i.target.JobsPath())
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Removing jobs directory '%s'", i.target.JobsPath())
+	}
+	return nil
+}
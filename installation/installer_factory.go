@@ -8,6 +8,7 @@ import (
 	boshsys "github.com/cloudfoundry/bosh-agent/system"
 	boshuuid "github.com/cloudfoundry/bosh-agent/uuid"
 
+	bicrypto "github.com/cloudfoundry/bosh-init/crypto"
 	bideplrel "github.com/cloudfoundry/bosh-init/deployment/release"
 	biindex "github.com/cloudfoundry/bosh-init/index"
 	biinstallblob "github.com/cloudfoundry/bosh-init/installation/blob"
@@ -25,6 +26,9 @@ import (
 
 type InstallerFactory interface {
 	NewInstaller() (Installer, error)
+
+	// NewJobInstaller returns a job installer that extracts the rendered jobs of the installation target
+	NewJobInstaller(Target) biinstalljob.Installer
 }
 
 type installerFactory struct {
@@ -35,8 +39,10 @@ type installerFactory struct {
 	extractor             boshcmd.Compressor
 	releaseResolver       birelset.Resolver
 	releaseJobResolver    bideplrel.JobResolver
+	erbRenderer           bierbrenderer.ERBRenderer
 	uuidGenerator         boshuuid.Generator
 	registryServerManager biregistry.ServerManager
+	encryptor             bicrypto.Encryptor
 	logger                boshlog.Logger
 	logTag                string
 }
@@ -49,8 +55,10 @@ func NewInstallerFactory(
 	extractor boshcmd.Compressor,
 	releaseResolver birelset.Resolver,
 	releaseJobResolver bideplrel.JobResolver,
+	erbRenderer bierbrenderer.ERBRenderer,
 	uuidGenerator boshuuid.Generator,
 	registryServerManager biregistry.ServerManager,
+	encryptor bicrypto.Encryptor,
 	logger boshlog.Logger,
 ) InstallerFactory {
 	return &installerFactory{
@@ -61,8 +69,10 @@ func NewInstallerFactory(
 		extractor:             extractor,
 		releaseResolver:       releaseResolver,
 		releaseJobResolver:    releaseJobResolver,
+		erbRenderer:           erbRenderer,
 		uuidGenerator:         uuidGenerator,
 		registryServerManager: registryServerManager,
+		encryptor:             encryptor,
 		logger:                logger,
 		logTag:                "installer",
 	}
@@ -83,6 +93,8 @@ func (f *installerFactory) NewInstaller() (Installer, error) {
 		extractor:          f.extractor,
 		uuidGenerator:      f.uuidGenerator,
 		releaseJobResolver: f.releaseJobResolver,
+		erbRenderer:        f.erbRenderer,
+		encryptor:          f.encryptor,
 	}
 
 	return NewInstaller(
@@ -97,6 +109,19 @@ func (f *installerFactory) NewInstaller() (Installer, error) {
 	), nil
 }
 
+func (f *installerFactory) NewJobInstaller(target Target) biinstalljob.Installer {
+	context := &installerFactoryContext{
+		target:        target,
+		fs:            f.fs,
+		logger:        f.logger,
+		extractor:     f.extractor,
+		uuidGenerator: f.uuidGenerator,
+		encryptor:     f.encryptor,
+	}
+
+	return context.JobInstaller()
+}
+
 type installerFactoryContext struct {
 	target             Target
 	fs                 boshsys.FileSystem
@@ -105,16 +130,20 @@ type installerFactoryContext struct {
 	extractor          boshcmd.Compressor
 	uuidGenerator      boshuuid.Generator
 	releaseJobResolver bideplrel.JobResolver
-
-	stateBuilder          biinstallstate.Builder
-	jobDependencyCompiler bistatejob.DependencyCompiler
-	packageCompiler       bistatepkg.Compiler
-	jobInstaller          biinstalljob.Installer
-	templatesRepo         bitemplate.TemplatesRepo
-	packageInstaller      biinstallpkg.Installer
-	blobstore             boshblob.Blobstore
-	blobExtractor         biinstallblob.Extractor
-	compiledPackageRepo   bistatepkg.CompiledPackageRepo
+	erbRenderer        bierbrenderer.ERBRenderer
+	encryptor          bicrypto.Encryptor
+
+	stateBuilder           biinstallstate.Builder
+	jobDependencyCompiler  bistatejob.DependencyCompiler
+	packageCompiler        bistatepkg.Compiler
+	jobInstaller           biinstalljob.Installer
+	templatesRepo          bitemplate.TemplatesRepo
+	packageInstaller       biinstallpkg.Installer
+	blobstore              boshblob.Blobstore
+	templatesBlobstore     boshblob.Blobstore
+	blobExtractor          biinstallblob.Extractor
+	templatesBlobExtractor biinstallblob.Extractor
+	compiledPackageRepo    bistatepkg.CompiledPackageRepo
 }
 
 func (c *installerFactoryContext) StateBuilder() biinstallstate.Builder {
@@ -122,8 +151,7 @@ func (c *installerFactoryContext) StateBuilder() biinstallstate.Builder {
 		return c.stateBuilder
 	}
 
-	erbRenderer := bierbrenderer.NewERBRenderer(c.fs, c.runner, c.logger)
-	jobRenderer := bitemplate.NewJobRenderer(erbRenderer, c.fs, c.logger)
+	jobRenderer := bitemplate.NewJobRenderer(c.erbRenderer, c.fs, c.logger)
 	jobListRenderer := bitemplate.NewJobListRenderer(jobRenderer, c.logger)
 
 	c.stateBuilder = biinstallstate.NewBuilder(
@@ -131,7 +159,7 @@ func (c *installerFactoryContext) StateBuilder() biinstallstate.Builder {
 		c.JobDependencyCompiler(),
 		jobListRenderer,
 		c.extractor,
-		c.Blobstore(),
+		c.TemplatesBlobstore(),
 		c.TemplatesRepo(),
 	)
 	return c.stateBuilder
@@ -176,9 +204,8 @@ func (c *installerFactoryContext) JobInstaller() biinstalljob.Installer {
 
 	c.jobInstaller = biinstalljob.NewInstaller(
 		c.fs,
-		c.BlobExtractor(),
+		c.TemplatesBlobExtractor(),
 		c.TemplatesRepo(),
-		c.target.JobsPath(),
 	)
 	return c.jobInstaller
 }
@@ -214,6 +241,20 @@ func (c *installerFactoryContext) Blobstore() boshblob.Blobstore {
 	return c.blobstore
 }
 
+// TemplatesBlobstore stores the rendered job templates, which may contain credentials, encrypted if the encryptor has a key
+func (c *installerFactoryContext) TemplatesBlobstore() boshblob.Blobstore {
+	if c.templatesBlobstore != nil {
+		return c.templatesBlobstore
+	}
+
+	options := map[string]interface{}{"blobstore_path": c.target.BlobstorePath()}
+	localBlobstore := boshblob.NewLocalBlobstore(c.fs, c.uuidGenerator, options)
+	encryptedBlobstore := biinstallblob.NewEncryptedBlobstore(localBlobstore, c.encryptor, c.fs)
+	c.templatesBlobstore = boshblob.NewSHA1VerifiableBlobstore(encryptedBlobstore)
+
+	return c.templatesBlobstore
+}
+
 func (c *installerFactoryContext) BlobExtractor() biinstallblob.Extractor {
 	if c.blobExtractor != nil {
 		return c.blobExtractor
@@ -224,6 +265,16 @@ func (c *installerFactoryContext) BlobExtractor() biinstallblob.Extractor {
 	return c.blobExtractor
 }
 
+func (c *installerFactoryContext) TemplatesBlobExtractor() biinstallblob.Extractor {
+	if c.templatesBlobExtractor != nil {
+		return c.templatesBlobExtractor
+	}
+
+	c.templatesBlobExtractor = biinstallblob.NewExtractor(c.fs, c.extractor, c.TemplatesBlobstore(), c.logger)
+
+	return c.templatesBlobExtractor
+}
+
 func (c *installerFactoryContext) CompiledPackageRepo() bistatepkg.CompiledPackageRepo {
 	if c.compiledPackageRepo != nil {
 		return c.compiledPackageRepo
@@ -1,6 +1,7 @@
 package installation_test
 
 import (
+	"errors"
 	"os"
 
 	. "github.com/onsi/ginkgo"
@@ -159,6 +160,47 @@ var _ = Describe("Installer", func() {
 			Expect(err).NotTo(HaveOccurred())
 		})
 
+		It("removes the cached CPI info, as the CPI may have changed", func() {
+			fakeFS.WriteFileString(target.CPIInfoPath(), "{}")
+
+			_, err := installer.Install(installationManifest, fakeStage)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeFS.FileExists(target.CPIInfoPath())).To(BeFalse())
+		})
+
+		It("records the rendered CPI job, so that it can be extracted again", func() {
+			_, err := installer.Install(installationManifest, fakeStage)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeFS.ReadFileString(target.RenderedCPIJobPath())).To(MatchJSON(`{
+				"name": "cpi",
+				"version": "fake-release-job-fingerprint",
+				"blobstore_id": "fake-rendered-job-blobstore-id",
+				"sha1": "fake-rendered-job-blobstore-id"
+			}`))
+		})
+
+		It("removes the jobs installed unencrypted into the installation by earlier versions", func() {
+			fakeFS.WriteFileString("fake-installation-path/jobs/cpi/config/cpi.json", "{}")
+
+			_, err := installer.Install(installationManifest, fakeStage)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeFS.FileExists(target.JobsPath())).To(BeFalse())
+		})
+
+		Context("when recording the rendered CPI job fails", func() {
+			BeforeEach(func() {
+				fakeFS.WriteFileError = errors.New("fake-write-error")
+			})
+
+			It("cleans up the installed job and returns an error", func() {
+				mockJobInstaller.EXPECT().Cleanup(installedJob)
+
+				_, err := installer.Install(installationManifest, fakeStage)
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("fake-write-error"))
+			})
+		})
+
 		It("returns the installation", func() {
 			installation, err := installer.Install(installationManifest, fakeStage)
 			Expect(err).NotTo(HaveOccurred())
@@ -166,6 +208,7 @@ var _ = Describe("Installer", func() {
 			expectedInstallation := NewInstallation(
 				target,
 				installedJob,
+				mockJobInstaller,
 				installationManifest,
 				mockRegistryServerManager,
 			)
@@ -26,21 +26,22 @@ type InstalledJob struct {
 	Path string
 }
 
+// Installer extracts a rendered job into a temporary jobs directory, as its templates may contain credentials:
+// the job is only kept unencrypted until Cleanup, which is called when the command that installed it finishes.
 type Installer interface {
 	Install(RenderedJobRef, biui.Stage) (InstalledJob, error)
+	Cleanup(InstalledJob) error
 }
 
 func NewInstaller(
 	fs boshsys.FileSystem,
 	templateExtractor biinstallblob.Extractor,
 	templateRepo bitemcomp.TemplatesRepo,
-	jobsPath string,
 ) Installer {
 	return jobInstaller{
 		fs:                fs,
 		templateExtractor: templateExtractor,
 		templateRepo:      templateRepo,
-		jobsPath:          jobsPath,
 	}
 }
 
@@ -48,7 +49,6 @@ type jobInstaller struct {
 	fs                boshsys.FileSystem
 	templateExtractor biinstallblob.Extractor
 	templateRepo      bitemcomp.TemplatesRepo
-	jobsPath          string
 }
 
 func (i jobInstaller) Install(renderedJobRef RenderedJobRef, stage biui.Stage) (installedJob InstalledJob, err error) {
@@ -60,30 +60,58 @@ func (i jobInstaller) Install(renderedJobRef RenderedJobRef, stage biui.Stage) (
 	return installedJob, err
 }
 
+// Cleanup deletes the temporary jobs directory of the job
+func (i jobInstaller) Cleanup(installedJob InstalledJob) error {
+	jobsDir := filepath.Dir(installedJob.Path)
+	err := i.fs.RemoveAll(jobsDir)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Removing jobs directory '%s'", jobsDir)
+	}
+	return nil
+}
+
 func (i jobInstaller) install(renderedJobRef RenderedJobRef) (InstalledJob, error) {
-	jobDir := filepath.Join(i.jobsPath, renderedJobRef.Name)
+	// the CPI finds the job in the jobs directory given to it, so the job keeps its name in the temporary directory
+	jobsDir, err := i.fs.TempDir("bosh-init-jobs")
+	if err != nil {
+		return InstalledJob{}, bosherr.WrapError(err, "Creating jobs directory")
+	}
+
+	installedJob := InstalledJob{Name: renderedJobRef.Name, Path: filepath.Join(jobsDir, renderedJobRef.Name)}
+	err = i.extract(renderedJobRef, installedJob.Path)
+	if err != nil {
+		if cleanupErr := i.Cleanup(installedJob); cleanupErr != nil {
+			return InstalledJob{}, bosherr.NewMultiError(err, cleanupErr)
+		}
+		return InstalledJob{}, err
+	}
+
+	return installedJob, nil
+}
+
+func (i jobInstaller) extract(renderedJobRef RenderedJobRef, jobDir string) error {
 	err := i.fs.MkdirAll(jobDir, os.ModePerm)
 	if err != nil {
-		return InstalledJob{}, bosherr.WrapErrorf(err, "Creating job directory '%s'", jobDir)
+		return bosherr.WrapErrorf(err, "Creating job directory '%s'", jobDir)
 	}
 
 	err = i.templateExtractor.Extract(renderedJobRef.BlobstoreID, renderedJobRef.SHA1, jobDir)
 	if err != nil {
-		return InstalledJob{}, bosherr.WrapErrorf(err, "Extracting blob with ID '%s'", renderedJobRef.BlobstoreID)
+		return bosherr.WrapErrorf(err, "Extracting blob with ID '%s'", renderedJobRef.BlobstoreID)
 	}
 
 	binFiles := path.Join(jobDir, "bin", "*")
 	files, err := i.fs.Glob(binFiles)
 	if err != nil {
-		return InstalledJob{}, bosherr.WrapErrorf(err, "Globbing %s", binFiles)
+		return bosherr.WrapErrorf(err, "Globbing %s", binFiles)
 	}
 
 	for _, file := range files {
 		err = i.fs.Chmod(file, os.FileMode(0755))
 		if err != nil {
-			return InstalledJob{}, bosherr.WrapErrorf(err, "Making %s executable", binFiles)
+			return bosherr.WrapErrorf(err, "Making %s executable", binFiles)
 		}
 	}
 
-	return InstalledJob{Name: renderedJobRef.Name, Path: jobDir}, nil
+	return nil
 }
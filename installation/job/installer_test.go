@@ -34,9 +34,10 @@ var _ = Describe("Installer", func() {
 			templateRepo = fakebitemplate.NewFakeTemplatesRepo()
 
 			jobsPath = "/fake/jobs"
+			fs.TempDirDir = jobsPath
 			fakeStage = fakebiui.NewFakeStage()
 
-			jobInstaller = NewInstaller(fs, blobExtractor, templateRepo, jobsPath)
+			jobInstaller = NewInstaller(fs, blobExtractor, templateRepo)
 
 			renderedJobRef = RenderedJobRef{
 				Name:        "cpi",
@@ -71,6 +72,16 @@ var _ = Describe("Installer", func() {
 			))
 		})
 
+		It("extracts the job into a temporary jobs directory", func() {
+			fs.TempDirDir = ""
+			fs.TempDirDirs = []string{"/fake/tmp/bosh-init-jobs"}
+			blobExtractor.SetExtractBehavior("fake-job-blobstore-id-cpi", "fake-job-sha1-cpi", "/fake/tmp/bosh-init-jobs/cpi", nil)
+
+			installedJob, err := jobInstaller.Install(renderedJobRef, fakeStage)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(installedJob.Path).To(Equal("/fake/tmp/bosh-init-jobs/cpi"))
+		})
+
 		It("creates basic job layout", func() {
 			_, err := jobInstaller.Install(renderedJobRef, fakeStage)
 			Expect(err).ToNot(HaveOccurred())
@@ -106,5 +117,36 @@ var _ = Describe("Installer", func() {
 			Expect(fakeStage.PerformCalls[0].Error).To(HaveOccurred())
 			Expect(fakeStage.PerformCalls[0].Error.Error()).To(Equal("Creating job directory '/fake/jobs/cpi': fake-mkdir-error"))
 		})
+
+		It("removes the jobs directory when extracting the job fails", func() {
+			fs.MkdirAllError = errors.New("fake-mkdir-error")
+
+			_, err := jobInstaller.Install(renderedJobRef, fakeStage)
+			Expect(err).To(HaveOccurred())
+			Expect(fs.FileExists(jobsPath)).To(BeFalse())
+		})
+	})
+
+	Context("Cleaning up the job", func() {
+		BeforeEach(func() {
+			fs = fakesys.NewFakeFileSystem()
+			jobInstaller = NewInstaller(fs, fakebiinstallblob.NewFakeExtractor(), fakebitemplate.NewFakeTemplatesRepo())
+		})
+
+		It("removes the jobs directory of the job", func() {
+			fs.WriteFileString("/fake/jobs/cpi/config/cpi.json", "{}")
+
+			err := jobInstaller.Cleanup(InstalledJob{Name: "cpi", Path: "/fake/jobs/cpi"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fs.FileExists("/fake/jobs")).To(BeFalse())
+		})
+
+		It("returns an error when removing the jobs directory fails", func() {
+			fs.RemoveAllError = errors.New("fake-remove-error")
+
+			err := jobInstaller.Cleanup(InstalledJob{Name: "cpi", Path: "/fake/jobs/cpi"})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("Removing jobs directory '/fake/jobs': fake-remove-error"))
+		})
 	})
 })
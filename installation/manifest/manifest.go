@@ -9,9 +9,22 @@ type Manifest struct {
 	Template        ReleaseJobRef
 	Properties      biproperty.Map
 	Mbus            string
+	BlobstoreURL    string
+	Cert            Cert
 	Registry        Registry
 	AgentEnvService string
 	SSHTunnel       SSHTunnel
+	Retries         Retries
+	Timeouts        Timeouts
+}
+
+// AgentBlobstoreURL returns the URL of the blobstore used to send blobs to the agent.
+// Agents reached over http serve the blobstore at the mbus URL, with a NATS mbus the blobstore is separate.
+func (m Manifest) AgentBlobstoreURL() string {
+	if m.BlobstoreURL != "" {
+		return m.BlobstoreURL
+	}
+	return m.Mbus
 }
 
 type ReleaseJobRef struct {
@@ -41,3 +54,27 @@ type SSHTunnel struct {
 func (o SSHTunnel) IsEmpty() bool {
 	return o == SSHTunnel{}
 }
+
+// Cert configures the TLS verification of the agent at the mbus URL.
+// All values are PEM encoded. Certificate and PrivateKey are only needed for mutual TLS.
+type Cert struct {
+	CA          string
+	Certificate string
+	PrivateKey  string `yaml:"private_key"`
+}
+
+func (c Cert) IsEmpty() bool {
+	return c == Cert{}
+}
+
+// Retries configures how CPI calls that fail with a retryable error are retried, with exponential backoff.
+// Delays are in seconds. Zero values use the defaults.
+type Retries struct {
+	MaxAttempts  int `yaml:"max_attempts"`
+	InitialDelay int `yaml:"initial_delay"`
+	MaxDelay     int `yaml:"max_delay"`
+}
+
+// Timeouts are the maximum durations of CPI calls in seconds by CPI method name,
+// with 'default' for the methods that are not listed.
+type Timeouts map[string]int
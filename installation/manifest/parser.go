@@ -37,6 +37,10 @@ type installation struct {
 	AgentEnvService string    `yaml:"agent_env_service"`
 	SSHTunnel       SSHTunnel `yaml:"ssh_tunnel"`
 	Mbus            string
+	BlobstoreURL    string `yaml:"blobstore_url"`
+	Cert            Cert
+	Retries         Retries
+	Timeouts        Timeouts
 }
 
 type template struct {
@@ -78,6 +82,10 @@ func (p *parser) Parse(path string) (Manifest, error) {
 		AgentEnvService: comboManifest.CloudProvider.AgentEnvService,
 		SSHTunnel:       comboManifest.CloudProvider.SSHTunnel,
 		Mbus:            comboManifest.CloudProvider.Mbus,
+		BlobstoreURL:    comboManifest.CloudProvider.BlobstoreURL,
+		Cert:            comboManifest.CloudProvider.Cert,
+		Retries:         comboManifest.CloudProvider.Retries,
+		Timeouts:        comboManifest.CloudProvider.Timeouts,
 	}
 
 	properties, err := biproperty.BuildMap(comboManifest.CloudProvider.Properties)
@@ -1,11 +1,15 @@
 package manifest
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/url"
 	"strings"
 
 	bosherr "github.com/cloudfoundry/bosh-agent/errors"
 	boshlog "github.com/cloudfoundry/bosh-agent/logger"
 
+	binatsclient "github.com/cloudfoundry/bosh-init/deployment/natsclient"
 	birelset "github.com/cloudfoundry/bosh-init/release/set"
 )
 
@@ -43,6 +47,28 @@ func (v *validator) Validate(manifest Manifest) error {
 		errs = append(errs, bosherr.WrapErrorf(err, "cloud_provider.template.release '%s' must refer to a provided release", cpiReleaseName))
 	}
 
+	errs = append(errs, v.validateBlobstoreURL(manifest)...)
+
+	errs = append(errs, v.validateCert(manifest.Cert)...)
+
+	if manifest.Retries.MaxAttempts < 0 {
+		errs = append(errs, bosherr.Error("cloud_provider.retries.max_attempts must not be negative"))
+	}
+
+	if manifest.Retries.InitialDelay < 0 {
+		errs = append(errs, bosherr.Error("cloud_provider.retries.initial_delay must not be negative"))
+	}
+
+	if manifest.Retries.MaxDelay < 0 {
+		errs = append(errs, bosherr.Error("cloud_provider.retries.max_delay must not be negative"))
+	}
+
+	for method, timeout := range manifest.Timeouts {
+		if timeout <= 0 {
+			errs = append(errs, bosherr.Errorf("cloud_provider.timeouts.%s must be positive", method))
+		}
+	}
+
 	if len(errs) > 0 {
 		return bosherr.NewMultiError(errs...)
 	}
@@ -50,6 +76,41 @@ func (v *validator) Validate(manifest Manifest) error {
 	return nil
 }
 
+func (v *validator) validateBlobstoreURL(manifest Manifest) []error {
+	if manifest.BlobstoreURL == "" {
+		if binatsclient.IsNATSURL(manifest.Mbus) {
+			return []error{bosherr.Error("cloud_provider.blobstore_url must be provided when cloud_provider.mbus is a NATS URL")}
+		}
+		return []error{}
+	}
+
+	parsedURL, err := url.Parse(manifest.BlobstoreURL)
+	if err != nil || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") {
+		return []error{bosherr.Error("cloud_provider.blobstore_url must be an http or https URL")}
+	}
+	return []error{}
+}
+
+func (v *validator) validateCert(cert Cert) []error {
+	errs := []error{}
+
+	if cert.CA != "" && !x509.NewCertPool().AppendCertsFromPEM([]byte(cert.CA)) {
+		errs = append(errs, bosherr.Error("cloud_provider.cert.ca must be a PEM encoded certificate"))
+	}
+
+	if cert.Certificate == "" && cert.PrivateKey == "" {
+		return errs
+	}
+
+	if cert.Certificate == "" || cert.PrivateKey == "" {
+		errs = append(errs, bosherr.Error("cloud_provider.cert.certificate and cloud_provider.cert.private_key must be provided together"))
+	} else if _, err := tls.X509KeyPair([]byte(cert.Certificate), []byte(cert.PrivateKey)); err != nil {
+		errs = append(errs, bosherr.WrapError(err, "cloud_provider.cert.certificate and cloud_provider.cert.private_key must be a PEM encoded key pair"))
+	}
+
+	return errs
+}
+
 func (v *validator) isBlank(str string) bool {
 	return str == "" || strings.TrimSpace(str) == ""
 }
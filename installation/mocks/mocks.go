@@ -32,6 +32,16 @@ func (_m *MockInstallation) EXPECT() *_MockInstallationRecorder {
 	return _m.recorder
 }
 
+func (_m *MockInstallation) Cleanup() error {
+	ret := _m.ctrl.Call(_m, "Cleanup")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockInstallationRecorder) Cleanup() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Cleanup")
+}
+
 func (_m *MockInstallation) Job() job.InstalledJob {
 	ret := _m.ctrl.Call(_m, "Job")
 	ret0, _ := ret[0].(job.InstalledJob)
@@ -42,6 +52,16 @@ func (_mr *_MockInstallationRecorder) Job() *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "Job")
 }
 
+func (_m *MockInstallation) Manifest() manifest.Manifest {
+	ret := _m.ctrl.Call(_m, "Manifest")
+	ret0, _ := ret[0].(manifest.Manifest)
+	return ret0
+}
+
+func (_mr *_MockInstallationRecorder) Manifest() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Manifest")
+}
+
 func (_m *MockInstallation) StartRegistry() error {
 	ret := _m.ctrl.Call(_m, "StartRegistry")
 	ret0, _ := ret[0].(error)
@@ -125,6 +145,16 @@ func (_m *MockInstallerFactory) EXPECT() *_MockInstallerFactoryRecorder {
 	return _m.recorder
 }
 
+func (_m *MockInstallerFactory) NewJobInstaller(_param0 installation.Target) job.Installer {
+	ret := _m.ctrl.Call(_m, "NewJobInstaller", _param0)
+	ret0, _ := ret[0].(job.Installer)
+	return ret0
+}
+
+func (_mr *_MockInstallerFactoryRecorder) NewJobInstaller(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "NewJobInstaller", arg0)
+}
+
 func (_m *MockInstallerFactory) NewInstaller() (installation.Installer, error) {
 	ret := _m.ctrl.Call(_m, "NewInstaller")
 	ret0, _ := ret[0].(installation.Installer)
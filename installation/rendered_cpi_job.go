@@ -0,0 +1,62 @@
+package installation
+
+import (
+	"encoding/json"
+
+	bosherr "github.com/cloudfoundry/bosh-agent/errors"
+	boshsys "github.com/cloudfoundry/bosh-agent/system"
+
+	biinstalljob "github.com/cloudfoundry/bosh-init/installation/job"
+)
+
+// renderedCPIJobRecord refers to the rendered CPI job in the templates blobstore,
+// so that commands which do not install the CPI can extract it again
+type renderedCPIJobRecord struct {
+	Name        string `json:"name"`
+	Version     string `json:"version"`
+	BlobstoreID string `json:"blobstore_id"`
+	SHA1        string `json:"sha1"`
+}
+
+func saveRenderedCPIJob(fs boshsys.FileSystem, path string, renderedJobRef biinstalljob.RenderedJobRef) error {
+	contents, err := json.Marshal(renderedCPIJobRecord{
+		Name:        renderedJobRef.Name,
+		Version:     renderedJobRef.Version,
+		BlobstoreID: renderedJobRef.BlobstoreID,
+		SHA1:        renderedJobRef.SHA1,
+	})
+	if err != nil {
+		return bosherr.WrapError(err, "Marshalling rendered CPI job")
+	}
+
+	err = fs.WriteFile(path, contents)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Writing rendered CPI job '%s'", path)
+	}
+	return nil
+}
+
+// loadRenderedCPIJob returns false for installations made before the rendered CPI job was saved
+func loadRenderedCPIJob(fs boshsys.FileSystem, path string) (biinstalljob.RenderedJobRef, bool, error) {
+	if !fs.FileExists(path) {
+		return biinstalljob.RenderedJobRef{}, false, nil
+	}
+
+	contents, err := fs.ReadFile(path)
+	if err != nil {
+		return biinstalljob.RenderedJobRef{}, false, bosherr.WrapErrorf(err, "Reading rendered CPI job '%s'", path)
+	}
+
+	var record renderedCPIJobRecord
+	err = json.Unmarshal(contents, &record)
+	if err != nil {
+		return biinstalljob.RenderedJobRef{}, false, bosherr.WrapErrorf(err, "Unmarshalling rendered CPI job '%s'", path)
+	}
+
+	return biinstalljob.RenderedJobRef{
+		Name:        record.Name,
+		Version:     record.Version,
+		BlobstoreID: record.BlobstoreID,
+		SHA1:        record.SHA1,
+	}, true, nil
+}
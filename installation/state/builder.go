@@ -109,7 +109,8 @@ func (b *builder) renderJobTemplates(
 ) ([]biinstalljob.RenderedJobRef, error) {
 	renderedJobRefs := make([]biinstalljob.RenderedJobRef, 0, len(releaseJobs))
 	err := stage.Perform("Rendering job templates", func() error {
-		renderedJobList, err := b.jobListRenderer.Render(releaseJobs, jobProperties, globalProperties, deploymentName)
+		// the CPI is installed on the local machine, not on an instance of the deployment
+		renderedJobList, err := b.jobListRenderer.Render(releaseJobs, jobProperties, globalProperties, deploymentName, bitemplate.Instance{})
 		if err != nil {
 			return err
 		}
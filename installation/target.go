@@ -30,10 +30,21 @@ func (t Target) TemplatesIndexPath() string {
 	return filepath.Join(t.path, "templates.json")
 }
 
+// CPIInfoPath is the cache of the result of the CPI 'info' method, removed when the CPI is installed
+func (t Target) CPIInfoPath() string {
+	return filepath.Join(t.path, "cpi_info.json")
+}
+
 func (t Target) PackagesPath() string {
 	return filepath.Join(t.path, "packages")
 }
 
+// RenderedCPIJobPath refers to the rendered CPI job in the templates blobstore, written when the CPI is installed
+func (t Target) RenderedCPIJobPath() string {
+	return filepath.Join(t.path, "rendered_cpi_job.json")
+}
+
+// JobsPath is where bosh-init versions that did not extract the CPI job into a temporary directory installed it
 func (t Target) JobsPath() string {
 	return filepath.Join(t.path, "jobs")
 }
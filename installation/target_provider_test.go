@@ -9,9 +9,11 @@ import (
 	boshlog "github.com/cloudfoundry/bosh-agent/logger"
 
 	fakesys "github.com/cloudfoundry/bosh-agent/system/fakes"
+	faketime "github.com/cloudfoundry/bosh-agent/time/fakes"
 	fakeuuid "github.com/cloudfoundry/bosh-agent/uuid/fakes"
 
 	biconfig "github.com/cloudfoundry/bosh-init/config"
+	bicrypto "github.com/cloudfoundry/bosh-init/crypto"
 )
 
 var _ = Describe("TargetProvider", func() {
@@ -34,6 +36,8 @@ var _ = Describe("TargetProvider", func() {
 		deploymentConfigService = biconfig.NewFileSystemDeploymentConfigService(
 			fakeFS,
 			fakeUUIDGenerator,
+			&faketime.FakeService{},
+			bicrypto.NewEncryptor(nil),
 			logger,
 		)
 		deploymentConfigService.SetConfigPath(configPath)
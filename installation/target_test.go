@@ -26,6 +26,10 @@ var _ = Describe("Target", func() {
 			Expect(target.TemplatesIndexPath()).To(Equal("/home/fake/madcow/templates.json"))
 		})
 
+		It("returns the CPI info path", func() {
+			Expect(target.CPIInfoPath()).To(Equal("/home/fake/madcow/cpi_info.json"))
+		})
+
 		It("returns the packages path", func() {
 			Expect(target.PackagesPath()).To(Equal("/home/fake/madcow/packages"))
 		})
@@ -11,8 +11,11 @@ import (
 	boshtime "github.com/cloudfoundry/bosh-agent/time"
 	boshuuid "github.com/cloudfoundry/bosh-agent/uuid"
 
+	bicloud "github.com/cloudfoundry/bosh-init/cloud"
 	bicmd "github.com/cloudfoundry/bosh-init/cmd"
 	biconfig "github.com/cloudfoundry/bosh-init/config"
+	bicrypto "github.com/cloudfoundry/bosh-init/crypto"
+	bierbrenderer "github.com/cloudfoundry/bosh-init/templatescompiler/erbrenderer"
 
 	biui "github.com/cloudfoundry/bosh-init/ui"
 	biuifmt "github.com/cloudfoundry/bosh-init/ui/fmt"
@@ -32,6 +35,8 @@ func main() {
 
 	timeService := boshtime.NewConcreteService()
 
+	signalTrap := bicloud.NewSignalTrap(bicloud.NewOSSignalSource(), os.Exit, ui, logger)
+
 	cmdFactory := bicmd.NewFactory(
 		config,
 		fileSystem,
@@ -40,11 +45,19 @@ func main() {
 		logger,
 		uuidGenerator,
 		workspaceRootPath,
+		erbRendererEngine(ui, logger),
+		cpiCassetteConfig(ui, logger),
+		stateKey(fileSystem, ui, logger),
+		signalTrap,
 	)
 
 	cmdRunner := bicmd.NewRunner(cmdFactory)
 	stage := biui.NewStage(ui, timeService, logger)
+
+	// interrupts are trapped for the whole command run, so that it can release the deployment lock on the way out
+	signalTrap.Trap()
 	err := cmdRunner.Run(stage, os.Args[1:]...)
+	signalTrap.Release()
 	if err != nil {
 		fail(err, ui, logger)
 	}
@@ -72,6 +85,50 @@ func newLogger() boshlog.Logger {
 	return boshlog.NewLogger(level)
 }
 
+func erbRendererEngine(ui biui.UI, logger boshlog.Logger) string {
+	engine := os.Getenv("BOSH_INIT_ERB_RENDERER")
+	switch engine {
+	case "":
+		return bierbrenderer.EngineGo
+	case bierbrenderer.EngineGo, bierbrenderer.EngineRuby:
+		return engine
+	}
+
+	err := bosherr.Errorf("Invalid BOSH_INIT_ERB_RENDERER value '%s', expected '%s' or '%s'", engine, bierbrenderer.EngineGo, bierbrenderer.EngineRuby)
+	fail(err, ui, logger)
+	return ""
+}
+
+func cpiCassetteConfig(ui biui.UI, logger boshlog.Logger) bicloud.CassetteConfig {
+	config := bicloud.CassetteConfig{
+		Mode: os.Getenv("BOSH_INIT_CPI_CASSETTE_MODE"),
+		Path: os.Getenv("BOSH_INIT_CPI_CASSETTE"),
+	}
+	switch config.Mode {
+	case "":
+		return config
+	case bicloud.CassetteModeRecord, bicloud.CassetteModeReplay:
+		if config.Path != "" {
+			return config
+		}
+		err := bosherr.Errorf("Expected BOSH_INIT_CPI_CASSETTE to be set when BOSH_INIT_CPI_CASSETTE_MODE is '%s'", config.Mode)
+		fail(err, ui, logger)
+		return bicloud.CassetteConfig{}
+	}
+
+	err := bosherr.Errorf("Invalid BOSH_INIT_CPI_CASSETTE_MODE value '%s', expected '%s' or '%s'", config.Mode, bicloud.CassetteModeRecord, bicloud.CassetteModeReplay)
+	fail(err, ui, logger)
+	return bicloud.CassetteConfig{}
+}
+
+func stateKey(fs boshsys.FileSystem, ui biui.UI, logger boshlog.Logger) []byte {
+	key, err := bicrypto.LoadKey(fs, os.Getenv(bicrypto.StateKeyEnv), os.Getenv(bicrypto.StateKeyFileEnv))
+	if err != nil {
+		fail(bosherr.WrapError(err, "Loading state encryption key"), ui, logger)
+	}
+	return key
+}
+
 func newFileLogger(logPath string, level boshlog.LogLevel) boshlog.Logger {
 	// Log file logger errors to the STDERR logger
 	logger := boshlog.NewLogger(boshlog.LevelError)
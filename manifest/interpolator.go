@@ -0,0 +1,139 @@
+package manifest
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/cloudfoundry-incubator/candiedyaml"
+
+	bosherr "github.com/cloudfoundry/bosh-agent/errors"
+	boshlog "github.com/cloudfoundry/bosh-agent/logger"
+)
+
+var (
+	placeholderRegexp      = regexp.MustCompile(`\(\(([-\w\./]+)\)\)`)
+	wholePlaceholderRegexp = regexp.MustCompile(`^\(\(([-\w\./]+)\)\)$`)
+)
+
+// Interpolator replaces ((name)) placeholders in the values of a YAML manifest with the values of variables.
+// A placeholder that is an entire value is replaced with the variable's value, which may be a number, list or map.
+// A placeholder within a string is replaced with the variable's value formatted as a string.
+type Interpolator interface {
+	Interpolate(contents []byte, variables Variables) ([]byte, error)
+}
+
+type interpolator struct {
+	logger boshlog.Logger
+	logTag string
+}
+
+func NewInterpolator(logger boshlog.Logger) Interpolator {
+	return &interpolator{
+		logger: logger,
+		logTag: "interpolator",
+	}
+}
+
+// Interpolate returns the contents unchanged when they have no placeholders,
+// otherwise it returns the interpolated manifest re-marshalled as YAML.
+// All variables that are not found are reported in one error.
+func (i *interpolator) Interpolate(contents []byte, variables Variables) ([]byte, error) {
+	if !placeholderRegexp.Match(contents) {
+		return contents, nil
+	}
+
+	var rawManifest interface{}
+	err := candiedyaml.Unmarshal(contents, &rawManifest)
+	if err != nil {
+		return nil, bosherr.WrapError(err, "Unmarshalling manifest")
+	}
+
+	missing := map[string]struct{}{}
+	interpolated, err := i.interpolate(rawManifest, variables, missing)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(missing) > 0 {
+		names := make([]string, 0, len(missing))
+		for name := range missing {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, bosherr.Errorf("Expected to find variables: %s", strings.Join(names, ", "))
+	}
+
+	interpolatedContents, err := candiedyaml.Marshal(interpolated)
+	if err != nil {
+		return nil, bosherr.WrapError(err, "Marshalling interpolated manifest")
+	}
+
+	return interpolatedContents, nil
+}
+
+func (i *interpolator) interpolate(value interface{}, variables Variables, missing map[string]struct{}) (interface{}, error) {
+	switch typedValue := value.(type) {
+	case map[interface{}]interface{}:
+		result := map[interface{}]interface{}{}
+		for key, nestedValue := range typedValue {
+			interpolatedValue, err := i.interpolate(nestedValue, variables, missing)
+			if err != nil {
+				return nil, err
+			}
+			result[key] = interpolatedValue
+		}
+		return result, nil
+	case []interface{}:
+		result := make([]interface{}, len(typedValue))
+		for idx, nestedValue := range typedValue {
+			interpolatedValue, err := i.interpolate(nestedValue, variables, missing)
+			if err != nil {
+				return nil, err
+			}
+			result[idx] = interpolatedValue
+		}
+		return result, nil
+	case string:
+		return i.interpolateString(typedValue, variables, missing)
+	default:
+		return value, nil
+	}
+}
+
+func (i *interpolator) interpolateString(value string, variables Variables, missing map[string]struct{}) (interface{}, error) {
+	if matches := wholePlaceholderRegexp.FindStringSubmatch(value); matches != nil {
+		variableValue, found := variables.Find(matches[1])
+		if !found {
+			missing[matches[1]] = struct{}{}
+			return value, nil
+		}
+		i.logger.Debug(i.logTag, "Interpolating variable '%s'", matches[1])
+		return variableValue, nil
+	}
+
+	var err error
+	result := placeholderRegexp.ReplaceAllStringFunc(value, func(placeholder string) string {
+		name := placeholderRegexp.FindStringSubmatch(placeholder)[1]
+		variableValue, found := variables.Find(name)
+		if !found {
+			missing[name] = struct{}{}
+			return placeholder
+		}
+
+		switch variableValue.(type) {
+		case map[interface{}]interface{}, map[string]interface{}, []interface{}:
+			err = bosherr.Errorf("Variable '%s' is a map or list and cannot be interpolated into the string '%s'", name, value)
+			return placeholder
+		}
+
+		i.logger.Debug(i.logTag, "Interpolating variable '%s'", name)
+		return fmt.Sprintf("%v", variableValue)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
@@ -0,0 +1,359 @@
+package manifest
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/cloudfoundry-incubator/candiedyaml"
+
+	bosherr "github.com/cloudfoundry/bosh-agent/errors"
+	boshlog "github.com/cloudfoundry/bosh-agent/logger"
+	boshsys "github.com/cloudfoundry/bosh-agent/system"
+)
+
+// Op is an operation in an ops file.
+// Path addresses a value in the manifest, e.g. '/jobs/name=bosh/properties/director/name':
+//   - 'key' is a map key
+//   - '0' is an array index
+//   - '-' is after the last array item (replace only)
+//   - 'key=value' is the array item that is a map with the key set to the value
+//
+// A '?' at the end of a segment makes it and all following segments optional:
+// missing keys and array items are created by replace, and removing them does nothing.
+type Op struct {
+	Type  string
+	Path  string
+	Value interface{}
+}
+
+const (
+	OpTypeReplace = "replace"
+	OpTypeRemove  = "remove"
+)
+
+// OpsApplier patches a YAML manifest with the operations in ops files, in order.
+type OpsApplier interface {
+	Apply(contents []byte, opsFilePaths []string) ([]byte, error)
+}
+
+type opsApplier struct {
+	fs     boshsys.FileSystem
+	logger boshlog.Logger
+	logTag string
+}
+
+func NewOpsApplier(fs boshsys.FileSystem, logger boshlog.Logger) OpsApplier {
+	return &opsApplier{
+		fs:     fs,
+		logger: logger,
+		logTag: "opsApplier",
+	}
+}
+
+// Apply returns the contents unchanged when there are no ops files,
+// otherwise it returns the patched manifest re-marshalled as YAML.
+func (a *opsApplier) Apply(contents []byte, opsFilePaths []string) ([]byte, error) {
+	if len(opsFilePaths) == 0 {
+		return contents, nil
+	}
+
+	var doc interface{}
+	err := candiedyaml.Unmarshal(contents, &doc)
+	if err != nil {
+		return nil, bosherr.WrapError(err, "Unmarshalling manifest")
+	}
+
+	for _, opsFilePath := range opsFilePaths {
+		ops, err := a.loadOps(opsFilePath)
+		if err != nil {
+			return nil, bosherr.WrapErrorf(err, "Loading ops file '%s'", opsFilePath)
+		}
+
+		for idx, op := range ops {
+			doc, err = a.applyOp(doc, op)
+			if err != nil {
+				return nil, bosherr.WrapErrorf(err, "Applying operation [%d] in ops file '%s' (type '%s', path '%s')", idx, opsFilePath, op.Type, op.Path)
+			}
+			a.logger.Debug(a.logTag, "Applied operation [%d] in ops file '%s' (type '%s', path '%s')", idx, opsFilePath, op.Type, op.Path)
+		}
+	}
+
+	patchedContents, err := candiedyaml.Marshal(doc)
+	if err != nil {
+		return nil, bosherr.WrapError(err, "Marshalling patched manifest")
+	}
+
+	return patchedContents, nil
+}
+
+func (a *opsApplier) loadOps(path string) ([]Op, error) {
+	contents, err := a.fs.ReadFile(path)
+	if err != nil {
+		return nil, bosherr.WrapErrorf(err, "Reading file %s", path)
+	}
+
+	ops := []Op{}
+	err = candiedyaml.Unmarshal(contents, &ops)
+	if err != nil {
+		return nil, bosherr.WrapError(err, "Unmarshalling ops")
+	}
+
+	return ops, nil
+}
+
+func (a *opsApplier) applyOp(doc interface{}, op Op) (interface{}, error) {
+	tokens, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Type {
+	case OpTypeReplace:
+		return a.replace(doc, tokens, 0, op.Value)
+	case OpTypeRemove:
+		if len(tokens) == 0 {
+			return nil, bosherr.Error("Cannot remove the entire manifest")
+		}
+		return a.remove(doc, tokens, 0)
+	default:
+		return nil, bosherr.Errorf("Unknown operation type '%s', expected '%s' or '%s'", op.Type, OpTypeReplace, OpTypeRemove)
+	}
+}
+
+// replace returns the node with the value at tokens[idx:] replaced
+func (a *opsApplier) replace(node interface{}, tokens []pointerToken, idx int, value interface{}) (interface{}, error) {
+	if idx == len(tokens) {
+		return value, nil
+	}
+	token := tokens[idx]
+	isLast := idx == len(tokens)-1
+
+	switch token.kind {
+	case keyToken:
+		if node == nil && token.optional {
+			node = map[interface{}]interface{}{}
+		}
+		typedNode, ok := node.(map[interface{}]interface{})
+		if !ok {
+			return nil, bosherr.Errorf("Expected to find a map at path '%s' but found '%T'", pointerString(tokens[:idx]), node)
+		}
+
+		child, found := typedNode[token.key]
+		if !found && !token.optional && !isLast {
+			return nil, bosherr.Errorf("Expected to find a map key '%s' for path '%s'", token.key, pointerString(tokens[:idx+1]))
+		}
+
+		newChild, err := a.replace(child, tokens, idx+1, value)
+		if err != nil {
+			return nil, err
+		}
+		typedNode[token.key] = newChild
+		return typedNode, nil
+
+	case indexToken, appendToken, matchToken:
+		if node == nil && token.optional {
+			node = []interface{}{}
+		}
+		typedNode, ok := node.([]interface{})
+		if !ok {
+			return nil, bosherr.Errorf("Expected to find an array at path '%s' but found '%T'", pointerString(tokens[:idx]), node)
+		}
+
+		if token.kind == appendToken {
+			if !isLast {
+				return nil, bosherr.Errorf("Expected '-' to be the last segment of path '%s'", pointerString(tokens))
+			}
+			return append(typedNode, value), nil
+		}
+
+		itemIdx, err := a.findItem(typedNode, tokens, idx)
+		if err != nil {
+			return nil, err
+		}
+		if itemIdx == len(typedNode) {
+			// optional matching item that is missing
+			typedNode = append(typedNode, map[interface{}]interface{}{token.key: token.value})
+		}
+
+		newItem, err := a.replace(typedNode[itemIdx], tokens, idx+1, value)
+		if err != nil {
+			return nil, err
+		}
+		typedNode[itemIdx] = newItem
+		return typedNode, nil
+	}
+
+	return nil, bosherr.Errorf("Unknown segment '%s' in path '%s'", token.raw, pointerString(tokens))
+}
+
+// remove returns the node with the value at tokens[idx:] removed
+func (a *opsApplier) remove(node interface{}, tokens []pointerToken, idx int) (interface{}, error) {
+	token := tokens[idx]
+	isLast := idx == len(tokens)-1
+
+	if node == nil && token.optional {
+		return node, nil
+	}
+
+	switch token.kind {
+	case keyToken:
+		typedNode, ok := node.(map[interface{}]interface{})
+		if !ok {
+			return nil, bosherr.Errorf("Expected to find a map at path '%s' but found '%T'", pointerString(tokens[:idx]), node)
+		}
+
+		child, found := typedNode[token.key]
+		if !found {
+			if token.optional {
+				return typedNode, nil
+			}
+			return nil, bosherr.Errorf("Expected to find a map key '%s' for path '%s'", token.key, pointerString(tokens[:idx+1]))
+		}
+
+		if isLast {
+			delete(typedNode, token.key)
+			return typedNode, nil
+		}
+
+		newChild, err := a.remove(child, tokens, idx+1)
+		if err != nil {
+			return nil, err
+		}
+		typedNode[token.key] = newChild
+		return typedNode, nil
+
+	case indexToken, matchToken:
+		typedNode, ok := node.([]interface{})
+		if !ok {
+			return nil, bosherr.Errorf("Expected to find an array at path '%s' but found '%T'", pointerString(tokens[:idx]), node)
+		}
+
+		itemIdx, err := a.findItem(typedNode, tokens, idx)
+		if err != nil {
+			return nil, err
+		}
+		if itemIdx == len(typedNode) {
+			// optional matching item that is missing
+			return typedNode, nil
+		}
+
+		if isLast {
+			return append(typedNode[:itemIdx], typedNode[itemIdx+1:]...), nil
+		}
+
+		newItem, err := a.remove(typedNode[itemIdx], tokens, idx+1)
+		if err != nil {
+			return nil, err
+		}
+		typedNode[itemIdx] = newItem
+		return typedNode, nil
+	}
+
+	return nil, bosherr.Errorf("Expected segment '%s' of path '%s' to be a map key, array index or matching array item", token.raw, pointerString(tokens))
+}
+
+// findItem returns the index of the array item addressed by tokens[idx],
+// or the length of the array when an optional matching item is missing
+func (a *opsApplier) findItem(items []interface{}, tokens []pointerToken, idx int) (int, error) {
+	token := tokens[idx]
+
+	if token.kind == indexToken {
+		if token.index < 0 || token.index >= len(items) {
+			return 0, bosherr.Errorf("Expected to find array index %d but found array of length %d for path '%s'", token.index, len(items), pointerString(tokens[:idx+1]))
+		}
+		return token.index, nil
+	}
+
+	matches := []int{}
+	for itemIdx, item := range items {
+		itemMap, ok := item.(map[interface{}]interface{})
+		if !ok {
+			continue
+		}
+		if itemValue, found := itemMap[token.key]; found && fmt.Sprintf("%v", itemValue) == token.value {
+			matches = append(matches, itemIdx)
+		}
+	}
+
+	if len(matches) == 0 && token.optional {
+		return len(items), nil
+	}
+	if len(matches) != 1 {
+		return 0, bosherr.Errorf("Expected to find exactly one matching array item for path '%s' but found %d", pointerString(tokens[:idx+1]), len(matches))
+	}
+	return matches[0], nil
+}
+
+type pointerTokenKind int
+
+const (
+	keyToken pointerTokenKind = iota
+	indexToken
+	appendToken
+	matchToken
+)
+
+type pointerToken struct {
+	kind     pointerTokenKind
+	raw      string
+	key      string
+	value    string
+	index    int
+	optional bool
+}
+
+// parsePointer parses a path such as '/jobs/name=bosh/properties?/director/name'.
+// As in JSON pointers, '~1' in a segment is a '/' and '~0' is a '~'.
+func parsePointer(path string) ([]pointerToken, error) {
+	if path == "" || path == "/" {
+		return []pointerToken{}, nil
+	}
+	if !strings.HasPrefix(path, "/") {
+		return nil, bosherr.Errorf("Expected path '%s' to start with '/'", path)
+	}
+
+	tokens := []pointerToken{}
+	optional := false
+	for _, segment := range strings.Split(path[1:], "/") {
+		token := pointerToken{raw: segment}
+
+		if strings.HasSuffix(segment, "?") {
+			optional = true
+			segment = strings.TrimSuffix(segment, "?")
+		}
+		token.optional = optional
+
+		segment = strings.Replace(strings.Replace(segment, "~1", "/", -1), "~0", "~", -1)
+
+		if segment == "" {
+			return nil, bosherr.Errorf("Expected path '%s' to not have empty segments", path)
+		}
+
+		if segment == "-" {
+			token.kind = appendToken
+		} else if index, err := strconv.Atoi(segment); err == nil {
+			token.kind = indexToken
+			token.index = index
+		} else if parts := strings.SplitN(segment, "=", 2); len(parts) == 2 {
+			token.kind = matchToken
+			token.key = parts[0]
+			token.value = parts[1]
+		} else {
+			token.kind = keyToken
+			token.key = segment
+		}
+
+		tokens = append(tokens, token)
+	}
+
+	return tokens, nil
+}
+
+func pointerString(tokens []pointerToken) string {
+	segments := make([]string, len(tokens))
+	for i, token := range tokens {
+		segments[i] = token.raw
+	}
+	return "/" + strings.Join(segments, "/")
+}
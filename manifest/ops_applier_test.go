@@ -0,0 +1,185 @@
+package manifest_test
+
+import (
+	"github.com/cloudfoundry-incubator/candiedyaml"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	boshlog "github.com/cloudfoundry/bosh-agent/logger"
+	fakesys "github.com/cloudfoundry/bosh-agent/system/fakes"
+
+	. "github.com/cloudfoundry/bosh-init/manifest"
+)
+
+var _ = Describe("OpsApplier", func() {
+	var (
+		fakeFs     *fakesys.FakeFileSystem
+		opsApplier OpsApplier
+		contents   []byte
+	)
+
+	BeforeEach(func() {
+		logger := boshlog.NewLogger(boshlog.LevelNone)
+		fakeFs = fakesys.NewFakeFileSystem()
+		opsApplier = NewOpsApplier(fakeFs, logger)
+
+		contents = []byte(`---
+name: fake-deployment-name
+jobs:
+- name: bosh
+  instances: 1
+  properties:
+    director:
+      name: fake-director-name
+      cpi_job: warden_cpi
+- name: other
+  instances: 2
+`)
+	})
+
+	apply := func(ops string) (interface{}, error) {
+		fakeFs.WriteFileString("/fake-ops.yml", ops)
+
+		patchedContents, err := opsApplier.Apply(contents, []string{"/fake-ops.yml"})
+		if err != nil {
+			return nil, err
+		}
+
+		var patched interface{}
+		err = candiedyaml.Unmarshal(patchedContents, &patched)
+		Expect(err).ToNot(HaveOccurred())
+		return patched, nil
+	}
+
+	boshJob := func(patched interface{}) map[interface{}]interface{} {
+		jobs := patched.(map[interface{}]interface{})["jobs"].([]interface{})
+		return jobs[0].(map[interface{}]interface{})
+	}
+
+	It("returns the contents unchanged when there are no ops files", func() {
+		patchedContents, err := opsApplier.Apply(contents, []string{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(patchedContents).To(Equal(contents))
+	})
+
+	It("replaces values addressed by map keys and matching array items", func() {
+		patched, err := apply(`
+- type: replace
+  path: /jobs/name=bosh/properties/director/name
+  value: aws-director
+- type: replace
+  path: /jobs/1/instances
+  value: 3
+`)
+		Expect(err).ToNot(HaveOccurred())
+
+		director := boshJob(patched)["properties"].(map[interface{}]interface{})["director"]
+		Expect(director).To(Equal(map[interface{}]interface{}{
+			"name":    "aws-director",
+			"cpi_job": "warden_cpi",
+		}))
+
+		otherJob := patched.(map[interface{}]interface{})["jobs"].([]interface{})[1]
+		Expect(otherJob.(map[interface{}]interface{})["instances"]).To(Equal(int64(3)))
+	})
+
+	It("creates missing keys and array items after an optional segment", func() {
+		patched, err := apply(`
+- type: replace
+  path: /jobs/name=bosh/properties/aws?/region
+  value: us-east-1
+- type: replace
+  path: /jobs/name=new-job?/instances
+  value: 1
+`)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(boshJob(patched)["properties"].(map[interface{}]interface{})["aws"]).To(Equal(map[interface{}]interface{}{
+			"region": "us-east-1",
+		}))
+
+		jobs := patched.(map[interface{}]interface{})["jobs"].([]interface{})
+		Expect(jobs).To(HaveLen(3))
+		Expect(jobs[2]).To(Equal(map[interface{}]interface{}{
+			"name":      "new-job",
+			"instances": int64(1),
+		}))
+	})
+
+	It("appends array items", func() {
+		patched, err := apply(`
+- type: replace
+  path: /jobs/-
+  value: {name: appended}
+`)
+		Expect(err).ToNot(HaveOccurred())
+
+		jobs := patched.(map[interface{}]interface{})["jobs"].([]interface{})
+		Expect(jobs).To(HaveLen(3))
+		Expect(jobs[2]).To(Equal(map[interface{}]interface{}{"name": "appended"}))
+	})
+
+	It("removes map keys and array items", func() {
+		patched, err := apply(`
+- type: remove
+  path: /jobs/name=bosh/properties/director/cpi_job
+- type: remove
+  path: /jobs/name=other
+- type: remove
+  path: /missing?/key
+`)
+		Expect(err).ToNot(HaveOccurred())
+
+		jobs := patched.(map[interface{}]interface{})["jobs"].([]interface{})
+		Expect(jobs).To(HaveLen(1))
+		Expect(boshJob(patched)["properties"]).To(Equal(map[interface{}]interface{}{
+			"director": map[interface{}]interface{}{
+				"name": "fake-director-name",
+			},
+		}))
+	})
+
+	It("returns an error with the index and path of the operation when a map key is missing", func() {
+		_, err := apply(`
+- type: replace
+  path: /name
+  value: new-name
+- type: replace
+  path: /jobs/name=bosh/missing/name
+  value: value
+`)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(Equal("Applying operation [1] in ops file '/fake-ops.yml' (type 'replace', path '/jobs/name=bosh/missing/name'): " +
+			"Expected to find a map key 'missing' for path '/jobs/name=bosh/missing'"))
+	})
+
+	It("returns an error when no array item matches", func() {
+		_, err := apply(`
+- type: remove
+  path: /jobs/name=missing/instances
+`)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("Applying operation [0] in ops file '/fake-ops.yml' (type 'remove', path '/jobs/name=missing/instances'): " +
+			"Expected to find exactly one matching array item for path '/jobs/name=missing' but found 0"))
+	})
+
+	It("returns an error when an array index is out of range", func() {
+		_, err := apply(`
+- type: replace
+  path: /jobs/5/instances
+  value: 1
+`)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("Expected to find array index 5 but found array of length 2 for path '/jobs/5'"))
+	})
+
+	It("returns an error for unknown operation types", func() {
+		_, err := apply(`
+- type: add
+  path: /name
+`)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("Unknown operation type 'add', expected 'replace' or 'remove'"))
+	})
+})
@@ -0,0 +1,198 @@
+package manifest
+
+import (
+	"bytes"
+
+	"github.com/cloudfoundry-incubator/candiedyaml"
+
+	bosherr "github.com/cloudfoundry/bosh-agent/errors"
+	boshlog "github.com/cloudfoundry/bosh-agent/logger"
+	boshsys "github.com/cloudfoundry/bosh-agent/system"
+)
+
+// Resolver patches a manifest file with ops files and then interpolates the variables into it,
+// so that the manifest parsers and the deployment record read the manifest that is deployed.
+// Variables declared in the manifest 'variables' section that are not given are generated and saved in the vars store,
+// unless the vars store is read only.
+type Resolver interface {
+	Resolve(manifestPath string, opsFilePaths []string, sources VariablesSources) (ResolvedManifest, error)
+}
+
+// ResolvedManifest is a manifest file with its ops applied and its variables interpolated.
+// Path is the original manifest path if the manifest is unchanged,
+// otherwise it is a temporary file that must be deleted when no longer needed.
+type ResolvedManifest struct {
+	Path string
+
+	temporary bool
+	fs        boshsys.FileSystem
+}
+
+func (m ResolvedManifest) Delete() error {
+	if !m.temporary {
+		return nil
+	}
+	return m.fs.RemoveAll(m.Path)
+}
+
+type resolver struct {
+	fs                 boshsys.FileSystem
+	variablesLoader    VariablesLoader
+	variablesStore     VariablesStore
+	variablesGenerator VariablesGenerator
+	opsApplier         OpsApplier
+	interpolator       Interpolator
+	logger             boshlog.Logger
+	logTag             string
+}
+
+func NewResolver(
+	fs boshsys.FileSystem,
+	variablesLoader VariablesLoader,
+	variablesStore VariablesStore,
+	variablesGenerator VariablesGenerator,
+	opsApplier OpsApplier,
+	interpolator Interpolator,
+	logger boshlog.Logger,
+) Resolver {
+	return &resolver{
+		fs:                 fs,
+		variablesLoader:    variablesLoader,
+		variablesStore:     variablesStore,
+		variablesGenerator: variablesGenerator,
+		opsApplier:         opsApplier,
+		interpolator:       interpolator,
+		logger:             logger,
+		logTag:             "manifestResolver",
+	}
+}
+
+func (r *resolver) Resolve(manifestPath string, opsFilePaths []string, sources VariablesSources) (ResolvedManifest, error) {
+	variables, err := r.variablesLoader.Load(sources)
+	if err != nil {
+		return ResolvedManifest{}, bosherr.WrapError(err, "Loading manifest variables")
+	}
+
+	contents, err := r.fs.ReadFile(manifestPath)
+	if err != nil {
+		return ResolvedManifest{}, bosherr.WrapErrorf(err, "Reading file %s", manifestPath)
+	}
+
+	patchedContents, err := r.opsApplier.Apply(contents, opsFilePaths)
+	if err != nil {
+		return ResolvedManifest{}, bosherr.WrapError(err, "Applying ops files")
+	}
+
+	variables, err = r.generateVariables(patchedContents, variables, sources)
+	if err != nil {
+		return ResolvedManifest{}, bosherr.WrapError(err, "Generating manifest variables")
+	}
+
+	interpolatedContents, err := r.interpolator.Interpolate(patchedContents, variables)
+	if err != nil {
+		return ResolvedManifest{}, bosherr.WrapError(err, "Interpolating manifest variables")
+	}
+
+	if bytes.Equal(contents, interpolatedContents) {
+		return ResolvedManifest{Path: manifestPath}, nil
+	}
+
+	file, err := r.fs.TempFile("bosh-init-manifest")
+	if err != nil {
+		return ResolvedManifest{}, bosherr.WrapError(err, "Creating temporary file for interpolated manifest")
+	}
+	resolvedPath := file.Name()
+
+	err = file.Close()
+	if err != nil {
+		return ResolvedManifest{}, bosherr.WrapErrorf(err, "Closing file %s", resolvedPath)
+	}
+
+	err = r.fs.WriteFile(resolvedPath, interpolatedContents)
+	if err != nil {
+		if removeErr := r.fs.RemoveAll(resolvedPath); removeErr != nil {
+			r.logger.Warn(r.logTag, "Failed to delete temporary file '%s': %s", resolvedPath, removeErr.Error())
+		}
+		return ResolvedManifest{}, bosherr.WrapErrorf(err, "Writing file %s", resolvedPath)
+	}
+
+	r.logger.Debug(r.logTag, "Resolved manifest '%s' into '%s'", manifestPath, resolvedPath)
+
+	return ResolvedManifest{
+		Path:      resolvedPath,
+		temporary: true,
+		fs:        r.fs,
+	}, nil
+}
+
+// generateVariables returns the variables with the stored and generated values of the variables declared in the manifest.
+// Declared variables that are given are not generated, and stored variables are only generated again if requested.
+// A read only vars store is neither generated into nor saved: declared variables missing from it are left to the interpolation to report.
+func (r *resolver) generateVariables(contents []byte, variables Variables, sources VariablesSources) (Variables, error) {
+	if len(bytes.TrimSpace(contents)) == 0 {
+		return variables, nil
+	}
+
+	var manifest struct {
+		Variables []VariableDefinition `yaml:"variables"`
+	}
+	err := candiedyaml.Unmarshal(contents, &manifest)
+	if err != nil {
+		return Variables{}, bosherr.WrapError(err, "Unmarshalling variable definitions")
+	}
+
+	if len(manifest.Variables) == 0 {
+		return variables, nil
+	}
+
+	if sources.StorePath == "" {
+		if sources.ReadOnly {
+			return variables, nil
+		}
+		return Variables{}, bosherr.Error("Expected a vars store to save generated variables in")
+	}
+
+	storedVariables, err := r.variablesStore.Load(sources.StorePath)
+	if err != nil {
+		return Variables{}, bosherr.WrapErrorf(err, "Loading vars store '%s'", sources.StorePath)
+	}
+
+	if sources.ReadOnly {
+		return storedVariables.Merge(variables), nil
+	}
+
+	regenerate := map[string]bool{}
+	for _, name := range sources.Regenerate {
+		regenerate[name] = true
+	}
+
+	allVariables := storedVariables.Merge(variables)
+	generated := false
+	for _, definition := range manifest.Variables {
+		if _, found := variables[definition.Name]; found {
+			continue
+		}
+		if _, found := storedVariables[definition.Name]; found && !regenerate[definition.Name] {
+			continue
+		}
+
+		value, err := r.variablesGenerator.Generate(definition, allVariables)
+		if err != nil {
+			return Variables{}, bosherr.WrapErrorf(err, "Generating variable '%s'", definition.Name)
+		}
+
+		r.logger.Info(r.logTag, "Generated variable '%s'", definition.Name)
+		allVariables[definition.Name] = value
+		storedVariables[definition.Name] = value
+		generated = true
+	}
+
+	if generated {
+		err = r.variablesStore.Save(sources.StorePath, storedVariables)
+		if err != nil {
+			return Variables{}, bosherr.WrapErrorf(err, "Saving vars store '%s'", sources.StorePath)
+		}
+	}
+
+	return allVariables, nil
+}
@@ -0,0 +1,245 @@
+package manifest_test
+
+import (
+	"github.com/cloudfoundry-incubator/candiedyaml"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	boshlog "github.com/cloudfoundry/bosh-agent/logger"
+	fakesys "github.com/cloudfoundry/bosh-agent/system/fakes"
+
+	bicrypto "github.com/cloudfoundry/bosh-init/crypto"
+	. "github.com/cloudfoundry/bosh-init/manifest"
+)
+
+var _ = Describe("Resolver", func() {
+	var (
+		fakeFs   *fakesys.FakeFileSystem
+		resolver Resolver
+	)
+
+	BeforeEach(func() {
+		logger := boshlog.NewLogger(boshlog.LevelNone)
+		fakeFs = fakesys.NewFakeFileSystem()
+		fakeFs.ReturnTempFile = fakesys.NewFakeFile("/fake-resolved-manifest", fakeFs)
+
+		resolver = NewResolver(
+			fakeFs,
+			NewVariablesLoader(fakeFs, []string{}, logger),
+			NewVariablesStore(fakeFs, bicrypto.NewEncryptor(nil), logger),
+			NewVariablesGenerator(logger),
+			NewOpsApplier(fakeFs, logger),
+			NewInterpolator(logger),
+			logger,
+		)
+	})
+
+	Context("when the manifest has no variables", func() {
+		BeforeEach(func() {
+			fakeFs.WriteFileString("/fake-manifest.yml", "name: fake-deployment-name\n")
+		})
+
+		It("returns the manifest path", func() {
+			resolvedManifest, err := resolver.Resolve("/fake-manifest.yml", []string{}, VariablesSources{Vars: []string{"name=unused"}})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resolvedManifest.Path).To(Equal("/fake-manifest.yml"))
+		})
+
+		It("does not delete the manifest", func() {
+			resolvedManifest, err := resolver.Resolve("/fake-manifest.yml", []string{}, VariablesSources{})
+			Expect(err).ToNot(HaveOccurred())
+
+			err = resolvedManifest.Delete()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fakeFs.FileExists("/fake-manifest.yml")).To(BeTrue())
+		})
+	})
+
+	Context("when the manifest has variables", func() {
+		BeforeEach(func() {
+			fakeFs.WriteFileString("/fake-manifest.yml", "name: ((name))\n")
+		})
+
+		It("writes the interpolated manifest to a temporary file", func() {
+			resolvedManifest, err := resolver.Resolve("/fake-manifest.yml", []string{}, VariablesSources{Vars: []string{"name=fake-deployment-name"}})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resolvedManifest.Path).To(Equal("/fake-resolved-manifest"))
+
+			contents, err := fakeFs.ReadFileString("/fake-resolved-manifest")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(contents).To(Equal("name: fake-deployment-name\n"))
+		})
+
+		It("deletes the temporary file", func() {
+			resolvedManifest, err := resolver.Resolve("/fake-manifest.yml", []string{}, VariablesSources{Vars: []string{"name=fake-deployment-name"}})
+			Expect(err).ToNot(HaveOccurred())
+
+			err = resolvedManifest.Delete()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fakeFs.FileExists("/fake-resolved-manifest")).To(BeFalse())
+			Expect(fakeFs.FileExists("/fake-manifest.yml")).To(BeTrue())
+		})
+
+		It("returns an error when a variable is not found", func() {
+			_, err := resolver.Resolve("/fake-manifest.yml", []string{}, VariablesSources{})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Expected to find variables: name"))
+		})
+	})
+
+	Context("when ops files are given", func() {
+		BeforeEach(func() {
+			fakeFs.WriteFileString("/fake-manifest.yml", "name: fake-deployment-name\n")
+			fakeFs.WriteFileString("/fake-ops.yml", "- type: replace\n  path: /name\n  value: ((name))\n")
+		})
+
+		It("applies the ops before interpolating the variables", func() {
+			resolvedManifest, err := resolver.Resolve("/fake-manifest.yml", []string{"/fake-ops.yml"}, VariablesSources{Vars: []string{"name=patched-deployment-name"}})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resolvedManifest.Path).To(Equal("/fake-resolved-manifest"))
+
+			contents, err := fakeFs.ReadFileString("/fake-resolved-manifest")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(contents).To(Equal("name: patched-deployment-name\n"))
+		})
+	})
+
+	Context("when the manifest declares variables", func() {
+		var sources VariablesSources
+
+		BeforeEach(func() {
+			fakeFs.WriteFileString("/fake-manifest.yml", `---
+name: fake-deployment-name
+properties:
+  password: ((password))
+  other_password: ((other_password))
+variables:
+- name: password
+  type: password
+- name: other_password
+  type: password
+`)
+			sources = VariablesSources{StorePath: "/fake-vars-store.yml"}
+		})
+
+		resolvedProperties := func(resolvedManifest ResolvedManifest) map[interface{}]interface{} {
+			contents, err := fakeFs.ReadFile(resolvedManifest.Path)
+			Expect(err).ToNot(HaveOccurred())
+
+			var manifest map[interface{}]interface{}
+			err = candiedyaml.Unmarshal(contents, &manifest)
+			Expect(err).ToNot(HaveOccurred())
+			return manifest["properties"].(map[interface{}]interface{})
+		}
+
+		It("generates the variables and saves them in the vars store", func() {
+			resolvedManifest, err := resolver.Resolve("/fake-manifest.yml", []string{}, sources)
+			Expect(err).ToNot(HaveOccurred())
+
+			properties := resolvedProperties(resolvedManifest)
+			Expect(properties["password"]).To(MatchRegexp(`^[a-z0-9]{20}$`))
+
+			storedVariables, err := NewVariablesStore(fakeFs, bicrypto.NewEncryptor(nil), boshlog.NewLogger(boshlog.LevelNone)).Load("/fake-vars-store.yml")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(storedVariables).To(Equal(Variables{
+				"password":       properties["password"],
+				"other_password": properties["other_password"],
+			}))
+		})
+
+		It("reuses stored variables", func() {
+			fakeFs.WriteFileString("/fake-vars-store.yml", "password: stored-password\nother_password: other-stored-password\n")
+
+			resolvedManifest, err := resolver.Resolve("/fake-manifest.yml", []string{}, sources)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(resolvedProperties(resolvedManifest)).To(Equal(map[interface{}]interface{}{
+				"password":       "stored-password",
+				"other_password": "other-stored-password",
+			}))
+		})
+
+		It("generates stored variables again when requested", func() {
+			fakeFs.WriteFileString("/fake-vars-store.yml", "password: stored-password\nother_password: other-stored-password\n")
+			sources.Regenerate = []string{"password"}
+
+			resolvedManifest, err := resolver.Resolve("/fake-manifest.yml", []string{}, sources)
+			Expect(err).ToNot(HaveOccurred())
+
+			properties := resolvedProperties(resolvedManifest)
+			Expect(properties["password"]).ToNot(Equal("stored-password"))
+			Expect(properties["other_password"]).To(Equal("other-stored-password"))
+
+			contents, err := fakeFs.ReadFileString("/fake-vars-store.yml")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(contents).ToNot(ContainSubstring(" stored-password"))
+		})
+
+		It("does not generate or store variables that are given", func() {
+			sources.Vars = []string{"password=given-password"}
+
+			resolvedManifest, err := resolver.Resolve("/fake-manifest.yml", []string{}, sources)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resolvedProperties(resolvedManifest)["password"]).To(Equal("given-password"))
+
+			contents, err := fakeFs.ReadFileString("/fake-vars-store.yml")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(contents).ToNot(ContainSubstring("given-password"))
+			Expect(contents).To(ContainSubstring("other_password"))
+		})
+
+		It("does not write the vars store when nothing is generated", func() {
+			sources.Vars = []string{"password=given-password", "other_password=other-given-password"}
+
+			_, err := resolver.Resolve("/fake-manifest.yml", []string{}, sources)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fakeFs.FileExists("/fake-vars-store.yml")).To(BeFalse())
+		})
+
+		It("returns an error when there is no vars store", func() {
+			_, err := resolver.Resolve("/fake-manifest.yml", []string{}, VariablesSources{})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Expected a vars store to save generated variables in"))
+		})
+
+		Context("when the vars store is read only", func() {
+			BeforeEach(func() {
+				sources.ReadOnly = true
+			})
+
+			It("uses the stored variables", func() {
+				fakeFs.WriteFileString("/fake-vars-store.yml", "password: stored-password\nother_password: other-stored-password\n")
+				sources.Regenerate = []string{"password"}
+
+				resolvedManifest, err := resolver.Resolve("/fake-manifest.yml", []string{}, sources)
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(resolvedProperties(resolvedManifest)).To(Equal(map[interface{}]interface{}{
+					"password":       "stored-password",
+					"other_password": "other-stored-password",
+				}))
+			})
+
+			It("does not generate or store variables missing from the vars store", func() {
+				fakeFs.WriteFileString("/fake-vars-store.yml", "password: stored-password\n")
+
+				_, err := resolver.Resolve("/fake-manifest.yml", []string{}, sources)
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("Expected to find variables: other_password"))
+
+				contents, err := fakeFs.ReadFileString("/fake-vars-store.yml")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(contents).To(Equal("password: stored-password\n"))
+			})
+
+			It("does not create the vars store", func() {
+				sources.Vars = []string{"password=given-password", "other_password=other-given-password"}
+
+				_, err := resolver.Resolve("/fake-manifest.yml", []string{}, sources)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(fakeFs.FileExists("/fake-vars-store.yml")).To(BeFalse())
+			})
+		})
+	})
+})
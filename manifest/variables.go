@@ -0,0 +1,65 @@
+package manifest
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Variables are the values of the ((name)) placeholders in a manifest, by variable name.
+// Values from vars files may be maps, whose keys can be referenced with a dotted name, e.g. ((director.password)).
+type Variables map[string]interface{}
+
+// Merge returns the variables with the other variables added, replacing variables with the same name.
+func (v Variables) Merge(other Variables) Variables {
+	merged := Variables{}
+	for name, value := range v {
+		merged[name] = value
+	}
+	for name, value := range other {
+		merged[name] = value
+	}
+	return merged
+}
+
+// Find returns the value of the variable with the given name.
+func (v Variables) Find(name string) (interface{}, bool) {
+	value, found := v[name]
+	if found {
+		return value, true
+	}
+
+	keys := strings.Split(name, ".")
+	if len(keys) == 1 {
+		return nil, false
+	}
+
+	value, found = v[keys[0]]
+	if !found {
+		return nil, false
+	}
+
+	for _, key := range keys[1:] {
+		switch typedValue := value.(type) {
+		case map[interface{}]interface{}:
+			value, found = typedValue[key]
+		case map[string]interface{}:
+			value, found = typedValue[key]
+		default:
+			found = false
+		}
+		if !found {
+			return nil, false
+		}
+	}
+
+	return value, true
+}
+
+// stringifyKeys returns the map with all its keys converted to strings
+func stringifyKeys(rawMap map[interface{}]interface{}) Variables {
+	variables := Variables{}
+	for key, value := range rawMap {
+		variables[fmt.Sprintf("%v", key)] = value
+	}
+	return variables
+}
@@ -0,0 +1,267 @@
+package manifest
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"strings"
+	"time"
+
+	bosherr "github.com/cloudfoundry/bosh-agent/errors"
+	boshlog "github.com/cloudfoundry/bosh-agent/logger"
+)
+
+const (
+	VariableTypePassword    = "password"
+	VariableTypeRSA         = "rsa"
+	VariableTypeSSH         = "ssh"
+	VariableTypeCertificate = "certificate"
+)
+
+const (
+	passwordLength   = 20
+	passwordChars    = "abcdefghijklmnopqrstuvwxyz0123456789"
+	rsaKeyBits       = 2048
+	certificateYears = 1
+)
+
+// VariableDefinition is a variable in the manifest 'variables' section, whose value is generated if it is not given.
+// Certificates support the options 'common_name', 'alternative_names', 'is_ca' and 'ca',
+// which is the name of the certificate variable to sign with (self-signed if not set).
+type VariableDefinition struct {
+	Name    string                      `yaml:"name"`
+	Type    string                      `yaml:"type"`
+	Options map[interface{}]interface{} `yaml:"options"`
+}
+
+// VariablesGenerator generates values for variable definitions:
+//   - password: a random string
+//   - rsa: a map with 'private_key' and 'public_key' in PEM format
+//   - ssh: a map with 'private_key' in PEM format, 'public_key' in authorized_keys format and 'public_key_fingerprint'
+//   - certificate: a map with 'ca', 'certificate' and 'private_key' in PEM format
+type VariablesGenerator interface {
+	Generate(definition VariableDefinition, variables Variables) (interface{}, error)
+}
+
+type variablesGenerator struct {
+	logger boshlog.Logger
+	logTag string
+}
+
+func NewVariablesGenerator(logger boshlog.Logger) VariablesGenerator {
+	return &variablesGenerator{
+		logger: logger,
+		logTag: "variablesGenerator",
+	}
+}
+
+// Generate returns a new value for the variable.
+// A certificate signed by a CA requires the CA variable to be in the variables.
+func (g *variablesGenerator) Generate(definition VariableDefinition, variables Variables) (interface{}, error) {
+	g.logger.Debug(g.logTag, "Generating variable '%s' of type '%s'", definition.Name, definition.Type)
+
+	switch definition.Type {
+	case VariableTypePassword:
+		return g.generatePassword()
+	case VariableTypeRSA:
+		return g.generateRSA()
+	case VariableTypeSSH:
+		return g.generateSSH()
+	case VariableTypeCertificate:
+		return g.generateCertificate(definition, variables)
+	default:
+		return nil, bosherr.Errorf("Unknown variable type '%s', expected one of '%s', '%s', '%s' or '%s'",
+			definition.Type, VariableTypePassword, VariableTypeRSA, VariableTypeSSH, VariableTypeCertificate)
+	}
+}
+
+func (g *variablesGenerator) generatePassword() (interface{}, error) {
+	randomBytes := make([]byte, passwordLength)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return nil, bosherr.WrapError(err, "Reading random bytes")
+	}
+
+	password := make([]byte, passwordLength)
+	for i, randomByte := range randomBytes {
+		password[i] = passwordChars[int(randomByte)%len(passwordChars)]
+	}
+	return string(password), nil
+}
+
+func (g *variablesGenerator) generateRSA() (interface{}, error) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	if err != nil {
+		return nil, bosherr.WrapError(err, "Generating private key")
+	}
+
+	publicKeyDER, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		return nil, bosherr.WrapError(err, "Marshalling public key")
+	}
+
+	return map[interface{}]interface{}{
+		"private_key": encodePrivateKey(privateKey),
+		"public_key":  string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKeyDER})),
+	}, nil
+}
+
+func (g *variablesGenerator) generateSSH() (interface{}, error) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	if err != nil {
+		return nil, bosherr.WrapError(err, "Generating private key")
+	}
+
+	publicKeyWire := sshPublicKeyWireFormat(&privateKey.PublicKey)
+
+	fingerprint := []string{}
+	for _, b := range md5.Sum(publicKeyWire) {
+		fingerprint = append(fingerprint, fmt.Sprintf("%02x", b))
+	}
+
+	return map[interface{}]interface{}{
+		"private_key":            encodePrivateKey(privateKey),
+		"public_key":             "ssh-rsa " + base64.StdEncoding.EncodeToString(publicKeyWire),
+		"public_key_fingerprint": strings.Join(fingerprint, ":"),
+	}, nil
+}
+
+func (g *variablesGenerator) generateCertificate(definition VariableDefinition, variables Variables) (interface{}, error) {
+	commonName, _ := definition.Options["common_name"].(string)
+	isCA, _ := definition.Options["is_ca"].(bool)
+	caName, _ := definition.Options["ca"].(string)
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	if err != nil {
+		return nil, bosherr.WrapError(err, "Generating private key")
+	}
+
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, bosherr.WrapError(err, "Generating serial number")
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             now.Add(-1 * time.Hour),
+		NotAfter:              now.AddDate(certificateYears, 0, 0),
+		KeyUsage:              x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+	if isCA {
+		template.KeyUsage |= x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+	}
+
+	alternativeNames, _ := definition.Options["alternative_names"].([]interface{})
+	for _, rawName := range alternativeNames {
+		name := fmt.Sprintf("%v", rawName)
+		if ip := net.ParseIP(name); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, name)
+		}
+	}
+
+	parent := template
+	signingKey := privateKey
+	caPEM := ""
+	if caName != "" {
+		parent, signingKey, caPEM, err = g.findCA(caName, variables)
+		if err != nil {
+			return nil, bosherr.WrapErrorf(err, "Finding CA '%s'", caName)
+		}
+	}
+
+	certificateDER, err := x509.CreateCertificate(rand.Reader, template, parent, &privateKey.PublicKey, signingKey)
+	if err != nil {
+		return nil, bosherr.WrapError(err, "Creating certificate")
+	}
+
+	certificatePEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificateDER}))
+	if caName == "" {
+		caPEM = certificatePEM
+	}
+
+	return map[interface{}]interface{}{
+		"ca":          caPEM,
+		"certificate": certificatePEM,
+		"private_key": encodePrivateKey(privateKey),
+	}, nil
+}
+
+// findCA returns the certificate, private key and PEM encoded certificate of the CA variable
+func (g *variablesGenerator) findCA(caName string, variables Variables) (*x509.Certificate, *rsa.PrivateKey, string, error) {
+	caValue, found := variables[caName]
+	if !found {
+		return nil, nil, "", bosherr.Errorf("Expected to find CA variable '%s' declared before the certificates it signs", caName)
+	}
+
+	caFields, _ := caValue.(map[interface{}]interface{})
+	caPEM, foundCertificate := caFields["certificate"].(string)
+	caKeyPEM, foundKey := caFields["private_key"].(string)
+	if !foundCertificate || !foundKey {
+		return nil, nil, "", bosherr.Errorf("Expected CA variable '%s' to have a 'certificate' and 'private_key'", caName)
+	}
+
+	certificateBlock, _ := pem.Decode([]byte(caPEM))
+	if certificateBlock == nil {
+		return nil, nil, "", bosherr.Error("Expected CA certificate to be in PEM format")
+	}
+	caCertificate, err := x509.ParseCertificate(certificateBlock.Bytes)
+	if err != nil {
+		return nil, nil, "", bosherr.WrapError(err, "Parsing CA certificate")
+	}
+
+	keyBlock, _ := pem.Decode([]byte(caKeyPEM))
+	if keyBlock == nil {
+		return nil, nil, "", bosherr.Error("Expected CA private key to be in PEM format")
+	}
+	caKey, err := x509.ParsePKCS1PrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, nil, "", bosherr.WrapError(err, "Parsing CA private key")
+	}
+
+	return caCertificate, caKey, caPEM, nil
+}
+
+func encodePrivateKey(privateKey *rsa.PrivateKey) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)}))
+}
+
+// sshPublicKeyWireFormat returns the public key as in RFC 4253 section 6.6, as used in authorized_keys files
+func sshPublicKeyWireFormat(publicKey *rsa.PublicKey) []byte {
+	buffer := &bytes.Buffer{}
+	writeSSHString(buffer, []byte("ssh-rsa"))
+	writeSSHString(buffer, sshMPInt(big.NewInt(int64(publicKey.E))))
+	writeSSHString(buffer, sshMPInt(publicKey.N))
+	return buffer.Bytes()
+}
+
+func writeSSHString(buffer *bytes.Buffer, value []byte) {
+	length := make([]byte, 4)
+	binary.BigEndian.PutUint32(length, uint32(len(value)))
+	buffer.Write(length)
+	buffer.Write(value)
+}
+
+// sshMPInt returns the bytes of a positive integer, with a leading zero byte if the high bit is set
+func sshMPInt(value *big.Int) []byte {
+	valueBytes := value.Bytes()
+	if len(valueBytes) > 0 && valueBytes[0]&0x80 != 0 {
+		return append([]byte{0}, valueBytes...)
+	}
+	return valueBytes
+}
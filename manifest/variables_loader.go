@@ -0,0 +1,136 @@
+package manifest
+
+import (
+	"strings"
+
+	"github.com/cloudfoundry-incubator/candiedyaml"
+
+	bosherr "github.com/cloudfoundry/bosh-agent/errors"
+	boshlog "github.com/cloudfoundry/bosh-agent/logger"
+	boshsys "github.com/cloudfoundry/bosh-agent/system"
+)
+
+// VariablesSources are where the values of manifest variables come from.
+// Later sources take precedence: environment variables, then vars files (in order), then vars.
+type VariablesSources struct {
+	// EnvPrefixes are prefixes of environment variables, e.g. 'BOSH_INIT' for BOSH_INIT_password=secret
+	EnvPrefixes []string
+
+	// Files are paths of YAML files with a map of variable names to values
+	Files []string
+
+	// Vars are variables in the form 'name=value'
+	Vars []string
+
+	// StorePath is the path of a YAML file that generated variables are read from and saved to
+	StorePath string
+
+	// Regenerate are the names of stored variables to generate again
+	Regenerate []string
+
+	// ReadOnly is true when the vars store is only read from,
+	// for commands that must not generate variables, e.g. credentials of a deployment that does not exist
+	ReadOnly bool
+}
+
+type VariablesLoader interface {
+	Load(VariablesSources) (Variables, error)
+}
+
+type variablesLoader struct {
+	fs      boshsys.FileSystem
+	environ []string
+	logger  boshlog.Logger
+	logTag  string
+}
+
+// NewVariablesLoader returns a VariablesLoader that reads environment variables from environ ('NAME=value' strings, as returned by os.Environ).
+func NewVariablesLoader(fs boshsys.FileSystem, environ []string, logger boshlog.Logger) VariablesLoader {
+	return &variablesLoader{
+		fs:      fs,
+		environ: environ,
+		logger:  logger,
+		logTag:  "variablesLoader",
+	}
+}
+
+func (l *variablesLoader) Load(sources VariablesSources) (Variables, error) {
+	variables := Variables{}
+
+	for _, prefix := range sources.EnvPrefixes {
+		envVariables, err := l.loadEnv(prefix)
+		if err != nil {
+			return Variables{}, bosherr.WrapErrorf(err, "Loading variables from environment variables with prefix '%s'", prefix)
+		}
+		variables = variables.Merge(envVariables)
+	}
+
+	for _, path := range sources.Files {
+		fileVariables, err := l.loadFile(path)
+		if err != nil {
+			return Variables{}, bosherr.WrapErrorf(err, "Loading variables from file '%s'", path)
+		}
+		variables = variables.Merge(fileVariables)
+	}
+
+	for _, nameValue := range sources.Vars {
+		name, value, err := l.splitNameValue(nameValue)
+		if err != nil {
+			return Variables{}, err
+		}
+		variables[name] = value
+	}
+
+	return variables, nil
+}
+
+// loadEnv parses the values of environment variables with the prefix as YAML, so that they can be numbers, lists or maps
+func (l *variablesLoader) loadEnv(prefix string) (Variables, error) {
+	variables := Variables{}
+	for _, nameValue := range l.environ {
+		if !strings.HasPrefix(nameValue, prefix+"_") {
+			continue
+		}
+
+		name, rawValue, err := l.splitNameValue(strings.TrimPrefix(nameValue, prefix+"_"))
+		if err != nil {
+			return Variables{}, err
+		}
+
+		var value interface{}
+		err = candiedyaml.Unmarshal([]byte(rawValue), &value)
+		if err != nil {
+			return Variables{}, bosherr.WrapErrorf(err, "Unmarshalling value of environment variable '%s_%s'", prefix, name)
+		}
+		if value == nil {
+			value = rawValue
+		}
+
+		l.logger.Debug(l.logTag, "Found variable '%s' in environment variable '%s_%s'", name, prefix, name)
+		variables[name] = value
+	}
+	return variables, nil
+}
+
+func (l *variablesLoader) loadFile(path string) (Variables, error) {
+	contents, err := l.fs.ReadFile(path)
+	if err != nil {
+		return Variables{}, bosherr.WrapErrorf(err, "Reading file %s", path)
+	}
+
+	rawVariables := map[interface{}]interface{}{}
+	err = candiedyaml.Unmarshal(contents, &rawVariables)
+	if err != nil {
+		return Variables{}, bosherr.WrapError(err, "Unmarshalling variables")
+	}
+
+	return stringifyKeys(rawVariables), nil
+}
+
+func (l *variablesLoader) splitNameValue(nameValue string) (string, string, error) {
+	parts := strings.SplitN(nameValue, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return "", "", bosherr.Errorf("Expected variable '%s' to be in the form 'name=value'", nameValue)
+	}
+	return parts[0], parts[1], nil
+}
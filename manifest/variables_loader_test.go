@@ -0,0 +1,87 @@
+package manifest_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	boshlog "github.com/cloudfoundry/bosh-agent/logger"
+	fakesys "github.com/cloudfoundry/bosh-agent/system/fakes"
+
+	. "github.com/cloudfoundry/bosh-init/manifest"
+)
+
+var _ = Describe("VariablesLoader", func() {
+	var (
+		fakeFs  *fakesys.FakeFileSystem
+		environ []string
+		loader  VariablesLoader
+	)
+
+	BeforeEach(func() {
+		fakeFs = fakesys.NewFakeFileSystem()
+		environ = []string{
+			"PATH=/usr/bin",
+			"FAKE_PREFIX_password=env-password",
+			"FAKE_PREFIX_port=4222",
+			"FAKE_PREFIX_dns=[10.0.0.2, 10.0.0.3]",
+		}
+	})
+
+	JustBeforeEach(func() {
+		logger := boshlog.NewLogger(boshlog.LevelNone)
+		loader = NewVariablesLoader(fakeFs, environ, logger)
+	})
+
+	It("loads variables from environment variables with the prefixes, parsing their values as YAML", func() {
+		variables, err := loader.Load(VariablesSources{EnvPrefixes: []string{"FAKE_PREFIX"}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(variables).To(Equal(Variables{
+			"password": "env-password",
+			"port":     int64(4222),
+			"dns":      []interface{}{"10.0.0.2", "10.0.0.3"},
+		}))
+	})
+
+	It("loads variables from vars files", func() {
+		fakeFs.WriteFileString("/fake-vars.yml", "password: file-password\ndirector:\n  name: fake-director\n")
+
+		variables, err := loader.Load(VariablesSources{Files: []string{"/fake-vars.yml"}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(variables).To(Equal(Variables{
+			"password": "file-password",
+			"director": map[interface{}]interface{}{
+				"name": "fake-director",
+			},
+		}))
+	})
+
+	It("prefers vars over vars files and vars files over environment variables", func() {
+		fakeFs.WriteFileString("/fake-vars-1.yml", "password: file-1-password\nport: 1\n")
+		fakeFs.WriteFileString("/fake-vars-2.yml", "password: file-2-password\n")
+
+		variables, err := loader.Load(VariablesSources{
+			EnvPrefixes: []string{"FAKE_PREFIX"},
+			Files:       []string{"/fake-vars-1.yml", "/fake-vars-2.yml"},
+			Vars:        []string{"port=6868", "name=a=b"},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(variables).To(Equal(Variables{
+			"password": "file-2-password",
+			"port":     "6868",
+			"dns":      []interface{}{"10.0.0.2", "10.0.0.3"},
+			"name":     "a=b",
+		}))
+	})
+
+	It("returns an error when a var is not in the form name=value", func() {
+		_, err := loader.Load(VariablesSources{Vars: []string{"password"}})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(Equal("Expected variable 'password' to be in the form 'name=value'"))
+	})
+
+	It("returns an error when a vars file cannot be read", func() {
+		_, err := loader.Load(VariablesSources{Files: []string{"/missing-vars.yml"}})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("Loading variables from file '/missing-vars.yml'"))
+	})
+})
@@ -0,0 +1,124 @@
+package manifest
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/cloudfoundry-incubator/candiedyaml"
+
+	bosherr "github.com/cloudfoundry/bosh-agent/errors"
+	boshlog "github.com/cloudfoundry/bosh-agent/logger"
+	boshsys "github.com/cloudfoundry/bosh-agent/system"
+
+	bicrypto "github.com/cloudfoundry/bosh-init/crypto"
+)
+
+// VariablesStore reads and writes the YAML file that generated variables are kept in,
+// so that they are reused by later deploys instead of being generated again.
+type VariablesStore interface {
+	Load(path string) (Variables, error)
+	Save(path string, variables Variables) error
+}
+
+type variablesStore struct {
+	fs        boshsys.FileSystem
+	encryptor bicrypto.Encryptor
+	logger    boshlog.Logger
+	logTag    string
+}
+
+// NewVariablesStore returns a VariablesStore that writes the file encrypted if the encryptor has a key
+func NewVariablesStore(fs boshsys.FileSystem, encryptor bicrypto.Encryptor, logger boshlog.Logger) VariablesStore {
+	return &variablesStore{
+		fs:        fs,
+		encryptor: encryptor,
+		logger:    logger,
+		logTag:    "variablesStore",
+	}
+}
+
+// Load returns no variables if the file does not exist yet
+func (s *variablesStore) Load(path string) (Variables, error) {
+	if !s.fs.FileExists(path) {
+		s.logger.Debug(s.logTag, "Vars store '%s' does not exist", path)
+		return Variables{}, nil
+	}
+
+	contents, err := s.fs.ReadFile(path)
+	if err != nil {
+		return Variables{}, bosherr.WrapErrorf(err, "Reading file %s", path)
+	}
+
+	contents, err = s.encryptor.Decrypt(contents)
+	if err != nil {
+		return Variables{}, bosherr.WrapErrorf(err, "Decrypting file %s", path)
+	}
+
+	rawVariables := map[interface{}]interface{}{}
+	err = candiedyaml.Unmarshal(contents, &rawVariables)
+	if err != nil {
+		return Variables{}, bosherr.WrapError(err, "Unmarshalling variables")
+	}
+
+	return stringifyKeys(rawVariables), nil
+}
+
+// Save writes the variables to the file, readable only by the current user as they are credentials
+func (s *variablesStore) Save(path string, variables Variables) error {
+	contents, err := candiedyaml.Marshal(map[string]interface{}(variables))
+	if err != nil {
+		return bosherr.WrapError(err, "Marshalling variables")
+	}
+
+	contents, err = s.encryptor.Encrypt(contents)
+	if err != nil {
+		return bosherr.WrapError(err, "Encrypting variables")
+	}
+
+	// the variables are written to a file that is only readable by the current user from its creation,
+	// and renamed over the vars store, so that they are never readable by others and a failed write does not lose them
+	tmpPath := path + ".tmp"
+	err = s.fs.RemoveAll(tmpPath)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Removing file %s", tmpPath)
+	}
+
+	err = s.writeFile(tmpPath, contents)
+	if err != nil {
+		return err
+	}
+
+	err = s.fs.Rename(tmpPath, path)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Renaming '%s' to vars store '%s'", tmpPath, path)
+	}
+
+	s.logger.Debug(s.logTag, "Saved %d variables to vars store '%s'", len(variables), path)
+	return nil
+}
+
+// writeFile creates the file readable only by the current user and writes the contents to it
+func (s *variablesStore) writeFile(path string, contents []byte) error {
+	err := s.fs.MkdirAll(filepath.Dir(path), os.ModePerm)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Creating directory of file %s", path)
+	}
+
+	file, err := s.fs.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Creating file %s", path)
+	}
+
+	_, err = file.Write(contents)
+	if err != nil {
+		file.Close()
+		return bosherr.WrapErrorf(err, "Writing file %s", path)
+	}
+
+	err = file.Close()
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Closing file %s", path)
+	}
+
+	return nil
+}
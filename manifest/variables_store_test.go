@@ -0,0 +1,136 @@
+package manifest_test
+
+import (
+	"errors"
+	"os"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	boshlog "github.com/cloudfoundry/bosh-agent/logger"
+	fakesys "github.com/cloudfoundry/bosh-agent/system/fakes"
+
+	bicrypto "github.com/cloudfoundry/bosh-init/crypto"
+	. "github.com/cloudfoundry/bosh-init/manifest"
+)
+
+var _ = Describe("VariablesStore", func() {
+	var (
+		fakeFs         *fakesys.FakeFileSystem
+		encryptor      bicrypto.Encryptor
+		variablesStore VariablesStore
+	)
+
+	BeforeEach(func() {
+		logger := boshlog.NewLogger(boshlog.LevelNone)
+		fakeFs = fakesys.NewFakeFileSystem()
+		encryptor = bicrypto.NewEncryptor(nil)
+		variablesStore = NewVariablesStore(fakeFs, encryptor, logger)
+	})
+
+	Describe("Load", func() {
+		It("returns no variables when the vars store does not exist", func() {
+			variables, err := variablesStore.Load("/fake-vars-store.yml")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(variables).To(Equal(Variables{}))
+		})
+
+		It("returns the stored variables", func() {
+			fakeFs.WriteFileString("/fake-vars-store.yml", "password: fake-password\nca:\n  certificate: fake-certificate\n")
+
+			variables, err := variablesStore.Load("/fake-vars-store.yml")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(variables).To(Equal(Variables{
+				"password": "fake-password",
+				"ca": map[interface{}]interface{}{
+					"certificate": "fake-certificate",
+				},
+			}))
+		})
+
+		It("returns an error when the vars store is not valid YAML", func() {
+			fakeFs.WriteFileString("/fake-vars-store.yml", "- not-a-map")
+
+			_, err := variablesStore.Load("/fake-vars-store.yml")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Unmarshalling variables"))
+		})
+	})
+
+	Describe("Save", func() {
+		It("writes the variables so that they can be loaded", func() {
+			err := variablesStore.Save("/fake-vars-store.yml", Variables{
+				"password": "fake-password",
+				"ca": map[interface{}]interface{}{
+					"certificate": "fake-certificate",
+				},
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			variables, err := variablesStore.Load("/fake-vars-store.yml")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(variables).To(Equal(Variables{
+				"password": "fake-password",
+				"ca": map[interface{}]interface{}{
+					"certificate": "fake-certificate",
+				},
+			}))
+		})
+
+		It("makes the vars store readable only by the current user", func() {
+			err := variablesStore.Save("/fake-vars-store.yml", Variables{"password": "fake-password"})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(fakeFs.GetFileTestStat("/fake-vars-store.yml").FileMode).To(Equal(os.FileMode(0600)))
+		})
+
+		It("writes the variables to a temporary file that is renamed over the vars store", func() {
+			fakeFs.WriteFileString("/fake-vars-store.yml", "password: old-password\n")
+			fakeFs.WriteFileString("/fake-vars-store.yml.tmp", "stale")
+
+			err := variablesStore.Save("/fake-vars-store.yml", Variables{"password": "fake-password"})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(fakeFs.RenameOldPaths).To(Equal([]string{"/fake-vars-store.yml.tmp"}))
+			Expect(fakeFs.RenameNewPaths).To(Equal([]string{"/fake-vars-store.yml"}))
+			Expect(fakeFs.FileExists("/fake-vars-store.yml.tmp")).To(BeFalse())
+			Expect(fakeFs.GetFileTestStat("/fake-vars-store.yml").FileMode).To(Equal(os.FileMode(0600)))
+		})
+
+		It("keeps the vars store when writing the variables fails", func() {
+			fakeFs.WriteFileString("/fake-vars-store.yml", "password: old-password\n")
+			fakeFs.OpenFileErr = errors.New("fake-open-error")
+
+			err := variablesStore.Save("/fake-vars-store.yml", Variables{"password": "fake-password"})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("fake-open-error"))
+
+			contents, err := fakeFs.ReadFileString("/fake-vars-store.yml")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(contents).To(Equal("password: old-password\n"))
+		})
+
+		Context("when the encryptor has a key", func() {
+			BeforeEach(func() {
+				encryptor.SetKey([]byte("fake-key"))
+			})
+
+			It("writes the variables encrypted so that they can be loaded with the key", func() {
+				err := variablesStore.Save("/fake-vars-store.yml", Variables{"password": "fake-password"})
+				Expect(err).ToNot(HaveOccurred())
+
+				contents, err := fakeFs.ReadFileString("/fake-vars-store.yml")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(contents).ToNot(ContainSubstring("fake-password"))
+
+				variables, err := variablesStore.Load("/fake-vars-store.yml")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(variables).To(Equal(Variables{"password": "fake-password"}))
+
+				_, err = NewVariablesStore(fakeFs, bicrypto.NewEncryptor(nil), boshlog.NewLogger(boshlog.LevelNone)).Load("/fake-vars-store.yml")
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("Decrypting file /fake-vars-store.yml"))
+			})
+		})
+	})
+})
@@ -2,6 +2,7 @@ package stemcell
 
 import (
 	"fmt"
+	"strings"
 
 	bosherr "github.com/cloudfoundry/bosh-agent/errors"
 
@@ -46,8 +47,9 @@ func (m *manager) FindCurrent() ([]CloudStemcell, error) {
 }
 
 // Upload stemcell to an IAAS. It does the following steps:
-// 1) uploads the stemcell to the cloud (if needed),
-// 2) saves a record of the uploaded stemcell in the repo
+// 1) checks that the CPI supports the stemcell format,
+// 2) uploads the stemcell to the cloud (if needed),
+// 3) saves a record of the uploaded stemcell in the repo
 func (m *manager) Upload(extractedStemcell ExtractedStemcell, uploadStage biui.Stage) (cloudStemcell CloudStemcell, err error) {
 	manifest := extractedStemcell.Manifest()
 	stageName := fmt.Sprintf("Uploading stemcell '%s/%s'", manifest.Name, manifest.Version)
@@ -62,6 +64,15 @@ func (m *manager) Upload(extractedStemcell ExtractedStemcell, uploadStage biui.S
 			return biui.NewSkipStageError(bosherr.Errorf("Found stemcell: %#v", foundStemcellRecord), "Stemcell already uploaded")
 		}
 
+		cpiInfo := m.cloud.Info()
+		if !cpiInfo.SupportsStemcellFormats(manifest.Formats) {
+			return bosherr.Errorf(
+				"CPI does not support the stemcell formats '%s', only '%s'",
+				strings.Join(manifest.Formats, ", "),
+				strings.Join(cpiInfo.StemcellFormats, ", "),
+			)
+		}
+
 		cid, err := m.cloud.CreateStemcell(manifest.ImagePath, manifest.CloudProperties)
 		if err != nil {
 			return bosherr.WrapErrorf(err, "creating stemcell (%s %s)", manifest.Name, manifest.Version)
@@ -11,10 +11,13 @@ import (
 	boshlog "github.com/cloudfoundry/bosh-agent/logger"
 
 	fakesys "github.com/cloudfoundry/bosh-agent/system/fakes"
+	faketime "github.com/cloudfoundry/bosh-agent/time/fakes"
 	fakeuuid "github.com/cloudfoundry/bosh-agent/uuid/fakes"
 
+	bicloud "github.com/cloudfoundry/bosh-init/cloud"
 	biproperty "github.com/cloudfoundry/bosh-init/common/property"
 	biconfig "github.com/cloudfoundry/bosh-init/config"
+	bicrypto "github.com/cloudfoundry/bosh-init/crypto"
 
 	fakebicloud "github.com/cloudfoundry/bosh-init/cloud/fakes"
 	fakebistemcell "github.com/cloudfoundry/bosh-init/stemcell/fakes"
@@ -41,7 +44,7 @@ var _ = Describe("Manager", func() {
 		reader = fakebistemcell.NewFakeReader()
 		logger := boshlog.NewLogger(boshlog.LevelNone)
 		fakeUUIDGenerator = &fakeuuid.FakeGenerator{}
-		configService := biconfig.NewFileSystemDeploymentConfigService(fs, fakeUUIDGenerator, logger)
+		configService := biconfig.NewFileSystemDeploymentConfigService(fs, fakeUUIDGenerator, &faketime.FakeService{}, bicrypto.NewEncryptor(nil), logger)
 		configService.SetConfigPath("/fake/path")
 		fakeUUIDGenerator.GeneratedUUID = "fake-stemcell-id-1"
 		stemcellRepo = biconfig.NewStemcellRepo(configService, fakeUUIDGenerator)
@@ -122,6 +125,29 @@ var _ = Describe("Manager", func() {
 			}))
 		})
 
+		Context("when the CPI does not support the stemcell formats", func() {
+			BeforeEach(func() {
+				fakeCloud.InfoResult = bicloud.CPIInfo{StemcellFormats: []string{"fake-supported-format"}}
+				expectedExtractedStemcell = NewExtractedStemcell(
+					Manifest{
+						Name:      "fake-stemcell-name",
+						Version:   "fake-stemcell-version",
+						ImagePath: "fake-image-path",
+						Formats:   []string{"fake-format-1", "fake-format-2"},
+					},
+					tempExtractionDir,
+					fs,
+				)
+			})
+
+			It("returns an error without uploading the stemcell", func() {
+				_, err := manager.Upload(expectedExtractedStemcell, fakeStage)
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("CPI does not support the stemcell formats 'fake-format-1, fake-format-2', only 'fake-supported-format'"))
+				Expect(fakeCloud.CreateStemcellInputs).To(BeEmpty())
+			})
+		})
+
 		It("when the upload fails, prints failed uploading ui stage", func() {
 			fakeCloud.CreateStemcellErr = errors.New("fake-create-error")
 			_, err := manager.Upload(expectedExtractedStemcell, fakeStage)
@@ -134,7 +160,7 @@ var _ = Describe("Manager", func() {
 		})
 
 		It("when the stemcellRepo save fails, logs uploading start and failure events to the eventLogger", func() {
-			fs.WriteFileError = errors.New("fake-save-error")
+			fs.OpenFileErr = errors.New("fake-save-error")
 			_, err := manager.Upload(expectedExtractedStemcell, fakeStage)
 			Expect(err).To(HaveOccurred())
 			Expect(err.Error()).To(ContainSubstring("fake-save-error"))
@@ -16,6 +16,7 @@ type manifest struct {
 	Name            string
 	Version         string
 	SHA1            string
+	Formats         []string                    `yaml:"stemcell_formats"`
 	CloudProperties map[interface{}]interface{} `yaml:"cloud_properties"`
 }
 
@@ -57,6 +58,7 @@ func (s reader) Read(stemcellTarballPath string, extractedPath string) (Extracte
 		Name:    rawManifest.Name,
 		Version: rawManifest.Version,
 		SHA1:    rawManifest.SHA1,
+		Formats: rawManifest.Formats,
 	}
 
 	cloudProperties, err := biproperty.BuildMap(rawManifest.CloudProperties)
@@ -30,6 +30,8 @@ var _ = Describe("Reader", func() {
 ---
 name: fake-stemcell-name
 version: '2690'
+stemcell_formats:
+- aws-light
 cloud_properties:
   infrastructure: aws
   ami:
@@ -53,6 +55,7 @@ cloud_properties:
 				Name:      "fake-stemcell-name",
 				Version:   "2690",
 				ImagePath: "fake-extracted-path/image",
+				Formats:   []string{"aws-light"},
 				CloudProperties: biproperty.Map{
 					"infrastructure": "aws",
 					"ami": biproperty.Map{
@@ -0,0 +1,116 @@
+package erbrenderer
+
+import (
+	"strings"
+
+	bosherr "github.com/cloudfoundry/bosh-agent/errors"
+)
+
+type erbSegmentKind int
+
+const (
+	erbText erbSegmentKind = iota
+	erbCode
+	erbOutput
+)
+
+// erbSegment is a piece of an ERB template: literal text, a <% code %> tag or an <%= output %> tag
+type erbSegment struct {
+	kind    erbSegmentKind
+	content string
+	line    int
+}
+
+// parseERB splits an ERB template into segments.
+// Besides the default ERB tags it supports the '-' trim mode used by BOSH job templates:
+// '<%-' removes the indentation before the tag and '-%>' removes the newline after it.
+func parseERB(source string) ([]erbSegment, error) {
+	segments := []erbSegment{}
+	text := ""
+	textLine := 1
+	line := 1
+
+	flushText := func() {
+		if text != "" {
+			segments = append(segments, erbSegment{kind: erbText, content: text, line: textLine})
+		}
+		text = ""
+		textLine = line
+	}
+
+	for len(source) > 0 {
+		start := strings.Index(source, "<%")
+		if start == -1 {
+			text += source
+			break
+		}
+
+		text += source[:start]
+		line += strings.Count(source[:start], "\n")
+		source = source[start:]
+
+		if strings.HasPrefix(source, "<%%") {
+			text += "<%"
+			source = source[3:]
+			continue
+		}
+
+		kind := erbCode
+		comment := false
+		source = source[2:]
+		switch {
+		case strings.HasPrefix(source, "="):
+			kind = erbOutput
+			source = source[1:]
+		case strings.HasPrefix(source, "#"):
+			comment = true
+			source = source[1:]
+		case strings.HasPrefix(source, "-"):
+			text = trimIndentation(text)
+			source = source[1:]
+		}
+
+		end := strings.Index(source, "%>")
+		if end == -1 {
+			return nil, bosherr.Errorf("Unclosed ERB tag on line %d", line)
+		}
+
+		content := source[:end]
+		source = source[end+2:]
+
+		trimNewline := strings.HasSuffix(content, "-")
+		if trimNewline {
+			content = content[:len(content)-1]
+		}
+
+		flushText()
+		if !comment {
+			segments = append(segments, erbSegment{kind: kind, content: content, line: line})
+		}
+		line += strings.Count(content, "\n")
+
+		if trimNewline {
+			if strings.HasPrefix(source, "\r\n") {
+				source = source[2:]
+				line++
+			} else if strings.HasPrefix(source, "\n") {
+				source = source[1:]
+				line++
+			}
+		}
+		textLine = line
+	}
+
+	flushText()
+
+	return segments, nil
+}
+
+// trimIndentation removes the spaces and tabs at the end of text when they are the only characters on their line
+func trimIndentation(text string) string {
+	trimmed := strings.TrimRight(text, " \t")
+	if trimmed == "" || strings.HasSuffix(trimmed, "\n") {
+		return trimmed
+	}
+	return text
+}
@@ -1,8 +1,12 @@
 package fakes
 
 type FakeTemplateEvaluationContext struct {
+	ContextJSON string
 }
 
 func (f FakeTemplateEvaluationContext) MarshalJSON() ([]byte, error) {
+	if f.ContextJSON != "" {
+		return []byte(f.ContextJSON), nil
+	}
 	return []byte("{}"), nil
 }
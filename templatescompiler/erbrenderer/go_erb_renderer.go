@@ -0,0 +1,114 @@
+package erbrenderer
+
+import (
+	"encoding/json"
+	"fmt"
+
+	bosherr "github.com/cloudfoundry/bosh-agent/errors"
+	boshlog "github.com/cloudfoundry/bosh-agent/logger"
+	boshsys "github.com/cloudfoundry/bosh-agent/system"
+)
+
+const (
+	// EngineGo renders templates in process with the subset of Ruby used by job templates
+	EngineGo = "go"
+	// EngineRuby renders templates by running the ruby executable
+	EngineRuby = "ruby"
+)
+
+type goERBRenderer struct {
+	fs     boshsys.FileSystem
+	logger boshlog.Logger
+	logTag string
+}
+
+// NewGoERBRenderer returns an ERBRenderer that does not depend on a Ruby installation.
+// It supports the ERB tags, the template evaluation context (p, if_p, spec, properties)
+// and the parts of the Ruby language and core classes commonly used in job templates.
+func NewGoERBRenderer(
+	fs boshsys.FileSystem,
+	logger boshlog.Logger,
+) ERBRenderer {
+	return goERBRenderer{
+		fs:     fs,
+		logger: logger,
+		logTag: "goERBRenderer",
+	}
+}
+
+func (r goERBRenderer) Render(srcPath, dstPath string, context TemplateEvaluationContext) error {
+	r.logger.Debug(r.logTag, "Rendering template %s", dstPath)
+
+	contextBytes, err := json.Marshal(context)
+	if err != nil {
+		return bosherr.WrapError(err, "Marshalling context")
+	}
+
+	evaluationContext, err := newTemplateEvaluationContext(contextBytes)
+	if err != nil {
+		return bosherr.WrapError(err, "Building template evaluation context")
+	}
+
+	template, err := r.fs.ReadFileString(srcPath)
+	if err != nil {
+		return bosherr.WrapError(err, "Reading template")
+	}
+
+	result, err := renderERB(template, evaluationContext)
+	if err != nil {
+		name := fmt.Sprintf("%s/%s", rubyToS(evaluationContext.name), rubyToS(evaluationContext.index))
+		return bosherr.Errorf("Error filling in template '%s' for %s (%s)", srcPath, name, err.Error())
+	}
+
+	err = r.fs.WriteFileString(dstPath, result)
+	if err != nil {
+		return bosherr.WrapError(err, "Writing rendered template")
+	}
+
+	return nil
+}
+
+// templateError describes where rendering a template failed, e.g. 'line 3: #<NoMethodError: ...>'
+type templateError struct {
+	line int
+	err  error
+}
+
+func (e templateError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.line, e.err.Error())
+}
+
+func renderERB(template string, context *templateEvaluationContext) (string, error) {
+	segments, err := parseERB(template)
+	if err != nil {
+		return "", err
+	}
+
+	tokens, err := lexERBSegments(segments)
+	if err != nil {
+		return "", err
+	}
+
+	nodes, err := parseRubyTemplate(tokens)
+	if err != nil {
+		return "", err
+	}
+
+	interpreter := &rubyInterpreter{context: context}
+	_, err = interpreter.evalBody(nodes, newRubyScope(nil))
+	if err != nil {
+		switch typedErr := err.(type) {
+		case *rubyError:
+			return "", templateError{line: typedErr.line, err: typedErr}
+		case *unsupportedConstError:
+			return "", templateError{line: typedErr.line, err: typedErr}
+		case nextSignal:
+			return "", templateError{line: 0, err: newRubyError("SyntaxError", "%s", typedErr.Error())}
+		case returnSignal:
+			return "", templateError{line: 0, err: newRubyError("LocalJumpError", "%s", typedErr.Error())}
+		}
+		return "", err
+	}
+
+	return interpreter.output.String(), nil
+}
@@ -0,0 +1,366 @@
+package erbrenderer_test
+
+import (
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	boshlog "github.com/cloudfoundry/bosh-agent/logger"
+	fakesys "github.com/cloudfoundry/bosh-agent/system/fakes"
+	fakebierbrenderer "github.com/cloudfoundry/bosh-init/templatescompiler/erbrenderer/fakes"
+
+	. "github.com/cloudfoundry/bosh-init/templatescompiler/erbrenderer"
+)
+
+var _ = Describe("GoERBRenderer", func() {
+	var (
+		fs          *fakesys.FakeFileSystem
+		erbRenderer ERBRenderer
+		context     *fakebierbrenderer.FakeTemplateEvaluationContext
+	)
+
+	BeforeEach(func() {
+		logger := boshlog.NewLogger(boshlog.LevelNone)
+		fs = fakesys.NewFakeFileSystem()
+		context = &fakebierbrenderer.FakeTemplateEvaluationContext{
+			ContextJSON: `{
+				"job": {"name": "fake-job-name"},
+				"index": 0,
+				"deployment": "fake-deployment-name",
+				"networks": {
+					"default": {"ip": "10.0.0.2", "netmask": "255.255.255.0"}
+				},
+				"global_properties": {
+					"nested": {"value": "fake-global-value"},
+					"list": ["a", "b", "c"]
+				},
+				"cluster_properties": {
+					"tags": {"env": "prod", "team": "core"}
+				},
+				"default_properties": {
+					"port": 8080,
+					"ratio": 1.5,
+					"name": null,
+					"nested.value": "fake-default-value",
+					"nested.other": "fake-default-other",
+					"list": null,
+					"tags": null,
+					"ssl.enabled": false
+				}
+			}`,
+		}
+
+		erbRenderer = NewGoERBRenderer(fs, logger)
+	})
+
+	render := func(template string) (string, error) {
+		err := fs.WriteFileString("/fake-src-path", template)
+		Expect(err).ToNot(HaveOccurred())
+
+		err = erbRenderer.Render("/fake-src-path", "/fake-dst-path", context)
+		if err != nil {
+			return "", err
+		}
+
+		return fs.ReadFileString("/fake-dst-path")
+	}
+
+	expectRender := func(template string, expected string) {
+		rendered, err := render(template)
+		ExpectWithOffset(1, err).ToNot(HaveOccurred())
+		ExpectWithOffset(1, rendered).To(Equal(expected))
+	}
+
+	Describe("ERB tags", func() {
+		It("renders text and output tags", func() {
+			expectRender("port: <%= p('port') %>\n", "port: 8080\n")
+		})
+
+		It("does not render code and comment tags", func() {
+			expectRender("<% x = 1 %>a<%# comment %>b", "ab")
+		})
+
+		It("renders <%% as a literal tag", func() {
+			expectRender("<%% not code %>", "<% not code %>")
+		})
+
+		It("trims the newline after -%> and the indentation before <%-", func() {
+			expectRender("a\n  <%- if true -%>\nb\n  <%- end -%>\nc\n", "a\nb\nc\n")
+		})
+
+		It("renders nil as an empty string", func() {
+			expectRender("[<%= nil %>]", "[]")
+		})
+
+		It("renders the value of the last statement of an output tag", func() {
+			expectRender("<%= a = 1; b = a + 1; b * 2 %> <%= x = 'x'\nx * 3 %>", "4 xxx")
+		})
+	})
+
+	Describe("template evaluation context", func() {
+		It("returns the property from p", func() {
+			expectRender("<%= p('nested.value') %>", "fake-global-value")
+		})
+
+		It("returns the default of the job spec when the property is not set", func() {
+			expectRender("<%= p('nested.other') %>", "fake-default-other")
+		})
+
+		It("prefers cluster properties over global properties", func() {
+			expectRender("<%= p('tags.env') %>/<%= p('tags.team') %>", "prod/core")
+		})
+
+		It("returns the first property that is set when given a list of names", func() {
+			expectRender("<%= p(['name', 'port']) %>", "8080")
+		})
+
+		It("returns the given default when the property is not set", func() {
+			expectRender("<%= p('name', 'fake-default') %>", "fake-default")
+		})
+
+		It("returns false properties", func() {
+			expectRender("<%= p('ssl.enabled') %>", "false")
+		})
+
+		It("raises an error for unknown properties", func() {
+			_, err := render("line 1\n<%= p('unknown', nil) %>\n<%= p(['name', 'unknown']) %>")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("Error filling in template '/fake-src-path' for fake-job-name/0 (line 3: #<TemplateEvaluationContext::UnknownProperty: Can't find property 'name', or 'unknown'>)"))
+		})
+
+		It("yields the properties to if_p when all of them are set", func() {
+			expectRender("<% if_p('port', 'nested.value') do |port, value| %><%= port %>-<%= value %><% end %>", "8080-fake-global-value")
+		})
+
+		It("runs the else block of if_p when a property is not set", func() {
+			expectRender(
+				"<% if_p('name') do |name| %>set<% end.else do %>unset<% end %>",
+				"unset",
+			)
+		})
+
+		It("supports else_if_p", func() {
+			expectRender(
+				"<% if_p('name') do |name| %>name<% end.else_if_p('port') do |port| %><%= port %><% end.else do %>none<% end %>",
+				"8080",
+			)
+		})
+
+		It("exposes the spec as nested objects", func() {
+			expectRender(
+				"<%= spec.deployment %> <%= spec.job.name %> <%= spec.index %> <%= spec.networks.default.ip %> <%= spec.unknown.nil? %>",
+				"fake-deployment-name fake-job-name 0 10.0.0.2 true",
+			)
+		})
+
+		It("exposes properties as nested objects", func() {
+			expectRender("<%= properties.nested.value %> <%= properties.tags.env %>", "fake-global-value prod")
+		})
+
+		It("exposes name and index", func() {
+			expectRender("<%= name %>/<%= index %>", "fake-job-name/0")
+		})
+	})
+
+	Describe("ruby expressions", func() {
+		It("supports if, elsif, else and unless", func() {
+			expectRender(
+				"<% if p('port') > 9000 %>high<% elsif p('port') > 8000 %>medium<% else %>low<% end %><% unless p('ssl.enabled') %> plain<% end %>",
+				"medium plain",
+			)
+		})
+
+		It("supports statement modifiers and the ternary operator", func() {
+			expectRender("<%= 'a' if true %><%= 'b' unless true %><%= p('ssl.enabled') ? 'https' : 'http' %>", "ahttp")
+		})
+
+		It("supports case statements", func() {
+			expectRender(
+				"<% case p('port') %><% when 80, 443 %>web<% when 8000..8999 %>alt<% else %>other<% end %>",
+				"alt",
+			)
+		})
+
+		It("supports local variables, operators and integer division", func() {
+			expectRender(
+				"<% x = p('port') / 3; y = x % 7; x += 1 %><%= x %> <%= y %> <%= -7 / 2 %> <%= 2 ** 10 %> <%= p('ratio') * 2 %>",
+				"2694 5 -4 1024 3.0",
+			)
+		})
+
+		It("supports boolean operators", func() {
+			expectRender("<%= true && !false %> <%= nil || 'fallback' %> <%= (not true) or false %>", "true fallback false")
+		})
+
+		It("supports string interpolation and methods", func() {
+			expectRender(
+				`<%= "#{p('nested.value').upcase}:#{p('port') + 1}" %> <%= ' x '.strip.length %> <%= 'a,b,,c'.split(',').inspect %> <%= 'Hello'.gsub(/l+/, 'L').sub('H', 'J') %>`,
+				`FAKE-GLOBAL-VALUE:8081 1 ["a", "b", "", "c"] JeLo`,
+			)
+		})
+
+		It("supports ranges", func() {
+			expectRender(
+				"<% (1..3).each do |i| %><%= i %><% end %> <%= (0...3).to_a.inspect %> <%= 'abcdef'[1..-2] %>",
+				"123 [0, 1, 2] bcde",
+			)
+		})
+
+		It("supports arrays with blocks", func() {
+			expectRender(
+				"<%= p('list').map { |item| item.upcase }.join('-') %> <% p('list').each_with_index do |item, i| %><%= i %><% end %> <%= p('list').select { |item| item != 'b' }.inspect %> <%= p('list').map(&:to_sym).first.inspect %>",
+				`A-B-C 012 ["a", "c"] :a`,
+			)
+		})
+
+		It("supports hashes", func() {
+			expectRender(
+				"<% p('tags').sort.each do |key, value| %><%= key %>=<%= value %>;<% end %> <%= { 'a' => 1, b: [nil, 2.0] }.inspect %> <%= p('tags').keys.sort.join(',') %>",
+				`env=prod;team=core; {"a"=>1, :b=>[nil, 2.0]} env,team`,
+			)
+		})
+
+		It("supports next in blocks", func() {
+			expectRender("<% [1, 2, 3].each do |i| %><% next if i == 2 %><%= i %><% end %>", "13")
+		})
+
+		It("generates JSON", func() {
+			expectRender(
+				`<%= JSON.dump(p('tags')) %> <%= JSON.dump('value') %> <%= p('list').to_json %> <%= JSON.pretty_generate({ 'a' => [1] }) %>`,
+				"{\"env\":\"prod\",\"team\":\"core\"} \"value\" [\"a\",\"b\",\"c\"] {\n  \"a\": [\n    1\n  ]\n}",
+			)
+		})
+
+		It("supports format strings", func() {
+			expectRender(`<%= format('%05d-%s-%.2f', 42, 'x', 1.5) %> <%= '%s:%d' % ['host', 80] %>`, "00042-x-1.50 host:80")
+		})
+
+		It("supports methods defined in the template", func() {
+			expectRender(
+				"<% def address(host, port = 80)\n  return 'none' if host.nil?\n  \"#{host}:#{port}\"\nend\ndef wrap\n  block_given? ? \"[#{yield 'x'}]\" : '[]'\nend %><%= address('a') %> <%= address(nil) %> <%= wrap { |v| v * 2 } %> <%= wrap %>",
+				"a:80 none [xx] []",
+			)
+		})
+
+		It("supports rescue", func() {
+			expectRender(
+				"<%= Integer('x') rescue 'invalid' %> <% begin %><% p('unknown') %><% rescue ArgumentError %>argument<% rescue => e %><%= e.class %><% ensure %>!<% end %>",
+				"invalid TemplateEvaluationContext::UnknownProperty!",
+			)
+		})
+
+		It("supports iteration without a block and destructuring block parameters", func() {
+			expectRender(
+				"<%= p('list').each_with_index.map { |item, i| \"#{i}#{item}\" }.join %> <%= p('list').map.with_index(1) { |item, i| i }.inspect %> <%= p('tags').inject([]) { |memo, (key, value)| memo << key } %>",
+				`0a1b2c [1, 2, 3] ["env", "team"]`,
+			)
+		})
+
+		It("supports operator symbols and iteration methods without a block", func() {
+			expectRender(
+				"<%= [1, 2, 3].inject(:+) %> <%= [2, 3].reduce(1, :*) %> <%= 3.times.map { |i| i * 2 }.inspect %> <%= 'ab'.each_char.map(&:upcase).join('-') %> <%= true ? 1 :-1 %>",
+				`6 6 [0, 2, 4] A-B 1`,
+			)
+		})
+
+		It("supports heredocs", func() {
+			expectRender(
+				"<%= <<-EOS.strip\n  host: #{p('port')}\n  EOS\n%>|<%= <<~EOS\n    a\n      b\n    EOS\n%>|<% text = <<'EOS'\n#{raw}\nEOS\n%><%= text %>",
+				"host: 8080|a\n  b\n|#{raw}\n",
+			)
+		})
+
+		It("generates YAML", func() {
+			expectRender(
+				`<%= p('list').to_yaml %><%= { 'a' => { 'b' => [1, 'true'] }, :c => nil, 'd' => [{ 'e' => 'x: y' }], 'f' => [], 'g' => "1\n2" }.to_yaml %><%= YAML.dump('') %>`,
+				"---\n- a\n- b\n- c\n---\na:\n  b:\n  - 1\n  - 'true'\n:c:\nd:\n- e: 'x: y'\nf: []\ng: |-\n  1\n  2\n--- ''\n",
+			)
+		})
+
+		It("supports Time", func() {
+			expectRender(
+				"<% t = Time.at(1420167845).utc %><%= t %> <%= t.iso8601 %> <%= t.strftime('%Y%m%d %-H:%M:%S %b') %> <%= (t + 60).to_i %> <%= t.year %> <%= Time.now > t %>",
+				"2015-01-02 03:04:05 UTC 2015-01-02T03:04:05Z 20150102 3:04:05 Jan 1420167905 2015 true",
+			)
+		})
+
+		It("ignores require", func() {
+			expectRender("<% require 'json' %>ok", "ok")
+		})
+	})
+
+	Describe("errors", func() {
+		It("returns an error with the line of a failing method call", func() {
+			_, err := render("first\nsecond <%= p('name', nil).upcase %>")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("Error filling in template '/fake-src-path' for fake-job-name/0 (line 2: #<NoMethodError: undefined method `upcase' for nil:NilClass>)"))
+		})
+
+		It("returns an error raised by the template", func() {
+			_, err := render("<% raise 'fake-error' %>")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("(line 1: #<RuntimeError: fake-error>)"))
+		})
+
+		It("returns an error for syntax errors", func() {
+			_, err := render("<% if true %>\nunterminated")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Error filling in template '/fake-src-path' for fake-job-name/0 (line 1: syntax error, unexpected end of template, expecting 'end')"))
+		})
+
+		It("returns an error for unterminated heredocs", func() {
+			_, err := render("<% x = <<-EOS\nfoo\n%>")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("line 1: syntax error, can't find string \"EOS\" anywhere before EOF"))
+		})
+
+		It("returns an error for unclosed tags", func() {
+			_, err := render("a\n<%= p('port')")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Unclosed ERB tag on line 2"))
+		})
+
+		It("returns an error for undefined methods", func() {
+			_, err := render("<%= unknown_method %>")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("#<NameError: undefined local variable or method `unknown_method' for #<TemplateEvaluationContext>>"))
+		})
+
+		It("returns an error that points to the ruby engine for Base64, which is not supported", func() {
+			_, err := render("certificate\n<%= Base64.encode64(p('port').to_s) %>")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("(line 2: Base64 is not supported by the 'go' ERB renderer, set BOSH_INIT_ERB_RENDERER=ruby to render the templates with Ruby)"))
+		})
+
+		It("does not let the template rescue Base64 not being supported", func() {
+			_, err := render("<% begin %><%= Base64.encode64('fake-certificate') %><% rescue %>fallback<% end %>")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("BOSH_INIT_ERB_RENDERER=ruby"))
+		})
+
+		Context("when reading the template fails", func() {
+			It("returns an error", func() {
+				err := fs.WriteFileString("/fake-src-path", "content")
+				Expect(err).ToNot(HaveOccurred())
+				fs.ReadFileError = errors.New("fake-read-error")
+
+				err = erbRenderer.Render("/fake-src-path", "/fake-dst-path", context)
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("fake-read-error"))
+			})
+		})
+
+		Context("when writing the rendered template fails", func() {
+			It("returns an error", func() {
+				err := fs.WriteFileString("/fake-src-path", "content")
+				Expect(err).ToNot(HaveOccurred())
+				fs.WriteFileError = errors.New("fake-write-error")
+
+				err = erbRenderer.Render("/fake-src-path", "/fake-dst-path", context)
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("fake-write-error"))
+			})
+		})
+	})
+})
@@ -0,0 +1,295 @@
+package erbrenderer
+
+import (
+	"strings"
+
+	bosherr "github.com/cloudfoundry/bosh-agent/errors"
+)
+
+// templateEvaluationContext is the self of a template rendered by the go renderer.
+// It mirrors TemplateEvaluationContext of the ruby renderer script.
+type templateEvaluationContext struct {
+	name          interface{}
+	index         interface{}
+	properties    interface{}
+	rawProperties *rubyHash
+	spec          interface{}
+}
+
+type activeElseBlock struct {
+	context *templateEvaluationContext
+}
+
+type inactiveElseBlock struct{}
+
+func newTemplateEvaluationContext(contextJSON []byte) (*templateEvaluationContext, error) {
+	decoded, err := decodeJSON(contextJSON)
+	if err != nil {
+		return nil, bosherr.WrapError(err, "Parsing context")
+	}
+
+	spec, ok := decoded.(*rubyHash)
+	if !ok {
+		return nil, bosherr.Errorf("Expected context to be a hash, got '%s'", rubyClassName(decoded))
+	}
+
+	context := &templateEvaluationContext{}
+
+	if job, isHash := hashValue(spec, "job").(*rubyHash); isHash {
+		context.name = hashValue(job, "name")
+	}
+	context.index = hashValue(spec, "index")
+
+	globalProperties, _ := hashValue(spec, "global_properties").(*rubyHash)
+	if globalProperties == nil {
+		globalProperties = newRubyHash()
+	}
+	if clusterProperties, isHash := hashValue(spec, "cluster_properties").(*rubyHash); isHash {
+		recursiveMerge(globalProperties, clusterProperties)
+	}
+
+	properties := newRubyHash()
+	if defaultProperties, isHash := hashValue(spec, "default_properties").(*rubyHash); isHash {
+		for _, name := range defaultProperties.keys {
+			defaultValue, _ := defaultProperties.get(name)
+			copyProperty(properties, globalProperties, rubyToS(name), defaultValue)
+		}
+	}
+
+	context.properties = toOpenStruct(properties)
+	context.rawProperties = properties
+	context.spec = toOpenStruct(spec)
+
+	return context, nil
+}
+
+func hashValue(hash *rubyHash, key string) interface{} {
+	value, _ := hash.get(key)
+	return value
+}
+
+func recursiveMerge(dst *rubyHash, src *rubyHash) {
+	for _, key := range src.keys {
+		newValue, _ := src.get(key)
+		oldValue, _ := dst.get(key)
+
+		oldHash, oldIsHash := oldValue.(*rubyHash)
+		newHash, newIsHash := newValue.(*rubyHash)
+		if oldIsHash && newIsHash {
+			recursiveMerge(oldHash, newHash)
+			continue
+		}
+		dst.set(key, newValue)
+	}
+}
+
+// copyProperty copies the dotted property name from src into dst, using the default when src does not have it
+func copyProperty(dst *rubyHash, src *rubyHash, name string, defaultValue interface{}) {
+	keys := strings.Split(name, ".")
+
+	srcRef := lookupProperty(src, name)
+
+	dstRef := dst
+	for _, key := range keys[:len(keys)-1] {
+		next, isHash := hashValue(dstRef, key).(*rubyHash)
+		if !isHash {
+			next = newRubyHash()
+			dstRef.set(key, next)
+		}
+		dstRef = next
+	}
+
+	if srcRef == nil {
+		srcRef = defaultValue
+	}
+	dstRef.set(keys[len(keys)-1], srcRef)
+}
+
+func lookupProperty(collection *rubyHash, name string) interface{} {
+	var ref interface{} = collection
+	for _, key := range strings.Split(name, ".") {
+		hash, isHash := ref.(*rubyHash)
+		if !isHash {
+			return nil
+		}
+		ref = hashValue(hash, key)
+		if ref == nil {
+			return nil
+		}
+	}
+	return ref
+}
+
+func toOpenStruct(value interface{}) interface{} {
+	switch v := value.(type) {
+	case *rubyHash:
+		fields := newRubyHash()
+		for _, key := range v.keys {
+			element, _ := v.get(key)
+			fields.set(rubyToS(key), toOpenStruct(element))
+		}
+		return &openStruct{fields: fields}
+	case *rubyArray:
+		elements := make([]interface{}, len(v.elements))
+		for index, element := range v.elements {
+			elements[index] = toOpenStruct(element)
+		}
+		return newRubyArray(elements...)
+	}
+	return value
+}
+
+// p returns the first of the given properties that is set, the default or raises UnknownProperty
+func (c *templateEvaluationContext) p(args []interface{}) (interface{}, error) {
+	if err := checkArgs(args, 1, 2); err != nil {
+		return nil, err
+	}
+
+	names := []interface{}{args[0]}
+	if array, isArray := args[0].(*rubyArray); isArray {
+		names = array.elements
+	}
+
+	quotedNames := []string{}
+	for _, name := range names {
+		result := lookupProperty(c.rawProperties, rubyToS(name))
+		if result != nil {
+			return result, nil
+		}
+		quotedNames = append(quotedNames, rubyToS(name))
+	}
+
+	if len(args) == 2 {
+		return args[1], nil
+	}
+
+	return nil, newRubyError("TemplateEvaluationContext::UnknownProperty", "Can't find property '%s'", strings.Join(quotedNames, "', or '"))
+}
+
+// ifP yields the values of the properties when all of them are set
+func (i *rubyInterpreter) ifP(names []interface{}, block *rubyProc) (interface{}, error) {
+	values := []interface{}{}
+	for _, name := range names {
+		value := lookupProperty(i.context.rawProperties, rubyToS(name))
+		if value == nil {
+			return &activeElseBlock{context: i.context}, nil
+		}
+		values = append(values, value)
+	}
+
+	_, err := i.callBlock(block, values...)
+	if err != nil {
+		return nil, err
+	}
+	return inactiveElseBlock{}, nil
+}
+
+// callFunction calls a method without an explicit receiver, i.e. a method of the template evaluation context or Kernel
+func (i *rubyInterpreter) callFunction(name string, args []interface{}, block *rubyProc) (interface{}, error) {
+	c := i.context
+
+	switch name {
+	case "p":
+		return c.p(args)
+	case "if_p":
+		return i.ifP(args, block)
+	case "spec", "properties", "raw_properties", "name", "index":
+		if err := checkArgs(args, 0, 0); err != nil {
+			return nil, err
+		}
+		switch name {
+		case "spec":
+			return c.spec, nil
+		case "properties":
+			return c.properties, nil
+		case "raw_properties":
+			return c.rawProperties, nil
+		case "name":
+			return c.name, nil
+		}
+		return c.index, nil
+	case "require":
+		return true, nil
+	case "raise", "fail":
+		if err := checkArgs(args, 0, 2); err != nil {
+			return nil, err
+		}
+		switch len(args) {
+		case 0:
+			return nil, newRubyError("RuntimeError", "unhandled exception")
+		case 1:
+			if raised, isError := args[0].(*rubyError); isError {
+				return nil, raised
+			}
+			return nil, newRubyError("RuntimeError", "%s", rubyToS(args[0]))
+		}
+		return nil, newRubyError(rubyToS(args[0]), "%s", rubyToS(args[1]))
+	case "format", "sprintf":
+		if err := checkArgs(args, 1, -1); err != nil {
+			return nil, err
+		}
+		format, err := stringArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		return rubySprintf(format, args[1:])
+	case "Integer", "Float", "String", "Array":
+		if err := checkArgs(args, 1, 1); err != nil {
+			return nil, err
+		}
+		return convert(name, args[0])
+	case "lambda", "proc":
+		if block == nil {
+			return nil, newRubyError("ArgumentError", "tried to create Proc object without a block")
+		}
+		return block, nil
+	case "puts", "print":
+		// like the ruby renderer, output that is not part of the template is not rendered
+		return nil, nil
+	case "loop":
+		for {
+			_, err := i.callBlock(block)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(args) == 0 && block == nil {
+		return nil, newRubyError("NameError", "undefined local variable or method `%s' for #<TemplateEvaluationContext>", name)
+	}
+	return nil, noMethodError(name, c)
+}
+
+// convert implements the Integer(), Float(), String() and Array() conversion functions
+func convert(name string, value interface{}) (interface{}, error) {
+	switch name {
+	case "Integer":
+		return formatInteger(value)
+	case "Float":
+		switch v := value.(type) {
+		case int64, float64:
+			float, _ := toFloat(v)
+			return float, nil
+		case string:
+			float := parseLeadingFloat(v)
+			if leadingFloatRegexp.FindString(v) != v {
+				return nil, newRubyError("ArgumentError", "invalid value for Float(): %s", rubyInspect(v))
+			}
+			return float, nil
+		}
+		return nil, newRubyError("TypeError", "can't convert %s into Float", rubyClassName(value))
+	case "String":
+		return rubyToS(value), nil
+	}
+
+	switch v := value.(type) {
+	case nil:
+		return newRubyArray(), nil
+	case *rubyArray:
+		return v, nil
+	case *rubyHash:
+		return newRubyArray(v.pairs()...), nil
+	}
+	return newRubyArray(value), nil
+}
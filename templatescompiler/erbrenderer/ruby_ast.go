@@ -0,0 +1,216 @@
+package erbrenderer
+
+import (
+	"regexp"
+)
+
+// rubyNode is a node of the syntax tree of the Ruby subset supported in job templates
+type rubyNode interface {
+	lineNumber() int
+}
+
+type nodeLine int
+
+func (l nodeLine) lineNumber() int { return int(l) }
+
+type textNode struct {
+	nodeLine
+	text string
+}
+
+type outputNode struct {
+	nodeLine
+	value rubyNode
+}
+
+type literalNode struct {
+	nodeLine
+	value interface{}
+}
+
+type stringNode struct {
+	nodeLine
+	parts []rubyNode
+}
+
+type regexpNode struct {
+	nodeLine
+	re     *regexp.Regexp
+	source string
+}
+
+type arrayNode struct {
+	nodeLine
+	elements []rubyNode
+}
+
+type hashNode struct {
+	nodeLine
+	keys   []rubyNode
+	values []rubyNode
+}
+
+type rangeNode struct {
+	nodeLine
+	from      rubyNode
+	to        rubyNode
+	exclusive bool
+}
+
+type selfNode struct {
+	nodeLine
+}
+
+type variableNode struct {
+	nodeLine
+	name string
+}
+
+type constNode struct {
+	nodeLine
+	name string
+}
+
+// callNode is a method call. A nil receiver calls a method of the template evaluation context.
+type callNode struct {
+	nodeLine
+	receiver rubyNode
+	name     string
+	args     []rubyNode
+	block    *blockNode
+}
+
+type blockNode struct {
+	nodeLine
+	params []blockParam
+	body   []rubyNode
+}
+
+// blockParam is a block parameter, a parameter in parentheses such as |(key, value), index| destructures an array
+type blockParam struct {
+	name   string
+	nested []string
+}
+
+// blockPassNode is the &:method argument of a call
+type blockPassNode struct {
+	nodeLine
+	method string
+}
+
+type assignNode struct {
+	nodeLine
+	name  string
+	value rubyNode
+}
+
+type opAssignNode struct {
+	nodeLine
+	target rubyNode
+	op     string
+	value  rubyNode
+}
+
+type indexAssignNode struct {
+	nodeLine
+	receiver rubyNode
+	args     []rubyNode
+	value    rubyNode
+}
+
+type andNode struct {
+	nodeLine
+	left  rubyNode
+	right rubyNode
+}
+
+type orNode struct {
+	nodeLine
+	left  rubyNode
+	right rubyNode
+}
+
+type notNode struct {
+	nodeLine
+	value rubyNode
+}
+
+type ifNode struct {
+	nodeLine
+	condition rubyNode
+	then      []rubyNode
+	otherwise []rubyNode
+}
+
+type whileNode struct {
+	nodeLine
+	condition rubyNode
+	until     bool
+	body      []rubyNode
+}
+
+type caseNode struct {
+	nodeLine
+	subject   rubyNode
+	whens     []whenClause
+	otherwise []rubyNode
+}
+
+type whenClause struct {
+	values []rubyNode
+	body   []rubyNode
+}
+
+type forNode struct {
+	nodeLine
+	vars       []string
+	collection rubyNode
+	body       []rubyNode
+}
+
+type nextNode struct {
+	nodeLine
+	value rubyNode
+}
+
+type beginNode struct {
+	nodeLine
+	body []rubyNode
+}
+
+// rescueNode evaluates the first rescue clause matching an exception raised by the body
+type rescueNode struct {
+	nodeLine
+	body       []rubyNode
+	clauses    []rescueClause
+	ensureBody []rubyNode
+}
+
+// rescueClause rescues exceptions of the classes, any StandardError when no classes are given
+type rescueClause struct {
+	classes  []rubyNode
+	variable string
+	body     []rubyNode
+}
+
+type defNode struct {
+	nodeLine
+	name   string
+	params []methodParam
+	body   []rubyNode
+}
+
+type methodParam struct {
+	name         string
+	defaultValue rubyNode
+}
+
+type returnNode struct {
+	nodeLine
+	value rubyNode
+}
+
+type yieldNode struct {
+	nodeLine
+	args []rubyNode
+}
@@ -0,0 +1,1374 @@
+package erbrenderer
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// enumerableMethod implements the Enumerable methods over the elements yielded by each
+func (i *rubyInterpreter) enumerableMethod(receiver interface{}, elements []interface{}, name string, args []interface{}, block *rubyProc) (interface{}, error) {
+	// without a block the iterating methods return an array in place of an enumerator, e.g. for each_with_index.map
+	if block == nil {
+		switch name {
+		case "each", "each_entry", "map", "collect", "select", "filter", "reject", "flat_map", "collect_concat", "filter_map":
+			if err := checkArgs(args, 0, 0); err != nil {
+				return nil, err
+			}
+			return newRubyArray(append([]interface{}{}, elements...)...), nil
+		case "each_with_index":
+			return i.enumerableMethod(receiver, elements, "with_index", args, nil)
+		}
+	}
+
+	switch name {
+	case "each", "each_entry":
+		for _, element := range elements {
+			_, err := i.callBlock(block, element)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return receiver, nil
+	case "reverse_each":
+		for index := len(elements) - 1; index >= 0; index-- {
+			_, err := i.callBlock(block, elements[index])
+			if err != nil {
+				return nil, err
+			}
+		}
+		return receiver, nil
+	case "each_with_index":
+		for index, element := range elements {
+			_, err := i.callBlock(block, element, int64(index))
+			if err != nil {
+				return nil, err
+			}
+		}
+		return receiver, nil
+	case "with_index":
+		if err := checkArgs(args, 0, 1); err != nil {
+			return nil, err
+		}
+		offset := int64(0)
+		if len(args) == 1 {
+			var err error
+			offset, err = toInt(args[0])
+			if err != nil {
+				return nil, err
+			}
+		}
+		result := newRubyArray()
+		for index, element := range elements {
+			var value interface{} = newRubyArray(element, int64(index)+offset)
+			if block != nil {
+				var err error
+				value, err = i.callBlock(block, element, int64(index)+offset)
+				if err != nil {
+					return nil, err
+				}
+			}
+			result.elements = append(result.elements, value)
+		}
+		return result, nil
+	case "each_with_object":
+		if err := checkArgs(args, 1, 1); err != nil {
+			return nil, err
+		}
+		for _, element := range elements {
+			_, err := i.callBlock(block, element, args[0])
+			if err != nil {
+				return nil, err
+			}
+		}
+		return args[0], nil
+	case "each_slice":
+		if err := checkArgs(args, 1, 1); err != nil {
+			return nil, err
+		}
+		size, err := toInt(args[0])
+		if err != nil {
+			return nil, err
+		}
+		if size <= 0 {
+			return nil, newRubyError("ArgumentError", "invalid slice size")
+		}
+		slices := newRubyArray()
+		for start := 0; start < len(elements); start += int(size) {
+			end := start + int(size)
+			if end > len(elements) {
+				end = len(elements)
+			}
+			slices.elements = append(slices.elements, newRubyArray(append([]interface{}{}, elements[start:end]...)...))
+		}
+		if block == nil {
+			return slices, nil
+		}
+		return nil, i.yieldEach(block, slices.elements)
+	case "map", "collect", "flat_map", "collect_concat", "filter_map":
+		result := newRubyArray()
+		for _, element := range elements {
+			value, err := i.callBlock(block, element)
+			if err != nil {
+				return nil, err
+			}
+			switch {
+			case name == "filter_map":
+				if truthy(value) {
+					result.elements = append(result.elements, value)
+				}
+			case name == "flat_map" || name == "collect_concat":
+				if array, isArray := value.(*rubyArray); isArray {
+					result.elements = append(result.elements, array.elements...)
+				} else {
+					result.elements = append(result.elements, value)
+				}
+			default:
+				result.elements = append(result.elements, value)
+			}
+		}
+		return result, nil
+	case "select", "filter", "reject", "partition":
+		selected, rejected := newRubyArray(), newRubyArray()
+		for _, element := range elements {
+			value, err := i.callBlock(block, element)
+			if err != nil {
+				return nil, err
+			}
+			if truthy(value) {
+				selected.elements = append(selected.elements, element)
+			} else {
+				rejected.elements = append(rejected.elements, element)
+			}
+		}
+		switch name {
+		case "reject":
+			return rejected, nil
+		case "partition":
+			return newRubyArray(selected, rejected), nil
+		}
+		return selected, nil
+	case "find", "detect", "find_index":
+		for index, element := range elements {
+			var matched bool
+			if name == "find_index" && len(args) == 1 {
+				matched = rubyEqual(element, args[0])
+			} else {
+				value, err := i.callBlock(block, element)
+				if err != nil {
+					return nil, err
+				}
+				matched = truthy(value)
+			}
+			if matched {
+				if name == "find_index" {
+					return int64(index), nil
+				}
+				return element, nil
+			}
+		}
+		return nil, nil
+	case "any?", "all?", "none?", "one?":
+		count := 0
+		for _, element := range elements {
+			value := element
+			switch {
+			case len(args) == 1:
+				value = caseEqual(args[0], element)
+			case block != nil:
+				var err error
+				value, err = i.callBlock(block, element)
+				if err != nil {
+					return nil, err
+				}
+			}
+			if truthy(value) {
+				count++
+			}
+		}
+		switch name {
+		case "any?":
+			return count > 0, nil
+		case "all?":
+			return count == len(elements), nil
+		case "none?":
+			return count == 0, nil
+		}
+		return count == 1, nil
+	case "count":
+		if len(args) == 0 && block == nil {
+			return int64(len(elements)), nil
+		}
+		count := int64(0)
+		for _, element := range elements {
+			var matched bool
+			if len(args) == 1 {
+				matched = rubyEqual(element, args[0])
+			} else {
+				value, err := i.callBlock(block, element)
+				if err != nil {
+					return nil, err
+				}
+				matched = truthy(value)
+			}
+			if matched {
+				count++
+			}
+		}
+		return count, nil
+	case "first", "take":
+		if len(args) == 0 && name == "first" {
+			if len(elements) == 0 {
+				return nil, nil
+			}
+			return elements[0], nil
+		}
+		if err := checkArgs(args, 1, 1); err != nil {
+			return nil, err
+		}
+		count, err := toInt(args[0])
+		if err != nil {
+			return nil, err
+		}
+		if count < 0 {
+			return nil, newRubyError("ArgumentError", "negative array size")
+		}
+		if int(count) > len(elements) {
+			count = int64(len(elements))
+		}
+		return newRubyArray(append([]interface{}{}, elements[:count]...)...), nil
+	case "drop":
+		if err := checkArgs(args, 1, 1); err != nil {
+			return nil, err
+		}
+		count, err := toInt(args[0])
+		if err != nil {
+			return nil, err
+		}
+		if int(count) > len(elements) {
+			count = int64(len(elements))
+		}
+		return newRubyArray(append([]interface{}{}, elements[count:]...)...), nil
+	case "take_while", "drop_while":
+		index := 0
+		for ; index < len(elements); index++ {
+			value, err := i.callBlock(block, elements[index])
+			if err != nil {
+				return nil, err
+			}
+			if !truthy(value) {
+				break
+			}
+		}
+		if name == "take_while" {
+			return newRubyArray(append([]interface{}{}, elements[:index]...)...), nil
+		}
+		return newRubyArray(append([]interface{}{}, elements[index:]...)...), nil
+	case "min", "max":
+		var result interface{}
+		for index, element := range elements {
+			if index == 0 {
+				result = element
+				continue
+			}
+			var c int
+			if block != nil {
+				value, err := i.callBlock(block, element, result)
+				if err != nil {
+					return nil, err
+				}
+				comparison, err := toInt(value)
+				if err != nil {
+					return nil, err
+				}
+				c = int(comparison)
+			} else {
+				c = compare(element, result)
+				if c == incomparable {
+					return nil, newRubyError("ArgumentError", "comparison of %s with %s failed", rubyClassName(element), rubyInspect(result))
+				}
+			}
+			if (name == "min" && c < 0) || (name == "max" && c > 0) {
+				result = element
+			}
+		}
+		return result, nil
+	case "min_by", "max_by", "sort_by":
+		keys := make([]interface{}, len(elements))
+		for index, element := range elements {
+			key, err := i.callBlock(block, element)
+			if err != nil {
+				return nil, err
+			}
+			keys[index] = newRubyArray(key, int64(index))
+		}
+		err := sortValues(keys, func(a, b interface{}) (bool, error) {
+			return sortByComparison(a.(*rubyArray).elements[0], b.(*rubyArray).elements[0])
+		})
+		if err != nil {
+			return nil, err
+		}
+		sorted := newRubyArray()
+		for _, key := range keys {
+			sorted.elements = append(sorted.elements, elements[key.(*rubyArray).elements[1].(int64)])
+		}
+		switch name {
+		case "min_by":
+			return i.enumerableMethod(sorted, sorted.elements, "first", nil, nil)
+		case "max_by":
+			if len(sorted.elements) == 0 {
+				return nil, nil
+			}
+			return sorted.elements[len(sorted.elements)-1], nil
+		}
+		return sorted, nil
+	case "sort":
+		sorted := append([]interface{}{}, elements...)
+		err := sortValues(sorted, func(a, b interface{}) (bool, error) {
+			if block == nil {
+				return sortByComparison(a, b)
+			}
+			value, err := i.callBlock(block, a, b)
+			if err != nil {
+				return false, err
+			}
+			c, err := toInt(value)
+			return c < 0, err
+		})
+		return newRubyArray(sorted...), err
+	case "group_by":
+		groups := newRubyHash()
+		for _, element := range elements {
+			key, err := i.callBlock(block, element)
+			if err != nil {
+				return nil, err
+			}
+			group, found := groups.get(key)
+			if !found {
+				group = newRubyArray()
+				err = groups.set(key, group)
+				if err != nil {
+					return nil, err
+				}
+			}
+			group.(*rubyArray).elements = append(group.(*rubyArray).elements, element)
+		}
+		return groups, nil
+	case "inject", "reduce", "sum":
+		var accumulator interface{}
+		start := 0
+		operator := ""
+		switch {
+		case name == "sum":
+			accumulator = int64(0)
+			if len(args) == 1 {
+				accumulator = args[0]
+			}
+			operator = "+"
+		case len(args) == 2:
+			accumulator = args[0]
+			operator = rubyToS(args[1])
+		case len(args) == 1 && block == nil:
+			operator = rubyToS(args[0])
+			if len(elements) > 0 {
+				accumulator = elements[0]
+				start = 1
+			}
+		case len(args) == 1:
+			accumulator = args[0]
+		case len(elements) > 0:
+			accumulator = elements[0]
+			start = 1
+		}
+		for _, element := range elements[start:] {
+			var err error
+			switch {
+			case name == "sum" && block != nil:
+				element, err = i.callBlock(block, element)
+				if err == nil {
+					accumulator, err = i.callMethod(accumulator, operator, []interface{}{element}, nil)
+				}
+			case operator != "":
+				accumulator, err = i.callMethod(accumulator, operator, []interface{}{element}, nil)
+			default:
+				accumulator, err = i.callBlock(block, accumulator, element)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		return accumulator, nil
+	case "include?", "member?":
+		if err := checkArgs(args, 1, 1); err != nil {
+			return nil, err
+		}
+		for _, element := range elements {
+			if rubyEqual(element, args[0]) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "to_a", "entries":
+		return newRubyArray(append([]interface{}{}, elements...)...), nil
+	case "to_h":
+		hash := newRubyHash()
+		for _, element := range elements {
+			pair := element
+			if block != nil {
+				var err error
+				pair, err = i.callBlock(block, element)
+				if err != nil {
+					return nil, err
+				}
+			}
+			array, isArray := pair.(*rubyArray)
+			if !isArray || len(array.elements) != 2 {
+				return nil, newRubyError("TypeError", "wrong element type %s (expected array)", rubyClassName(pair))
+			}
+			err := hash.set(array.elements[0], array.elements[1])
+			if err != nil {
+				return nil, err
+			}
+		}
+		return hash, nil
+	case "uniq":
+		result := newRubyArray()
+		seen := []interface{}{}
+		for _, element := range elements {
+			key := element
+			if block != nil {
+				var err error
+				key, err = i.callBlock(block, element)
+				if err != nil {
+					return nil, err
+				}
+			}
+			duplicate := false
+			for _, existing := range seen {
+				if rubyEqual(existing, key) {
+					duplicate = true
+					break
+				}
+			}
+			if !duplicate {
+				seen = append(seen, key)
+				result.elements = append(result.elements, element)
+			}
+		}
+		return result, nil
+	case "zip":
+		result := newRubyArray()
+		for index, element := range elements {
+			tuple := newRubyArray(element)
+			for _, arg := range args {
+				other, isArray := arg.(*rubyArray)
+				if !isArray {
+					return nil, newRubyError("TypeError", "wrong argument type %s (must respond to :each)", rubyClassName(arg))
+				}
+				var value interface{}
+				if index < len(other.elements) {
+					value = other.elements[index]
+				}
+				tuple.elements = append(tuple.elements, value)
+			}
+			result.elements = append(result.elements, tuple)
+		}
+		return result, nil
+	}
+	return nil, errMethodMissing
+}
+
+func (i *rubyInterpreter) yieldEach(block *rubyProc, elements []interface{}) error {
+	for _, element := range elements {
+		_, err := i.callBlock(block, element)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (i *rubyInterpreter) arrayMethod(receiver *rubyArray, name string, args []interface{}, block *rubyProc) (interface{}, error) {
+	elements := receiver.elements
+
+	switch name {
+	case "length", "size":
+		return int64(len(elements)), nil
+	case "empty?":
+		return len(elements) == 0, nil
+	case "any?":
+		if len(args) == 0 && block == nil {
+			for _, element := range elements {
+				if truthy(element) {
+					return true, nil
+				}
+			}
+			return false, nil
+		}
+	case "[]", "slice":
+		start, end, isSlice, ok, err := sliceBounds(args, len(elements))
+		if err != nil || !ok {
+			return nil, err
+		}
+		if isSlice {
+			return newRubyArray(append([]interface{}{}, elements[start:end]...)...), nil
+		}
+		return elements[start], nil
+	case "[]=":
+		if err := checkArgs(args, 2, 2); err != nil {
+			return nil, err
+		}
+		index, err := toInt(args[0])
+		if err != nil {
+			return nil, err
+		}
+		if index < 0 {
+			index += int64(len(elements))
+			if index < 0 {
+				return nil, newRubyError("IndexError", "index %d too small for array", index-int64(len(elements)))
+			}
+		}
+		for int(index) >= len(receiver.elements) {
+			receiver.elements = append(receiver.elements, nil)
+		}
+		receiver.elements[index] = args[1]
+		return args[1], nil
+	case "fetch":
+		if err := checkArgs(args, 1, 2); err != nil {
+			return nil, err
+		}
+		index, err := toInt(args[0])
+		if err != nil {
+			return nil, err
+		}
+		position, ok := normalizeIndex(index, len(elements))
+		if ok && position < len(elements) {
+			return elements[position], nil
+		}
+		if block != nil {
+			return i.callBlock(block, args[0])
+		}
+		if len(args) == 2 {
+			return args[1], nil
+		}
+		return nil, newRubyError("IndexError", "index %d outside of array bounds: %d...%d", index, -len(elements), len(elements))
+	case "dig":
+		return dig(receiver, args)
+	case "values_at":
+		result := newRubyArray()
+		for _, arg := range args {
+			value, err := i.arrayMethod(receiver, "[]", []interface{}{arg}, nil)
+			if err != nil {
+				return nil, err
+			}
+			result.elements = append(result.elements, value)
+		}
+		return result, nil
+	case "last":
+		if len(args) == 0 {
+			if len(elements) == 0 {
+				return nil, nil
+			}
+			return elements[len(elements)-1], nil
+		}
+		count, err := toInt(args[0])
+		if err != nil {
+			return nil, err
+		}
+		if int(count) > len(elements) {
+			count = int64(len(elements))
+		}
+		return newRubyArray(append([]interface{}{}, elements[len(elements)-int(count):]...)...), nil
+	case "push", "append", "<<":
+		if name == "<<" {
+			if err := checkArgs(args, 1, 1); err != nil {
+				return nil, err
+			}
+		}
+		receiver.elements = append(receiver.elements, args...)
+		return receiver, nil
+	case "unshift", "prepend":
+		receiver.elements = append(append([]interface{}{}, args...), elements...)
+		return receiver, nil
+	case "pop", "shift":
+		if len(elements) == 0 {
+			return nil, nil
+		}
+		if name == "pop" {
+			receiver.elements = elements[:len(elements)-1]
+			return elements[len(elements)-1], nil
+		}
+		receiver.elements = elements[1:]
+		return elements[0], nil
+	case "concat":
+		for _, arg := range args {
+			other, isArray := arg.(*rubyArray)
+			if !isArray {
+				return nil, newRubyError("TypeError", "no implicit conversion of %s into Array", rubyClassName(arg))
+			}
+			receiver.elements = append(receiver.elements, other.elements...)
+		}
+		return receiver, nil
+	case "delete":
+		if err := checkArgs(args, 1, 1); err != nil {
+			return nil, err
+		}
+		var deleted interface{}
+		kept := []interface{}{}
+		for _, element := range elements {
+			if rubyEqual(element, args[0]) {
+				deleted = element
+			} else {
+				kept = append(kept, element)
+			}
+		}
+		receiver.elements = kept
+		return deleted, nil
+	case "+", "-", "&", "|":
+		if err := checkArgs(args, 1, 1); err != nil {
+			return nil, err
+		}
+		other, isArray := args[0].(*rubyArray)
+		if !isArray {
+			return nil, newRubyError("TypeError", "no implicit conversion of %s into Array", rubyClassName(args[0]))
+		}
+		return arraySetOperation(receiver, name, other), nil
+	case "*":
+		if err := checkArgs(args, 1, 1); err != nil {
+			return nil, err
+		}
+		if separator, isString := args[0].(string); isString {
+			return joinArray(receiver, separator), nil
+		}
+		count, err := toInt(args[0])
+		if err != nil {
+			return nil, err
+		}
+		result := newRubyArray()
+		for n := int64(0); n < count; n++ {
+			result.elements = append(result.elements, elements...)
+		}
+		return result, nil
+	case "join":
+		if err := checkArgs(args, 0, 1); err != nil {
+			return nil, err
+		}
+		separator := ""
+		if len(args) == 1 && args[0] != nil {
+			var err error
+			separator, err = stringArg(args, 0)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return joinArray(receiver, separator), nil
+	case "compact":
+		result := newRubyArray()
+		for _, element := range elements {
+			if element != nil {
+				result.elements = append(result.elements, element)
+			}
+		}
+		return result, nil
+	case "flatten":
+		depth := int64(-1)
+		if len(args) == 1 {
+			var err error
+			depth, err = toInt(args[0])
+			if err != nil {
+				return nil, err
+			}
+		}
+		return newRubyArray(flatten(elements, depth)...), nil
+	case "reverse":
+		result := newRubyArray()
+		for index := len(elements) - 1; index >= 0; index-- {
+			result.elements = append(result.elements, elements[index])
+		}
+		return result, nil
+	case "index", "find_index":
+		return i.enumerableMethod(receiver, elements, "find_index", args, block)
+	case "rotate":
+		if len(elements) == 0 {
+			return newRubyArray(), nil
+		}
+		count := int64(1)
+		if len(args) == 1 {
+			var err error
+			count, err = toInt(args[0])
+			if err != nil {
+				return nil, err
+			}
+		}
+		shift := int(((count % int64(len(elements))) + int64(len(elements))) % int64(len(elements)))
+		return newRubyArray(append(append([]interface{}{}, elements[shift:]...), elements[:shift]...)...), nil
+	case "transpose":
+		result := newRubyArray()
+		for row, element := range elements {
+			array, isArray := element.(*rubyArray)
+			if !isArray {
+				return nil, newRubyError("TypeError", "no implicit conversion of %s into Array", rubyClassName(element))
+			}
+			for column, value := range array.elements {
+				if row == 0 {
+					result.elements = append(result.elements, newRubyArray())
+				}
+				if column >= len(result.elements) {
+					return nil, newRubyError("IndexError", "element size differs")
+				}
+				result.elements[column].(*rubyArray).elements = append(result.elements[column].(*rubyArray).elements, value)
+			}
+		}
+		return result, nil
+	case "map!", "collect!", "select!", "reject!", "sort!", "uniq!", "compact!", "flatten!", "reverse!", "sort_by!", "shuffle":
+		base := strings.TrimSuffix(name, "!")
+		if name == "shuffle" {
+			base = "to_a"
+		}
+		result, err := i.arrayMethod(receiver, base, args, block)
+		if err != nil {
+			return nil, err
+		}
+		receiver.elements = result.(*rubyArray).elements
+		return receiver, nil
+	case "to_a", "entries":
+		return receiver, nil
+	}
+
+	return i.enumerableMethod(receiver, elements, name, args, block)
+}
+
+func arraySetOperation(left *rubyArray, op string, right *rubyArray) *rubyArray {
+	contains := func(elements []interface{}, value interface{}) bool {
+		for _, element := range elements {
+			if rubyEqual(element, value) {
+				return true
+			}
+		}
+		return false
+	}
+
+	result := newRubyArray()
+	switch op {
+	case "+":
+		result.elements = append(append(result.elements, left.elements...), right.elements...)
+	case "-":
+		for _, element := range left.elements {
+			if !contains(right.elements, element) {
+				result.elements = append(result.elements, element)
+			}
+		}
+	case "&":
+		for _, element := range left.elements {
+			if contains(right.elements, element) && !contains(result.elements, element) {
+				result.elements = append(result.elements, element)
+			}
+		}
+	case "|":
+		for _, element := range append(append([]interface{}{}, left.elements...), right.elements...) {
+			if !contains(result.elements, element) {
+				result.elements = append(result.elements, element)
+			}
+		}
+	}
+	return result
+}
+
+func joinArray(array *rubyArray, separator string) string {
+	parts := make([]string, len(array.elements))
+	for index, element := range array.elements {
+		if nested, isArray := element.(*rubyArray); isArray {
+			parts[index] = joinArray(nested, separator)
+		} else {
+			parts[index] = rubyToS(element)
+		}
+	}
+	return strings.Join(parts, separator)
+}
+
+func flatten(elements []interface{}, depth int64) []interface{} {
+	result := []interface{}{}
+	for _, element := range elements {
+		if nested, isArray := element.(*rubyArray); isArray && depth != 0 {
+			result = append(result, flatten(nested.elements, depth-1)...)
+		} else {
+			result = append(result, element)
+		}
+	}
+	return result
+}
+
+func dig(value interface{}, keys []interface{}) (interface{}, error) {
+	for _, key := range keys {
+		switch v := value.(type) {
+		case nil:
+			return nil, nil
+		case *rubyHash:
+			value, _ = v.get(key)
+		case *openStruct:
+			value, _ = v.fields.get(rubyToS(key))
+		case *rubyArray:
+			index, err := toInt(key)
+			if err != nil {
+				return nil, err
+			}
+			position, ok := normalizeIndex(index, len(v.elements))
+			if !ok || position >= len(v.elements) {
+				return nil, nil
+			}
+			value = v.elements[position]
+		default:
+			return nil, newRubyError("TypeError", "%s does not have #dig method", rubyClassName(value))
+		}
+	}
+	return value, nil
+}
+
+func (i *rubyInterpreter) hashMethod(receiver *rubyHash, name string, args []interface{}, block *rubyProc) (interface{}, error) {
+	switch name {
+	case "[]":
+		if err := checkArgs(args, 1, 1); err != nil {
+			return nil, err
+		}
+		value, found := receiver.get(args[0])
+		if !found {
+			return receiver.defaultValue, nil
+		}
+		return value, nil
+	case "[]=", "store":
+		if err := checkArgs(args, 2, 2); err != nil {
+			return nil, err
+		}
+		return args[1], receiver.set(args[0], args[1])
+	case "fetch":
+		if err := checkArgs(args, 1, 2); err != nil {
+			return nil, err
+		}
+		value, found := receiver.get(args[0])
+		switch {
+		case found:
+			return value, nil
+		case block != nil:
+			return i.callBlock(block, args[0])
+		case len(args) == 2:
+			return args[1], nil
+		}
+		return nil, newRubyError("KeyError", "key not found: %s", rubyInspect(args[0]))
+	case "dig":
+		return dig(receiver, args)
+	case "key?", "has_key?", "include?", "member?":
+		if err := checkArgs(args, 1, 1); err != nil {
+			return nil, err
+		}
+		_, found := receiver.get(args[0])
+		return found, nil
+	case "value?", "has_value?":
+		if err := checkArgs(args, 1, 1); err != nil {
+			return nil, err
+		}
+		for _, key := range receiver.keys {
+			value, _ := receiver.get(key)
+			if rubyEqual(value, args[0]) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "key":
+		if err := checkArgs(args, 1, 1); err != nil {
+			return nil, err
+		}
+		for _, key := range receiver.keys {
+			value, _ := receiver.get(key)
+			if rubyEqual(value, args[0]) {
+				return key, nil
+			}
+		}
+		return nil, nil
+	case "keys":
+		return newRubyArray(append([]interface{}{}, receiver.keys...)...), nil
+	case "values":
+		values := newRubyArray()
+		for _, key := range receiver.keys {
+			value, _ := receiver.get(key)
+			values.elements = append(values.elements, value)
+		}
+		return values, nil
+	case "values_at":
+		values := newRubyArray()
+		for _, key := range args {
+			value, _ := receiver.get(key)
+			values.elements = append(values.elements, value)
+		}
+		return values, nil
+	case "length", "size":
+		return int64(receiver.length()), nil
+	case "empty?":
+		return receiver.length() == 0, nil
+	case "each_pair":
+		return i.enumerableMethod(receiver, receiver.pairs(), "each", args, block)
+	case "each_key", "each_value":
+		for _, key := range receiver.keys {
+			value := key
+			if name == "each_value" {
+				value, _ = receiver.get(key)
+			}
+			_, err := i.callBlock(block, value)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return receiver, nil
+	case "select", "filter", "reject", "compact":
+		result := newRubyHash()
+		for _, key := range receiver.keys {
+			value, _ := receiver.get(key)
+			var keep bool
+			if name == "compact" {
+				keep = value != nil
+			} else {
+				selected, err := i.callBlock(block, key, value)
+				if err != nil {
+					return nil, err
+				}
+				keep = truthy(selected) == (name != "reject")
+			}
+			if keep {
+				result.set(key, value)
+			}
+		}
+		return result, nil
+	case "merge", "merge!", "update":
+		result := receiver
+		if name == "merge" {
+			result = receiver.copy()
+		}
+		for _, arg := range args {
+			other, isHash := arg.(*rubyHash)
+			if !isHash {
+				return nil, newRubyError("TypeError", "no implicit conversion of %s into Hash", rubyClassName(arg))
+			}
+			for _, key := range other.keys {
+				value, _ := other.get(key)
+				if existing, found := result.get(key); found && block != nil {
+					var err error
+					value, err = i.callBlock(block, key, existing, value)
+					if err != nil {
+						return nil, err
+					}
+				}
+				result.set(key, value)
+			}
+		}
+		return result, nil
+	case "delete":
+		if err := checkArgs(args, 1, 1); err != nil {
+			return nil, err
+		}
+		return receiver.delete(args[0]), nil
+	case "invert":
+		result := newRubyHash()
+		for _, key := range receiver.keys {
+			value, _ := receiver.get(key)
+			err := result.set(value, key)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+	case "transform_values", "transform_keys":
+		result := newRubyHash()
+		for _, key := range receiver.keys {
+			value, _ := receiver.get(key)
+			var err error
+			if name == "transform_values" {
+				value, err = i.callBlock(block, value)
+			} else {
+				key, err = i.callBlock(block, key)
+			}
+			if err != nil {
+				return nil, err
+			}
+			err = result.set(key, value)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+	case "to_h":
+		if block == nil {
+			return receiver, nil
+		}
+	case "count":
+		if len(args) == 0 && block == nil {
+			return int64(receiver.length()), nil
+		}
+	}
+
+	return i.enumerableMethod(receiver, receiver.pairs(), name, args, block)
+}
+
+func (i *rubyInterpreter) rangeMethod(receiver *rubyRange, name string, args []interface{}, block *rubyProc) (interface{}, error) {
+	switch name {
+	case "begin":
+		return receiver.from, nil
+	case "end":
+		return receiver.to, nil
+	case "first", "min":
+		if len(args) == 0 && block == nil {
+			if name == "min" && compare(receiver.from, receiver.to) > 0 {
+				return nil, nil
+			}
+			return receiver.from, nil
+		}
+	case "last", "max":
+		if len(args) == 0 && block == nil && !receiver.exclusive {
+			if name == "max" && compare(receiver.from, receiver.to) > 0 {
+				return nil, nil
+			}
+			return receiver.to, nil
+		}
+	case "exclude_end?":
+		return receiver.exclusive, nil
+	case "include?", "member?", "cover?", "===":
+		if err := checkArgs(args, 1, 1); err != nil {
+			return nil, err
+		}
+		return receiver.includes(args[0]), nil
+	case "step":
+		if err := checkArgs(args, 1, 1); err != nil {
+			return nil, err
+		}
+		step, err := toInt(args[0])
+		if err != nil {
+			return nil, err
+		}
+		if step <= 0 {
+			return nil, newRubyError("ArgumentError", "step can't be negative")
+		}
+		elements, err := receiver.elements()
+		if err != nil {
+			return nil, err
+		}
+		stepped := newRubyArray()
+		for index := 0; index < len(elements); index += int(step) {
+			stepped.elements = append(stepped.elements, elements[index])
+		}
+		if block == nil {
+			return stepped, nil
+		}
+		return receiver, i.yieldEach(block, stepped.elements)
+	}
+
+	elements, err := receiver.elements()
+	if err != nil {
+		return nil, err
+	}
+
+	switch name {
+	case "size", "count", "length":
+		if len(args) == 0 && block == nil {
+			return int64(len(elements)), nil
+		}
+	case "last":
+		array := newRubyArray(elements...)
+		return i.arrayMethod(array, name, args, block)
+	}
+
+	return i.enumerableMethod(receiver, elements, name, args, block)
+}
+
+func (i *rubyInterpreter) openStructMethod(receiver *openStruct, name string, args []interface{}, block *rubyProc) (interface{}, error) {
+	switch name {
+	case "[]":
+		if err := checkArgs(args, 1, 1); err != nil {
+			return nil, err
+		}
+		value, _ := receiver.fields.get(rubyToS(args[0]))
+		return value, nil
+	case "[]=":
+		if err := checkArgs(args, 2, 2); err != nil {
+			return nil, err
+		}
+		return args[1], receiver.fields.set(rubyToS(args[0]), args[1])
+	case "to_h", "marshal_dump":
+		hash := newRubyHash()
+		for _, key := range receiver.fields.keys {
+			value, _ := receiver.fields.get(key)
+			hash.set(rubySymbol(rubyToS(key)), value)
+		}
+		return hash, nil
+	case "each_pair":
+		for _, key := range receiver.fields.keys {
+			value, _ := receiver.fields.get(key)
+			_, err := i.callBlock(block, newRubyArray(rubySymbol(rubyToS(key)), value))
+			if err != nil {
+				return nil, err
+			}
+		}
+		return receiver, nil
+	case "dig":
+		return dig(receiver, args)
+	case "delete_field":
+		if err := checkArgs(args, 1, 1); err != nil {
+			return nil, err
+		}
+		return receiver.fields.delete(rubyToS(args[0])), nil
+	}
+
+	if value, found := receiver.fields.get(name); found && len(args) == 0 {
+		return value, nil
+	}
+
+	if strings.HasSuffix(name, "=") && len(args) == 1 && name != "==" {
+		return args[0], receiver.fields.set(strings.TrimSuffix(name, "="), args[0])
+	}
+
+	result, err := i.objectMethod(receiver, name, args, block)
+	if err == errMethodMissing && len(args) == 0 && block == nil {
+		// like OpenStruct, unknown attributes are nil
+		return nil, nil
+	}
+	return result, err
+}
+
+func (i *rubyInterpreter) classMethod(receiver *rubyClass, name string, args []interface{}, block *rubyProc) (interface{}, error) {
+	if receiver.name == "Time" {
+		result, err := timeClassMethod(name, args)
+		if err != errMethodMissing {
+			return result, err
+		}
+	}
+
+	switch receiver.name + "." + name {
+	case "JSON.dump":
+		if err := checkArgs(args, 1, 1); err != nil {
+			return nil, err
+		}
+		switch args[0].(type) {
+		case string, int64, float64:
+			// the ruby renderer dumps strings and numbers with inspect
+			return rubyInspect(args[0]), nil
+		}
+		return generateJSON(args[0], false)
+	case "YAML.dump":
+		if err := checkArgs(args, 1, 1); err != nil {
+			return nil, err
+		}
+		return generateYAML(args[0])
+	case "JSON.generate", "JSON.pretty_generate":
+		if err := checkArgs(args, 1, 2); err != nil {
+			return nil, err
+		}
+		return generateJSON(args[0], name == "pretty_generate")
+	case "JSON.parse", "JSON.load":
+		if err := checkArgs(args, 1, 2); err != nil {
+			return nil, err
+		}
+		source, err := stringArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		value, err := decodeJSON([]byte(source))
+		if err != nil {
+			return nil, newRubyError("JSON::ParserError", "%s", err.Error())
+		}
+		return value, nil
+	case "Hash.new":
+		if err := checkArgs(args, 0, 1); err != nil {
+			return nil, err
+		}
+		hash := newRubyHash()
+		if len(args) == 1 {
+			hash.defaultValue = args[0]
+		}
+		return hash, nil
+	case "Array.new":
+		if err := checkArgs(args, 0, 2); err != nil {
+			return nil, err
+		}
+		array := newRubyArray()
+		if len(args) == 0 {
+			return array, nil
+		}
+		size, err := toInt(args[0])
+		if err != nil {
+			return nil, err
+		}
+		for index := int64(0); index < size; index++ {
+			var value interface{}
+			switch {
+			case block != nil:
+				value, err = i.callBlock(block, index)
+				if err != nil {
+					return nil, err
+				}
+			case len(args) == 2:
+				value = args[1]
+			}
+			array.elements = append(array.elements, value)
+		}
+		return array, nil
+	case "String.new":
+		if err := checkArgs(args, 0, 1); err != nil {
+			return nil, err
+		}
+		if len(args) == 0 {
+			return "", nil
+		}
+		return stringArg(args, 0)
+	case "OpenStruct.new":
+		if err := checkArgs(args, 0, 1); err != nil {
+			return nil, err
+		}
+		fields := newRubyHash()
+		if len(args) == 1 {
+			hash, isHash := args[0].(*rubyHash)
+			if !isHash {
+				return nil, newRubyError("NoMethodError", "undefined method `each_pair' for %s", rubyInspect(args[0]))
+			}
+			for _, key := range hash.keys {
+				value, _ := hash.get(key)
+				fields.set(rubyToS(key), value)
+			}
+		}
+		return &openStruct{fields: fields}, nil
+	}
+
+	switch name {
+	case "name", "to_s":
+		return receiver.name, nil
+	}
+	return nil, errMethodMissing
+}
+
+var formatDirectiveRegexp = regexp.MustCompile(`%(?:<(\w+)>|\{(\w+)\})?([-+ 0#]*)(\d+|\*)?(?:\.(\d+))?([sdifgGeExXobBpc%])?`)
+
+// rubySprintf implements Kernel#format and String#%
+func rubySprintf(format string, args []interface{}) (interface{}, error) {
+	var result strings.Builder
+	argIndex := 0
+	last := 0
+
+	nextArg := func() (interface{}, error) {
+		if argIndex >= len(args) {
+			return nil, newRubyError("ArgumentError", "too few arguments")
+		}
+		argIndex++
+		return args[argIndex-1], nil
+	}
+
+	for _, match := range formatDirectiveRegexp.FindAllStringSubmatchIndex(format, -1) {
+		result.WriteString(format[last:match[0]])
+		last = match[1]
+
+		group := func(index int) string {
+			if match[index*2] < 0 {
+				return ""
+			}
+			return format[match[index*2]:match[index*2+1]]
+		}
+		name, template, flags, width, precision, verb := group(1), group(2), group(3), group(4), group(5), group(6)
+
+		var arg interface{}
+		if name != "" || template != "" {
+			if len(args) != 1 {
+				return nil, newRubyError("ArgumentError", "one hash required")
+			}
+			hash, isHash := args[0].(*rubyHash)
+			if !isHash {
+				return nil, newRubyError("ArgumentError", "one hash required")
+			}
+			key := name + template
+			value, found := hash.get(rubySymbol(key))
+			if !found {
+				return nil, newRubyError("KeyError", "key<%s> not found", key)
+			}
+			if template != "" {
+				result.WriteString(rubyToS(value))
+				continue
+			}
+			arg = value
+		} else if verb == "%" {
+			result.WriteString("%")
+			continue
+		} else if verb == "" {
+			return nil, newRubyError("ArgumentError", "malformed format string - %s", format[match[0]:match[1]])
+		}
+
+		if width == "*" {
+			widthArg, err := nextArg()
+			if err != nil {
+				return nil, err
+			}
+			widthValue, err := toInt(widthArg)
+			if err != nil {
+				return nil, err
+			}
+			width = strconv.FormatInt(widthValue, 10)
+		}
+
+		if name == "" {
+			var err error
+			arg, err = nextArg()
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		spec := "%" + flags + width
+		if precision != "" {
+			spec += "." + precision
+		}
+
+		switch verb {
+		case "s":
+			result.WriteString(fmt.Sprintf(spec+"s", rubyToS(arg)))
+		case "p":
+			result.WriteString(fmt.Sprintf(spec+"s", rubyInspect(arg)))
+		case "d", "i", "x", "X", "o", "b", "B", "c":
+			integer, err := formatInteger(arg)
+			if err != nil {
+				return nil, err
+			}
+			goVerb := verb
+			switch verb {
+			case "i":
+				goVerb = "d"
+			case "B":
+				goVerb = "b"
+			}
+			result.WriteString(fmt.Sprintf(spec+goVerb, integer))
+		default:
+			float, isNumeric := toFloat(arg)
+			if s, isString := arg.(string); isString {
+				var err error
+				float, err = strconv.ParseFloat(strings.TrimSpace(s), 64)
+				isNumeric = err == nil
+			}
+			if !isNumeric {
+				return nil, newRubyError("TypeError", "can't convert %s into Float", rubyClassName(arg))
+			}
+			result.WriteString(fmt.Sprintf(spec+verb, float))
+		}
+	}
+	result.WriteString(format[last:])
+
+	return result.String(), nil
+}
+
+func formatInteger(arg interface{}) (int64, error) {
+	switch v := arg.(type) {
+	case int64:
+		return v, nil
+	case float64:
+		return int64(v), nil
+	case string:
+		value, err := strconv.ParseInt(strings.Replace(strings.TrimSpace(v), "_", "", -1), 0, 64)
+		if err != nil {
+			return 0, newRubyError("ArgumentError", "invalid value for Integer(): %s", rubyInspect(v))
+		}
+		return value, nil
+	}
+	return 0, newRubyError("TypeError", "can't convert %s into Integer", rubyClassName(arg))
+}
@@ -0,0 +1,796 @@
+package erbrenderer
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+)
+
+// rubyError is an exception raised while evaluating a template
+type rubyError struct {
+	class string
+	msg   string
+	line  int
+}
+
+func newRubyError(class string, format string, args ...interface{}) *rubyError {
+	return &rubyError{class: class, msg: fmt.Sprintf(format, args...)}
+}
+
+func (e *rubyError) Error() string {
+	return fmt.Sprintf("#<%s: %s>", e.class, e.msg)
+}
+
+// unsupportedConstError is returned for a constant that job templates use but that is not implemented, e.g. Base64.
+// It is not a Ruby exception, so that a template cannot rescue it and render differently than with the ruby engine.
+type unsupportedConstError struct {
+	name string
+	line int
+}
+
+func (e *unsupportedConstError) Error() string {
+	return fmt.Sprintf("%s is not supported by the '%s' ERB renderer, set BOSH_INIT_ERB_RENDERER=%s to render the templates with Ruby", e.name, EngineGo, EngineRuby)
+}
+
+// nextSignal unwinds the evaluation of a block when it calls 'next'
+type nextSignal struct {
+	value interface{}
+}
+
+func (s nextSignal) Error() string {
+	return "next used outside of a block"
+}
+
+// returnSignal unwinds the evaluation of a method defined by the template when it calls 'return'
+type returnSignal struct {
+	value interface{}
+}
+
+func (s returnSignal) Error() string {
+	return "unexpected return"
+}
+
+// errMethodMissing is returned by the builtin method tables when a receiver has no such method
+var errMethodMissing = fmt.Errorf("method missing")
+
+type rubyScope struct {
+	vars   map[string]interface{}
+	parent *rubyScope
+
+	// block is the block passed to the method whose body this scope belongs to
+	block *rubyProc
+}
+
+func newRubyScope(parent *rubyScope) *rubyScope {
+	return &rubyScope{vars: map[string]interface{}{}, parent: parent}
+}
+
+func (s *rubyScope) lookup(name string) (interface{}, bool) {
+	for scope := s; scope != nil; scope = scope.parent {
+		if value, found := scope.vars[name]; found {
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+// set assigns an existing variable of an enclosing scope or defines a new one
+func (s *rubyScope) set(name string, value interface{}) {
+	for scope := s; scope != nil; scope = scope.parent {
+		if _, found := scope.vars[name]; found {
+			scope.vars[name] = value
+			return
+		}
+	}
+	s.vars[name] = value
+}
+
+// methodBlock returns the block given to the method that is being evaluated
+func (s *rubyScope) methodBlock() *rubyProc {
+	for scope := s; scope != nil; scope = scope.parent {
+		if scope.block != nil {
+			return scope.block
+		}
+	}
+	return nil
+}
+
+type rubyInterpreter struct {
+	context *templateEvaluationContext
+	output  bytes.Buffer
+	methods map[string]*defNode
+}
+
+func (i *rubyInterpreter) evalBody(nodes []rubyNode, scope *rubyScope) (interface{}, error) {
+	var result interface{}
+	for _, node := range nodes {
+		value, err := i.eval(node, scope)
+		if err != nil {
+			return nil, err
+		}
+		result = value
+	}
+	return result, nil
+}
+
+// eval evaluates a node and attributes errors without a line to the line of the node
+func (i *rubyInterpreter) eval(node rubyNode, scope *rubyScope) (interface{}, error) {
+	value, err := i.evalNode(node, scope)
+	if err != nil {
+		switch typedErr := err.(type) {
+		case *rubyError:
+			if typedErr.line == 0 {
+				typedErr.line = node.lineNumber()
+			}
+		case *unsupportedConstError:
+			if typedErr.line == 0 {
+				typedErr.line = node.lineNumber()
+			}
+		}
+		return nil, err
+	}
+	return value, nil
+}
+
+func (i *rubyInterpreter) evalNode(node rubyNode, scope *rubyScope) (interface{}, error) {
+	switch n := node.(type) {
+	case *textNode:
+		i.output.WriteString(n.text)
+		return nil, nil
+
+	case *outputNode:
+		value, err := i.eval(n.value, scope)
+		if err != nil {
+			return nil, err
+		}
+		i.output.WriteString(rubyToS(value))
+		return nil, nil
+
+	case *literalNode:
+		return n.value, nil
+
+	case *stringNode:
+		var buf bytes.Buffer
+		for _, part := range n.parts {
+			value, err := i.eval(part, scope)
+			if err != nil {
+				return nil, err
+			}
+			buf.WriteString(rubyToS(value))
+		}
+		return buf.String(), nil
+
+	case *regexpNode:
+		return &rubyRegexp{re: n.re, source: n.source}, nil
+
+	case *arrayNode:
+		array := newRubyArray()
+		for _, element := range n.elements {
+			value, err := i.eval(element, scope)
+			if err != nil {
+				return nil, err
+			}
+			array.elements = append(array.elements, value)
+		}
+		return array, nil
+
+	case *hashNode:
+		hash := newRubyHash()
+		for index := range n.keys {
+			key, err := i.eval(n.keys[index], scope)
+			if err != nil {
+				return nil, err
+			}
+			value, err := i.eval(n.values[index], scope)
+			if err != nil {
+				return nil, err
+			}
+			err = hash.set(key, value)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return hash, nil
+
+	case *rangeNode:
+		from, err := i.eval(n.from, scope)
+		if err != nil {
+			return nil, err
+		}
+		to, err := i.eval(n.to, scope)
+		if err != nil {
+			return nil, err
+		}
+		if compare(from, to) == incomparable {
+			return nil, newRubyError("ArgumentError", "bad value for range")
+		}
+		return &rubyRange{from: from, to: to, exclusive: n.exclusive}, nil
+
+	case *selfNode:
+		return i.context, nil
+
+	case *variableNode:
+		value, _ := scope.lookup(n.name)
+		return value, nil
+
+	case *constNode:
+		return lookupConst(n.name)
+
+	case *callNode:
+		return i.evalCall(n, scope)
+
+	case *blockPassNode:
+		return nil, newRubyError("SyntaxError", "unexpected block argument")
+
+	case *assignNode:
+		value, err := i.eval(n.value, scope)
+		if err != nil {
+			return nil, err
+		}
+		scope.set(n.name, value)
+		return value, nil
+
+	case *opAssignNode:
+		return i.evalOpAssign(n, scope)
+
+	case *indexAssignNode:
+		receiver, err := i.eval(n.receiver, scope)
+		if err != nil {
+			return nil, err
+		}
+		args, _, err := i.evalArgs(n.args, scope)
+		if err != nil {
+			return nil, err
+		}
+		value, err := i.eval(n.value, scope)
+		if err != nil {
+			return nil, err
+		}
+		_, err = i.callMethod(receiver, "[]=", append(args, value), nil)
+		return value, err
+
+	case *andNode:
+		left, err := i.eval(n.left, scope)
+		if err != nil || !truthy(left) {
+			return left, err
+		}
+		return i.eval(n.right, scope)
+
+	case *orNode:
+		left, err := i.eval(n.left, scope)
+		if err != nil || truthy(left) {
+			return left, err
+		}
+		return i.eval(n.right, scope)
+
+	case *notNode:
+		value, err := i.eval(n.value, scope)
+		if err != nil {
+			return nil, err
+		}
+		return !truthy(value), nil
+
+	case *ifNode:
+		condition, err := i.eval(n.condition, scope)
+		if err != nil {
+			return nil, err
+		}
+		if truthy(condition) {
+			return i.evalBody(n.then, scope)
+		}
+		return i.evalBody(n.otherwise, scope)
+
+	case *whileNode:
+		for {
+			condition, err := i.eval(n.condition, scope)
+			if err != nil {
+				return nil, err
+			}
+			if truthy(condition) == n.until {
+				return nil, nil
+			}
+			_, err = i.evalBody(n.body, scope)
+			if _, isNext := err.(nextSignal); err != nil && !isNext {
+				return nil, err
+			}
+		}
+
+	case *caseNode:
+		return i.evalCase(n, scope)
+
+	case *forNode:
+		collection, err := i.eval(n.collection, scope)
+		if err != nil {
+			return nil, err
+		}
+		elements, err := iterationElements(collection)
+		if err != nil {
+			return nil, err
+		}
+		for _, element := range elements {
+			values := []interface{}{element}
+			if array, isArray := element.(*rubyArray); isArray && len(n.vars) > 1 {
+				values = array.elements
+			}
+			for index, name := range n.vars {
+				var value interface{}
+				if index < len(values) {
+					value = values[index]
+				}
+				scope.set(name, value)
+			}
+			_, err = i.evalBody(n.body, scope)
+			if _, isNext := err.(nextSignal); err != nil && !isNext {
+				return nil, err
+			}
+		}
+		return collection, nil
+
+	case *nextNode:
+		var value interface{}
+		if n.value != nil {
+			var err error
+			value, err = i.eval(n.value, scope)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return nil, nextSignal{value: value}
+
+	case *returnNode:
+		var value interface{}
+		if n.value != nil {
+			var err error
+			value, err = i.eval(n.value, scope)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return nil, returnSignal{value: value}
+
+	case *yieldNode:
+		args, _, err := i.evalArgs(n.args, scope)
+		if err != nil {
+			return nil, err
+		}
+		return i.callBlock(scope.methodBlock(), args...)
+
+	case *defNode:
+		if i.methods == nil {
+			i.methods = map[string]*defNode{}
+		}
+		i.methods[n.name] = n
+		return rubySymbol(n.name), nil
+
+	case *rescueNode:
+		return i.evalRescue(n, scope)
+
+	case *beginNode:
+		return i.evalBody(n.body, scope)
+	}
+
+	return nil, newRubyError("NotImplementedError", "unsupported expression")
+}
+
+func (i *rubyInterpreter) evalArgs(nodes []rubyNode, scope *rubyScope) ([]interface{}, *rubyProc, error) {
+	args := []interface{}{}
+	var block *rubyProc
+	for _, node := range nodes {
+		if blockPass, ok := node.(*blockPassNode); ok {
+			block = &rubyProc{method: blockPass.method}
+			continue
+		}
+		value, err := i.eval(node, scope)
+		if err != nil {
+			return nil, nil, err
+		}
+		args = append(args, value)
+	}
+	return args, block, nil
+}
+
+func (i *rubyInterpreter) evalCall(n *callNode, scope *rubyScope) (interface{}, error) {
+	var receiver interface{}
+	if n.receiver != nil {
+		var err error
+		receiver, err = i.eval(n.receiver, scope)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	args, block, err := i.evalArgs(n.args, scope)
+	if err != nil {
+		return nil, err
+	}
+	if n.block != nil {
+		block = &rubyProc{block: n.block, scope: scope}
+	}
+
+	if n.receiver == nil {
+		if n.name == "block_given?" {
+			return scope.methodBlock() != nil, nil
+		}
+		if method, found := i.methods[n.name]; found {
+			return i.callDefinedMethod(method, args, block)
+		}
+		return i.callFunction(n.name, args, block)
+	}
+
+	result, err := i.callMethod(receiver, n.name, args, block)
+	if err != nil {
+		return nil, err
+	}
+
+	// strings are immutable values here, appending to a string variable reassigns it
+	if _, isString := receiver.(string); isString && (n.name == "<<" || n.name == "concat") {
+		if variable, isVariable := n.receiver.(*variableNode); isVariable {
+			scope.set(variable.name, result)
+		}
+	}
+
+	return result, nil
+}
+
+// callDefinedMethod calls a method defined with def in the template, which does not see the local variables of the caller
+func (i *rubyInterpreter) callDefinedMethod(method *defNode, args []interface{}, block *rubyProc) (interface{}, error) {
+	required := 0
+	for _, param := range method.params {
+		if param.defaultValue == nil {
+			required++
+		}
+	}
+	if err := checkArgs(args, required, len(method.params)); err != nil {
+		return nil, err
+	}
+
+	scope := newRubyScope(nil)
+	scope.block = block
+	for index, param := range method.params {
+		if index < len(args) {
+			scope.vars[param.name] = args[index]
+			continue
+		}
+		value, err := i.eval(param.defaultValue, scope)
+		if err != nil {
+			return nil, err
+		}
+		scope.vars[param.name] = value
+	}
+
+	value, err := i.evalBody(method.body, scope)
+	if signal, isReturn := err.(returnSignal); isReturn {
+		return signal.value, nil
+	}
+	return value, err
+}
+
+// evalRescue evaluates a body with rescue and ensure clauses, only exceptions are rescued and not next or return
+func (i *rubyInterpreter) evalRescue(n *rescueNode, scope *rubyScope) (interface{}, error) {
+	value, err := i.evalBody(n.body, scope)
+
+	if rubyErr, isRubyError := err.(*rubyError); isRubyError {
+		for _, clause := range n.clauses {
+			rescued, classErr := i.rescues(clause, rubyErr, scope)
+			if classErr != nil {
+				err = classErr
+				break
+			}
+			if rescued {
+				if clause.variable != "" {
+					scope.set(clause.variable, rubyErr)
+				}
+				value, err = i.evalBody(clause.body, scope)
+				break
+			}
+		}
+	}
+
+	if len(n.ensureBody) > 0 {
+		_, ensureErr := i.evalBody(n.ensureBody, scope)
+		if ensureErr != nil {
+			return nil, ensureErr
+		}
+	}
+
+	return value, err
+}
+
+func (i *rubyInterpreter) rescues(clause rescueClause, rubyErr *rubyError, scope *rubyScope) (bool, error) {
+	if len(clause.classes) == 0 {
+		return true, nil
+	}
+
+	for _, classNode := range clause.classes {
+		value, err := i.eval(classNode, scope)
+		if err != nil {
+			return false, err
+		}
+		class, isClass := value.(*rubyClass)
+		if !isClass {
+			return false, newRubyError("TypeError", "class or module required for rescue clause")
+		}
+		switch class.name {
+		case "Exception", "StandardError", rubyErr.class:
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (i *rubyInterpreter) evalOpAssign(n *opAssignNode, scope *rubyScope) (interface{}, error) {
+	var current interface{}
+	var assign func(value interface{}) error
+
+	switch target := n.target.(type) {
+	case *variableNode:
+		current, _ = scope.lookup(target.name)
+		assign = func(value interface{}) error {
+			scope.set(target.name, value)
+			return nil
+		}
+	case *callNode:
+		receiver, err := i.eval(target.receiver, scope)
+		if err != nil {
+			return nil, err
+		}
+		args, _, err := i.evalArgs(target.args, scope)
+		if err != nil {
+			return nil, err
+		}
+		current, err = i.callMethod(receiver, target.name, args, nil)
+		if err != nil {
+			return nil, err
+		}
+		setter := target.name + "="
+		if target.name == "[]" {
+			setter = "[]="
+		}
+		assign = func(value interface{}) error {
+			_, err := i.callMethod(receiver, setter, append(append([]interface{}{}, args...), value), nil)
+			return err
+		}
+	default:
+		return nil, newRubyError("SyntaxError", "unsupported assignment")
+	}
+
+	switch n.op {
+	case "||":
+		if truthy(current) {
+			return current, nil
+		}
+	case "&&":
+		if !truthy(current) {
+			return current, nil
+		}
+	}
+
+	value, err := i.eval(n.value, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	if n.op != "||" && n.op != "&&" {
+		value, err = i.callMethod(current, n.op, []interface{}{value}, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return value, assign(value)
+}
+
+func (i *rubyInterpreter) evalCase(n *caseNode, scope *rubyScope) (interface{}, error) {
+	var subject interface{}
+	if n.subject != nil {
+		var err error
+		subject, err = i.eval(n.subject, scope)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, clause := range n.whens {
+		for _, valueNode := range clause.values {
+			value, err := i.eval(valueNode, scope)
+			if err != nil {
+				return nil, err
+			}
+
+			matched := truthy(value)
+			if n.subject != nil {
+				matched = caseEqual(value, subject)
+			}
+			if matched {
+				return i.evalBody(clause.body, scope)
+			}
+		}
+	}
+
+	return i.evalBody(n.otherwise, scope)
+}
+
+// caseEqual implements === as used by case/when
+func caseEqual(pattern interface{}, value interface{}) bool {
+	switch p := pattern.(type) {
+	case *rubyClass:
+		return isA(value, p.name)
+	case *rubyRange:
+		return p.includes(value)
+	case *rubyRegexp:
+		s, isString := value.(string)
+		if symbol, isSymbol := value.(rubySymbol); isSymbol {
+			s, isString = string(symbol), true
+		}
+		return isString && p.re.MatchString(s)
+	}
+	return rubyEqual(pattern, value)
+}
+
+// callBlock yields to a block. A single array argument is spread over the parameters of a block with several parameters.
+func (i *rubyInterpreter) callBlock(block *rubyProc, args ...interface{}) (interface{}, error) {
+	if block == nil {
+		return nil, newRubyError("LocalJumpError", "no block given (yield)")
+	}
+
+	if block.method != "" {
+		if len(args) == 0 {
+			return nil, newRubyError("ArgumentError", "no receiver given")
+		}
+		return i.callMethod(args[0], block.method, args[1:], nil)
+	}
+
+	params := block.block.params
+	if len(args) == 1 && len(params) > 1 {
+		if array, isArray := args[0].(*rubyArray); isArray {
+			args = array.elements
+		}
+	}
+
+	scope := newRubyScope(block.scope)
+	for index, param := range params {
+		var value interface{}
+		if index < len(args) {
+			value = args[index]
+		}
+		if param.nested == nil {
+			scope.vars[param.name] = value
+			continue
+		}
+		values := []interface{}{value}
+		if array, isArray := value.(*rubyArray); isArray {
+			values = array.elements
+		}
+		for nestedIndex, name := range param.nested {
+			scope.vars[name] = nil
+			if nestedIndex < len(values) {
+				scope.vars[name] = values[nestedIndex]
+			}
+		}
+	}
+
+	value, err := i.evalBody(block.block.body, scope)
+	if signal, isNext := err.(nextSignal); isNext {
+		return signal.value, nil
+	}
+	return value, err
+}
+
+// callMethod calls a method on a receiver using the builtin methods of its class
+func (i *rubyInterpreter) callMethod(receiver interface{}, name string, args []interface{}, block *rubyProc) (interface{}, error) {
+	var result interface{}
+	err := errMethodMissing
+
+	switch r := receiver.(type) {
+	case *templateEvaluationContext:
+		return i.callFunction(name, args, block)
+	case nil:
+		result, err = nilMethod(name, args)
+	case bool:
+		result, err = boolMethod(r, name, args)
+	case int64, float64:
+		result, err = i.numericMethod(r, name, args, block)
+	case string:
+		result, err = i.stringMethod(r, name, args, block)
+	case rubySymbol:
+		result, err = symbolMethod(r, name, args)
+	case *rubyArray:
+		result, err = i.arrayMethod(r, name, args, block)
+	case *rubyHash:
+		result, err = i.hashMethod(r, name, args, block)
+	case *rubyRange:
+		result, err = i.rangeMethod(r, name, args, block)
+	case *openStruct:
+		result, err = i.openStructMethod(r, name, args, block)
+	case *rubyRegexp:
+		result, err = regexpMethod(r, name, args)
+	case time.Time:
+		result, err = timeMethod(r, name, args)
+	case *rubyProc:
+		if name == "call" || name == "yield" || name == "()" {
+			return i.callBlock(r, args...)
+		}
+	case *rubyClass:
+		result, err = i.classMethod(r, name, args, block)
+	case *rubyError:
+		switch name {
+		case "message", "to_s":
+			return r.msg, nil
+		case "class":
+			return &rubyClass{name: r.class}, nil
+		}
+	case *activeElseBlock:
+		switch name {
+		case "else":
+			return i.callBlock(block)
+		case "else_if_p":
+			return i.ifP(args, block)
+		}
+	case inactiveElseBlock:
+		switch name {
+		case "else":
+			return nil, nil
+		case "else_if_p":
+			return inactiveElseBlock{}, nil
+		}
+	}
+
+	if err == errMethodMissing {
+		result, err = i.objectMethod(receiver, name, args, block)
+	}
+	if err == errMethodMissing {
+		return nil, noMethodError(name, receiver)
+	}
+	return result, err
+}
+
+func noMethodError(name string, receiver interface{}) *rubyError {
+	switch receiver.(type) {
+	case nil:
+		return newRubyError("NoMethodError", "undefined method `%s' for nil:NilClass", name)
+	case *templateEvaluationContext:
+		return newRubyError("NoMethodError", "undefined method `%s' for #<TemplateEvaluationContext>", name)
+	}
+	return newRubyError("NoMethodError", "undefined method `%s' for %s:%s", name, rubyInspect(receiver), rubyClassName(receiver))
+}
+
+func checkArgs(args []interface{}, min int, max int) error {
+	if len(args) < min || (max >= 0 && len(args) > max) {
+		expected := fmt.Sprintf("%d", min)
+		switch {
+		case max < 0:
+			expected += "+"
+		case max != min:
+			expected += fmt.Sprintf("..%d", max)
+		}
+		return newRubyError("ArgumentError", "wrong number of arguments (given %d, expected %s)", len(args), expected)
+	}
+	return nil
+}
+
+// lookupConst returns the classes and modules that templates may refer to
+func lookupConst(name string) (interface{}, error) {
+	switch name {
+	case "JSON", "YAML", "String", "Integer", "Fixnum", "Bignum", "Float", "Numeric", "Array", "Hash",
+		"Symbol", "NilClass", "TrueClass", "FalseClass", "Range", "Regexp", "OpenStruct", "Object",
+		"Comparable", "Enumerable", "Kernel", "Proc", "Exception", "StandardError", "RuntimeError", "ArgumentError",
+		"TypeError", "NameError", "NoMethodError", "KeyError", "IndexError", "JSON::ParserError", "Time":
+		return &rubyClass{name: name}, nil
+	case "Base64":
+		return nil, &unsupportedConstError{name: name}
+	}
+	return nil, newRubyError("NameError", "uninitialized constant %s", name)
+}
+
+// iterationElements returns the values yielded by each for arrays, hashes and ranges
+func iterationElements(collection interface{}) ([]interface{}, error) {
+	switch c := collection.(type) {
+	case *rubyArray:
+		return append([]interface{}{}, c.elements...), nil
+	case *rubyHash:
+		return c.pairs(), nil
+	case *rubyRange:
+		return c.elements()
+	}
+	return nil, noMethodError("each", collection)
+}
@@ -0,0 +1,675 @@
+package erbrenderer
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNewline
+	tokText
+	tokOutput
+	tokOutputEnd
+	tokIdent
+	tokConst
+	tokLabel
+	tokInt
+	tokFloat
+	tokString
+	tokSymbol
+	tokRegexp
+	tokWords
+	tokKeyword
+	tokOp
+)
+
+type token struct {
+	kind        tokenKind
+	text        string
+	line        int
+	spaceBefore bool
+	parts       []stringPart
+	words       []string
+}
+
+// stringPart is either a literal piece of a double quoted string or the code of a #{} interpolation
+type stringPart struct {
+	literal string
+	code    string
+	isCode  bool
+	line    int
+}
+
+var rubyKeywords = map[string]bool{
+	"if": true, "elsif": true, "else": true, "unless": true, "end": true,
+	"case": true, "when": true, "then": true, "do": true, "for": true, "in": true,
+	"and": true, "or": true, "not": true, "nil": true, "true": true, "false": true,
+	"self": true, "next": true, "while": true, "until": true, "begin": true,
+	"rescue": true, "ensure": true, "def": true, "return": true, "yield": true,
+}
+
+// operators ordered so that longer operators match first
+var rubyOperators = []string{
+	"**=", "||=", "&&=", "...", "<=>", "===",
+	"**", "==", "!=", ">=", "<=", "&&", "||", "<<", "=>", "..", "=~", "!~", "+=", "-=", "*=", "/=", "::",
+	"+", "-", "*", "/", "%", "=", "<", ">", "!", ".", ",", "(", ")", "[", "]", "{", "}", "|", "?", ":", "&",
+}
+
+type rubyLexer struct {
+	src      []rune
+	pos      int
+	line     int
+	tokens   []token
+	heredocs []heredoc
+}
+
+// heredoc is a here document whose body starts on the line after its <<ID token
+type heredoc struct {
+	tokenIndex  int
+	id          string
+	indented    bool
+	squiggly    bool
+	interpolate bool
+	line        int
+}
+
+type rubySyntaxError struct {
+	msg  string
+	line int
+}
+
+func (e rubySyntaxError) Error() string {
+	return fmt.Sprintf("line %d: syntax error, %s", e.line, e.msg)
+}
+
+// lexERBSegments turns the segments of an ERB template into a single token stream.
+// Text segments become tokText tokens and the code of output segments is enclosed in tokOutput and tokOutputEnd tokens,
+// every segment ends a statement.
+func lexERBSegments(segments []erbSegment) ([]token, error) {
+	tokens := []token{}
+	for _, segment := range segments {
+		switch segment.kind {
+		case erbText:
+			tokens = append(tokens, token{kind: tokText, text: segment.content, line: segment.line})
+		case erbOutput, erbCode:
+			codeTokens, err := lexRuby(segment.content, segment.line)
+			if err != nil {
+				return nil, err
+			}
+			if segment.kind == erbOutput {
+				tokens = append(tokens, token{kind: tokOutput, line: segment.line})
+				tokens = append(tokens, codeTokens...)
+				tokens = append(tokens, token{kind: tokOutputEnd, line: segment.line})
+			} else {
+				tokens = append(tokens, codeTokens...)
+			}
+		}
+		tokens = append(tokens, token{kind: tokNewline, text: ";", line: segment.line})
+	}
+	return append(tokens, token{kind: tokEOF}), nil
+}
+
+func lexRuby(code string, line int) ([]token, error) {
+	l := &rubyLexer{src: []rune(code), line: line}
+	err := l.lex()
+	if err != nil {
+		return nil, err
+	}
+	return l.tokens, nil
+}
+
+func (l *rubyLexer) peek(offset int) rune {
+	if l.pos+offset < len(l.src) {
+		return l.src[l.pos+offset]
+	}
+	return 0
+}
+
+func (l *rubyLexer) emit(kind tokenKind, text string, spaceBefore bool) *token {
+	l.tokens = append(l.tokens, token{kind: kind, text: text, line: l.line, spaceBefore: spaceBefore})
+	return &l.tokens[len(l.tokens)-1]
+}
+
+func (l *rubyLexer) lastToken() *token {
+	if len(l.tokens) == 0 {
+		return nil
+	}
+	return &l.tokens[len(l.tokens)-1]
+}
+
+func (l *rubyLexer) lex() error {
+	spaceBefore := false
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\r':
+			l.pos++
+			spaceBefore = true
+			continue
+		case c == '\\' && l.peek(1) == '\n':
+			l.pos += 2
+			l.line++
+			spaceBefore = true
+			continue
+		case c == '\n' || c == ';':
+			l.emit(tokNewline, string(c), spaceBefore)
+			l.pos++
+			if c == '\n' {
+				l.line++
+				err := l.lexHeredocBodies()
+				if err != nil {
+					return err
+				}
+			}
+		case c == '#':
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+				l.pos++
+			}
+			continue
+		case unicode.IsDigit(c):
+			l.lexNumber(spaceBefore)
+		case c == '_' || unicode.IsLetter(c):
+			l.lexIdentifier(spaceBefore)
+		case c == '@' || c == '$':
+			return rubySyntaxError{msg: fmt.Sprintf("instance and global variables are not supported: '%c'", c), line: l.line}
+		case c == '"' || c == '`':
+			l.pos++
+			parts, err := l.lexDoubleQuoted(c)
+			if err != nil {
+				return err
+			}
+			l.emit(tokString, "", spaceBefore).parts = parts
+		case c == '\'':
+			l.pos++
+			literal, err := l.lexSingleQuoted('\'')
+			if err != nil {
+				return err
+			}
+			l.emit(tokString, "", spaceBefore).parts = []stringPart{{literal: literal}}
+		case c == ':' && (l.peek(1) == '_' || unicode.IsLetter(l.peek(1))):
+			l.pos++
+			start := l.pos
+			for l.pos < len(l.src) && isIdentifierRune(l.src[l.pos]) {
+				l.pos++
+			}
+			if l.pos < len(l.src) && (l.src[l.pos] == '?' || l.src[l.pos] == '!') {
+				l.pos++
+			}
+			l.emit(tokSymbol, string(l.src[start:l.pos]), spaceBefore)
+		case c == ':' && l.operatorSymbol() != "":
+			operator := l.operatorSymbol()
+			l.pos += 1 + len([]rune(operator))
+			l.emit(tokSymbol, operator, spaceBefore)
+		case c == ':' && (l.peek(1) == '"' || l.peek(1) == '\''):
+			quote := l.peek(1)
+			l.pos += 2
+			literal, err := l.lexSingleQuoted(quote)
+			if err != nil {
+				return err
+			}
+			l.emit(tokSymbol, literal, spaceBefore)
+		case c == '%' && l.peek(1) == 'w' && isOpeningDelimiter(l.peek(2)) && l.regexpAllowed(spaceBefore):
+			l.pos += 2
+			err := l.lexWords(spaceBefore)
+			if err != nil {
+				return err
+			}
+		case c == '<' && l.peek(1) == '<' && l.heredocStart() > 0 && l.regexpAllowed(spaceBefore):
+			l.lexHeredocStart(spaceBefore)
+		case c == '/' && l.regexpAllowed(spaceBefore):
+			l.pos++
+			err := l.lexRegexp(spaceBefore)
+			if err != nil {
+				return err
+			}
+		default:
+			if !l.lexOperator(spaceBefore) {
+				return rubySyntaxError{msg: fmt.Sprintf("unexpected character '%c'", c), line: l.line}
+			}
+		}
+		spaceBefore = false
+	}
+	if len(l.heredocs) > 0 {
+		return l.unterminatedHeredoc(l.heredocs[0])
+	}
+	return nil
+}
+
+// operatorSymbols are the operator methods that may be named by a symbol such as :+ in inject(:+)
+var operatorSymbols = []string{"<=>", "===", "[]", "==", "**", "<=", ">=", "<<", "+", "-", "*", "/", "%", "<", ">"}
+
+// operatorSymbol returns the operator of a symbol such as :+ at the current position.
+// The operator must be followed by the end of the argument, so that 'a ? b :-1' is still a ternary operator.
+func (l *rubyLexer) operatorSymbol() string {
+	rest := string(l.src[l.pos+1 : minInt(l.pos+4, len(l.src))])
+	for _, operator := range operatorSymbols {
+		if !strings.HasPrefix(rest, operator) {
+			continue
+		}
+		switch l.peek(1 + len(operator)) {
+		case 0, ')', ',', ']', '}', ' ', '\t', '\n', ';':
+			return operator
+		}
+		return ""
+	}
+	return ""
+}
+
+func isIdentifierRune(c rune) bool {
+	return c == '_' || unicode.IsLetter(c) || unicode.IsDigit(c)
+}
+
+func isOpeningDelimiter(c rune) bool {
+	return c == '(' || c == '[' || c == '{' || c == '<'
+}
+
+func closingDelimiter(c rune) rune {
+	switch c {
+	case '(':
+		return ')'
+	case '[':
+		return ']'
+	case '{':
+		return '}'
+	case '<':
+		return '>'
+	}
+	return c
+}
+
+func (l *rubyLexer) lexNumber(spaceBefore bool) {
+	start := l.pos
+	for l.pos < len(l.src) && (unicode.IsDigit(l.src[l.pos]) || l.src[l.pos] == '_') {
+		l.pos++
+	}
+	kind := tokInt
+	if l.peek(0) == '.' && unicode.IsDigit(l.peek(1)) {
+		kind = tokFloat
+		l.pos++
+		for l.pos < len(l.src) && (unicode.IsDigit(l.src[l.pos]) || l.src[l.pos] == '_') {
+			l.pos++
+		}
+	}
+	if (l.peek(0) == 'e' || l.peek(0) == 'E') && (unicode.IsDigit(l.peek(1)) || ((l.peek(1) == '-' || l.peek(1) == '+') && unicode.IsDigit(l.peek(2)))) {
+		kind = tokFloat
+		l.pos += 2
+		for l.pos < len(l.src) && unicode.IsDigit(l.src[l.pos]) {
+			l.pos++
+		}
+	}
+	l.emit(kind, strings.Replace(string(l.src[start:l.pos]), "_", "", -1), spaceBefore)
+}
+
+func (l *rubyLexer) lexIdentifier(spaceBefore bool) {
+	start := l.pos
+	for l.pos < len(l.src) && isIdentifierRune(l.src[l.pos]) {
+		l.pos++
+	}
+	if (l.peek(0) == '?' || l.peek(0) == '!') && l.peek(1) != '=' {
+		l.pos++
+	} else if l.peek(0) == '?' && l.peek(1) == '=' && l.peek(2) == '=' {
+		l.pos++
+	}
+	name := string(l.src[start:l.pos])
+
+	previous := l.lastToken()
+	afterDot := previous != nil && previous.kind == tokOp && (previous.text == "." || previous.text == "::")
+
+	switch {
+	case l.peek(0) == ':' && l.peek(1) != ':' && !afterDot:
+		l.pos++
+		l.emit(tokLabel, name, spaceBefore)
+	case afterDot:
+		l.emit(tokIdent, name, spaceBefore)
+	case rubyKeywords[name]:
+		l.emit(tokKeyword, name, spaceBefore)
+	case unicode.IsUpper([]rune(name)[0]):
+		l.emit(tokConst, name, spaceBefore)
+	default:
+		l.emit(tokIdent, name, spaceBefore)
+	}
+}
+
+// regexpAllowed decides whether '/' starts a regular expression or is the division operator
+func (l *rubyLexer) regexpAllowed(spaceBefore bool) bool {
+	previous := l.lastToken()
+	if previous == nil {
+		return true
+	}
+	switch previous.kind {
+	case tokNewline:
+		return true
+	case tokOp:
+		return previous.text != ")" && previous.text != "]" && previous.text != "}"
+	case tokKeyword:
+		switch previous.text {
+		case "end", "nil", "true", "false", "self":
+			return false
+		}
+		return true
+	case tokIdent:
+		next := l.peek(1)
+		return spaceBefore && next != ' ' && next != '='
+	}
+	return false
+}
+
+func (l *rubyLexer) lexOperator(spaceBefore bool) bool {
+	rest := string(l.src[l.pos:minInt(l.pos+3, len(l.src))])
+	for _, op := range rubyOperators {
+		if strings.HasPrefix(rest, op) {
+			l.pos += len([]rune(op))
+			l.emit(tokOp, op, spaceBefore)
+			return true
+		}
+	}
+	return false
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// heredocStart returns the length of the <<ID, <<-ID or <<~ID at the current position, 0 when there is none.
+// Like in Ruby, the identifier of a plain <<ID must be quoted or a constant, so that 'a <<b' is still an append.
+func (l *rubyLexer) heredocStart() int {
+	length := 2
+	plain := true
+	if l.peek(length) == '-' || l.peek(length) == '~' {
+		length++
+		plain = false
+	}
+
+	c := l.peek(length)
+	if c == '\'' || c == '"' {
+		for end := length + 1; l.pos+end < len(l.src); end++ {
+			switch l.peek(end) {
+			case c:
+				return end + 1
+			case '\n':
+				return 0
+			}
+		}
+		return 0
+	}
+
+	if !(c == '_' || unicode.IsLetter(c)) || (plain && !unicode.IsUpper(c)) {
+		return 0
+	}
+	for isIdentifierRune(l.peek(length)) {
+		length++
+	}
+	return length
+}
+
+func (l *rubyLexer) lexHeredocStart(spaceBefore bool) {
+	length := l.heredocStart()
+	start := string(l.src[l.pos+2 : l.pos+length])
+	l.pos += length
+
+	doc := heredoc{tokenIndex: len(l.tokens), interpolate: true, line: l.line}
+	switch start[0] {
+	case '-':
+		doc.indented = true
+		start = start[1:]
+	case '~':
+		doc.indented = true
+		doc.squiggly = true
+		start = start[1:]
+	}
+	switch start[0] {
+	case '\'':
+		doc.interpolate = false
+		start = start[1 : len(start)-1]
+	case '"':
+		start = start[1 : len(start)-1]
+	}
+	doc.id = start
+
+	l.emit(tokString, "", spaceBefore)
+	l.heredocs = append(l.heredocs, doc)
+}
+
+// lexHeredocBodies reads the bodies of the here documents started on the line that just ended
+func (l *rubyLexer) lexHeredocBodies() error {
+	for _, doc := range l.heredocs {
+		lines := []string{}
+		bodyLine := l.line
+		for {
+			if l.pos >= len(l.src) {
+				return l.unterminatedHeredoc(doc)
+			}
+			end := l.pos
+			for end < len(l.src) && l.src[end] != '\n' {
+				end++
+			}
+			line := string(l.src[l.pos:end])
+			l.pos = minInt(end+1, len(l.src))
+			l.line++
+
+			terminator := strings.TrimRight(line, " \t\r")
+			if doc.indented {
+				terminator = strings.TrimLeft(terminator, " \t")
+			}
+			if terminator == doc.id {
+				break
+			}
+			lines = append(lines, line+"\n")
+		}
+
+		if doc.squiggly {
+			lines = removeCommonIndentation(lines)
+		}
+		body := strings.Join(lines, "")
+
+		parts := []stringPart{{literal: body}}
+		if doc.interpolate {
+			// the body is lexed like a double quoted string terminated by the NUL appended to it
+			bodyLexer := &rubyLexer{src: append([]rune(body), 0), line: bodyLine}
+			var err error
+			parts, err = bodyLexer.lexDoubleQuoted(0)
+			if err != nil {
+				return err
+			}
+		}
+		l.tokens[doc.tokenIndex].parts = parts
+	}
+	l.heredocs = nil
+	return nil
+}
+
+func (l *rubyLexer) unterminatedHeredoc(doc heredoc) error {
+	return rubySyntaxError{msg: fmt.Sprintf("can't find string \"%s\" anywhere before EOF", doc.id), line: doc.line}
+}
+
+// removeCommonIndentation removes the indentation of the least indented line that is not blank from all lines
+func removeCommonIndentation(lines []string) []string {
+	indentation := -1
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		lineIndentation := len(line) - len(strings.TrimLeft(line, " \t"))
+		if indentation < 0 || lineIndentation < indentation {
+			indentation = lineIndentation
+		}
+	}
+
+	dedented := make([]string, len(lines))
+	for i, line := range lines {
+		if len(line)-len(strings.TrimLeft(line, " \t")) >= indentation && indentation > 0 {
+			line = line[indentation:]
+		} else if strings.TrimSpace(line) == "" {
+			line = strings.TrimLeft(line, " \t")
+		}
+		dedented[i] = line
+	}
+	return dedented
+}
+
+func (l *rubyLexer) lexSingleQuoted(quote rune) (string, error) {
+	startLine := l.line
+	var literal []rune
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c == quote:
+			l.pos++
+			return string(literal), nil
+		case c == '\\' && (l.peek(1) == quote || l.peek(1) == '\\'):
+			literal = append(literal, l.peek(1))
+			l.pos += 2
+		default:
+			if c == '\n' {
+				l.line++
+			}
+			literal = append(literal, c)
+			l.pos++
+		}
+	}
+	return "", rubySyntaxError{msg: "unterminated string meets end of file", line: startLine}
+}
+
+func (l *rubyLexer) lexDoubleQuoted(quote rune) ([]stringPart, error) {
+	startLine := l.line
+	parts := []stringPart{}
+	var literal []rune
+
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c == quote:
+			l.pos++
+			if len(literal) > 0 || len(parts) == 0 {
+				parts = append(parts, stringPart{literal: string(literal)})
+			}
+			return parts, nil
+		case c == '\\':
+			literal = append(literal, unescapeRune(l.peek(1)))
+			l.pos += 2
+		case c == '#' && l.peek(1) == '{':
+			if len(literal) > 0 {
+				parts = append(parts, stringPart{literal: string(literal)})
+				literal = nil
+			}
+			l.pos += 2
+			codeLine := l.line
+			code, err := l.scanBalanced('{', '}')
+			if err != nil {
+				return nil, err
+			}
+			parts = append(parts, stringPart{code: code, isCode: true, line: codeLine})
+		default:
+			if c == '\n' {
+				l.line++
+			}
+			literal = append(literal, c)
+			l.pos++
+		}
+	}
+	return nil, rubySyntaxError{msg: "unterminated string meets end of file", line: startLine}
+}
+
+func unescapeRune(c rune) rune {
+	switch c {
+	case 'n':
+		return '\n'
+	case 't':
+		return '\t'
+	case 'r':
+		return '\r'
+	case '0':
+		return 0
+	case 's':
+		return ' '
+	case 'e':
+		return 0x1b
+	}
+	return c
+}
+
+// scanBalanced returns the source up to the closing delimiter, skipping over nested pairs and strings
+func (l *rubyLexer) scanBalanced(open rune, close rune) (string, error) {
+	startLine := l.line
+	start := l.pos
+	depth := 0
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c == '\n':
+			l.line++
+		case c == '\\':
+			l.pos++
+		case c == '"' || c == '\'':
+			l.pos++
+			for l.pos < len(l.src) && l.src[l.pos] != c {
+				if l.src[l.pos] == '\\' {
+					l.pos++
+				}
+				l.pos++
+			}
+		case c == open:
+			depth++
+		case c == close:
+			if depth == 0 {
+				code := string(l.src[start:l.pos])
+				l.pos++
+				return code, nil
+			}
+			depth--
+		}
+		l.pos++
+	}
+	return "", rubySyntaxError{msg: fmt.Sprintf("missing '%c'", close), line: startLine}
+}
+
+func (l *rubyLexer) lexWords(spaceBefore bool) error {
+	open := l.src[l.pos]
+	l.pos++
+	content, err := l.scanBalanced(open, closingDelimiter(open))
+	if err != nil {
+		return err
+	}
+	l.emit(tokWords, content, spaceBefore).words = strings.Fields(content)
+	return nil
+}
+
+func (l *rubyLexer) lexRegexp(spaceBefore bool) error {
+	startLine := l.line
+	var source []rune
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c == '/':
+			l.pos++
+			flags := ""
+			for l.pos < len(l.src) && strings.ContainsRune("imxo", l.src[l.pos]) {
+				flags += string(l.src[l.pos])
+				l.pos++
+			}
+			l.emit(tokRegexp, string(source), spaceBefore).words = []string{flags}
+			return nil
+		case c == '\\' && l.peek(1) == '/':
+			source = append(source, '/')
+			l.pos += 2
+		case c == '\\':
+			source = append(source, c, l.peek(1))
+			l.pos += 2
+		default:
+			if c == '\n' {
+				l.line++
+			}
+			source = append(source, c)
+			l.pos++
+		}
+	}
+	return rubySyntaxError{msg: "unterminated regexp meets end of file", line: startLine}
+}
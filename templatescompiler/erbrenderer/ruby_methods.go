@@ -0,0 +1,1177 @@
+package erbrenderer
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// objectMethod implements the methods every Ruby object responds to
+func (i *rubyInterpreter) objectMethod(receiver interface{}, name string, args []interface{}, block *rubyProc) (interface{}, error) {
+	switch name {
+	case "nil?":
+		return receiver == nil, nil
+	case "==", "eql?", "equal?":
+		if err := checkArgs(args, 1, 1); err != nil {
+			return nil, err
+		}
+		return rubyEqual(receiver, args[0]), nil
+	case "===":
+		if err := checkArgs(args, 1, 1); err != nil {
+			return nil, err
+		}
+		return caseEqual(receiver, args[0]), nil
+	case "<=>":
+		if err := checkArgs(args, 1, 1); err != nil {
+			return nil, err
+		}
+		c := compare(receiver, args[0])
+		if c == incomparable {
+			return nil, nil
+		}
+		return int64(c), nil
+	case "!":
+		return !truthy(receiver), nil
+	case "to_s":
+		return rubyToS(receiver), nil
+	case "inspect":
+		return rubyInspect(receiver), nil
+	case "to_json":
+		return generateJSON(receiver, false)
+	case "to_yaml":
+		return generateYAML(receiver)
+	case "is_a?", "kind_of?", "instance_of?":
+		if err := checkArgs(args, 1, 1); err != nil {
+			return nil, err
+		}
+		class, ok := args[0].(*rubyClass)
+		if !ok {
+			return nil, newRubyError("TypeError", "class or module required")
+		}
+		return isA(receiver, class.name), nil
+	case "class":
+		return &rubyClass{name: rubyClassName(receiver)}, nil
+	case "dup", "clone":
+		return shallowCopy(receiver), nil
+	case "freeze", "itself", "taint", "untaint":
+		return receiver, nil
+	case "frozen?":
+		return false, nil
+	case "tap":
+		_, err := i.callBlock(block, receiver)
+		return receiver, err
+	case "then", "yield_self":
+		return i.callBlock(block, receiver)
+	case "send", "public_send", "__send__":
+		if err := checkArgs(args, 1, -1); err != nil {
+			return nil, err
+		}
+		return i.callMethod(receiver, rubyToS(args[0]), args[1:], block)
+	case "respond_to?":
+		if err := checkArgs(args, 1, 2); err != nil {
+			return nil, err
+		}
+		if o, ok := receiver.(*openStruct); ok {
+			_, found := o.fields.get(rubyToS(args[0]))
+			return found, nil
+		}
+		return false, nil
+	}
+	return nil, errMethodMissing
+}
+
+func nilMethod(name string, args []interface{}) (interface{}, error) {
+	switch name {
+	case "to_a":
+		return newRubyArray(), nil
+	case "to_h":
+		return newRubyHash(), nil
+	case "to_i":
+		return int64(0), nil
+	case "to_f":
+		return float64(0), nil
+	case "&":
+		return false, nil
+	case "|":
+		if err := checkArgs(args, 1, 1); err != nil {
+			return nil, err
+		}
+		return truthy(args[0]), nil
+	}
+	return nil, errMethodMissing
+}
+
+func boolMethod(receiver bool, name string, args []interface{}) (interface{}, error) {
+	switch name {
+	case "&", "|", "^":
+		if err := checkArgs(args, 1, 1); err != nil {
+			return nil, err
+		}
+		other := truthy(args[0])
+		switch name {
+		case "&":
+			return receiver && other, nil
+		case "|":
+			return receiver || other, nil
+		}
+		return receiver != other, nil
+	}
+	return nil, errMethodMissing
+}
+
+func symbolMethod(receiver rubySymbol, name string, args []interface{}) (interface{}, error) {
+	switch name {
+	case "to_sym":
+		return receiver, nil
+	case "to_proc":
+		return &rubyProc{method: string(receiver)}, nil
+	case "length", "size":
+		return int64(utf8.RuneCountInString(string(receiver))), nil
+	case "upcase":
+		return rubySymbol(strings.ToUpper(string(receiver))), nil
+	case "downcase":
+		return rubySymbol(strings.ToLower(string(receiver))), nil
+	case "<", ">", "<=", ">=":
+		return compareWith(receiver, name, args)
+	}
+	return nil, errMethodMissing
+}
+
+func compareWith(receiver interface{}, op string, args []interface{}) (interface{}, error) {
+	if err := checkArgs(args, 1, 1); err != nil {
+		return nil, err
+	}
+	c := compare(receiver, args[0])
+	if c == incomparable {
+		return nil, newRubyError("ArgumentError", "comparison of %s with %s failed", rubyClassName(receiver), rubyInspect(args[0]))
+	}
+	switch op {
+	case "<":
+		return c < 0, nil
+	case ">":
+		return c > 0, nil
+	case "<=":
+		return c <= 0, nil
+	}
+	return c >= 0, nil
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+func toInt(value interface{}) (int64, error) {
+	switch v := value.(type) {
+	case int64:
+		return v, nil
+	case float64:
+		return int64(v), nil
+	case nil:
+		return 0, newRubyError("TypeError", "no implicit conversion from nil to integer")
+	}
+	return 0, newRubyError("TypeError", "no implicit conversion of %s into Integer", rubyClassName(value))
+}
+
+func (i *rubyInterpreter) numericMethod(receiver interface{}, name string, args []interface{}, block *rubyProc) (interface{}, error) {
+	integer, isInt := receiver.(int64)
+	float, _ := toFloat(receiver)
+
+	switch name {
+	case "+", "-", "*", "/", "%", "modulo", "**", "div", "fdiv":
+		if err := checkArgs(args, 1, 1); err != nil {
+			return nil, err
+		}
+		return arithmetic(receiver, name, args[0])
+	case "<", ">", "<=", ">=":
+		if len(args) == 1 {
+			if _, isNumeric := toFloat(args[0]); !isNumeric {
+				return nil, newRubyError("ArgumentError", "comparison of %s with %s failed", rubyClassName(receiver), rubyInspect(args[0]))
+			}
+		}
+		return compareWith(receiver, name, args)
+	case "-@":
+		if isInt {
+			return -integer, nil
+		}
+		return -float, nil
+	case "to_i", "to_int", "truncate":
+		if isInt {
+			return integer, nil
+		}
+		return int64(float), nil
+	case "to_f":
+		return float, nil
+	case "to_s":
+		if isInt && len(args) == 1 {
+			base, err := toInt(args[0])
+			if err != nil {
+				return nil, err
+			}
+			return strconv.FormatInt(integer, int(base)), nil
+		}
+		return rubyToS(receiver), nil
+	case "round", "floor", "ceil":
+		if isInt {
+			return integer, nil
+		}
+		digits := int64(0)
+		if len(args) == 1 {
+			var err error
+			digits, err = toInt(args[0])
+			if err != nil {
+				return nil, err
+			}
+		}
+		scale := math.Pow(10, float64(digits))
+		var rounded float64
+		switch name {
+		case "round":
+			rounded = math.Round(float*scale) / scale
+		case "floor":
+			rounded = math.Floor(float*scale) / scale
+		default:
+			rounded = math.Ceil(float*scale) / scale
+		}
+		if digits > 0 {
+			return rounded, nil
+		}
+		return int64(rounded), nil
+	case "abs", "magnitude":
+		if isInt {
+			if integer < 0 {
+				return -integer, nil
+			}
+			return integer, nil
+		}
+		return math.Abs(float), nil
+	case "zero?":
+		return float == 0, nil
+	case "positive?":
+		return float > 0, nil
+	case "negative?":
+		return float < 0, nil
+	case "integer?":
+		return isInt, nil
+	case "nan?":
+		return math.IsNaN(float), nil
+	case "between?":
+		if err := checkArgs(args, 2, 2); err != nil {
+			return nil, err
+		}
+		return compare(receiver, args[0]) >= 0 && compare(receiver, args[1]) <= 0, nil
+	}
+
+	if !isInt {
+		return nil, errMethodMissing
+	}
+
+	switch name {
+	case "even?":
+		return integer%2 == 0, nil
+	case "odd?":
+		return integer%2 != 0, nil
+	case "succ", "next":
+		return integer + 1, nil
+	case "pred":
+		return integer - 1, nil
+	case "chr":
+		return string(rune(integer)), nil
+	case "ord":
+		return integer, nil
+	case "times":
+		if block == nil {
+			// an array in place of an enumerator, e.g. for times.map
+			numbers := newRubyArray()
+			for n := int64(0); n < integer; n++ {
+				numbers.elements = append(numbers.elements, n)
+			}
+			return numbers, nil
+		}
+		for n := int64(0); n < integer; n++ {
+			_, err := i.callBlock(block, n)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return integer, nil
+	case "upto", "downto":
+		if err := checkArgs(args, 1, 1); err != nil {
+			return nil, err
+		}
+		limit, err := toInt(args[0])
+		if err != nil {
+			return nil, err
+		}
+		step := int64(1)
+		if name == "downto" {
+			step = -1
+		}
+		for n := integer; (step > 0 && n <= limit) || (step < 0 && n >= limit); n += step {
+			_, err := i.callBlock(block, n)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return integer, nil
+	}
+	return nil, errMethodMissing
+}
+
+// arithmetic implements the numeric operators, integer division and modulo round towards negative infinity like Ruby
+func arithmetic(left interface{}, op string, right interface{}) (interface{}, error) {
+	l, leftInt := left.(int64)
+	r, rightInt := right.(int64)
+	rf, rightNumeric := toFloat(right)
+	if !rightNumeric {
+		if right == nil {
+			return nil, newRubyError("TypeError", "nil can't be coerced into %s", rubyClassName(left))
+		}
+		return nil, newRubyError("TypeError", "%s can't be coerced into %s", rubyClassName(right), rubyClassName(left))
+	}
+
+	if leftInt && rightInt && op != "fdiv" {
+		switch op {
+		case "+":
+			return l + r, nil
+		case "-":
+			return l - r, nil
+		case "*":
+			return l * r, nil
+		case "/", "div", "%", "modulo":
+			if r == 0 {
+				return nil, newRubyError("ZeroDivisionError", "divided by 0")
+			}
+			quotient, remainder := l/r, l%r
+			if remainder != 0 && (remainder < 0) != (r < 0) {
+				quotient--
+				remainder += r
+			}
+			if op == "/" || op == "div" {
+				return quotient, nil
+			}
+			return remainder, nil
+		case "**":
+			if r >= 0 {
+				result := int64(1)
+				for n := int64(0); n < r; n++ {
+					result *= l
+				}
+				return result, nil
+			}
+			return math.Pow(float64(l), float64(r)), nil
+		}
+	}
+
+	lf, _ := toFloat(left)
+	switch op {
+	case "+":
+		return lf + rf, nil
+	case "-":
+		return lf - rf, nil
+	case "*":
+		return lf * rf, nil
+	case "/", "fdiv":
+		return lf / rf, nil
+	case "div":
+		if rf == 0 {
+			return nil, newRubyError("ZeroDivisionError", "divided by 0")
+		}
+		return int64(math.Floor(lf / rf)), nil
+	case "%", "modulo":
+		result := math.Mod(lf, rf)
+		if result != 0 && (result < 0) != (rf < 0) {
+			result += rf
+		}
+		return result, nil
+	case "**":
+		return math.Pow(lf, rf), nil
+	}
+	return nil, errMethodMissing
+}
+
+func stringArg(args []interface{}, index int) (string, error) {
+	switch v := args[index].(type) {
+	case string:
+		return v, nil
+	case rubySymbol:
+		return string(v), nil
+	}
+	return "", newRubyError("TypeError", "no implicit conversion of %s into String", rubyClassName(args[index]))
+}
+
+func (i *rubyInterpreter) stringMethod(receiver string, name string, args []interface{}, block *rubyProc) (interface{}, error) {
+	switch name {
+	case "+", "<<", "concat":
+		if err := checkArgs(args, 1, 1); err != nil {
+			return nil, err
+		}
+		other, isString := args[0].(string)
+		if !isString {
+			return nil, newRubyError("TypeError", "no implicit conversion of %s into String", rubyClassName(args[0]))
+		}
+		return receiver + other, nil
+	case "*":
+		if err := checkArgs(args, 1, 1); err != nil {
+			return nil, err
+		}
+		count, err := toInt(args[0])
+		if err != nil {
+			return nil, err
+		}
+		if count < 0 {
+			return nil, newRubyError("ArgumentError", "negative argument")
+		}
+		return strings.Repeat(receiver, int(count)), nil
+	case "%":
+		if err := checkArgs(args, 1, 1); err != nil {
+			return nil, err
+		}
+		if array, isArray := args[0].(*rubyArray); isArray {
+			return rubySprintf(receiver, array.elements)
+		}
+		return rubySprintf(receiver, args)
+	case "<", ">", "<=", ">=", "between?":
+		if name == "between?" {
+			if err := checkArgs(args, 2, 2); err != nil {
+				return nil, err
+			}
+			return compare(receiver, args[0]) >= 0 && compare(receiver, args[1]) <= 0, nil
+		}
+		return compareWith(receiver, name, args)
+	case "=~":
+		if err := checkArgs(args, 1, 1); err != nil {
+			return nil, err
+		}
+		re, ok := args[0].(*rubyRegexp)
+		if !ok {
+			return nil, newRubyError("TypeError", "wrong argument type %s (expected Regexp)", rubyClassName(args[0]))
+		}
+		return matchIndex(re, receiver), nil
+	case "match", "match?":
+		if err := checkArgs(args, 1, 1); err != nil {
+			return nil, err
+		}
+		re, err := patternArg(args[0])
+		if err != nil {
+			return nil, err
+		}
+		if name == "match?" {
+			return re.MatchString(receiver), nil
+		}
+		return matchData(re, receiver), nil
+	case "scan":
+		if err := checkArgs(args, 1, 1); err != nil {
+			return nil, err
+		}
+		re, err := patternArg(args[0])
+		if err != nil {
+			return nil, err
+		}
+		matches := newRubyArray()
+		for _, match := range re.FindAllStringSubmatch(receiver, -1) {
+			if len(match) == 1 {
+				matches.elements = append(matches.elements, match[0])
+				continue
+			}
+			groups := newRubyArray()
+			for _, group := range match[1:] {
+				groups.elements = append(groups.elements, group)
+			}
+			matches.elements = append(matches.elements, groups)
+		}
+		return matches, nil
+	case "length", "size":
+		return int64(utf8.RuneCountInString(receiver)), nil
+	case "bytesize":
+		return int64(len(receiver)), nil
+	case "upcase":
+		return strings.ToUpper(receiver), nil
+	case "downcase":
+		return strings.ToLower(receiver), nil
+	case "capitalize":
+		if receiver == "" {
+			return receiver, nil
+		}
+		first, size := utf8.DecodeRuneInString(receiver)
+		return string(unicode.ToUpper(first)) + strings.ToLower(receiver[size:]), nil
+	case "swapcase":
+		return strings.Map(func(r rune) rune {
+			if unicode.IsUpper(r) {
+				return unicode.ToLower(r)
+			}
+			return unicode.ToUpper(r)
+		}, receiver), nil
+	case "strip":
+		return strings.TrimSpace(strings.Trim(receiver, "\x00")), nil
+	case "lstrip":
+		return strings.TrimLeftFunc(receiver, unicode.IsSpace), nil
+	case "rstrip":
+		return strings.TrimRightFunc(receiver, unicode.IsSpace), nil
+	case "chomp":
+		if len(args) == 1 {
+			suffix, err := stringArg(args, 0)
+			if err != nil {
+				return nil, err
+			}
+			return strings.TrimSuffix(receiver, suffix), nil
+		}
+		if strings.HasSuffix(receiver, "\r\n") {
+			return receiver[:len(receiver)-2], nil
+		}
+		return strings.TrimSuffix(strings.TrimSuffix(receiver, "\n"), "\r"), nil
+	case "chop":
+		if receiver == "" {
+			return receiver, nil
+		}
+		if strings.HasSuffix(receiver, "\r\n") {
+			return receiver[:len(receiver)-2], nil
+		}
+		_, size := utf8.DecodeLastRuneInString(receiver)
+		return receiver[:len(receiver)-size], nil
+	case "chars":
+		chars := newRubyArray()
+		for _, r := range receiver {
+			chars.elements = append(chars.elements, string(r))
+		}
+		return chars, nil
+	case "lines":
+		lines := newRubyArray()
+		for _, line := range strings.SplitAfter(receiver, "\n") {
+			if line != "" {
+				lines.elements = append(lines.elements, line)
+			}
+		}
+		return lines, nil
+	case "each_line", "each_char":
+		method := "lines"
+		if name == "each_char" {
+			method = "chars"
+		}
+		parts, _ := i.stringMethod(receiver, method, nil, nil)
+		if block == nil {
+			return parts, nil
+		}
+		for _, part := range parts.(*rubyArray).elements {
+			_, err := i.callBlock(block, part)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return receiver, nil
+	case "reverse":
+		runes := []rune(receiver)
+		for left, right := 0, len(runes)-1; left < right; left, right = left+1, right-1 {
+			runes[left], runes[right] = runes[right], runes[left]
+		}
+		return string(runes), nil
+	case "empty?":
+		return receiver == "", nil
+	case "include?":
+		if err := checkArgs(args, 1, 1); err != nil {
+			return nil, err
+		}
+		other, err := stringArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		return strings.Contains(receiver, other), nil
+	case "start_with?", "end_with?":
+		for index := range args {
+			affix, err := stringArg(args, index)
+			if err != nil {
+				return nil, err
+			}
+			if (name == "start_with?" && strings.HasPrefix(receiver, affix)) || (name == "end_with?" && strings.HasSuffix(receiver, affix)) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "delete_prefix", "delete_suffix":
+		if err := checkArgs(args, 1, 1); err != nil {
+			return nil, err
+		}
+		affix, err := stringArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		if name == "delete_prefix" {
+			return strings.TrimPrefix(receiver, affix), nil
+		}
+		return strings.TrimSuffix(receiver, affix), nil
+	case "index", "rindex":
+		if err := checkArgs(args, 1, 1); err != nil {
+			return nil, err
+		}
+		var byteIndex int
+		if re, isRegexp := args[0].(*rubyRegexp); isRegexp {
+			byteIndex = -1
+			if name == "index" {
+				if location := re.re.FindStringIndex(receiver); location != nil {
+					byteIndex = location[0]
+				}
+			} else if locations := re.re.FindAllStringIndex(receiver, -1); len(locations) > 0 {
+				byteIndex = locations[len(locations)-1][0]
+			}
+		} else {
+			other, err := stringArg(args, 0)
+			if err != nil {
+				return nil, err
+			}
+			if name == "index" {
+				byteIndex = strings.Index(receiver, other)
+			} else {
+				byteIndex = strings.LastIndex(receiver, other)
+			}
+		}
+		if byteIndex < 0 {
+			return nil, nil
+		}
+		return int64(utf8.RuneCountInString(receiver[:byteIndex])), nil
+	case "count":
+		if err := checkArgs(args, 1, 1); err != nil {
+			return nil, err
+		}
+		set, err := stringArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		count := int64(0)
+		for _, r := range receiver {
+			if strings.ContainsRune(set, r) {
+				count++
+			}
+		}
+		return count, nil
+	case "split":
+		return splitString(receiver, args)
+	case "gsub", "sub":
+		return i.substitute(receiver, name == "gsub", args, block)
+	case "tr", "delete", "squeeze":
+		return translate(receiver, name, args)
+	case "to_i":
+		base := int64(10)
+		if len(args) == 1 {
+			var err error
+			base, err = toInt(args[0])
+			if err != nil {
+				return nil, err
+			}
+		}
+		return parseLeadingInt(receiver, int(base)), nil
+	case "to_f":
+		return parseLeadingFloat(receiver), nil
+	case "to_s", "to_str":
+		return receiver, nil
+	case "to_sym", "intern":
+		return rubySymbol(receiver), nil
+	case "[]", "slice":
+		return sliceString(receiver, args)
+	case "center", "ljust", "rjust":
+		return justify(receiver, name, args)
+	case "ord":
+		if receiver == "" {
+			return nil, newRubyError("ArgumentError", "empty string")
+		}
+		r, _ := utf8.DecodeRuneInString(receiver)
+		return int64(r), nil
+	case "hex":
+		return parseLeadingInt(strings.TrimPrefix(strings.TrimPrefix(receiver, "0x"), "0X"), 16), nil
+	case "casecmp":
+		if err := checkArgs(args, 1, 1); err != nil {
+			return nil, err
+		}
+		other, err := stringArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		return int64(strings.Compare(strings.ToLower(receiver), strings.ToLower(other))), nil
+	case "casecmp?":
+		if err := checkArgs(args, 1, 1); err != nil {
+			return nil, err
+		}
+		other, err := stringArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		return strings.EqualFold(receiver, other), nil
+	case "force_encoding", "encode", "unicode_normalize", "b", "scrub":
+		return receiver, nil
+	case "dump":
+		return inspectString(receiver), nil
+	}
+	return nil, errMethodMissing
+}
+
+func patternArg(pattern interface{}) (*regexp.Regexp, error) {
+	switch p := pattern.(type) {
+	case *rubyRegexp:
+		return p.re, nil
+	case string:
+		return regexp.MustCompile(regexp.QuoteMeta(p)), nil
+	}
+	return nil, newRubyError("TypeError", "wrong argument type %s (expected Regexp)", rubyClassName(pattern))
+}
+
+func matchIndex(re *rubyRegexp, s string) interface{} {
+	location := re.re.FindStringIndex(s)
+	if location == nil {
+		return nil
+	}
+	return int64(utf8.RuneCountInString(s[:location[0]]))
+}
+
+// matchData returns the match and its groups as an array, which supports the common MatchData#[] usages
+func matchData(re *regexp.Regexp, s string) interface{} {
+	match := re.FindStringSubmatch(s)
+	if match == nil {
+		return nil
+	}
+	groups := newRubyArray()
+	for _, group := range match {
+		groups.elements = append(groups.elements, group)
+	}
+	return groups
+}
+
+func splitString(s string, args []interface{}) (interface{}, error) {
+	if err := checkArgs(args, 0, 2); err != nil {
+		return nil, err
+	}
+
+	limit := int64(0)
+	if len(args) == 2 {
+		var err error
+		limit, err = toInt(args[1])
+		if err != nil {
+			return nil, err
+		}
+	}
+	n := -1
+	if limit > 0 {
+		n = int(limit)
+	}
+
+	var parts []string
+	switch {
+	case len(args) == 0 || args[0] == nil || args[0] == " ":
+		if n > 0 {
+			parts = strings.SplitN(strings.TrimLeftFunc(s, unicode.IsSpace), " ", n)
+		} else {
+			parts = strings.Fields(s)
+		}
+	default:
+		if re, isRegexp := args[0].(*rubyRegexp); isRegexp {
+			parts = re.re.Split(s, n)
+		} else {
+			separator, err := stringArg(args, 0)
+			if err != nil {
+				return nil, err
+			}
+			if separator == "" {
+				parts = strings.Split(s, "")
+			} else {
+				parts = strings.SplitN(s, separator, n)
+			}
+		}
+	}
+
+	if limit == 0 {
+		for len(parts) > 0 && parts[len(parts)-1] == "" {
+			parts = parts[:len(parts)-1]
+		}
+	}
+
+	result := newRubyArray()
+	for _, part := range parts {
+		result.elements = append(result.elements, part)
+	}
+	return result, nil
+}
+
+// substitute implements sub and gsub with a string, hash or block replacement
+func (i *rubyInterpreter) substitute(s string, global bool, args []interface{}, block *rubyProc) (interface{}, error) {
+	if block != nil {
+		if err := checkArgs(args, 1, 1); err != nil {
+			return nil, err
+		}
+	} else if err := checkArgs(args, 2, 2); err != nil {
+		return nil, err
+	}
+
+	re, err := patternArg(args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	n := 1
+	if global {
+		n = -1
+	}
+
+	var result strings.Builder
+	last := 0
+	for _, match := range re.FindAllStringSubmatchIndex(s, n) {
+		result.WriteString(s[last:match[0]])
+		matched := s[match[0]:match[1]]
+
+		var replacement string
+		switch {
+		case block != nil:
+			value, err := i.callBlock(block, matched)
+			if err != nil {
+				return nil, err
+			}
+			replacement = rubyToS(value)
+		default:
+			switch r := args[1].(type) {
+			case *rubyHash:
+				value, _ := r.get(matched)
+				replacement = rubyToS(value)
+			case string:
+				replacement = expandReplacement(re, r, s, match)
+			default:
+				return nil, newRubyError("TypeError", "no implicit conversion of %s into String", rubyClassName(args[1]))
+			}
+		}
+
+		result.WriteString(replacement)
+		last = match[1]
+	}
+	result.WriteString(s[last:])
+
+	return result.String(), nil
+}
+
+// expandReplacement expands the \0-\9, \& and \k<name> references of a sub/gsub replacement
+func expandReplacement(re *regexp.Regexp, replacement string, s string, match []int) string {
+	group := func(index int) string {
+		if index*2+1 >= len(match) || match[index*2] < 0 {
+			return ""
+		}
+		return s[match[index*2]:match[index*2+1]]
+	}
+
+	var result strings.Builder
+	for index := 0; index < len(replacement); index++ {
+		c := replacement[index]
+		if c != '\\' || index == len(replacement)-1 {
+			result.WriteByte(c)
+			continue
+		}
+
+		next := replacement[index+1]
+		switch {
+		case next >= '0' && next <= '9':
+			result.WriteString(group(int(next - '0')))
+			index++
+		case next == '&':
+			result.WriteString(group(0))
+			index++
+		case next == '\\':
+			result.WriteByte('\\')
+			index++
+		case next == 'k' && strings.HasPrefix(replacement[index+2:], "<"):
+			end := strings.IndexByte(replacement[index+2:], '>')
+			if end == -1 {
+				result.WriteByte(c)
+				continue
+			}
+			groupName := replacement[index+3 : index+2+end]
+			result.WriteString(group(re.SubexpIndex(groupName)))
+			index += 2 + end
+		default:
+			result.WriteByte(c)
+		}
+	}
+	return result.String()
+}
+
+// expandCharacterSet expands the a-z ranges and the leading ^ of a tr/delete/squeeze character set
+func expandCharacterSet(set string) ([]rune, bool) {
+	runes := []rune(set)
+	negated := len(runes) > 1 && runes[0] == '^'
+	if negated {
+		runes = runes[1:]
+	}
+
+	expanded := []rune{}
+	for index := 0; index < len(runes); index++ {
+		if index+2 < len(runes) && runes[index+1] == '-' && runes[index] <= runes[index+2] {
+			for r := runes[index]; r <= runes[index+2]; r++ {
+				expanded = append(expanded, r)
+			}
+			index += 2
+			continue
+		}
+		expanded = append(expanded, runes[index])
+	}
+	return expanded, negated
+}
+
+func translate(s string, name string, args []interface{}) (interface{}, error) {
+	expected := 1
+	if name == "tr" {
+		expected = 2
+	}
+	if name == "squeeze" && len(args) == 0 {
+		args = []interface{}{nil}
+	}
+	if err := checkArgs(args, expected, expected); err != nil {
+		return nil, err
+	}
+
+	var from []rune
+	negated := false
+	if args[0] != nil {
+		fromSet, err := stringArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		from, negated = expandCharacterSet(fromSet)
+	}
+	inSet := func(r rune) bool {
+		if args[0] == nil {
+			return true
+		}
+		for _, candidate := range from {
+			if candidate == r {
+				return !negated
+			}
+		}
+		return negated
+	}
+
+	var result strings.Builder
+	switch name {
+	case "delete":
+		for _, r := range s {
+			if !inSet(r) {
+				result.WriteRune(r)
+			}
+		}
+	case "squeeze":
+		previous := rune(-1)
+		for _, r := range s {
+			if r == previous && inSet(r) {
+				continue
+			}
+			result.WriteRune(r)
+			previous = r
+		}
+	case "tr":
+		toSet, err := stringArg(args, 1)
+		if err != nil {
+			return nil, err
+		}
+		to, _ := expandCharacterSet(toSet)
+		for _, r := range s {
+			if !inSet(r) {
+				result.WriteRune(r)
+				continue
+			}
+			if len(to) == 0 {
+				continue
+			}
+			position := len(to) - 1
+			if !negated {
+				for index, candidate := range from {
+					if candidate == r {
+						position = index
+						break
+					}
+				}
+			}
+			if position >= len(to) {
+				position = len(to) - 1
+			}
+			result.WriteRune(to[position])
+		}
+	}
+	return result.String(), nil
+}
+
+var leadingIntegerRegexp = regexp.MustCompile(`^\s*[-+]?[0-9a-zA-Z][0-9a-zA-Z_]*`)
+var leadingFloatRegexp = regexp.MustCompile(`^\s*[-+]?\d[\d_]*(\.\d[\d_]*)?([eE][-+]?\d+)?`)
+
+// parseLeadingInt implements String#to_i which ignores anything after the leading number
+func parseLeadingInt(s string, base int) int64 {
+	candidate := strings.Replace(strings.TrimSpace(leadingIntegerRegexp.FindString(s)), "_", "", -1)
+	for len(candidate) > 0 {
+		value, err := strconv.ParseInt(candidate, base, 64)
+		if err == nil {
+			return value
+		}
+		candidate = candidate[:len(candidate)-1]
+	}
+	return 0
+}
+
+func parseLeadingFloat(s string) float64 {
+	candidate := strings.Replace(strings.TrimSpace(leadingFloatRegexp.FindString(s)), "_", "", -1)
+	value, _ := strconv.ParseFloat(candidate, 64)
+	return value
+}
+
+// normalizeIndex turns a negative Ruby index into a positive one, it returns false when out of bounds
+func normalizeIndex(index int64, length int) (int, bool) {
+	if index < 0 {
+		index += int64(length)
+	}
+	return int(index), index >= 0 && index <= int64(length)
+}
+
+// sliceBounds resolves the index, start/length and range forms of [] into start and end positions
+func sliceBounds(args []interface{}, length int) (int, int, bool, bool, error) {
+	if err := checkArgs(args, 1, 2); err != nil {
+		return 0, 0, false, false, err
+	}
+
+	if r, isRange := args[0].(*rubyRange); isRange && len(args) == 1 {
+		from, err := toInt(r.from)
+		if err != nil {
+			return 0, 0, false, false, err
+		}
+		to, err := toInt(r.to)
+		if err != nil {
+			return 0, 0, false, false, err
+		}
+		start, ok := normalizeIndex(from, length)
+		if !ok {
+			return 0, 0, false, false, nil
+		}
+		if to < 0 {
+			to += int64(length)
+		}
+		if !r.exclusive {
+			to++
+		}
+		end := int(to)
+		if end > length {
+			end = length
+		}
+		if end < start {
+			end = start
+		}
+		return start, end, true, true, nil
+	}
+
+	index, err := toInt(args[0])
+	if err != nil {
+		return 0, 0, false, false, err
+	}
+
+	if len(args) == 2 {
+		count, err := toInt(args[1])
+		if err != nil {
+			return 0, 0, false, false, err
+		}
+		start, ok := normalizeIndex(index, length)
+		if !ok || count < 0 {
+			return 0, 0, false, false, nil
+		}
+		end := start + int(count)
+		if end > length {
+			end = length
+		}
+		return start, end, true, true, nil
+	}
+
+	start, ok := normalizeIndex(index, length)
+	if !ok || start == length {
+		return 0, 0, false, false, nil
+	}
+	return start, start + 1, false, true, nil
+}
+
+func sliceString(s string, args []interface{}) (interface{}, error) {
+	if len(args) == 1 {
+		switch pattern := args[0].(type) {
+		case string:
+			if strings.Contains(s, pattern) {
+				return pattern, nil
+			}
+			return nil, nil
+		case *rubyRegexp:
+			return pattern.re.FindString(s), nil
+		}
+	}
+
+	runes := []rune(s)
+	start, end, _, ok, err := sliceBounds(args, len(runes))
+	if err != nil || !ok {
+		return nil, err
+	}
+	return string(runes[start:end]), nil
+}
+
+func justify(s string, name string, args []interface{}) (interface{}, error) {
+	if err := checkArgs(args, 1, 2); err != nil {
+		return nil, err
+	}
+	width, err := toInt(args[0])
+	if err != nil {
+		return nil, err
+	}
+	padding := " "
+	if len(args) == 2 {
+		padding, err = stringArg(args, 1)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	missing := int(width) - utf8.RuneCountInString(s)
+	if missing <= 0 || padding == "" {
+		return s, nil
+	}
+
+	pad := func(count int) string {
+		return string([]rune(strings.Repeat(padding, count))[:count])
+	}
+
+	switch name {
+	case "ljust":
+		return s + pad(missing), nil
+	case "rjust":
+		return pad(missing) + s, nil
+	}
+	return pad(missing/2) + s + pad(missing-missing/2), nil
+}
+
+func regexpMethod(receiver *rubyRegexp, name string, args []interface{}) (interface{}, error) {
+	switch name {
+	case "=~", "match", "match?":
+		if err := checkArgs(args, 1, 1); err != nil {
+			return nil, err
+		}
+		if args[0] == nil {
+			if name == "match?" {
+				return false, nil
+			}
+			return nil, nil
+		}
+		s, err := stringArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		switch name {
+		case "=~":
+			return matchIndex(receiver, s), nil
+		case "match?":
+			return receiver.re.MatchString(s), nil
+		}
+		return matchData(receiver.re, s), nil
+	case "source":
+		return receiver.source, nil
+	}
+	return nil, errMethodMissing
+}
@@ -0,0 +1,1061 @@
+package erbrenderer
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type rubyParser struct {
+	tokens []token
+	pos    int
+	locals []map[string]bool
+	// noDo is set while parsing the arguments of a call without parentheses or a loop condition,
+	// a 'do' in that position belongs to the outer call or loop
+	noDo bool
+}
+
+// parseRubyTemplate parses the token stream of an ERB template into a list of statements
+func parseRubyTemplate(tokens []token) (nodes []rubyNode, err error) {
+	p := &rubyParser{tokens: tokens, locals: []map[string]bool{{}}}
+
+	defer func() {
+		if r := recover(); r != nil {
+			syntaxErr, ok := r.(rubySyntaxError)
+			if !ok {
+				panic(r)
+			}
+			err = syntaxErr
+		}
+	}()
+
+	nodes = p.parseStatements()
+	if p.cur().kind != tokEOF {
+		p.unexpected()
+	}
+	return nodes, nil
+}
+
+func (p *rubyParser) cur() token {
+	return p.tokens[p.pos]
+}
+
+func (p *rubyParser) peekToken(offset int) token {
+	if p.pos+offset < len(p.tokens) {
+		return p.tokens[p.pos+offset]
+	}
+	return p.tokens[len(p.tokens)-1]
+}
+
+func (p *rubyParser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *rubyParser) isOp(text string) bool {
+	t := p.cur()
+	return t.kind == tokOp && t.text == text
+}
+
+func (p *rubyParser) isKeyword(texts ...string) bool {
+	t := p.cur()
+	if t.kind != tokKeyword {
+		return false
+	}
+	for _, text := range texts {
+		if t.text == text {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *rubyParser) fail(line int, format string, args ...interface{}) {
+	panic(rubySyntaxError{msg: fmt.Sprintf(format, args...), line: line})
+}
+
+func (p *rubyParser) unexpected() {
+	t := p.cur()
+	switch t.kind {
+	case tokEOF:
+		p.fail(p.peekToken(-1).line, "unexpected end of template, expecting 'end'")
+	case tokNewline:
+		p.fail(t.line, "unexpected end of statement")
+	case tokText:
+		p.fail(t.line, "unexpected template text")
+	case tokOutput:
+		p.fail(t.line, "unexpected output tag")
+	case tokOutputEnd:
+		p.fail(t.line, "unexpected end of output tag")
+	case tokString:
+		p.fail(t.line, "unexpected string literal")
+	}
+	p.fail(t.line, "unexpected '%s'", t.text)
+}
+
+func (p *rubyParser) expectOp(text string) {
+	if !p.isOp(text) {
+		p.unexpected()
+	}
+	p.next()
+}
+
+func (p *rubyParser) expectKeyword(text string) {
+	if !p.isKeyword(text) {
+		p.unexpected()
+	}
+	p.next()
+}
+
+func (p *rubyParser) skipNewlines() {
+	for p.cur().kind == tokNewline {
+		p.next()
+	}
+}
+
+func (p *rubyParser) pushScope() {
+	p.locals = append(p.locals, map[string]bool{})
+}
+
+func (p *rubyParser) popScope() {
+	p.locals = p.locals[:len(p.locals)-1]
+}
+
+func (p *rubyParser) declare(name string) {
+	p.locals[len(p.locals)-1][name] = true
+}
+
+func (p *rubyParser) isLocal(name string) bool {
+	for _, scope := range p.locals {
+		if scope[name] {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *rubyParser) atTerminator(terminators []string) bool {
+	t := p.cur()
+	if t.kind == tokEOF || t.kind == tokOutputEnd {
+		return true
+	}
+	if t.kind != tokKeyword && t.kind != tokOp {
+		return false
+	}
+	for _, terminator := range terminators {
+		if t.text == terminator {
+			return true
+		}
+	}
+	return false
+}
+
+// parseStatements parses statements until one of the terminating keywords or operators
+func (p *rubyParser) parseStatements(terminators ...string) []rubyNode {
+	nodes := []rubyNode{}
+	for {
+		p.skipNewlines()
+		if p.atTerminator(terminators) {
+			return nodes
+		}
+
+		nodes = append(nodes, p.parseStatement())
+
+		if p.cur().kind != tokNewline && !p.atTerminator(terminators) {
+			p.unexpected()
+		}
+	}
+}
+
+func (p *rubyParser) parseStatement() rubyNode {
+	t := p.cur()
+	switch t.kind {
+	case tokText:
+		p.next()
+		return &textNode{nodeLine: nodeLine(t.line), text: t.text}
+	case tokOutput:
+		// like ERB, the value of the last statement of an output tag is output
+		p.next()
+		body := p.parseStatements()
+		if p.cur().kind != tokOutputEnd {
+			p.unexpected()
+		}
+		p.next()
+		return &outputNode{nodeLine: nodeLine(t.line), value: &beginNode{nodeLine: nodeLine(t.line), body: body}}
+	}
+	return p.parseExpressionStatement()
+}
+
+// parseExpressionStatement parses an expression followed by 'if', 'unless', 'while' or 'until' modifiers
+func (p *rubyParser) parseExpressionStatement() rubyNode {
+	node := p.parseLowExpression()
+	for {
+		t := p.cur()
+		switch {
+		case p.isKeyword("if"):
+			p.next()
+			node = &ifNode{nodeLine: nodeLine(t.line), condition: p.parseLowExpression(), then: []rubyNode{node}}
+		case p.isKeyword("unless"):
+			p.next()
+			node = &ifNode{nodeLine: nodeLine(t.line), condition: p.parseLowExpression(), otherwise: []rubyNode{node}}
+		case p.isKeyword("rescue"):
+			p.next()
+			node = &rescueNode{nodeLine: nodeLine(t.line), body: []rubyNode{node}, clauses: []rescueClause{{body: []rubyNode{p.parseLowExpression()}}}}
+		case p.isKeyword("while", "until"):
+			p.next()
+			node = &whileNode{nodeLine: nodeLine(t.line), condition: p.parseLowExpression(), until: t.text == "until", body: []rubyNode{node}}
+		default:
+			return node
+		}
+	}
+}
+
+// parseLowExpression parses the low precedence 'and', 'or' and 'not' operators
+func (p *rubyParser) parseLowExpression() rubyNode {
+	left := p.parseLowNot()
+	for p.isKeyword("and", "or") {
+		t := p.next()
+		p.skipNewlines()
+		right := p.parseLowNot()
+		if t.text == "and" {
+			left = &andNode{nodeLine: nodeLine(t.line), left: left, right: right}
+		} else {
+			left = &orNode{nodeLine: nodeLine(t.line), left: left, right: right}
+		}
+	}
+	return left
+}
+
+func (p *rubyParser) parseLowNot() rubyNode {
+	if p.isKeyword("not") {
+		t := p.next()
+		return &notNode{nodeLine: nodeLine(t.line), value: p.parseLowNot()}
+	}
+	return p.parseExpression()
+}
+
+var assignmentOperators = map[string]string{
+	"+=": "+", "-=": "-", "*=": "*", "/=": "/", "**=": "**", "||=": "||", "&&=": "&&",
+}
+
+func (p *rubyParser) parseExpression() rubyNode {
+	t := p.cur()
+	next := p.peekToken(1)
+
+	if t.kind == tokIdent && next.kind == tokOp {
+		if next.text == "=" {
+			p.next()
+			p.next()
+			p.skipNewlines()
+			p.declare(t.text)
+			return &assignNode{nodeLine: nodeLine(t.line), name: t.text, value: p.parseExpression()}
+		}
+		if op, ok := assignmentOperators[next.text]; ok {
+			p.next()
+			p.next()
+			p.skipNewlines()
+			p.declare(t.text)
+			target := &variableNode{nodeLine: nodeLine(t.line), name: t.text}
+			return &opAssignNode{nodeLine: nodeLine(t.line), target: target, op: op, value: p.parseExpression()}
+		}
+	}
+
+	left := p.parseTernary()
+
+	call, isCall := left.(*callNode)
+	if isCall && call.receiver != nil && call.block == nil {
+		if p.isOp("=") {
+			p.next()
+			p.skipNewlines()
+			value := p.parseExpression()
+			if call.name == "[]" {
+				return &indexAssignNode{nodeLine: call.nodeLine, receiver: call.receiver, args: call.args, value: value}
+			}
+			if len(call.args) == 0 {
+				return &callNode{nodeLine: call.nodeLine, receiver: call.receiver, name: call.name + "=", args: []rubyNode{value}}
+			}
+			p.fail(call.lineNumber(), "unexpected '='")
+		}
+		if op, ok := assignmentOperators[p.cur().text]; ok && p.cur().kind == tokOp {
+			p.next()
+			p.skipNewlines()
+			return &opAssignNode{nodeLine: call.nodeLine, target: call, op: op, value: p.parseExpression()}
+		}
+	}
+
+	return left
+}
+
+func (p *rubyParser) parseTernary() rubyNode {
+	condition := p.parseRange()
+	if !p.isOp("?") {
+		return condition
+	}
+	t := p.next()
+	p.skipNewlines()
+
+	var then rubyNode
+	if p.cur().kind == tokLabel {
+		// 'a ? b: c' lexes 'b:' as a label
+		label := p.next()
+		then = p.identifier(label)
+	} else {
+		then = p.parseTernary()
+		p.skipNewlines()
+		p.expectOp(":")
+	}
+	p.skipNewlines()
+	otherwise := p.parseTernary()
+
+	return &ifNode{nodeLine: nodeLine(t.line), condition: condition, then: []rubyNode{then}, otherwise: []rubyNode{otherwise}}
+}
+
+func (p *rubyParser) parseRange() rubyNode {
+	from := p.parseBinary(0)
+	if p.isOp("..") || p.isOp("...") {
+		t := p.next()
+		to := p.parseBinary(0)
+		return &rangeNode{nodeLine: nodeLine(t.line), from: from, to: to, exclusive: t.text == "..."}
+	}
+	return from
+}
+
+// binaryOperators lists the binary operators from the lowest to the highest precedence
+var binaryOperators = [][]string{
+	{"||"},
+	{"&&"},
+	{"<=>", "==", "===", "!=", "=~", "!~"},
+	{"<", ">", "<=", ">="},
+	{"<<"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func (p *rubyParser) parseBinary(level int) rubyNode {
+	if level == len(binaryOperators) {
+		return p.parseUnary()
+	}
+
+	left := p.parseBinary(level + 1)
+	for {
+		t := p.cur()
+		if t.kind != tokOp || !containsString(binaryOperators[level], t.text) {
+			return left
+		}
+		p.next()
+		p.skipNewlines()
+		right := p.parseBinary(level + 1)
+
+		line := nodeLine(t.line)
+		switch t.text {
+		case "||":
+			left = &orNode{nodeLine: line, left: left, right: right}
+		case "&&":
+			left = &andNode{nodeLine: line, left: left, right: right}
+		case "!=":
+			left = &notNode{nodeLine: line, value: &callNode{nodeLine: line, receiver: left, name: "==", args: []rubyNode{right}}}
+		case "!~":
+			left = &notNode{nodeLine: line, value: &callNode{nodeLine: line, receiver: left, name: "=~", args: []rubyNode{right}}}
+		default:
+			left = &callNode{nodeLine: line, receiver: left, name: t.text, args: []rubyNode{right}}
+		}
+	}
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *rubyParser) parseUnary() rubyNode {
+	t := p.cur()
+	switch {
+	case p.isOp("!"):
+		p.next()
+		return &notNode{nodeLine: nodeLine(t.line), value: p.parseUnary()}
+	case p.isOp("-"):
+		p.next()
+		next := p.cur()
+		if (next.kind == tokInt || next.kind == tokFloat) && !next.spaceBefore {
+			p.next()
+			literal := p.numberLiteral(token{kind: next.kind, text: "-" + next.text, line: next.line})
+			return p.parsePower(p.parsePostfix(literal))
+		}
+		return &callNode{nodeLine: nodeLine(t.line), receiver: p.parseUnary(), name: "-@"}
+	case p.isOp("+"):
+		p.next()
+		return p.parseUnary()
+	}
+	return p.parsePower(p.parsePostfix(p.parsePrimary()))
+}
+
+func (p *rubyParser) parsePower(base rubyNode) rubyNode {
+	if p.isOp("**") {
+		t := p.next()
+		p.skipNewlines()
+		return &callNode{nodeLine: nodeLine(t.line), receiver: base, name: "**", args: []rubyNode{p.parseUnary()}}
+	}
+	return base
+}
+
+func (p *rubyParser) parsePostfix(node rubyNode) rubyNode {
+	for {
+		t := p.cur()
+		switch {
+		case p.isOp(".") || (p.isOp("&") && p.peekToken(1).kind == tokOp && p.peekToken(1).text == "."):
+			safe := p.isOp("&")
+			if safe {
+				p.next()
+			}
+			p.next()
+			p.skipNewlines()
+			node = p.parseMethodCall(node, safe)
+		case t.kind == tokNewline && t.text == "\n" && p.peekToken(1).kind == tokOp && p.peekToken(1).text == ".":
+			// a method chain continued on the next line
+			p.next()
+		case p.isOp("::"):
+			p.next()
+			if namespace, isConst := node.(*constNode); isConst && p.cur().kind == tokIdent && !p.isOp("(") {
+				name := p.next()
+				node = &constNode{nodeLine: namespace.nodeLine, name: namespace.name + "::" + name.text}
+				continue
+			}
+			node = p.parseMethodCall(node, false)
+		case p.isOp("[") && !t.spaceBefore:
+			p.next()
+			args := p.parseArgs("]")
+			node = &callNode{nodeLine: nodeLine(t.line), receiver: node, name: "[]", args: args}
+		default:
+			return node
+		}
+	}
+}
+
+func (p *rubyParser) parseMethodCall(receiver rubyNode, safe bool) rubyNode {
+	t := p.cur()
+	switch t.kind {
+	case tokIdent, tokConst, tokKeyword:
+		p.next()
+	case tokOp:
+		if t.text != "(" {
+			p.unexpected()
+		}
+		// receiver.() calls the receiver
+		t = token{kind: tokIdent, text: "call", line: t.line}
+	default:
+		p.unexpected()
+	}
+
+	call := p.parseCallRest(receiver, t)
+	if safe {
+		return &ifNode{
+			nodeLine:  call.nodeLine,
+			condition: &notNode{nodeLine: call.nodeLine, value: &callNode{nodeLine: call.nodeLine, receiver: receiver, name: "nil?"}},
+			then:      []rubyNode{call},
+		}
+	}
+	return call
+}
+
+func (p *rubyParser) parseCallRest(receiver rubyNode, name token) *callNode {
+	call := &callNode{nodeLine: nodeLine(name.line), receiver: receiver, name: name.text}
+
+	if p.isOp("(") && !p.cur().spaceBefore {
+		p.next()
+		call.args = p.parseArgs(")")
+	} else if p.canStartCommandArg() {
+		noDo := p.noDo
+		p.noDo = true
+		call.args = p.parseCommandArgs()
+		p.noDo = noDo
+	}
+
+	call.block = p.parseBlock()
+	return call
+}
+
+// canStartCommandArg decides whether the current token starts the argument of a call without parentheses
+func (p *rubyParser) canStartCommandArg() bool {
+	t := p.cur()
+	if !t.spaceBefore {
+		return false
+	}
+	switch t.kind {
+	case tokString, tokInt, tokFloat, tokSymbol, tokIdent, tokConst, tokLabel, tokWords, tokRegexp:
+		return true
+	case tokKeyword:
+		return t.text == "nil" || t.text == "true" || t.text == "false" || t.text == "self"
+	case tokOp:
+		next := p.peekToken(1)
+		switch t.text {
+		case "[", "(", "::":
+			return true
+		case "-", "!", "&":
+			return !next.spaceBefore && next.kind != tokNewline
+		}
+	}
+	return false
+}
+
+func (p *rubyParser) parseArgs(closer string) []rubyNode {
+	noDo := p.noDo
+	p.noDo = false
+	defer func() { p.noDo = noDo }()
+
+	args := []rubyNode{}
+	var hash *hashNode
+	for {
+		p.skipNewlines()
+		if p.isOp(closer) {
+			p.next()
+			return args
+		}
+
+		args, hash = p.parseArg(args, hash)
+
+		p.skipNewlines()
+		if p.isOp(",") {
+			p.next()
+		} else if !p.isOp(closer) {
+			p.unexpected()
+		}
+	}
+}
+
+func (p *rubyParser) parseCommandArgs() []rubyNode {
+	args := []rubyNode{}
+	var hash *hashNode
+	for {
+		args, hash = p.parseArg(args, hash)
+		if !p.isOp(",") {
+			return args
+		}
+		p.next()
+		p.skipNewlines()
+	}
+}
+
+// parseArg parses a call argument, 'key: value' and 'key => value' pairs are collected into a trailing hash
+func (p *rubyParser) parseArg(args []rubyNode, hash *hashNode) ([]rubyNode, *hashNode) {
+	t := p.cur()
+
+	addPair := func(key rubyNode, value rubyNode) {
+		if hash == nil {
+			hash = &hashNode{nodeLine: nodeLine(t.line)}
+			args = append(args, hash)
+		}
+		hash.keys = append(hash.keys, key)
+		hash.values = append(hash.values, value)
+	}
+
+	switch {
+	case t.kind == tokLabel:
+		p.next()
+		p.skipNewlines()
+		addPair(&literalNode{nodeLine: nodeLine(t.line), value: rubySymbol(t.text)}, p.parseExpression())
+	case p.isOp("&"):
+		p.next()
+		symbol := p.next()
+		if symbol.kind != tokSymbol {
+			p.fail(symbol.line, "only symbols are supported as block arguments")
+		}
+		args = append(args, &blockPassNode{nodeLine: nodeLine(t.line), method: symbol.text})
+	default:
+		value := p.parseExpression()
+		if p.isOp("=>") {
+			p.next()
+			p.skipNewlines()
+			addPair(value, p.parseExpression())
+		} else {
+			args = append(args, value)
+		}
+	}
+	return args, hash
+}
+
+func (p *rubyParser) parseBlock() *blockNode {
+	t := p.cur()
+	var closer string
+	switch {
+	case p.isOp("{"):
+		closer = "}"
+	case p.isKeyword("do") && !p.noDo:
+		closer = "end"
+	default:
+		return nil
+	}
+	p.next()
+
+	noDo := p.noDo
+	p.noDo = false
+	defer func() { p.noDo = noDo }()
+
+	p.pushScope()
+	defer p.popScope()
+
+	block := &blockNode{nodeLine: nodeLine(t.line)}
+	if p.isOp("||") {
+		p.next()
+	} else if p.isOp("|") {
+		p.next()
+		for !p.isOp("|") {
+			param := blockParam{}
+			if p.isOp("(") {
+				p.next()
+				for !p.isOp(")") {
+					param.nested = append(param.nested, p.parseParamName())
+					if p.isOp(",") {
+						p.next()
+					}
+				}
+				p.next()
+			} else {
+				param.name = p.parseParamName()
+			}
+			block.params = append(block.params, param)
+			if p.isOp(",") {
+				p.next()
+			}
+		}
+		p.next()
+	}
+
+	block.body = p.parseStatements(closer)
+	if closer == "}" {
+		p.expectOp("}")
+	} else {
+		p.expectKeyword("end")
+	}
+	return block
+}
+
+func (p *rubyParser) parseParamName() string {
+	param := p.next()
+	if param.kind != tokIdent {
+		p.fail(param.line, "unsupported parameter '%s'", param.text)
+	}
+	p.declare(param.text)
+	return param.text
+}
+
+func (p *rubyParser) parsePrimary() rubyNode {
+	t := p.cur()
+	line := nodeLine(t.line)
+
+	switch t.kind {
+	case tokInt, tokFloat:
+		p.next()
+		return p.numberLiteral(t)
+	case tokString:
+		p.next()
+		return p.stringLiteral(t)
+	case tokSymbol:
+		p.next()
+		return &literalNode{nodeLine: line, value: rubySymbol(t.text)}
+	case tokRegexp:
+		p.next()
+		re, err := compileRubyRegexp(t.text, t.words[0])
+		if err != nil {
+			p.fail(t.line, "invalid regexp /%s/: %s", t.text, err.Error())
+		}
+		return &regexpNode{nodeLine: line, re: re, source: t.text}
+	case tokWords:
+		p.next()
+		words := &arrayNode{nodeLine: line}
+		for _, word := range t.words {
+			words.elements = append(words.elements, &literalNode{nodeLine: line, value: word})
+		}
+		return words
+	case tokConst:
+		p.next()
+		if p.isOp("(") && !p.cur().spaceBefore {
+			// conversion methods such as Integer("1")
+			return p.parseCallRest(nil, t)
+		}
+		return &constNode{nodeLine: line, name: t.text}
+	case tokIdent:
+		p.next()
+		return p.identifier(t)
+	case tokKeyword:
+		return p.parseKeyword()
+	case tokOp:
+		switch t.text {
+		case "(":
+			p.next()
+			noDo := p.noDo
+			p.noDo = false
+			body := p.parseStatements(")")
+			p.noDo = noDo
+			p.expectOp(")")
+			switch len(body) {
+			case 0:
+				return &literalNode{nodeLine: line}
+			case 1:
+				return body[0]
+			}
+			return &beginNode{nodeLine: line, body: body}
+		case "[":
+			p.next()
+			args := p.parseArgs("]")
+			for _, arg := range args {
+				if _, ok := arg.(*blockPassNode); ok {
+					p.fail(t.line, "unexpected '&'")
+				}
+			}
+			return &arrayNode{nodeLine: line, elements: args}
+		case "{":
+			p.next()
+			return p.parseHash(t)
+		case "::":
+			p.next()
+			name := p.next()
+			if name.kind != tokConst {
+				p.unexpected()
+			}
+			return &constNode{nodeLine: line, name: name.text}
+		}
+	}
+
+	p.unexpected()
+	return nil
+}
+
+func (p *rubyParser) identifier(t token) rubyNode {
+	if p.isLocal(t.text) && !(p.isOp("(") && !p.cur().spaceBefore) {
+		return &variableNode{nodeLine: nodeLine(t.line), name: t.text}
+	}
+	return p.parseCallRest(nil, t)
+}
+
+func (p *rubyParser) numberLiteral(t token) rubyNode {
+	if t.kind == tokFloat {
+		value, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			p.fail(t.line, "invalid float literal '%s'", t.text)
+		}
+		return &literalNode{nodeLine: nodeLine(t.line), value: value}
+	}
+
+	value, err := strconv.ParseInt(t.text, 10, 64)
+	if err != nil {
+		p.fail(t.line, "invalid integer literal '%s'", t.text)
+	}
+	return &literalNode{nodeLine: nodeLine(t.line), value: value}
+}
+
+func (p *rubyParser) stringLiteral(t token) rubyNode {
+	node := &stringNode{nodeLine: nodeLine(t.line)}
+	for _, part := range t.parts {
+		if !part.isCode {
+			node.parts = append(node.parts, &literalNode{nodeLine: nodeLine(t.line), value: part.literal})
+			continue
+		}
+
+		tokens, err := lexRuby(part.code, part.line)
+		if err != nil {
+			panic(err)
+		}
+		embedded := &rubyParser{tokens: append(tokens, token{kind: tokEOF, line: part.line}), locals: p.locals}
+		body := embedded.parseStatements()
+		if embedded.cur().kind != tokEOF {
+			embedded.unexpected()
+		}
+		node.parts = append(node.parts, &beginNode{nodeLine: nodeLine(part.line), body: body})
+	}
+	return node
+}
+
+func (p *rubyParser) parseHash(open token) rubyNode {
+	noDo := p.noDo
+	p.noDo = false
+	defer func() { p.noDo = noDo }()
+
+	hash := &hashNode{nodeLine: nodeLine(open.line)}
+	for {
+		p.skipNewlines()
+		if p.isOp("}") {
+			p.next()
+			return hash
+		}
+
+		t := p.cur()
+		if t.kind == tokLabel {
+			p.next()
+			hash.keys = append(hash.keys, &literalNode{nodeLine: nodeLine(t.line), value: rubySymbol(t.text)})
+		} else {
+			hash.keys = append(hash.keys, p.parseExpression())
+			p.skipNewlines()
+			p.expectOp("=>")
+		}
+		p.skipNewlines()
+		hash.values = append(hash.values, p.parseExpression())
+
+		p.skipNewlines()
+		if p.isOp(",") {
+			p.next()
+		} else if !p.isOp("}") {
+			p.unexpected()
+		}
+	}
+}
+
+func (p *rubyParser) parseKeyword() rubyNode {
+	t := p.next()
+	line := nodeLine(t.line)
+
+	switch t.text {
+	case "nil":
+		return &literalNode{nodeLine: line}
+	case "true":
+		return &literalNode{nodeLine: line, value: true}
+	case "false":
+		return &literalNode{nodeLine: line, value: false}
+	case "self":
+		return &selfNode{nodeLine: line}
+	case "if":
+		return p.parseIf(t, p.parseConditionExpression())
+	case "unless":
+		condition := p.parseConditionExpression()
+		p.skipThen()
+		then := p.parseStatements("else", "end")
+		node := &ifNode{nodeLine: line, condition: &notNode{nodeLine: line, value: condition}, then: then}
+		if p.isKeyword("else") {
+			p.next()
+			node.otherwise = p.parseStatements("end")
+		}
+		p.expectKeyword("end")
+		return node
+	case "while", "until":
+		condition := p.parseConditionExpression()
+		if p.isKeyword("do") {
+			p.next()
+		}
+		body := p.parseStatements("end")
+		p.expectKeyword("end")
+		return &whileNode{nodeLine: line, condition: condition, until: t.text == "until", body: body}
+	case "case":
+		return p.parseCase(t)
+	case "for":
+		return p.parseFor(t)
+	case "begin":
+		return &beginNode{nodeLine: line, body: p.parseBodyWithRescue(t)}
+	case "def":
+		return p.parseDef(t)
+	case "next":
+		node := &nextNode{nodeLine: line}
+		if p.hasJumpValue() {
+			node.value = p.parseExpression()
+		}
+		return node
+	case "return":
+		node := &returnNode{nodeLine: line}
+		if p.hasJumpValue() {
+			node.value = p.parseExpression()
+		}
+		return node
+	case "yield":
+		node := &yieldNode{nodeLine: line}
+		if p.isOp("(") && !p.cur().spaceBefore {
+			p.next()
+			node.args = p.parseArgs(")")
+		} else if p.canStartCommandArg() {
+			node.args = p.parseCommandArgs()
+		}
+		return node
+	case "not":
+		return &notNode{nodeLine: line, value: p.parseExpression()}
+	}
+
+	p.pos--
+	p.unexpected()
+	return nil
+}
+
+func (p *rubyParser) hasJumpValue() bool {
+	return p.cur().kind != tokNewline && p.cur().kind != tokEOF && p.cur().kind != tokOutputEnd && !p.isKeyword("if", "unless", "end") && !p.isOp("}")
+}
+
+// parseBodyWithRescue parses the body of a begin or def up to its 'end', including rescue and ensure clauses
+func (p *rubyParser) parseBodyWithRescue(t token) []rubyNode {
+	body := p.parseStatements("rescue", "ensure", "end")
+	if !p.isKeyword("rescue", "ensure") {
+		p.expectKeyword("end")
+		return body
+	}
+
+	node := &rescueNode{nodeLine: nodeLine(t.line), body: body}
+	for p.isKeyword("rescue") {
+		p.next()
+		clause := rescueClause{}
+		for p.cur().kind == tokConst {
+			clause.classes = append(clause.classes, p.parsePostfix(p.parsePrimary()))
+			if !p.isOp(",") {
+				break
+			}
+			p.next()
+		}
+		if p.isOp("=>") {
+			p.next()
+			clause.variable = p.parseParamName()
+		}
+		p.skipThen()
+		clause.body = p.parseStatements("rescue", "ensure", "end")
+		node.clauses = append(node.clauses, clause)
+	}
+	if p.isKeyword("ensure") {
+		p.next()
+		node.ensureBody = p.parseStatements("end")
+	}
+	p.expectKeyword("end")
+
+	return []rubyNode{node}
+}
+
+func (p *rubyParser) parseDef(t token) rubyNode {
+	name := p.next()
+	if name.kind != tokIdent && name.kind != tokConst && name.kind != tokLabel {
+		p.fail(name.line, "unexpected '%s', expecting a method name", name.text)
+	}
+	node := &defNode{nodeLine: nodeLine(t.line), name: name.text}
+
+	// methods do not see the local variables of the template
+	locals := p.locals
+	p.locals = []map[string]bool{{}}
+	defer func() { p.locals = locals }()
+
+	parenthesized := p.isOp("(")
+	if parenthesized {
+		p.next()
+	}
+	for (parenthesized && !p.isOp(")")) || (!parenthesized && p.cur().kind == tokIdent) {
+		param := methodParam{name: p.parseParamName()}
+		if p.isOp("=") {
+			p.next()
+			param.defaultValue = p.parseTernary()
+		}
+		node.params = append(node.params, param)
+		if !p.isOp(",") {
+			break
+		}
+		p.next()
+	}
+	if parenthesized {
+		p.expectOp(")")
+	}
+
+	node.body = p.parseBodyWithRescue(t)
+	return node
+}
+
+func (p *rubyParser) parseConditionExpression() rubyNode {
+	noDo := p.noDo
+	p.noDo = true
+	defer func() { p.noDo = noDo }()
+	return p.parseLowExpression()
+}
+
+func (p *rubyParser) skipThen() {
+	if p.isKeyword("then") {
+		p.next()
+	}
+}
+
+func (p *rubyParser) parseIf(t token, condition rubyNode) rubyNode {
+	p.skipThen()
+	node := &ifNode{nodeLine: nodeLine(t.line), condition: condition, then: p.parseStatements("elsif", "else", "end")}
+
+	if p.isKeyword("elsif") {
+		elsif := p.next()
+		node.otherwise = []rubyNode{p.parseIf(elsif, p.parseConditionExpression())}
+		return node
+	}
+
+	if p.isKeyword("else") {
+		p.next()
+		node.otherwise = p.parseStatements("end")
+	}
+	p.expectKeyword("end")
+	return node
+}
+
+func (p *rubyParser) parseCase(t token) rubyNode {
+	node := &caseNode{nodeLine: nodeLine(t.line)}
+	if p.cur().kind != tokNewline {
+		node.subject = p.parseLowExpression()
+	}
+	p.skipNewlines()
+
+	for p.isKeyword("when") {
+		p.next()
+		clause := whenClause{}
+		for {
+			clause.values = append(clause.values, p.parseTernary())
+			if !p.isOp(",") {
+				break
+			}
+			p.next()
+			p.skipNewlines()
+		}
+		p.skipThen()
+		clause.body = p.parseStatements("when", "else", "end")
+		node.whens = append(node.whens, clause)
+	}
+
+	if len(node.whens) == 0 {
+		p.unexpected()
+	}
+
+	if p.isKeyword("else") {
+		p.next()
+		node.otherwise = p.parseStatements("end")
+	}
+	p.expectKeyword("end")
+	return node
+}
+
+func (p *rubyParser) parseFor(t token) rubyNode {
+	node := &forNode{nodeLine: nodeLine(t.line)}
+	for {
+		name := p.next()
+		if name.kind != tokIdent {
+			p.fail(name.line, "unexpected '%s', expecting a variable name", name.text)
+		}
+		p.declare(name.text)
+		node.vars = append(node.vars, name.text)
+		if !p.isOp(",") {
+			break
+		}
+		p.next()
+	}
+	p.expectKeyword("in")
+	node.collection = p.parseConditionExpression()
+	if p.isKeyword("do") {
+		p.next()
+	}
+	node.body = p.parseStatements("end")
+	p.expectKeyword("end")
+	return node
+}
+
+// compileRubyRegexp translates a Ruby regular expression into the RE2 syntax.
+// In Ruby '^' and '$' always match at line boundaries and the 'm' flag lets '.' match newlines.
+func compileRubyRegexp(source string, flags string) (*regexp.Regexp, error) {
+	goFlags := "m"
+	if strings.Contains(flags, "i") {
+		goFlags += "i"
+	}
+	if strings.Contains(flags, "m") {
+		goFlags += "s"
+	}
+
+	replacer := strings.NewReplacer(`\Z`, `\z`, `\h`, `[0-9a-fA-F]`, `\H`, `[^0-9a-fA-F]`)
+	return regexp.Compile("(?" + goFlags + ")" + replacer.Replace(source))
+}
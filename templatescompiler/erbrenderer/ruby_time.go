@@ -0,0 +1,272 @@
+package erbrenderer
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Ruby Time values are represented by time.Time
+
+// timeClassMethod implements Time.now, Time.at and the Time constructors
+func timeClassMethod(name string, args []interface{}) (interface{}, error) {
+	switch name {
+	case "now":
+		if err := checkArgs(args, 0, 0); err != nil {
+			return nil, err
+		}
+		return time.Now(), nil
+	case "at":
+		if err := checkArgs(args, 1, 1); err != nil {
+			return nil, err
+		}
+		switch seconds := args[0].(type) {
+		case int64:
+			return time.Unix(seconds, 0), nil
+		case float64:
+			whole, fraction := math.Modf(seconds)
+			return time.Unix(int64(whole), int64(fraction*1e9)), nil
+		case time.Time:
+			return seconds, nil
+		}
+		return nil, newRubyError("TypeError", "can't convert %s into an exact number", rubyClassName(args[0]))
+	case "new", "local", "mktime", "utc", "gm":
+		if name == "new" && len(args) == 0 {
+			return time.Now(), nil
+		}
+		if err := checkArgs(args, 1, 7); err != nil {
+			return nil, err
+		}
+		fields := []int64{0, 1, 1, 0, 0, 0}
+		for index, arg := range args[:minInt(len(args), len(fields))] {
+			field, err := toInt(arg)
+			if err != nil {
+				return nil, err
+			}
+			fields[index] = field
+		}
+		location := time.Local
+		if name == "utc" || name == "gm" {
+			location = time.UTC
+		}
+		return time.Date(int(fields[0]), time.Month(fields[1]), int(fields[2]), int(fields[3]), int(fields[4]), int(fields[5]), 0, location), nil
+	}
+	return nil, errMethodMissing
+}
+
+func timeMethod(receiver time.Time, name string, args []interface{}) (interface{}, error) {
+	switch name {
+	case "to_i", "tv_sec":
+		return receiver.Unix(), nil
+	case "to_f":
+		return float64(receiver.UnixNano()) / 1e9, nil
+	case "year":
+		return int64(receiver.Year()), nil
+	case "month", "mon":
+		return int64(receiver.Month()), nil
+	case "day", "mday":
+		return int64(receiver.Day()), nil
+	case "hour":
+		return int64(receiver.Hour()), nil
+	case "min":
+		return int64(receiver.Minute()), nil
+	case "sec":
+		return int64(receiver.Second()), nil
+	case "usec":
+		return int64(receiver.Nanosecond() / 1000), nil
+	case "nsec":
+		return int64(receiver.Nanosecond()), nil
+	case "wday":
+		return int64(receiver.Weekday()), nil
+	case "yday":
+		return int64(receiver.YearDay()), nil
+	case "utc", "getutc", "gmtime", "getgm":
+		return receiver.UTC(), nil
+	case "localtime", "getlocal":
+		return receiver.Local(), nil
+	case "utc?", "gmt?":
+		return receiver.Location() == time.UTC, nil
+	case "zone":
+		zone, _ := receiver.Zone()
+		return zone, nil
+	case "utc_offset", "gmt_offset":
+		_, offset := receiver.Zone()
+		return int64(offset), nil
+	case "iso8601", "xmlschema":
+		if err := checkArgs(args, 0, 1); err != nil {
+			return nil, err
+		}
+		layout := "2006-01-02T15:04:05"
+		if len(args) == 1 {
+			digits, err := toInt(args[0])
+			if err != nil {
+				return nil, err
+			}
+			if digits > 0 {
+				layout += "." + strings.Repeat("0", int(digits))
+			}
+		}
+		return receiver.Format(layout + "Z07:00"), nil
+	case "strftime":
+		if err := checkArgs(args, 1, 1); err != nil {
+			return nil, err
+		}
+		format, err := stringArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		return strftime(receiver, format), nil
+	case "+", "-":
+		if err := checkArgs(args, 1, 1); err != nil {
+			return nil, err
+		}
+		if other, isTime := args[0].(time.Time); isTime && name == "-" {
+			return receiver.Sub(other).Seconds(), nil
+		}
+		seconds, isNumeric := toFloat(args[0])
+		if !isNumeric {
+			return nil, newRubyError("TypeError", "can't convert %s into an exact number", rubyClassName(args[0]))
+		}
+		if name == "-" {
+			seconds = -seconds
+		}
+		return receiver.Add(time.Duration(seconds * float64(time.Second))), nil
+	case "<", ">", "<=", ">=":
+		if err := checkArgs(args, 1, 1); err != nil {
+			return nil, err
+		}
+		c := compare(receiver, args[0])
+		if c == incomparable {
+			return nil, newRubyError("ArgumentError", "comparison of Time with %s failed", rubyInspect(args[0]))
+		}
+		switch name {
+		case "<":
+			return c < 0, nil
+		case ">":
+			return c > 0, nil
+		case "<=":
+			return c <= 0, nil
+		}
+		return c >= 0, nil
+	}
+	return nil, errMethodMissing
+}
+
+// formatRubyTime formats a time like Time#to_s, e.g. 2015-01-02 03:04:05 UTC
+func formatRubyTime(t time.Time) string {
+	if t.Location() == time.UTC {
+		return t.Format("2006-01-02 15:04:05 UTC")
+	}
+	return t.Format("2006-01-02 15:04:05 -0700")
+}
+
+// strftime implements Time#strftime for the common directives and the '-' (no padding) flag
+func strftime(t time.Time, format string) string {
+	var result strings.Builder
+	runes := []rune(format)
+	for index := 0; index < len(runes); index++ {
+		if runes[index] != '%' || index == len(runes)-1 {
+			result.WriteRune(runes[index])
+			continue
+		}
+
+		index++
+		pad := true
+		if runes[index] == '-' && index < len(runes)-1 {
+			pad = false
+			index++
+		}
+
+		number := func(value int, width int) string {
+			if !pad {
+				return strconv.Itoa(value)
+			}
+			return fmt.Sprintf("%0*d", width, value)
+		}
+		hour12 := t.Hour() % 12
+		if hour12 == 0 {
+			hour12 = 12
+		}
+
+		switch runes[index] {
+		case 'Y':
+			result.WriteString(strconv.Itoa(t.Year()))
+		case 'C':
+			result.WriteString(number(t.Year()/100, 2))
+		case 'y':
+			result.WriteString(number(t.Year()%100, 2))
+		case 'm':
+			result.WriteString(number(int(t.Month()), 2))
+		case 'B':
+			result.WriteString(t.Month().String())
+		case 'b', 'h':
+			result.WriteString(t.Month().String()[:3])
+		case 'd':
+			result.WriteString(number(t.Day(), 2))
+		case 'e':
+			result.WriteString(fmt.Sprintf("%2d", t.Day()))
+		case 'j':
+			result.WriteString(number(t.YearDay(), 3))
+		case 'H':
+			result.WriteString(number(t.Hour(), 2))
+		case 'k':
+			result.WriteString(fmt.Sprintf("%2d", t.Hour()))
+		case 'I':
+			result.WriteString(number(hour12, 2))
+		case 'l':
+			result.WriteString(fmt.Sprintf("%2d", hour12))
+		case 'M':
+			result.WriteString(number(t.Minute(), 2))
+		case 'S':
+			result.WriteString(number(t.Second(), 2))
+		case 'L':
+			result.WriteString(fmt.Sprintf("%03d", t.Nanosecond()/1e6))
+		case 'N':
+			result.WriteString(fmt.Sprintf("%09d", t.Nanosecond()))
+		case 'z':
+			result.WriteString(t.Format("-0700"))
+		case 'Z':
+			zone, _ := t.Zone()
+			result.WriteString(zone)
+		case 'A':
+			result.WriteString(t.Weekday().String())
+		case 'a':
+			result.WriteString(t.Weekday().String()[:3])
+		case 'u':
+			weekday := int(t.Weekday())
+			if weekday == 0 {
+				weekday = 7
+			}
+			result.WriteString(strconv.Itoa(weekday))
+		case 'w':
+			result.WriteString(strconv.Itoa(int(t.Weekday())))
+		case 'p':
+			result.WriteString(t.Format("PM"))
+		case 'P':
+			result.WriteString(t.Format("pm"))
+		case 's':
+			result.WriteString(strconv.FormatInt(t.Unix(), 10))
+		case 'F':
+			result.WriteString(t.Format("2006-01-02"))
+		case 'T', 'X':
+			result.WriteString(t.Format("15:04:05"))
+		case 'D', 'x':
+			result.WriteString(t.Format("01/02/06"))
+		case 'R':
+			result.WriteString(t.Format("15:04"))
+		case 'c':
+			result.WriteString(t.Format("Mon Jan  2 15:04:05 2006"))
+		case '%':
+			result.WriteRune('%')
+		default:
+			result.WriteRune('%')
+			if !pad {
+				result.WriteRune('-')
+			}
+			result.WriteRune(runes[index])
+		}
+	}
+	return result.String()
+}
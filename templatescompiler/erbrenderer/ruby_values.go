@@ -0,0 +1,731 @@
+package erbrenderer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Ruby values are represented by nil, bool, int64, float64, string and the types below
+
+type rubySymbol string
+
+type rubyArray struct {
+	elements []interface{}
+}
+
+// rubyHash is a hash that keeps the insertion order of its keys like a Ruby Hash
+type rubyHash struct {
+	keys         []interface{}
+	values       map[interface{}]interface{}
+	defaultValue interface{}
+}
+
+// openStruct exposes the keys of a hash as methods, see Ruby's OpenStruct
+type openStruct struct {
+	fields *rubyHash
+}
+
+type rubyRange struct {
+	from      interface{}
+	to        interface{}
+	exclusive bool
+}
+
+type rubyRegexp struct {
+	re     *regexp.Regexp
+	source string
+}
+
+type rubyProc struct {
+	block  *blockNode
+	scope  *rubyScope
+	method string
+}
+
+// rubyClass is the value of a constant such as JSON or String
+type rubyClass struct {
+	name string
+}
+
+// nilKey stands in for nil when used as a hash key
+type nilKey struct{}
+
+func newRubyArray(elements ...interface{}) *rubyArray {
+	return &rubyArray{elements: elements}
+}
+
+func newRubyHash() *rubyHash {
+	return &rubyHash{values: map[interface{}]interface{}{}}
+}
+
+func hashKey(key interface{}) (interface{}, error) {
+	switch key.(type) {
+	case nil:
+		return nilKey{}, nil
+	case string, rubySymbol, int64, float64, bool:
+		return key, nil
+	}
+	return nil, newRubyError("TypeError", "unsupported hash key %s", rubyInspect(key))
+}
+
+func (h *rubyHash) get(key interface{}) (interface{}, bool) {
+	k, err := hashKey(key)
+	if err != nil {
+		return nil, false
+	}
+	value, found := h.values[k]
+	return value, found
+}
+
+func (h *rubyHash) set(key interface{}, value interface{}) error {
+	k, err := hashKey(key)
+	if err != nil {
+		return err
+	}
+	if _, found := h.values[k]; !found {
+		h.keys = append(h.keys, key)
+	}
+	h.values[k] = value
+	return nil
+}
+
+func (h *rubyHash) delete(key interface{}) interface{} {
+	k, err := hashKey(key)
+	if err != nil {
+		return nil
+	}
+	value, found := h.values[k]
+	if !found {
+		return nil
+	}
+	delete(h.values, k)
+	for i, existing := range h.keys {
+		existingKey, _ := hashKey(existing)
+		if existingKey == k {
+			h.keys = append(h.keys[:i:i], h.keys[i+1:]...)
+			break
+		}
+	}
+	return value
+}
+
+func (h *rubyHash) length() int {
+	return len(h.keys)
+}
+
+func (h *rubyHash) copy() *rubyHash {
+	c := newRubyHash()
+	for _, key := range h.keys {
+		value, _ := h.get(key)
+		c.set(key, value)
+	}
+	return c
+}
+
+// pairs returns the entries of the hash as [key, value] arrays
+func (h *rubyHash) pairs() []interface{} {
+	pairs := make([]interface{}, 0, len(h.keys))
+	for _, key := range h.keys {
+		value, _ := h.get(key)
+		pairs = append(pairs, newRubyArray(key, value))
+	}
+	return pairs
+}
+
+// rangeElements expands an integer range into its elements
+func (r *rubyRange) elements() ([]interface{}, error) {
+	from, fromOK := r.from.(int64)
+	to, toOK := r.to.(int64)
+	if !fromOK || !toOK {
+		return nil, newRubyError("TypeError", "can't iterate from %s", rubyClassName(r.from))
+	}
+	if r.exclusive {
+		to--
+	}
+	elements := []interface{}{}
+	for i := from; i <= to; i++ {
+		elements = append(elements, i)
+	}
+	return elements, nil
+}
+
+func (r *rubyRange) includes(value interface{}) bool {
+	if compare(r.from, value) > 0 {
+		return false
+	}
+	c := compare(value, r.to)
+	if r.exclusive {
+		return c < 0
+	}
+	return c <= 0
+}
+
+func truthy(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	}
+	return true
+}
+
+func rubyClassName(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "NilClass"
+	case bool:
+		if v {
+			return "TrueClass"
+		}
+		return "FalseClass"
+	case int64:
+		return "Integer"
+	case float64:
+		return "Float"
+	case string:
+		return "String"
+	case rubySymbol:
+		return "Symbol"
+	case *rubyArray:
+		return "Array"
+	case *rubyHash:
+		return "Hash"
+	case *openStruct:
+		return "OpenStruct"
+	case *rubyRange:
+		return "Range"
+	case *rubyRegexp:
+		return "Regexp"
+	case *rubyProc:
+		return "Proc"
+	case *rubyClass:
+		return "Class"
+	case time.Time:
+		return "Time"
+	case *rubyError:
+		return v.class
+	case *activeElseBlock:
+		return "TemplateEvaluationContext::ActiveElseBlock"
+	case inactiveElseBlock:
+		return "TemplateEvaluationContext::InactiveElseBlock"
+	case *templateEvaluationContext:
+		return "TemplateEvaluationContext"
+	}
+	return "Object"
+}
+
+// isA implements Object#is_a? for the classes available in templates
+func isA(value interface{}, class string) bool {
+	switch class {
+	case "Object", "BasicObject", "Kernel":
+		return true
+	case "Numeric", "Comparable":
+		switch value.(type) {
+		case int64, float64:
+			return true
+		}
+		_, isString := value.(string)
+		return class == "Comparable" && isString
+	case "Fixnum", "Bignum":
+		_, isInt := value.(int64)
+		return isInt
+	case "Enumerable":
+		switch value.(type) {
+		case *rubyArray, *rubyHash, *rubyRange:
+			return true
+		}
+		return false
+	}
+	return rubyClassName(value) == class
+}
+
+func rubyToS(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case rubySymbol:
+		return string(v)
+	case float64:
+		return formatRubyFloat(v)
+	case *rubyArray, *rubyHash:
+		return rubyInspect(v)
+	case *rubyClass:
+		return v.name
+	case *rubyError:
+		return v.msg
+	case time.Time:
+		return formatRubyTime(v)
+	}
+	return rubyInspect(value)
+}
+
+func rubyInspect(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "nil"
+	case bool:
+		return strconv.FormatBool(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return formatRubyFloat(v)
+	case string:
+		return inspectString(v)
+	case rubySymbol:
+		if isPlainSymbol(string(v)) {
+			return ":" + string(v)
+		}
+		return ":" + inspectString(string(v))
+	case *rubyArray:
+		parts := make([]string, len(v.elements))
+		for i, element := range v.elements {
+			parts[i] = rubyInspect(element)
+		}
+		return "[" + strings.Join(parts, ", ") + "]"
+	case *rubyHash:
+		parts := make([]string, 0, v.length())
+		for _, key := range v.keys {
+			element, _ := v.get(key)
+			parts = append(parts, rubyInspect(key)+"=>"+rubyInspect(element))
+		}
+		return "{" + strings.Join(parts, ", ") + "}"
+	case *openStruct:
+		parts := make([]string, 0, v.fields.length())
+		for _, key := range v.fields.keys {
+			element, _ := v.fields.get(key)
+			parts = append(parts, " "+rubyToS(key)+"="+rubyInspect(element))
+		}
+		return "#<OpenStruct" + strings.Join(parts, ",") + ">"
+	case *rubyRange:
+		if v.exclusive {
+			return rubyInspect(v.from) + "..." + rubyInspect(v.to)
+		}
+		return rubyInspect(v.from) + ".." + rubyInspect(v.to)
+	case *rubyRegexp:
+		return "/" + v.source + "/"
+	case *rubyClass:
+		return v.name
+	case *rubyError:
+		return v.Error()
+	case time.Time:
+		return formatRubyTime(v)
+	}
+	return "#<" + rubyClassName(value) + ">"
+}
+
+func isPlainSymbol(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		if r == '_' || unicode.IsLetter(r) || (i > 0 && unicode.IsDigit(r)) {
+			continue
+		}
+		if (r == '?' || r == '!' || r == '=') && i == len(name)-1 {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+func inspectString(s string) string {
+	var buf bytes.Buffer
+	buf.WriteByte('"')
+	for i, r := range s {
+		switch r {
+		case '"', '\\':
+			buf.WriteByte('\\')
+			buf.WriteRune(r)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\t':
+			buf.WriteString(`\t`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case 0x1b:
+			buf.WriteString(`\e`)
+		case '#':
+			next, _ := utf8.DecodeRuneInString(s[i+1:])
+			if next == '{' || next == '$' || next == '@' {
+				buf.WriteByte('\\')
+			}
+			buf.WriteRune(r)
+		default:
+			if r == utf8.RuneError || !unicode.IsPrint(r) {
+				fmt.Fprintf(&buf, `\u%04X`, r)
+			} else {
+				buf.WriteRune(r)
+			}
+		}
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
+
+// formatRubyFloat formats a float like Float#to_s, e.g. 1.0, 0.0001, 1.0e-05 and 1.0e+16
+func formatRubyFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+
+	scientific := strconv.FormatFloat(f, 'e', -1, 64)
+	exponentIndex := strings.IndexByte(scientific, 'e')
+	exponent, _ := strconv.Atoi(scientific[exponentIndex+1:])
+
+	if exponent < -4 || exponent >= 16 {
+		mantissa := scientific[:exponentIndex]
+		if !strings.Contains(mantissa, ".") {
+			mantissa += ".0"
+		}
+		return mantissa + scientific[exponentIndex:]
+	}
+
+	fixed := strconv.FormatFloat(f, 'f', -1, 64)
+	if !strings.Contains(fixed, ".") {
+		fixed += ".0"
+	}
+	return fixed
+}
+
+func rubyEqual(a interface{}, b interface{}) bool {
+	switch av := a.(type) {
+	case int64:
+		switch bv := b.(type) {
+		case int64:
+			return av == bv
+		case float64:
+			return float64(av) == bv
+		}
+		return false
+	case float64:
+		switch bv := b.(type) {
+		case int64:
+			return av == float64(bv)
+		case float64:
+			return av == bv
+		}
+		return false
+	case *rubyArray:
+		bv, ok := b.(*rubyArray)
+		if !ok || len(av.elements) != len(bv.elements) {
+			return false
+		}
+		for i := range av.elements {
+			if !rubyEqual(av.elements[i], bv.elements[i]) {
+				return false
+			}
+		}
+		return true
+	case *rubyHash:
+		bv, ok := b.(*rubyHash)
+		if !ok || av.length() != bv.length() {
+			return false
+		}
+		for _, key := range av.keys {
+			aValue, _ := av.get(key)
+			bValue, found := bv.get(key)
+			if !found || !rubyEqual(aValue, bValue) {
+				return false
+			}
+		}
+		return true
+	case *openStruct:
+		bv, ok := b.(*openStruct)
+		return ok && rubyEqual(av.fields, bv.fields)
+	case *rubyRange:
+		bv, ok := b.(*rubyRange)
+		return ok && av.exclusive == bv.exclusive && rubyEqual(av.from, bv.from) && rubyEqual(av.to, bv.to)
+	case *rubyRegexp:
+		bv, ok := b.(*rubyRegexp)
+		return ok && av.re.String() == bv.re.String()
+	case *rubyClass:
+		bv, ok := b.(*rubyClass)
+		return ok && av.name == bv.name
+	case time.Time:
+		bv, ok := b.(time.Time)
+		return ok && av.Equal(bv)
+	}
+
+	defer func() { recover() }()
+	return a == b
+}
+
+const incomparable = 2
+
+// compare implements <=>, it returns incomparable for values that can not be compared
+func compare(a interface{}, b interface{}) int {
+	switch av := a.(type) {
+	case int64:
+		switch bv := b.(type) {
+		case int64:
+			return compareOrdered(av < bv, av > bv)
+		case float64:
+			return compareOrdered(float64(av) < bv, float64(av) > bv)
+		}
+	case float64:
+		switch bv := b.(type) {
+		case int64:
+			return compareOrdered(av < float64(bv), av > float64(bv))
+		case float64:
+			return compareOrdered(av < bv, av > bv)
+		}
+	case string:
+		if bv, ok := b.(string); ok {
+			return strings.Compare(av, bv)
+		}
+	case rubySymbol:
+		if bv, ok := b.(rubySymbol); ok {
+			return strings.Compare(string(av), string(bv))
+		}
+	case *rubyArray:
+		if bv, ok := b.(*rubyArray); ok {
+			for i := 0; i < len(av.elements) && i < len(bv.elements); i++ {
+				c := compare(av.elements[i], bv.elements[i])
+				if c != 0 {
+					return c
+				}
+			}
+			return compareOrdered(len(av.elements) < len(bv.elements), len(av.elements) > len(bv.elements))
+		}
+	case time.Time:
+		if bv, ok := b.(time.Time); ok {
+			return compareOrdered(av.Before(bv), av.After(bv))
+		}
+	}
+	return incomparable
+}
+
+func compareOrdered(less bool, greater bool) int {
+	switch {
+	case less:
+		return -1
+	case greater:
+		return 1
+	}
+	return 0
+}
+
+func sortValues(values []interface{}, less func(a, b interface{}) (bool, error)) error {
+	var sortErr error
+	sort.SliceStable(values, func(i, j int) bool {
+		if sortErr != nil {
+			return false
+		}
+		result, err := less(values[i], values[j])
+		if err != nil {
+			sortErr = err
+		}
+		return result
+	})
+	return sortErr
+}
+
+func sortByComparison(a interface{}, b interface{}) (bool, error) {
+	c := compare(a, b)
+	if c == incomparable {
+		return false, newRubyError("ArgumentError", "comparison of %s with %s failed", rubyClassName(a), rubyInspect(b))
+	}
+	return c < 0, nil
+}
+
+// shallowCopy implements dup for the mutable values
+func shallowCopy(value interface{}) interface{} {
+	switch v := value.(type) {
+	case *rubyArray:
+		return newRubyArray(append([]interface{}{}, v.elements...)...)
+	case *rubyHash:
+		return v.copy()
+	case *openStruct:
+		return &openStruct{fields: v.fields.copy()}
+	}
+	return value
+}
+
+// decodeJSON converts JSON into Ruby values keeping the order of object keys
+func decodeJSON(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	value, err := decodeJSONValue(decoder)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after top-level value")
+	}
+	return value, nil
+}
+
+func decodeJSONValue(decoder *json.Decoder) (interface{}, error) {
+	t, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch v := t.(type) {
+	case json.Delim:
+		switch v {
+		case '[':
+			array := newRubyArray()
+			for decoder.More() {
+				element, err := decodeJSONValue(decoder)
+				if err != nil {
+					return nil, err
+				}
+				array.elements = append(array.elements, element)
+			}
+			_, err = decoder.Token()
+			return array, err
+		case '{':
+			hash := newRubyHash()
+			for decoder.More() {
+				key, err := decoder.Token()
+				if err != nil {
+					return nil, err
+				}
+				value, err := decodeJSONValue(decoder)
+				if err != nil {
+					return nil, err
+				}
+				hash.set(key.(string), value)
+			}
+			_, err = decoder.Token()
+			return hash, err
+		}
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i, nil
+		}
+		return v.Float64()
+	}
+	return t, nil
+}
+
+// generateJSON implements JSON.generate and, with pretty set, JSON.pretty_generate
+func generateJSON(value interface{}, pretty bool) (string, error) {
+	var buf bytes.Buffer
+	err := writeJSON(&buf, value, pretty, "")
+	return buf.String(), err
+}
+
+func writeJSON(buf *bytes.Buffer, value interface{}, pretty bool, indent string) error {
+	switch v := value.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		buf.WriteString(strconv.FormatBool(v))
+	case int64:
+		buf.WriteString(strconv.FormatInt(v, 10))
+	case float64:
+		if math.IsInf(v, 0) || math.IsNaN(v) {
+			return newRubyError("JSON::GeneratorError", "%s not allowed in JSON", formatRubyFloat(v))
+		}
+		buf.WriteString(formatRubyFloat(v))
+	case string:
+		writeJSONString(buf, v)
+	case rubySymbol:
+		writeJSONString(buf, string(v))
+	case *rubyArray:
+		if len(v.elements) == 0 {
+			buf.WriteString("[]")
+			return nil
+		}
+		buf.WriteByte('[')
+		for i, element := range v.elements {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if pretty {
+				buf.WriteString("\n" + indent + "  ")
+			}
+			err := writeJSON(buf, element, pretty, indent+"  ")
+			if err != nil {
+				return err
+			}
+		}
+		if pretty {
+			buf.WriteString("\n" + indent)
+		}
+		buf.WriteByte(']')
+	case *rubyHash:
+		if v.length() == 0 {
+			buf.WriteString("{}")
+			return nil
+		}
+		buf.WriteByte('{')
+		for i, key := range v.keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if pretty {
+				buf.WriteString("\n" + indent + "  ")
+			}
+			writeJSONString(buf, rubyToS(key))
+			buf.WriteByte(':')
+			if pretty {
+				buf.WriteByte(' ')
+			}
+			element, _ := v.get(key)
+			err := writeJSON(buf, element, pretty, indent+"  ")
+			if err != nil {
+				return err
+			}
+		}
+		if pretty {
+			buf.WriteString("\n" + indent)
+		}
+		buf.WriteByte('}')
+	default:
+		writeJSONString(buf, rubyToS(v))
+	}
+	return nil
+}
+
+func writeJSONString(buf *bytes.Buffer, s string) {
+	buf.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			buf.WriteString(`\"`)
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		case '\b':
+			buf.WriteString(`\b`)
+		case '\f':
+			buf.WriteString(`\f`)
+		default:
+			if r < 0x20 {
+				fmt.Fprintf(buf, `\u%04x`, r)
+			} else {
+				buf.WriteRune(r)
+			}
+		}
+	}
+	buf.WriteByte('"')
+}
@@ -0,0 +1,208 @@
+package erbrenderer
+
+import (
+	"bytes"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// generateYAML implements Object#to_yaml and YAML.dump in the block style of Ruby's Psych,
+// e.g. "---\n- a\n- b\n" for ['a', 'b']
+func generateYAML(value interface{}) (string, error) {
+	var buf bytes.Buffer
+	buf.WriteString("---")
+	if isYAMLCollection(value) {
+		buf.WriteByte('\n')
+		err := writeYAMLCollection(&buf, value, "", false)
+		return buf.String(), err
+	}
+
+	scalar, err := yamlScalar(value, "")
+	if err != nil {
+		return "", err
+	}
+	if scalar != "" {
+		buf.WriteString(" " + scalar)
+	}
+	buf.WriteByte('\n')
+	return buf.String(), nil
+}
+
+// isYAMLCollection returns whether the value is written as a block collection, empty collections are written inline
+func isYAMLCollection(value interface{}) bool {
+	switch v := value.(type) {
+	case *rubyArray:
+		return len(v.elements) > 0
+	case *rubyHash:
+		return v.length() > 0
+	}
+	return false
+}
+
+// writeYAMLCollection writes the entries of an array or hash on lines with the indent.
+// With inline set the first entry continues the current line, as for a collection in an array.
+func writeYAMLCollection(buf *bytes.Buffer, value interface{}, indent string, inline bool) error {
+	prefix := func(index int) string {
+		if inline && index == 0 {
+			return ""
+		}
+		return indent
+	}
+
+	switch v := value.(type) {
+	case *rubyArray:
+		for index, element := range v.elements {
+			buf.WriteString(prefix(index) + "-")
+			if isYAMLCollection(element) {
+				buf.WriteByte(' ')
+				err := writeYAMLCollection(buf, element, indent+"  ", true)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			err := writeYAMLValue(buf, element, indent)
+			if err != nil {
+				return err
+			}
+		}
+	case *rubyHash:
+		for index, key := range v.keys {
+			keyScalar, err := yamlScalar(key, indent)
+			if err != nil {
+				return err
+			}
+			buf.WriteString(prefix(index) + keyScalar + ":")
+
+			element, _ := v.get(key)
+			switch element.(type) {
+			case *rubyArray:
+				// like Psych, the entries of an array in a hash are not indented
+				if isYAMLCollection(element) {
+					buf.WriteByte('\n')
+					err = writeYAMLCollection(buf, element, indent, false)
+					break
+				}
+				err = writeYAMLValue(buf, element, indent)
+			case *rubyHash:
+				if isYAMLCollection(element) {
+					buf.WriteByte('\n')
+					err = writeYAMLCollection(buf, element, indent+"  ", false)
+					break
+				}
+				err = writeYAMLValue(buf, element, indent)
+			default:
+				err = writeYAMLValue(buf, element, indent)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeYAMLValue writes a scalar or an empty collection after an array dash or a hash key
+func writeYAMLValue(buf *bytes.Buffer, value interface{}, indent string) error {
+	scalar, err := yamlScalar(value, indent)
+	if err != nil {
+		return err
+	}
+	if scalar != "" {
+		buf.WriteString(" " + scalar)
+	}
+	buf.WriteByte('\n')
+	return nil
+}
+
+func yamlScalar(value interface{}, indent string) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		switch {
+		case math.IsInf(v, 1):
+			return ".inf", nil
+		case math.IsInf(v, -1):
+			return "-.inf", nil
+		case math.IsNaN(v):
+			return ".nan", nil
+		}
+		return formatRubyFloat(v), nil
+	case string:
+		return yamlString(v, indent), nil
+	case rubySymbol:
+		return ":" + string(v), nil
+	case *rubyArray:
+		return "[]", nil
+	case *rubyHash:
+		return "{}", nil
+	}
+	return "", newRubyError("TypeError", "can't dump %s to YAML", rubyClassName(value))
+}
+
+// yamlReservedPattern matches the plain scalars that would not load as strings, such as booleans, nulls, numbers and dates
+var yamlReservedPattern = regexp.MustCompile(`^(?:~|null|Null|NULL|true|True|TRUE|false|False|FALSE|yes|Yes|YES|no|No|NO|on|On|ON|off|Off|OFF|y|Y|n|N|[-+]?(?:\d[\d_]*(?:\.[\d_]*)?|\.\d[\d_]*)(?:[eE][-+]?\d+)?|0x[0-9a-fA-F_]+|0o?[0-7_]+|0b[01_]+|[-+]?\.(?:inf|Inf|INF)|\.(?:nan|NaN|NAN)|\d+(?::[0-5]?\d)+(?:\.\d*)?|\d{4}-\d{1,2}-\d{1,2}.*)$`)
+
+// yamlString writes multiline strings as literal blocks and quotes strings that would not load as the same string
+func yamlString(s string, indent string) string {
+	switch {
+	case s == "":
+		return "''"
+	case strings.IndexFunc(s, func(r rune) bool { return r < 0x20 && r != '\n' && r != '\t' }) >= 0:
+		var buf bytes.Buffer
+		writeJSONString(&buf, s)
+		return buf.String()
+	case strings.Contains(s, "\n"):
+		if strings.HasPrefix(s, " ") || strings.HasPrefix(s, "\t") {
+			var buf bytes.Buffer
+			writeJSONString(&buf, s)
+			return buf.String()
+		}
+		return yamlLiteralBlock(s, indent)
+	}
+
+	needsQuotes := yamlReservedPattern.MatchString(s) ||
+		strings.ContainsAny(s[:1], "-?:,[]{}#&*!|>'\"%@`") ||
+		strings.TrimSpace(s) != s ||
+		strings.Contains(s, ": ") ||
+		strings.Contains(s, " #") ||
+		strings.HasSuffix(s, ":")
+
+	if !needsQuotes {
+		return s
+	}
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+// yamlLiteralBlock writes a multiline string as a literal block, the chomping indicator keeps the trailing newlines
+func yamlLiteralBlock(s string, indent string) string {
+	body := strings.TrimRight(s, "\n")
+	indicator := "|-"
+	switch len(s) - len(body) {
+	case 0:
+	case 1:
+		indicator = "|"
+	default:
+		indicator = "|+"
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(indicator)
+	for _, line := range strings.Split(body, "\n") {
+		buf.WriteByte('\n')
+		if line != "" {
+			buf.WriteString(indent + "  " + line)
+		}
+	}
+	for i := 1; i < len(s)-len(body); i++ {
+		buf.WriteByte('\n')
+	}
+	return buf.String()
+}
@@ -2,6 +2,7 @@ package templatescompiler
 
 import (
 	"encoding/json"
+	"fmt"
 
 	bosherr "github.com/cloudfoundry/bosh-agent/errors"
 	boshlog "github.com/cloudfoundry/bosh-agent/logger"
@@ -13,6 +14,7 @@ import (
 
 type jobEvaluationContext struct {
 	releaseJob       bireljob.Job
+	instance         Instance
 	jobProperties    biproperty.Map
 	globalProperties biproperty.Map
 	deploymentName   string
@@ -20,13 +22,29 @@ type jobEvaluationContext struct {
 	logTag           string
 }
 
+// Instance is the instance of a deployment job whose templates are rendered.
+// Networks are the network interfaces of the instance by network name,
+// with the networks that are the default for DNS and gateway listed in their 'default' key.
+type Instance struct {
+	Name     string
+	ID       string
+	Index    int
+	Networks map[string]biproperty.Map
+}
+
 // RootContext is exposed as an open struct in ERB templates.
 // It must stay same to provide backwards compatible API.
 type RootContext struct {
 	Index      int        `json:"index"`
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
 	JobContext jobContext `json:"job"`
 	Deployment string     `json:"deployment"`
 
+	// IP of the network that is the default gateway, e.g. <%= spec.ip %>
+	IP      string `json:"ip"`
+	Address string `json:"address"`
+
 	// Usually is accessed with <%= spec.networks.default.ip %>
 	NetworkContexts map[string]networkContext `json:"networks"`
 
@@ -41,13 +59,16 @@ type jobContext struct {
 }
 
 type networkContext struct {
-	IP      string `json:"ip"`
-	Netmask string `json:"netmask"`
-	Gateway string `json:"gateway"`
+	IP      string   `json:"ip"`
+	Netmask string   `json:"netmask"`
+	Gateway string   `json:"gateway"`
+	DNS     []string `json:"dns,omitempty"`
+	Default []string `json:"default,omitempty"`
 }
 
 func NewJobEvaluationContext(
 	releaseJob bireljob.Job,
+	instance Instance,
 	jobProperties biproperty.Map,
 	globalProperties biproperty.Map,
 	deploymentName string,
@@ -55,6 +76,7 @@ func NewJobEvaluationContext(
 ) bierbrenderer.TemplateEvaluationContext {
 	return jobEvaluationContext{
 		releaseJob:       releaseJob,
+		instance:         instance,
 		jobProperties:    jobProperties,
 		globalProperties: globalProperties,
 		deploymentName:   deploymentName,
@@ -66,11 +88,18 @@ func NewJobEvaluationContext(
 func (ec jobEvaluationContext) MarshalJSON() ([]byte, error) {
 	defaultProperties := ec.propertyDefaults(ec.releaseJob.Properties)
 
+	networkContexts := ec.buildNetworkContexts()
+	ip := ec.defaultGatewayIP(networkContexts)
+
 	context := RootContext{
-		Index:             0,
+		Index:             ec.instance.Index,
+		ID:                ec.instance.ID,
+		Name:              ec.instance.Name,
 		JobContext:        jobContext{Name: ec.releaseJob.Name},
 		Deployment:        ec.deploymentName,
-		NetworkContexts:   ec.buildNetworkContexts(),
+		IP:                ip,
+		Address:           ip,
+		NetworkContexts:   networkContexts,
 		GlobalProperties:  ec.globalProperties,
 		ClusterProperties: ec.jobProperties,
 		DefaultProperties: defaultProperties,
@@ -95,10 +124,62 @@ func (ec jobEvaluationContext) propertyDefaults(properties map[string]bireljob.P
 }
 
 func (ec jobEvaluationContext) buildNetworkContexts() map[string]networkContext {
-	// IP is being returned by agent
-	return map[string]networkContext{
-		"default": networkContext{
-			IP: "",
-		},
+	if len(ec.instance.Networks) == 0 {
+		// installation jobs are not rendered for an instance with networks
+		return map[string]networkContext{
+			"default": networkContext{
+				IP: "",
+			},
+		}
+	}
+
+	networkContexts := map[string]networkContext{}
+	for networkName, networkInterface := range ec.instance.Networks {
+		networkContexts[networkName] = networkContext{
+			IP:      ec.stringValue(networkInterface["ip"]),
+			Netmask: ec.stringValue(networkInterface["netmask"]),
+			Gateway: ec.stringValue(networkInterface["gateway"]),
+			DNS:     ec.stringList(networkInterface["dns"]),
+			Default: ec.stringList(networkInterface["default"]),
+		}
+	}
+	return networkContexts
+}
+
+// defaultGatewayIP returns the IP on the network that is the default gateway
+func (ec jobEvaluationContext) defaultGatewayIP(networkContexts map[string]networkContext) string {
+	for _, network := range networkContexts {
+		for _, networkDefault := range network.Default {
+			if networkDefault == "gateway" {
+				return network.IP
+			}
+		}
+	}
+	return ""
+}
+
+func (ec jobEvaluationContext) stringValue(value biproperty.Property) string {
+	if value == nil {
+		return ""
 	}
+	return fmt.Sprintf("%v", value)
+}
+
+func (ec jobEvaluationContext) stringList(value biproperty.Property) []string {
+	result := []string{}
+	switch list := value.(type) {
+	case []string:
+		result = append(result, list...)
+	case []interface{}:
+		for _, element := range list {
+			result = append(result, ec.stringValue(element))
+		}
+	case biproperty.List:
+		for _, element := range list {
+			result = append(result, ec.stringValue(element))
+		}
+	default:
+		return nil
+	}
+	return result
 }
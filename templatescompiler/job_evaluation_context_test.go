@@ -24,11 +24,13 @@ var _ = Describe("JobEvaluationContext", func() {
 		generatedContext RootContext
 
 		releaseJob        bireljob.Job
+		instance          Instance
 		clusterProperties biproperty.Map
 		globalProperties  biproperty.Map
 	)
 	BeforeEach(func() {
 		generatedContext = RootContext{}
+		instance = Instance{}
 
 		releaseJob = bireljob.Job{
 			Name: "fake-job-name",
@@ -57,6 +59,7 @@ var _ = Describe("JobEvaluationContext", func() {
 
 		jobEvaluationContext := NewJobEvaluationContext(
 			releaseJob,
+			instance,
 			clusterProperties,
 			globalProperties,
 			"fake-deployment-name",
@@ -74,12 +77,64 @@ var _ = Describe("JobEvaluationContext", func() {
 		Expect(generatedContext.NetworkContexts["default"].IP).To(Equal(""))
 	})
 
+	Context("when rendering for an instance with networks", func() {
+		BeforeEach(func() {
+			instance = Instance{
+				Name:  "fake-deployment-job-name",
+				ID:    "fake-instance-id",
+				Index: 2,
+				Networks: map[string]biproperty.Map{
+					"fake-manual-network": biproperty.Map{
+						"type":    "manual",
+						"ip":      "10.0.0.5",
+						"netmask": "255.255.255.0",
+						"gateway": "10.0.0.1",
+						"dns":     []interface{}{"10.0.0.2", "10.0.0.3"},
+						"default": []string{"dns", "gateway"},
+					},
+					"fake-vip-network": biproperty.Map{
+						"type":    "vip",
+						"ip":      "1.2.3.4",
+						"default": []string{},
+					},
+				},
+			}
+		})
+
+		It("has a network context for each network of the instance", func() {
+			Expect(generatedContext.NetworkContexts).To(HaveLen(2))
+
+			manualNetwork := generatedContext.NetworkContexts["fake-manual-network"]
+			Expect(manualNetwork.IP).To(Equal("10.0.0.5"))
+			Expect(manualNetwork.Netmask).To(Equal("255.255.255.0"))
+			Expect(manualNetwork.Gateway).To(Equal("10.0.0.1"))
+			Expect(manualNetwork.DNS).To(Equal([]string{"10.0.0.2", "10.0.0.3"}))
+			Expect(manualNetwork.Default).To(Equal([]string{"dns", "gateway"}))
+
+			vipNetwork := generatedContext.NetworkContexts["fake-vip-network"]
+			Expect(vipNetwork.IP).To(Equal("1.2.3.4"))
+			Expect(vipNetwork.Gateway).To(BeEmpty())
+			Expect(vipNetwork.Default).To(BeEmpty())
+		})
+
+		It("uses the IP on the default gateway network as the instance IP and address", func() {
+			Expect(generatedContext.IP).To(Equal("10.0.0.5"))
+			Expect(generatedContext.Address).To(Equal("10.0.0.5"))
+		})
+
+		It("has the index, ID and name of the instance", func() {
+			Expect(generatedContext.Index).To(Equal(2))
+			Expect(generatedContext.ID).To(Equal("fake-instance-id"))
+			Expect(generatedContext.Name).To(Equal("fake-deployment-job-name"))
+			Expect(generatedContext.JobContext.Name).To(Equal("fake-job-name"))
+		})
+	})
+
 	var erbRenderer erbrenderer.ERBRenderer
 	getValueFor := func(key string) string {
 		logger := boshlog.NewLogger(boshlog.LevelNone)
 		fs := boshsys.NewOsFileSystem(logger)
-		commandRunner := boshsys.NewExecCmdRunner(logger)
-		erbRenderer = erbrenderer.NewERBRenderer(fs, commandRunner, logger)
+		erbRenderer = erbrenderer.NewGoERBRenderer(fs, logger)
 
 		srcFile, err := ioutil.TempFile("", "source.txt.erb")
 		Expect(err).ToNot(HaveOccurred())
@@ -97,6 +152,7 @@ var _ = Describe("JobEvaluationContext", func() {
 
 		jobEvaluationContext := NewJobEvaluationContext(
 			releaseJob,
+			instance,
 			clusterProperties,
 			globalProperties,
 			"fake-deployment-name",
@@ -29,6 +29,7 @@ var _ = Describe("JobRenderer", func() {
 		fs               *fakesys.FakeFileSystem
 		jobProperties    biproperty.Map
 		globalProperties biproperty.Map
+		instance         Instance
 		srcPath          string
 		dstPath          string
 	)
@@ -51,9 +52,11 @@ var _ = Describe("JobRenderer", func() {
 			ExtractedPath: srcPath,
 		}
 
+		instance = Instance{Name: "fake-job-name", ID: "fake-instance-id", Index: 1}
+
 		logger := boshlog.NewLogger(boshlog.LevelNone)
 
-		context = NewJobEvaluationContext(job, jobProperties, globalProperties, "fake-deployment-name", logger)
+		context = NewJobEvaluationContext(job, instance, jobProperties, globalProperties, "fake-deployment-name", logger)
 
 		fakeERBRenderer = fakebirender.NewFakeERBRender()
 
@@ -84,7 +87,7 @@ var _ = Describe("JobRenderer", func() {
 
 	Describe("Render", func() {
 		It("renders job templates", func() {
-			renderedjob, err := jobRenderer.Render(job, jobProperties, globalProperties, "fake-deployment-name")
+			renderedjob, err := jobRenderer.Render(job, jobProperties, globalProperties, "fake-deployment-name", instance)
 			Expect(err).ToNot(HaveOccurred())
 
 			Expect(fakeERBRenderer.RenderInputs).To(Equal([]fakebirender.RenderInput{
@@ -112,7 +115,7 @@ var _ = Describe("JobRenderer", func() {
 			})
 
 			It("returns an error", func() {
-				_, err := jobRenderer.Render(job, jobProperties, globalProperties, "fake-deployment-name")
+				_, err := jobRenderer.Render(job, jobProperties, globalProperties, "fake-deployment-name", instance)
 				Expect(err).To(HaveOccurred())
 				Expect(err.Error()).To(ContainSubstring("fake-template-render-error"))
 			})
@@ -0,0 +1,320 @@
+package fakeagent
+
+import (
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	bosherr "github.com/cloudfoundry/bosh-agent/errors"
+	boshlog "github.com/cloudfoundry/bosh-agent/logger"
+	boshsys "github.com/cloudfoundry/bosh-agent/system"
+)
+
+// Request is an agent request received by the fake agent
+type Request struct {
+	Method    string        `json:"method"`
+	Arguments []interface{} `json:"arguments"`
+	ReplyTo   string        `json:"reply_to"`
+}
+
+// FakeAgent is an https agent that responds to the agent requests of bosh-init, e.g. 'ping', 'apply' and 'get_task',
+// and serves the agent's blobstore from a local directory.
+// Asynchronous tasks finish immediately; their result is returned by the first 'get_task'.
+type FakeAgent struct {
+	blobstorePath string
+	username      string
+	password      string
+	fs            boshsys.FileSystem
+	logger        boshlog.Logger
+	logTag        string
+
+	lock         sync.Mutex
+	requests     []Request
+	tasks        map[string]interface{}
+	lastTaskID   int
+	lastBlobID   int
+	jobState     string
+	applySpec    interface{}
+	mountedDisks []string
+
+	listener net.Listener
+}
+
+func NewFakeAgent(blobstorePath, username, password string, fs boshsys.FileSystem, logger boshlog.Logger) *FakeAgent {
+	return &FakeAgent{
+		blobstorePath: blobstorePath,
+		username:      username,
+		password:      password,
+		fs:            fs,
+		logger:        logger,
+		logTag:        "fakeAgent",
+		tasks:         map[string]interface{}{},
+		jobState:      "stopped",
+		mountedDisks:  []string{},
+	}
+}
+
+// Start listens on a random local port with the PEM encoded certificate and private key,
+// and returns the mbus URL of the agent, with its credentials
+func (a *FakeAgent) Start(certificate, privateKey string) (string, error) {
+	keyPair, err := tls.X509KeyPair([]byte(certificate), []byte(privateKey))
+	if err != nil {
+		return "", bosherr.WrapError(err, "Loading certificate")
+	}
+
+	err = a.fs.MkdirAll(a.blobstorePath, 0700)
+	if err != nil {
+		return "", bosherr.WrapErrorf(err, "Creating blobstore directory '%s'", a.blobstorePath)
+	}
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{keyPair}})
+	if err != nil {
+		return "", bosherr.WrapError(err, "Listening")
+	}
+	a.listener = listener
+
+	go func() {
+		err := http.Serve(listener, a)
+		a.logger.Debug(a.logTag, "Stopped serving: %s", err)
+	}()
+
+	return fmt.Sprintf("https://%s:%s@%s", a.username, a.password, listener.Addr().String()), nil
+}
+
+func (a *FakeAgent) Stop() error {
+	if a.listener == nil {
+		return nil
+	}
+	return a.listener.Close()
+}
+
+// Requests returns the agent requests received so far, including 'get_task'
+func (a *FakeAgent) Requests() []Request {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	return append([]Request{}, a.requests...)
+}
+
+// ApplySpec returns the spec of the last 'apply', as unmarshalled JSON
+func (a *FakeAgent) ApplySpec() interface{} {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	return a.applySpec
+}
+
+func (a *FakeAgent) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	username, password, ok := r.BasicAuth()
+	if !ok || username != a.username || password != a.password {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	switch {
+	case r.URL.Path == "/agent" && r.Method == "POST":
+		a.serveAgentRequest(w, r)
+	case strings.HasPrefix(r.URL.Path, "/blobs/") && r.Method == "PUT":
+		a.putBlob(w, r)
+	case strings.HasPrefix(r.URL.Path, "/blobs/") && r.Method == "GET":
+		a.getBlob(w, r)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (a *FakeAgent) serveAgentRequest(w http.ResponseWriter, r *http.Request) {
+	request := Request{}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	a.lock.Lock()
+	a.requests = append(a.requests, request)
+	value, err := a.handle(request)
+	a.lock.Unlock()
+
+	response := map[string]interface{}{"value": value}
+	if err != nil {
+		a.logger.Debug(a.logTag, "Agent request '%s' failed: %s", request.Method, err.Error())
+		response = map[string]interface{}{"exception": map[string]string{"message": err.Error()}}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		a.logger.Warn(a.logTag, "Failed to write agent response: %s", err.Error())
+	}
+}
+
+func (a *FakeAgent) handle(request Request) (interface{}, error) {
+	switch request.Method {
+	case "ping":
+		return "pong", nil
+	case "get_state":
+		return map[string]string{"job_state": a.jobState}, nil
+	case "start":
+		a.jobState = "running"
+		return "started", nil
+	case "list_disk":
+		return a.mountedDisks, nil
+	case "get_task":
+		return a.getTask(request.Arguments)
+	case "stop":
+		a.jobState = "stopped"
+		return a.startTask("stopped"), nil
+	case "apply":
+		if len(request.Arguments) != 1 {
+			return nil, bosherr.Errorf("Expected 1 argument, got %d", len(request.Arguments))
+		}
+		a.applySpec = request.Arguments[0]
+		return a.startTask("applied"), nil
+	case "mount_disk":
+		return a.mountDisk(request.Arguments)
+	case "unmount_disk":
+		return a.unmountDisk(request.Arguments)
+	case "migrate_disk":
+		return a.startTask(map[string]interface{}{}), nil
+	case "compile_package":
+		return a.compilePackage(request.Arguments)
+	case "run_errand":
+		return a.startTask(map[string]interface{}{"exit_code": 0, "stdout": "", "stderr": ""}), nil
+	default:
+		return nil, bosherr.Errorf("Unknown message '%s'", request.Method)
+	}
+}
+
+// startTask returns the running task response of an asynchronous agent request, whose result is returned by 'get_task'
+func (a *FakeAgent) startTask(result interface{}) interface{} {
+	a.lastTaskID++
+	taskID := fmt.Sprintf("%d", a.lastTaskID)
+	a.tasks[taskID] = result
+	return map[string]string{"agent_task_id": taskID, "state": "running"}
+}
+
+func (a *FakeAgent) getTask(args []interface{}) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, bosherr.Errorf("Expected 1 argument, got %d", len(args))
+	}
+
+	taskID := fmt.Sprintf("%v", args[0])
+	result, found := a.tasks[taskID]
+	if !found {
+		return nil, bosherr.Errorf("Task '%s' not found", taskID)
+	}
+	return result, nil
+}
+
+func (a *FakeAgent) mountDisk(args []interface{}) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, bosherr.Errorf("Expected 1 argument, got %d", len(args))
+	}
+
+	a.mountedDisks = append(a.mountedDisks, fmt.Sprintf("%v", args[0]))
+	return a.startTask(map[string]interface{}{}), nil
+}
+
+func (a *FakeAgent) unmountDisk(args []interface{}) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, bosherr.Errorf("Expected 1 argument, got %d", len(args))
+	}
+
+	diskCID := fmt.Sprintf("%v", args[0])
+	mountedDisks := []string{}
+	for _, mountedDisk := range a.mountedDisks {
+		if mountedDisk != diskCID {
+			mountedDisks = append(mountedDisks, mountedDisk)
+		}
+	}
+	a.mountedDisks = mountedDisks
+	return a.startTask(map[string]interface{}{}), nil
+}
+
+// compilePackage 'compiles' the package by adding a copy of its source blob to the blobstore
+func (a *FakeAgent) compilePackage(args []interface{}) (interface{}, error) {
+	if len(args) != 5 {
+		return nil, bosherr.Errorf("Expected 5 arguments, got %d", len(args))
+	}
+
+	blobID := fmt.Sprintf("%v", args[0])
+	expectedSHA1 := fmt.Sprintf("%v", args[1])
+
+	contents, err := a.fs.ReadFile(a.blobPath(blobID))
+	if err != nil {
+		return nil, bosherr.WrapErrorf(err, "Reading package blob '%s'", blobID)
+	}
+	if actualSHA1 := sha1Hex(contents); actualSHA1 != expectedSHA1 {
+		return nil, bosherr.Errorf("Expected package blob '%s' to have SHA1 '%s', got '%s'", blobID, expectedSHA1, actualSHA1)
+	}
+
+	a.lastBlobID++
+	compiledBlobID := fmt.Sprintf("compiled-package-%d", a.lastBlobID)
+	err = a.fs.WriteFile(a.blobPath(compiledBlobID), contents)
+	if err != nil {
+		return nil, bosherr.WrapErrorf(err, "Writing compiled package blob '%s'", compiledBlobID)
+	}
+
+	return a.startTask(map[string]interface{}{
+		"result": map[string]string{
+			"sha1":         expectedSHA1,
+			"blobstore_id": compiledBlobID,
+		},
+	}), nil
+}
+
+func (a *FakeAgent) putBlob(w http.ResponseWriter, r *http.Request) {
+	contents, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err = a.fs.WriteFile(a.blobPath(path.Base(r.URL.Path)), contents)
+	if err != nil {
+		a.logger.Warn(a.logTag, "Failed to write blob: %s", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (a *FakeAgent) getBlob(w http.ResponseWriter, r *http.Request) {
+	blobPath := a.blobPath(path.Base(r.URL.Path))
+	if !a.fs.FileExists(blobPath) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	file, err := a.fs.OpenFile(blobPath, os.O_RDONLY, 0)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+
+	_, err = io.Copy(w, file)
+	if err != nil {
+		a.logger.Warn(a.logTag, "Failed to write blob: %s", err.Error())
+	}
+}
+
+// blobPath returns the path of the blob in the blobstore directory, without the hash prefix of the blob URL
+func (a *FakeAgent) blobPath(blobID string) string {
+	return filepath.Join(a.blobstorePath, blobID)
+}
+
+func sha1Hex(contents []byte) string {
+	return fmt.Sprintf("%x", sha1.Sum(contents))
+}
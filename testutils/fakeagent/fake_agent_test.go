@@ -0,0 +1,154 @@
+package fakeagent_test
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	boshlog "github.com/cloudfoundry/bosh-agent/logger"
+	boshsys "github.com/cloudfoundry/bosh-agent/system"
+	boshuuid "github.com/cloudfoundry/bosh-agent/uuid"
+
+	biblobstore "github.com/cloudfoundry/bosh-init/blobstore"
+	biagentclient "github.com/cloudfoundry/bosh-init/deployment/agentclient"
+	bihttpagent "github.com/cloudfoundry/bosh-init/deployment/agentclient/http"
+	bias "github.com/cloudfoundry/bosh-init/deployment/applyspec"
+	biinstallmanifest "github.com/cloudfoundry/bosh-init/installation/manifest"
+	bitestutils "github.com/cloudfoundry/bosh-init/testutils"
+
+	. "github.com/cloudfoundry/bosh-init/testutils/fakeagent"
+)
+
+var _ = Describe("FakeAgent", func() {
+	var (
+		fs          boshsys.FileSystem
+		logger      boshlog.Logger
+		tmpDir      string
+		fakeAgent   *FakeAgent
+		mbusURL     string
+		cert        biinstallmanifest.Cert
+		agentClient biagentclient.AgentClient
+	)
+
+	BeforeEach(func() {
+		logger = boshlog.NewLogger(boshlog.LevelNone)
+		fs = boshsys.NewOsFileSystem(logger)
+
+		var err error
+		tmpDir, err = fs.TempDir("fake-agent")
+		Expect(err).ToNot(HaveOccurred())
+
+		caCert, privateKey, err := bitestutils.GenerateCertificate("fake-agent")
+		Expect(err).ToNot(HaveOccurred())
+		cert = biinstallmanifest.Cert{CA: caCert}
+
+		fakeAgent = NewFakeAgent(filepath.Join(tmpDir, "blobs"), "fake-user", "fake-password", fs, logger)
+		mbusURL, err = fakeAgent.Start(caCert, privateKey)
+		Expect(err).ToNot(HaveOccurred())
+
+		agentClientFactory := bihttpagent.NewAgentClientFactory(1*time.Millisecond, 1*time.Second, boshuuid.NewGenerator(), logger)
+		agentClient, err = agentClientFactory.NewAgentClient("fake-director-id", mbusURL, "fake-agent-id", cert)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		err := fakeAgent.Stop()
+		Expect(err).ToNot(HaveOccurred())
+
+		err = fs.RemoveAll(tmpDir)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("responds to ping", func() {
+		response, err := agentClient.Ping()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(response).To(Equal("pong"))
+	})
+
+	It("applies the spec and runs the jobs when started", func() {
+		err := agentClient.Stop()
+		Expect(err).ToNot(HaveOccurred())
+
+		err = agentClient.Apply(bias.ApplySpec{Deployment: "fake-deployment"})
+		Expect(err).ToNot(HaveOccurred())
+
+		state, err := agentClient.GetState()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(state.JobState).To(Equal("stopped"))
+
+		err = agentClient.Start()
+		Expect(err).ToNot(HaveOccurred())
+
+		state, err = agentClient.GetState()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(state.JobState).To(Equal("running"))
+
+		applySpec, ok := fakeAgent.ApplySpec().(map[string]interface{})
+		Expect(ok).To(BeTrue())
+		Expect(applySpec["deployment"]).To(Equal("fake-deployment"))
+	})
+
+	It("lists the mounted disks", func() {
+		err := agentClient.MountDisk("fake-disk-cid-1")
+		Expect(err).ToNot(HaveOccurred())
+		err = agentClient.MountDisk("fake-disk-cid-2")
+		Expect(err).ToNot(HaveOccurred())
+		err = agentClient.UnmountDisk("fake-disk-cid-1")
+		Expect(err).ToNot(HaveOccurred())
+
+		disks, err := agentClient.ListDisk()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(disks).To(Equal([]string{"fake-disk-cid-2"}))
+	})
+
+	It("compiles packages from its blobstore", func() {
+		blobstore, err := biblobstore.NewBlobstoreFactory(boshuuid.NewGenerator(), fs, logger).Create(mbusURL, cert)
+		Expect(err).ToNot(HaveOccurred())
+
+		packagePath := filepath.Join(tmpDir, "fake-package.tgz")
+		err = fs.WriteFileString(packagePath, "fake-package-contents")
+		Expect(err).ToNot(HaveOccurred())
+
+		blobID, err := blobstore.Add(packagePath)
+		Expect(err).ToNot(HaveOccurred())
+
+		packageSHA1 := fmt.Sprintf("%x", sha1.Sum([]byte("fake-package-contents")))
+		compiledPackageRef, err := agentClient.CompilePackage(biagentclient.BlobRef{
+			Name:        "fake-package",
+			Version:     "fake-version",
+			BlobstoreID: blobID,
+			SHA1:        packageSHA1,
+		}, []biagentclient.BlobRef{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(compiledPackageRef.SHA1).To(Equal(packageSHA1))
+
+		compiledBlob, err := blobstore.Get(compiledPackageRef.BlobstoreID)
+		Expect(err).ToNot(HaveOccurred())
+		defer compiledBlob.DeleteSilently()
+
+		contents, err := fs.ReadFileString(compiledBlob.Path())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(contents).To(Equal("fake-package-contents"))
+	})
+
+	It("records the requests it receives", func() {
+		_, err := agentClient.RunErrand()
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(fakeAgent.Requests()).To(ContainElement(Request{Method: "run_errand", Arguments: []interface{}{}, ReplyTo: "fake-director-id"}))
+	})
+
+	It("rejects requests with the wrong credentials", func() {
+		agentClientFactory := bihttpagent.NewAgentClientFactory(1*time.Millisecond, 1*time.Second, boshuuid.NewGenerator(), logger)
+		otherAgentClient, err := agentClientFactory.NewAgentClient("fake-director-id", "https://fake-user:wrong-password@"+mbusURL[len("https://fake-user:fake-password@"):], "fake-agent-id", cert)
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = otherAgentClient.Ping()
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("401"))
+	})
+})
@@ -0,0 +1,13 @@
+package fakeagent_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestFakeAgent(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Fake Agent Suite")
+}
@@ -0,0 +1,45 @@
+// fake-cpi is a CPI executable that keeps its stemcells, VMs and disks in an inventory file instead of an IaaS.
+//
+// Build it with 'go build -o bin/cpi github.com/cloudfoundry/bosh-init/testutils/fakecpi/cmd'
+// and package it as the 'cpi' executable of a CPI release job.
+// The inventory is kept in the installation directory, next to its packages directory, unless its path is given with -inventory.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	boshlog "github.com/cloudfoundry/bosh-agent/logger"
+	boshsys "github.com/cloudfoundry/bosh-agent/system"
+
+	bicloud "github.com/cloudfoundry/bosh-init/cloud"
+	bifakecpi "github.com/cloudfoundry/bosh-init/testutils/fakecpi"
+)
+
+func main() {
+	defaultInventoryPath := filepath.Join(os.Getenv("BOSH_PACKAGES_DIR"), "..", "fake-cpi-inventory.json")
+	inventoryPath := flag.String("inventory", defaultInventoryPath, "Path of the inventory file")
+	flag.Parse()
+
+	// the CPI log is written to stderr, which bosh-init streams into its logs
+	logger := boshlog.NewWriterLogger(boshlog.LevelInfo, os.Stderr, os.Stderr)
+	fs := boshsys.NewOsFileSystem(logger)
+
+	input := bicloud.CmdInput{}
+	err := json.NewDecoder(os.Stdin).Decode(&input)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unmarshalling CPI request: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	output := bifakecpi.NewFakeCPI(*inventoryPath, fs, logger).Run(input)
+
+	err = json.NewEncoder(os.Stdout).Encode(output)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Marshalling CPI response: %s\n", err.Error())
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,508 @@
+package fakecpi
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	bosherr "github.com/cloudfoundry/bosh-agent/errors"
+	boshlog "github.com/cloudfoundry/bosh-agent/logger"
+	boshsys "github.com/cloudfoundry/bosh-agent/system"
+
+	bicloud "github.com/cloudfoundry/bosh-init/cloud"
+)
+
+const CloudError = "Bosh::Clouds::CloudError"
+
+// StemcellFormat is the only stemcell format reported by the fake CPI 'info' method
+const StemcellFormat = "fake-raw"
+
+// Inventory is the state of the fake IaaS, kept in a JSON file between CPI commands
+type Inventory struct {
+	Stemcells map[string]Stemcell `json:"stemcells"`
+	VMs       map[string]VM       `json:"vms"`
+	Disks     map[string]Disk     `json:"disks"`
+	Snapshots map[string]Snapshot `json:"snapshots"`
+
+	// LastID is the number in the last generated CID, so that CIDs are unique and predictable
+	LastID int `json:"last_id"`
+}
+
+type Stemcell struct {
+	ImagePath       string                 `json:"image_path"`
+	CloudProperties map[string]interface{} `json:"cloud_properties"`
+}
+
+type VM struct {
+	AgentID         string                 `json:"agent_id"`
+	StemcellCID     string                 `json:"stemcell_cid"`
+	CloudProperties map[string]interface{} `json:"cloud_properties"`
+	Networks        map[string]interface{} `json:"networks"`
+	Env             map[string]interface{} `json:"env"`
+	DiskCIDs        []string               `json:"disk_cids"`
+	Metadata        map[string]string      `json:"metadata"`
+	Reboots         int                    `json:"reboots"`
+}
+
+type Disk struct {
+	Size            int                    `json:"size"`
+	CloudProperties map[string]interface{} `json:"cloud_properties"`
+	VMCID           string                 `json:"vm_cid"`
+}
+
+type Snapshot struct {
+	DiskCID  string                 `json:"disk_cid"`
+	Metadata map[string]interface{} `json:"metadata"`
+}
+
+// FakeCPI implements the CPI methods used by bosh-init against an inventory file instead of an IaaS
+type FakeCPI interface {
+	Run(input bicloud.CmdInput) bicloud.CmdOutput
+	Inventory() (Inventory, error)
+}
+
+type fakeCPI struct {
+	inventoryPath string
+	fs            boshsys.FileSystem
+	logger        boshlog.Logger
+	logTag        string
+
+	lock sync.Mutex
+}
+
+func NewFakeCPI(inventoryPath string, fs boshsys.FileSystem, logger boshlog.Logger) FakeCPI {
+	return &fakeCPI{
+		inventoryPath: inventoryPath,
+		fs:            fs,
+		logger:        logger,
+		logTag:        "fakeCPI",
+	}
+}
+
+// Run returns the output of the CPI method, with the error that a CPI would respond with if it fails
+func (c *fakeCPI) Run(input bicloud.CmdInput) bicloud.CmdOutput {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.logger.Debug(c.logTag, "Running CPI method '%s' with arguments %#v", input.Method, input.Arguments)
+
+	inventory, err := c.Inventory()
+	if err != nil {
+		return errorOutput(err)
+	}
+
+	result, cpiErr := c.run(&inventory, input.Method, input.Arguments)
+	if cpiErr != nil {
+		return bicloud.CmdOutput{Error: cpiErr}
+	}
+
+	err = c.save(inventory)
+	if err != nil {
+		return errorOutput(err)
+	}
+
+	return bicloud.CmdOutput{Result: result}
+}
+
+// Inventory returns the inventory, which is empty if the inventory file does not exist yet
+func (c *fakeCPI) Inventory() (Inventory, error) {
+	inventory := Inventory{
+		Stemcells: map[string]Stemcell{},
+		VMs:       map[string]VM{},
+		Disks:     map[string]Disk{},
+		Snapshots: map[string]Snapshot{},
+	}
+
+	if !c.fs.FileExists(c.inventoryPath) {
+		return inventory, nil
+	}
+
+	contents, err := c.fs.ReadFile(c.inventoryPath)
+	if err != nil {
+		return Inventory{}, bosherr.WrapErrorf(err, "Reading inventory '%s'", c.inventoryPath)
+	}
+
+	err = json.Unmarshal(contents, &inventory)
+	if err != nil {
+		return Inventory{}, bosherr.WrapErrorf(err, "Unmarshalling inventory '%s'", c.inventoryPath)
+	}
+	return inventory, nil
+}
+
+func (c *fakeCPI) save(inventory Inventory) error {
+	contents, err := json.MarshalIndent(inventory, "", "  ")
+	if err != nil {
+		return bosherr.WrapError(err, "Marshalling inventory")
+	}
+
+	err = c.fs.WriteFile(c.inventoryPath, contents)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Writing inventory '%s'", c.inventoryPath)
+	}
+	return nil
+}
+
+func (c *fakeCPI) run(inventory *Inventory, method string, args []interface{}) (interface{}, *bicloud.CmdError) {
+	switch method {
+	case "info":
+		return map[string]interface{}{"api_version": bicloud.SupportedAPIVersion, "stemcell_formats": []interface{}{StemcellFormat}}, nil
+	case "create_stemcell":
+		return c.createStemcell(inventory, args)
+	case "delete_stemcell":
+		return c.deleteStemcell(inventory, args)
+	case "create_vm":
+		return c.createVM(inventory, args)
+	case "delete_vm":
+		return c.deleteVM(inventory, args)
+	case "has_vm":
+		return c.hasVM(inventory, args)
+	case "create_disk":
+		return c.createDisk(inventory, args)
+	case "delete_disk":
+		return c.deleteDisk(inventory, args)
+	case "attach_disk":
+		return c.attachDisk(inventory, args)
+	case "detach_disk":
+		return c.detachDisk(inventory, args)
+	case "has_disk":
+		return c.hasDisk(inventory, args)
+	case "get_disks":
+		return c.getDisks(inventory, args)
+	case "set_vm_metadata":
+		return c.setVMMetadata(inventory, args)
+	case "snapshot_disk":
+		return c.snapshotDisk(inventory, args)
+	case "delete_snapshot":
+		return c.deleteSnapshot(inventory, args)
+	case "reboot_vm":
+		return c.rebootVM(inventory, args)
+	default:
+		// like the Ruby CPIs, which respond to methods they do not know with an invalid call error
+		return nil, &bicloud.CmdError{Type: bicloud.InvalidCallError, Message: fmt.Sprintf("Method is not known, got %s", method)}
+	}
+}
+
+func (c *fakeCPI) createStemcell(inventory *Inventory, args []interface{}) (interface{}, *bicloud.CmdError) {
+	var imagePath string
+	var cloudProperties map[string]interface{}
+	cmdErr := parseArguments(args, &imagePath, &cloudProperties)
+	if cmdErr != nil {
+		return nil, cmdErr
+	}
+
+	if !c.fs.FileExists(imagePath) {
+		return nil, cloudError("Stemcell image '%s' does not exist", imagePath)
+	}
+
+	stemcellCID := nextCID(inventory, "stemcell")
+	inventory.Stemcells[stemcellCID] = Stemcell{
+		ImagePath:       imagePath,
+		CloudProperties: cloudProperties,
+	}
+	return stemcellCID, nil
+}
+
+func (c *fakeCPI) deleteStemcell(inventory *Inventory, args []interface{}) (interface{}, *bicloud.CmdError) {
+	var stemcellCID string
+	cmdErr := parseArguments(args, &stemcellCID)
+	if cmdErr != nil {
+		return nil, cmdErr
+	}
+
+	delete(inventory.Stemcells, stemcellCID)
+	return nil, nil
+}
+
+func (c *fakeCPI) createVM(inventory *Inventory, args []interface{}) (interface{}, *bicloud.CmdError) {
+	var agentID, stemcellCID string
+	var cloudProperties, networks, env map[string]interface{}
+	var diskLocality []string
+	cmdErr := parseArguments(args, &agentID, &stemcellCID, &cloudProperties, &networks, &diskLocality, &env)
+	if cmdErr != nil {
+		return nil, cmdErr
+	}
+
+	if _, found := inventory.Stemcells[stemcellCID]; !found {
+		return nil, cloudError("Stemcell '%s' not found", stemcellCID)
+	}
+
+	vmCID := nextCID(inventory, "vm")
+	inventory.VMs[vmCID] = VM{
+		AgentID:         agentID,
+		StemcellCID:     stemcellCID,
+		CloudProperties: cloudProperties,
+		Networks:        networks,
+		Env:             env,
+		DiskCIDs:        []string{},
+	}
+	return vmCID, nil
+}
+
+func (c *fakeCPI) deleteVM(inventory *Inventory, args []interface{}) (interface{}, *bicloud.CmdError) {
+	var vmCID string
+	cmdErr := parseArguments(args, &vmCID)
+	if cmdErr != nil {
+		return nil, cmdErr
+	}
+
+	vm, found := inventory.VMs[vmCID]
+	if !found {
+		return nil, vmNotFoundError(vmCID)
+	}
+
+	for _, diskCID := range vm.DiskCIDs {
+		disk := inventory.Disks[diskCID]
+		disk.VMCID = ""
+		inventory.Disks[diskCID] = disk
+	}
+	delete(inventory.VMs, vmCID)
+	return nil, nil
+}
+
+func (c *fakeCPI) hasVM(inventory *Inventory, args []interface{}) (interface{}, *bicloud.CmdError) {
+	var vmCID string
+	cmdErr := parseArguments(args, &vmCID)
+	if cmdErr != nil {
+		return nil, cmdErr
+	}
+
+	_, found := inventory.VMs[vmCID]
+	return found, nil
+}
+
+func (c *fakeCPI) createDisk(inventory *Inventory, args []interface{}) (interface{}, *bicloud.CmdError) {
+	var size int
+	var cloudProperties map[string]interface{}
+	var vmCID string
+	cmdErr := parseArguments(args, &size, &cloudProperties, &vmCID)
+	if cmdErr != nil {
+		return nil, cmdErr
+	}
+
+	diskCID := nextCID(inventory, "disk")
+	inventory.Disks[diskCID] = Disk{
+		Size:            size,
+		CloudProperties: cloudProperties,
+	}
+	return diskCID, nil
+}
+
+func (c *fakeCPI) deleteDisk(inventory *Inventory, args []interface{}) (interface{}, *bicloud.CmdError) {
+	var diskCID string
+	cmdErr := parseArguments(args, &diskCID)
+	if cmdErr != nil {
+		return nil, cmdErr
+	}
+
+	disk, found := inventory.Disks[diskCID]
+	if !found {
+		return nil, diskNotFoundError(diskCID)
+	}
+	if disk.VMCID != "" {
+		return nil, cloudError("Disk '%s' is attached to VM '%s'", diskCID, disk.VMCID)
+	}
+
+	delete(inventory.Disks, diskCID)
+	return nil, nil
+}
+
+func (c *fakeCPI) attachDisk(inventory *Inventory, args []interface{}) (interface{}, *bicloud.CmdError) {
+	var vmCID, diskCID string
+	cmdErr := parseArguments(args, &vmCID, &diskCID)
+	if cmdErr != nil {
+		return nil, cmdErr
+	}
+
+	vm, disk, cmdErr := findVMAndDisk(inventory, vmCID, diskCID)
+	if cmdErr != nil {
+		return nil, cmdErr
+	}
+	if disk.VMCID != "" {
+		return nil, cloudError("Disk '%s' is already attached to VM '%s'", diskCID, disk.VMCID)
+	}
+
+	disk.VMCID = vmCID
+	vm.DiskCIDs = append(vm.DiskCIDs, diskCID)
+	inventory.Disks[diskCID] = disk
+	inventory.VMs[vmCID] = vm
+	return nil, nil
+}
+
+func (c *fakeCPI) detachDisk(inventory *Inventory, args []interface{}) (interface{}, *bicloud.CmdError) {
+	var vmCID, diskCID string
+	cmdErr := parseArguments(args, &vmCID, &diskCID)
+	if cmdErr != nil {
+		return nil, cmdErr
+	}
+
+	vm, disk, cmdErr := findVMAndDisk(inventory, vmCID, diskCID)
+	if cmdErr != nil {
+		return nil, cmdErr
+	}
+	if disk.VMCID != vmCID {
+		return nil, cloudError("Disk '%s' is not attached to VM '%s'", diskCID, vmCID)
+	}
+
+	disk.VMCID = ""
+	diskCIDs := []string{}
+	for _, attachedDiskCID := range vm.DiskCIDs {
+		if attachedDiskCID != diskCID {
+			diskCIDs = append(diskCIDs, attachedDiskCID)
+		}
+	}
+	vm.DiskCIDs = diskCIDs
+	inventory.Disks[diskCID] = disk
+	inventory.VMs[vmCID] = vm
+	return nil, nil
+}
+
+func (c *fakeCPI) hasDisk(inventory *Inventory, args []interface{}) (interface{}, *bicloud.CmdError) {
+	var diskCID string
+	cmdErr := parseArguments(args, &diskCID)
+	if cmdErr != nil {
+		return nil, cmdErr
+	}
+
+	_, found := inventory.Disks[diskCID]
+	return found, nil
+}
+
+func (c *fakeCPI) getDisks(inventory *Inventory, args []interface{}) (interface{}, *bicloud.CmdError) {
+	var vmCID string
+	cmdErr := parseArguments(args, &vmCID)
+	if cmdErr != nil {
+		return nil, cmdErr
+	}
+
+	vm, found := inventory.VMs[vmCID]
+	if !found {
+		return nil, vmNotFoundError(vmCID)
+	}
+	// the result is returned as unmarshalled JSON, as it would be by a CPI executable
+	diskCIDs := []interface{}{}
+	for _, diskCID := range vm.DiskCIDs {
+		diskCIDs = append(diskCIDs, diskCID)
+	}
+	return diskCIDs, nil
+}
+
+func (c *fakeCPI) setVMMetadata(inventory *Inventory, args []interface{}) (interface{}, *bicloud.CmdError) {
+	var vmCID string
+	var metadata map[string]string
+	cmdErr := parseArguments(args, &vmCID, &metadata)
+	if cmdErr != nil {
+		return nil, cmdErr
+	}
+
+	vm, found := inventory.VMs[vmCID]
+	if !found {
+		return nil, vmNotFoundError(vmCID)
+	}
+	vm.Metadata = metadata
+	inventory.VMs[vmCID] = vm
+	return nil, nil
+}
+
+func (c *fakeCPI) snapshotDisk(inventory *Inventory, args []interface{}) (interface{}, *bicloud.CmdError) {
+	var diskCID string
+	var metadata map[string]interface{}
+	cmdErr := parseArguments(args, &diskCID, &metadata)
+	if cmdErr != nil {
+		return nil, cmdErr
+	}
+
+	if _, found := inventory.Disks[diskCID]; !found {
+		return nil, diskNotFoundError(diskCID)
+	}
+
+	snapshotCID := nextCID(inventory, "snapshot")
+	inventory.Snapshots[snapshotCID] = Snapshot{
+		DiskCID:  diskCID,
+		Metadata: metadata,
+	}
+	return snapshotCID, nil
+}
+
+func (c *fakeCPI) deleteSnapshot(inventory *Inventory, args []interface{}) (interface{}, *bicloud.CmdError) {
+	var snapshotCID string
+	cmdErr := parseArguments(args, &snapshotCID)
+	if cmdErr != nil {
+		return nil, cmdErr
+	}
+
+	if _, found := inventory.Snapshots[snapshotCID]; !found {
+		return nil, cloudError("Snapshot '%s' not found", snapshotCID)
+	}
+	delete(inventory.Snapshots, snapshotCID)
+	return nil, nil
+}
+
+func (c *fakeCPI) rebootVM(inventory *Inventory, args []interface{}) (interface{}, *bicloud.CmdError) {
+	var vmCID string
+	cmdErr := parseArguments(args, &vmCID)
+	if cmdErr != nil {
+		return nil, cmdErr
+	}
+
+	vm, found := inventory.VMs[vmCID]
+	if !found {
+		return nil, vmNotFoundError(vmCID)
+	}
+	vm.Reboots++
+	inventory.VMs[vmCID] = vm
+	return nil, nil
+}
+
+func findVMAndDisk(inventory *Inventory, vmCID, diskCID string) (VM, Disk, *bicloud.CmdError) {
+	vm, found := inventory.VMs[vmCID]
+	if !found {
+		return VM{}, Disk{}, vmNotFoundError(vmCID)
+	}
+
+	disk, found := inventory.Disks[diskCID]
+	if !found {
+		return VM{}, Disk{}, diskNotFoundError(diskCID)
+	}
+	return vm, disk, nil
+}
+
+func vmNotFoundError(vmCID string) *bicloud.CmdError {
+	return &bicloud.CmdError{Type: bicloud.VMNotFoundError, Message: fmt.Sprintf("VM '%s' not found", vmCID)}
+}
+
+func diskNotFoundError(diskCID string) *bicloud.CmdError {
+	return &bicloud.CmdError{Type: bicloud.DiskNotFoundError, Message: fmt.Sprintf("Disk '%s' not found", diskCID)}
+}
+
+func nextCID(inventory *Inventory, prefix string) string {
+	inventory.LastID++
+	return fmt.Sprintf("%s-%d", prefix, inventory.LastID)
+}
+
+// parseArguments converts the JSON arguments into the values, which must be pointers, in order
+func parseArguments(args []interface{}, values ...interface{}) *bicloud.CmdError {
+	if len(args) != len(values) {
+		return cloudError("Expected %d arguments, got %d", len(values), len(args))
+	}
+
+	for i, arg := range args {
+		argBytes, err := json.Marshal(arg)
+		if err != nil {
+			return cloudError("Marshalling argument %d: %s", i, err.Error())
+		}
+
+		err = json.Unmarshal(argBytes, values[i])
+		if err != nil {
+			return cloudError("Unexpected argument %d '%s': %s", i, argBytes, err.Error())
+		}
+	}
+	return nil
+}
+
+func cloudError(format string, args ...interface{}) *bicloud.CmdError {
+	return &bicloud.CmdError{Type: CloudError, Message: fmt.Sprintf(format, args...)}
+}
+
+func errorOutput(err error) bicloud.CmdOutput {
+	return bicloud.CmdOutput{Error: &bicloud.CmdError{Type: CloudError, Message: err.Error()}}
+}
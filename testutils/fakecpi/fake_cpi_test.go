@@ -0,0 +1,180 @@
+package fakecpi_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	boshlog "github.com/cloudfoundry/bosh-agent/logger"
+	fakesys "github.com/cloudfoundry/bosh-agent/system/fakes"
+
+	bicloud "github.com/cloudfoundry/bosh-init/cloud"
+	biproperty "github.com/cloudfoundry/bosh-init/common/property"
+
+	. "github.com/cloudfoundry/bosh-init/testutils/fakecpi"
+)
+
+// fakeCPICmdRunner runs CPI commands with the fake CPI instead of an executable
+type fakeCPICmdRunner struct {
+	fakeCPI FakeCPI
+}
+
+func (r fakeCPICmdRunner) Run(context bicloud.CmdContext, method string, args ...interface{}) (bicloud.CmdOutput, error) {
+	return r.fakeCPI.Run(bicloud.CmdInput{Method: method, Arguments: args, Context: context}), nil
+}
+
+var _ = Describe("FakeCPI", func() {
+	var (
+		fs      *fakesys.FakeFileSystem
+		fakeCPI FakeCPI
+		cloud   bicloud.Cloud
+	)
+
+	BeforeEach(func() {
+		logger := boshlog.NewLogger(boshlog.LevelNone)
+		fs = fakesys.NewFakeFileSystem()
+		fakeCPI = NewFakeCPI("/fake-installation/inventory.json", fs, logger)
+		cloud = bicloud.NewCloud(fakeCPICmdRunner{fakeCPI: fakeCPI}, "fake-director-id", bicloud.CPIInfo{}, logger)
+
+		err := fs.WriteFileString("/fake-stemcell/image", "fake-image")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("keeps the stemcells, VMs and disks created by the cloud in the inventory", func() {
+		stemcellCID, err := cloud.CreateStemcell("/fake-stemcell/image", biproperty.Map{"fake-stemcell-property": "fake-value"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(stemcellCID).To(Equal("stemcell-1"))
+
+		vmCID, err := cloud.CreateVM("fake-agent-id", stemcellCID, biproperty.Map{}, map[string]biproperty.Map{}, biproperty.Map{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(vmCID).To(Equal("vm-2"))
+
+		found, err := cloud.HasVM(vmCID)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(found).To(BeTrue())
+
+		diskCID, err := cloud.CreateDisk(1024, biproperty.Map{}, vmCID)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(diskCID).To(Equal("disk-3"))
+
+		err = cloud.AttachDisk(vmCID, diskCID)
+		Expect(err).ToNot(HaveOccurred())
+
+		inventory, err := fakeCPI.Inventory()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(inventory.Stemcells).To(Equal(map[string]Stemcell{
+			"stemcell-1": {ImagePath: "/fake-stemcell/image", CloudProperties: map[string]interface{}{"fake-stemcell-property": "fake-value"}},
+		}))
+		Expect(inventory.VMs["vm-2"].AgentID).To(Equal("fake-agent-id"))
+		Expect(inventory.VMs["vm-2"].DiskCIDs).To(Equal([]string{"disk-3"}))
+		Expect(inventory.Disks["disk-3"]).To(Equal(Disk{Size: 1024, CloudProperties: map[string]interface{}{}, VMCID: "vm-2"}))
+	})
+
+	It("removes deleted stemcells, VMs and disks from the inventory", func() {
+		stemcellCID, err := cloud.CreateStemcell("/fake-stemcell/image", biproperty.Map{})
+		Expect(err).ToNot(HaveOccurred())
+		vmCID, err := cloud.CreateVM("fake-agent-id", stemcellCID, biproperty.Map{}, map[string]biproperty.Map{}, biproperty.Map{})
+		Expect(err).ToNot(HaveOccurred())
+		diskCID, err := cloud.CreateDisk(1024, biproperty.Map{}, vmCID)
+		Expect(err).ToNot(HaveOccurred())
+		err = cloud.AttachDisk(vmCID, diskCID)
+		Expect(err).ToNot(HaveOccurred())
+
+		err = cloud.DetachDisk(vmCID, diskCID)
+		Expect(err).ToNot(HaveOccurred())
+		err = cloud.DeleteDisk(diskCID)
+		Expect(err).ToNot(HaveOccurred())
+		err = cloud.DeleteVM(vmCID)
+		Expect(err).ToNot(HaveOccurred())
+		err = cloud.DeleteStemcell(stemcellCID)
+		Expect(err).ToNot(HaveOccurred())
+
+		inventory, err := fakeCPI.Inventory()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(inventory.Stemcells).To(BeEmpty())
+		Expect(inventory.VMs).To(BeEmpty())
+		Expect(inventory.Disks).To(BeEmpty())
+
+		found, err := cloud.HasVM(vmCID)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(found).To(BeFalse())
+	})
+
+	It("responds with a VM not found error when deleting a missing VM", func() {
+		err := cloud.DeleteVM("fake-missing-vm-cid")
+		Expect(err).To(HaveOccurred())
+
+		cpiErr, ok := err.(bicloud.Error)
+		Expect(ok).To(BeTrue())
+		Expect(cpiErr.Type()).To(Equal(bicloud.VMNotFoundError))
+	})
+
+	It("responds with a cloud error when the stemcell image does not exist", func() {
+		_, err := cloud.CreateStemcell("/fake-missing-image", biproperty.Map{})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("Stemcell image '/fake-missing-image' does not exist"))
+	})
+
+	It("reports the disks, metadata, snapshots and reboots of VMs", func() {
+		stemcellCID, err := cloud.CreateStemcell("/fake-stemcell/image", biproperty.Map{})
+		Expect(err).ToNot(HaveOccurred())
+		vmCID, err := cloud.CreateVM("fake-agent-id", stemcellCID, biproperty.Map{}, map[string]biproperty.Map{}, biproperty.Map{})
+		Expect(err).ToNot(HaveOccurred())
+		diskCID, err := cloud.CreateDisk(1024, biproperty.Map{}, vmCID)
+		Expect(err).ToNot(HaveOccurred())
+		err = cloud.AttachDisk(vmCID, diskCID)
+		Expect(err).ToNot(HaveOccurred())
+
+		found, err := cloud.HasDisk(diskCID)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(found).To(BeTrue())
+
+		diskCIDs, err := cloud.GetDisks(vmCID)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(diskCIDs).To(Equal([]string{diskCID}))
+
+		err = cloud.SetVMMetadata(vmCID, bicloud.VMMetadata{"deployment": "fake-deployment-name"})
+		Expect(err).ToNot(HaveOccurred())
+
+		err = cloud.RebootVM(vmCID)
+		Expect(err).ToNot(HaveOccurred())
+
+		snapshotCID, err := cloud.SnapshotDisk(diskCID, biproperty.Map{"job": "fake-job-name"})
+		Expect(err).ToNot(HaveOccurred())
+
+		inventory, err := fakeCPI.Inventory()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(inventory.VMs[vmCID].Metadata).To(Equal(map[string]string{"deployment": "fake-deployment-name"}))
+		Expect(inventory.VMs[vmCID].Reboots).To(Equal(1))
+		Expect(inventory.Snapshots).To(Equal(map[string]Snapshot{
+			snapshotCID: {DiskCID: diskCID, Metadata: map[string]interface{}{"job": "fake-job-name"}},
+		}))
+
+		err = cloud.DeleteSnapshot(snapshotCID)
+		Expect(err).ToNot(HaveOccurred())
+
+		inventory, err = fakeCPI.Inventory()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(inventory.Snapshots).To(BeEmpty())
+
+		found, err = cloud.HasDisk("fake-missing-disk-cid")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(found).To(BeFalse())
+	})
+
+	It("reports its API version and stemcell formats", func() {
+		cmdOutput := fakeCPI.Run(bicloud.CmdInput{Method: "info"})
+		Expect(cmdOutput.Error).To(BeNil())
+		Expect(cmdOutput.Result).To(Equal(map[string]interface{}{
+			"api_version":      bicloud.SupportedAPIVersion,
+			"stemcell_formats": []interface{}{StemcellFormat},
+		}))
+	})
+
+	It("responds with an invalid call error for unknown methods, like the Ruby CPIs", func() {
+		cmdOutput := fakeCPI.Run(bicloud.CmdInput{Method: "fake-unknown-method"})
+		Expect(cmdOutput.Error).To(Equal(&bicloud.CmdError{
+			Type:    bicloud.InvalidCallError,
+			Message: "Method is not known, got fake-unknown-method",
+		}))
+	})
+})
@@ -0,0 +1,13 @@
+package fakecpi_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestFakeCPI(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Fake CPI Suite")
+}